@@ -109,10 +109,16 @@ var (
 		utils.TrieCacheGenFlag,
 		utils.DownloadOnlyFlag,
 		utils.StorageModeFlag,
+		utils.PruneModeFlag,
 		utils.ArchiveSyncInterval,
 		utils.DatabaseFlag,
 		utils.LMDBMapSizeFlag,
 		utils.PrivateApiAddr,
+		utils.PrivateApiTLSCert,
+		utils.PrivateApiTLSKey,
+		utils.PrivateApiTLSCACert,
+		utils.PrivateApiToken,
+		utils.PrivateApiWriteToken,
 		utils.CacheNoPrefetchFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
@@ -147,6 +153,8 @@ var (
 		utils.GoerliFlag,
 		utils.YoloV1Flag,
 		utils.VMEnableDebugFlag,
+		utils.VMPrefetchStateFlag,
+		utils.VMParallelTxsFlag,
 		utils.NetworkIdFlag,
 		utils.EthStatsURLFlag,
 		utils.FakePoWFlag,
@@ -56,6 +56,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.WhitelistFlag,
 			utils.DownloadOnlyFlag,
 			utils.StorageModeFlag,
+			utils.PruneModeFlag,
 			utils.ArchiveSyncInterval,
 		},
 	},
@@ -154,6 +155,11 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
 			utils.PrivateApiAddr,
+			utils.PrivateApiTLSCert,
+			utils.PrivateApiTLSKey,
+			utils.PrivateApiTLSCACert,
+			utils.PrivateApiToken,
+			utils.PrivateApiWriteToken,
 			utils.DebugProtocolFlag,
 		},
 	},
@@ -201,6 +207,8 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Name: "VIRTUAL MACHINE",
 		Flags: []cli.Flag{
 			utils.VMEnableDebugFlag,
+			utils.VMPrefetchStateFlag,
+			utils.VMParallelTxsFlag,
 			utils.EVMInterpreterFlag,
 			utils.EWASMInterpreterFlag,
 		},
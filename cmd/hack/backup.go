@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// backup copies the database at chaindata into dir, limited to limitMB megabytes per second
+// if set. The database may be in use by a running node, an interrupt aborts the copy.
+func backup(chaindata, dir, limitMB string) error {
+	if dir == "" {
+		return errors.New("usage: hack -action backup -chaindata <chaindata> <dir> [MB per second]")
+	}
+	var limit datasize.ByteSize
+	if limitMB != "" {
+		mb, err := strconv.ParseUint(limitMB, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid limit %s: %w", limitMB, err)
+		}
+		limit = datasize.ByteSize(mb) * datasize.MB
+	}
+	kv, err := ethdb.NewLMDB().Path(chaindata).ReadOnly().Open()
+	if err != nil {
+		return err
+	}
+	defer kv.Close()
+	return ethdb.Backup(utils.RootContext(), kv, dir, limit, nil)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// diffBlock is a basic block with its instructions rendered for comparison.
+type diffBlock struct {
+	start, end int
+	skeleton   string // opcodes without push immediates
+	text       string // opcodes with push immediates
+	norm       string // like text, but with jump destinations masked out
+}
+
+func newDiffBlock(b *vm.BasicBlock) *diffBlock {
+	skeleton := make([]string, len(b.Instrs))
+	text := make([]string, len(b.Instrs))
+	norm := make([]string, len(b.Instrs))
+	for i, in := range b.Instrs {
+		skeleton[i], text[i], norm[i] = in.Op.String(), in.Op.String(), in.Op.String()
+		if in.Imm != nil {
+			text[i] = fmt.Sprintf("%s 0x%x", in.Op, in.Imm)
+			norm[i] = text[i]
+			if i+1 < len(b.Instrs) && (b.Instrs[i+1].Op == vm.JUMP || b.Instrs[i+1].Op == vm.JUMPI) {
+				norm[i] = in.Op.String() + " @"
+			}
+		}
+	}
+	return &diffBlock{start: b.Start, end: b.End, skeleton: strings.Join(skeleton, " "), text: strings.Join(text, " "), norm: strings.Join(norm, " ")}
+}
+
+// cfgFunctions maps every dispatched selector to the blocks statically reachable from
+// its entry, with jump destinations masked so that code moving around does not count
+// as a change.
+func cfgFunctions(cfg *vm.Cfg, blocks map[int]*diffBlock) map[string]map[string]int {
+	functions := make(map[string]map[string]int)
+	for _, f := range cfg.Functions {
+		body := make(map[string]int)
+		for _, pc := range f.Blocks {
+			body[blocks[pc].norm]++
+		}
+		functions[fmt.Sprintf("0x%08x", f.Selector)] = body
+	}
+	return functions
+}
+
+func diffBlocks(cfg *vm.Cfg) ([]*diffBlock, map[int]*diffBlock) {
+	list := make([]*diffBlock, len(cfg.Blocks))
+	byStart := make(map[int]*diffBlock, len(cfg.Blocks))
+	for i, b := range cfg.Blocks {
+		list[i] = newDiffBlock(b)
+		byStart[b.Start] = list[i]
+	}
+	return list, byStart
+}
+
+func readHexCode(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	code := common.FromHex(string(bytes.TrimSpace(data)))
+	if len(code) == 0 {
+		return nil, fmt.Errorf("no bytecode in %s", path)
+	}
+	return code, nil
+}
+
+// cfgDiff compares two bytecodes at the basic block level: blocks with identical
+// instructions are unchanged, blocks that only differ in push immediates (typically
+// shifted jump destinations) are changed, the rest are added or removed. Functions are
+// matched by their dispatcher selector.
+func cfgDiff(oldPath, newPath string) error {
+	oldCode, err := readHexCode(oldPath)
+	if err != nil {
+		return err
+	}
+	newCode, err := readHexCode(newPath)
+	if err != nil {
+		return err
+	}
+	oldCfg, newCfg := vm.NewCfg(oldCode), vm.NewCfg(newCode)
+	for _, cfg := range []*vm.Cfg{oldCfg, newCfg} {
+		stats := cfg.Stats()
+		fmt.Printf("Analysis: %d instructions, %d blocks, %d functions, %d/%d jumps unresolved, %s\n",
+			stats.Instructions, stats.Blocks, stats.Functions, stats.UnresolvedJumps, stats.ResolvedJumps+stats.UnresolvedJumps, stats.Duration)
+	}
+	oldBlocks, oldByStart := diffBlocks(oldCfg)
+	newBlocks, newByStart := diffBlocks(newCfg)
+
+	unmatchedOld := make(map[string][]*diffBlock)
+	for _, b := range oldBlocks {
+		unmatchedOld[b.text] = append(unmatchedOld[b.text], b)
+	}
+	var unchanged int
+	var rest []*diffBlock
+	for _, b := range newBlocks {
+		if l := unmatchedOld[b.text]; len(l) > 0 {
+			unmatchedOld[b.text] = l[1:]
+			unchanged++
+			continue
+		}
+		rest = append(rest, b)
+	}
+	bySkeleton := make(map[string][]*diffBlock)
+	for _, l := range unmatchedOld {
+		for _, b := range l {
+			bySkeleton[b.skeleton] = append(bySkeleton[b.skeleton], b)
+		}
+	}
+	var changed [][2]*diffBlock
+	var added []*diffBlock
+	for _, b := range rest {
+		if l := bySkeleton[b.skeleton]; len(l) > 0 {
+			bySkeleton[b.skeleton] = l[1:]
+			changed = append(changed, [2]*diffBlock{l[0], b})
+			continue
+		}
+		added = append(added, b)
+	}
+	var removed []*diffBlock
+	for _, l := range bySkeleton {
+		removed = append(removed, l...)
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].start < removed[j].start })
+
+	fmt.Printf("Blocks: old %d, new %d, unchanged %d, changed %d, added %d, removed %d\n",
+		len(oldBlocks), len(newBlocks), unchanged, len(changed), len(added), len(removed))
+	for _, pair := range changed {
+		fmt.Printf("  ~ [%d-%d] -> [%d-%d] %s\n", pair[0].start, pair[0].end, pair[1].start, pair[1].end, pair[1].text)
+	}
+	for _, b := range added {
+		fmt.Printf("  + [%d-%d] %s\n", b.start, b.end, b.text)
+	}
+	for _, b := range removed {
+		fmt.Printf("  - [%d-%d] %s\n", b.start, b.end, b.text)
+	}
+
+	oldFuncs, newFuncs := cfgFunctions(oldCfg, oldByStart), cfgFunctions(newCfg, newByStart)
+	selectors := make(map[string]struct{})
+	for sel := range oldFuncs {
+		selectors[sel] = struct{}{}
+	}
+	for sel := range newFuncs {
+		selectors[sel] = struct{}{}
+	}
+	sorted := make([]string, 0, len(selectors))
+	for sel := range selectors {
+		sorted = append(sorted, sel)
+	}
+	sort.Strings(sorted)
+	fmt.Printf("Functions: old %d, new %d\n", len(oldFuncs), len(newFuncs))
+	for _, sel := range sorted {
+		oldBody, inOld := oldFuncs[sel]
+		newBody, inNew := newFuncs[sel]
+		switch {
+		case !inOld:
+			fmt.Printf("  + %s (%d blocks)\n", sel, len(newBody))
+		case !inNew:
+			fmt.Printf("  - %s (%d blocks)\n", sel, len(oldBody))
+		default:
+			var plus, minus int
+			for text, n := range newBody {
+				if n > oldBody[text] {
+					plus += n - oldBody[text]
+				}
+			}
+			for text, n := range oldBody {
+				if n > newBody[text] {
+					minus += n - newBody[text]
+				}
+			}
+			if plus == 0 && minus == 0 {
+				fmt.Printf("    %s unchanged\n", sel)
+			} else {
+				fmt.Printf("  ~ %s changed (+%d -%d blocks)\n", sel, plus, minus)
+			}
+		}
+	}
+	return nil
+}
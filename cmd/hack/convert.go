@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// convert copies the database at chaindata, of the engine fromEngine, into a new database at
+// dir of the engine toEngine, e.g. from LMDB to Badger. The node must be stopped.
+func convert(chaindata, fromEngine, dir, toEngine string) error {
+	if fromEngine == "" || dir == "" || toEngine == "" {
+		return errors.New("usage: hack -action convert -chaindata <chaindata> <lmdb|bolt|badger> <dir> <lmdb|bolt|badger>")
+	}
+	from, err := ethdb.OpenKV(fromEngine, chaindata, true)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	to, err := ethdb.OpenKV(toEngine, dir, false)
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+	if err = ethdb.Convert(utils.RootContext(), from, to); err != nil {
+		return err
+	}
+	log.Info("Converted the database", "from", chaindata, "to", dir)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// datalogFacts writes the CFG of a bytecode as tab separated relation files, using the
+// relation names and the statement identifiers (hex pcs) of the Gigahorse fact generator,
+// so that the output can be fed to datalog-based decompilers and analyses:
+//
+//	IsStatement(stmt), Statement_Opcode(stmt, op), PushValue(stmt, value),
+//	Statement_Next(stmt, next), Statement_Block(stmt, block), IsBasicBlock(block),
+//	BasicBlock_Tail(block, stmt), LocalBlockEdge(from, to), ValueFlow(def, use, arg)
+//
+// Blocks are identified by their first statement. Only statically resolved jumps are
+// edges, ValueFlow is limited to values defined in the same block.
+func datalogFacts(codePath, outDir string) error {
+	code, err := readHexCode(codePath)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	cfg := vm.NewCfg(code)
+	relations := make(map[string][][]string)
+	add := func(relation string, fields ...string) {
+		relations[relation] = append(relations[relation], fields)
+	}
+	stmt := func(pc int) string { return fmt.Sprintf("0x%x", pc) }
+	var prev string
+	for _, b := range cfg.Blocks {
+		block := stmt(b.Start)
+		add("IsBasicBlock", block)
+		add("BasicBlock_Tail", block, stmt(b.Last().PC))
+		for _, succ := range b.Succs {
+			add("LocalBlockEdge", block, stmt(succ))
+		}
+		for _, in := range b.Instrs {
+			s := stmt(in.PC)
+			add("IsStatement", s)
+			add("Statement_Opcode", s, in.Op.String())
+			add("Statement_Block", s, block)
+			if in.Imm != nil {
+				add("PushValue", s, fmt.Sprintf("0x%x", in.Imm))
+			}
+			if prev != "" {
+				add("Statement_Next", prev, s)
+			}
+			prev = s
+		}
+	}
+	for _, f := range cfg.ValueFlows() {
+		add("ValueFlow", stmt(f.Def), stmt(f.Use), fmt.Sprintf("%d", f.Arg))
+	}
+	for _, relation := range []string{"IsStatement", "Statement_Opcode", "PushValue", "Statement_Next", "Statement_Block",
+		"IsBasicBlock", "BasicBlock_Tail", "LocalBlockEdge", "ValueFlow"} {
+		if err := writeFacts(filepath.Join(outDir, relation+".facts"), relations[relation]); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote %d statements, %d blocks and %d value flows to %s\n",
+		len(relations["IsStatement"]), len(cfg.Blocks), len(relations["ValueFlow"]), outDir)
+	return nil
+}
+
+func writeFacts(path string, tuples [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for _, tuple := range tuples {
+		for i, field := range tuple {
+			if i > 0 {
+				if err := w.WriteByte('\t'); err != nil {
+					return err
+				}
+			}
+			if _, err := w.WriteString(field); err != nil {
+				return err
+			}
+		}
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
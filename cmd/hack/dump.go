@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+// Formats of the bucket dumps. Both are streams of the key-value pairs in the order of the keys,
+// without a header: "lp" is the uvarint length of the key, the key, the uvarint length of the
+// value and the value; "rlp" is the RLP list [key, value].
+const (
+	dumpFormatLP  = "lp"
+	dumpFormatRLP = "rlp"
+)
+
+type dumpRecord struct {
+	Key   []byte
+	Value []byte
+}
+
+func checkDumpArgs(bucketName, format string) error {
+	if _, ok := dbutils.BucketsCfg[bucketName]; !ok {
+		return fmt.Errorf("unknown bucket %q", bucketName)
+	}
+	if format != dumpFormatLP && format != dumpFormatRLP {
+		return fmt.Errorf("unknown format %q, expected %s or %s", format, dumpFormatLP, dumpFormatRLP)
+	}
+	return nil
+}
+
+// dumpBucket writes the pairs of the bucket with keys from fromHex, inclusive, to toHex,
+// exclusive, both optional, into file, or the standard output if empty.
+func dumpBucket(chaindata, bucketName, fromHex, toHex, format, file string) error {
+	if err := checkDumpArgs(bucketName, format); err != nil {
+		return err
+	}
+	from, to := common.FromHex(fromHex), common.FromHex(toHex)
+	var out io.Writer = os.Stdout
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+
+	kv, err := ethdb.NewLMDB().Path(chaindata).ReadOnly().Open()
+	if err != nil {
+		return err
+	}
+	defer kv.Close()
+	// the values are dumped uncompressed, for the import to compress them as the database does
+	if kv, err = ethdb.WithCompression(kv); err != nil {
+		return err
+	}
+	ctx := utils.RootContext()
+	var count uint64
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	if err = kv.View(ctx, func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucketName)
+		for k, v, err := c.Seek(from); k != nil; k, v, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			if len(to) > 0 && bytes.Compare(k, to) >= 0 {
+				break
+			}
+			if err = common.Stopped(ctx.Done()); err != nil {
+				return err
+			}
+			switch format {
+			case dumpFormatLP:
+				for _, b := range [][]byte{k, v} {
+					n := binary.PutUvarint(lenBuf, uint64(len(b)))
+					if _, err = w.Write(lenBuf[:n]); err != nil {
+						return err
+					}
+					if _, err = w.Write(b); err != nil {
+						return err
+					}
+				}
+			case dumpFormatRLP:
+				if err = rlp.Encode(w, dumpRecord{k, v}); err != nil {
+					return err
+				}
+			}
+			count++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	log.Info("Dumped", "bucket", bucketName, "records", count)
+	return nil
+}
+
+// importBucket puts the pairs of a dump of the format read from file, or the standard input if
+// empty, into the bucket, overwriting the existing values of the same keys.
+func importBucket(chaindata, bucketName, format, file string) error {
+	if err := checkDumpArgs(bucketName, format); err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	r := bufio.NewReader(in)
+	next := func() ([]byte, []byte, error) {
+		switch format {
+		case dumpFormatLP:
+			var kv [2][]byte
+			for i := range kv {
+				l, err := binary.ReadUvarint(r)
+				if err != nil {
+					if i == 1 && errors.Is(err, io.EOF) {
+						err = io.ErrUnexpectedEOF
+					}
+					return nil, nil, err
+				}
+				kv[i] = make([]byte, l)
+				if _, err = io.ReadFull(r, kv[i]); err != nil {
+					return nil, nil, err
+				}
+			}
+			return kv[0], kv[1], nil
+		default:
+			var record dumpRecord
+			if err := rlp.Decode(r, &record); err != nil {
+				return nil, nil, err
+			}
+			return record.Key, record.Value, nil
+		}
+	}
+
+	db, err := ethdb.Open(chaindata)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := utils.RootContext()
+	batch := db.NewBatch()
+	defer batch.Rollback()
+	var count uint64
+	for {
+		k, v, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", count, err)
+		}
+		if err = common.Stopped(ctx.Done()); err != nil {
+			return err
+		}
+		if err = batch.Put(bucketName, k, v); err != nil {
+			return err
+		}
+		count++
+		if batch.BatchSize() >= batch.IdealBatchSize() {
+			if err = batch.CommitAndBegin(); err != nil {
+				return err
+			}
+			log.Info("Imported", "bucket", bucketName, "records", count)
+		}
+	}
+	if _, err = batch.Commit(); err != nil {
+		return err
+	}
+	log.Info("Imported", "bucket", bucketName, "records", count)
+	return nil
+}
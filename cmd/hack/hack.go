@@ -55,6 +55,9 @@ var account = flag.String("account", "0x", "specifies account to investigate")
 var name = flag.String("name", "", "name to add to the file names")
 var chaindata = flag.String("chaindata", "chaindata", "path to the chaindata database file")
 var bucket = flag.String("bucket", "", "bucket in the database")
+var fromKey = flag.String("from", "", "hex key the dump of a bucket starts at")
+var toKey = flag.String("to", "", "hex key the dump of a bucket stops before")
+var format = flag.String("format", "lp", "format of the dump of a bucket: lp (length-prefixed) or rlp")
 var hash = flag.String("hash", "0x00", "image for preimage or state root for testBlockHashes action")
 
 func check(e error) {
@@ -1736,4 +1739,44 @@ func main() {
 			fmt.Printf("Error: %v\n", err)
 		}
 	}
+	if *action == "cfgdiff" {
+		if err := cfgDiff(flag.Arg(0), flag.Arg(1)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if *action == "datalog" {
+		if err := datalogFacts(flag.Arg(0), flag.Arg(1)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if *action == "passes" {
+		if err := analysisPasses(flag.Arg(0), flag.Arg(1)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if *action == "backup" {
+		if err := backup(*chaindata, flag.Arg(0), flag.Arg(1)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if *action == "check-integrity" {
+		if err := checkIntegrity(*chaindata, flag.Arg(0), flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if *action == "dump" {
+		if err := dumpBucket(*chaindata, *bucket, *fromKey, *toKey, *format, flag.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+	if *action == "import" {
+		if err := importBucket(*chaindata, *bucket, *format, flag.Arg(0)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+	if *action == "convert" {
+		if err := convert(*chaindata, flag.Arg(0), flag.Arg(1), flag.Arg(2)); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
 }
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/eth/integrity"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// checkIntegrity verifies the database at chaindata from the block from to the block to, the
+// last executed one if empty, recomputing the state roots at the comma separated blocks of
+// stateRoots. The findings are printed as JSON lines.
+func checkIntegrity(chaindata, from, to, stateRoots string) error {
+	var cfg integrity.Config
+	var err error
+	if from != "" {
+		if cfg.From, err = strconv.ParseUint(from, 10, 64); err != nil {
+			return fmt.Errorf("invalid from block %s: %w", from, err)
+		}
+	}
+	if to != "" {
+		if cfg.To, err = strconv.ParseUint(to, 10, 64); err != nil {
+			return fmt.Errorf("invalid to block %s: %w", to, err)
+		}
+	}
+	if stateRoots != "" {
+		for _, s := range strings.Split(stateRoots, ",") {
+			block, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid state root block %s: %w", s, err)
+			}
+			cfg.StateRoots = append(cfg.StateRoots, block)
+		}
+	}
+	kv, err := ethdb.NewLMDB().Path(chaindata).ReadOnly().Open()
+	if err != nil {
+		return err
+	}
+	db := ethdb.NewObjectDatabase(kv)
+	defer db.Close()
+	findings, err := integrity.Check(utils.RootContext(), db, cfg)
+	enc := json.NewEncoder(os.Stdout)
+	for _, f := range findings {
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d findings\n", len(findings))
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+)
+
+// analysisPasses runs the comma separated analysis passes, all registered ones if empty,
+// over the bytecode and prints their reports as JSON keyed by pass name.
+func analysisPasses(codePath, passes string) error {
+	code, err := readHexCode(codePath)
+	if err != nil {
+		return err
+	}
+	names := vm.AnalysisPasses()
+	if passes != "" {
+		names = strings.Split(passes, ",")
+	}
+	cfg := vm.NewCfg(code)
+	reports := make(map[string]vm.AnalysisReport, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if reports[name], err = cfg.RunAnalysisPass(name); err != nil {
+			return err
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/spf13/cobra"
+)
+
+var cmdExportDelta = &cobra.Command{
+	Use:   "export_delta",
+	Short: "Export what the blocks after --block changed, for import_delta on a replica",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := exportDelta(); err != nil {
+			log.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+var cmdImportDelta = &cobra.Command{
+	Use:   "import_delta",
+	Short: "Apply the archive of export_delta to a replica executed up to its first block",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := importDelta(); err != nil {
+			log.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	withChaindata(cmdExportDelta)
+	withBlock(cmdExportDelta)
+	withFile(cmdExportDelta)
+
+	rootCmd.AddCommand(cmdExportDelta)
+
+	withChaindata(cmdImportDelta)
+	withFile(cmdImportDelta)
+
+	rootCmd.AddCommand(cmdImportDelta)
+}
+
+func exportDelta() error {
+	db := ethdb.MustOpen(chaindata)
+	defer db.Close()
+
+	// O_EXCL: don't overwrite a previous archive
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = stagedsync.ExportDelta(db, block, f); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+	return f.Close()
+}
+
+func importDelta() error {
+	db := ethdb.MustOpen(chaindata)
+	defer db.Close()
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = stagedsync.ImportDelta(db, f)
+	return err
+}
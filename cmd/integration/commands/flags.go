@@ -15,6 +15,9 @@ var (
 	reset              bool
 	bucket             string
 	datadir            string
+	file               string
+	dryRun             bool
+	parallelTxs        int
 )
 
 func must(err error) {
@@ -61,3 +64,17 @@ func withBucket(cmd *cobra.Command) {
 func withDatadir(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&datadir, "datadir", node.DefaultDataDir(), "data directory for temporary ELT files")
 }
+
+func withFile(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&file, "file", "", "path to the archive")
+	must(cmd.MarkFlagFilename("file"))
+	must(cmd.MarkFlagRequired("file"))
+}
+
+func withDryRun(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only log what would be done")
+}
+
+func withParallelTxs(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&parallelTxs, "parallel", 0, "execute the transactions of a block on this many threads, in order if 0")
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/migrations"
+	"github.com/spf13/cobra"
+)
+
+var cmdMigrations = &cobra.Command{
+	Use:   "migrations",
+	Short: "Apply the pending migrations of the database, or only list them with --dry-run",
+	// replaces the one of the root command, which applies the migrations
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := utils.SetupCobra(cmd); err != nil {
+			panic(err)
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyMigrations(); err != nil {
+			log.Error(err.Error())
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	withChaindata(cmdMigrations)
+	withDatadir(cmdMigrations)
+	withDryRun(cmdMigrations)
+
+	rootCmd.AddCommand(cmdMigrations)
+}
+
+func applyMigrations() error {
+	db := ethdb.MustOpen(chaindata)
+	defer db.Close()
+
+	migrator := migrations.NewMigrator()
+	migrator.DryRun = dryRun
+	return migrator.Apply(db, datadir)
+}
@@ -101,6 +101,9 @@ func resetState(_ context.Context) error {
 	if err := resetTxLookup(db); err != nil {
 		return err
 	}
+	if err := resetLogIndex(db); err != nil {
+		return err
+	}
 
 	// set genesis after reset all buckets
 	if _, _, err := core.DefaultGenesisBlock().CommitGenesisState(db, false); err != nil {
@@ -191,6 +194,24 @@ func resetTxLookup(db *ethdb.ObjectDatabase) error {
 
 	return nil
 }
+
+func resetLogIndex(db *ethdb.ObjectDatabase) error {
+	if err := db.ClearBuckets(
+		dbutils.LogAddressIndex,
+		dbutils.LogTopicIndex,
+	); err != nil {
+		return err
+	}
+	if err := stages.SaveStageProgress(db, stages.LogIndex, 0, nil); err != nil {
+		return err
+	}
+	if err := stages.SaveStageUnwind(db, stages.LogIndex, 0, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func printStages(db *ethdb.ObjectDatabase) error {
 	var err error
 	var progress uint64
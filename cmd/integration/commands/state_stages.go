@@ -24,6 +24,7 @@ var stateStags = &cobra.Command{
 			Each iteration test will move forward "--unwind_every" blocks, then unwind "--unwind" blocks.
 			Use reset_state command to re-run this test.
 			When finish all cycles, does comparison to "--reference_chaindata" if flag provided.
+			"--parallel" executes the transactions of the blocks on that many threads, to be checked against the changesets and the reference.
 		`,
 	Example: "go run ./cmd/integration state_stages --chaindata=... --verbosity=3 --unwind=100 --unwind_every=100000 --block=2000000",
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -50,6 +51,7 @@ func init() {
 	withUnwind(stateStags)
 	withUnwindEvery(stateStags)
 	withBlock(stateStags)
+	withParallelTxs(stateStags)
 
 	rootCmd.AddCommand(stateStags)
 }
@@ -87,6 +89,7 @@ func syncBySmallSteps(ctx context.Context, chaindata string) error {
 
 	bc, st, progress := newSync(ch, db, changeSetHook)
 	defer bc.Stop()
+	bc.GetVMConfig().ParallelTxs = parallelTxs
 
 	st.DisableStages(stages.Headers, stages.BlockHashes, stages.Bodies, stages.Senders, stages.TxPool)
 
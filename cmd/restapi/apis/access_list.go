@@ -0,0 +1,238 @@
+package apis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// AccessTuple is an entry of an access list, in the EIP-2930 format.
+type AccessTuple struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []common.Hash  `json:"storageKeys"`
+}
+
+// AccessListResponse is what eth_createAccessList returns: the addresses and storage keys
+// accessed by a transaction.
+type AccessListResponse struct {
+	AccessList []AccessTuple  `json:"accessList"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Error      string         `json:"error,omitempty"` // of a reverted or failed execution
+}
+
+// AccessListCall is a message executed at the start of a block. The gas defaults to the
+// gas limit of the block and the gas price to zero.
+type AccessListCall struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      *hexutil.Uint64 `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Data     hexutil.Bytes   `json:"data"`
+}
+
+func (e *Env) GetTxAccessList(c *gin.Context) {
+	hash := common.HexToHash(c.Param("hash"))
+	bn, index, bf, ok := e.lookupTx(c, hash)
+	if !ok {
+		return
+	}
+	tracer := &accessListTracer{}
+	_, receipt, err := replayTx(c.Request.Context(), hash, bn, index, c.Param("chain"), e.KV, e.DB, state.NewNoopWriter(), vm.Config{Debug: true, Tracer: tracer})
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result := AccessListResponse{AccessList: tracer.accessList(chainConfig.Rules(new(big.Int).SetUint64(bn))), GasUsed: hexutil.Uint64(receipt.GasUsed)}
+	if receipt.Status == types.ReceiptStatusFailed {
+		result.Error = "execution failed"
+	}
+	render(c, http.StatusOK, struct {
+		AccessListResponse
+		BlockFinality
+	}{result, bf})
+}
+
+func (e *Env) PostCallAccessList(c *gin.Context) {
+	var call AccessListCall
+	if err := c.ShouldBindJSON(&call); err != nil {
+		abortWithError(c, fmt.Errorf("%w: %v", ErrInvalidParam, err))
+		return
+	}
+	number, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil || number == 0 {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	result, err := CallAccessList(c.Request.Context(), call, number, c.Param("chain"), e.KV, e.DB)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	render(c, http.StatusOK, result)
+}
+
+// invalidCallError is a message that could never be included in the block, like one with
+// a wrong nonce or from an account that cannot pay for it.
+type invalidCallError struct{ err error }
+
+func (e *invalidCallError) Error() string { return e.err.Error() }
+
+func (e *invalidCallError) Unwrap() error { return ErrInvalidParam }
+
+// CallAccessList executes the call on the state after the parent of the block, in the
+// context of the block, and returns what it accessed. Without EIP-2929 the access list
+// does not change the execution, so a single run gives the final list.
+func CallAccessList(ctx context.Context, call AccessListCall, blockNumber uint64, chain string, kv ethdb.KV, db ethdb.Getter) (AccessListResponse, error) {
+	chainConfig, err := ReadChainConfig(kv, chain)
+	if err != nil {
+		return AccessListResponse{}, err
+	}
+	header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, blockNumber), blockNumber)
+	if header == nil {
+		return AccessListResponse{}, fmt.Errorf("%w: %d", ErrBlockNotFound, blockNumber)
+	}
+	gas := header.GasLimit
+	if call.Gas != nil {
+		gas = uint64(*call.Gas)
+	}
+	gasPrice, value := new(uint256.Int), new(uint256.Int)
+	if call.GasPrice != nil {
+		if overflow := gasPrice.SetFromBig(call.GasPrice.ToInt()); overflow {
+			return AccessListResponse{}, &invalidCallError{errors.New("gas price overflows 256 bits")}
+		}
+	}
+	if call.Value != nil {
+		if overflow := value.SetFromBig(call.Value.ToInt()); overflow {
+			return AccessListResponse{}, &invalidCallError{errors.New("value overflows 256 bits")}
+		}
+	}
+	msg := types.NewMessage(call.From, call.To, 0, value, gas, gasPrice, call.Data, false)
+
+	ibs := state.New(NewRemoteReader(ctx, kv, blockNumber-1))
+	tracer := &accessListTracer{}
+	evm := vm.NewEVM(core.NewEVMContext(msg, header, NewRemoteContext(kv, db, chainConfig), nil), ibs, chainConfig, vm.Config{Debug: true, Tracer: tracer, Cancel: ctx.Done()})
+	res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(gas))
+	if ctx.Err() != nil {
+		return AccessListResponse{}, ctx.Err()
+	}
+	if err != nil {
+		return AccessListResponse{}, &invalidCallError{err}
+	}
+	result := AccessListResponse{AccessList: tracer.accessList(evm.ChainConfig().Rules(header.Number)), GasUsed: hexutil.Uint64(res.UsedGas)}
+	if res.Err != nil {
+		result.Error = res.Err.Error()
+	}
+	return result, nil
+}
+
+// accessListTracer collects the addresses and storage keys accessed by the instructions
+// of a transaction, as the access list tracer of go-ethereum does.
+type accessListTracer struct {
+	from, to common.Address
+	accessed map[common.Address]map[common.Hash]struct{}
+}
+
+func (t *accessListTracer) touch(address common.Address) map[common.Hash]struct{} {
+	if t.accessed == nil {
+		t.accessed = make(map[common.Address]map[common.Hash]struct{})
+	}
+	keys, ok := t.accessed[address]
+	if !ok {
+		keys = make(map[common.Hash]struct{})
+		t.accessed[address] = keys
+	}
+	return keys
+}
+
+// accessList sorts the accessed addresses and keys, leaving out the sender, the recipient
+// and the precompiles, which are warm anyway, unless their storage was accessed.
+func (t *accessListTracer) accessList(rules params.Rules) []AccessTuple {
+	precompiles := vm.PrecompiledContractsHomestead
+	switch {
+	case rules.IsYoloV1:
+		precompiles = vm.PrecompiledContractsYoloV1
+	case rules.IsIstanbul:
+		precompiles = vm.PrecompiledContractsIstanbul
+	case rules.IsByzantium:
+		precompiles = vm.PrecompiledContractsByzantium
+	}
+	list := []AccessTuple{}
+	for address, keys := range t.accessed {
+		if _, ok := precompiles[address]; (ok || address == t.from || address == t.to) && len(keys) == 0 {
+			continue
+		}
+		tuple := AccessTuple{Address: address, StorageKeys: make([]common.Hash, 0, len(keys))}
+		for key := range keys {
+			tuple.StorageKeys = append(tuple.StorageKeys, key)
+		}
+		sort.Slice(tuple.StorageKeys, func(i, j int) bool { return bytes.Compare(tuple.StorageKeys[i][:], tuple.StorageKeys[j][:]) < 0 })
+		list = append(list, tuple)
+	}
+	sort.Slice(list, func(i, j int) bool { return bytes.Compare(list[i].Address[:], list[j].Address[:]) < 0 })
+	return list
+}
+
+func (t *accessListTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	if depth == 0 {
+		t.from, t.to = from, to
+	}
+	return nil
+}
+
+func (t *accessListTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	n := stack.Len()
+	switch {
+	case (op == vm.SLOAD || op == vm.SSTORE) && n >= 1:
+		t.touch(contract.Address())[common.Hash(stack.Back(0).Bytes32())] = struct{}{}
+	case (op == vm.EXTCODECOPY || op == vm.EXTCODEHASH || op == vm.EXTCODESIZE || op == vm.BALANCE || op == vm.SELFDESTRUCT) && n >= 1:
+		t.touch(common.Address(stack.Back(0).Bytes20()))
+	case (op == vm.CALL || op == vm.CALLCODE || op == vm.DELEGATECALL || op == vm.STATICCALL) && n >= 5:
+		t.touch(common.Address(stack.Back(1).Bytes20()))
+	}
+	return nil
+}
+
+func (t *accessListTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *accessListTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+func (t *accessListTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (t *accessListTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (t *accessListTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
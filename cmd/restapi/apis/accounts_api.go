@@ -12,22 +12,31 @@ import (
 )
 
 func RegisterAccountAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(withBlockParam)
 	router.GET(":accountID", e.GetAccount)
 	return nil
 }
 
 func (e *Env) GetAccount(c *gin.Context) {
-	account, err := findAccountByID(c.Param("accountID"), e.KV)
+	var account *accounts.Account
+	var err error
+	if blockParam(c).Latest() {
+		account, err = findAccountByID(c.Param("accountID"), e.KV)
+	} else {
+		account, err = e.findAccountAsOf(c, c.Param("accountID"))
+	}
 	if err == ErrEntityNotFound {
 		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "account not found"})
 		return
 	} else if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		abortWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, jsonifyAccount(account))
 }
 
+// jsonifyAccount keeps the snake_case root_hash and code_hash which accounts/:accountID
+// served before the camelCase fields, the account history embeds the same object.
 func jsonifyAccount(account *accounts.Account) map[string]interface{} {
 	result := map[string]interface{}{
 		"nonce":     account.Nonce,
@@ -86,3 +95,26 @@ func getPossibleKeys(accountID string) [][]byte {
 		address,
 	}
 }
+
+// findAccountAsOf reads the account as of the ?block= parameter, history is keyed by address only.
+func (e *Env) findAccountAsOf(c *gin.Context, accountID string) (*accounts.Account, error) {
+	address := common.FromHex(accountID)
+	if len(address) != common.AddressLength {
+		return nil, ErrEntityNotFound
+	}
+	var account *accounts.Account
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		cp, err := e.commitPoint(c, tx)
+		if err != nil {
+			return err
+		}
+		account, err = readAccountTx(tx, common.BytesToAddress(address), cp.Block)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, ErrEntityNotFound
+	}
+	return account, nil
+}
@@ -0,0 +1,395 @@
+package apis
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+const (
+	analysisCacheSize = 1024
+	analysisSlowest   = 20 // number of most expensive contracts kept in the statistics
+)
+
+var (
+	analysisTimer           = metrics.NewRegisteredTimer("restapi/analysis/cfg", nil)
+	analysisCacheHitMeter   = metrics.NewRegisteredMeter("restapi/analysis/cache/hit", nil)
+	analysisCacheMissMeter  = metrics.NewRegisteredMeter("restapi/analysis/cache/miss", nil)
+	analysisInstrMeter      = metrics.NewRegisteredMeter("restapi/analysis/instructions", nil)
+	analysisBlockMeter      = metrics.NewRegisteredMeter("restapi/analysis/blocks", nil)
+	analysisUnresolvedMeter = metrics.NewRegisteredMeter("restapi/analysis/jumps/unresolved", nil)
+)
+
+func RegisterAnalysisAPI(router *gin.RouterGroup, e *Env) error {
+	cache, err := lru.New(analysisCacheSize)
+	if err != nil {
+		return err
+	}
+	e.AnalysisCache = cache
+	e.AnalysisStats = &AnalysisStats{}
+	router.Use(withBlockParam)
+	router.GET(":chain/:address", e.GetAnalysis)
+	router.GET(":chain/:address/jumps/:number", e.limitReplays, e.GetJumpCheck)
+	router.GET(":chain/:address/protocol", e.GetProtocolAnalysis)
+	router.GET(":chain/:address/decompile", e.GetDecompiled)
+	return nil
+}
+
+// RegisterAnalysisStatsAPI serves the statistics of the analyses made by the routes of
+// RegisterAnalysisAPI, in a group of their own as gin allows no static segment next to :chain.
+func RegisterAnalysisStatsAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET("", e.GetAnalysisStats)
+	return nil
+}
+
+type AnalysisJumps struct {
+	Resolved   int  `json:"resolved"`
+	Unresolved int  `json:"unresolved"`
+	Complete   bool `json:"complete"` // all jumps are resolved
+}
+
+// AnalysisStorage lists constant storage slots, accesses with a computed slot are only counted.
+type AnalysisStorage struct {
+	Reads         []string `json:"reads"`
+	Writes        []string `json:"writes"`
+	MappedReads   []string `json:"mappedReads,omitempty"` // slots of mappings and dynamic arrays, e.g. 0x3[*]
+	MappedWrites  []string `json:"mappedWrites,omitempty"`
+	DynamicReads  int      `json:"dynamicReads"`
+	DynamicWrites int      `json:"dynamicWrites"`
+}
+
+type AnalysisFunction struct {
+	Selector string          `json:"selector"`
+	Name     string          `json:"name,omitempty"`
+	Entry    int             `json:"entry"`
+	Blocks   int             `json:"blocks"`
+	Storage  AnalysisStorage `json:"storage"`
+	Taint    []AnalysisTaint `json:"taint,omitempty"`
+	Memory   AnalysisMemory  `json:"memory"`
+	Refund   AnalysisRefund  `json:"refund"`
+}
+
+// AnalysisMemory is the worst-case memory of a function, Size and Gas are upper bounds
+// only if Bounded, otherwise Unbounded lists the accesses with ranges that are not constant.
+type AnalysisMemory struct {
+	Bounded   bool   `json:"bounded"`
+	Size      uint64 `json:"size"`
+	Gas       uint64 `json:"gas"`
+	Unbounded []int  `json:"unbounded,omitempty"`
+}
+
+// AnalysisRefund is the most gas a function can have refunded, before the cap of a half
+// of the gas used. Refund is an upper bound only if Bounded, otherwise Loops lists the
+// SSTOREs in loops.
+type AnalysisRefund struct {
+	Bounded      bool   `json:"bounded"`
+	Sstores      int    `json:"sstores"`
+	Selfdestruct bool   `json:"selfdestruct"`
+	Refund       uint64 `json:"refund"`
+	Loops        []int  `json:"loops,omitempty"`
+}
+
+// AnalysisTaint is a calldata value (loaded at Source) reaching a sensitive operand at Sink.
+type AnalysisTaint struct {
+	Source int    `json:"source"`
+	Sink   int    `json:"sink"`
+	Kind   string `json:"kind"`
+}
+
+type AnalysisFinding struct {
+	Kind string `json:"kind"`
+	PC   int    `json:"pc"`
+	Path []int  `json:"path,omitempty"` // data flow to the sink for overflow candidates
+
+	// for stack height conflicts, the heights and the paths of blocks they are reached by
+	Heights []int   `json:"heights,omitempty"`
+	Paths   [][]int `json:"paths,omitempty"`
+}
+
+type AnalysisResponse struct {
+	Address   common.Address     `json:"address"`
+	CodeHash  common.Hash        `json:"codeHash"`
+	CodeSize  int                `json:"codeSize"`
+	Fork      string             `json:"fork"`
+	Blocks    int                `json:"blocks"`
+	Jumps     AnalysisJumps      `json:"jumps"`
+	Functions []AnalysisFunction `json:"functions"`
+	Storage   AnalysisStorage    `json:"storage"`
+	Findings  []AnalysisFinding  `json:"findings"`
+	Stats     AnalysisRun        `json:"stats"`
+}
+
+// AnalysisRun describes one construction of a CFG.
+type AnalysisRun struct {
+	Address      common.Address `json:"address"`
+	CodeHash     common.Hash    `json:"codeHash"`
+	Instructions int            `json:"instructions"`
+	Blocks       int            `json:"blocks"`
+	Unresolved   int            `json:"unresolvedJumps"`
+	Micros       int64          `json:"micros"`
+}
+
+// AnalysisStats accumulates the cost of the analyses done since startup and keeps the
+// most expensive contracts.
+type AnalysisStats struct {
+	mu           sync.Mutex
+	Analyses     int           `json:"analyses"`
+	CacheHits    int           `json:"cacheHits"`
+	Instructions int           `json:"instructions"`
+	Unresolved   int           `json:"unresolvedJumps"`
+	Micros       int64         `json:"micros"`
+	Slowest      []AnalysisRun `json:"slowest"`
+}
+
+func (s *AnalysisStats) hit() {
+	analysisCacheHitMeter.Mark(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.CacheHits++
+}
+
+func (s *AnalysisStats) add(run AnalysisRun, stats vm.CfgStats) {
+	analysisCacheMissMeter.Mark(1)
+	analysisTimer.Update(stats.Duration)
+	analysisInstrMeter.Mark(int64(stats.Instructions))
+	analysisBlockMeter.Mark(int64(stats.Blocks))
+	analysisUnresolvedMeter.Mark(int64(stats.UnresolvedJumps))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Analyses++
+	s.Instructions += run.Instructions
+	s.Unresolved += run.Unresolved
+	s.Micros += run.Micros
+	i := sort.Search(len(s.Slowest), func(i int) bool { return s.Slowest[i].Micros < run.Micros })
+	if i == analysisSlowest {
+		return
+	}
+	s.Slowest = append(s.Slowest, AnalysisRun{})
+	copy(s.Slowest[i+1:], s.Slowest[i:])
+	s.Slowest[i] = run
+	if len(s.Slowest) > analysisSlowest {
+		s.Slowest = s.Slowest[:analysisSlowest]
+	}
+}
+
+func (s *AnalysisStats) snapshot() *AnalysisStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &AnalysisStats{
+		Analyses:     s.Analyses,
+		CacheHits:    s.CacheHits,
+		Instructions: s.Instructions,
+		Unresolved:   s.Unresolved,
+		Micros:       s.Micros,
+		Slowest:      append([]AnalysisRun(nil), s.Slowest...),
+	}
+}
+
+func (e *Env) GetAnalysisStats(c *gin.Context) {
+	render(c, http.StatusOK, e.AnalysisStats.snapshot())
+}
+
+// findingOps are instructions worth a reviewer's attention wherever they appear.
+var findingOps = map[vm.OpCode]string{
+	vm.SELFDESTRUCT: "selfdestruct",
+	vm.DELEGATECALL: "delegatecall",
+	vm.CALLCODE:     "callcode",
+	vm.ORIGIN:       "tx-origin",
+}
+
+// contractCode reads the code of the contract in the path and the rules at the requested
+// block, aborting the request if that fails or there is no code.
+func (e *Env) contractCode(c *gin.Context) (address common.Address, codeHash common.Hash, code []byte, rules params.Rules, ok bool) {
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	address = common.HexToAddress(c.Param("address"))
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		cp, err := e.commitPoint(c, tx)
+		if err != nil {
+			return err
+		}
+		rules = chainConfig.Rules(new(big.Int).SetUint64(cp.Block))
+		codeHash, code, err = readCodeTx(tx, address, cp.Block)
+		return err
+	}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if len(code) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "contract not found"})
+		return
+	}
+	return address, codeHash, code, rules, true
+}
+
+func (e *Env) GetAnalysis(c *gin.Context) {
+	address, codeHash, code, rules, ok := e.contractCode(c)
+	if !ok {
+		return
+	}
+	cfg, run := e.analyse(address, codeHash, code, rules)
+	result := analysisResponse(cfg, e.Selectors)
+	result.Address, result.CodeHash, result.CodeSize, result.Fork, result.Stats = address, codeHash, len(code), cfg.Fork, run
+	render(c, http.StatusOK, result)
+}
+
+// analysisKey identifies a cached CFG, the same code decodes differently before and after
+// the fork introducing an instruction.
+type analysisKey struct {
+	codeHash common.Hash
+	fork     string
+}
+
+// analyse returns the CFG of the code under the rules from the cache, building it on a miss.
+func (e *Env) analyse(address common.Address, codeHash common.Hash, code []byte, rules params.Rules) (*vm.Cfg, AnalysisRun) {
+	var cfg *vm.Cfg
+	key := analysisKey{codeHash, vm.ForkName(rules)}
+	cached, hit := e.AnalysisCache.Get(key)
+	if hit {
+		cfg = cached.(*vm.Cfg)
+		e.AnalysisStats.hit()
+	} else {
+		cfg = vm.NewCfgWithRules(code, rules)
+		e.AnalysisCache.Add(key, cfg)
+	}
+	stats := cfg.Stats()
+	run := AnalysisRun{
+		Address:      address,
+		CodeHash:     codeHash,
+		Instructions: stats.Instructions,
+		Blocks:       stats.Blocks,
+		Unresolved:   stats.UnresolvedJumps,
+		Micros:       int64(stats.Duration / time.Microsecond),
+	}
+	if !hit {
+		e.AnalysisStats.add(run, stats)
+	}
+	return cfg, run
+}
+
+func analysisResponse(cfg *vm.Cfg, selectors *SelectorDB) AnalysisResponse {
+	var result AnalysisResponse
+	result.Blocks = len(cfg.Blocks)
+	result.Jumps.Resolved, result.Jumps.Unresolved = cfg.JumpStats()
+	result.Jumps.Complete = result.Jumps.Unresolved == 0
+	accesses := cfg.StorageAccesses()
+	result.Storage = storageSummary(accesses, nil)
+	taint := cfg.TaintFlows()
+	memory := make(map[uint32]vm.MemoryBound, len(cfg.Functions))
+	for _, m := range cfg.MemoryBounds() {
+		memory[m.Selector] = m
+	}
+	refunds := make(map[uint32]vm.RefundBound, len(cfg.Functions))
+	for _, r := range cfg.RefundBounds() {
+		refunds[r.Selector] = r
+	}
+	for _, f := range cfg.Functions {
+		inFunction := make(map[int]bool, len(f.Blocks))
+		for _, pc := range f.Blocks {
+			inFunction[pc] = true
+		}
+		mem, refund := memory[f.Selector], refunds[f.Selector]
+		sel := [4]byte{byte(f.Selector >> 24), byte(f.Selector >> 16), byte(f.Selector >> 8), byte(f.Selector)}
+		result.Functions = append(result.Functions, AnalysisFunction{
+			Selector: fmt.Sprintf("0x%x", sel),
+			Name:     selectors.Name(sel[:]),
+			Entry:    f.Entry,
+			Blocks:   len(f.Blocks),
+			Storage:  storageSummary(accesses, inFunction),
+			Taint:    analysisTaint(taint[f.Selector]),
+			Memory:   AnalysisMemory{Bounded: mem.Bounded, Size: mem.Size, Gas: mem.Gas, Unbounded: mem.Unbounded},
+			Refund:   AnalysisRefund{Bounded: refund.Bounded, Sstores: refund.Sstores, Selfdestruct: refund.Selfdestruct, Refund: refund.Refund, Loops: refund.Loops},
+		})
+	}
+	for _, b := range cfg.Blocks {
+		for _, in := range b.Instrs {
+			if kind, ok := findingOps[in.Op]; ok {
+				result.Findings = append(result.Findings, AnalysisFinding{Kind: kind, PC: in.PC})
+			}
+		}
+		if b.Jump && !b.Resolved {
+			result.Findings = append(result.Findings, AnalysisFinding{Kind: "unresolved-jump", PC: b.Last().PC})
+		}
+	}
+	for _, o := range cfg.OverflowCandidates() {
+		result.Findings = append(result.Findings, AnalysisFinding{Kind: "overflow-candidate", PC: o.PC, Path: o.Path})
+	}
+	for _, c := range cfg.StackConflicts() {
+		result.Findings = append(result.Findings, AnalysisFinding{Kind: "stack-height-conflict", PC: c.Block, Heights: c.Heights, Paths: c.Paths})
+	}
+	sort.SliceStable(result.Findings, func(i, j int) bool { return result.Findings[i].PC < result.Findings[j].PC })
+	return result
+}
+
+func analysisTaint(flows []vm.TaintFlow) []AnalysisTaint {
+	var taint []AnalysisTaint
+	for _, f := range flows {
+		taint = append(taint, AnalysisTaint{Source: f.Source, Sink: f.Sink, Kind: f.Kind})
+	}
+	return taint
+}
+
+// storageSummary aggregates accesses of the given blocks, or of all blocks if the filter is nil.
+func storageSummary(accesses []vm.StorageAccess, blocks map[int]bool) AnalysisStorage {
+	var s AnalysisStorage
+	reads, writes := make(map[string]bool), make(map[string]bool)
+	mappedReads, mappedWrites := make(map[string]bool), make(map[string]bool)
+	for _, a := range accesses {
+		if blocks != nil && !blocks[a.Block] {
+			continue
+		}
+		if a.Key != nil {
+			if a.Op == vm.SLOAD {
+				mappedReads[a.Key.String()] = true
+			} else {
+				mappedWrites[a.Key.String()] = true
+			}
+			continue
+		}
+		if a.Slot == nil {
+			if a.Op == vm.SLOAD {
+				s.DynamicReads++
+			} else {
+				s.DynamicWrites++
+			}
+			continue
+		}
+		slot := common.BigToHash(a.Slot.ToBig()).Hex()
+		if a.Op == vm.SLOAD {
+			reads[slot] = true
+		} else {
+			writes[slot] = true
+		}
+	}
+	s.Reads, s.Writes = sortedKeys(reads), sortedKeys(writes)
+	if len(mappedReads) > 0 {
+		s.MappedReads = sortedKeys(mappedReads)
+	}
+	if len(mappedWrites) > 0 {
+		s.MappedWrites = sortedKeys(mappedWrites)
+	}
+	return s
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,146 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// maxJumpCheckBlocks bounds the blocks replayed by one jump check.
+const maxJumpCheckBlocks = 100
+
+// JumpEdge is a jump taken by the replay, with the number of times it was.
+type JumpEdge struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Count int `json:"count"`
+}
+
+// JumpCheckResponse compares the jumps a contract took in the replayed blocks with its CFG.
+// Unsound edges are missing from the CFG although it claims to know the successors of
+// their jump, those of unresolved jumps are expected to be missing.
+type JumpCheckResponse struct {
+	Address    common.Address `json:"address"`
+	CodeHash   common.Hash    `json:"codeHash"`
+	Fork       string         `json:"fork"` // instruction set the CFG is decoded with, that of the first block
+	From       uint64         `json:"from"`
+	To         uint64         `json:"to"`
+	Edges      int            `json:"edges"` // distinct edges taken
+	Unsound    []JumpEdge     `json:"unsound"`
+	Unresolved []JumpEdge     `json:"unresolved"`
+}
+
+// GetJumpCheck replays the blocks from :number to ?to= (inclusive, :number by default),
+// recording the jumps taken by the code of the address, and checks them against its CFG.
+func (e *Env) GetJumpCheck(c *gin.Context) {
+	from, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	to := from
+	if s := c.Query("to"); s != "" {
+		if to, err = strconv.ParseUint(s, 10, 64); err != nil || to < from {
+			abortWithError(c, fmt.Errorf("%w: invalid end of the block range %s", ErrInvalidParam, s))
+			return
+		}
+	}
+	if to-from >= maxJumpCheckBlocks {
+		abortWithError(c, fmt.Errorf("%w: at most %d blocks are replayed", ErrInvalidParam, maxJumpCheckBlocks))
+		return
+	}
+	// the state before the first block must be kept, the last one confirmed enough
+	for _, bn := range []uint64{from, to} {
+		if _, err = e.replayableBlock(bn); err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+	address := common.HexToAddress(c.Param("address"))
+	var codeHash common.Hash
+	var code []byte
+	if err = e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		codeHash, code, err = readCodeTx(tx, address, from-1)
+		return err
+	}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if len(code) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "contract not found"})
+		return
+	}
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	recorder := vm.NewJumpRecorder(codeHash)
+	for bn := from; bn <= to; bn++ {
+		if err = replayJumps(c.Request.Context(), bn, chainConfig, e.KV, e.DB, recorder); err != nil {
+			abortWithError(c, err)
+			return
+		}
+	}
+	cfg := vm.NewCfgWithRules(code, chainConfig.Rules(new(big.Int).SetUint64(from)))
+	result := checkJumps(cfg, recorder.Edges())
+	result.Address, result.CodeHash, result.Fork, result.From, result.To = address, codeHash, cfg.Fork, from, to
+	render(c, http.StatusOK, result)
+}
+
+// replayJumps runs the transactions of the block with the recorder as tracer. The state
+// changes are dropped, so the block is not finalized. It stops with the error of the context
+// once that is done.
+func replayJumps(ctx context.Context, bn uint64, chainConfig *params.ChainConfig, kv ethdb.KV, db ethdb.Getter, recorder *vm.JumpRecorder) error {
+	block := rawdb.ReadBlockByNumber(db, bn)
+	if block == nil {
+		return fmt.Errorf("%w: %d", ErrBlockNotFound, bn)
+	}
+	header := block.Header()
+	ibs := state.New(NewRemoteReader(ctx, kv, bn))
+	chainCtx := NewRemoteContext(kv, db, chainConfig)
+	vmConfig := vm.Config{Debug: true, Tracer: recorder, Cancel: ctx.Done()}
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	usedGas := new(uint64)
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	for _, tx := range block.Transactions() {
+		_, err := core.ApplyTransaction(chainConfig, chainCtx, nil, gp, ibs, state.NewNoopWriter(), header, tx, usedGas, vmConfig)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+		}
+	}
+	return nil
+}
+
+func checkJumps(cfg *vm.Cfg, taken map[vm.CfgEdge]int) JumpCheckResponse {
+	edges := make([]vm.CfgEdge, 0, len(taken))
+	for e := range taken {
+		edges = append(edges, e)
+	}
+	unsound, unresolved := cfg.CheckEdges(edges)
+	jumpEdges := func(edges []vm.CfgEdge) []JumpEdge {
+		list := make([]JumpEdge, len(edges))
+		for i, e := range edges {
+			list[i] = JumpEdge{From: e.From, To: e.To, Count: taken[e]}
+		}
+		return list
+	}
+	return JumpCheckResponse{Edges: len(edges), Unsound: jumpEdges(unsound), Unresolved: jumpEdges(unresolved)}
+}
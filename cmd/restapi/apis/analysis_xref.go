@@ -0,0 +1,316 @@
+package apis
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+// StorageXrefResponse compares the storage accesses of a transaction with those the CFG
+// analysis predicts for the code it executed.
+type StorageXrefResponse struct {
+	Hash        common.Hash    `json:"hash"`
+	BlockNumber uint64         `json:"blockNumber"`
+	TxIndex     uint64         `json:"txIndex"`
+	Contracts   []ContractXref `json:"contracts"`
+	Summary     XrefSummary    `json:"summary"`
+	BlockFinality
+}
+
+// ContractXref are the accesses to the storage of Address by the code of CodeHash, which
+// is not the code of Address for DELEGATECALL and contract creations. The predictions are
+// those of the functions called, or of the whole code if one of them is not found by the
+// analysis, like the fallback.
+type ContractXref struct {
+	Address         common.Address `json:"address"`
+	CodeHash        common.Hash    `json:"codeHash"`
+	Fork            string         `json:"fork"`
+	Functions       []XrefFunction `json:"functions"`
+	Scope           string         `json:"scope"` // "functions" or "code"
+	PredictedUsed   []XrefAccess   `json:"predictedUsed"`
+	PredictedUnused []XrefAccess   `json:"predictedUnused"`
+	Unpredicted     []XrefAccess   `json:"unpredicted"` // used but not predicted
+}
+
+type XrefFunction struct {
+	Selector string `json:"selector"`
+	Name     string `json:"name,omitempty"`
+}
+
+// XrefAccess is a read or write of a slot by the instruction at PC, the lowest doing it.
+// Pattern is the derived slot the analysis found at PC without being able to compute it,
+// like 0x3[*] for any key of the mapping at slot 3.
+type XrefAccess struct {
+	PC      int         `json:"pc"`
+	Op      string      `json:"op"`
+	Slot    common.Hash `json:"slot"`
+	Pattern string      `json:"pattern,omitempty"`
+}
+
+// XrefSummary counts the accesses of all contracts. Precision is the share of the predicted
+// accesses which were used, recall that of the used ones which were predicted. Derived are
+// the unpredicted accesses with a pattern.
+type XrefSummary struct {
+	Predicted       int     `json:"predicted"`
+	Used            int     `json:"used"`
+	PredictedUsed   int     `json:"predictedUsed"`
+	PredictedUnused int     `json:"predictedUnused"`
+	Unpredicted     int     `json:"unpredicted"`
+	Derived         int     `json:"derived"`
+	Precision       float64 `json:"precision"`
+	Recall          float64 `json:"recall"`
+}
+
+func (e *Env) GetTxStorageXref(c *gin.Context) {
+	hash := common.HexToHash(c.Param("hash"))
+	bn, index, bf, ok := e.lookupTx(c, hash)
+	if !ok {
+		return
+	}
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	tracer := &storageAccessTracer{codes: make(map[common.Hash][]byte)}
+	if _, _, err = replayTx(c.Request.Context(), hash, bn, index, c.Param("chain"), e.KV, e.DB, state.NewNoopWriter(), vm.Config{Debug: true, Tracer: tracer}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result := StorageXrefResponse{Hash: hash, BlockNumber: bn, TxIndex: index, Contracts: []ContractXref{}, BlockFinality: bf}
+	rules := chainConfig.Rules(new(big.Int).SetUint64(bn))
+	for _, group := range tracer.order {
+		cfg, _ := e.analyse(group.address, group.codeHash, tracer.codes[group.codeHash], rules)
+		xref := contractXref(cfg, group, e.Selectors)
+		result.Summary.add(xref)
+		result.Contracts = append(result.Contracts, xref)
+	}
+	result.Summary.ratios()
+	render(c, http.StatusOK, result)
+}
+
+// accessKey is a read or write of a slot.
+type accessKey struct {
+	op   vm.OpCode
+	slot common.Hash
+}
+
+// observedAccesses are the accesses to the storage of an address by a code.
+type observedAccesses struct {
+	address   common.Address
+	codeHash  common.Hash
+	selectors map[uint32]bool
+	create    bool // the code ran without calldata, as init code or a plain transfer
+	firstPC   map[accessKey]int
+}
+
+func contractXref(cfg *vm.Cfg, observed *observedAccesses, names *SelectorDB) ContractXref {
+	xref := ContractXref{
+		Address:         observed.address,
+		CodeHash:        observed.codeHash,
+		Fork:            cfg.Fork,
+		Functions:       []XrefFunction{},
+		Scope:           "code",
+		PredictedUsed:   []XrefAccess{},
+		PredictedUnused: []XrefAccess{},
+		Unpredicted:     []XrefAccess{},
+	}
+	var inScope map[int]bool
+	if !observed.create && len(observed.selectors) > 0 {
+		inScope = make(map[int]bool)
+		found := 0
+		for _, f := range cfg.Functions {
+			if observed.selectors[f.Selector] {
+				found++
+				for _, pc := range f.Blocks {
+					inScope[pc] = true
+				}
+			}
+		}
+		if found == len(observed.selectors) {
+			xref.Scope = "functions"
+		} else {
+			inScope = nil
+		}
+	}
+	for selector := range observed.selectors {
+		sel := [4]byte{byte(selector >> 24), byte(selector >> 16), byte(selector >> 8), byte(selector)}
+		xref.Functions = append(xref.Functions, XrefFunction{Selector: fmt.Sprintf("0x%x", sel), Name: names.Name(sel[:])})
+	}
+	sort.Slice(xref.Functions, func(i, j int) bool { return xref.Functions[i].Selector < xref.Functions[j].Selector })
+
+	predicted := make(map[accessKey]int)
+	patterns := make(map[int]string)
+	for _, a := range cfg.StorageAccesses() {
+		if inScope != nil && !inScope[a.Block] {
+			continue
+		}
+		var slot common.Hash
+		switch {
+		case a.Key != nil:
+			var ok bool
+			if slot, ok = derivedSlot(a.Key); !ok {
+				patterns[a.PC] = a.Key.String()
+				continue
+			}
+		case a.Slot != nil:
+			slot = common.Hash(a.Slot.Bytes32())
+		default:
+			continue
+		}
+		key := accessKey{a.Op, slot}
+		if pc, ok := predicted[key]; !ok || a.PC < pc {
+			predicted[key] = a.PC
+		}
+	}
+
+	for key, pc := range observed.firstPC {
+		access := XrefAccess{PC: pc, Op: key.op.String(), Slot: key.slot}
+		if _, ok := predicted[key]; ok {
+			xref.PredictedUsed = append(xref.PredictedUsed, access)
+			continue
+		}
+		access.Pattern = patterns[pc]
+		xref.Unpredicted = append(xref.Unpredicted, access)
+	}
+	for key, pc := range predicted {
+		if _, ok := observed.firstPC[key]; !ok {
+			xref.PredictedUnused = append(xref.PredictedUnused, XrefAccess{PC: pc, Op: key.op.String(), Slot: key.slot})
+		}
+	}
+	for _, list := range [][]XrefAccess{xref.PredictedUsed, xref.PredictedUnused, xref.Unpredicted} {
+		sortXrefAccesses(list)
+	}
+	return xref
+}
+
+func sortXrefAccesses(list []XrefAccess) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].PC != list[j].PC {
+			return list[i].PC < list[j].PC
+		}
+		return bytes.Compare(list[i].Slot[:], list[j].Slot[:]) < 0
+	})
+}
+
+// derivedSlot computes the slot of a storage key whose bases and indices are constants.
+func derivedSlot(k *vm.StorageKey) (common.Hash, bool) {
+	var base common.Hash
+	switch {
+	case k.Parent != nil:
+		var ok bool
+		if base, ok = derivedSlot(k.Parent); !ok {
+			return common.Hash{}, false
+		}
+	case k.Base != nil:
+		base = common.Hash(k.Base.Bytes32())
+	default:
+		return common.Hash{}, false
+	}
+	if k.Key == nil {
+		return common.Hash{}, false
+	}
+	if k.Mapping {
+		key := k.Key.Bytes32()
+		return crypto.Keccak256Hash(key[:], base[:]), true
+	}
+	start := new(uint256.Int).SetBytes(crypto.Keccak256(base[:]))
+	return common.Hash(start.Add(start, k.Key).Bytes32()), true
+}
+
+func (s *XrefSummary) add(xref ContractXref) {
+	s.PredictedUsed += len(xref.PredictedUsed)
+	s.PredictedUnused += len(xref.PredictedUnused)
+	s.Unpredicted += len(xref.Unpredicted)
+	for _, a := range xref.Unpredicted {
+		if a.Pattern != "" {
+			s.Derived++
+		}
+	}
+	s.Predicted = s.PredictedUsed + s.PredictedUnused
+	s.Used = s.PredictedUsed + s.Unpredicted
+}
+
+func (s *XrefSummary) ratios() {
+	if s.Predicted > 0 {
+		s.Precision = float64(s.PredictedUsed) / float64(s.Predicted)
+	}
+	if s.Used > 0 {
+		s.Recall = float64(s.PredictedUsed) / float64(s.Used)
+	}
+}
+
+// storageAccessTracer records the SLOAD and SSTORE instructions of a transaction, grouped
+// by the storage and the code, keeping the code for the analysis.
+type storageAccessTracer struct {
+	codes    map[common.Hash][]byte
+	observed map[[2]common.Hash]*observedAccesses
+	order    []*observedAccesses // as first accessed
+}
+
+func (t *storageAccessTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (t *storageAccessTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if (op != vm.SLOAD && op != vm.SSTORE) || stack.Len() < 1 {
+		return nil
+	}
+	codeHash := contract.CodeHash
+	if codeHash == (common.Hash{}) {
+		codeHash = crypto.Keccak256Hash(contract.Code)
+	}
+	address := contract.Address()
+	id := [2]common.Hash{address.Hash(), codeHash}
+	if t.observed == nil {
+		t.observed = make(map[[2]common.Hash]*observedAccesses)
+	}
+	o, ok := t.observed[id]
+	if !ok {
+		o = &observedAccesses{address: address, codeHash: codeHash, selectors: make(map[uint32]bool), firstPC: make(map[accessKey]int)}
+		t.observed[id] = o
+		t.order = append(t.order, o)
+		t.codes[codeHash] = contract.Code
+	}
+	if len(contract.Input) >= 4 {
+		o.selectors[uint32(contract.Input[0])<<24|uint32(contract.Input[1])<<16|uint32(contract.Input[2])<<8|uint32(contract.Input[3])] = true
+	} else {
+		o.create = true
+	}
+	key := accessKey{op, common.Hash(stack.Back(0).Bytes32())}
+	if first, ok := o.firstPC[key]; !ok || int(pc) < first {
+		o.firstPC[key] = int(pc)
+	}
+	return nil
+}
+
+func (t *storageAccessTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *storageAccessTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+func (t *storageAccessTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (t *storageAccessTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (t *storageAccessTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
@@ -0,0 +1,243 @@
+package apis
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scope is what a credential may do. Read covers every route serving chain data, Admin
+// also the routes changing the server, like switching the database or the finalized block.
+type Scope int
+
+const (
+	ScopeRead Scope = iota
+	ScopeAdmin
+)
+
+const (
+	authScopeKey  = "authScope"
+	authClientKey = "authClient"
+)
+
+func ParseScope(s string) (Scope, error) {
+	switch s {
+	case "read":
+		return ScopeRead, nil
+	case "admin":
+		return ScopeAdmin, nil
+	}
+	return 0, fmt.Errorf("unknown scope %q, expected read or admin", s)
+}
+
+// Auth checks the credentials of requests: static API keys, or JWTs signed with a shared
+// HMAC secret carrying the scope in a "scope" claim. Both are sent as
+// "Authorization: Bearer <credential>", API keys also as "X-API-Key: <key>".
+type Auth struct {
+	keys      []apiKey
+	jwtSecret []byte
+}
+
+type apiKey struct {
+	key   []byte
+	scope Scope
+	id    string
+}
+
+// NewAuth returns nil, which disables authentication, if there are neither keys nor a secret.
+func NewAuth(keys map[string]Scope, jwtSecret []byte) *Auth {
+	if len(keys) == 0 && len(jwtSecret) == 0 {
+		return nil
+	}
+	a := &Auth{jwtSecret: jwtSecret}
+	for key, scope := range keys {
+		sum := sha256.Sum256([]byte(key))
+		a.keys = append(a.keys, apiKey{key: []byte(key), scope: scope, id: "key:" + hex.EncodeToString(sum[:8])})
+	}
+	return a
+}
+
+// LoadAPIKeys reads a file with one "<scope> <key>" per line, empty lines and lines
+// starting with # are skipped.
+func LoadAPIKeys(path string) (map[string]Scope, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys := make(map[string]Scope)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<scope> <key>\"", path, n)
+		}
+		scope, err := ParseScope(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		keys[fields[1]] = scope
+	}
+	return keys, scanner.Err()
+}
+
+// LoadJWTSecret reads the HMAC secret from a file, as 0x-prefixed hex or as is.
+func LoadJWTSecret(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(b))
+	secret := []byte(s)
+	if strings.HasPrefix(s, "0x") {
+		if secret, err = hex.DecodeString(s[2:]); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s: empty secret", path)
+	}
+	return secret, nil
+}
+
+// Middleware rejects requests without valid credentials with 401 and records the scope
+// and the identity of the client for requireAdmin and the rate limits.
+func (a *Auth) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next() // CORS preflight requests carry no credentials
+			return
+		}
+		scope, client, err := a.check(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+			return
+		}
+		c.Set(authScopeKey, scope)
+		c.Set(authClientKey, client)
+		c.Next()
+	}
+}
+
+func (a *Auth) check(r *http.Request) (Scope, string, error) {
+	credential := r.Header.Get("X-API-Key")
+	if h := r.Header.Get("Authorization"); credential == "" && h != "" {
+		if !strings.HasPrefix(h, "Bearer ") {
+			return 0, "", errors.New("expected a bearer token")
+		}
+		credential = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if credential == "" {
+		return 0, "", errors.New("missing credentials")
+	}
+	var found *apiKey
+	for i := range a.keys {
+		// compare with every key in constant time, not to leak how much of a key matched
+		if subtle.ConstantTimeCompare(a.keys[i].key, []byte(credential)) == 1 {
+			found = &a.keys[i]
+		}
+	}
+	if found != nil {
+		return found.scope, found.id, nil
+	}
+	if len(a.jwtSecret) > 0 && strings.Count(credential, ".") == 2 {
+		return a.checkJWT(credential, time.Now())
+	}
+	return 0, "", errors.New("invalid credentials")
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Scope     string `json:"scope"`
+	ExpiresAt *int64 `json:"exp"`
+	NotBefore *int64 `json:"nbf"`
+}
+
+// checkJWT verifies a JWT signed with HS256, HS384 or HS512. The scope defaults to read.
+func (a *Auth) checkJWT(token string, now time.Time) (Scope, string, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return 0, "", err
+	}
+	var h func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		h = sha256.New
+	case "HS384":
+		h = sha512.New384
+	case "HS512":
+		h = sha512.New
+	default:
+		return 0, "", fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, "", errors.New("invalid token signature")
+	}
+	mac := hmac.New(h, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return 0, "", errors.New("invalid token signature")
+	}
+	var claims jwtClaims
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return 0, "", err
+	}
+	if claims.ExpiresAt != nil && now.Unix() >= *claims.ExpiresAt {
+		return 0, "", errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Unix() < *claims.NotBefore {
+		return 0, "", errors.New("token not valid yet")
+	}
+	scope := ScopeRead
+	if claims.Scope != "" {
+		if scope, err = ParseScope(claims.Scope); err != nil {
+			return 0, "", err
+		}
+	}
+	return scope, "jwt:" + claims.Subject, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("invalid token encoding")
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return errors.New("invalid token encoding")
+	}
+	return nil
+}
+
+// requireAdmin guards routes changing the server. Without authentication configured
+// every request is let through, as before.
+func requireAdmin(c *gin.Context) {
+	if scope, ok := c.Get(authScopeKey); ok && scope.(Scope) < ScopeAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "admin scope required"})
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,118 @@
+package apis
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signJWT returns a JWT of the claims signed with HS256, or with the header given.
+func signJWT(t *testing.T, secret []byte, header string, claims map[string]interface{}) string {
+	if header == "" {
+		header = `{"alg":"HS256","typ":"JWT"}`
+	}
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("secret")
+	auth := NewAuth(map[string]Scope{"reader": ScopeRead, "admin": ScopeAdmin}, secret)
+	e := newTestEnv(t)
+	defer e.KV.Close()
+	r := newTestRouter(t, e, auth)
+	now := time.Now().Unix()
+
+	bearer := func(credential string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + credential}}
+	}
+	for _, tt := range []struct {
+		name   string
+		header http.Header
+		read   int // status of GET finality
+		admin  int // status of POST finality
+	}{
+		{"none", nil, http.StatusUnauthorized, http.StatusUnauthorized},
+		{"unknown key", http.Header{"X-Api-Key": {"other"}}, http.StatusUnauthorized, http.StatusUnauthorized},
+		{"basic", http.Header{"Authorization": {"Basic cmVhZGVyOg=="}}, http.StatusUnauthorized, http.StatusUnauthorized},
+		{"read key", http.Header{"X-Api-Key": {"reader"}}, http.StatusOK, http.StatusForbidden},
+		{"read key as bearer", bearer("reader"), http.StatusOK, http.StatusForbidden},
+		{"admin key", bearer("admin"), http.StatusOK, http.StatusOK},
+		{"jwt read by default", bearer(signJWT(t, secret, "", map[string]interface{}{"sub": "a"})), http.StatusOK, http.StatusForbidden},
+		{"jwt admin", bearer(signJWT(t, secret, "", map[string]interface{}{"sub": "a", "scope": "admin", "exp": now + 60})), http.StatusOK, http.StatusOK},
+		{"jwt unknown scope", bearer(signJWT(t, secret, "", map[string]interface{}{"scope": "root"})), http.StatusUnauthorized, http.StatusUnauthorized},
+		{"jwt expired", bearer(signJWT(t, secret, "", map[string]interface{}{"scope": "admin", "exp": now - 1})), http.StatusUnauthorized, http.StatusUnauthorized},
+		{"jwt not valid yet", bearer(signJWT(t, secret, "", map[string]interface{}{"nbf": now + 60})), http.StatusUnauthorized, http.StatusUnauthorized},
+		{"jwt other secret", bearer(signJWT(t, []byte("other"), "", map[string]interface{}{"scope": "admin"})), http.StatusUnauthorized, http.StatusUnauthorized},
+		{"jwt none algorithm", bearer(signJWT(t, secret, `{"alg":"none"}`, map[string]interface{}{"scope": "admin"})), http.StatusUnauthorized, http.StatusUnauthorized},
+	} {
+		w := serve(r, http.MethodGet, "/api/v1/finality/", tt.header)
+		assert.Equal(t, tt.read, w.Code, "%s: read %s", tt.name, w.Body)
+		if w.Code == http.StatusUnauthorized {
+			assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"), tt.name)
+		}
+		w = serve(r, http.MethodPost, "/api/v1/finality/?number=5", tt.header)
+		assert.Equal(t, tt.admin, w.Code, "%s: admin %s", tt.name, w.Body)
+	}
+
+	// the routes outside of api/v1 are not authenticated
+	assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/openapi.json", nil).Code)
+	// nor are CORS preflight requests
+	assert.NotEqual(t, http.StatusUnauthorized, serve(r, http.MethodOptions, "/api/v1/finality/", nil).Code)
+}
+
+func TestNoAuth(t *testing.T) {
+	assert.Nil(t, NewAuth(nil, nil))
+	e := newTestEnv(t)
+	defer e.KV.Close()
+	r := newTestRouter(t, e, nil)
+	assert.Equal(t, http.StatusOK, serve(r, http.MethodGet, "/api/v1/finality/", nil).Code)
+	// requireAdmin lets every request through
+	assert.Equal(t, http.StatusOK, serve(r, http.MethodPost, "/api/v1/finality/?number=5", nil).Code)
+}
+
+func TestLoadAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restapi-auth")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	keys, err := LoadAPIKeys(write("keys", "# comment\n\nread k1\nadmin  k2 \n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Scope{"k1": ScopeRead, "k2": ScopeAdmin}, keys)
+	_, err = LoadAPIKeys(write("no-scope", "k1\n"))
+	assert.Error(t, err)
+	_, err = LoadAPIKeys(write("bad-scope", "root k1\n"))
+	assert.Error(t, err)
+
+	secret, err := LoadJWTSecret(write("hex", "0x0102\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2}, secret)
+	secret, err = LoadJWTSecret(write("text", " secret\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), secret)
+	_, err = LoadJWTSecret(write("empty", "\n"))
+	assert.Error(t, err)
+	_, err = LoadJWTSecret(write("empty-hex", "0x\n"))
+	assert.Error(t, err)
+	_, err = LoadJWTSecret(write("bad-hex", "0x0g\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,228 @@
+package apis
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+const maxBatchReads = 1000
+
+func RegisterBatchAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(withBlockParam)
+	router.POST("/", e.BatchRead)
+	return nil
+}
+
+// BatchReadRequest is a list of heterogeneous reads executed against a single database
+// transaction. Type is one of "account", "storage", "code" and "header".
+type BatchReadRequest struct {
+	Block *uint64     `json:"block"` // state as of the end of this block, the ?block= parameter if omitted
+	Reads []BatchRead `json:"reads"`
+}
+
+type BatchRead struct {
+	Type    string         `json:"type"`
+	Address common.Address `json:"address"`
+	Slot    common.Hash    `json:"slot"`
+	Number  uint64         `json:"number"`
+}
+
+// CommitPoint identifies the database state all reads of a request observed.
+type CommitPoint struct {
+	Head  uint64 `json:"head"`
+	Block uint64 `json:"block"`
+}
+
+// at overrides the block with one given in a request body.
+func (cp CommitPoint) at(block *uint64) (CommitPoint, error) {
+	if block == nil {
+		return cp, nil
+	}
+	if *block > cp.Head {
+		return cp, fmt.Errorf("%w: block %d is beyond the head %d", ErrBlockNotFound, *block, cp.Head)
+	}
+	cp.Block = *block
+	return cp, nil
+}
+
+type BatchReadResult struct {
+	Error   string            `json:"error,omitempty"`
+	Account *BatchAccount     `json:"account,omitempty"`
+	Value   hexutil.Bytes     `json:"value,omitempty"`
+	Header  map[string]string `json:"header,omitempty"`
+}
+
+type BatchAccount struct {
+	Nonce       uint64      `json:"nonce"`
+	Balance     string      `json:"balance"`
+	CodeHash    common.Hash `json:"codeHash"`
+	Incarnation uint64      `json:"incarnation"`
+}
+
+type BatchReadResponse struct {
+	CommitPoint CommitPoint       `json:"commitPoint"`
+	Results     []BatchReadResult `json:"results"`
+}
+
+func (e *Env) BatchRead(c *gin.Context) {
+	var req BatchReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if len(req.Reads) > maxBatchReads {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("at most %d reads per batch", maxBatchReads)})
+		return
+	}
+	var resp BatchReadResponse
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		cp, err := e.commitPoint(c, tx)
+		if err != nil {
+			return err
+		}
+		if cp, err = cp.at(req.Block); err != nil {
+			return err
+		}
+		resp = batchRead(tx, cp, req.Reads)
+		return nil
+	}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	render(c, http.StatusOK, resp)
+}
+
+// batchRead performs all reads as of the commit point block. With a local database all of
+// them share one transaction; the remote KV may reopen transactions between cursors, but
+// because state is read through history as of a fixed block, a head advancing during the
+// batch does not change the results.
+func batchRead(tx ethdb.Tx, cp CommitPoint, reads []BatchRead) BatchReadResponse {
+	resp := BatchReadResponse{CommitPoint: cp}
+	blockNr := resp.CommitPoint.Block
+	getter := txGetter{tx}
+	resp.Results = make([]BatchReadResult, len(reads))
+	for i, read := range reads {
+		var res BatchReadResult
+		var err error
+		switch read.Type {
+		case "account":
+			var acc *accounts.Account
+			if acc, err = readAccountTx(tx, read.Address, blockNr); err == nil && acc != nil {
+				res.Account = &BatchAccount{Nonce: acc.Nonce, Balance: acc.Balance.ToBig().String(), CodeHash: acc.CodeHash, Incarnation: acc.Incarnation}
+			}
+		case "storage":
+			var acc *accounts.Account
+			if acc, err = readAccountTx(tx, read.Address, blockNr); err == nil && acc != nil {
+				res.Value, err = readStorageTx(tx, read.Address, acc.Incarnation, read.Slot, blockNr)
+			}
+		case "code":
+			_, res.Value, err = readCodeTx(tx, read.Address, blockNr)
+		case "header":
+			if read.Number > resp.CommitPoint.Head {
+				err = fmt.Errorf("header %d is beyond the head %d", read.Number, resp.CommitPoint.Head)
+				break
+			}
+			hash := rawdb.ReadCanonicalHash(getter, read.Number)
+			if header := rawdb.ReadHeader(getter, hash, read.Number); header != nil {
+				res.Header = map[string]string{
+					"hash":       header.Hash().Hex(),
+					"parentHash": header.ParentHash.Hex(),
+					"stateRoot":  header.Root.Hex(),
+					"timestamp":  fmt.Sprintf("%d", header.Time),
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown read type %q", read.Type)
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		resp.Results[i] = res
+	}
+	return resp
+}
+
+func readAccountTx(tx ethdb.Tx, address common.Address, blockNr uint64) (*accounts.Account, error) {
+	enc, err := state.NewHistoryTx(tx, blockNr).Get(dbutils.PlainStateBucket, address[:])
+	if err != nil || enc == nil {
+		return nil, err
+	}
+	var acc accounts.Account
+	if err := acc.DecodeForStorage(enc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// headTx returns the highest block for which state is available.
+func headTx(tx ethdb.Tx) (uint64, error) {
+	v, err := tx.Get(dbutils.SyncStageProgress, stages.DBKeys[stages.Execution])
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return 0, err
+	}
+	if len(v) < 8 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v[:8]), nil
+}
+
+// readCodeTx returns the code of the account as of the given block, nil for accounts without code.
+func readCodeTx(tx ethdb.Tx, address common.Address, blockNr uint64) (common.Hash, []byte, error) {
+	acc, err := readAccountTx(tx, address, blockNr)
+	if err != nil || acc == nil {
+		return common.Hash{}, nil, err
+	}
+	codeHash := acc.CodeHash
+	if acc.IsEmptyCodeHash() && acc.Incarnation > 0 {
+		// plain state keeps code hashes of contracts separately
+		v, err := tx.Get(dbutils.PlainContractCodeBucket, dbutils.PlainGenerateStoragePrefix(address[:], acc.Incarnation))
+		if err != nil {
+			return common.Hash{}, nil, err
+		}
+		if len(v) > 0 {
+			codeHash = common.BytesToHash(v)
+		}
+	}
+	if codeHash == (common.Hash{}) || codeHash == emptyCodeHash {
+		return codeHash, nil, nil
+	}
+	code, err := tx.Get(dbutils.CodeBucket, codeHash[:])
+	return codeHash, common.CopyBytes(code), err
+}
+
+func readStorageTx(tx ethdb.Tx, address common.Address, incarnation uint64, slot common.Hash, blockNr uint64) ([]byte, error) {
+	return state.NewHistoryTx(tx, blockNr).Get(dbutils.PlainStateBucket, dbutils.PlainGenerateCompositeStorageKey(address, incarnation, slot))
+}
+
+// txGetter adapts ethdb.Tx to rawdb.DatabaseReader, so rawdb accessors read within the transaction.
+type txGetter struct {
+	tx ethdb.Tx
+}
+
+func (g txGetter) Get(bucket string, key []byte) ([]byte, error) {
+	v, err := g.tx.Get(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ethdb.ErrKeyNotFound
+	}
+	return v, nil
+}
+
+func (g txGetter) Has(bucket string, key []byte) (bool, error) {
+	v, err := g.tx.Get(bucket, key)
+	return v != nil, err
+}
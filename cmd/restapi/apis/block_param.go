@@ -0,0 +1,120 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+const blockParamKey = "blockParam"
+
+// ErrBlockNotFound is returned for a ?block= referring to an unknown hash or a block beyond the head.
+var ErrBlockNotFound = errors.New("block not found")
+
+// BlockParam is the parsed ?block= query parameter: a decimal or 0x-prefixed hex number,
+// a block hash, or one of the tags "latest" (the default), "earliest" and "finalized".
+type BlockParam struct {
+	Number *uint64
+	Hash   *common.Hash
+	Tag    string
+}
+
+func ParseBlockParam(s string) (BlockParam, error) {
+	switch s {
+	case "", "latest":
+		return BlockParam{Tag: "latest"}, nil
+	case "earliest", "finalized":
+		return BlockParam{Tag: s}, nil
+	}
+	if strings.HasPrefix(s, "0x") && len(s) == 2+2*common.HashLength {
+		hash := common.HexToHash(s)
+		return BlockParam{Hash: &hash}, nil
+	}
+	var number uint64
+	var err error
+	if strings.HasPrefix(s, "0x") {
+		number, err = hexutil.DecodeUint64(s)
+	} else {
+		number, err = strconv.ParseUint(s, 10, 64)
+	}
+	if err != nil {
+		return BlockParam{}, fmt.Errorf("invalid block %q, expected a number, a hash, latest, earliest or finalized", s)
+	}
+	return BlockParam{Number: &number}, nil
+}
+
+// Latest tells if the parameter refers to the head, so that current state can be read directly.
+func (p BlockParam) Latest() bool {
+	return p.Tag == "latest"
+}
+
+// Resolve returns the commit point the parameter refers to within the transaction.
+func (p BlockParam) Resolve(tx ethdb.Tx, finality *Finality) (CommitPoint, error) {
+	head, err := headTx(tx)
+	if err != nil {
+		return CommitPoint{}, err
+	}
+	cp := CommitPoint{Head: head, Block: head}
+	switch {
+	case p.Number != nil:
+		cp.Block = *p.Number
+	case p.Hash != nil:
+		number := rawdb.ReadHeaderNumber(txGetter{tx}, *p.Hash)
+		if number == nil || rawdb.ReadCanonicalHash(txGetter{tx}, *number) != *p.Hash {
+			return cp, fmt.Errorf("%w: no canonical block %x", ErrBlockNotFound, *p.Hash)
+		}
+		cp.Block = *number
+	case p.Tag == "earliest":
+		cp.Block = 0
+	case p.Tag == "finalized":
+		finalized, ok := finality.Finalized()
+		if !ok {
+			return cp, fmt.Errorf("%w: no finalized block is known", ErrBlockNotFound)
+		}
+		cp.Block = finalized
+	}
+	if cp.Block > head {
+		return cp, fmt.Errorf("%w: block %d is beyond the head %d", ErrBlockNotFound, cp.Block, head)
+	}
+	return cp, nil
+}
+
+// withBlockParam is a middleware parsing ?block= once per request, handlers resolve it with commitPoint.
+func withBlockParam(c *gin.Context) {
+	p, err := ParseBlockParam(c.Query("block"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.Set(blockParamKey, p)
+	c.Next()
+}
+
+// withoutBlockParam rejects ?block= for endpoints reading data without history, rather than
+// silently serving the head.
+func withoutBlockParam(c *gin.Context) {
+	if c.Query("block") != "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "block parameter is not supported, only the latest state is kept"})
+		return
+	}
+	c.Next()
+}
+
+func blockParam(c *gin.Context) BlockParam {
+	if p, ok := c.Get(blockParamKey); ok {
+		return p.(BlockParam)
+	}
+	return BlockParam{Tag: "latest"}
+}
+
+func (e *Env) commitPoint(c *gin.Context, tx ethdb.Tx) (CommitPoint, error) {
+	return blockParam(c).Resolve(tx, e.Finality)
+}
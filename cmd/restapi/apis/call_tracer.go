@@ -0,0 +1,134 @@
+package apis
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+)
+
+// CallFrame is a call or contract creation with the calls it made.
+type CallFrame struct {
+	Type    string         `json:"type"`
+	Name    string         `json:"name,omitempty"` // signature of the selector of the input, see nameCalls
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+	Value   *hexutil.Big   `json:"value,omitempty"` // not set for delegate calls
+	Gas     hexutil.Uint64 `json:"gas"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Input   hexutil.Bytes  `json:"input"`
+	Output  hexutil.Bytes  `json:"output,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Calls   []*CallFrame   `json:"calls,omitempty"`
+}
+
+// TxCalls is the call tree of a transaction.
+type TxCalls struct {
+	Hash common.Hash `json:"hash"`
+	Call *CallFrame  `json:"call"`
+}
+
+// nameCalls returns a copy of the call trees with every frame named from the selector
+// database. The trees may be cached while the database keeps growing, so they are named
+// when rendered rather than when traced.
+func nameCalls(calls []TxCalls, names *SelectorDB) []TxCalls {
+	if calls == nil || names == nil {
+		return calls
+	}
+	named := make([]TxCalls, len(calls))
+	for i, tx := range calls {
+		named[i] = TxCalls{Hash: tx.Hash, Call: nameFrame(tx.Call, names)}
+	}
+	return named
+}
+
+func nameFrame(frame *CallFrame, names *SelectorDB) *CallFrame {
+	if frame == nil {
+		return nil
+	}
+	named := *frame
+	if frame.Type != vm.CREATE.String() && frame.Type != vm.CREATE2.String() {
+		named.Name = names.Name(frame.Input)
+	}
+	if frame.Calls != nil {
+		named.Calls = make([]*CallFrame, len(frame.Calls))
+		for i, call := range frame.Calls {
+			named.Calls[i] = nameFrame(call, names)
+		}
+	}
+	return &named
+}
+
+// callTracer builds the call tree of a transaction from the frames told to a FrameTracer.
+type callTracer struct {
+	root   *CallFrame
+	frames []*CallFrame
+}
+
+var _ vm.FrameTracer = (*callTracer)(nil)
+
+// take returns the call tree of the last transaction and resets the tracer.
+func (t *callTracer) take() *CallFrame {
+	root := t.root
+	t.root, t.frames = nil, nil
+	return root
+}
+
+func (t *callTracer) CaptureEnter(typ vm.OpCode, depth int, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	frame := &CallFrame{Type: typ.String(), From: from, To: to, Gas: hexutil.Uint64(gas), Input: common.CopyBytes(input)}
+	if value != nil {
+		frame.Value = (*hexutil.Big)(new(big.Int).Set(value))
+	}
+	if len(t.frames) == 0 {
+		t.root = frame
+	} else {
+		parent := t.frames[len(t.frames)-1]
+		parent.Calls = append(parent.Calls, frame)
+	}
+	t.frames = append(t.frames, frame)
+	return nil
+}
+
+func (t *callTracer) CaptureExit(depth int, output []byte, gasUsed uint64, err error) error {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	frame.GasUsed, frame.Output = hexutil.Uint64(gasUsed), common.CopyBytes(output)
+	if err != nil {
+		frame.Error = err.Error()
+	}
+	return nil
+}
+
+func (t *callTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *callTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+func (t *callTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (t *callTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (t *callTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
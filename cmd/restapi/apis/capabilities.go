@@ -0,0 +1,219 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// CapabilitiesVersion is bumped on incompatible changes of the Capabilities schema,
+// new fields and names are added without bumping it.
+const CapabilitiesVersion = 1
+
+// Capabilities lists the optional subsystems of the deployment under stable names, so that
+// clients can check for a feature instead of interpreting empty or failed responses.
+type Capabilities struct {
+	Version    int                       `json:"version"`
+	Head       uint64                    `json:"head"`
+	Storage    CapabilityStorage         `json:"storage"`
+	Indices    map[string]bool           `json:"indices"` // by index name, true if present and not empty
+	History    CapabilityHistory         `json:"history"`
+	Tracers    map[string]bool           `json:"tracers"` // by tracer name, true if it can be used
+	Analysis   CapabilityAnalysis        `json:"analysis"`
+	Finality   CapabilityFinality        `json:"finality"`
+	Extensions []string                  `json:"extensions"`
+	Backend    string                    `json:"backend"` // "remote" or "local"
+	Endpoints  map[string]CapabilityUsed `json:"endpoints"`
+}
+
+// CapabilityStorage is the storage mode turbo-geth was started with.
+type CapabilityStorage struct {
+	Mode        string `json:"mode"` // flags as given to --storage-mode, e.g. "hrt"
+	History     bool   `json:"history"`
+	Receipts    bool   `json:"receipts"`
+	TxIndex     bool   `json:"txIndex"`
+	Compression bool   `json:"compression"`
+	Pruned      bool   `json:"pruned"`
+	PrunedTo    uint64 `json:"prunedTo,omitempty"` // last block whose history was pruned
+	Profile     string `json:"profile"`            // "archive", "pruned" or "no-history"
+}
+
+// CapabilityHistory tells for which blocks ?block= can be served.
+type CapabilityHistory struct {
+	Available bool   `json:"available"`
+	Oldest    uint64 `json:"oldest"` // oldest block with state history
+	Depth     uint64 `json:"depth"`  // number of blocks below the head with state history
+}
+
+type CapabilityAnalysis struct {
+	Cache     bool `json:"cache"`
+	CacheSize int  `json:"cacheSize"` // number of cached CFGs
+	Selectors int  `json:"selectors"` // number of known function signatures
+}
+
+type CapabilityFinality struct {
+	MinConfirmations uint64 `json:"minConfirmations"`
+	Finalized        bool   `json:"finalized"` // an external finality marker was supplied
+}
+
+// CapabilityUsed tells if an endpoint group is served and what it depends on when it is not.
+type CapabilityUsed struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// capabilityIndices maps stable index names to the buckets holding them.
+var capabilityIndices = map[string]string{
+	"accountHistory":     dbutils.AccountsHistoryBucket,
+	"storageHistory":     dbutils.StorageHistoryBucket,
+	"accountChangesets":  dbutils.PlainAccountChangeSetBucket,
+	"storageChangesets":  dbutils.PlainStorageChangeSetBucket,
+	"receipts":           dbutils.BlockReceiptsPrefix,
+	"txLookup":           dbutils.TxLookupPrefix,
+	"senders":            dbutils.Senders,
+	"intermediateHashes": dbutils.IntermediateTrieHashBucket,
+	"preimages":          dbutils.PreimagePrefix,
+}
+
+func RegisterCapabilitiesAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET("/", e.GetCapabilities)
+	return nil
+}
+
+func (e *Env) GetCapabilities(c *gin.Context) {
+	var caps Capabilities
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		var err error
+		caps, err = e.capabilities(tx)
+		return err
+	}); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	render(c, http.StatusOK, caps)
+}
+
+func (e *Env) capabilities(tx ethdb.Tx) (Capabilities, error) {
+	caps := Capabilities{
+		Version:    CapabilitiesVersion,
+		Indices:    make(map[string]bool, len(capabilityIndices)),
+		Extensions: []string{},
+		Backend:    "local",
+	}
+	if e.RemoteDBAddress != "" {
+		caps.Backend = "remote"
+	}
+	head, err := headTx(tx)
+	if err != nil {
+		return caps, err
+	}
+	caps.Head = head
+
+	flag := func(key []byte) bool {
+		v, _ := tx.Get(dbutils.DatabaseInfoBucket, key)
+		return len(v) == 1 && v[0] == 1
+	}
+	caps.Storage.History = flag(dbutils.StorageModeHistory)
+	caps.Storage.Receipts = flag(dbutils.StorageModeReceipts)
+	caps.Storage.TxIndex = flag(dbutils.StorageModeTxIndex)
+	caps.Storage.Compression = flag(dbutils.StorageModeCompression)
+	caps.Storage.Mode = ethdb.StorageMode{History: caps.Storage.History, Receipts: caps.Storage.Receipts, TxIndex: caps.Storage.TxIndex, Compression: caps.Storage.Compression}.ToString()
+	if pruned, err := ethdb.GetPruned(tx, dbutils.PrunedHistory); err != nil {
+		return caps, err
+	} else if pruned > 0 {
+		caps.Storage.Pruned, caps.Storage.PrunedTo = true, pruned
+	}
+
+	for name, bucket := range capabilityIndices {
+		k, _, err := tx.Cursor(bucket).First()
+		if err != nil {
+			return caps, err
+		}
+		caps.Indices[name] = k != nil
+	}
+
+	if k, _, err := tx.Cursor(dbutils.PlainAccountChangeSetBucket).First(); err != nil {
+		return caps, err
+	} else if k != nil {
+		oldest, _ := dbutils.DecodeTimestamp(k)
+		caps.History = CapabilityHistory{Available: true, Oldest: oldest}
+		if head >= oldest {
+			caps.History.Depth = head - oldest + 1
+		}
+	}
+	switch {
+	case !caps.Storage.History || !caps.History.Available:
+		caps.Storage.Profile = "no-history"
+	case caps.Storage.Pruned || caps.History.Oldest > 1:
+		caps.Storage.Profile = "pruned"
+	default:
+		caps.Storage.Profile = "archive"
+	}
+
+	// retrace replays blocks through the object database on top of the state history
+	retrace := CapabilityUsed{Enabled: e.DB != nil && caps.History.Available}
+	switch {
+	case e.DB == nil:
+		retrace.Reason = "no object database"
+	case !caps.History.Available:
+		retrace.Reason = "no state history"
+	}
+	caps.Tracers = map[string]bool{"retrace": retrace.Enabled}
+
+	if e.AnalysisCache != nil {
+		caps.Analysis.Cache = true
+		caps.Analysis.CacheSize = e.AnalysisCache.Len()
+	}
+	if e.Selectors != nil {
+		caps.Analysis.Selectors = e.Selectors.Len()
+	}
+	if e.Finality != nil {
+		caps.Finality.MinConfirmations = e.Finality.MinConfirmations
+		_, caps.Finality.Finalized = e.Finality.Finalized()
+	}
+	for _, ext := range Extensions() {
+		caps.Extensions = append(caps.Extensions, ext.Name)
+	}
+
+	// stored receipts only need the object database, replaying pruned ones needs the history too
+	receipts := CapabilityUsed{Enabled: e.DB != nil}
+	if !receipts.Enabled {
+		receipts.Reason = "no object database"
+	}
+	history := CapabilityUsed{Enabled: caps.History.Available}
+	if !history.Enabled {
+		history.Reason = "no state history, only the latest state can be read"
+	}
+	privateAPI := CapabilityUsed{Enabled: e.RemoteDBAddress != ""}
+	if !privateAPI.Enabled {
+		privateAPI.Reason = "serving a local database"
+	}
+	caps.Endpoints = map[string]CapabilityUsed{
+		"accounts":          {Enabled: true},
+		"accounts.history":  history,
+		"storage":           {Enabled: true},
+		"storage.history":   history,
+		"storage.decode":    {Enabled: true},
+		"retrace":           retrace,
+		"trace":             retrace,
+		"receipts":          receipts,
+		"history":           history,
+		"state":             history,
+		"supply":            receipts,
+		"rewards":           retrace,
+		"intermediate-hash": {Enabled: true},
+		"db":                {Enabled: true},
+		"private-api":       privateAPI,
+		"selectors":         {Enabled: true},
+		"finality":          {Enabled: true},
+		"batch":             {Enabled: true},
+		"analysis":          {Enabled: e.AnalysisCache != nil},
+		"warmup":            {Enabled: true},
+	}
+	if !caps.Indices["intermediateHashes"] {
+		caps.Endpoints["intermediate-hash"] = CapabilityUsed{Reason: "intermediate hash bucket is empty"}
+	}
+	return caps, nil
+}
@@ -0,0 +1,193 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// Chain is a network the :chain segment of the routes may name. Its configuration is either
+// given literally or read from the database under its genesis hash, as geth stores it.
+type Chain struct {
+	Name    string              `json:"name"`
+	Genesis common.Hash         `json:"genesis"`
+	Config  *params.ChainConfig `json:"config,omitempty"` // used as is, Genesis is then ignored
+	BuiltIn bool                `json:"builtin,omitempty"`
+}
+
+var (
+	chainsMu sync.RWMutex
+	chains   = map[string]Chain{
+		"mainnet": {Name: "mainnet", Genesis: params.MainnetGenesisHash, BuiltIn: true},
+		"testnet": {Name: "testnet", Genesis: params.RopstenGenesisHash, BuiltIn: true},
+		"rinkeby": {Name: "rinkeby", Genesis: params.RinkebyGenesisHash, BuiltIn: true},
+		"goerli":  {Name: "goerli", Genesis: params.GoerliGenesisHash, BuiltIn: true},
+	}
+)
+
+// RegisterChain adds a chain or replaces a registered one, built-in chains can not be replaced.
+func RegisterChain(chain Chain) error {
+	if chain.Name == "" {
+		return fmt.Errorf("chain without name")
+	}
+	if chain.Config == nil && chain.Genesis == (common.Hash{}) {
+		return fmt.Errorf("chain %s needs a genesis hash or a config", chain.Name)
+	}
+	chainsMu.Lock()
+	defer chainsMu.Unlock()
+	if known, ok := chains[chain.Name]; ok && known.BuiltIn {
+		return fmt.Errorf("chain %s is built in", chain.Name)
+	}
+	chain.BuiltIn = false
+	chains[chain.Name] = chain
+	return nil
+}
+
+// LoadChains registers the chains of a file holding a JSON array of Chain.
+func LoadChains(path string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var list []Chain
+	if err = json.Unmarshal(b, &list); err != nil {
+		return 0, fmt.Errorf("parsing chains from %s: %w", path, err)
+	}
+	for _, chain := range list {
+		if err = RegisterChain(chain); err != nil {
+			return 0, fmt.Errorf("loading chains from %s: %w", path, err)
+		}
+	}
+	return len(list), nil
+}
+
+// Chains returns the registered chains sorted by name.
+func Chains() []Chain {
+	chainsMu.RLock()
+	defer chainsMu.RUnlock()
+	list := make([]Chain, 0, len(chains))
+	for _, chain := range chains {
+		list = append(list, chain)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ReadChainConfig retrieves the consensus settings of the named chain. A name may also be a
+// 0x-prefixed genesis hash; any other unknown name stands for the chain whose genesis is in
+// the database, so that private networks work without registration.
+func ReadChainConfig(db ethdb.KV, chain string) (*params.ChainConfig, error) {
+	chainsMu.RLock()
+	known, ok := chains[chain]
+	chainsMu.RUnlock()
+	if ok && known.Config != nil {
+		config := *known.Config
+		return &config, nil
+	}
+	var data []byte
+	if err := db.View(context.Background(), func(tx ethdb.Tx) error {
+		genesis := known.Genesis
+		switch {
+		case ok:
+		case len(chain) == 2+2*common.HashLength && chain[:2] == "0x":
+			genesis = common.HexToHash(chain)
+		default:
+			h, err := tx.Get(dbutils.HeaderPrefix, dbutils.HeaderHashKey(0))
+			if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+				return err
+			}
+			if len(h) == 0 {
+				return fmt.Errorf("%w %s: no genesis block in the database", ErrUnknownChain, chain)
+			}
+			genesis = common.BytesToHash(h)
+		}
+		d, err := tx.Get(dbutils.ConfigPrefix, genesis[:])
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return err
+		}
+		if len(d) == 0 {
+			return fmt.Errorf("%w %s: no config of genesis %x in the database", ErrUnknownChain, chain, genesis)
+		}
+		data = common.CopyBytes(d)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	var config params.ChainConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// DetectChain names the chain whose genesis block is in the database: the registered chain
+// with that genesis hash if any, else the 0x-prefixed hash, which ReadChainConfig accepts.
+// The config has to be readable, so that a database without one fails at startup rather
+// than deep in a replay.
+func DetectChain(db ethdb.KV) (string, error) {
+	var genesis common.Hash
+	if err := db.View(context.Background(), func(tx ethdb.Tx) error {
+		h, err := tx.Get(dbutils.HeaderPrefix, dbutils.HeaderHashKey(0))
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return err
+		}
+		if len(h) == 0 {
+			return fmt.Errorf("no genesis block in the database")
+		}
+		genesis = common.BytesToHash(h)
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	name := genesis.Hex()
+	for _, chain := range Chains() {
+		if chain.Config == nil && chain.Genesis == genesis {
+			name = chain.Name
+			break
+		}
+	}
+	if _, err := ReadChainConfig(db, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func RegisterChainsAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET("/", e.GetChains)
+	router.POST("/", requireAdmin, e.PostChain)
+	return nil
+}
+
+func (e *Env) GetChains(c *gin.Context) {
+	render(c, http.StatusOK, Chains())
+}
+
+// PostChain registers the chain in the body, it lasts until the server stops.
+func (e *Env) PostChain(c *gin.Context) {
+	var chain Chain
+	if err := c.ShouldBindJSON(&chain); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := RegisterChain(chain); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if _, err := ReadChainConfig(e.KV, chain.Name); err != nil {
+		// registered anyway, the database may be switched to one holding the chain
+		render(c, http.StatusCreated, gin.H{"name": chain.Name, "warning": err.Error()})
+		return
+	}
+	render(c, http.StatusCreated, gin.H{"name": chain.Name})
+}
@@ -3,15 +3,67 @@ package apis
 import (
 	"errors"
 
+	"github.com/gin-gonic/gin"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
 var ErrEntityNotFound = errors.New("entity not found")
 
+var emptyCodeHash = common.BytesToHash(crypto.Keccak256(nil))
+
 type Env struct {
-	KV              ethdb.KV
-	DB              ethdb.Getter
-	Back            ethdb.Backend
-	Chaindata       string
-	RemoteDBAddress string
+	KV               ethdb.KV
+	DB               ethdb.Getter
+	Back             ethdb.Backend
+	Chaindata        string
+	Chain            string // detected from the database, for the routes not naming one
+	RemoteDBAddress  string
+	OpenRemote       func(addr string) (ethdb.KV, ethdb.Backend, error) // with the TLS and token of the remote database
+	Selectors        *SelectorDB
+	Finality         *Finality
+	AnalysisCache    *lru.Cache // vm.Cfg by code hash and fork
+	AnalysisStats    *AnalysisStats
+	ReplaySlots      chan struct{} // bounds the concurrent replays, see limitReplays
+	RetraceCache     *RetraceCache // nil if disabled
+	MaxResponseBytes int           // retraces larger than this are cut into pages, 0 for no limit
+	MaxRetraceBatch  int           // items of a batch retrace, 0 for no limit
+
+	draining int32 // set by SetDraining
+}
+
+// RegisterRoutes registers the routes of Operations under root, the api/v1 group.
+func RegisterRoutes(root *gin.RouterGroup, e *Env) error {
+	for _, group := range []struct {
+		path     string
+		register func(*gin.RouterGroup, *Env) error
+	}{
+		{"private-api", RegisterPrivateAPI},
+		{"accounts", RegisterAccountAPI},
+		{"storage", RegisterStorageAPI},
+		{"retrace", RegisterRetraceAPI},
+		{"trace", RegisterTraceAPI},
+		{"receipts", RegisterReceiptsAPI},
+		{"history", RegisterHistoryAPI},
+		{"state", RegisterStateAPI},
+		{"supply", RegisterSupplyAPI},
+		{"rewards", RegisterRewardsAPI},
+		{"intermediate-hash", RegisterIntermediateHashAPI},
+		{"db", RegisterDBAPI},
+		{"selectors", RegisterSelectorsAPI},
+		{"finality", RegisterFinalityAPI},
+		{"batch", RegisterBatchAPI},
+		{"analysis", RegisterAnalysisAPI},
+		{"analysis-stats", RegisterAnalysisStatsAPI},
+		{"warmup", RegisterWarmupAPI},
+		{"chains", RegisterChainsAPI},
+		{"capabilities", RegisterCapabilitiesAPI},
+	} {
+		if err := group.register(root.Group(group.path), e); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,120 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// MIMECSV is served for ?format=csv, one row per read, write or change, so that the data can
+// be loaded into dataframes without flattening JSON.
+const MIMECSV = "text/csv"
+
+var (
+	retraceCSVHeader        = []string{"block", "tx", "kind", "access", "address", "key", "original", "value"}
+	accountHistoryCSVHeader = []string{"block", "address", "existed", "nonce", "balance", "code_hash", "incarnation"}
+	storageHistoryCSVHeader = []string{"block", "address", "slot", "before", "after"}
+)
+
+// renderCSV writes the rows after the header, as an attachment named after the request.
+func renderCSV(c *gin.Context, name string, header []string, rows [][]string) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)  //nolint:errcheck
+	w.WriteAll(rows) //nolint:errcheck
+	if err := w.Error(); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	c.Data(http.StatusOK, MIMECSV+"; charset=utf-8", buf.Bytes())
+}
+
+// retraceRows flattens a retrace into one row per access, tx is empty for a block retrace.
+// Keys are given as in the JSON form of the storage layout, calls are left out.
+func retraceRows(block uint64, tx string, r RetraceResponse) [][]string {
+	bn := strconv.FormatUint(block, 10)
+	var rows [][]string
+	add := func(kind, access, address, key string, values *WriteValues) {
+		row := []string{bn, tx, kind, access, address, key, "", ""}
+		if values != nil {
+			row[6], row[7] = values.Original, values.Value
+		}
+		rows = append(rows, row)
+	}
+	for _, address := range r.Account.Reads {
+		add("account", "read", address, "", nil)
+	}
+	for _, address := range r.Account.Writes {
+		var values *WriteValues
+		if v, ok := r.Account.Values[address]; ok {
+			values = &v
+		}
+		add("account", "write", address, "", values)
+	}
+	for _, address := range sortedAddresses(r.Storage.Reads) {
+		for _, key := range r.Storage.Reads[address] {
+			add("storage", "read", address, key, nil)
+		}
+	}
+	for _, address := range sortedAddresses(r.Storage.Writes) {
+		for _, key := range r.Storage.Writes[address] {
+			var values *WriteValues
+			if v, ok := r.Storage.Values[address][key]; ok {
+				values = &v
+			}
+			add("storage", "write", address, key, values)
+		}
+	}
+	addresses := make([]common.Address, 0, len(r.Contracts))
+	for address := range r.Contracts {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool { return bytes.Compare(addresses[i][:], addresses[j][:]) < 0 })
+	for _, address := range addresses {
+		contract := r.Contracts[address]
+		for _, key := range contract.Reads {
+			add("storage", "read", common.Bytes2Hex(address[:]), common.Bytes2Hex(key[:]), nil)
+		}
+		for _, key := range contract.Writes {
+			var values *WriteValues
+			if v, ok := contract.Values[key]; ok {
+				values = &v
+			}
+			add("storage", "write", common.Bytes2Hex(address[:]), common.Bytes2Hex(key[:]), values)
+		}
+	}
+	return rows
+}
+
+func accountHistoryRows(h AccountHistory) [][]string {
+	rows := make([][]string, 0, len(h.Changes))
+	for _, change := range h.Changes {
+		row := []string{strconv.FormatUint(change.Block, 10), h.Address.Hex(), "false", "", "", "", ""}
+		if before := change.Before; before != nil {
+			row[2] = "true"
+			row[3] = fmt.Sprint(before["nonce"])
+			row[4] = fmt.Sprint(before["balance"])
+			row[5] = fmt.Sprint(before["code_hash"])
+			if impl, ok := before["implementation"].(map[string]interface{}); ok {
+				row[6] = fmt.Sprint(impl["incarnation"])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func storageHistoryRows(h StorageHistory) [][]string {
+	rows := make([][]string, 0, len(h.Changes))
+	for _, change := range h.Changes {
+		rows = append(rows, []string{strconv.FormatUint(change.Block, 10), h.Address.Hex(), h.Slot.Hex(), change.Before.Hex(), change.After.Hex()})
+	}
+	return rows
+}
@@ -2,7 +2,10 @@ package apis
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ledgerwatch/turbo-geth/common"
@@ -13,6 +16,8 @@ import (
 func RegisterDBAPI(router *gin.RouterGroup, e *Env) error {
 	router.GET("/buckets-stat", e.BucketsStat)
 	router.GET("/size", e.Size)
+	router.GET("/buckets", e.BucketStats)
+	router.GET("/growth", e.DBGrowth)
 	return nil
 }
 
@@ -46,3 +51,154 @@ func (e *Env) Size(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, results)
 }
+
+// BucketStats describes a bucket. Entries, KeyBytes and ValueBytes are counted by walking
+// the bucket, or estimated from the first ?sample= entries, then Sampled is set. The B-tree
+// fields are only known for local databases, Utilization is the share of the leaf and
+// overflow pages taken by the keys and values.
+type BucketStats struct {
+	Size          common.StorageSize `json:"size"`
+	Entries       uint64             `json:"entries"`
+	KeyBytes      uint64             `json:"keyBytes"`
+	ValueBytes    uint64             `json:"valueBytes"`
+	Sampled       bool               `json:"sampled"`
+	Depth         uint64             `json:"depth,omitempty"`
+	BranchPages   uint64             `json:"branchPages,omitempty"`
+	LeafPages     uint64             `json:"leafPages,omitempty"`
+	OverflowPages uint64             `json:"overflowPages,omitempty"`
+	Utilization   float64            `json:"utilization,omitempty"`
+}
+
+func (e *Env) BucketStats(c *gin.Context) {
+	var sample uint64
+	if s := c.Query("sample"); s != "" {
+		var err error
+		if sample, err = strconv.ParseUint(s, 10, 64); err != nil || sample == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid sample " + s})
+			return
+		}
+	}
+	stats := make(map[string]*BucketStats, len(dbutils.Buckets))
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		for _, name := range dbutils.Buckets {
+			st, err := bucketStats(tx, name, sample)
+			if err != nil {
+				return err
+			}
+			stats[name] = st
+		}
+		return nil
+	}); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func bucketStats(tx ethdb.Tx, name string, sample uint64) (*BucketStats, error) {
+	size, err := tx.BucketSize(name)
+	if err != nil {
+		return nil, err
+	}
+	st := &BucketStats{Size: common.StorageSize(size)}
+	var bt *ethdb.BucketStat
+	if withStat, ok := tx.(ethdb.HasBucketStat); ok {
+		if bt, err = withStat.BucketStat(name); err != nil {
+			return nil, err
+		}
+		st.Depth, st.BranchPages, st.LeafPages, st.OverflowPages = bt.Depth, bt.BranchPages, bt.LeafPages, bt.OverflowPages
+	}
+	cursor := tx.Cursor(name).NoValues()
+	for k, vSize, err := cursor.First(); k != nil; k, vSize, err = cursor.Next() {
+		if err != nil {
+			return nil, err
+		}
+		if sample != 0 && st.Entries == sample {
+			st.Sampled = true
+			break
+		}
+		st.Entries++
+		st.KeyBytes += uint64(len(k))
+		st.ValueBytes += uint64(vSize)
+	}
+	if st.Sampled && bt != nil {
+		// scale the sample to the number of entries known from the B-tree
+		scale := float64(bt.Entries) / float64(st.Entries)
+		st.KeyBytes = uint64(float64(st.KeyBytes) * scale)
+		st.ValueBytes = uint64(float64(st.ValueBytes) * scale)
+		st.Entries = bt.Entries
+	}
+	if bt != nil && bt.LeafPages+bt.OverflowPages > 0 {
+		st.Utilization = float64(st.KeyBytes+st.ValueBytes) / float64((bt.LeafPages+bt.OverflowPages)*bt.PageSize)
+	}
+	return st, nil
+}
+
+// DBGrowth is the growth of the database over the last ?days=, from the samples of its size
+// stored by the node every hour. BytesPerDay is the slope of the least squares line through
+// the samples. Free, DaysUntilFull and FullAt are only known for a local database growing.
+type DBGrowth struct {
+	From          time.Time                `json:"from"`
+	To            time.Time                `json:"to"`
+	Samples       int                      `json:"samples"`
+	Size          common.StorageSize       `json:"size"`
+	BytesPerDay   float64                  `json:"bytesPerDay"`
+	Free          common.StorageSize       `json:"free,omitempty"`
+	DaysUntilFull float64                  `json:"daysUntilFull,omitempty"`
+	FullAt        *time.Time               `json:"fullAt,omitempty"`
+	Buckets       map[string]*BucketGrowth `json:"buckets"`
+}
+
+// BucketGrowth is the size of a bucket at the last sample and its growth.
+type BucketGrowth struct {
+	Size        common.StorageSize `json:"size"`
+	BytesPerDay float64            `json:"bytesPerDay"`
+}
+
+func (e *Env) DBGrowth(c *gin.Context) {
+	days := uint64(7)
+	if s := c.Query("days"); s != "" {
+		var err error
+		if days, err = strconv.ParseUint(s, 10, 64); err != nil || days == 0 {
+			abortWithError(c, fmt.Errorf("%w: days %s", ErrInvalidParam, s))
+			return
+		}
+	}
+	var samples []*ethdb.SizeSample
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		var err error
+		samples, err = ethdb.ReadSizeSamples(tx, time.Now().Add(-time.Duration(days)*24*time.Hour))
+		return err
+	}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if len(samples) < 2 {
+		abortWithError(c, fmt.Errorf("%w: %d samples of the database size in %d days, the node takes one every %s", ErrEntityNotFound, len(samples), days, ethdb.SizeSampleInterval))
+		return
+	}
+	last := samples[len(samples)-1]
+	total, buckets := ethdb.SizeGrowth(samples)
+	growth := &DBGrowth{
+		From:        samples[0].Time,
+		To:          last.Time,
+		Samples:     len(samples),
+		Size:        common.StorageSize(last.Total),
+		BytesPerDay: total,
+		Buckets:     make(map[string]*BucketGrowth, len(buckets)),
+	}
+	for name, perDay := range buckets {
+		growth.Buckets[name] = &BucketGrowth{Size: common.StorageSize(last.Buckets[name]), BytesPerDay: perDay}
+	}
+	if e.Chaindata != "" {
+		if free, err := diskFree(e.Chaindata); err == nil {
+			growth.Free = common.StorageSize(free)
+			if total > 0 {
+				growth.DaysUntilFull = float64(free) / total
+				fullAt := time.Now().Add(time.Duration(growth.DaysUntilFull * float64(24*time.Hour)))
+				growth.FullAt = &fullAt
+			}
+		}
+	}
+	c.JSON(http.StatusOK, growth)
+}
@@ -0,0 +1,43 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// Decompiled is the pseudo-Yul of the public functions of a contract.
+type Decompiled struct {
+	Address   common.Address       `json:"address"`
+	CodeHash  common.Hash          `json:"codeHash"`
+	Fork      string               `json:"fork"`
+	Functions []DecompiledFunction `json:"functions"`
+}
+
+type DecompiledFunction struct {
+	Selector string `json:"selector"`
+	Name     string `json:"name,omitempty"`
+	Entry    int    `json:"entry"`
+	Code     string `json:"code"`
+}
+
+func (e *Env) GetDecompiled(c *gin.Context) {
+	address, codeHash, code, rules, ok := e.contractCode(c)
+	if !ok {
+		return
+	}
+	cfg, _ := e.analyse(address, codeHash, code, rules)
+	result := Decompiled{Address: address, CodeHash: codeHash, Fork: cfg.Fork, Functions: []DecompiledFunction{}}
+	for _, f := range cfg.Decompile() {
+		sel := [4]byte{byte(f.Selector >> 24), byte(f.Selector >> 16), byte(f.Selector >> 8), byte(f.Selector)}
+		result.Functions = append(result.Functions, DecompiledFunction{
+			Selector: fmt.Sprintf("0x%x", sel),
+			Name:     e.Selectors.Name(sel[:]),
+			Entry:    f.Entry,
+			Code:     f.Code,
+		})
+	}
+	render(c, http.StatusOK, result)
+}
@@ -0,0 +1,14 @@
+// +build !windows
+
+package apis
+
+import "syscall"
+
+// diskFree is the space available to the process on the filesystem of the path.
+func diskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil //nolint:unconvert
+}
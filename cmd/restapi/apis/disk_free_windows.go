@@ -0,0 +1,8 @@
+package apis
+
+import "errors"
+
+// diskFree is not implemented on Windows, the growth of the database is given without a forecast.
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("free disk space not supported on windows")
+}
@@ -0,0 +1,88 @@
+package apis
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+// Media types which can be requested through the Accept header. Binary encodings
+// use the same field names as the JSON form (codec honours `json` struct tags).
+const (
+	MIMEJSON     = "application/json"
+	MIMECBOR     = "application/cbor"
+	MIMEMsgPack  = "application/msgpack"
+	MIMEXMsgPack = "application/x-msgpack"
+	MIMENDJSON   = "application/x-ndjson" // only for streaming endpoints, see acceptsNDJSON
+)
+
+var (
+	cborHandle    = &codec.CborHandle{}
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+)
+
+// negotiate picks the response encoding from the Accept header, JSON is the default.
+func negotiate(c *gin.Context) string {
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		mime := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch mime {
+		case MIMECBOR, MIMEMsgPack, MIMEJSON:
+			return mime
+		case MIMEXMsgPack:
+			return MIMEMsgPack
+		}
+	}
+	return MIMEJSON
+}
+
+// acceptsNDJSON tells if the client asked for a stream of newline delimited JSON records.
+func acceptsNDJSON(c *gin.Context) bool {
+	for _, part := range strings.Split(c.GetHeader("Accept"), ",") {
+		if strings.TrimSpace(strings.SplitN(part, ";", 2)[0]) == MIMENDJSON {
+			return true
+		}
+	}
+	return false
+}
+
+func codecHandle(mime string) codec.Handle {
+	switch mime {
+	case MIMECBOR:
+		return cborHandle
+	case MIMEMsgPack:
+		return msgpackHandle
+	}
+	return nil
+}
+
+// codecRender is a gin renderer encoding straight into the response writer,
+// so large results are not buffered a second time.
+type codecRender struct {
+	handle      codec.Handle
+	contentType string
+	data        interface{}
+}
+
+func (r codecRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return codec.NewEncoder(w, r.handle).Encode(r.data)
+}
+
+func (r codecRender) WriteContentType(w http.ResponseWriter) {
+	header := w.Header()
+	if val := header["Content-Type"]; len(val) == 0 {
+		header["Content-Type"] = []string{r.contentType}
+	}
+}
+
+// render writes obj in the encoding negotiated with the client.
+func render(c *gin.Context, code int, obj interface{}) {
+	mime := negotiate(c)
+	if h := codecHandle(mime); h != nil {
+		c.Render(code, codecRender{handle: h, contentType: mime, data: obj})
+		return
+	}
+	c.JSON(code, obj)
+}
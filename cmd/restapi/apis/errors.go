@@ -0,0 +1,66 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// Errors of requests, wrapped with the details. abortWithError maps them to the status and
+// the code of the response, anything else is an internal error.
+var (
+	ErrInvalidParam = errors.New("invalid parameter")
+	ErrUnknownChain = errors.New("unknown chain")
+	ErrPruned       = errors.New("history pruned")
+	ErrUnconfirmed  = errors.New("not enough confirmations")
+)
+
+// ErrorResponse is the body of error responses. Code is one of invalid_param,
+// block_not_found, not_found, unknown_chain, pruned, unconfirmed and internal.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var errorStatuses = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrInvalidParam, http.StatusBadRequest, "invalid_param"},
+	{ErrBlockNotFound, http.StatusNotFound, "block_not_found"},
+	{ErrEntityNotFound, http.StatusNotFound, "not_found"},
+	{ErrUnknownChain, http.StatusNotFound, "unknown_chain"},
+	{ErrPruned, http.StatusGone, "pruned"},
+	{ethdb.ErrPruned, http.StatusGone, "pruned"},
+	{ErrUnconfirmed, http.StatusConflict, "unconfirmed"},
+}
+
+// errorStatus returns the status and the code of the response to the error.
+func errorStatus(err error) (int, string) {
+	for _, s := range errorStatuses {
+		if errors.Is(err, s.err) {
+			return s.status, s.code
+		}
+	}
+	return http.StatusInternalServerError, "internal"
+}
+
+// abortWithError responds with the status and the code of the error. Internal errors are
+// also recorded in the context, for the logs. Requests cancelled by the client that went
+// away are only aborted.
+func abortWithError(c *gin.Context, err error) {
+	if errors.Is(err, context.Canceled) && c.Request.Context().Err() != nil {
+		c.Abort()
+		return
+	}
+	status, code := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		c.Error(err) //nolint:errcheck
+	}
+	c.AbortWithStatusJSON(status, ErrorResponse{Code: code, Message: err.Error()})
+}
@@ -0,0 +1,85 @@
+package apis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// decodeError returns the ErrorResponse of w, checking its status.
+func decodeError(t *testing.T, w *httptest.ResponseRecorder, status int) ErrorResponse {
+	require.Equal(t, status, w.Code, w.Body.String())
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), w.Body.String())
+	return resp
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, tt := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("%w: x", ErrInvalidParam), http.StatusBadRequest, "invalid_param"},
+		{fmt.Errorf("a: %w", fmt.Errorf("%w: b", ErrBlockNotFound)), http.StatusNotFound, "block_not_found"},
+		{ErrEntityNotFound, http.StatusNotFound, "not_found"},
+		{fmt.Errorf("%w x", ErrUnknownChain), http.StatusNotFound, "unknown_chain"},
+		{fmt.Errorf("%w: x", ErrPruned), http.StatusGone, "pruned"},
+		{fmt.Errorf("%w: x", ethdb.ErrPruned), http.StatusGone, "pruned"},
+		{fmt.Errorf("%w: x", ErrUnconfirmed), http.StatusConflict, "unconfirmed"},
+		{fmt.Errorf("x"), http.StatusInternalServerError, "internal"},
+	} {
+		status, code := errorStatus(tt.err)
+		assert.Equal(t, tt.status, status, tt.err.Error())
+		assert.Equal(t, tt.code, code, tt.err.Error())
+	}
+}
+
+// TestErrorResponses checks the typed errors of the block retrace: the chain head, the
+// confirmations and the pruning decide which blocks can be replayed.
+func TestErrorResponses(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.KV.Close()
+	db := e.DB.(ethdb.Database)
+	require.NoError(t, stages.SaveStageProgress(db, stages.Execution, 3, nil))
+	pruned := make([]byte, 8)
+	binary.BigEndian.PutUint64(pruned, 1)
+	require.NoError(t, db.Put(dbutils.DatabaseInfoBucket, dbutils.PrunedHistory, pruned))
+	r := newTestRouter(t, e, nil)
+	chain := e.Chain
+
+	for _, tt := range []struct {
+		target string
+		status int
+		code   string
+	}{
+		{"/api/v1/retrace/" + chain + "/abc", http.StatusBadRequest, "invalid_param"},
+		{"/api/v1/retrace/" + chain + "/0", http.StatusBadRequest, "invalid_param"},
+		{"/api/v1/retrace/" + chain + "/4", http.StatusNotFound, "block_not_found"},
+		{"/api/v1/retrace/" + chain + "/1", http.StatusGone, "pruned"},
+		{"/api/v1/retrace/0x0000000000000000000000000000000000000000000000000000000000000000/2", http.StatusNotFound, "unknown_chain"},
+		{"/api/v1/retrace/" + chain + "/2?format=xml", http.StatusBadRequest, "invalid_param"},
+	} {
+		resp := decodeError(t, serve(r, http.MethodGet, tt.target, nil), tt.status)
+		assert.Equal(t, tt.code, resp.Code, tt.target)
+		assert.NotEmpty(t, resp.Message, tt.target)
+	}
+
+	// block 2 has 2 confirmations, until it is finalized
+	e.Finality.MinConfirmations = 3
+	resp := decodeError(t, serve(r, http.MethodGet, "/api/v1/retrace/"+chain+"/2?format=xml", nil), http.StatusConflict)
+	assert.Equal(t, "unconfirmed", resp.Code)
+	e.Finality.SetFinalized(2)
+	resp = decodeError(t, serve(r, http.MethodGet, "/api/v1/retrace/"+chain+"/2?format=xml", nil), http.StatusBadRequest)
+	assert.Equal(t, "invalid_param", resp.Code)
+}
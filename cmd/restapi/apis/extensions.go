@@ -0,0 +1,53 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Extension is a group of additional routes compiled into the restapi binary.
+// Operators register extensions from their own main package (or an init function of an
+// imported package) before executing commands.RootCommand(), without patching cmd/restapi:
+//
+//	apis.RegisterExtension(apis.Extension{
+//		Name:     "my-indexer",
+//		Register: func(router *gin.RouterGroup, e *apis.Env) error { ... },
+//	})
+type Extension struct {
+	Name     string                                      // routes are served under api/v1/<Name>
+	Register func(router *gin.RouterGroup, e *Env) error // adds the routes, required
+	Start    func(ctx context.Context, e *Env) error     // optional, called before serving; ctx is cancelled on shutdown
+	Stop     func(e *Env)                                // optional, called after the server stopped serving
+
+	Operations []Operation // optional, listed in /openapi.json with paths relative to the group
+}
+
+var (
+	extensionsMu sync.Mutex
+	extensions   []Extension
+)
+
+// RegisterExtension adds an extension, it panics on a missing Register function or a duplicate name.
+func RegisterExtension(ext Extension) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	if ext.Register == nil {
+		panic(fmt.Sprintf("restapi extension %q without Register function", ext.Name))
+	}
+	for _, known := range extensions {
+		if known.Name == ext.Name {
+			panic(fmt.Sprintf("restapi extension %q registered twice", ext.Name))
+		}
+	}
+	extensions = append(extensions, ext)
+}
+
+// Extensions returns the registered extensions in registration order.
+func Extensions() []Extension {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	return append([]Extension(nil), extensions...)
+}
@@ -0,0 +1,140 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// Finality tracks how deep blocks are below the chain head and an optional,
+// externally supplied finalized block number (e.g. from a checkpointing service).
+type Finality struct {
+	// MinConfirmations is the number of confirmations a block needs before
+	// it is replayed by the retrace endpoints, 0 disables the check.
+	MinConfirmations uint64
+
+	mu           sync.RWMutex
+	finalized    uint64
+	hasFinalized bool
+}
+
+// BlockFinality is embedded into responses describing a single block.
+type BlockFinality struct {
+	Confirmations uint64 `json:"confirmations"`
+	Finalized     bool   `json:"finalized"`
+}
+
+func NewFinality(minConfirmations uint64) *Finality {
+	return &Finality{MinConfirmations: minConfirmations}
+}
+
+// Head returns the highest block for which state is available.
+func (f *Finality) Head(db ethdb.Getter) (uint64, error) {
+	head, _, err := stages.GetStageProgress(db, stages.Execution)
+	return head, err
+}
+
+// SetFinalized records an externally supplied finality marker: all blocks up to
+// and including the given number are treated as final.
+func (f *Finality) SetFinalized(number uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.finalized = number
+	f.hasFinalized = true
+}
+
+func (f *Finality) Finalized() (uint64, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.finalized, f.hasFinalized
+}
+
+// Of computes the confirmation depth of the given block. The head block itself has one confirmation.
+func (f *Finality) Of(db ethdb.Getter, number uint64) (BlockFinality, error) {
+	head, err := f.Head(db)
+	if err != nil {
+		return BlockFinality{}, err
+	}
+	var bf BlockFinality
+	if head >= number {
+		bf.Confirmations = head - number + 1
+	}
+	if finalized, ok := f.Finalized(); ok {
+		bf.Finalized = number <= finalized
+	}
+	return bf, nil
+}
+
+// Check returns an error if the block does not have enough confirmations to be served.
+func (f *Finality) Check(bf BlockFinality) error {
+	if bf.Finalized || f.MinConfirmations == 0 || bf.Confirmations >= f.MinConfirmations {
+		return nil
+	}
+	return fmt.Errorf("%w: block has %d, at least %d required", ErrUnconfirmed, bf.Confirmations, f.MinConfirmations)
+}
+
+// replayableBlock returns the finality of the block if it can be replayed: it is known,
+// confirmed enough, and the state before it was not pruned.
+func (e *Env) replayableBlock(number uint64) (BlockFinality, error) {
+	if number == 0 {
+		return BlockFinality{}, fmt.Errorf("%w: the genesis block can not be replayed", ErrInvalidParam)
+	}
+	bf, err := e.Finality.Of(e.DB, number)
+	if err != nil {
+		return bf, err
+	}
+	if bf.Confirmations == 0 {
+		return bf, fmt.Errorf("%w: block %d is beyond the head", ErrBlockNotFound, number)
+	}
+	if err = e.Finality.Check(bf); err != nil {
+		return bf, err
+	}
+	return bf, e.KV.View(context.Background(), func(tx ethdb.Tx) error {
+		pruned, err := ethdb.GetPruned(tx, dbutils.PrunedHistory)
+		if err != nil {
+			return err
+		}
+		// the changesets up to the last pruned block are gone
+		if number <= pruned {
+			return fmt.Errorf("%w: the state before block %d is no longer kept", ErrPruned, number)
+		}
+		return nil
+	})
+}
+
+func RegisterFinalityAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET("/", e.GetFinality)
+	router.POST("/", requireAdmin, e.PostFinality)
+	return nil
+}
+
+func (e *Env) GetFinality(c *gin.Context) {
+	head, err := e.Finality.Head(e.DB)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	result := gin.H{"head": head, "minConfirmations": e.Finality.MinConfirmations}
+	if finalized, ok := e.Finality.Finalized(); ok {
+		result["finalized"] = finalized
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// PostFinality sets the externally supplied finalized block number.
+func (e *Env) PostFinality(c *gin.Context) {
+	number, err := strconv.ParseUint(c.Query("number"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid block number"})
+		return
+	}
+	e.Finality.SetFinalized(number)
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,193 @@
+package apis
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// gasCategory groups the opcodes by what they spend gas on.
+func gasCategory(op vm.OpCode) string {
+	switch {
+	case op == vm.SLOAD || op == vm.SSTORE:
+		return "storage"
+	case op == vm.MLOAD || op == vm.MSTORE || op == vm.MSTORE8 || op == vm.MSIZE:
+		return "memory"
+	case op == vm.CALL || op == vm.CALLCODE || op == vm.DELEGATECALL || op == vm.STATICCALL ||
+		op == vm.CREATE || op == vm.CREATE2 || op == vm.SELFDESTRUCT:
+		return "calls"
+	case op == vm.SHA3:
+		return "hashing"
+	case op >= vm.ADD && op <= vm.SIGNEXTEND, op >= vm.LT && op <= vm.SAR:
+		return "arithmetic"
+	case op >= vm.LOG0 && op <= vm.LOG4:
+		return "logs"
+	case op == vm.BALANCE || op == vm.SELFBALANCE || op == vm.EXTCODESIZE || op == vm.EXTCODECOPY || op == vm.EXTCODEHASH:
+		return "state"
+	case op == vm.CALLDATACOPY || op == vm.CODECOPY || op == vm.RETURNDATACOPY:
+		return "copy"
+	case op == vm.POP || op.IsPush() || op >= vm.DUP1 && op <= vm.SWAP16:
+		return "stack"
+	case op == vm.JUMP || op == vm.JUMPI || op == vm.JUMPDEST || op == vm.PC ||
+		op == vm.STOP || op == vm.RETURN || op == vm.REVERT:
+		return "control"
+	default:
+		return "environment"
+	}
+}
+
+// memoryGas is the cost of the memory grown to size bytes.
+func memoryGas(size int) uint64 {
+	words := uint64(size+31) / 32
+	return words*params.MemoryGas + words*words/params.QuadCoeffDiv
+}
+
+type gasFrame struct {
+	pending   bool
+	op        vm.OpCode
+	gas       uint64 // before the pending instruction
+	expansion uint64 // of the memory by the pending instruction
+	mem       int    // memory size after the expansion by the pending instruction
+	inner     uint64 // used by the calls made by the pending instruction
+	total     uint64 // accounted for so far, including calls
+}
+
+// gasTracer accounts the gas used by a transaction to the categories of the instructions
+// that used it. The gas of an instruction is the difference of the gas left before it
+// and before the next instruction of the same call, less what its calls used and, under
+// "memory", its memory expansion. The last instruction of a call gets what the call used
+// and was not accounted for, and precompiles get the gas of the calls without code.
+//
+// The frames of all the calls are told by FrameTracer.
+type gasTracer struct {
+	frames     []*gasFrame
+	categories map[string]uint64
+	startGas   uint64 // of the outermost call
+	gasUsed    uint64 // by the outermost call
+}
+
+var _ vm.FrameTracer = (*gasTracer)(nil)
+
+func newGasTracer() *gasTracer {
+	return &gasTracer{categories: make(map[string]uint64)}
+}
+
+// breakdown returns the gas of the transaction traced, with its receipt.
+func (t *gasTracer) breakdown(tx *types.Transaction, receipt *types.Receipt, blockNumber, index uint64) GasBreakdown {
+	result := GasBreakdown{
+		Hash:        tx.Hash(),
+		BlockNumber: blockNumber,
+		TxIndex:     index,
+		GasUsed:     receipt.GasUsed,
+		Failed:      receipt.Status == types.ReceiptStatusFailed,
+		Intrinsic:   tx.Gas() - t.startGas,
+		Categories:  t.categories,
+	}
+	if used := result.Intrinsic + t.gasUsed; used > receipt.GasUsed {
+		result.Refund = used - receipt.GasUsed
+	}
+	return result
+}
+
+func (t *gasTracer) account(category string, gas uint64) {
+	if gas > 0 {
+		t.categories[category] += gas
+	}
+}
+
+// settle accounts the used gas to the pending instruction of the frame.
+func (t *gasTracer) settle(f *gasFrame, used uint64) {
+	expansion := f.expansion
+	if expansion > used {
+		expansion = used
+	}
+	t.account("memory", expansion)
+	used -= expansion
+	if f.inner > used {
+		f.inner = used
+	}
+	t.account(gasCategory(f.op), used-f.inner)
+	f.pending, f.inner = false, 0
+}
+
+func (t *gasTracer) CaptureEnter(typ vm.OpCode, depth int, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	if depth == 0 {
+		t.startGas = gas
+	}
+	t.frames = append(t.frames, &gasFrame{})
+	return nil
+}
+
+func (t *gasTracer) CaptureExit(depth int, output []byte, gasUsed uint64, err error) error {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	f := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+	var rest uint64
+	if gasUsed > f.total {
+		rest = gasUsed - f.total
+	}
+	if f.pending {
+		t.settle(f, rest)
+	} else {
+		t.account("precompiles", rest)
+	}
+	if len(t.frames) == 0 {
+		t.gasUsed = gasUsed
+	} else {
+		t.frames[len(t.frames)-1].inner += gasUsed
+	}
+	return nil
+}
+
+func (t *gasTracer) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (t *gasTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if len(t.frames) == 0 {
+		return nil
+	}
+	f := t.frames[len(t.frames)-1]
+	if f.pending {
+		var used uint64
+		if gas < f.gas {
+			used = f.gas - gas
+		}
+		f.total += used
+		t.settle(f, used)
+	}
+	// the memory is already expanded for the instruction
+	f.pending, f.op, f.gas, f.expansion = true, op, gas, 0
+	if size := memory.Len(); size > f.mem {
+		f.expansion = memoryGas(size) - memoryGas(f.mem)
+		f.mem = size
+	}
+	return nil
+}
+
+func (t *gasTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *stack.Stack, rStack *stack.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *gasTracer) CaptureEnd(depth int, output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+func (t *gasTracer) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (t *gasTracer) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (t *gasTracer) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
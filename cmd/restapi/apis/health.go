@@ -0,0 +1,78 @@
+package apis
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// readyTimeout bounds the database read of a readiness check.
+const readyTimeout = 2 * time.Second
+
+// Readiness tells if the server can serve requests, for load balancers and orchestrators.
+type Readiness struct {
+	Ready        bool   `json:"ready"`
+	Chain        string `json:"chain,omitempty"`
+	Head         uint64 `json:"head"`
+	Connectivity string `json:"connectivity,omitempty"` // of the connections to a remote database
+	Reason       string `json:"reason,omitempty"`       // why it is not ready
+}
+
+// RegisterHealthAPI serves /health and /ready next to the API, without authentication or
+// rate limits, as probes do not carry credentials.
+func RegisterHealthAPI(router gin.IRoutes, e *Env) {
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/ready", e.GetReady)
+}
+
+// SetDraining makes the readiness checks fail from now on, when shutting down.
+func (e *Env) SetDraining() {
+	atomic.StoreInt32(&e.draining, 1)
+}
+
+// GetReady checks that the server is not shutting down, that the database is connected and
+// answers and that the config of the chain can be read.
+func (e *Env) GetReady(c *gin.Context) {
+	result := Readiness{Chain: e.Chain}
+	notReady := func(reason string) {
+		result.Reason = reason
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, result)
+	}
+	if atomic.LoadInt32(&e.draining) == 1 {
+		notReady("shutting down")
+		return
+	}
+	if remote, ok := e.KV.(ethdb.HasConnectivity); ok {
+		var connected bool
+		if connected, result.Connectivity = remote.Connectivity(); !connected {
+			notReady("database disconnected")
+			return
+		}
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+	if err := e.KV.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		result.Head, err = headTx(tx)
+		return err
+	}); err != nil {
+		notReady("database: " + err.Error())
+		return
+	}
+	if e.Chain == "" {
+		notReady("chain not detected")
+		return
+	}
+	if _, err := ReadChainConfig(e.KV, e.Chain); err != nil {
+		notReady("chain config: " + err.Error())
+		return
+	}
+	result.Ready = true
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,286 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// maxHistoryRange is the most blocks whose changesets a single history request walks.
+const maxHistoryRange = 100000
+
+func RegisterHistoryAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET(":chain/account/:address", e.GetAccountHistory)
+	router.GET(":chain/storage/:address/:slot", e.GetStorageHistory)
+	router.GET(":chain/logs/:address", e.GetLogHistory)
+	return nil
+}
+
+// AccountChange is a block changing an account, Before is the account before the block,
+// nil if it did not exist.
+type AccountChange struct {
+	Block  uint64                 `json:"block"`
+	Before map[string]interface{} `json:"before"`
+}
+
+type AccountHistory struct {
+	Address common.Address  `json:"address"`
+	From    uint64          `json:"from"`
+	To      uint64          `json:"to"`
+	Changes []AccountChange `json:"changes"`
+}
+
+// StorageChange is a block changing a storage slot, with its values before and after.
+type StorageChange struct {
+	Block  uint64      `json:"block"`
+	Before common.Hash `json:"before"`
+	After  common.Hash `json:"after"`
+}
+
+type StorageHistory struct {
+	Address common.Address  `json:"address"`
+	Slot    common.Hash     `json:"slot"`
+	From    uint64          `json:"from"`
+	To      uint64          `json:"to"`
+	Changes []StorageChange `json:"changes"`
+}
+
+// LogHistory is the logs of an address, only those with the topic if set.
+type LogHistory struct {
+	Address common.Address `json:"address"`
+	Topic   *common.Hash   `json:"topic,omitempty"`
+	From    uint64         `json:"from"`
+	To      uint64         `json:"to"`
+	Logs    []*types.Log   `json:"logs"`
+}
+
+func (e *Env) GetAccountHistory(c *gin.Context) {
+	e.history(c, func(tx ethdb.Tx, address common.Address, from, to uint64) (interface{}, error) {
+		return accountHistory(tx, address, from, to)
+	})
+}
+
+func (e *Env) GetStorageHistory(c *gin.Context) {
+	slot := common.HexToHash(c.Param("slot"))
+	e.history(c, func(tx ethdb.Tx, address common.Address, from, to uint64) (interface{}, error) {
+		return storageHistory(tx, address, slot, from, to)
+	})
+}
+
+func (e *Env) GetLogHistory(c *gin.Context) {
+	var topic *common.Hash
+	if s := c.Query("topic"); s != "" {
+		h := common.HexToHash(s)
+		topic = &h
+	}
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	e.history(c, func(_ ethdb.Tx, address common.Address, from, to uint64) (interface{}, error) {
+		return logHistory(e.DB, chainConfig, address, topic, from, to)
+	})
+}
+
+// history serves the result of the query for the :address and the ?from= and ?to= range.
+func (e *Env) history(c *gin.Context, query func(tx ethdb.Tx, address common.Address, from, to uint64) (interface{}, error)) {
+	address := common.FromHex(c.Param("address"))
+	if len(address) != common.AddressLength {
+		abortWithError(c, fmt.Errorf("%w: invalid address %s", ErrInvalidParam, c.Param("address")))
+		return
+	}
+	if _, err := ReadChainConfig(e.KV, c.Param("chain")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	var result interface{}
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		from, to, err := historyRange(c, tx)
+		if err != nil {
+			return err
+		}
+		result, err = query(tx, common.BytesToAddress(address), from, to)
+		return err
+	}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if c.Query("format") == "csv" {
+		switch h := result.(type) {
+		case AccountHistory:
+			renderCSV(c, "history-"+h.Address.Hex(), accountHistoryCSVHeader, accountHistoryRows(h))
+			return
+		case StorageHistory:
+			renderCSV(c, "history-"+h.Address.Hex()+"-"+h.Slot.Hex(), storageHistoryCSVHeader, storageHistoryRows(h))
+			return
+		}
+	}
+	render(c, http.StatusOK, result)
+}
+
+type invalidRangeError struct{ message string }
+
+func (e *invalidRangeError) Error() string { return e.message }
+
+func (e *invalidRangeError) Unwrap() error { return ErrInvalidParam }
+
+// historyRange reads the ?from= and ?to= parameters, to defaults to the head.
+func historyRange(c *gin.Context, tx ethdb.Tx) (from, to uint64, err error) {
+	if from, err = strconv.ParseUint(c.Query("from"), 10, 64); err != nil {
+		return 0, 0, &invalidRangeError{"invalid from block " + c.Query("from")}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return 0, 0, &invalidRangeError{"invalid to block " + s}
+		}
+	} else if to, err = headTx(tx); err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		return 0, 0, &invalidRangeError{fmt.Sprintf("to block %d is before from block %d", to, from)}
+	}
+	if to-from >= maxHistoryRange {
+		return 0, 0, &invalidRangeError{fmt.Sprintf("at most %d blocks can be walked at once", maxHistoryRange)}
+	}
+	return from, to, nil
+}
+
+// logHistory reads the receipts of the blocks of the log index, and of all the blocks above
+// the progress of the index.
+func logHistory(db ethdb.Getter, chainConfig *params.ChainConfig, address common.Address, topic *common.Hash, from, to uint64) (LogHistory, error) {
+	result := LogHistory{Address: address, Topic: topic, From: from, To: to, Logs: []*types.Log{}}
+	indexed, _, err := stages.GetStageProgress(db, stages.LogIndex)
+	if err != nil {
+		return LogHistory{}, err
+	}
+	var blocks []uint64
+	if indexed >= from {
+		if indexed > to {
+			indexed = to
+		}
+		var topics [][]common.Hash
+		if topic != nil {
+			topics = [][]common.Hash{{*topic}}
+		}
+		if blocks, err = core.LogIndexBlocks(db, []common.Address{address}, topics, from, indexed); err != nil {
+			return LogHistory{}, err
+		}
+		from = indexed + 1
+	}
+	for block := from; block <= to; block++ {
+		blocks = append(blocks, block)
+	}
+
+	for _, block := range blocks {
+		hash := rawdb.ReadCanonicalHash(db, block)
+		for _, receipt := range rawdb.ReadReceipts(db, hash, block, chainConfig) {
+			for _, l := range receipt.Logs {
+				if l.Address == address && (topic == nil || hasTopic(l, *topic)) {
+					result.Logs = append(result.Logs, l)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func hasTopic(l *types.Log, topic common.Hash) bool {
+	for _, t := range l.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// walkChangeSets calls f with the number and the changeset of every block from..to that
+// has one. Over a remote KV, the changesets of the range are streamed in one batch, and the
+// node stops at the end of the range.
+func walkChangeSets(tx ethdb.Tx, bucket string, from, to uint64, f func(block uint64, cs []byte) error) error {
+	c := tx.Cursor(bucket).Prefetch(uint(to-from+1)).Range(dbutils.EncodeTimestamp(from), dbutils.EncodeTimestamp(to+1))
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		block, _ := dbutils.DecodeTimestamp(k)
+		if err = f(block, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accountHistory lists the blocks from..to changing the account, from the changesets.
+func accountHistory(tx ethdb.Tx, address common.Address, from, to uint64) (AccountHistory, error) {
+	result := AccountHistory{Address: address, From: from, To: to, Changes: []AccountChange{}}
+	err := walkChangeSets(tx, dbutils.PlainAccountChangeSetBucket, from, to, func(block uint64, cs []byte) error {
+		enc, err := changeset.AccountChangeSetPlainBytes(cs).Find(address[:])
+		if errors.Is(err, changeset.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		change := AccountChange{Block: block}
+		if len(enc) > 0 {
+			var account accounts.Account
+			if err = account.DecodeForStorage(enc); err != nil {
+				return err
+			}
+			change.Before = jsonifyAccount(&account)
+		}
+		result.Changes = append(result.Changes, change)
+		return nil
+	})
+	return result, err
+}
+
+// storageHistory lists the blocks from..to changing the slot, whatever the incarnation of
+// the contract, from the changesets. The value after a change is the value before the
+// next one, or the value after the block to for the last one.
+func storageHistory(tx ethdb.Tx, address common.Address, slot common.Hash, from, to uint64) (StorageHistory, error) {
+	result := StorageHistory{Address: address, Slot: slot, From: from, To: to, Changes: []StorageChange{}}
+	if err := walkChangeSets(tx, dbutils.PlainStorageChangeSetBucket, from, to, func(block uint64, cs []byte) error {
+		v, err := changeset.StorageChangeSetPlainBytes(cs).FindWithoutIncarnation(address[:], slot[:])
+		if errors.Is(err, changeset.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n := len(result.Changes); n > 0 {
+			result.Changes[n-1].After = common.BytesToHash(v)
+		}
+		result.Changes = append(result.Changes, StorageChange{Block: block, Before: common.BytesToHash(v)})
+		return nil
+	}); err != nil {
+		return result, err
+	}
+	if len(result.Changes) == 0 {
+		return result, nil
+	}
+	account, err := readAccountTx(tx, address, to)
+	if err != nil || account == nil {
+		return result, err
+	}
+	v, err := readStorageTx(tx, address, account.Incarnation, slot, to)
+	if err != nil {
+		return result, err
+	}
+	result.Changes[len(result.Changes)-1].After = common.BytesToHash(v)
+	return result, nil
+}
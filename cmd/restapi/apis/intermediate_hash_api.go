@@ -2,17 +2,24 @@ package apis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/trie"
 )
 
 func RegisterIntermediateHashAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(withoutBlockParam)
 	router.GET("/", e.FindIntermediateHash)
+	router.GET("node/:prefix", e.GetIntermediateHashNode)
+	router.GET("root", e.VerifyStateRoot)
 	return nil
 }
 
@@ -61,3 +68,62 @@ func findIntermediateHashByPrefix(prefixS string, remoteDB ethdb.KV) ([]*Interme
 
 	return results, nil
 }
+
+// GetIntermediateHashNode gives the hash of the subtrie at exactly the prefix.
+func (e *Env) GetIntermediateHashNode(c *gin.Context) {
+	prefix := common.FromHex(c.Param("prefix"))
+	var hash []byte
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		v, err := tx.Get(dbutils.IntermediateTrieHashBucket, prefix)
+		hash = common.CopyBytes(v)
+		return err
+	}); err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	if hash == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("no intermediate hash at prefix %x", prefix)})
+		return
+	}
+	c.JSON(http.StatusOK, &IntermediateHashResponse{Prefix: fmt.Sprintf("%x", prefix), Value: fmt.Sprintf("%x", hash)})
+}
+
+// StateRootResponse compares the state root computed from the hashed state and the
+// intermediate hashes with the root in the header of the block they are at.
+type StateRootResponse struct {
+	BlockNumber  uint64      `json:"blockNumber"`
+	ComputedRoot common.Hash `json:"computedRoot"`
+	HeaderRoot   common.Hash `json:"headerRoot"`
+	Match        bool        `json:"match"`
+}
+
+// VerifyStateRoot computes the state root. Only the latest hashed state is kept, so the
+// root can only be verified at the block of the intermediate hashes stage.
+func (e *Env) VerifyStateRoot(c *gin.Context) {
+	db := ethdb.NewObjectDatabase(e.KV)
+	var result StateRootResponse
+	var err error
+	if result.BlockNumber, _, err = stages.GetStageProgress(db, stages.IntermediateHashes); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, result.BlockNumber), result.BlockNumber)
+	if header == nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("header of block %d not found", result.BlockNumber)})
+		return
+	}
+	loader := trie.NewFlatDbSubTrieLoader()
+	noCollector := func(keyHex []byte, hash []byte) error { return nil }
+	if err = loader.Reset(db, trie.NewRetainList(0), trie.NewRetainList(0), noCollector, [][]byte{nil}, []int{0}, false); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	subTries, err := loader.LoadSubTries()
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	result.ComputedRoot, result.HeaderRoot = subTries.Hashes[0], header.Root
+	result.Match = result.ComputedRoot == result.HeaderRoot
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,107 @@
+package apis
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiterIdle is how long the bucket of a client is kept after its last request.
+const rateLimiterIdle = 10 * time.Minute
+
+// RateLimiter gives every client, identified by its credentials or else its IP, a token
+// bucket refilled at a fixed rate. Requests finding it empty get 429 right away.
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+	swept   time.Time
+}
+
+type clientLimiter struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// NewRateLimiter returns nil, which disables rate limiting, if perSecond is not positive.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{limit: rate.Limit(perSecond), burst: burst, clients: make(map[string]*clientLimiter), swept: time.Now()}
+}
+
+// Middleware has to run after the authentication, which identifies the clients.
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := c.ClientIP()
+		if id, ok := c.Get(authClientKey); ok {
+			client = id.(string)
+		}
+		now := time.Now()
+		r := l.limiter(client, now).ReserveN(now, 1)
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (l *RateLimiter) limiter(client string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > rateLimiterIdle {
+		for id, cl := range l.clients {
+			if now.Sub(cl.seen) > rateLimiterIdle {
+				delete(l.clients, id)
+			}
+		}
+		l.swept = now
+	}
+	cl, ok := l.clients[client]
+	if !ok {
+		cl = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[client] = cl
+	}
+	cl.seen = now
+	return cl.limiter
+}
+
+// NewReplaySlots returns the semaphore bounding the concurrent block and transaction
+// replays, nil for no bound.
+func NewReplaySlots(n int) chan struct{} {
+	if n <= 0 {
+		return nil
+	}
+	return make(chan struct{}, n)
+}
+
+// limitReplays guards the routes replaying blocks or transactions. When all slots are taken
+// the request gets 503 instead of waiting, replays of heavy blocks take seconds.
+func (e *Env) limitReplays(c *gin.Context) {
+	if e.ReplaySlots == nil {
+		c.Next()
+		return
+	}
+	select {
+	case e.ReplaySlots <- struct{}{}:
+		defer func() { <-e.ReplaySlots }()
+		c.Next()
+	default:
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "too many concurrent replays"})
+	}
+}
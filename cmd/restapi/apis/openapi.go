@@ -0,0 +1,333 @@
+package apis
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// Param is a query parameter of an operation. Path parameters are taken from the path.
+type Param struct {
+	Name        string
+	Type        string // "string", "integer" or "boolean"
+	Description string
+}
+
+// Operation describes a route for the OpenAPI document and the generated client in
+// cmd/restapi/client. Body and Response are values of the request and response types,
+// their schemas are derived from the json tags.
+type Operation struct {
+	ID       string // name of the client method
+	Method   string
+	Path     string // in gin syntax, relative to api/v1
+	Summary  string
+	Query    []Param
+	Body     interface{} // nil without a JSON body
+	RawBody  string      // media type of a body taken as is, instead of Body
+	Response interface{}
+	Admin    bool // requires the admin scope when authentication is enabled
+}
+
+var (
+	blockQuery   = Param{"block", "string", "number, hash, \"latest\", \"earliest\" or \"finalized\", latest if omitted"}
+	retraceQuery = []Param{{"values", "boolean", "include the values written"}, {"storage", "string", "\"nested\" to group storage by contract"}, {"calls", "boolean", "include the call tree"},
+		{"cursor", "string", "nextCursor of the previous page"}, {"limit", "integer", "most reads and writes per page"}}
+	vmQuery = []Param{{"tracer", "string", "\"calls\" for the call trees, \"gas\" for the gas by category of every transaction"},
+		{"fork", "string", "replay under the rules of this fork, e.g. \"istanbul\""}, {"eips", "string", "comma separated EIPs to enable, e.g. \"2315\""},
+		{"gaslimit", "string", "\"none\" for instructions never to run out of gas"}}
+	txsQuery    = Param{"txs", "boolean", "the reads and writes of every transaction, with its gas used, instead of those of the block"}
+	verifyQuery = Param{"verify", "boolean", "check the replayed receipts root, gas used and logs bloom against the header and the stored receipts"}
+	filterQuery = []Param{{"address", "string", "comma separated addresses whose accounts and storage are kept, can be repeated"},
+		{"prefix", "string", "comma separated hex prefixes of the storage keys kept, can be repeated"}, {"writesOnly", "boolean", "drop the reads"}}
+	csvFormat     = Param{"format", "string", "\"csv\" for text/csv rows instead of JSON"}
+	historyQuery  = []Param{{"from", "integer", "first block, required"}, {"to", "integer", "last block, the head if omitted"}, csvFormat}
+	analysisQuery = []Param{blockQuery}
+)
+
+// Operations are the built-in routes. Routes of extensions are described by their
+// Operations field.
+var Operations = []Operation{
+	{ID: "GetRemoteDB", Method: http.MethodGet, Path: "private-api/", Summary: "Address of the remote database", Response: map[string]string{}},
+	{ID: "SetRemoteDB", Method: http.MethodPost, Path: "private-api/", Summary: "Switch to another remote database",
+		Query: []Param{{"host", "string", ""}, {"port", "string", ""}}, Admin: true},
+	{ID: "GetAccount", Method: http.MethodGet, Path: "accounts/:accountID", Summary: "Account by address or hashed address",
+		Query: []Param{blockQuery}, Response: map[string]interface{}{}},
+	{ID: "FindStorage", Method: http.MethodGet, Path: "storage/", Summary: "Storage entries by key prefix",
+		Query: []Param{{"prefix", "string", "hex key prefix"}, blockQuery}, Response: []*StorageResponse{}},
+	{ID: "DecodeStorage", Method: http.MethodPost, Path: "storage/decode", Summary: "Variables of a contract from a solc storage layout",
+		Query: []Param{blockQuery}, Body: DecodeStorageRequest{}, Response: DecodeStorageResponse{}},
+	{ID: "Retrace", Method: http.MethodGet, Path: "retrace/:chain/:number", Summary: "Accounts and storage read and written by a block, ?format=parity gives OpenEthereum state diffs instead",
+		Query: append([]Param{{"format", "string", "\"parity\" for trace_replayBlockTransactions state diffs, \"csv\" for text/csv rows"}, txsQuery, verifyQuery}, append(append(vmQuery, retraceQuery...), filterQuery...)...), Response: RetraceResponse{}},
+	{ID: "RetraceRange", Method: http.MethodGet, Path: "retrace/:chain/:from/:to", Summary: "Accounts and storage read and written by the blocks from..to",
+		Query: filterQuery, Response: RetraceRangeResponse{}},
+	{ID: "RetraceBatch", Method: http.MethodPost, Path: "retrace/:chain", Summary: "Retraces of blocks and transactions, one line each with Accept: application/x-ndjson",
+		Query: append(append([]Param{txsQuery, verifyQuery}, vmQuery...), append(retraceQuery[:3:3], filterQuery...)...), Body: []RetraceBatchItem{}, Response: RetraceBatchResponse{}},
+	{ID: "RetraceWitness", Method: http.MethodGet, Path: "retrace/:chain/:number/witness", Summary: "Witness of the state read and written by a block, for stateless clients",
+		Response: BlockWitnessResponse{}},
+	{ID: "RetraceTx", Method: http.MethodGet, Path: "retrace/:chain/tx/:hash", Summary: "Accounts and storage read and written by a transaction",
+		Query: append(append([]Param{csvFormat}, retraceQuery...), filterQuery...), Response: RetraceTxResponse{}},
+	{ID: "TraceTx", Method: http.MethodGet, Path: "trace/:chain/tx/:hash", Summary: "Opcode trace of a transaction",
+		Query: []Param{{"stack", "boolean", "include the stack, true by default"}, {"memory", "boolean", "include the memory"}, {"limit", "integer", "most steps returned"}}, Response: TxTrace{}},
+	{ID: "TraceTxGas", Method: http.MethodGet, Path: "trace/:chain/tx/:hash/gas", Summary: "Gas of a transaction by category", Response: TxGas{}},
+	{ID: "TxAccessList", Method: http.MethodGet, Path: "trace/:chain/tx/:hash/access-list", Summary: "Access list of a transaction", Response: AccessListResponse{}},
+	{ID: "TxStorageXref", Method: http.MethodGet, Path: "trace/:chain/tx/:hash/storage-xref", Summary: "Storage accesses of a transaction against those predicted by the analysis", Response: StorageXrefResponse{}},
+	{ID: "CallAccessList", Method: http.MethodPost, Path: "trace/:chain/:number/access-list", Summary: "Access list of a call at the start of a block",
+		Body: AccessListCall{}, Response: AccessListResponse{}},
+	{ID: "Receipts", Method: http.MethodGet, Path: "receipts/:chain/:number", Summary: "Receipts of a block",
+		Query: []Param{{"reexecute", "boolean", "execute the block even if its receipts are stored"}}, Response: ReceiptsResponse{}},
+	{ID: "AccountHistory", Method: http.MethodGet, Path: "history/:chain/account/:address", Summary: "Blocks changing an account",
+		Query: historyQuery, Response: AccountHistory{}},
+	{ID: "StorageHistory", Method: http.MethodGet, Path: "history/:chain/storage/:address/:slot", Summary: "Blocks changing a storage slot",
+		Query: historyQuery, Response: StorageHistory{}},
+	{ID: "LogHistory", Method: http.MethodGet, Path: "history/:chain/logs/:address", Summary: "Logs of an address, from the log index",
+		Query: append(historyQuery[:2:2], Param{"topic", "string", "only the logs with this topic, at any position"}), Response: LogHistory{}},
+	{ID: "AccountState", Method: http.MethodGet, Path: "state/:chain/:number/account/:address", Summary: "Account after a block", Response: AccountState{}},
+	{ID: "Supply", Method: http.MethodGet, Path: "supply/:chain/:number", Summary: "Ether issued up to a block", Response: Supply{}},
+	{ID: "Rewards", Method: http.MethodGet, Path: "rewards/:chain/:number", Summary: "Rewards and fees of a block", Response: BlockRewards{}},
+	{ID: "FindIntermediateHash", Method: http.MethodGet, Path: "intermediate-hash/", Summary: "Intermediate hashes by prefix",
+		Query: []Param{{"prefix", "string", "hex prefix"}}, Response: []*IntermediateHashResponse{}},
+	{ID: "IntermediateHashNode", Method: http.MethodGet, Path: "intermediate-hash/node/:prefix", Summary: "Intermediate hash of a node", Response: IntermediateHashResponse{}},
+	{ID: "VerifyStateRoot", Method: http.MethodGet, Path: "intermediate-hash/root", Summary: "State root computed from the intermediate hashes", Response: StateRootResponse{}},
+	{ID: "BucketSizes", Method: http.MethodGet, Path: "db/buckets-stat", Summary: "Size of every bucket", Response: map[string]map[string]float64{}},
+	{ID: "DBSize", Method: http.MethodGet, Path: "db/size", Summary: "Size of the database on disk", Response: uint64(0)},
+	{ID: "BucketStats", Method: http.MethodGet, Path: "db/buckets", Summary: "Entries and B-tree statistics of every bucket",
+		Query: []Param{{"sample", "integer", "estimate from the first entries of every bucket"}}, Response: map[string]*BucketStats{}},
+	{ID: "DBGrowth", Method: http.MethodGet, Path: "db/growth", Summary: "Growth of the database and forecast of the disk full",
+		Query: []Param{{"days", "integer", "days of samples, 7 if omitted"}}, Response: DBGrowth{}},
+	{ID: "Selector", Method: http.MethodGet, Path: "selectors/:selector", Summary: "Text signatures of a function selector", Response: SelectorResponse{}},
+	{ID: "AddSelectors", Method: http.MethodPost, Path: "selectors/", Summary: "Add text signatures", Body: []string{}, Response: SelectorsAdded{}, Admin: true},
+	{ID: "ImportSelectors", Method: http.MethodPost, Path: "selectors/import", Summary: "Import a dump with one signature, optionally preceded by its selector, per line",
+		RawBody: "text/plain", Response: SelectorsAdded{}, Admin: true},
+	{ID: "Finality", Method: http.MethodGet, Path: "finality/", Summary: "Head, confirmations required and finalized block", Response: map[string]uint64{}},
+	{ID: "SetFinalized", Method: http.MethodPost, Path: "finality/", Summary: "Set the finalized block",
+		Query: []Param{{"number", "integer", "finalized block, required"}}, Admin: true},
+	{ID: "BatchRead", Method: http.MethodPost, Path: "batch/", Summary: "Several reads in one database transaction",
+		Query: []Param{blockQuery}, Body: BatchReadRequest{}, Response: BatchReadResponse{}},
+	{ID: "AnalysisStats", Method: http.MethodGet, Path: "analysis-stats", Summary: "Cost of the analyses since startup", Response: &AnalysisStats{}},
+	{ID: "Analysis", Method: http.MethodGet, Path: "analysis/:chain/:address", Summary: "Static analysis of a contract",
+		Query: analysisQuery, Response: AnalysisResponse{}},
+	{ID: "ProtocolAnalysis", Method: http.MethodGet, Path: "analysis/:chain/:address/protocol", Summary: "Analysis of the contracts called by a contract",
+		Query: append([]Param{{"depth", "integer", "most calls followed"}, {"contracts", "integer", "most contracts analysed"}}, analysisQuery...), Response: ProtocolAnalysis{}},
+	{ID: "Decompile", Method: http.MethodGet, Path: "analysis/:chain/:address/decompile", Summary: "Pseudo-Yul of the public functions of a contract",
+		Query: analysisQuery, Response: Decompiled{}},
+	{ID: "JumpCheck", Method: http.MethodGet, Path: "analysis/:chain/:address/jumps/:number", Summary: "Jumps taken by a contract in replayed blocks checked against its CFG",
+		Query: []Param{{"to", "integer", "last block replayed, number if omitted"}}, Response: JumpCheckResponse{}},
+	{ID: "Warmup", Method: http.MethodPost, Path: "warmup/", Summary: "Read what the first requests after a restart need",
+		Query: []Param{{"blocks", "integer", ""}, {"contracts", "integer", ""}, {"ih", "integer", ""}}, Response: WarmupResult{}, Admin: true},
+	{ID: "Chains", Method: http.MethodGet, Path: "chains/", Summary: "Chains the :chain segment may name", Response: []Chain{}},
+	{ID: "RegisterChain", Method: http.MethodPost, Path: "chains/", Summary: "Register a chain by genesis hash or config", Body: Chain{}, Response: map[string]string{}, Admin: true},
+	{ID: "Capabilities", Method: http.MethodGet, Path: "capabilities/", Summary: "Optional subsystems of the deployment", Response: Capabilities{}},
+}
+
+// SelectorResponse is what GET selectors/:selector returns.
+type SelectorResponse struct {
+	Selector   string   `json:"selector"`
+	Signatures []string `json:"signatures"`
+}
+
+// SelectorsAdded is what adding or importing selectors returns.
+type SelectorsAdded struct {
+	Added int `json:"added"`
+	Total int `json:"total"`
+}
+
+// RegisterOpenAPI serves the OpenAPI document of the built-in routes and the extensions.
+func RegisterOpenAPI(router gin.IRoutes) {
+	doc := OpenAPI(Extensions())
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	})
+}
+
+// OpenAPI builds the OpenAPI 3 document of Operations and those of the extensions.
+func OpenAPI(exts []Extension) map[string]interface{} {
+	ops := append([]Operation(nil), Operations...)
+	for _, ext := range exts {
+		for _, op := range ext.Operations {
+			op.Path = ext.Name + "/" + strings.TrimPrefix(op.Path, "/")
+			ops = append(ops, op)
+		}
+	}
+	s := &schemaBuilder{components: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+	for _, op := range ops {
+		path, pathParams := openAPIPath(op.Path)
+		var parameters []interface{}
+		for _, name := range pathParams {
+			parameters = append(parameters, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+			})
+		}
+		for _, p := range op.Query {
+			param := map[string]interface{}{"name": p.Name, "in": "query", "schema": map[string]string{"type": p.Type}}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			parameters = append(parameters, param)
+		}
+		operation := map[string]interface{}{
+			"operationId": op.ID,
+			"summary":     op.Summary,
+			"responses":   map[string]interface{}{"200": s.response(op.Response), "default": errorResponse},
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if op.Admin {
+			operation["description"] = "Requires the admin scope when authentication is enabled."
+		}
+		switch {
+		case op.Body != nil:
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{MIMEJSON: map[string]interface{}{"schema": s.of(reflect.TypeOf(op.Body))}},
+			}
+		case op.RawBody != "":
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{op.RawBody: map[string]interface{}{"schema": map[string]string{"type": "string"}}},
+			}
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(op.Method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": "turbo-geth REST API", "version": params.VersionWithMeta},
+		"servers": []map[string]string{{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": s.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]string{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]string{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		// only enforced when the server is started with --auth.keys or --auth.jwt.secret
+		"security": []map[string][]string{{"bearer": {}}, {"apiKey": {}}},
+	}
+}
+
+var errorResponse = map[string]interface{}{
+	"description": "error",
+	"content": map[string]interface{}{MIMEJSON: map[string]interface{}{"schema": map[string]interface{}{
+		"type": "object", "properties": map[string]interface{}{
+			"code":    map[string]string{"type": "string", "description": "see ErrorResponse, absent from some older errors"},
+			"message": map[string]string{"type": "string"},
+		},
+	}}},
+}
+
+// openAPIPath converts a gin path to an OpenAPI path and returns its parameters.
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	var params []string
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") {
+			params = append(params, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return "/" + strings.Join(segments, "/"), params
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaBuilder derives JSON schemas from Go types as encoding/json marshals them. Named
+// structs become components, referenced from where they are used.
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func (s *schemaBuilder) response(v interface{}) map[string]interface{} {
+	if v == nil {
+		return map[string]interface{}{"description": "OK"}
+	}
+	return map[string]interface{}{
+		"description": "OK",
+		"content":     map[string]interface{}{MIMEJSON: map[string]interface{}{"schema": s.of(reflect.TypeOf(v))}},
+	}
+}
+
+func (s *schemaBuilder) of(t reflect.Type) map[string]interface{} {
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(textMarshalerType) || t.Implements(textMarshalerType) {
+		return map[string]interface{}{"type": "string"}
+	}
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(jsonMarshalerType) || t.Implements(jsonMarshalerType) {
+		return map[string]interface{}{} // custom encoding, any value
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.of(t.Elem())
+		if _, ref := schema["$ref"]; !ref {
+			schema["nullable"] = true
+		}
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := s.components[t.Name()]; !ok {
+			s.components[t.Name()] = nil // a placeholder for recursive types
+			s.components[t.Name()] = s.object(t)
+		}
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// object lists the fields of a struct, those of embedded structs included.
+func (s *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				collect(f.Type)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = s.of(f.Type)
+		}
+	}
+	collect(t)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
@@ -0,0 +1,47 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func serve(h http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	r := gin.New()
+	RegisterOpenAPI(r)
+	w := serve(r, http.MethodGet, "/openapi.json", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.NotEmpty(t, doc.OpenAPI)
+	for _, op := range Operations {
+		path, _ := openAPIPath(op.Path)
+		operation, ok := doc.Paths[path][strings.ToLower(op.Method)]
+		if assert.True(t, ok, "%s %s missing", op.Method, path) {
+			assert.Equal(t, op.ID, operation["operationId"])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package apis
+
+import (
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+const (
+	defaultProtocolDepth     = 3
+	defaultProtocolContracts = 50
+	maxProtocolContracts     = 200
+)
+
+// ProtocolAnalysis is the call graph of the contracts reachable from a root contract
+// through call sites with constant targets or targets kept in constant storage slots.
+type ProtocolAnalysis struct {
+	CommitPoint CommitPoint        `json:"commitPoint"`
+	Root        common.Address     `json:"root"`
+	Contracts   []ProtocolContract `json:"contracts"`
+	Calls       []ProtocolCall     `json:"calls"`
+	Truncated   bool               `json:"truncated"` // the depth or contract limit was hit
+}
+
+type ProtocolContract struct {
+	Address   common.Address `json:"address"`
+	CodeHash  common.Hash    `json:"codeHash"`
+	CodeSize  int            `json:"codeSize"`
+	Depth     int            `json:"depth"`
+	Functions int            `json:"functions"`
+	Unknown   int            `json:"unknownCalls"` // call sites whose target could not be resolved
+}
+
+// ProtocolCall is a resolved call site, Via is "constant" or "storage" (then Slot is set).
+type ProtocolCall struct {
+	From common.Address `json:"from"`
+	PC   int            `json:"pc"`
+	Kind string         `json:"kind"`
+	To   common.Address `json:"to"`
+	Via  string         `json:"via"`
+	Slot string         `json:"slot,omitempty"`
+}
+
+func (e *Env) GetProtocolAnalysis(c *gin.Context) {
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	depth, contracts := defaultProtocolDepth, defaultProtocolContracts
+	if s := c.Query("depth"); s != "" {
+		if depth, err = strconv.Atoi(s); err != nil || depth < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "invalid depth " + s})
+			return
+		}
+	}
+	if s := c.Query("contracts"); s != "" {
+		if contracts, err = strconv.Atoi(s); err != nil || contracts < 1 || contracts > maxProtocolContracts {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "contracts must be between 1 and " + strconv.Itoa(maxProtocolContracts)})
+			return
+		}
+	}
+	root := common.HexToAddress(c.Param("address"))
+	var result ProtocolAnalysis
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		cp, err := e.commitPoint(c, tx)
+		if err != nil {
+			return err
+		}
+		rules := chainConfig.Rules(new(big.Int).SetUint64(cp.Block))
+		result, err = e.analyseProtocol(tx, cp, rules, root, depth, contracts)
+		return err
+	}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if len(result.Contracts) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "contract not found"})
+		return
+	}
+	render(c, http.StatusOK, result)
+}
+
+// analyseProtocol walks the call graph breadth first from the root, analysing every
+// contract with code once.
+func (e *Env) analyseProtocol(tx ethdb.Tx, cp CommitPoint, rules params.Rules, root common.Address, maxDepth, maxContracts int) (ProtocolAnalysis, error) {
+	result := ProtocolAnalysis{CommitPoint: cp, Root: root, Calls: []ProtocolCall{}}
+	type queued struct {
+		address common.Address
+		depth   int
+	}
+	seen := map[common.Address]bool{root: true}
+	queue := []queued{{root, 0}}
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		codeHash, code, err := readCodeTx(tx, q.address, cp.Block)
+		if err != nil {
+			return result, err
+		}
+		if len(code) == 0 {
+			continue // externally owned account or precompile
+		}
+		if len(result.Contracts) == maxContracts {
+			result.Truncated = true
+			break
+		}
+		cfg, _ := e.analyse(q.address, codeHash, code, rules)
+		contract := ProtocolContract{Address: q.address, CodeHash: codeHash, CodeSize: len(code), Depth: q.depth, Functions: len(cfg.Functions)}
+		account, err := readAccountTx(tx, q.address, cp.Block)
+		if err != nil {
+			return result, err
+		}
+		for _, t := range cfg.CallTargets() {
+			call := ProtocolCall{From: q.address, PC: t.PC, Kind: strings.ToLower(t.Op.String())}
+			switch {
+			case t.Address != nil:
+				call.To, call.Via = *t.Address, "constant"
+			case t.Slot != nil && account != nil:
+				slot := common.Hash(t.Slot.Bytes32())
+				v, err := readStorageTx(tx, q.address, account.Incarnation, slot, cp.Block)
+				if err != nil {
+					return result, err
+				}
+				call.To, call.Via, call.Slot = common.BytesToAddress(v), "storage", slot.Hex()
+			default:
+				contract.Unknown++
+				continue
+			}
+			result.Calls = append(result.Calls, call)
+			if seen[call.To] || call.To == (common.Address{}) {
+				continue
+			}
+			if q.depth == maxDepth {
+				result.Truncated = true
+				continue
+			}
+			seen[call.To] = true
+			queue = append(queue, queued{call.To, q.depth + 1})
+		}
+		result.Contracts = append(result.Contracts, contract)
+	}
+	return result, nil
+}
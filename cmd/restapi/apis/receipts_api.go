@@ -0,0 +1,94 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func RegisterReceiptsAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(e.limitReplays)
+	router.GET(":chain/:number", e.GetReceipts)
+	return nil
+}
+
+// ReceiptsResponse holds the receipts of a block, read from the receipts bucket or, if
+// they are not stored or ?reexecute=true, obtained by executing the block again. Their
+// root is checked against the header in both cases.
+type ReceiptsResponse struct {
+	BlockNumber  uint64         `json:"blockNumber"`
+	BlockHash    common.Hash    `json:"blockHash"`
+	Source       string         `json:"source"` // "stored" or "reexecuted"
+	Receipts     types.Receipts `json:"receipts"`
+	ReceiptsRoot common.Hash    `json:"receiptsRoot"` // of the receipts above
+	HeaderRoot   common.Hash    `json:"headerReceiptsRoot"`
+	RootMismatch bool           `json:"rootMismatch"`
+	BlockFinality
+}
+
+func (e *Env) GetReceipts(c *gin.Context) {
+	bn, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	bf, err := e.Finality.Of(e.DB, bn)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := BlockReceipts(c.Request.Context(), bn, c.Param("chain"), e.KV, e.DB, c.Query("reexecute") == "true")
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result.BlockFinality = bf
+	render(c, http.StatusOK, result)
+}
+
+// BlockReceipts reads the receipts of the canonical block, executing it on the state after
+// its parent if they are not stored or reexecute is set.
+func BlockReceipts(ctx context.Context, blockNumber uint64, chain string, kv ethdb.KV, db ethdb.Getter, reexecute bool) (ReceiptsResponse, error) {
+	chainConfig, err := ReadChainConfig(kv, chain)
+	if err != nil {
+		return ReceiptsResponse{}, err
+	}
+	block := rawdb.ReadBlockByNumber(db, blockNumber)
+	if block == nil {
+		return ReceiptsResponse{}, fmt.Errorf("%w: %d", ErrBlockNotFound, blockNumber)
+	}
+	result := ReceiptsResponse{BlockNumber: blockNumber, BlockHash: block.Hash(), Source: "stored", HeaderRoot: block.ReceiptHash()}
+	if !reexecute {
+		result.Receipts = rawdb.ReadReceipts(db, block.Hash(), blockNumber, chainConfig)
+	}
+	if result.Receipts == nil && len(block.Transactions()) > 0 {
+		result.Source = "reexecuted"
+		reader := NewRemoteReader(ctx, kv, blockNumber-1)
+		if err = reader.PrefetchSenders(chainConfig, block); err != nil {
+			return ReceiptsResponse{}, err
+		}
+		ibs := state.New(reader)
+		noOpWriter := state.NewNoopWriter()
+		if result.Receipts, err = runBlock(ctx, ibs, noOpWriter, noOpWriter, chainConfig, NewRemoteContext(kv, db, chainConfig), block, vm.Config{}, nil); err != nil {
+			return ReceiptsResponse{}, err
+		}
+		if err = result.Receipts.DeriveFields(chainConfig, block.Hash(), blockNumber, block.Transactions()); err != nil {
+			return ReceiptsResponse{}, err
+		}
+	}
+	if result.Receipts == nil {
+		result.Receipts = types.Receipts{}
+	}
+	result.ReceiptsRoot = types.DeriveSha(result.Receipts)
+	result.RootMismatch = result.ReceiptsRoot != result.HeaderRoot
+	return result, nil
+}
@@ -6,11 +6,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
 )
 
 func RegisterPrivateAPI(router *gin.RouterGroup, e *Env) error {
 	router.GET("/", e.GetDB)
-	router.POST("/", e.PostDB)
+	router.POST("/", requireAdmin, e.PostDB)
 	return nil
 }
 
@@ -26,12 +27,12 @@ func (e *Env) GetDB(c *gin.Context) {
 
 func (e *Env) PostDB(c *gin.Context) {
 	newAddr := c.Query("host") + ":" + c.Query("port")
-	kv, back, err := ethdb.NewRemote().Path(newAddr).Open()
+	kv, back, err := e.OpenRemote(newAddr)
 	if err != nil {
 		c.Error(err) //nolint:errcheck
 		return
 	}
-	e.RemoteDBAddress = newAddr
+	e.RemoteDBAddress, e.Chaindata = newAddr, ""
 
 	e.KV.Close()
 
@@ -39,5 +40,8 @@ func (e *Env) PostDB(c *gin.Context) {
 	db := ethdb.NewObjectDatabase(kv)
 	e.DB = db
 	e.Back = back
+	if e.Chain, err = DetectChain(kv); err != nil {
+		log.Warn("Could not detect the chain of the new database", "err", err)
+	}
 	c.Status(http.StatusOK)
 }
@@ -2,11 +2,13 @@ package apis
 
 import (
 	"bytes"
-	"math/big"
+	"fmt"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/consensus/clique"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/core/types"
@@ -14,7 +16,6 @@ import (
 	"github.com/ledgerwatch/turbo-geth/crypto"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/params"
-	"github.com/ledgerwatch/turbo-geth/rpc"
 	"golang.org/x/net/context"
 )
 
@@ -23,69 +24,25 @@ type RemoteReader struct {
 	accountReads map[common.Address]struct{}
 	storageReads map[common.Address]map[common.Hash]struct{}
 	codeReads    map[common.Address]struct{}
-	blockNr      uint64
-	db           ethdb.KV
+	db           *state.HistoryView
+	prefetched   map[common.Address][]byte // encoded accounts, nil for missing ones, see PrefetchSenders
+	ctx          context.Context           // of the request, the reads of an abandoned one fail
 }
 
+// RemoteContext is the chain context of replays, with the consensus engine of the chain.
 type RemoteContext struct {
-	kv ethdb.KV
-	db ethdb.Getter
+	kv     ethdb.KV
+	db     ethdb.Getter
+	engine consensus.Engine
 }
 
-type powEngine struct {
-}
-
-func (c *powEngine) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
-
-	panic("must not be called")
-}
-func (c *powEngine) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (func(), <-chan error) {
-	panic("must not be called")
-}
-func (c *powEngine) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
-	panic("must not be called")
-}
-func (c *powEngine) VerifySeal(chain consensus.ChainHeaderReader, header *types.Header) error {
-	panic("must not be called")
-}
-func (c *powEngine) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
-	panic("must not be called")
-}
-func (c *powEngine) Finalize(chainConfig *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction, uncles []*types.Header) {
-	panic("must not be called")
-}
-func (c *powEngine) FinalizeAndAssemble(chainConfig *params.ChainConfig, header *types.Header, state *state.IntraBlockState, txs []*types.Transaction,
-	uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
-	panic("must not be called")
-}
-func (c *powEngine) Seal(_ consensus.Cancel, chain consensus.ChainHeaderReader, block *types.Block, results chan<- consensus.ResultWithContext, stop <-chan struct{}) error {
-	panic("must not be called")
-}
-func (c *powEngine) SealHash(header *types.Header) common.Hash {
-	panic("must not be called")
-}
-func (c *powEngine) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
-	panic("must not be called")
-}
-func (c *powEngine) APIs(chain consensus.ChainHeaderReader) []rpc.API {
-	panic("must not be called")
-}
-
-func (c *powEngine) Close() error {
-	panic("must not be called")
-}
-
-func (c *powEngine) Author(header *types.Header) (common.Address, error) {
-	return header.Coinbase, nil
-}
-
-func NewRemoteReader(db ethdb.KV, blockNr uint64) *RemoteReader {
+func NewRemoteReader(ctx context.Context, db ethdb.KV, blockNr uint64) *RemoteReader {
 	return &RemoteReader{
 		accountReads: make(map[common.Address]struct{}),
 		storageReads: make(map[common.Address]map[common.Hash]struct{}),
 		codeReads:    make(map[common.Address]struct{}),
-		db:           db,
-		blockNr:      blockNr,
+		db:           state.NewHistoryView(db, blockNr),
+		ctx:          ctx,
 	}
 }
 
@@ -117,11 +74,7 @@ func (r *RemoteReader) GetCodeReads() [][]byte {
 
 func (r *RemoteReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
 	r.accountReads[address] = struct{}{}
-	addrHash, err := common.HashData(address[:])
-	if err != nil {
-		return nil, err
-	}
-	enc, err := state.GetAsOf(r.db, false /* storage */, addrHash[:], r.blockNr+1)
+	enc, err := r.readPlainState(address[:])
 	if err != nil || enc == nil || len(enc) == 0 {
 		return nil, nil
 	}
@@ -132,6 +85,39 @@ func (r *RemoteReader) ReadAccountData(address common.Address) (*accounts.Accoun
 	return &acc, nil
 }
 
+// PrefetchSenders reads the accounts of the senders of the transactions of the block at once,
+// a single round trip to remote databases, instead of as each transaction starts.
+func (r *RemoteReader) PrefetchSenders(chainConfig *params.ChainConfig, block *types.Block) error {
+	signer := types.MakeSigner(chainConfig, block.Number())
+	var senders []common.Address
+	var keys [][]byte
+	seen := make(map[common.Address]bool)
+	for _, tx := range block.Transactions() {
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			return fmt.Errorf("tx %x: %w", tx.Hash(), err)
+		}
+		if !seen[sender] {
+			seen[sender] = true
+			senders = append(senders, sender)
+			keys = append(keys, common.CopyBytes(sender[:]))
+		}
+	}
+	var values [][]byte
+	if err := r.db.View(r.ctx, func(tx ethdb.Tx) error {
+		var err error
+		values, err = tx.MultiGet(dbutils.PlainStateBucket, keys)
+		return err
+	}); err != nil {
+		return err
+	}
+	r.prefetched = make(map[common.Address][]byte, len(senders))
+	for i, sender := range senders {
+		r.prefetched[sender] = values[i]
+	}
+	return nil
+}
+
 func (r *RemoteReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
 	m, ok := r.storageReads[address]
 	if !ok {
@@ -139,18 +125,8 @@ func (r *RemoteReader) ReadAccountStorage(address common.Address, incarnation ui
 		r.storageReads[address] = m
 	}
 	m[*key] = struct{}{}
-	keyHash, err := common.HashData(key[:])
-	if err != nil {
-		return nil, err
-	}
-
-	addrHash, err := common.HashData(address[:])
-	if err != nil {
-		return nil, err
-	}
-
-	compositeKey := dbutils.GenerateCompositeStorageKey(addrHash, incarnation, keyHash)
-	enc, err := state.GetAsOf(r.db, true /* storage */, compositeKey, r.blockNr+1)
+	compositeKey := dbutils.PlainGenerateCompositeStorageKey(address, incarnation, *key)
+	enc, err := r.readPlainState(compositeKey)
 	if err != nil || enc == nil {
 		return nil, nil
 	}
@@ -163,7 +139,7 @@ func (r *RemoteReader) ReadAccountCode(address common.Address, codeHash common.H
 		return nil, nil
 	}
 	var val []byte
-	err := r.db.View(context.Background(), func(tx ethdb.Tx) error {
+	err := r.db.View(r.ctx, func(tx ethdb.Tx) error {
 		v, err := tx.Get(dbutils.CodeBucket, codeHash[:])
 		val = v
 		return err
@@ -174,6 +150,17 @@ func (r *RemoteReader) ReadAccountCode(address common.Address, codeHash common.H
 	return val, nil
 }
 
+// readPlainState reads an account or a storage slot as of the block of the reader.
+func (r *RemoteReader) readPlainState(key []byte) ([]byte, error) {
+	var v []byte
+	err := r.db.View(r.ctx, func(tx ethdb.Tx) error {
+		var err error
+		v, err = tx.Get(dbutils.PlainStateBucket, key)
+		return err
+	})
+	return v, err
+}
+
 func (r *RemoteReader) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
 	code, err := r.ReadAccountCode(address, codeHash)
 	if err != nil {
@@ -186,15 +173,26 @@ func (r *RemoteReader) ReadAccountIncarnation(address common.Address) (uint64, e
 	return 0, nil
 }
 
-func NewRemoteContext(kv ethdb.KV, db ethdb.Getter) *RemoteContext {
+func NewRemoteContext(kv ethdb.KV, db ethdb.Getter, chainConfig *params.ChainConfig) *RemoteContext {
 	return &RemoteContext{
-		kv: kv,
-		db: db,
+		kv:     kv,
+		db:     db,
+		engine: consensusEngine(chainConfig),
+	}
+}
+
+// consensusEngine returns the engine finalizing the blocks of the chain. On clique chains
+// the signer recovered from the header, not the coinbase, is the beneficiary of the fees and
+// of COINBASE, and there are no rewards. Seals are not verified, ethash is a faker.
+func consensusEngine(chainConfig *params.ChainConfig) consensus.Engine {
+	if chainConfig.Clique != nil {
+		return clique.New(chainConfig.Clique, nil) // the database only holds vote snapshots
 	}
+	return ethash.NewFullFaker()
 }
 
 func (e *RemoteContext) Engine() consensus.Engine {
-	return &powEngine{}
+	return e.engine
 }
 
 func (e *RemoteContext) GetHeader(hash common.Hash, number uint64) *types.Header {
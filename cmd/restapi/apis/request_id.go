@@ -0,0 +1,69 @@
+package apis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// RequestIDHeader carries the ID of a request, taken from the request if a proxy set one,
+// echoed in the response and logged with everything the request causes.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request a context belongs to, empty outside of requests.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware gives every request an ID, the one of its RequestIDHeader if it is
+// printable and not too long, or else a random one.
+func RequestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		var b [16]byte
+		rand.Read(b[:]) //nolint:errcheck
+		id = hex.EncodeToString(b[:])
+	}
+	c.Header(RequestIDHeader, id)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+	c.Next()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool { return r <= ' ' || r > '~' }) < 0
+}
+
+// AccessLog logs every request once it is served, with its ID and the errors its handlers
+// recorded. It replaces the logger of gin, for the logs to have a single format.
+func AccessLog(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	r := c.Request
+	ctx := []interface{}{"id", RequestID(r.Context()), "method", r.Method, "path", r.URL.Path}
+	if r.URL.RawQuery != "" {
+		ctx = append(ctx, "query", r.URL.RawQuery)
+	}
+	ctx = append(ctx, "status", c.Writer.Status(), "bytes", c.Writer.Size(), "elapsed", time.Since(start), "client", c.ClientIP())
+	if len(c.Errors) > 0 {
+		ctx = append(ctx, "err", strings.Join(c.Errors.Errors(), "; "))
+	}
+	if c.Writer.Status() >= http.StatusInternalServerError {
+		log.Warn("Request failed", ctx...)
+	} else {
+		log.Info("Served request", ctx...)
+	}
+}
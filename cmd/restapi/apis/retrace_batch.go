@@ -0,0 +1,191 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// RetraceBatchItem is a block, given as a JSON number or a decimal string, or a transaction,
+// given as its 0x-prefixed hash.
+type RetraceBatchItem struct {
+	Block *uint64
+	Tx    *common.Hash
+}
+
+func (it RetraceBatchItem) MarshalJSON() ([]byte, error) {
+	if it.Tx != nil {
+		return json.Marshal(it.Tx)
+	}
+	if it.Block != nil {
+		return json.Marshal(*it.Block)
+	}
+	return nil, fmt.Errorf("empty retrace batch item")
+}
+
+func (it *RetraceBatchItem) UnmarshalJSON(b []byte) error {
+	var number uint64
+	if err := json.Unmarshal(b, &number); err == nil {
+		it.Block = &number
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("%w: batch items are block numbers or transaction hashes, not %s", ErrInvalidParam, b)
+	}
+	if strings.HasPrefix(s, "0x") && len(s) == 2+2*common.HashLength {
+		hash := common.HexToHash(s)
+		it.Tx = &hash
+		return nil
+	}
+	number, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: batch items are block numbers or transaction hashes, not %q", ErrInvalidParam, s)
+	}
+	it.Block = &number
+	return nil
+}
+
+// RetraceBatchResult is the retrace of an item of a batch, or why it failed. Block is that
+// of the transaction for transaction items.
+type RetraceBatchResult struct {
+	Block   uint64           `json:"block"`
+	Tx      *common.Hash     `json:"tx,omitempty"`
+	TxIndex *uint64          `json:"txIndex,omitempty"`
+	Retrace *RetraceResponse `json:"retrace,omitempty"`
+	Error   *ErrorResponse   `json:"error,omitempty"`
+}
+
+type RetraceBatchResponse struct {
+	Results []RetraceBatchResult `json:"results"` // in the order of the request
+}
+
+// PostRetraceBatch retraces the blocks and transactions of the body one after the other,
+// holding a single replay slot. A failing item does not fail the others.
+func (e *Env) PostRetraceBatch(c *gin.Context) {
+	var items []RetraceBatchItem
+	if err := c.ShouldBindJSON(&items); err != nil {
+		if !errors.Is(err, ErrInvalidParam) {
+			err = fmt.Errorf("%w: %v", ErrInvalidParam, err)
+		}
+		abortWithError(c, err)
+		return
+	}
+	if len(items) == 0 {
+		abortWithError(c, fmt.Errorf("%w: empty batch", ErrInvalidParam))
+		return
+	}
+	if e.MaxRetraceBatch > 0 && len(items) > e.MaxRetraceBatch {
+		abortWithError(c, fmt.Errorf("%w: at most %d items can be retraced at once", ErrInvalidParam, e.MaxRetraceBatch))
+		return
+	}
+	opts, err := retraceOptions(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	filter, err := retraceFilterParams(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	chain := c.Param("chain")
+	ctx := c.Request.Context()
+	if !acceptsNDJSON(c) {
+		results := make([]RetraceBatchResult, 0, len(items))
+		for _, item := range items {
+			if ctx.Err() != nil {
+				return
+			}
+			results = append(results, e.retraceBatchItem(ctx, chain, item, opts, filter))
+		}
+		render(c, http.StatusOK, RetraceBatchResponse{Results: results})
+		return
+	}
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", MIMENDJSON)
+	enc := json.NewEncoder(c.Writer)
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := enc.Encode(e.retraceBatchItem(ctx, chain, item, opts, filter)); err != nil {
+			return // the client went away
+		}
+		c.Writer.Flush()
+	}
+}
+
+func (e *Env) retraceBatchItem(ctx context.Context, chain string, item RetraceBatchItem, opts RetraceOptions, filter *retraceFilter) RetraceBatchResult {
+	var result RetraceBatchResult
+	var retrace RetraceResponse
+	var bf BlockFinality
+	var err error
+	if item.Tx != nil {
+		result.Tx = item.Tx
+		retrace, bf, err = e.batchTxRetrace(ctx, chain, *item.Tx, &result, opts)
+	} else {
+		result.Block = *item.Block
+		retrace, bf, err = e.batchBlockRetrace(ctx, chain, *item.Block, opts)
+	}
+	if err == nil {
+		retrace = filter.apply(retrace)
+		retrace.Calls = nameCalls(retrace.Calls, e.Selectors)
+		retrace, err = pageRetrace(retrace, 0, 0, e.MaxResponseBytes)
+	}
+	if err != nil {
+		_, code := errorStatus(err)
+		if code == "internal" && ctx.Err() == nil {
+			log.Warn("Batch retrace failed", "id", RequestID(ctx), "block", result.Block, "tx", result.Tx, "err", err)
+		}
+		result.Error = &ErrorResponse{Code: code, Message: err.Error()}
+		return result
+	}
+	retrace.BlockFinality = bf
+	result.Retrace = &retrace
+	return result
+}
+
+// batchBlockRetrace retraces the block through the cache, like GetWritesReads.
+func (e *Env) batchBlockRetrace(ctx context.Context, chain string, bn uint64, opts RetraceOptions) (RetraceResponse, BlockFinality, error) {
+	bf, err := e.replayableBlock(bn)
+	if err != nil {
+		return RetraceResponse{}, bf, err
+	}
+	key := retraceCacheKey{Hash: rawdb.ReadCanonicalHash(e.DB, bn), Format: "retrace", Opts: opts}
+	cache := e.RetraceCache
+	if key.Hash == (common.Hash{}) {
+		cache = nil
+	}
+	result, _, err := cache.fetch(bn, key, func() interface{} { return new(RetraceResponse) }, func() (interface{}, error) {
+		results, err := Retrace(ctx, strconv.FormatUint(bn, 10), chain, e.KV, e.DB, opts)
+		return &results, err
+	})
+	if err != nil {
+		return RetraceResponse{}, bf, err
+	}
+	return *result.(*RetraceResponse), bf, nil
+}
+
+func (e *Env) batchTxRetrace(ctx context.Context, chain string, hash common.Hash, result *RetraceBatchResult, opts RetraceOptions) (RetraceResponse, BlockFinality, error) {
+	tx, _, bn, index := rawdb.ReadTransaction(e.DB, hash)
+	if tx == nil {
+		return RetraceResponse{}, BlockFinality{}, fmt.Errorf("%w: transaction %x", ErrEntityNotFound, hash)
+	}
+	result.Block, result.TxIndex = bn, &index
+	bf, err := e.replayableBlock(bn)
+	if err != nil {
+		return RetraceResponse{}, bf, err
+	}
+	retrace, err := RetraceTx(ctx, hash, bn, index, chain, e.KV, e.DB, opts)
+	return retrace.RetraceResponse, bf, err
+}
@@ -0,0 +1,161 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// RetraceCacheHeader tells if a retrace was served from the cache ("hit") or computed ("miss").
+const RetraceCacheHeader = "X-Retrace-Cache"
+
+var (
+	retraceCacheHitMeter  = metrics.NewRegisteredMeter("restapi/retrace/cache/hit", nil)
+	retraceCacheMissMeter = metrics.NewRegisteredMeter("restapi/retrace/cache/miss", nil)
+)
+
+// RetraceCache keeps block retraces by block hash, format and options, in memory and
+// optionally as JSON files in a directory, which survive restarts. As the keys are hashes
+// a reorg can never serve a stale retrace, but the retraces of the blocks it replaced are
+// dropped when a retrace of the new block at the same height is requested.
+type RetraceCache struct {
+	mem *lru.Cache
+	dir string
+
+	mu     sync.Mutex
+	hashes map[uint64]common.Hash // by number, the hash retraces were last requested for
+}
+
+type retraceCacheKey struct {
+	Hash   common.Hash
+	Format string
+	Opts   RetraceOptions
+}
+
+func (k retraceCacheKey) fileName() string {
+	name := fmt.Sprintf("%x-%s", k.Hash, k.Format)
+	for _, opt := range []struct {
+		set  bool
+		name string
+	}{{k.Opts.Values, "values"}, {k.Opts.Nested, "nested"}, {k.Opts.Calls, "calls"}, {k.Opts.Verify, "verify"}, {k.Opts.Txs, "txs"}, {k.Opts.Gas, "gas"}, {k.Opts.NoGasLimit, "nogaslimit"}} {
+		if opt.set {
+			name += "-" + opt.name
+		}
+	}
+	if k.Opts.Fork != "" {
+		name += "-fork_" + k.Opts.Fork
+	}
+	if k.Opts.EIPs != "" {
+		name += "-eips_" + strings.ReplaceAll(k.Opts.EIPs, ",", "_")
+	}
+	return name + ".json"
+}
+
+// NewRetraceCache returns nil, which disables caching, if size is not positive. dir is
+// created if needed, an empty dir keeps retraces in memory only.
+func NewRetraceCache(size int, dir string) (*RetraceCache, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	mem, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &RetraceCache{mem: mem, dir: dir, hashes: make(map[uint64]common.Hash)}, nil
+}
+
+// fetch returns the retrace of the key, computing and storing it on a miss. newResult
+// returns a pointer to decode a file into, compute returns a pointer to the same type.
+func (rc *RetraceCache) fetch(number uint64, key retraceCacheKey, newResult func() interface{}, compute func() (interface{}, error)) (interface{}, bool, error) {
+	if rc == nil {
+		result, err := compute()
+		return result, false, err
+	}
+	rc.checkReorg(number, key.Hash)
+	if result, ok := rc.mem.Get(key); ok {
+		retraceCacheHitMeter.Mark(1)
+		return result, true, nil
+	}
+	if rc.dir != "" {
+		if b, err := ioutil.ReadFile(filepath.Join(rc.dir, key.fileName())); err == nil {
+			result := newResult()
+			if err = json.Unmarshal(b, result); err == nil {
+				rc.mem.Add(key, result)
+				retraceCacheHitMeter.Mark(1)
+				return result, true, nil
+			}
+			log.Warn("Dropping unreadable cached retrace", "file", key.fileName(), "err", err)
+		}
+	}
+	retraceCacheMissMeter.Mark(1)
+	result, err := compute()
+	if err != nil {
+		return nil, false, err
+	}
+	rc.mem.Add(key, result)
+	if rc.dir != "" {
+		if err = rc.write(key, result); err != nil {
+			log.Warn("Could not store retrace", "file", key.fileName(), "err", err)
+		}
+	}
+	return result, false, nil
+}
+
+// write stores the retrace through a temporary file, so that readers never see a partial one.
+func (rc *RetraceCache) write(key retraceCacheKey, result interface{}) error {
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(rc.dir, "retrace-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(rc.dir, key.fileName()))
+}
+
+// checkReorg drops the retraces of the block previously seen at the height, if it changed.
+func (rc *RetraceCache) checkReorg(number uint64, hash common.Hash) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	old, ok := rc.hashes[number]
+	rc.hashes[number] = hash
+	if !ok || old == hash {
+		return
+	}
+	log.Info("Dropping retraces of a reorged block", "number", number, "hash", old)
+	for _, k := range rc.mem.Keys() {
+		if k.(retraceCacheKey).Hash == old {
+			rc.mem.Remove(k)
+		}
+	}
+	if rc.dir != "" {
+		files, _ := filepath.Glob(filepath.Join(rc.dir, fmt.Sprintf("%x-*.json", old)))
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package apis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// retraceFilter selects the reads and writes a retrace response keeps. It is applied to the
+// whole retrace before paging and encoding, so a cached retrace serves every filter.
+type retraceFilter struct {
+	addresses  map[string]bool // of accounts and storage, as in the response, any if empty
+	prefixes   []string        // of storage keys, as in the response, any if empty
+	writesOnly bool
+}
+
+// retraceFilterParams reads ?address=, ?prefix= and ?writesOnly=, the first two may be
+// repeated or comma separated. It returns nil without any of them.
+func retraceFilterParams(c *gin.Context) (*retraceFilter, error) {
+	f := &retraceFilter{addresses: make(map[string]bool), writesOnly: c.Query("writesOnly") == "true"}
+	for _, param := range c.QueryArray("address") {
+		for _, s := range strings.Split(param, ",") {
+			address := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+			if len(address) != 2*common.AddressLength || !isHex(address) {
+				return nil, fmt.Errorf("%w: invalid address %q", ErrInvalidParam, s)
+			}
+			f.addresses[address] = true
+		}
+	}
+	for _, param := range c.QueryArray("prefix") {
+		for _, s := range strings.Split(param, ",") {
+			prefix := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+			if prefix == "" || len(prefix) > 2*common.HashLength || !isHex(prefix) {
+				return nil, fmt.Errorf("%w: invalid storage key prefix %q", ErrInvalidParam, s)
+			}
+			f.prefixes = append(f.prefixes, prefix)
+		}
+	}
+	if len(f.addresses) == 0 && len(f.prefixes) == 0 && !f.writesOnly {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+func (f *retraceFilter) account(address string) bool {
+	return len(f.addresses) == 0 || f.addresses[address]
+}
+
+func (f *retraceFilter) key(key string) bool {
+	if len(f.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the filtered copy of the retrace, which may be cached and is left as is.
+// Calls, gas and the verification are kept.
+func (f *retraceFilter) apply(r RetraceResponse) RetraceResponse {
+	if f == nil {
+		return r
+	}
+	out := r
+	out.Account = f.accounts(r.Account)
+	out.Storage = f.storage(r.Storage)
+	out.Contracts = f.contracts(r.Contracts)
+	if r.Txs != nil {
+		out.Txs = make([]TxRetrace, len(r.Txs))
+		for i, tx := range r.Txs {
+			out.Txs[i] = tx
+			out.Txs[i].Account = f.accounts(tx.Account)
+			out.Txs[i].Storage = f.storage(tx.Storage)
+			out.Txs[i].Contracts = f.contracts(tx.Contracts)
+		}
+	}
+	return out
+}
+
+// applyRange filters the aggregated sets of a range retrace in place, they are not cached.
+func (f *retraceFilter) applyRange(r *RetraceRangeResponse) {
+	if f == nil {
+		return
+	}
+	if f.writesOnly {
+		r.Account.Reads = make(map[string]KeySpan)
+		r.Storage.Reads = make(map[string]map[string]KeySpan)
+	}
+	for _, accounts := range []map[string]KeySpan{r.Account.Reads, r.Account.Writes} {
+		for address := range accounts {
+			if !f.account(address) {
+				delete(accounts, address)
+			}
+		}
+	}
+	for _, storage := range []map[string]map[string]KeySpan{r.Storage.Reads, r.Storage.Writes} {
+		for address, keys := range storage {
+			if !f.account(address) {
+				delete(storage, address)
+				continue
+			}
+			for key := range keys {
+				if !f.key(key) {
+					delete(keys, key)
+				}
+			}
+			if len(keys) == 0 {
+				delete(storage, address)
+			}
+		}
+	}
+}
+
+func (f *retraceFilter) accounts(a AccountWritesReads) AccountWritesReads {
+	out := AccountWritesReads{Reads: []string{}, Writes: []string{}}
+	if !f.writesOnly {
+		for _, address := range a.Reads {
+			if f.account(address) {
+				out.Reads = append(out.Reads, address)
+			}
+		}
+	}
+	for _, address := range a.Writes {
+		if f.account(address) {
+			out.Writes = append(out.Writes, address)
+		}
+	}
+	if a.Values != nil {
+		out.Values = make(map[string]WriteValues)
+		for _, address := range out.Writes {
+			if v, ok := a.Values[address]; ok {
+				out.Values[address] = v
+			}
+		}
+	}
+	return out
+}
+
+func (f *retraceFilter) storage(s StorageWriteReads) StorageWriteReads {
+	var out StorageWriteReads
+	if s.Reads != nil {
+		out.Reads = make(map[string][]string)
+		if !f.writesOnly {
+			out.Reads = f.storageKeys(s.Reads)
+		}
+	}
+	if s.Writes != nil {
+		out.Writes = f.storageKeys(s.Writes)
+	}
+	if s.Values != nil {
+		out.Values = make(map[string]map[string]WriteValues)
+		for address, keys := range out.Writes {
+			out.Values[address] = make(map[string]WriteValues)
+			for _, key := range keys {
+				if v, ok := s.Values[address][key]; ok {
+					out.Values[address][key] = v
+				}
+			}
+		}
+	}
+	return out
+}
+
+func (f *retraceFilter) storageKeys(byAddress map[string][]string) map[string][]string {
+	out := make(map[string][]string)
+	for address, keys := range byAddress {
+		if !f.account(address) {
+			continue
+		}
+		var kept []string
+		for _, key := range keys {
+			if f.key(key) {
+				kept = append(kept, key)
+			}
+		}
+		if len(kept) > 0 {
+			out[address] = kept
+		}
+	}
+	return out
+}
+
+func (f *retraceFilter) contracts(contracts map[common.Address]*ContractStorage) map[common.Address]*ContractStorage {
+	if contracts == nil {
+		return nil
+	}
+	out := make(map[common.Address]*ContractStorage)
+	for address, c := range contracts {
+		if !f.account(common.Bytes2Hex(address[:])) {
+			continue
+		}
+		kept := &ContractStorage{Incarnation: c.Incarnation, Reads: []common.Hash{}, Writes: []common.Hash{}}
+		if !f.writesOnly {
+			for _, key := range c.Reads {
+				if f.key(common.Bytes2Hex(key[:])) {
+					kept.Reads = append(kept.Reads, key)
+				}
+			}
+		}
+		for _, key := range c.Writes {
+			if f.key(common.Bytes2Hex(key[:])) {
+				kept.Writes = append(kept.Writes, key)
+			}
+		}
+		if len(kept.Reads) == 0 && len(kept.Writes) == 0 {
+			continue
+		}
+		if c.Values != nil {
+			kept.Values = make(map[common.Hash]WriteValues)
+			for _, key := range kept.Writes {
+				kept.Values[key] = c.Values[key]
+			}
+		}
+		out[address] = kept
+	}
+	return out
+}
@@ -0,0 +1,221 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// maxRetracePageLimit is the most entries a ?limit= may ask for.
+const maxRetracePageLimit = 1000000
+
+// RetracePage tells which part of the reads and writes of a retrace a response holds.
+// The entries are taken in a fixed order: the account reads, the account writes, then the
+// storage reads and writes by address, or by contract with ?storage=nested. Values come
+// with the writes of the page, calls, gas and the sets of the transactions only with the
+// first page.
+type RetracePage struct {
+	Entries    int    `json:"entries"`              // in the whole retrace
+	NextCursor string `json:"nextCursor,omitempty"` // for ?cursor= to get the next page, none on the last
+	Truncated  bool   `json:"truncated,omitempty"`  // the page was cut to fit the response size limit
+}
+
+// retracePageParams reads ?cursor= and ?limit=, a zero limit is no pagination.
+func retracePageParams(c *gin.Context) (offset, limit int, err error) {
+	if s := c.Query("cursor"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%w: invalid cursor %q", ErrInvalidParam, s)
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxRetracePageLimit {
+			return 0, 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidParam, maxRetracePageLimit)
+		}
+	} else if offset > 0 {
+		limit = maxRetracePageLimit
+	}
+	return offset, limit, nil
+}
+
+// pageRetrace returns the page at the offset of at most limit entries, if the retrace is
+// paginated, then cuts it further until its JSON encoding fits maxBytes, if positive.
+func pageRetrace(r RetraceResponse, offset, limit, maxBytes int) (RetraceResponse, error) {
+	page := r
+	if limit > 0 {
+		page = retraceWindow(r, offset, limit)
+	} else {
+		limit = retraceEntries(r)
+	}
+	if maxBytes <= 0 {
+		return page, nil
+	}
+	for {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(page); err != nil {
+			return RetraceResponse{}, err
+		}
+		if buf.Len() <= maxBytes || limit <= 1 {
+			return page, nil
+		}
+		// the entries are of similar sizes, aim below the limit to need few attempts
+		scaled := int(float64(limit) * float64(maxBytes) / float64(buf.Len()) * 0.9)
+		if scaled >= limit {
+			scaled = limit - 1
+		}
+		if limit = scaled; limit < 1 {
+			limit = 1
+		}
+		page = retraceWindow(r, offset, limit)
+		page.Page.Truncated = true
+	}
+}
+
+func retraceEntries(r RetraceResponse) int {
+	n := len(r.Account.Reads) + len(r.Account.Writes)
+	for _, keys := range r.Storage.Reads {
+		n += len(keys)
+	}
+	for _, keys := range r.Storage.Writes {
+		n += len(keys)
+	}
+	for _, c := range r.Contracts {
+		n += len(c.Reads) + len(c.Writes)
+	}
+	return n
+}
+
+// retraceWindow copies the entries offset..offset+limit of the retrace.
+func retraceWindow(r RetraceResponse, offset, limit int) RetraceResponse {
+	w := &window{from: offset, to: offset + limit}
+	page := RetraceResponse{BlockFinality: r.BlockFinality, Verify: r.Verify, Page: &RetracePage{Entries: retraceEntries(r)}}
+	if offset == 0 {
+		page.Calls, page.Gas, page.Txs = r.Calls, r.Gas, r.Txs
+	}
+
+	page.Account.Reads = sortedStrings(r.Account.Reads, w.take(len(r.Account.Reads)))
+	page.Account.Writes = sortedStrings(r.Account.Writes, w.take(len(r.Account.Writes)))
+	if r.Account.Values != nil {
+		page.Account.Values = make(map[string]WriteValues)
+		for _, address := range page.Account.Writes {
+			page.Account.Values[address] = r.Account.Values[address]
+		}
+	}
+
+	if r.Storage.Reads != nil || r.Storage.Writes != nil {
+		page.Storage.Reads = windowByAddress(w, r.Storage.Reads)
+		page.Storage.Writes = windowByAddress(w, r.Storage.Writes)
+	}
+	if r.Storage.Values != nil {
+		page.Storage.Values = make(map[string]map[string]WriteValues)
+		for address, keys := range page.Storage.Writes {
+			page.Storage.Values[address] = make(map[string]WriteValues)
+			for _, key := range keys {
+				page.Storage.Values[address][key] = r.Storage.Values[address][key]
+			}
+		}
+	}
+
+	if r.Contracts != nil {
+		page.Contracts = make(map[common.Address]*ContractStorage)
+		addresses := make([]common.Address, 0, len(r.Contracts))
+		for address := range r.Contracts {
+			addresses = append(addresses, address)
+		}
+		sort.Slice(addresses, func(i, j int) bool { return bytes.Compare(addresses[i][:], addresses[j][:]) < 0 })
+		for _, address := range addresses {
+			c := r.Contracts[address]
+			reads, writes := w.take(len(c.Reads)), w.take(len(c.Writes))
+			if reads.empty() && writes.empty() {
+				continue
+			}
+			pc := &ContractStorage{Incarnation: c.Incarnation, Reads: sortedHashes(c.Reads, reads), Writes: sortedHashes(c.Writes, writes)}
+			if c.Values != nil {
+				pc.Values = make(map[common.Hash]WriteValues)
+				for _, key := range pc.Writes {
+					pc.Values[key] = c.Values[key]
+				}
+			}
+			page.Contracts[address] = pc
+		}
+	}
+
+	if w.pos > w.to {
+		page.Page.NextCursor = strconv.Itoa(w.to)
+	}
+	return page
+}
+
+func windowByAddress(w *window, byAddress map[string][]string) map[string][]string {
+	page := make(map[string][]string)
+	for _, address := range sortedAddresses(byAddress) {
+		keys := byAddress[address]
+		if s := w.take(len(keys)); !s.empty() {
+			page[address] = sortedStrings(keys, s)
+		}
+	}
+	return page
+}
+
+// window walks the entries of the lists of a retrace in order and tells which of them are
+// within from..to.
+type window struct {
+	pos, from, to int
+}
+
+type span struct{ lo, hi int }
+
+func (s span) empty() bool { return s.lo == s.hi }
+
+// take returns the span of the next list of n entries within the window.
+func (w *window) take(n int) span {
+	lo, hi := w.from-w.pos, w.to-w.pos
+	w.pos += n
+	clamp := func(i int) int {
+		if i < 0 {
+			return 0
+		}
+		if i > n {
+			return n
+		}
+		return i
+	}
+	lo, hi = clamp(lo), clamp(hi)
+	if lo > hi {
+		lo = hi
+	}
+	return span{lo, hi}
+}
+
+// sortedStrings returns the span of the sorted strings, s itself is left as is as it may
+// be cached.
+func sortedStrings(s []string, sp span) []string {
+	if sp.empty() {
+		return []string{}
+	}
+	sorted := append([]string{}, s...)
+	sort.Strings(sorted)
+	return sorted[sp.lo:sp.hi]
+}
+
+func sortedHashes(s []common.Hash, sp span) []common.Hash {
+	if sp.empty() {
+		return []common.Hash{}
+	}
+	sorted := append([]common.Hash{}, s...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+	return sorted[sp.lo:sp.hi]
+}
+
+func sortedAddresses(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
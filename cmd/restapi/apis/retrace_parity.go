@@ -0,0 +1,231 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// ParityTrace is an element of the result of OpenEthereum's trace_replayBlockTransactions
+// with the stateDiff trace type. Output, Trace and VMTrace are not computed.
+type ParityTrace struct {
+	Output          *hexutil.Bytes                        `json:"output"`
+	StateDiff       map[common.Address]*ParityAccountDiff `json:"stateDiff"`
+	Trace           []interface{}                         `json:"trace"`
+	VMTrace         interface{}                           `json:"vmTrace"`
+	TransactionHash common.Hash                           `json:"transactionHash"`
+}
+
+// ParityAccountDiff holds for every field "=" if it is unchanged, {"+": value} if the
+// account is created, {"-": value} if it is deleted, or {"*": {"from": a, "to": b}}.
+type ParityAccountDiff struct {
+	Balance interface{}                 `json:"balance"`
+	Nonce   interface{}                 `json:"nonce"`
+	Code    interface{}                 `json:"code"`
+	Storage map[common.Hash]interface{} `json:"storage"`
+}
+
+func parityChange(from, to string, born, died bool) interface{} {
+	switch {
+	case born:
+		return map[string]string{"+": to}
+	case died:
+		return map[string]string{"-": from}
+	case from == to:
+		return "="
+	default:
+		return map[string]interface{}{"*": map[string]string{"from": from, "to": to}}
+	}
+}
+
+// ParityStateDiffs replays the block and returns the state diff of every transaction.
+// Storage of deleted contracts is not listed, it cannot be enumerated from the writes.
+func ParityStateDiffs(ctx context.Context, blockNumber, chain string, kv ethdb.KV, db ethdb.Getter) ([]ParityTrace, error) {
+	chainConfig, err := ReadChainConfig(kv, chain)
+	if err != nil {
+		return nil, err
+	}
+	bn, err := strconv.ParseUint(blockNumber, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	block := rawdb.ReadBlockByNumber(db, bn)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %d", ErrBlockNotFound, bn)
+	}
+	header := block.Header()
+	reader := NewRemoteReader(ctx, kv, bn)
+	ibs := state.New(reader)
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	usedGas := new(uint64)
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	writer := newParityWriter(reader)
+	traces := make([]ParityTrace, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		_, err = core.ApplyTransaction(chainConfig, NewRemoteContext(kv, db, chainConfig), nil, gp, ibs, writer, header, tx, usedGas, vm.Config{Cancel: ctx.Done()})
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // a cancelled transaction stops short without an error
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+		}
+		diff, err := writer.finishTx()
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, ParityTrace{StateDiff: diff, Trace: []interface{}{}, TransactionHash: tx.Hash()})
+	}
+	return traces, nil
+}
+
+// parityTouch is what a transaction did to an account.
+type parityTouch struct {
+	before, after *accounts.Account // nil if missing
+	code          []byte            // set if written
+	storage       map[common.Hash][2]uint256.Int
+}
+
+// parityWriter collects the changes of a transaction, keeping the values written by the
+// preceding ones: the originals passed by the IntraBlockState are those of the block.
+type parityWriter struct {
+	reader   state.StateReader
+	accounts map[common.Address]*accounts.Account // nil for deleted accounts
+	storage  map[common.Address]map[common.Hash]uint256.Int
+	code     map[common.Address][]byte
+	touched  map[common.Address]*parityTouch
+}
+
+func newParityWriter(reader state.StateReader) *parityWriter {
+	return &parityWriter{
+		reader:   reader,
+		accounts: make(map[common.Address]*accounts.Account),
+		storage:  make(map[common.Address]map[common.Hash]uint256.Int),
+		code:     make(map[common.Address][]byte),
+		touched:  make(map[common.Address]*parityTouch),
+	}
+}
+
+func (w *parityWriter) touch(address common.Address, original *accounts.Account) *parityTouch {
+	t, ok := w.touched[address]
+	if ok {
+		return t
+	}
+	t = &parityTouch{storage: make(map[common.Hash][2]uint256.Int)}
+	if a, known := w.accounts[address]; known {
+		t.before = a
+	} else if original != nil && original.Initialised {
+		t.before = original.SelfCopy()
+	}
+	t.after = t.before
+	w.touched[address] = t
+	return t
+}
+
+func (w *parityWriter) UpdateAccountData(_ context.Context, address common.Address, original, account *accounts.Account) error {
+	w.touch(address, original).after = account.SelfCopy()
+	return nil
+}
+
+func (w *parityWriter) UpdateAccountCode(address common.Address, _ uint64, _ common.Hash, code []byte) error {
+	w.touch(address, nil).code = common.CopyBytes(code)
+	return nil
+}
+
+func (w *parityWriter) DeleteAccount(_ context.Context, address common.Address, original *accounts.Account) error {
+	w.touch(address, original).after = nil
+	return nil
+}
+
+func (w *parityWriter) WriteAccountStorage(_ context.Context, address common.Address, _ uint64, key *common.Hash, original, value *uint256.Int) error {
+	from := *original
+	if v, ok := w.storage[address][*key]; ok {
+		from = v
+	}
+	if from == *value {
+		return nil
+	}
+	if w.storage[address] == nil {
+		w.storage[address] = make(map[common.Hash]uint256.Int)
+	}
+	w.storage[address][*key] = *value
+	t := w.touch(address, nil)
+	if change, ok := t.storage[*key]; ok {
+		from = change[0]
+	}
+	t.storage[*key] = [2]uint256.Int{from, *value}
+	return nil
+}
+
+func (w *parityWriter) CreateContract(common.Address) error {
+	return nil
+}
+
+// codeOf returns the code of the account as of the start of the transaction.
+func (w *parityWriter) codeOf(address common.Address, account *accounts.Account) ([]byte, error) {
+	if code, ok := w.code[address]; ok {
+		return code, nil
+	}
+	if account == nil || account.IsEmptyCodeHash() {
+		return nil, nil
+	}
+	return w.reader.ReadAccountCode(address, account.CodeHash)
+}
+
+// finishTx returns the diff of the transaction and starts the next one.
+func (w *parityWriter) finishTx() (map[common.Address]*ParityAccountDiff, error) {
+	diffs := make(map[common.Address]*ParityAccountDiff)
+	for address, t := range w.touched {
+		if t.before == nil && t.after == nil {
+			continue
+		}
+		born, died := t.before == nil, t.after == nil
+		code, err := w.codeOf(address, t.before)
+		if err != nil {
+			return nil, err
+		}
+		newCode := code
+		if t.code != nil {
+			newCode = t.code
+		}
+		if died {
+			newCode = nil
+		}
+		var balance, nonce [2]string
+		if t.before != nil {
+			balance[0], nonce[0] = t.before.Balance.Hex(), hexutil.EncodeUint64(t.before.Nonce)
+		}
+		if t.after != nil {
+			balance[1], nonce[1] = t.after.Balance.Hex(), hexutil.EncodeUint64(t.after.Nonce)
+		}
+		diff := &ParityAccountDiff{
+			Balance: parityChange(balance[0], balance[1], born, died),
+			Nonce:   parityChange(nonce[0], nonce[1], born, died),
+			Code:    parityChange(hexutil.Encode(code), hexutil.Encode(newCode), born, died),
+			Storage: make(map[common.Hash]interface{}),
+		}
+		for key, change := range t.storage {
+			from, to := common.Hash(change[0].Bytes32()), common.Hash(change[1].Bytes32())
+			diff.Storage[key] = parityChange(from.Hex(), to.Hex(), born, died)
+		}
+		if diff.Balance == "=" && diff.Nonce == "=" && diff.Code == "=" && len(diff.Storage) == 0 {
+			continue
+		}
+		diffs[address] = diff
+		w.accounts[address], w.code[address] = t.after, newCode
+	}
+	w.touched = make(map[common.Address]*parityTouch)
+	return diffs, nil
+}
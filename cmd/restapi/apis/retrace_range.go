@@ -0,0 +1,226 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+const (
+	// maxRetraceRange is the most blocks a single range retrace replays.
+	maxRetraceRange = 10000
+	// retraceHeartbeat is how often a streamed retrace reports that it is still working.
+	retraceHeartbeat = 5 * time.Second
+)
+
+// KeySpan is the first and the last block of a range touching a key.
+type KeySpan struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+}
+
+type RangeAccountWritesReads struct {
+	Reads  map[string]KeySpan `json:"reads"`
+	Writes map[string]KeySpan `json:"writes"`
+}
+
+type RangeStorageWritesReads struct {
+	Reads  map[string]map[string]KeySpan `json:"reads"`
+	Writes map[string]map[string]KeySpan `json:"writes"`
+}
+
+// RetraceRangeResponse aggregates the retraces of the blocks From..To, BlockFinality is
+// that of To.
+type RetraceRangeResponse struct {
+	From    uint64                  `json:"from"`
+	To      uint64                  `json:"to"`
+	Storage RangeStorageWritesReads `json:"storage"`
+	Account RangeAccountWritesReads `json:"accounts"`
+	BlockFinality
+}
+
+func (e *Env) GetRangeWritesReads(c *gin.Context) {
+	from, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid from block %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	to, err := strconv.ParseUint(c.Param("arg"), 10, 64)
+	if err != nil || to < from {
+		abortWithError(c, fmt.Errorf("%w: invalid to block %s", ErrInvalidParam, c.Param("arg")))
+		return
+	}
+	if to-from >= maxRetraceRange {
+		abortWithError(c, fmt.Errorf("%w: at most %d blocks can be retraced at once", ErrInvalidParam, maxRetraceRange))
+		return
+	}
+	filter, err := retraceFilterParams(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if _, err = e.replayableBlock(from); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	bf, err := e.replayableBlock(to)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if acceptsNDJSON(c) {
+		e.streamRange(c, from, to, filter)
+		return
+	}
+	results, err := RetraceRange(c.Request.Context(), from, to, c.Param("chain"), e.KV, e.DB)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	filter.applyRange(&results)
+	results.BlockFinality = bf
+	render(c, http.StatusOK, results)
+}
+
+// RetraceRange replays the blocks from..to and merges their read and write sets.
+func RetraceRange(ctx context.Context, from, to uint64, chain string, kv ethdb.KV, db ethdb.Getter) (RetraceRangeResponse, error) {
+	chainConfig, err := ReadChainConfig(kv, chain)
+	if err != nil {
+		return RetraceRangeResponse{}, err
+	}
+	output := RetraceRangeResponse{
+		From:    from,
+		To:      to,
+		Storage: RangeStorageWritesReads{Reads: make(map[string]map[string]KeySpan), Writes: make(map[string]map[string]KeySpan)},
+		Account: RangeAccountWritesReads{Reads: make(map[string]KeySpan), Writes: make(map[string]KeySpan)},
+	}
+	err = retraceRange(ctx, chainConfig, from, to, kv, db, RetraceOptions{}, func(bn uint64, r RetraceResponse) error {
+		touchKeys(output.Account.Reads, r.Account.Reads, bn)
+		touchKeys(output.Account.Writes, r.Account.Writes, bn)
+		touchStorage(output.Storage.Reads, r.Storage.Reads, bn)
+		touchStorage(output.Storage.Writes, r.Storage.Writes, bn)
+		return nil
+	})
+	return output, err
+}
+
+// retraceRange retraces the blocks from..to in order, passing each result to fn.
+func retraceRange(ctx context.Context, chainConfig *params.ChainConfig, from, to uint64, kv ethdb.KV, db ethdb.Getter, opts RetraceOptions, fn func(uint64, RetraceResponse) error) error {
+	for bn := from; bn <= to; bn++ {
+		r, err := retraceBlock(ctx, chainConfig, bn, kv, db, opts)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", bn, err)
+		}
+		if err = fn(bn, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func touchKeys(spans map[string]KeySpan, keys []string, bn uint64) {
+	for _, key := range keys {
+		span, ok := spans[key]
+		if !ok {
+			span.First = bn
+		}
+		span.Last = bn
+		spans[key] = span
+	}
+}
+
+func touchStorage(spans map[string]map[string]KeySpan, keys map[string][]string, bn uint64) {
+	for address, slots := range keys {
+		if spans[address] == nil {
+			spans[address] = make(map[string]KeySpan)
+		}
+		touchKeys(spans[address], slots, bn)
+	}
+}
+
+// RetraceRecord is a line of a streamed range retrace: the retrace of a block, a heartbeat
+// carrying the block being replayed, or the final record with Done or Error set.
+type RetraceRecord struct {
+	Block     uint64           `json:"block"`
+	Retrace   *RetraceResponse `json:"retrace,omitempty"`
+	Heartbeat int64            `json:"heartbeat,omitempty"` // unix time
+	Done      bool             `json:"done,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// streamRange writes the retrace of every block as soon as it completes, so the results
+// are not held in memory, with heartbeats while a block takes long. Errors after the
+// first record can only be reported in the stream.
+func (e *Env) streamRange(c *gin.Context, from, to uint64, filter *retraceFilter) {
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	opts, err := retraceOptions(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	records := make(chan RetraceRecord)
+	go func() {
+		defer close(records)
+		err := retraceRange(ctx, chainConfig, from, to, e.KV, e.DB, opts, func(bn uint64, r RetraceResponse) error {
+			bf, err := e.Finality.Of(e.DB, bn)
+			if err != nil {
+				return err
+			}
+			r = filter.apply(r)
+			r.Calls = nameCalls(r.Calls, e.Selectors)
+			r.BlockFinality = bf
+			select {
+			case records <- RetraceRecord{Block: bn, Retrace: &r}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		last := RetraceRecord{Block: to, Done: err == nil}
+		if err != nil {
+			last.Error = err.Error()
+		}
+		select {
+		case records <- last:
+		case <-ctx.Done():
+		}
+	}()
+
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", MIMENDJSON)
+	enc := json.NewEncoder(c.Writer)
+	heartbeat := time.NewTicker(retraceHeartbeat)
+	defer heartbeat.Stop()
+	next := from
+	for {
+		var record RetraceRecord
+		select {
+		case r, ok := <-records:
+			if !ok {
+				return
+			}
+			record, next = r, r.Block+1
+		case now := <-heartbeat.C:
+			record = RetraceRecord{Block: next, Heartbeat: now.Unix()}
+		case <-ctx.Done():
+			return
+		}
+		if err := enc.Encode(record); err != nil {
+			return // the client went away
+		}
+		c.Writer.Flush()
+	}
+}
@@ -1,16 +1,17 @@
 package apis
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/binary"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ledgerwatch/turbo-geth/common"
-	"github.com/ledgerwatch/turbo-geth/common/dbutils"
-	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
 	"github.com/ledgerwatch/turbo-geth/consensus/misc"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
@@ -18,61 +19,245 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/metrics"
 	"github.com/ledgerwatch/turbo-geth/params"
 )
 
+var (
+	replayBlockTimer    = metrics.NewRegisteredTimer("restapi/replay/block", nil)
+	replayTxTimer       = metrics.NewRegisteredTimer("restapi/replay/tx", nil)
+	replayedBlocksMeter = metrics.NewRegisteredMeter("restapi/replay/blocks", nil)
+	replayedTxsMeter    = metrics.NewRegisteredMeter("restapi/replay/txs", nil) // including those replayed to reach a transaction
+)
+
 func RegisterRetraceAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(e.limitReplays)
 	router.GET(":chain/:number", e.GetWritesReads)
+	router.POST(":chain", e.PostRetraceBatch)
+	// gin does not allow a static segment next to :number, so tx/:hash, :number/witness and
+	// :from/:to share a route
+	router.GET(":chain/:number/:arg", func(c *gin.Context) {
+		switch {
+		case c.Param("number") == "tx":
+			e.GetTxWritesReads(c)
+		case c.Param("arg") == "witness":
+			e.GetBlockWitness(c)
+		default:
+			e.GetRangeWritesReads(c)
+		}
+	})
 	return nil
 }
 
 func (e *Env) GetWritesReads(c *gin.Context) {
-	results, err := Retrace(c.Param("number"), c.Param("chain"), e.KV, e.DB)
+	bn, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	bf, err := e.replayableBlock(bn)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		abortWithError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, results)
+	offset, limit, err := retracePageParams(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	opts, err := retraceOptions(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	filter, err := retraceFilterParams(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	format := c.Query("format")
+	key := retraceCacheKey{Hash: rawdb.ReadCanonicalHash(e.DB, bn), Format: format}
+	var newResult func() interface{}
+	var compute func() (interface{}, error)
+	switch key.Format {
+	case "", "csv":
+		key.Format, key.Opts = "retrace", opts // csv is rendered from the cached retrace
+		newResult = func() interface{} { return new(RetraceResponse) }
+		compute = func() (interface{}, error) {
+			results, err := Retrace(c.Request.Context(), c.Param("number"), c.Param("chain"), e.KV, e.DB, key.Opts)
+			return &results, err
+		}
+	case "parity":
+		if filter != nil {
+			abortWithError(c, fmt.Errorf("%w: parity state diffs can not be filtered", ErrInvalidParam))
+			return
+		}
+		newResult = func() interface{} { return new([]ParityTrace) }
+		compute = func() (interface{}, error) {
+			traces, err := ParityStateDiffs(c.Request.Context(), c.Param("number"), c.Param("chain"), e.KV, e.DB)
+			return &traces, err
+		}
+	default:
+		abortWithError(c, fmt.Errorf("%w: unknown format %s", ErrInvalidParam, key.Format))
+		return
+	}
+	cache := e.RetraceCache
+	if key.Hash == (common.Hash{}) {
+		cache = nil // not canonical yet, let the retrace fail as before
+	}
+	result, hit, err := cache.fetch(bn, key, newResult, compute)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if hit {
+		c.Header(RetraceCacheHeader, "hit")
+	} else if cache != nil {
+		c.Header(RetraceCacheHeader, "miss")
+	}
+	switch result := result.(type) {
+	case *RetraceResponse:
+		filtered := filter.apply(*result)
+		filtered.Calls = nameCalls(filtered.Calls, e.Selectors)
+		if format == "csv" {
+			rows := retraceRows(bn, "", filtered)
+			for _, tx := range filtered.Txs {
+				rows = append(rows, retraceRows(bn, tx.Hash.Hex(), tx.retraceResponse())...)
+			}
+			renderCSV(c, "retrace-"+c.Param("number"), retraceCSVHeader, rows)
+			return
+		}
+		results, err := pageRetrace(filtered, offset, limit, e.MaxResponseBytes) // a copy, the cached one is shared
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+			return
+		}
+		results.BlockFinality = bf
+		render(c, http.StatusOK, results)
+	case *[]ParityTrace:
+		render(c, http.StatusOK, *result)
+	}
 }
 
 type AccountWritesReads struct {
-	Reads  []string `json:"reads"`
-	Writes []string `json:"writes"`
+	Reads  []string               `json:"reads"`
+	Writes []string               `json:"writes"`
+	Values map[string]WriteValues `json:"values,omitempty"` // by address, for ?values=true
 }
 type StorageWriteReads struct {
 	Reads  map[string][]string
 	Writes map[string][]string
+	Values map[string]map[string]WriteValues `json:",omitempty"` // by address and key, for ?values=true
 }
 type RetraceResponse struct {
-	Storage StorageWriteReads  `json:"storage"`
-	Account AccountWritesReads `json:"accounts"`
+	Storage   StorageWriteReads                   `json:"storage"`
+	Account   AccountWritesReads                  `json:"accounts"`
+	Contracts map[common.Address]*ContractStorage `json:"contracts,omitempty"` // for ?storage=nested
+	Calls     []TxCalls                           `json:"calls,omitempty"`     // for ?calls=true
+	Gas       []GasBreakdown                      `json:"gas,omitempty"`       // for ?tracer=gas
+	Page      *RetracePage                        `json:"page,omitempty"`      // for ?limit= or a response cut to the size limit
+	Verify    *BlockVerification                  `json:"verify,omitempty"`    // for ?verify=true
+	Txs       []TxRetrace                         `json:"txs,omitempty"`       // for ?txs=true, instead of the sets of the block
+	BlockFinality
+}
+
+// ContractStorage are the storage accesses of a contract. Incarnation is that of the
+// writes, reads are recorded without it.
+type ContractStorage struct {
+	Incarnation uint64                      `json:"incarnation,omitempty"`
+	Reads       []common.Hash               `json:"reads"`
+	Writes      []common.Hash               `json:"writes"`
+	Values      map[common.Hash]WriteValues `json:"values,omitempty"` // for ?values=true
 }
 
-func Retrace(blockNumber, chain string, kv ethdb.KV, db ethdb.Getter) (RetraceResponse, error) {
+// RetraceOptions select the optional parts of a retrace.
+type RetraceOptions struct {
+	Values bool // original and new values of the writes
+	Nested bool // storage accesses under their contract instead of the flat hex keys
+	Calls  bool // call tree of every transaction
+	Verify bool // check the replayed receipts against the header and the stored ones, blocks only
+	Txs    bool // the sets of every transaction of a block instead of those of the block
+
+	// EVM options of block retraces, see vmOptions
+	Gas        bool   // gas by category of every transaction
+	Fork       string // rules to replay under
+	EIPs       string // comma separated, sorted
+	NoGasLimit bool
+}
+
+func retraceOptions(c *gin.Context) (RetraceOptions, error) {
+	opts := RetraceOptions{
+		Values: c.Query("values") == "true",
+		Nested: c.Query("storage") == "nested",
+		Calls:  c.Query("calls") == "true",
+		Verify: c.Query("verify") == "true",
+		Txs:    c.Query("txs") == "true",
+	}
+	return opts, vmOptions(c, &opts)
+}
+
+func Retrace(ctx context.Context, blockNumber, chain string, kv ethdb.KV, db ethdb.Getter, opts RetraceOptions) (RetraceResponse, error) {
 	chainConfig, err := ReadChainConfig(kv, chain)
 	if err != nil {
 		return RetraceResponse{}, err
 	}
-	noOpWriter := state.NewNoopWriter()
-	bn, err := strconv.Atoi(blockNumber)
+	bn, err := strconv.ParseUint(blockNumber, 10, 64)
 	if err != nil {
 		return RetraceResponse{}, err
 	}
-	block := rawdb.ReadBlockByNumber(db, uint64(bn))
-	chainCtx := NewRemoteContext(kv, db)
-	writer := state.NewChangeSetWriterPlain(uint64(bn - 1))
-	reader := NewRemoteReader(kv, uint64(bn))
-	intraBlockState := state.New(reader)
+	return retraceBlock(ctx, chainConfig, bn, kv, db, opts)
+}
 
-	if err = runBlock(intraBlockState, noOpWriter, writer, chainConfig, chainCtx, block); err != nil {
+func retraceBlock(ctx context.Context, chainConfig *params.ChainConfig, bn uint64, kv ethdb.KV, db ethdb.Getter, opts RetraceOptions) (RetraceResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return RetraceResponse{}, err
+	}
+	noOpWriter := state.NewNoopWriter()
+	block := rawdb.ReadBlockByNumber(db, bn)
+	if block == nil {
+		return RetraceResponse{}, fmt.Errorf("%w: %d", ErrBlockNotFound, bn)
+	}
+	chainConfig, vmConfig := opts.vmConfig(chainConfig, bn)
+	chainCtx := NewRemoteContext(kv, db, chainConfig)
+	writer := state.NewChangeSetWriterPlainWithValues(bn - 1)
+	reader := NewRemoteReader(ctx, kv, bn)
+	if err := reader.PrefetchSenders(chainConfig, block); err != nil {
 		return RetraceResponse{}, err
 	}
+	intraBlockState := state.New(reader)
 
+	trace := newBlockTrace(opts)
 	var output RetraceResponse
-	accountChanges, _ := writer.GetAccountChanges()
+	var receipts types.Receipts
+	var err error
+	if opts.Txs {
+		newReader := func() *RemoteReader {
+			r := NewRemoteReader(ctx, kv, bn)
+			r.prefetched = reader.prefetched
+			return r
+		}
+		output.Txs, receipts, err = runBlockTxs(ctx, newBlockOverlay(reader), newReader, chainConfig, chainCtx, block, vmConfig, trace, opts)
+	} else {
+		receipts, err = runBlock(ctx, intraBlockState, noOpWriter, writer, chainConfig, chainCtx, block, vmConfig, trace)
+		output = retraceOutput(writer, reader, opts)
+	}
 	if err != nil {
 		return RetraceResponse{}, err
 	}
+
+	if trace != nil {
+		output.Calls, output.Gas = trace.Calls, trace.Gas
+	}
+	if opts.Verify {
+		output.Verify = verifyBlock(block, receipts, db, chainConfig)
+	}
+	return output, nil
+}
+
+// retraceOutput lists the changes collected by the writer and the reads recorded by the reader.
+func retraceOutput(writer *state.ChangeSetWriter, reader *RemoteReader, opts RetraceOptions) RetraceResponse {
+	var output RetraceResponse
+	accountChanges, _ := writer.GetAccountChanges()
 	for _, ch := range accountChanges.Changes {
 		output.Account.Writes = append(output.Account.Writes, common.Bytes2Hex(ch.Key))
 	}
@@ -80,6 +265,18 @@ func Retrace(blockNumber, chain string, kv ethdb.KV, db ethdb.Getter) (RetraceRe
 		output.Account.Reads = append(output.Account.Reads, common.Bytes2Hex(ch))
 	}
 
+	if opts.Nested {
+		output.Contracts = nestedStorage(writer, reader)
+	} else {
+		flatStorage(&output, writer, reader)
+	}
+	if opts.Values {
+		addValues(writer, &output)
+	}
+	return output
+}
+
+func flatStorage(output *RetraceResponse, writer *state.ChangeSetWriter, reader *RemoteReader) {
 	storageChanges, _ := writer.GetStorageChanges()
 	output.Storage.Writes = make(map[string][]string)
 	for _, ch := range storageChanges.Changes {
@@ -92,70 +289,77 @@ func Retrace(blockNumber, chain string, kv ethdb.KV, db ethdb.Getter) (RetraceRe
 	for _, key := range reader.GetStorageReads() {
 		addrKey := common.Bytes2Hex(key[:common.AddressLength])
 		l := output.Storage.Reads[addrKey]
-		l = append(l, common.Bytes2Hex(key[common.AddressLength+common.IncarnationLength:]))
+		l = append(l, common.Bytes2Hex(key[common.AddressLength:]))
 		output.Storage.Reads[addrKey] = l
 	}
-	return output, nil
 }
 
-func runBlock(ibs *state.IntraBlockState, txnWriter state.StateWriter, blockWriter state.StateWriter,
-	chainConfig *params.ChainConfig, bcb core.ChainContext, block *types.Block,
-) error {
+func nestedStorage(writer *state.ChangeSetWriter, reader *RemoteReader) map[common.Address]*ContractStorage {
+	contracts := make(map[common.Address]*ContractStorage)
+	contract := func(address common.Address) *ContractStorage {
+		c, ok := contracts[address]
+		if !ok {
+			c = &ContractStorage{Reads: []common.Hash{}, Writes: []common.Hash{}}
+			contracts[address] = c
+		}
+		return c
+	}
+	storageChanges, _ := writer.GetStorageChanges()
+	for _, ch := range storageChanges.Changes {
+		c := contract(common.BytesToAddress(ch.Key[:common.AddressLength]))
+		c.Incarnation = binary.BigEndian.Uint64(ch.Key[common.AddressLength:])
+		c.Writes = append(c.Writes, common.BytesToHash(ch.Key[common.AddressLength+common.IncarnationLength:]))
+	}
+	for _, key := range reader.GetStorageReads() {
+		c := contract(common.BytesToAddress(key[:common.AddressLength]))
+		c.Reads = append(c.Reads, common.BytesToHash(key[common.AddressLength:]))
+	}
+	for _, c := range contracts {
+		sort.Slice(c.Reads, func(i, j int) bool { return bytes.Compare(c.Reads[i][:], c.Reads[j][:]) < 0 })
+		sort.Slice(c.Writes, func(i, j int) bool { return bytes.Compare(c.Writes[i][:], c.Writes[j][:]) < 0 })
+	}
+	return contracts
+}
+
+// runBlock executes the block with the vm config, recording every transaction in the trace
+// unless it is nil. It stops with the error of the context once that is done.
+func runBlock(ctx context.Context, ibs *state.IntraBlockState, txnWriter state.StateWriter, blockWriter state.StateWriter,
+	chainConfig *params.ChainConfig, bcb core.ChainContext, block *types.Block, vmConfig vm.Config, trace *blockTrace,
+) (types.Receipts, error) {
+	defer replayBlockTimer.UpdateSince(time.Now())
+	replayedBlocksMeter.Mark(1)
+	replayedTxsMeter.Mark(int64(len(block.Transactions())))
 	header := block.Header()
-	vmConfig := vm.Config{}
-	engine := ethash.NewFullFaker()
+	vmConfig.Cancel = ctx.Done()
+	if trace != nil {
+		vmConfig.Debug, vmConfig.Tracer = true, trace.tracer()
+	}
 	gp := new(core.GasPool).AddGas(block.GasLimit())
 	usedGas := new(uint64)
 	var receipts types.Receipts
 	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(ibs)
 	}
-	for _, tx := range block.Transactions() {
+	for i, tx := range block.Transactions() {
 		receipt, err := core.ApplyTransaction(chainConfig, bcb, nil, gp, ibs, txnWriter, header, tx, usedGas, vmConfig)
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // a cancelled transaction stops short without an error
+		}
 		if err != nil {
-			return fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+			return nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
 		}
 		receipts = append(receipts, receipt)
+		if trace != nil {
+			trace.take(tx, receipt, block.NumberU64(), uint64(i))
+		}
 	}
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
-	if _, err := engine.FinalizeAndAssemble(chainConfig, header, ibs, block.Transactions(), block.Uncles(), receipts); err != nil {
-		return fmt.Errorf("finalize of block %d failed: %v", block.NumberU64(), err)
-	}
-
-	ctx := chainConfig.WithEIPsFlags(context.Background(), header.Number)
-	if err := ibs.CommitBlock(ctx, blockWriter); err != nil {
-		return fmt.Errorf("committing block %d failed: %v", block.NumberU64(), err)
+	if _, err := bcb.Engine().FinalizeAndAssemble(chainConfig, header, ibs, block.Transactions(), block.Uncles(), receipts); err != nil {
+		return nil, fmt.Errorf("finalize of block %d failed: %v", block.NumberU64(), err)
 	}
-	return nil
-}
 
-// ReadChainConfig retrieves the consensus settings based on the given genesis hash.
-func ReadChainConfig(db ethdb.KV, chain string) (*params.ChainConfig, error) {
-	var k []byte
-	var data []byte
-	switch chain {
-	case "mainnet":
-		k = params.MainnetGenesisHash[:]
-	case "testnet":
-		k = params.RopstenGenesisHash[:]
-	case "rinkeby":
-		k = params.RinkebyGenesisHash[:]
-	case "goerli":
-		k = params.GoerliGenesisHash[:]
-	}
-	if err := db.View(context.Background(), func(tx ethdb.Tx) error {
-		d, err := tx.Get(dbutils.ConfigPrefix, k)
-		if err != nil {
-			return err
-		}
-		data = common.CopyBytes(d)
-		return nil
-	}); err != nil {
-		return nil, err
-	}
-	var config params.ChainConfig
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, err
+	if err := ibs.CommitBlock(chainConfig.WithEIPsFlags(ctx, header.Number), blockWriter); err != nil {
+		return nil, fmt.Errorf("committing block %d failed: %v", block.NumberU64(), err)
 	}
-	return &config, nil
+	return receipts, nil
 }
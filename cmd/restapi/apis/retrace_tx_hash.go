@@ -0,0 +1,241 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+type RetraceTxResponse struct {
+	Hash        common.Hash `json:"hash"`
+	BlockNumber uint64      `json:"blockNumber"`
+	TxIndex     uint64      `json:"txIndex"`
+	RetraceResponse
+}
+
+func (e *Env) GetTxWritesReads(c *gin.Context) {
+	hash := common.HexToHash(c.Param("arg"))
+	bn, index, bf, ok := e.lookupTx(c, hash)
+	if !ok {
+		return
+	}
+	offset, limit, err := retracePageParams(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	opts, err := retraceOptions(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	filter, err := retraceFilterParams(c)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	results, err := RetraceTx(c.Request.Context(), hash, bn, index, c.Param("chain"), e.KV, e.DB, opts)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	results.RetraceResponse = filter.apply(results.RetraceResponse)
+	results.Calls = nameCalls(results.Calls, e.Selectors)
+	if c.Query("format") == "csv" {
+		renderCSV(c, "retrace-"+hash.Hex(), retraceCSVHeader, retraceRows(bn, hash.Hex(), results.RetraceResponse))
+		return
+	}
+	if results.RetraceResponse, err = pageRetrace(results.RetraceResponse, offset, limit, e.MaxResponseBytes); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	results.BlockFinality = bf
+	render(c, http.StatusOK, results)
+}
+
+// RetraceTx replays the transactions of the block preceding the one at the index, keeping
+// their effects in memory, and returns the reads and writes of that transaction alone.
+func RetraceTx(ctx context.Context, hash common.Hash, blockNumber, index uint64, chain string, kv ethdb.KV, db ethdb.Getter, opts RetraceOptions) (RetraceTxResponse, error) {
+	writer := state.NewChangeSetWriterPlainWithValues(blockNumber - 1)
+	tracer := &callTracer{}
+	vmConfig := vm.Config{}
+	if opts.Calls {
+		vmConfig.Debug, vmConfig.Tracer = true, tracer
+	}
+	overlay, _, err := replayTx(ctx, hash, blockNumber, index, chain, kv, db, writer, vmConfig)
+	if err != nil {
+		return RetraceTxResponse{}, err
+	}
+	output := retraceOutput(writer, overlay.RemoteReader, opts)
+	if opts.Calls {
+		output.Calls = []TxCalls{{Hash: hash, Call: tracer.take()}}
+	}
+	return RetraceTxResponse{Hash: hash, BlockNumber: blockNumber, TxIndex: index, RetraceResponse: output}, nil
+}
+
+// replayTx applies the transactions of the block preceding the one at the index to an
+// overlay of the state after the parent block, then applies that transaction with the
+// writer and the vm config on a fresh state over the overlay, so that everything the
+// transaction touches goes through the overlay's remote reader. It stops with the error of
+// the context once that is done.
+func replayTx(ctx context.Context, hash common.Hash, blockNumber, index uint64, chain string, kv ethdb.KV, db ethdb.Getter, writer state.StateWriter, vmConfig vm.Config) (*blockOverlay, *types.Receipt, error) {
+	chainConfig, err := ReadChainConfig(kv, chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	block := rawdb.ReadBlockByNumber(db, blockNumber)
+	if block == nil || index >= uint64(len(block.Transactions())) {
+		return nil, nil, fmt.Errorf("%w: %d with transaction %x", ErrBlockNotFound, blockNumber, hash)
+	}
+	defer replayTxTimer.UpdateSince(time.Now())
+	replayedTxsMeter.Mark(int64(index + 1))
+	header := block.Header()
+	chainCtx := NewRemoteContext(kv, db, chainConfig)
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	usedGas := new(uint64)
+
+	reader := NewRemoteReader(ctx, kv, blockNumber-1)
+	if err = reader.PrefetchSenders(chainConfig, block); err != nil {
+		return nil, nil, err
+	}
+	overlay := newBlockOverlay(reader)
+	ibs := state.New(overlay)
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(ibs)
+	}
+	for i, tx := range block.Transactions()[:index] {
+		_, err = core.ApplyTransaction(chainConfig, chainCtx, nil, gp, ibs, overlay, header, tx, usedGas, vm.Config{Cancel: ctx.Done()})
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err() // a cancelled transaction stops short without an error
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("tx %d (%x) failed: %v", i, tx.Hash(), err)
+		}
+	}
+	if err = ibs.FinalizeTx(chainConfig.WithEIPsFlags(ctx, header.Number), overlay); err != nil {
+		return nil, nil, err
+	}
+
+	overlay.RemoteReader = NewRemoteReader(ctx, kv, blockNumber-1)
+	overlay.RemoteReader.prefetched = reader.prefetched
+	vmConfig.Cancel = ctx.Done()
+	receipt, err := core.ApplyTransaction(chainConfig, chainCtx, nil, gp, state.New(overlay), writer, header, block.Transactions()[index], usedGas, vmConfig)
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("tx %x failed: %v", hash, err)
+	}
+	return overlay, receipt, nil
+}
+
+type overlayStorageKey struct {
+	address     common.Address
+	incarnation uint64
+	key         common.Hash
+}
+
+// blockOverlay is a state writer keeping the changes in memory and a state reader serving
+// them before falling back to the remote reader, which records all reads.
+type blockOverlay struct {
+	*RemoteReader
+	accounts     map[common.Address]*accounts.Account // nil for deleted accounts
+	incarnations map[common.Address]uint64            // of deleted accounts
+	storage      map[overlayStorageKey][]byte
+	code         map[common.Hash][]byte
+}
+
+func newBlockOverlay(reader *RemoteReader) *blockOverlay {
+	return &blockOverlay{
+		RemoteReader: reader,
+		accounts:     make(map[common.Address]*accounts.Account),
+		incarnations: make(map[common.Address]uint64),
+		storage:      make(map[overlayStorageKey][]byte),
+		code:         make(map[common.Hash][]byte),
+	}
+}
+
+func (o *blockOverlay) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	account, ok := o.accounts[address]
+	if !ok {
+		return o.RemoteReader.ReadAccountData(address)
+	}
+	o.accountReads[address] = struct{}{}
+	if account == nil {
+		return nil, nil
+	}
+	return account.SelfCopy(), nil
+}
+
+func (o *blockOverlay) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	v, ok := o.storage[overlayStorageKey{address, incarnation, *key}]
+	if !ok {
+		return o.RemoteReader.ReadAccountStorage(address, incarnation, key)
+	}
+	if o.storageReads[address] == nil {
+		o.storageReads[address] = make(map[common.Hash]struct{})
+	}
+	o.storageReads[address][*key] = struct{}{}
+	return v, nil
+}
+
+func (o *blockOverlay) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	code, ok := o.code[codeHash]
+	if !ok {
+		return o.RemoteReader.ReadAccountCode(address, codeHash)
+	}
+	o.codeReads[address] = struct{}{}
+	return code, nil
+}
+
+func (o *blockOverlay) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	code, err := o.ReadAccountCode(address, codeHash)
+	return len(code), err
+}
+
+func (o *blockOverlay) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if incarnation, ok := o.incarnations[address]; ok {
+		return incarnation, nil
+	}
+	return o.RemoteReader.ReadAccountIncarnation(address)
+}
+
+func (o *blockOverlay) UpdateAccountData(_ context.Context, address common.Address, _, account *accounts.Account) error {
+	o.accounts[address] = account.SelfCopy()
+	return nil
+}
+
+func (o *blockOverlay) UpdateAccountCode(_ common.Address, _ uint64, codeHash common.Hash, code []byte) error {
+	o.code[codeHash] = common.CopyBytes(code)
+	return nil
+}
+
+func (o *blockOverlay) DeleteAccount(_ context.Context, address common.Address, original *accounts.Account) error {
+	o.accounts[address] = nil
+	if original != nil {
+		o.incarnations[address] = original.Incarnation
+	}
+	return nil
+}
+
+func (o *blockOverlay) WriteAccountStorage(_ context.Context, address common.Address, incarnation uint64, key *common.Hash, _, value *uint256.Int) error {
+	o.storage[overlayStorageKey{address, incarnation, *key}] = value.Bytes()
+	return nil
+}
+
+func (o *blockOverlay) CreateContract(common.Address) error {
+	return nil
+}
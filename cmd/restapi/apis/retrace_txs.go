@@ -0,0 +1,125 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/misc"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// TxRetrace are the reads and writes of a transaction of a block, for ?txs=true.
+type TxRetrace struct {
+	Hash      common.Hash                         `json:"hash"`
+	TxIndex   uint64                              `json:"txIndex"`
+	GasUsed   uint64                              `json:"gasUsed"`
+	Failed    bool                                `json:"failed"`
+	Storage   StorageWriteReads                   `json:"storage"`
+	Account   AccountWritesReads                  `json:"accounts"`
+	Contracts map[common.Address]*ContractStorage `json:"contracts,omitempty"` // for ?storage=nested
+}
+
+// retraceResponse returns the sets of the transaction as a retrace, for the CSV rows.
+func (t TxRetrace) retraceResponse() RetraceResponse {
+	return RetraceResponse{Storage: t.Storage, Account: t.Account, Contracts: t.Contracts}
+}
+
+// runBlockTxs executes the transactions of the block like replayTx does the one it retraces:
+// every transaction runs on a fresh state over an overlay holding the changes of the
+// preceding ones, through a fresh reader, so that its reads and writes are collected alone.
+// The changes of the DAO fork are those of the first transaction, block rewards are not
+// applied.
+func runBlockTxs(ctx context.Context, overlay *blockOverlay, newReader func() *RemoteReader, chainConfig *params.ChainConfig,
+	bcb core.ChainContext, block *types.Block, vmConfig vm.Config, trace *blockTrace, opts RetraceOptions,
+) ([]TxRetrace, types.Receipts, error) {
+	defer replayBlockTimer.UpdateSince(time.Now())
+	replayedBlocksMeter.Mark(1)
+	replayedTxsMeter.Mark(int64(len(block.Transactions())))
+	header := block.Header()
+	vmConfig.Cancel = ctx.Done()
+	if trace != nil {
+		vmConfig.Debug, vmConfig.Tracer = true, trace.tracer()
+	}
+	gp := new(core.GasPool).AddGas(block.GasLimit())
+	usedGas := new(uint64)
+	txs := make([]TxRetrace, 0, len(block.Transactions()))
+	var receipts types.Receipts
+	for i, tx := range block.Transactions() {
+		overlay.RemoteReader = newReader()
+		ibs := state.New(overlay)
+		if i == 0 && chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0 {
+			misc.ApplyDAOHardFork(ibs)
+		}
+		writer := state.NewChangeSetWriterPlainWithValues(block.NumberU64() - 1)
+		receipt, err := core.ApplyTransaction(chainConfig, bcb, nil, gp, ibs, &teeWriter{writer, overlay}, header, tx, usedGas, vmConfig)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err() // a cancelled transaction stops short without an error
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+		}
+		receipts = append(receipts, receipt)
+		if trace != nil {
+			trace.take(tx, receipt, block.NumberU64(), uint64(i))
+		}
+		output := retraceOutput(writer, overlay.RemoteReader, opts)
+		txs = append(txs, TxRetrace{
+			Hash:      tx.Hash(),
+			TxIndex:   uint64(i),
+			GasUsed:   receipt.GasUsed,
+			Failed:    receipt.Status == types.ReceiptStatusFailed,
+			Storage:   output.Storage,
+			Account:   output.Account,
+			Contracts: output.Contracts,
+		})
+	}
+	return txs, receipts, nil
+}
+
+// teeWriter passes the changes to both writers.
+type teeWriter struct {
+	a, b state.StateWriter
+}
+
+func (w *teeWriter) UpdateAccountData(ctx context.Context, address common.Address, original, account *accounts.Account) error {
+	if err := w.a.UpdateAccountData(ctx, address, original, account); err != nil {
+		return err
+	}
+	return w.b.UpdateAccountData(ctx, address, original, account)
+}
+
+func (w *teeWriter) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	if err := w.a.UpdateAccountCode(address, incarnation, codeHash, code); err != nil {
+		return err
+	}
+	return w.b.UpdateAccountCode(address, incarnation, codeHash, code)
+}
+
+func (w *teeWriter) DeleteAccount(ctx context.Context, address common.Address, original *accounts.Account) error {
+	if err := w.a.DeleteAccount(ctx, address, original); err != nil {
+		return err
+	}
+	return w.b.DeleteAccount(ctx, address, original)
+}
+
+func (w *teeWriter) WriteAccountStorage(ctx context.Context, address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	if err := w.a.WriteAccountStorage(ctx, address, incarnation, key, original, value); err != nil {
+		return err
+	}
+	return w.b.WriteAccountStorage(ctx, address, incarnation, key, original, value)
+}
+
+func (w *teeWriter) CreateContract(address common.Address) error {
+	if err := w.a.CreateContract(address); err != nil {
+		return err
+	}
+	return w.b.CreateContract(address)
+}
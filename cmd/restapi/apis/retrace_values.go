@@ -0,0 +1,61 @@
+package apis
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+)
+
+// WriteValues are the encoded values of a written key before and after the block, or the
+// transaction. Accounts use the storage encoding, an empty value is a missing account or a
+// zero slot.
+type WriteValues struct {
+	Original string `json:"original"`
+	Value    string `json:"value"`
+}
+
+// addValues adds the original and the new values of the writes in the output, the writer
+// is of state.NewChangeSetWriterPlainWithValues.
+func addValues(writer *state.ChangeSetWriter, output *RetraceResponse) {
+	output.Account.Values = make(map[string]WriteValues)
+	accountChanges, _ := writer.GetAccountChanges()
+	accountValues, _ := writer.GetAccountValues()
+	newValues := make(map[string][]byte, len(accountValues.Changes))
+	for _, ch := range accountValues.Changes {
+		newValues[string(ch.Key)] = ch.Value
+	}
+	for _, ch := range accountChanges.Changes {
+		output.Account.Values[common.Bytes2Hex(ch.Key)] = WriteValues{
+			Original: common.Bytes2Hex(ch.Value),
+			Value:    common.Bytes2Hex(newValues[string(ch.Key)]),
+		}
+	}
+	if output.Contracts == nil {
+		output.Storage.Values = make(map[string]map[string]WriteValues)
+	}
+	storageChanges, _ := writer.GetStorageChanges()
+	storageValues, _ := writer.GetStorageValues()
+	newValues = make(map[string][]byte, len(storageValues.Changes))
+	for _, ch := range storageValues.Changes {
+		newValues[string(ch.Key)] = ch.Value
+	}
+	for _, ch := range storageChanges.Changes {
+		address := common.BytesToAddress(ch.Key[:common.AddressLength])
+		key := common.BytesToHash(ch.Key[common.AddressLength+common.IncarnationLength:])
+		values := WriteValues{
+			Original: common.Bytes2Hex(ch.Value),
+			Value:    common.Bytes2Hex(newValues[string(ch.Key)]),
+		}
+		if c, ok := output.Contracts[address]; ok {
+			if c.Values == nil {
+				c.Values = make(map[common.Hash]WriteValues)
+			}
+			c.Values[key] = values
+			continue
+		}
+		addrKey := common.Bytes2Hex(address[:])
+		if output.Storage.Values[addrKey] == nil {
+			output.Storage.Values[addrKey] = make(map[string]WriteValues)
+		}
+		output.Storage.Values[addrKey][common.Bytes2Hex(key[:])] = values
+	}
+}
@@ -0,0 +1,79 @@
+package apis
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// BlockVerification compares the outcome of a replay, for ?verify=true, with the header and
+// the stored receipts of the block: an execution audit of the block.
+type BlockVerification struct {
+	Passed       bool                `json:"passed"`
+	ReceiptsRoot HashCheck           `json:"receiptsRoot"`
+	GasUsed      GasCheck            `json:"gasUsed"`
+	Bloom        BloomCheck          `json:"logsBloom"`
+	Stored       StoredReceiptsCheck `json:"storedReceipts"`
+}
+
+type HashCheck struct {
+	Replayed common.Hash `json:"replayed"`
+	Header   common.Hash `json:"header"`
+	Match    bool        `json:"match"`
+}
+
+type GasCheck struct {
+	Replayed uint64 `json:"replayed"`
+	Header   uint64 `json:"header"`
+	Match    bool   `json:"match"`
+}
+
+type BloomCheck struct {
+	Replayed types.Bloom `json:"replayed"`
+	Header   types.Bloom `json:"header"`
+	Match    bool        `json:"match"`
+}
+
+// StoredReceiptsCheck compares the replayed receipts with the stored ones, when the node
+// keeps them. Mismatches are the indices of the transactions whose status, cumulative gas
+// or logs bloom differ.
+type StoredReceiptsCheck struct {
+	Available  bool     `json:"available"`
+	Match      bool     `json:"match"`
+	Mismatches []uint64 `json:"mismatches,omitempty"`
+}
+
+// verifyBlock checks the receipts of the replay of the block. A block passes if the checks
+// against the header and, if any, against the stored receipts all match.
+func verifyBlock(block *types.Block, receipts types.Receipts, db ethdb.Getter, chainConfig *params.ChainConfig) *BlockVerification {
+	header := block.Header()
+	if receipts == nil {
+		receipts = types.Receipts{}
+	}
+	v := &BlockVerification{
+		ReceiptsRoot: HashCheck{Replayed: types.DeriveSha(receipts), Header: header.ReceiptHash},
+		Bloom:        BloomCheck{Replayed: types.CreateBloom(receipts), Header: header.Bloom},
+		GasUsed:      GasCheck{Header: header.GasUsed},
+	}
+	if len(receipts) > 0 {
+		v.GasUsed.Replayed = receipts[len(receipts)-1].CumulativeGasUsed
+	}
+	v.ReceiptsRoot.Match = v.ReceiptsRoot.Replayed == v.ReceiptsRoot.Header
+	v.Bloom.Match = v.Bloom.Replayed == v.Bloom.Header
+	v.GasUsed.Match = v.GasUsed.Replayed == v.GasUsed.Header
+
+	v.Stored.Match = true
+	if stored := rawdb.ReadReceipts(db, block.Hash(), block.NumberU64(), chainConfig); stored != nil {
+		v.Stored.Available = true
+		for i, r := range receipts {
+			if i >= len(stored) || stored[i].Status != r.Status || stored[i].CumulativeGasUsed != r.CumulativeGasUsed || stored[i].Bloom != r.Bloom {
+				v.Stored.Mismatches = append(v.Stored.Mismatches, uint64(i))
+			}
+		}
+		v.Stored.Match = len(v.Stored.Mismatches) == 0 && len(stored) == len(receipts)
+	}
+	v.Passed = v.ReceiptsRoot.Match && v.Bloom.Match && v.GasUsed.Match && v.Stored.Match
+	return v
+}
@@ -0,0 +1,161 @@
+package apis
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// forks are the names ?fork= takes, in activation order, with the blocks of the chain
+// config activating them.
+var forks = []struct {
+	name   string
+	blocks func(c *params.ChainConfig) []**big.Int
+}{
+	{"homestead", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.HomesteadBlock} }},
+	{"tangerinewhistle", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.EIP150Block} }},
+	{"spuriousdragon", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.EIP155Block, &c.EIP158Block} }},
+	{"byzantium", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.ByzantiumBlock} }},
+	{"constantinople", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.ConstantinopleBlock} }},
+	{"petersburg", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.PetersburgBlock} }},
+	{"istanbul", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.IstanbulBlock} }},
+	{"muirglacier", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.MuirGlacierBlock} }},
+	{"yolov1", func(c *params.ChainConfig) []**big.Int { return []**big.Int{&c.YoloV1Block} }},
+}
+
+func forkNames() []string {
+	names := make([]string, len(forks))
+	for i, f := range forks {
+		names[i] = f.name
+	}
+	return names
+}
+
+// vmOptions reads the options of the EVM of block retraces: ?tracer=calls or gas, ?fork= to
+// replay under the rules of another fork, ?eips= to enable EIPs on top of them and
+// ?gaslimit=none for instructions never to run out of gas.
+func vmOptions(c *gin.Context, opts *RetraceOptions) error {
+	switch tracer := c.Query("tracer"); tracer {
+	case "":
+	case "calls":
+		opts.Calls = true
+	case "gas":
+		if opts.Calls {
+			return fmt.Errorf("%w: only one tracer can be used, ?calls=true is the calls tracer", ErrInvalidParam)
+		}
+		opts.Gas = true
+	default:
+		return fmt.Errorf("%w: unknown tracer %q, calls and gas are available", ErrInvalidParam, tracer)
+	}
+	if fork := strings.ToLower(c.Query("fork")); fork != "" {
+		known := false
+		for _, f := range forks {
+			known = known || f.name == fork
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown fork %q, one of %s", ErrInvalidParam, fork, strings.Join(forkNames(), ", "))
+		}
+		opts.Fork = fork
+	}
+	if s := c.Query("eips"); s != "" {
+		var eips []int
+		for _, e := range strings.Split(s, ",") {
+			eip, err := strconv.Atoi(strings.TrimSpace(e))
+			if err != nil || !vm.ValidEip(eip) {
+				return fmt.Errorf("%w: eip %q can not be enabled, one of %s", ErrInvalidParam, e, strings.Join(vm.ActivateableEips(), ", "))
+			}
+			eips = append(eips, eip)
+		}
+		sort.Ints(eips)
+		names := make([]string, len(eips))
+		for i, eip := range eips {
+			names[i] = strconv.Itoa(eip)
+		}
+		opts.EIPs = strings.Join(names, ",") // canonical, as part of the cache key
+	}
+	switch s := c.Query("gaslimit"); s {
+	case "":
+	case "none":
+		opts.NoGasLimit = true
+	default:
+		return fmt.Errorf("%w: gaslimit can only be none", ErrInvalidParam)
+	}
+	return nil
+}
+
+// vmConfig returns the chain config and the EVM config the options replay the block with.
+// A fork activates the forks up to it at the block and deactivates the later ones.
+func (opts RetraceOptions) vmConfig(chainConfig *params.ChainConfig, bn uint64) (*params.ChainConfig, vm.Config) {
+	var vmConfig vm.Config
+	vmConfig.NoGasLimit = opts.NoGasLimit
+	if opts.EIPs != "" {
+		for _, s := range strings.Split(opts.EIPs, ",") {
+			eip, _ := strconv.Atoi(s)
+			vmConfig.ExtraEips = append(vmConfig.ExtraEips, eip)
+		}
+	}
+	if opts.Fork == "" {
+		return chainConfig, vmConfig
+	}
+	overridden := *chainConfig
+	number, never := new(big.Int).SetUint64(bn), new(big.Int).SetUint64(math.MaxUint64)
+	active := true
+	for _, f := range forks {
+		for _, block := range f.blocks(&overridden) {
+			switch {
+			case !active:
+				*block = never
+			case *block == nil || (*block).Cmp(number) > 0:
+				*block = number
+			}
+		}
+		if f.name == opts.Fork {
+			active = false
+		}
+	}
+	return &overridden, vmConfig
+}
+
+// blockTrace collects the result of the tracer of a block replay after every transaction.
+type blockTrace struct {
+	calls *callTracer
+	gas   *gasTracer
+	Calls []TxCalls
+	Gas   []GasBreakdown
+}
+
+// newBlockTrace returns nil if the options select no tracer.
+func newBlockTrace(opts RetraceOptions) *blockTrace {
+	switch {
+	case opts.Calls:
+		return &blockTrace{calls: &callTracer{}, Calls: []TxCalls{}}
+	case opts.Gas:
+		return &blockTrace{gas: newGasTracer(), Gas: []GasBreakdown{}}
+	}
+	return nil
+}
+
+func (t *blockTrace) tracer() vm.Tracer {
+	if t.calls != nil {
+		return t.calls
+	}
+	return t.gas
+}
+
+// take records the result of the transaction and resets the tracer.
+func (t *blockTrace) take(tx *types.Transaction, receipt *types.Receipt, bn, index uint64) {
+	if t.calls != nil {
+		t.Calls = append(t.Calls, TxCalls{Hash: tx.Hash(), Call: t.calls.take()})
+		return
+	}
+	t.Gas = append(t.Gas, t.gas.breakdown(tx, receipt, bn, index))
+	*t.gas = *newGasTracer()
+}
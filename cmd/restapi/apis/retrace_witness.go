@@ -0,0 +1,117 @@
+package apis
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// maxWitnessRewind is the most blocks the hashed state is rewound by to build a witness.
+const maxWitnessRewind = 10000
+
+// BlockWitnessResponse is the witness of the state read and written by a block, against the
+// state root of its parent, serialized for stateless clients.
+type BlockWitnessResponse struct {
+	BlockNumber uint64        `json:"blockNumber"`
+	Root        common.Hash   `json:"root"`
+	Witness     hexutil.Bytes `json:"witness"`
+	Stats       WitnessStats  `json:"stats"`
+}
+
+// WitnessStats are the sizes in bytes of the parts of a witness.
+type WitnessStats struct {
+	Size       uint64 `json:"size"`
+	Codes      uint64 `json:"codes"`
+	LeafKeys   uint64 `json:"leafKeys"`
+	LeafValues uint64 `json:"leafValues"`
+	Structure  uint64 `json:"structure"`
+	Hashes     uint64 `json:"hashes"`
+}
+
+func (e *Env) GetBlockWitness(c *gin.Context) {
+	bn, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	if _, err = e.replayableBlock(bn); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := e.blockWitness(c, bn)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	render(c, http.StatusOK, result)
+}
+
+// blockWitness replays the block recording the state it reads and writes, and proves it with
+// the hashed state rewound to the parent of the block, see state.BlockWitness.
+func (e *Env) blockWitness(c *gin.Context, bn uint64) (*BlockWitnessResponse, error) {
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		return nil, err
+	}
+	db := ethdb.NewObjectDatabase(e.KV)
+	head, _, err := stages.GetStageProgress(db, stages.IntermediateHashes)
+	if err != nil {
+		return nil, err
+	}
+	if bn-1 > head {
+		return nil, fmt.Errorf("%w: the state is hashed up to block %d, not yet before block %d", ErrInvalidParam, head, bn)
+	}
+	if head-(bn-1) > maxWitnessRewind {
+		return nil, fmt.Errorf("%w: the state is hashed at block %d, more than %d blocks after block %d", ErrInvalidParam, head, maxWitnessRewind, bn)
+	}
+	block := rawdb.ReadBlockByNumber(e.DB, bn)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %d", ErrBlockNotFound, bn)
+	}
+
+	ctx := c.Request.Context()
+	remoteReader := NewRemoteReader(ctx, e.KV, bn)
+	if err = remoteReader.PrefetchSenders(chainConfig, block); err != nil {
+		return nil, err
+	}
+	reader := state.NewWitnessReader(remoteReader)
+	writer := state.NewChangeSetWriterPlain(bn)
+	if _, err = runBlock(ctx, state.New(reader), state.NewNoopWriter(), writer, chainConfig, NewRemoteContext(e.KV, e.DB, chainConfig), block, vm.Config{}, nil); err != nil {
+		return nil, err
+	}
+	if err = reader.TouchChanges(writer); err != nil {
+		return nil, err
+	}
+	witness, err := state.BlockWitness(db, head, bn, reader)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	stats, err := witness.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockWitnessResponse{
+		BlockNumber: bn,
+		Root:        rawdb.ReadHeader(e.DB, block.ParentHash(), bn-1).Root,
+		Witness:     buf.Bytes(),
+		Stats: WitnessStats{
+			Size:       stats.BlockWitnessSize(),
+			Codes:      stats.CodesSize(),
+			LeafKeys:   stats.LeafKeysSize(),
+			LeafValues: stats.LeafValuesSize(),
+			Structure:  stats.StructureSize(),
+			Hashes:     stats.HashesSize(),
+		},
+	}, nil
+}
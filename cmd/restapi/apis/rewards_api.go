@@ -0,0 +1,149 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func RegisterRewardsAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(e.limitReplays)
+	router.GET(":chain/:number", e.GetRewards)
+	return nil
+}
+
+// BlockRewards are the amounts credited for a block, in wei. Fees are paid by the senders,
+// only the rewards are issued.
+type BlockRewards struct {
+	BlockNumber  uint64         `json:"blockNumber"`
+	BlockHash    common.Hash    `json:"blockHash"`
+	Miner        common.Address `json:"miner"`       // of the fees, the signer on clique chains
+	MinerReward  string         `json:"minerReward"` // including the rewards for the inclusion of the uncles
+	Uncles       []UncleReward  `json:"uncles"`
+	UncleRewards string         `json:"uncleRewards"`
+	Fees         string         `json:"fees"`
+	Issuance     string         `json:"issuance"`   // miner and uncle rewards
+	MinerTotal   string         `json:"minerTotal"` // miner reward and fees
+	BlockFinality
+}
+
+// UncleReward is what the miner of an uncle was credited.
+type UncleReward struct {
+	Number uint64         `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+	Miner  common.Address `json:"miner"`
+	Reward string         `json:"reward"`
+}
+
+func (e *Env) GetRewards(c *gin.Context) {
+	bn, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	bf, err := e.replayableBlock(bn)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := ComputeBlockRewards(c.Request.Context(), bn, c.Param("chain"), e.KV, e.DB)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result.BlockFinality = bf
+	render(c, http.StatusOK, result)
+}
+
+// ComputeBlockRewards replays the block on the state after its parent for the fees, the
+// gas used by every transaction times its gas price, and finalizes it with the engine of the
+// chain for the rewards.
+func ComputeBlockRewards(ctx context.Context, blockNumber uint64, chain string, kv ethdb.KV, db ethdb.Getter) (BlockRewards, error) {
+	chainConfig, err := ReadChainConfig(kv, chain)
+	if err != nil {
+		return BlockRewards{}, err
+	}
+	block := rawdb.ReadBlockByNumber(db, blockNumber)
+	if block == nil {
+		return BlockRewards{}, fmt.Errorf("%w: %d", ErrBlockNotFound, blockNumber)
+	}
+	chainCtx := NewRemoteContext(kv, db, chainConfig)
+	reader := NewRemoteReader(ctx, kv, blockNumber-1)
+	if err = reader.PrefetchSenders(chainConfig, block); err != nil {
+		return BlockRewards{}, err
+	}
+	ibs := state.New(reader)
+	noOpWriter := state.NewNoopWriter()
+	receipts, err := runBlock(ctx, ibs, noOpWriter, noOpWriter, chainConfig, chainCtx, block, vm.Config{}, nil)
+	if err != nil {
+		return BlockRewards{}, err
+	}
+	fees := new(big.Int)
+	for i, tx := range block.Transactions() {
+		fee := new(big.Int).SetUint64(receipts[i].GasUsed)
+		fees.Add(fees, fee.Mul(fee, tx.GasPrice().ToBig()))
+	}
+	miner, err := chainCtx.Engine().Author(block.Header())
+	if err != nil {
+		return BlockRewards{}, err
+	}
+
+	minerReward, uncleRewards := finalizeRewards(chainConfig, chainCtx.Engine(), block)
+	result := BlockRewards{
+		BlockNumber: blockNumber,
+		BlockHash:   block.Hash(),
+		Miner:       miner,
+		MinerReward: minerReward.String(),
+		Uncles:      []UncleReward{},
+		Fees:        fees.String(),
+		MinerTotal:  new(big.Int).Add(minerReward, fees).String(),
+	}
+	issuance := new(big.Int).Set(minerReward)
+	for i, uncle := range block.Uncles() {
+		result.Uncles = append(result.Uncles, UncleReward{Number: uncle.Number.Uint64(), Hash: uncle.Hash(), Miner: uncle.Coinbase, Reward: uncleRewards[i].String()})
+		issuance.Add(issuance, uncleRewards[i])
+	}
+	result.UncleRewards = new(big.Int).Sub(issuance, minerReward).String()
+	result.Issuance = issuance.String()
+	return result, nil
+}
+
+// finalizeRewards finalizes copies of the block header and uncles on an empty state, with
+// coinbases replaced by distinct addresses, and returns what those were credited: the miner
+// of the block and those of the uncles may be the same.
+func finalizeRewards(chainConfig *params.ChainConfig, engine consensus.Engine, block *types.Block) (*big.Int, []*big.Int) {
+	beneficiary := func(i int) common.Address {
+		var a common.Address
+		a[0] = 0xff
+		a[common.AddressLength-2], a[common.AddressLength-1] = byte(i>>8), byte(i)
+		return a
+	}
+	header := types.CopyHeader(block.Header())
+	header.Coinbase = beneficiary(0)
+	uncles := make([]*types.Header, len(block.Uncles()))
+	for i, uncle := range block.Uncles() {
+		uncles[i] = types.CopyHeader(uncle)
+		uncles[i].Coinbase = beneficiary(i + 1)
+	}
+	empty := ethdb.NewMemDatabase()
+	defer empty.Close()
+	ibs := state.New(state.NewPlainStateReader(empty))
+	engine.Finalize(chainConfig, header, ibs, block.Transactions(), uncles)
+	uncleRewards := make([]*big.Int, len(uncles))
+	for i := range uncles {
+		uncleRewards[i] = ibs.GetBalance(beneficiary(i + 1)).ToBig()
+	}
+	return ibs.GetBalance(beneficiary(0)).ToBig(), uncleRewards
+}
@@ -0,0 +1,87 @@
+package apis
+
+import (
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+var testAddress = common.HexToAddress("0x0a")
+
+// newTestEnv returns an Env over an in-memory database holding the genesis of a test chain.
+func newTestEnv(t *testing.T) *Env {
+	db := ethdb.NewMemDatabase()
+	gspec := &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  core.GenesisAlloc{testAddress: {Balance: big.NewInt(1000)}},
+	}
+	gspec.MustCommit(db)
+	chain, err := DetectChain(db.KV())
+	require.NoError(t, err)
+	return &Env{
+		KV:        db.KV(),
+		DB:        db,
+		Chain:     chain,
+		Selectors: NewSelectorDB(),
+		Finality:  NewFinality(0),
+	}
+}
+
+// newTestRouter serves the routes of e under api/v1 like the server, checking the credentials
+// with auth if not nil.
+func newTestRouter(t *testing.T, e *Env, auth *Auth) *gin.Engine {
+	r := gin.New()
+	root := r.Group("api/v1")
+	if auth != nil {
+		root.Use(auth.Middleware())
+	}
+	require.NoError(t, RegisterRoutes(root, e))
+	RegisterOpenAPI(r)
+	return r
+}
+
+// TestOperationsRouted checks that every operation of the OpenAPI document and the client is
+// served, and requires the admin scope if and only if it is marked so. The handlers are not
+// run, the route matched is recorded by a middleware.
+func TestOperationsRouted(t *testing.T) {
+	e := newTestEnv(t)
+	defer e.KV.Close()
+	r := gin.New()
+	r.NoRoute(func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusNotFound)
+	})
+	root := r.Group("api/v1")
+	root.Use(func(c *gin.Context) {
+		admin := false
+		for _, name := range c.HandlerNames() {
+			admin = admin || strings.HasSuffix(name, ".requireAdmin")
+		}
+		c.Header("X-Admin", map[bool]string{false: "no", true: "yes"}[admin])
+		c.AbortWithStatus(http.StatusNoContent)
+	})
+	require.NoError(t, RegisterRoutes(root, e))
+
+	for _, op := range Operations {
+		segments := strings.Split(op.Path, "/")
+		for i, s := range segments {
+			if strings.HasPrefix(s, ":") {
+				segments[i] = "1"
+			}
+		}
+		w := serve(r, op.Method, "/api/v1/"+strings.Join(segments, "/"), nil)
+		if !assert.Equal(t, http.StatusNoContent, w.Code, "%s %s not routed", op.Method, op.Path) {
+			continue
+		}
+		assert.Equal(t, map[bool]string{false: "no", true: "yes"}[op.Admin], w.Header().Get("X-Admin"), "admin scope of %s %s", op.Method, op.Path)
+	}
+}
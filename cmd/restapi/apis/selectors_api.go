@@ -0,0 +1,203 @@
+package apis
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+// SelectorDB is a local 4-byte function selector database used to give
+// human-readable names to calls whose full ABI is unknown.
+type SelectorDB struct {
+	mu   sync.RWMutex
+	sigs map[[4]byte][]string
+}
+
+func NewSelectorDB() *SelectorDB {
+	return &SelectorDB{sigs: make(map[[4]byte][]string)}
+}
+
+// OpenSelectorDB creates a selector database and imports the dump at the given path.
+func OpenSelectorDB(path string) (*SelectorDB, error) {
+	sdb := NewSelectorDB()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := sdb.Import(f); err != nil {
+		return nil, fmt.Errorf("importing selectors from %s: %w", path, err)
+	}
+	return sdb, nil
+}
+
+// Selector computes the 4-byte selector of a text signature like "transfer(address,uint256)".
+func Selector(signature string) [4]byte {
+	var sel [4]byte
+	copy(sel[:], crypto.Keccak256([]byte(signature)))
+	return sel
+}
+
+// Add registers a text signature, its selector is computed from the signature itself.
+// Returns false if the signature was already known.
+func (s *SelectorDB) Add(signature string) bool {
+	signature = strings.TrimSpace(signature)
+	sel := Selector(signature)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, known := range s.sigs[sel] {
+		if known == signature {
+			return false
+		}
+	}
+	s.sigs[sel] = append(s.sigs[sel], signature)
+	return true
+}
+
+// Import reads a dump with one signature per line. Lines may be either a bare text
+// signature or "<hex selector> <signature>" (space, tab or comma separated); entries
+// whose selector does not match the signature are rejected.
+func (s *SelectorDB) Import(r io.Reader) (int, error) {
+	added := 0
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		signature, err := parseSignature(text)
+		if err != nil {
+			return added, fmt.Errorf("line %d: %w", line, err)
+		}
+		if s.Add(signature) {
+			added++
+		}
+	}
+	return added, scanner.Err()
+}
+
+// Lookup returns all known signatures for the selector, sorted.
+func (s *SelectorDB) Lookup(sel [4]byte) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sigs := append([]string(nil), s.sigs[sel]...)
+	sort.Strings(sigs)
+	return sigs
+}
+
+// Name returns the best-known signature for the given call input, or an empty string
+// when the input is too short to carry a selector or the selector is unknown.
+func (s *SelectorDB) Name(input []byte) string {
+	if s == nil || len(input) < 4 {
+		return ""
+	}
+	var sel [4]byte
+	copy(sel[:], input)
+	sigs := s.Lookup(sel)
+	if len(sigs) == 0 {
+		return ""
+	}
+	return sigs[0]
+}
+
+func (s *SelectorDB) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sigs)
+}
+
+// parseSignature validates an entry of a dump or of the JSON array of AddSelectors, either a
+// bare text signature or "<hex selector> <signature>", and returns the signature.
+func parseSignature(text string) (string, error) {
+	signature := strings.TrimSpace(text)
+	if i := strings.IndexAny(signature, " \t,"); i > 0 && !strings.Contains(signature[:i], "(") {
+		selHex, sig := signature[:i], strings.TrimSpace(signature[i+1:])
+		sel, err := parseSelector(selHex)
+		if err != nil {
+			return "", err
+		}
+		if Selector(sig) != sel {
+			return "", fmt.Errorf("selector %s does not match signature %q", selHex, sig)
+		}
+		signature = sig
+	}
+	if !strings.HasSuffix(signature, ")") || !strings.Contains(signature, "(") {
+		return "", fmt.Errorf("malformed signature %q", signature)
+	}
+	return signature, nil
+}
+
+func parseSelector(selHex string) ([4]byte, error) {
+	var sel [4]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(selHex, "0x"))
+	if err != nil || len(b) != 4 {
+		return sel, fmt.Errorf("invalid selector %q", selHex)
+	}
+	copy(sel[:], b)
+	return sel, nil
+}
+
+func RegisterSelectorsAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET(":selector", e.GetSelector)
+	router.POST("/", requireAdmin, e.AddSelectors)
+	router.POST("/import", requireAdmin, e.ImportSelectors)
+	return nil
+}
+
+func (e *Env) GetSelector(c *gin.Context) {
+	sel, err := parseSelector(c.Param("selector"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	sigs := e.Selectors.Lookup(sel)
+	if len(sigs) == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "selector not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"selector": fmt.Sprintf("0x%x", sel), "signatures": sigs})
+}
+
+// AddSelectors accepts a JSON array of text signatures, validated as by SelectorDB.Import.
+// None is added if one of them is invalid.
+func (e *Env) AddSelectors(c *gin.Context) {
+	var signatures []string
+	if err := c.ShouldBindJSON(&signatures); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	for i, sig := range signatures {
+		signature, err := parseSignature(sig)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("signature %d: %v", i, err)})
+			return
+		}
+		signatures[i] = signature
+	}
+	added := 0
+	for _, sig := range signatures {
+		if e.Selectors.Add(sig) {
+			added++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"added": added, "total": e.Selectors.Len()})
+}
+
+// ImportSelectors accepts a dump in the format understood by SelectorDB.Import as the request body.
+func (e *Env) ImportSelectors(c *gin.Context) {
+	added, err := e.Selectors.Import(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error(), "added": added})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"added": added, "total": e.Selectors.Len()})
+}
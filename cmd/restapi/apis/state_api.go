@@ -0,0 +1,88 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func RegisterStateAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET(":chain/:number/account/:address", e.GetAccountState)
+	return nil
+}
+
+// AccountState is an account after a block.
+type AccountState struct {
+	Address     common.Address `json:"address"`
+	BlockNumber uint64         `json:"blockNumber"`
+	Balance     string         `json:"balance"`
+	Nonce       uint64         `json:"nonce"`
+	CodeHash    common.Hash    `json:"codeHash"`
+	CodeSize    int            `json:"codeSize"`
+	Incarnation uint64         `json:"incarnation"`
+}
+
+func (e *Env) GetAccountState(c *gin.Context) {
+	bn, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	address := common.FromHex(c.Param("address"))
+	if len(address) != common.AddressLength {
+		abortWithError(c, fmt.Errorf("%w: invalid address %s", ErrInvalidParam, c.Param("address")))
+		return
+	}
+	if _, err = ReadChainConfig(e.KV, c.Param("chain")); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := ReadAccountState(c.Request.Context(), common.BytesToAddress(address), bn, e.KV)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	render(c, http.StatusOK, result)
+}
+
+// ReadAccountState reads the account as of the block through a RemoteReader. Blocks beyond
+// the head are refused, as the history would silently give the latest state for them.
+func ReadAccountState(ctx context.Context, address common.Address, blockNumber uint64, kv ethdb.KV) (AccountState, error) {
+	var head uint64
+	if err := kv.View(ctx, func(tx ethdb.Tx) error {
+		var err error
+		head, err = headTx(tx)
+		return err
+	}); err != nil {
+		return AccountState{}, err
+	}
+	if blockNumber > head {
+		return AccountState{}, fmt.Errorf("%w: %d is beyond the head %d", ErrBlockNotFound, blockNumber, head)
+	}
+	reader := NewRemoteReader(ctx, kv, blockNumber)
+	account, err := reader.ReadAccountData(address)
+	if err != nil {
+		return AccountState{}, err
+	}
+	if account == nil {
+		return AccountState{}, fmt.Errorf("%w: account %x at block %d", ErrEntityNotFound, address, blockNumber)
+	}
+	codeSize, err := reader.ReadAccountCodeSize(address, account.CodeHash)
+	if err != nil {
+		return AccountState{}, err
+	}
+	return AccountState{
+		Address:     address,
+		BlockNumber: blockNumber,
+		Balance:     account.Balance.ToBig().String(),
+		Nonce:       account.Nonce,
+		CodeHash:    account.CodeHash,
+		CodeSize:    codeSize,
+		Incarnation: account.Incarnation,
+	}, nil
+}
@@ -8,23 +8,79 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/state"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 )
 
 func RegisterStorageAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(withBlockParam)
 	router.GET("/", e.FindStorage)
+	router.POST("decode", e.DecodeStorage)
 	return nil
 }
 
 func (e *Env) FindStorage(c *gin.Context) {
-	results, err := findStorageByPrefix(c.Query("prefix"), e.KV)
+	var results []*StorageResponse
+	var err error
+	if blockParam(c).Latest() {
+		results, err = findStorageByPrefix(c.Query("prefix"), e.KV)
+	} else {
+		results, err = e.findStorageByPrefixAsOf(c, c.Query("prefix"))
+	}
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		abortWithError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, results)
 }
 
+type DecodeStorageRequest struct {
+	Address common.Address `json:"address"`
+	Block   *uint64        `json:"block"` // state as of the end of this block, the ?block= parameter if omitted
+	Layout  StorageLayout  `json:"layout"`
+}
+
+type DecodeStorageResponse struct {
+	CommitPoint CommitPoint       `json:"commitPoint"`
+	Variables   []StorageVariable `json:"variables"`
+}
+
+// DecodeStorage reads the slots of a contract described by a solc storage layout and
+// splits them into variables.
+func (e *Env) DecodeStorage(c *gin.Context) {
+	var req DecodeStorageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if _, err := req.Layout.Slots(); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	var resp DecodeStorageResponse
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		cp, err := e.commitPoint(c, tx)
+		if err != nil {
+			return err
+		}
+		if resp.CommitPoint, err = cp.at(req.Block); err != nil {
+			return err
+		}
+		acc, err := readAccountTx(tx, req.Address, resp.CommitPoint.Block)
+		if err != nil || acc == nil {
+			return err
+		}
+		resp.Variables, err = req.Layout.DecodeStorage(func(slot common.Hash) ([]byte, error) {
+			return readStorageTx(tx, req.Address, acc.Incarnation, slot, resp.CommitPoint.Block)
+		})
+		return err
+	}); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	render(c, http.StatusOK, resp)
+}
+
 type StorageResponse struct {
 	Prefix string `json:"prefix"`
 	Value  string `json:"value"`
@@ -64,3 +120,33 @@ func findStorageByPrefix(prefixS string, remoteDB ethdb.KV) ([]*StorageResponse,
 
 	return results, nil
 }
+
+// findStorageByPrefixAsOf walks the storage history as of the ?block= parameter.
+func (e *Env) findStorageByPrefixAsOf(c *gin.Context, prefixS string) ([]*StorageResponse, error) {
+	var cp CommitPoint
+	if err := e.KV.View(c.Request.Context(), func(tx ethdb.Tx) error {
+		var err error
+		cp, err = e.commitPoint(c, tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	var results []*StorageResponse
+	prefix := common.FromHex(prefixS)
+	if err := state.WalkAsOf(e.KV, dbutils.CurrentStateBucket, dbutils.StorageHistoryBucket, prefix, 8*len(prefix), cp.Block+1, func(k, v []byte) (bool, error) {
+		results = append(results, &StorageResponse{
+			Prefix: fmt.Sprintf("%x\n", k),
+			Value:  fmt.Sprintf("%x\n", v),
+		})
+		if len(results) > 200 {
+			results = append(results, &StorageResponse{
+				Prefix: "too much results",
+			})
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
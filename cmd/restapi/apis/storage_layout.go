@@ -0,0 +1,251 @@
+package apis
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// StorageLayout is the storage layout emitted by solc (--storage-layout, or the
+// "storageLayout" output selection of standard JSON).
+type StorageLayout struct {
+	Storage []StorageLayoutEntry         `json:"storage"`
+	Types   map[string]StorageLayoutType `json:"types"`
+}
+
+type StorageLayoutEntry struct {
+	Label  string `json:"label"`
+	Offset int    `json:"offset"`
+	Slot   string `json:"slot"` // decimal
+	Type   string `json:"type"`
+}
+
+type StorageLayoutType struct {
+	Encoding      string               `json:"encoding"` // inplace, mapping, dynamic_array or bytes
+	Label         string               `json:"label"`
+	NumberOfBytes string               `json:"numberOfBytes"`
+	Base          string               `json:"base,omitempty"`    // element type of arrays
+	Members       []StorageLayoutEntry `json:"members,omitempty"` // struct members, slots are relative
+}
+
+// StorageVariable is a variable decoded from a storage slot. Value is rendered according
+// to the type: decimal for integers, checksummed hex for addresses, hex for fixed bytes.
+// Mappings and dynamic arrays only yield their length (arrays) or nothing (mappings),
+// strings and bytes are decoded in the short form and give the length otherwise.
+type StorageVariable struct {
+	Label  string      `json:"label"`
+	Type   string      `json:"type"`
+	Slot   common.Hash `json:"slot"`
+	Offset int         `json:"offset"`
+	Size   int         `json:"size"`
+	Value  string      `json:"value"`
+}
+
+// slotVariable is a value type variable placed at an absolute slot.
+type slotVariable struct {
+	label  string
+	typ    StorageLayoutType
+	slot   common.Hash
+	offset int
+	size   int
+}
+
+// variables flattens structs and static arrays into their value type members.
+func (l *StorageLayout) variables() ([]slotVariable, error) {
+	var vars []slotVariable
+	var walk func(label, typeID string, slot *uint256.Int, offset int) error
+	walk = func(label, typeID string, slot *uint256.Int, offset int) error {
+		typ, ok := l.Types[typeID]
+		if !ok {
+			return fmt.Errorf("unknown type %q of %s", typeID, label)
+		}
+		size, err := strconv.Atoi(typ.NumberOfBytes)
+		if err != nil {
+			return fmt.Errorf("invalid size of type %q: %w", typeID, err)
+		}
+		switch {
+		case typ.Encoding == "inplace" && len(typ.Members) > 0:
+			for _, m := range typ.Members {
+				rel, err := parseSlot(m.Slot)
+				if err != nil {
+					return err
+				}
+				if err := walk(label+"."+m.Label, m.Type, new(uint256.Int).Add(slot, rel), m.Offset); err != nil {
+					return err
+				}
+			}
+			return nil
+		case typ.Encoding == "inplace" && typ.Base != "":
+			base, ok := l.Types[typ.Base]
+			if !ok {
+				return fmt.Errorf("unknown type %q of %s", typ.Base, label)
+			}
+			elemSize, err := strconv.Atoi(base.NumberOfBytes)
+			if err != nil || elemSize == 0 {
+				return fmt.Errorf("invalid size of type %q", typ.Base)
+			}
+			// numberOfBytes is rounded up to whole slots, the label has the exact length
+			length := size / elemSize
+			if i := strings.LastIndexByte(typ.Label, '['); i >= 0 && strings.HasSuffix(typ.Label, "]") {
+				if n, err := strconv.Atoi(typ.Label[i+1 : len(typ.Label)-1]); err == nil {
+					length = n
+				}
+			}
+			elemSlot, elemOffset := new(uint256.Int).Set(slot), 0
+			for i := 0; i < length; i++ {
+				if elemOffset+elemSize > 32 {
+					elemSlot.Add(elemSlot, uint256.NewInt().SetOne())
+					elemOffset = 0
+				}
+				if err := walk(fmt.Sprintf("%s[%d]", label, i), typ.Base, new(uint256.Int).Set(elemSlot), elemOffset); err != nil {
+					return err
+				}
+				if elemSize >= 32 {
+					// elements spanning whole slots never share them
+					elemSlot.Add(elemSlot, uint256.NewInt().SetUint64(uint64((elemSize+31)/32)))
+					continue
+				}
+				elemOffset += elemSize
+			}
+			return nil
+		}
+		if typ.Encoding == "inplace" && offset+size > 32 {
+			return fmt.Errorf("%s of %d bytes at offset %d does not fit a slot", label, size, offset)
+		}
+		vars = append(vars, slotVariable{label: label, typ: typ, slot: common.Hash(slot.Bytes32()), offset: offset, size: size})
+		return nil
+	}
+	for _, entry := range l.Storage {
+		slot, err := parseSlot(entry.Slot)
+		if err != nil {
+			return nil, err
+		}
+		if err := walk(entry.Label, entry.Type, slot, entry.Offset); err != nil {
+			return nil, err
+		}
+	}
+	return vars, nil
+}
+
+func parseSlot(s string) (*uint256.Int, error) {
+	b, ok := new(big.Int).SetString(s, 0)
+	if !ok || b.Sign() < 0 {
+		return nil, fmt.Errorf("invalid slot %q", s)
+	}
+	slot, overflow := uint256.FromBig(b)
+	if overflow {
+		return nil, fmt.Errorf("invalid slot %q", s)
+	}
+	return slot, nil
+}
+
+// Slots returns the distinct slots holding variables of the layout, in ascending order.
+func (l *StorageLayout) Slots() ([]common.Hash, error) {
+	vars, err := l.variables()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[common.Hash]struct{})
+	var slots []common.Hash
+	for _, v := range vars {
+		if _, ok := seen[v.slot]; !ok {
+			seen[v.slot] = struct{}{}
+			slots = append(slots, v.slot)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Big().Cmp(slots[j].Big()) < 0 })
+	return slots, nil
+}
+
+// DecodeSlot splits the value of a slot into the variables the layout places in it.
+// The value is the stored word without leading zeroes, as kept in the database.
+func (l *StorageLayout) DecodeSlot(slot common.Hash, value []byte) ([]StorageVariable, error) {
+	vars, err := l.variables()
+	if err != nil {
+		return nil, err
+	}
+	word := common.LeftPadBytes(value, 32)
+	var decoded []StorageVariable
+	for _, v := range vars {
+		if v.slot != slot {
+			continue
+		}
+		decoded = append(decoded, StorageVariable{
+			Label:  v.label,
+			Type:   v.typ.Label,
+			Slot:   v.slot,
+			Offset: v.offset,
+			Size:   v.size,
+			Value:  decodeStorageValue(v.typ, word, v.offset, v.size),
+		})
+	}
+	sort.Slice(decoded, func(i, j int) bool { return decoded[i].Offset < decoded[j].Offset })
+	return decoded, nil
+}
+
+// DecodeStorage decodes all variables of the layout, reading each slot once.
+func (l *StorageLayout) DecodeStorage(read func(slot common.Hash) ([]byte, error)) ([]StorageVariable, error) {
+	slots, err := l.Slots()
+	if err != nil {
+		return nil, err
+	}
+	var decoded []StorageVariable
+	for _, slot := range slots {
+		value, err := read(slot)
+		if err != nil {
+			return nil, err
+		}
+		vars, err := l.DecodeSlot(slot, value)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, vars...)
+	}
+	return decoded, nil
+}
+
+// decodeStorageValue extracts size bytes at offset, counted from the lower-order end of the word.
+func decodeStorageValue(typ StorageLayoutType, word []byte, offset, size int) string {
+	switch typ.Encoding {
+	case "mapping":
+		return ""
+	case "dynamic_array":
+		return new(big.Int).SetBytes(word).String()
+	case "bytes":
+		if word[31]&1 == 1 {
+			// long form, the slot holds length*2+1 and the data lives at keccak(slot)
+			length := new(big.Int).Rsh(new(big.Int).SetBytes(word), 1)
+			return fmt.Sprintf("<%s bytes>", length)
+		}
+		length := int(word[31] / 2)
+		if length > 31 {
+			return fmt.Sprintf("0x%x", word)
+		}
+		if strings.HasPrefix(typ.Label, "string") {
+			return string(word[:length])
+		}
+		return fmt.Sprintf("0x%x", word[:length])
+	}
+	raw := word[32-offset-size : 32-offset]
+	label := typ.Label
+	switch {
+	case label == "bool":
+		return strconv.FormatBool(raw[len(raw)-1] != 0)
+	case label == "address" || label == "address payable" || strings.HasPrefix(label, "contract "):
+		return common.BytesToAddress(raw).Hex()
+	case strings.HasPrefix(label, "int"):
+		v := new(big.Int).SetBytes(raw)
+		if len(raw) > 0 && raw[0]&0x80 != 0 {
+			v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*len(raw))))
+		}
+		return v.String()
+	case strings.HasPrefix(label, "uint") || strings.HasPrefix(label, "enum "):
+		return new(big.Int).SetBytes(raw).String()
+	}
+	return fmt.Sprintf("0x%x", raw)
+}
@@ -0,0 +1,142 @@
+package apis
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// supplyCheckInterval is how many headers are walked between checks of the request context.
+const supplyCheckInterval = 10000
+
+func RegisterSupplyAPI(router *gin.RouterGroup, e *Env) error {
+	router.GET(":chain/:number", e.GetSupply)
+	return nil
+}
+
+// Supply is the ether issued up to and including a block, in wei. There are no burnt
+// fees before EIP-1559, which this tree does not implement.
+type Supply struct {
+	BlockNumber  uint64 `json:"blockNumber"`
+	Genesis      string `json:"genesis"`
+	BlockRewards string `json:"blockRewards"`
+	UncleRewards string `json:"uncleRewards"` // to the miners of the uncles, the inclusion rewards are block rewards
+	Total        string `json:"total"`
+	Uncles       uint64 `json:"uncles"`
+}
+
+func (e *Env) GetSupply(c *gin.Context) {
+	bn, err := strconv.ParseUint(c.Param("number"), 10, 64)
+	if err != nil {
+		abortWithError(c, fmt.Errorf("%w: invalid block number %s", ErrInvalidParam, c.Param("number")))
+		return
+	}
+	genesis := genesisByChain(c.Param("chain"))
+	if genesis == nil {
+		abortWithError(c, fmt.Errorf("%w %s: the supply is only known for the built-in chains", ErrUnknownChain, c.Param("chain")))
+		return
+	}
+	chainConfig, err := ReadChainConfig(e.KV, c.Param("chain"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result, err := ComputeSupply(c.Request.Context().Done(), chainConfig, genesis, bn, e.DB)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	render(c, http.StatusOK, result)
+}
+
+// genesisByChain returns the genesis of the chains ReadChainConfig knows.
+func genesisByChain(chain string) *core.Genesis {
+	switch chain {
+	case "mainnet":
+		return core.DefaultGenesisBlock()
+	case "testnet":
+		return core.DefaultRopstenGenesisBlock()
+	case "rinkeby":
+		return core.DefaultRinkebyGenesisBlock()
+	case "goerli":
+		return core.DefaultGoerliGenesisBlock()
+	}
+	return nil
+}
+
+// ComputeSupply adds the rewards of the ethash schedule to the genesis allocation, walking
+// the canonical headers up to the block. Clique chains issue nothing after the genesis.
+func ComputeSupply(quit <-chan struct{}, chainConfig *params.ChainConfig, genesis *core.Genesis, blockNumber uint64, db ethdb.Getter) (Supply, error) {
+	result := Supply{BlockNumber: blockNumber}
+	genesisAlloc, blockRewards, uncleRewards := new(big.Int), new(big.Int), new(big.Int)
+	for _, account := range genesis.Alloc {
+		genesisAlloc.Add(genesisAlloc, account.Balance)
+	}
+	if chainConfig.Ethash != nil {
+		for n := uint64(1); n <= blockNumber; n++ {
+			if n%supplyCheckInterval == 0 {
+				select {
+				case <-quit:
+					return Supply{}, fmt.Errorf("interrupted at block %d", n)
+				default:
+				}
+			}
+			hash := rawdb.ReadCanonicalHash(db, n)
+			header := rawdb.ReadHeader(db, hash, n)
+			if header == nil {
+				return Supply{}, fmt.Errorf("%w: %d", ErrBlockNotFound, n)
+			}
+			var uncles []*types.Header
+			if header.UncleHash != types.EmptyUncleHash {
+				body := rawdb.ReadBody(db, hash, n)
+				if body == nil {
+					return Supply{}, fmt.Errorf("body of block %d not found", n)
+				}
+				uncles = body.Uncles
+			}
+			reward, minerRewards := ethashRewards(chainConfig, header, uncles)
+			blockRewards.Add(blockRewards, reward)
+			uncleRewards.Add(uncleRewards, minerRewards)
+			result.Uncles += uint64(len(uncles))
+		}
+	} else if blockNumber > 0 && rawdb.ReadCanonicalHash(db, blockNumber) == (common.Hash{}) {
+		return Supply{}, fmt.Errorf("%w: %d", ErrBlockNotFound, blockNumber)
+	}
+	result.Genesis = genesisAlloc.String()
+	result.BlockRewards = blockRewards.String()
+	result.UncleRewards = uncleRewards.String()
+	result.Total = new(big.Int).Add(genesisAlloc, new(big.Int).Add(blockRewards, uncleRewards)).String()
+	return result, nil
+}
+
+// ethashRewards returns the reward of the miner of the block, including the inclusion of the
+// uncles, and the rewards of the miners of the uncles, as ethash accumulateRewards credits them.
+func ethashRewards(config *params.ChainConfig, header *types.Header, uncles []*types.Header) (reward, uncleRewards *big.Int) {
+	blockReward := ethash.FrontierBlockReward.ToBig()
+	if config.IsByzantium(header.Number) {
+		blockReward = ethash.ByzantiumBlockReward.ToBig()
+	}
+	if config.IsConstantinople(header.Number) {
+		blockReward = ethash.ConstantinopleBlockReward.ToBig()
+	}
+	reward, uncleRewards = new(big.Int).Set(blockReward), new(big.Int)
+	for _, uncle := range uncles {
+		r := new(big.Int).Add(uncle.Number, big.NewInt(8))
+		r.Sub(r, header.Number)
+		r.Mul(r, blockReward)
+		r.Div(r, big.NewInt(8))
+		uncleRewards.Add(uncleRewards, r)
+		reward.Add(reward, new(big.Int).Div(blockReward, big.NewInt(32)))
+	}
+	return reward, uncleRewards
+}
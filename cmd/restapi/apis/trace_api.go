@@ -0,0 +1,194 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+const (
+	defaultTraceSteps = 10000
+	maxTraceSteps     = 100000
+)
+
+func RegisterTraceAPI(router *gin.RouterGroup, e *Env) error {
+	router.Use(e.limitReplays)
+	router.GET(":chain/tx/:hash", e.GetTxTrace)
+	router.GET(":chain/tx/:hash/gas", e.GetTxGas)
+	router.GET(":chain/tx/:hash/access-list", e.GetTxAccessList)
+	router.GET(":chain/tx/:hash/storage-xref", e.GetTxStorageXref)
+	router.POST(":chain/:number/access-list", e.PostCallAccessList)
+	return nil
+}
+
+// TraceOptions select what is captured at every step, Steps bounds the number of steps.
+type TraceOptions struct {
+	Stack  bool
+	Memory bool
+	Steps  int
+}
+
+// TxTrace is the opcode trace of a transaction, in the structLog format of debug_traceTransaction.
+type TxTrace struct {
+	Hash        common.Hash `json:"hash"`
+	BlockNumber uint64      `json:"blockNumber"`
+	TxIndex     uint64      `json:"txIndex"`
+	Gas         uint64      `json:"gas"`
+	Failed      bool        `json:"failed"`
+	ReturnValue string      `json:"returnValue"`
+	StructLogs  []TraceStep `json:"structLogs"`
+	Truncated   bool        `json:"truncated"` // the step limit was hit
+	BlockFinality
+}
+
+type TraceStep struct {
+	Pc      uint64   `json:"pc"`
+	Op      string   `json:"op"`
+	Gas     uint64   `json:"gas"`
+	GasCost uint64   `json:"gasCost"`
+	Depth   int      `json:"depth"`
+	Error   string   `json:"error,omitempty"`
+	Stack   []string `json:"stack,omitempty"`
+	Memory  []string `json:"memory,omitempty"`
+}
+
+func (e *Env) GetTxTrace(c *gin.Context) {
+	opts := TraceOptions{Stack: c.Query("stack") != "false", Memory: c.Query("memory") == "true", Steps: defaultTraceSteps}
+	if s := c.Query("limit"); s != "" {
+		var err error
+		if opts.Steps, err = strconv.Atoi(s); err != nil || opts.Steps < 1 || opts.Steps > maxTraceSteps {
+			abortWithError(c, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidParam, maxTraceSteps))
+			return
+		}
+	}
+	hash := common.HexToHash(c.Param("hash"))
+	bn, index, bf, ok := e.lookupTx(c, hash)
+	if !ok {
+		return
+	}
+	result, err := TraceTx(c.Request.Context(), hash, bn, index, c.Param("chain"), e.KV, e.DB, opts)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result.BlockFinality = bf
+	render(c, http.StatusOK, result)
+}
+
+// lookupTx finds the block and index of the transaction and checks that the block is
+// confirmed enough, aborting the request otherwise.
+func (e *Env) lookupTx(c *gin.Context, hash common.Hash) (blockNumber, index uint64, bf BlockFinality, ok bool) {
+	tx, _, blockNumber, index := rawdb.ReadTransaction(e.DB, hash)
+	if tx == nil {
+		abortWithError(c, fmt.Errorf("%w: transaction %x", ErrEntityNotFound, hash))
+		return 0, 0, bf, false
+	}
+	bf, err := e.replayableBlock(blockNumber)
+	if err != nil {
+		abortWithError(c, err)
+		return 0, 0, bf, false
+	}
+	return blockNumber, index, bf, true
+}
+
+// TraceTx replays the transaction like RetraceTx, with a struct logger attached.
+func TraceTx(ctx context.Context, hash common.Hash, blockNumber, index uint64, chain string, kv ethdb.KV, db ethdb.Getter, opts TraceOptions) (TxTrace, error) {
+	logger := vm.NewStructLogger(&vm.LogConfig{
+		DisableStack:      !opts.Stack,
+		DisableMemory:     !opts.Memory,
+		DisableStorage:    true,
+		DisableReturnData: true,
+		Limit:             opts.Steps,
+	})
+	_, receipt, err := replayTx(ctx, hash, blockNumber, index, chain, kv, db, state.NewNoopWriter(), vm.Config{Debug: true, Tracer: logger})
+	if err != nil {
+		return TxTrace{}, err
+	}
+	logs := logger.StructLogs()
+	result := TxTrace{
+		Hash:        hash,
+		BlockNumber: blockNumber,
+		TxIndex:     index,
+		Gas:         receipt.GasUsed,
+		Failed:      receipt.Status == types.ReceiptStatusFailed,
+		ReturnValue: fmt.Sprintf("%x", logger.Output()),
+		StructLogs:  make([]TraceStep, len(logs)),
+		Truncated:   len(logs) == opts.Steps,
+	}
+	for i, l := range logs {
+		step := TraceStep{Pc: l.Pc, Op: l.Op.String(), Gas: l.Gas, GasCost: l.GasCost, Depth: l.Depth}
+		if l.Err != nil {
+			step.Error = l.Err.Error()
+		}
+		if l.Stack != nil {
+			step.Stack = make([]string, len(l.Stack))
+			for j, v := range l.Stack {
+				step.Stack[j] = hexutil.EncodeBig(v)
+			}
+		}
+		// memory in words, as debug_traceTransaction does
+		for j := 0; j+32 <= len(l.Memory); j += 32 {
+			step.Memory = append(step.Memory, fmt.Sprintf("%x", l.Memory[j:j+32]))
+		}
+		result.StructLogs[i] = step
+	}
+	return result, nil
+}
+
+// GasBreakdown is the gas used by a transaction by category, see gasTracer. Intrinsic is
+// the gas charged before execution and Refund what was given back after, so that
+// GasUsed = Intrinsic + sum(Categories) - Refund.
+type GasBreakdown struct {
+	Hash        common.Hash       `json:"hash"`
+	BlockNumber uint64            `json:"blockNumber"`
+	TxIndex     uint64            `json:"txIndex"`
+	GasUsed     uint64            `json:"gasUsed"`
+	Failed      bool              `json:"failed"`
+	Intrinsic   uint64            `json:"intrinsic"`
+	Refund      uint64            `json:"refund"`
+	Categories  map[string]uint64 `json:"categories"`
+}
+
+type TxGas struct {
+	GasBreakdown
+	BlockFinality
+}
+
+func (e *Env) GetTxGas(c *gin.Context) {
+	hash := common.HexToHash(c.Param("hash"))
+	bn, index, bf, ok := e.lookupTx(c, hash)
+	if !ok {
+		return
+	}
+	result, err := TraceTxGas(c.Request.Context(), hash, bn, index, c.Param("chain"), e.KV, e.DB)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	result.BlockFinality = bf
+	render(c, http.StatusOK, result)
+}
+
+// TraceTxGas replays the transaction like RetraceTx, accounting its gas by category.
+func TraceTxGas(ctx context.Context, hash common.Hash, blockNumber, index uint64, chain string, kv ethdb.KV, db ethdb.Getter) (TxGas, error) {
+	tracer := newGasTracer()
+	_, receipt, err := replayTx(ctx, hash, blockNumber, index, chain, kv, db, state.NewNoopWriter(), vm.Config{Debug: true, Tracer: tracer})
+	if err != nil {
+		return TxGas{}, err
+	}
+	tx, _, _, _ := rawdb.ReadTransaction(db, hash)
+	if tx == nil {
+		return TxGas{}, fmt.Errorf("transaction %x not found", hash)
+	}
+	return TxGas{GasBreakdown: tracer.breakdown(tx, receipt, blockNumber, index)}, nil
+}
@@ -0,0 +1,171 @@
+package apis
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// WarmupConfig limits how much is pre-loaded by Warmup.
+type WarmupConfig struct {
+	Blocks             uint64 // recent blocks whose headers, bodies and touched accounts are read
+	HotContracts       int    // most called contracts of the recent blocks whose code is read and analysed
+	IntermediateHashes int    // entries of the intermediate hash bucket read from its start
+}
+
+var DefaultWarmupConfig = WarmupConfig{
+	Blocks:             256,
+	HotContracts:       100,
+	IntermediateHashes: 100000,
+}
+
+// WarmupResult tells what was loaded and how long it took.
+type WarmupResult struct {
+	Head               uint64 `json:"head"`
+	Headers            int    `json:"headers"`
+	Accounts           int    `json:"accounts"`
+	Contracts          int    `json:"contracts"`
+	IntermediateHashes int    `json:"intermediateHashes"`
+	Millis             int64  `json:"millis"`
+}
+
+func RegisterWarmupAPI(router *gin.RouterGroup, e *Env) error {
+	router.POST("/", requireAdmin, e.PostWarmup)
+	return nil
+}
+
+// PostWarmup runs a warmup with the defaults, overridden by the blocks, contracts and ih query parameters.
+func (e *Env) PostWarmup(c *gin.Context) {
+	config := DefaultWarmupConfig
+	for param, set := range map[string]func(uint64){
+		"blocks":    func(v uint64) { config.Blocks = v },
+		"contracts": func(v uint64) { config.HotContracts = int(v) },
+		"ih":        func(v uint64) { config.IntermediateHashes = int(v) },
+	} {
+		if s := c.Query(param); s != "" {
+			v, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": param + ": " + err.Error()})
+				return
+			}
+			set(v)
+		}
+	}
+	result, err := Warmup(c.Request.Context(), e, config)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err) //nolint:errcheck
+		return
+	}
+	render(c, http.StatusOK, result)
+}
+
+// Warmup reads the data the first requests after a restart typically need, so that it is
+// in the page cache of the database (local or behind the remote KV) and in the caches of
+// the API: canonical headers and bodies of recent blocks, the accounts they changed, the
+// top of the intermediate hash trie, and the code of the most called contracts, whose CFGs
+// are put into the analysis cache.
+func Warmup(ctx context.Context, e *Env, config WarmupConfig) (WarmupResult, error) {
+	start := time.Now()
+	var result WarmupResult
+	calls := make(map[common.Address]int)
+	err := e.KV.View(ctx, func(tx ethdb.Tx) error {
+		head, err := headTx(tx)
+		if err != nil {
+			return err
+		}
+		result.Head = head
+		getter := txGetter{tx}
+		from := uint64(0)
+		if head > config.Blocks {
+			from = head - config.Blocks
+		}
+		touched := make(map[common.Address]struct{})
+		for n := head; n > from; n-- {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			hash := rawdb.ReadCanonicalHash(getter, n)
+			if rawdb.ReadHeader(getter, hash, n) == nil {
+				continue
+			}
+			result.Headers++
+			if body := rawdb.ReadBody(getter, hash, n); body != nil {
+				for _, txn := range body.Transactions {
+					if to := txn.To(); to != nil {
+						calls[*to]++
+					}
+				}
+			}
+			v, err := tx.Get(dbutils.PlainAccountChangeSetBucket, dbutils.EncodeTimestamp(n))
+			if err != nil {
+				return err
+			}
+			if err := changeset.AccountChangeSetPlainBytes(v).Walk(func(k, _ []byte) error {
+				touched[common.BytesToAddress(k)] = struct{}{}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		for address := range touched {
+			if _, err := readAccountTx(tx, address, head); err != nil {
+				return err
+			}
+			result.Accounts++
+		}
+
+		c := tx.Cursor(dbutils.IntermediateTrieHashBucket)
+		for k, _, err := c.First(); k != nil && result.IntermediateHashes < config.IntermediateHashes; k, _, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			result.IntermediateHashes++
+		}
+
+		hot := make([]common.Address, 0, len(calls))
+		for address := range calls {
+			hot = append(hot, address)
+		}
+		sort.Slice(hot, func(i, j int) bool { return calls[hot[i]] > calls[hot[j]] })
+		if len(hot) > config.HotContracts {
+			hot = hot[:config.HotContracts]
+		}
+		var rules params.Rules
+		if chainConfig := rawdb.ReadChainConfig(getter, rawdb.ReadCanonicalHash(getter, 0)); chainConfig != nil {
+			rules = chainConfig.Rules(new(big.Int).SetUint64(head))
+		}
+		for _, address := range hot {
+			codeHash, code, err := readCodeTx(tx, address, head)
+			if err != nil {
+				return err
+			}
+			if len(code) == 0 {
+				continue
+			}
+			result.Contracts++
+			if e.AnalysisCache != nil && !e.AnalysisCache.Contains(analysisKey{codeHash, vm.ForkName(rules)}) {
+				e.analyse(address, codeHash, code, rules)
+			}
+		}
+		return nil
+	})
+	result.Millis = int64(time.Since(start) / time.Millisecond)
+	if err == nil {
+		log.Info("Warmup done", "head", result.Head, "headers", result.Headers, "accounts", result.Accounts,
+			"contracts", result.Contracts, "ih", result.IntermediateHashes, "duration", time.Since(start))
+	}
+	return result, err
+}
@@ -0,0 +1,90 @@
+// Package client is a Go client of the restapi. Its methods are generated from
+// apis.Operations, run go generate after changing them.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/restapi/apis"
+)
+
+//go:generate go run ./internal/gen.go
+
+// Client calls the routes under URL, the api/v1 root of a server, e.g. http://localhost:8080/api/v1.
+type Client struct {
+	URL   string
+	HTTP  *http.Client
+	Token string // API key or JWT sent as bearer token, if the server requires authentication
+}
+
+func New(url string) *Client {
+	return &Client{URL: strings.TrimSuffix(url, "/"), HTTP: http.DefaultClient}
+}
+
+// Error is a response with a status other than 2xx. Code is that of apis.ErrorResponse,
+// empty for errors without one.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("restapi: %d %s", e.StatusCode, e.Message)
+}
+
+// do sends the request and decodes the response into result, if not nil. A body which is an
+// io.Reader is sent as is, any other is encoded to JSON.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, result interface{}) error {
+	u := c.URL + "/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		reader, contentType = b, "text/plain"
+	default:
+		enc, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		reader, contentType = bytes.NewReader(enc), "application/json"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var msg apis.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&msg) != nil || msg.Message == "" {
+			msg.Message = http.StatusText(resp.StatusCode)
+		}
+		return &Error{StatusCode: resp.StatusCode, Code: msg.Code, Message: msg.Message}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,314 @@
+// Code generated by go generate; DO NOT EDIT.
+package client
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/restapi/apis"
+)
+
+// GetRemoteDB calls GET private-api/: Address of the remote database.
+func (c *Client) GetRemoteDB(ctx context.Context, query url.Values) (map[string]string, error) {
+	var result map[string]string
+	err := c.do(ctx, "GET", "private-api/", query, nil, &result)
+	return result, err
+}
+
+// SetRemoteDB calls POST private-api/: Switch to another remote database.
+func (c *Client) SetRemoteDB(ctx context.Context, query url.Values) error {
+	return c.do(ctx, "POST", "private-api/", query, nil, nil)
+}
+
+// GetAccount calls GET accounts/:accountID: Account by address or hashed address.
+func (c *Client) GetAccount(ctx context.Context, accountID string, query url.Values) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := c.do(ctx, "GET", "accounts/"+url.PathEscape(accountID), query, nil, &result)
+	return result, err
+}
+
+// FindStorage calls GET storage/: Storage entries by key prefix.
+func (c *Client) FindStorage(ctx context.Context, query url.Values) ([]*apis.StorageResponse, error) {
+	var result []*apis.StorageResponse
+	err := c.do(ctx, "GET", "storage/", query, nil, &result)
+	return result, err
+}
+
+// DecodeStorage calls POST storage/decode: Variables of a contract from a solc storage layout.
+func (c *Client) DecodeStorage(ctx context.Context, body apis.DecodeStorageRequest, query url.Values) (apis.DecodeStorageResponse, error) {
+	var result apis.DecodeStorageResponse
+	err := c.do(ctx, "POST", "storage/decode", query, body, &result)
+	return result, err
+}
+
+// Retrace calls GET retrace/:chain/:number: Accounts and storage read and written by a block, ?format=parity gives OpenEthereum state diffs instead.
+func (c *Client) Retrace(ctx context.Context, chain string, number string, query url.Values) (apis.RetraceResponse, error) {
+	var result apis.RetraceResponse
+	err := c.do(ctx, "GET", "retrace/"+url.PathEscape(chain)+"/"+url.PathEscape(number), query, nil, &result)
+	return result, err
+}
+
+// RetraceRange calls GET retrace/:chain/:from/:to: Accounts and storage read and written by the blocks from..to.
+func (c *Client) RetraceRange(ctx context.Context, chain string, from string, to string, query url.Values) (apis.RetraceRangeResponse, error) {
+	var result apis.RetraceRangeResponse
+	err := c.do(ctx, "GET", "retrace/"+url.PathEscape(chain)+"/"+url.PathEscape(from)+"/"+url.PathEscape(to), query, nil, &result)
+	return result, err
+}
+
+// RetraceBatch calls POST retrace/:chain: Retraces of blocks and transactions, one line each with Accept: application/x-ndjson.
+func (c *Client) RetraceBatch(ctx context.Context, chain string, body []apis.RetraceBatchItem, query url.Values) (apis.RetraceBatchResponse, error) {
+	var result apis.RetraceBatchResponse
+	err := c.do(ctx, "POST", "retrace/"+url.PathEscape(chain), query, body, &result)
+	return result, err
+}
+
+// RetraceWitness calls GET retrace/:chain/:number/witness: Witness of the state read and written by a block, for stateless clients.
+func (c *Client) RetraceWitness(ctx context.Context, chain string, number string, query url.Values) (apis.BlockWitnessResponse, error) {
+	var result apis.BlockWitnessResponse
+	err := c.do(ctx, "GET", "retrace/"+url.PathEscape(chain)+"/"+url.PathEscape(number)+"/witness", query, nil, &result)
+	return result, err
+}
+
+// RetraceTx calls GET retrace/:chain/tx/:hash: Accounts and storage read and written by a transaction.
+func (c *Client) RetraceTx(ctx context.Context, chain string, hash string, query url.Values) (apis.RetraceTxResponse, error) {
+	var result apis.RetraceTxResponse
+	err := c.do(ctx, "GET", "retrace/"+url.PathEscape(chain)+"/tx/"+url.PathEscape(hash), query, nil, &result)
+	return result, err
+}
+
+// TraceTx calls GET trace/:chain/tx/:hash: Opcode trace of a transaction.
+func (c *Client) TraceTx(ctx context.Context, chain string, hash string, query url.Values) (apis.TxTrace, error) {
+	var result apis.TxTrace
+	err := c.do(ctx, "GET", "trace/"+url.PathEscape(chain)+"/tx/"+url.PathEscape(hash), query, nil, &result)
+	return result, err
+}
+
+// TraceTxGas calls GET trace/:chain/tx/:hash/gas: Gas of a transaction by category.
+func (c *Client) TraceTxGas(ctx context.Context, chain string, hash string, query url.Values) (apis.TxGas, error) {
+	var result apis.TxGas
+	err := c.do(ctx, "GET", "trace/"+url.PathEscape(chain)+"/tx/"+url.PathEscape(hash)+"/gas", query, nil, &result)
+	return result, err
+}
+
+// TxAccessList calls GET trace/:chain/tx/:hash/access-list: Access list of a transaction.
+func (c *Client) TxAccessList(ctx context.Context, chain string, hash string, query url.Values) (apis.AccessListResponse, error) {
+	var result apis.AccessListResponse
+	err := c.do(ctx, "GET", "trace/"+url.PathEscape(chain)+"/tx/"+url.PathEscape(hash)+"/access-list", query, nil, &result)
+	return result, err
+}
+
+// TxStorageXref calls GET trace/:chain/tx/:hash/storage-xref: Storage accesses of a transaction against those predicted by the analysis.
+func (c *Client) TxStorageXref(ctx context.Context, chain string, hash string, query url.Values) (apis.StorageXrefResponse, error) {
+	var result apis.StorageXrefResponse
+	err := c.do(ctx, "GET", "trace/"+url.PathEscape(chain)+"/tx/"+url.PathEscape(hash)+"/storage-xref", query, nil, &result)
+	return result, err
+}
+
+// CallAccessList calls POST trace/:chain/:number/access-list: Access list of a call at the start of a block.
+func (c *Client) CallAccessList(ctx context.Context, chain string, number string, body apis.AccessListCall, query url.Values) (apis.AccessListResponse, error) {
+	var result apis.AccessListResponse
+	err := c.do(ctx, "POST", "trace/"+url.PathEscape(chain)+"/"+url.PathEscape(number)+"/access-list", query, body, &result)
+	return result, err
+}
+
+// Receipts calls GET receipts/:chain/:number: Receipts of a block.
+func (c *Client) Receipts(ctx context.Context, chain string, number string, query url.Values) (apis.ReceiptsResponse, error) {
+	var result apis.ReceiptsResponse
+	err := c.do(ctx, "GET", "receipts/"+url.PathEscape(chain)+"/"+url.PathEscape(number), query, nil, &result)
+	return result, err
+}
+
+// AccountHistory calls GET history/:chain/account/:address: Blocks changing an account.
+func (c *Client) AccountHistory(ctx context.Context, chain string, address string, query url.Values) (apis.AccountHistory, error) {
+	var result apis.AccountHistory
+	err := c.do(ctx, "GET", "history/"+url.PathEscape(chain)+"/account/"+url.PathEscape(address), query, nil, &result)
+	return result, err
+}
+
+// StorageHistory calls GET history/:chain/storage/:address/:slot: Blocks changing a storage slot.
+func (c *Client) StorageHistory(ctx context.Context, chain string, address string, slot string, query url.Values) (apis.StorageHistory, error) {
+	var result apis.StorageHistory
+	err := c.do(ctx, "GET", "history/"+url.PathEscape(chain)+"/storage/"+url.PathEscape(address)+"/"+url.PathEscape(slot), query, nil, &result)
+	return result, err
+}
+
+// LogHistory calls GET history/:chain/logs/:address: Logs of an address, from the log index.
+func (c *Client) LogHistory(ctx context.Context, chain string, address string, query url.Values) (apis.LogHistory, error) {
+	var result apis.LogHistory
+	err := c.do(ctx, "GET", "history/"+url.PathEscape(chain)+"/logs/"+url.PathEscape(address), query, nil, &result)
+	return result, err
+}
+
+// AccountState calls GET state/:chain/:number/account/:address: Account after a block.
+func (c *Client) AccountState(ctx context.Context, chain string, number string, address string, query url.Values) (apis.AccountState, error) {
+	var result apis.AccountState
+	err := c.do(ctx, "GET", "state/"+url.PathEscape(chain)+"/"+url.PathEscape(number)+"/account/"+url.PathEscape(address), query, nil, &result)
+	return result, err
+}
+
+// Supply calls GET supply/:chain/:number: Ether issued up to a block.
+func (c *Client) Supply(ctx context.Context, chain string, number string, query url.Values) (apis.Supply, error) {
+	var result apis.Supply
+	err := c.do(ctx, "GET", "supply/"+url.PathEscape(chain)+"/"+url.PathEscape(number), query, nil, &result)
+	return result, err
+}
+
+// Rewards calls GET rewards/:chain/:number: Rewards and fees of a block.
+func (c *Client) Rewards(ctx context.Context, chain string, number string, query url.Values) (apis.BlockRewards, error) {
+	var result apis.BlockRewards
+	err := c.do(ctx, "GET", "rewards/"+url.PathEscape(chain)+"/"+url.PathEscape(number), query, nil, &result)
+	return result, err
+}
+
+// FindIntermediateHash calls GET intermediate-hash/: Intermediate hashes by prefix.
+func (c *Client) FindIntermediateHash(ctx context.Context, query url.Values) ([]*apis.IntermediateHashResponse, error) {
+	var result []*apis.IntermediateHashResponse
+	err := c.do(ctx, "GET", "intermediate-hash/", query, nil, &result)
+	return result, err
+}
+
+// IntermediateHashNode calls GET intermediate-hash/node/:prefix: Intermediate hash of a node.
+func (c *Client) IntermediateHashNode(ctx context.Context, prefix string, query url.Values) (apis.IntermediateHashResponse, error) {
+	var result apis.IntermediateHashResponse
+	err := c.do(ctx, "GET", "intermediate-hash/node/"+url.PathEscape(prefix), query, nil, &result)
+	return result, err
+}
+
+// VerifyStateRoot calls GET intermediate-hash/root: State root computed from the intermediate hashes.
+func (c *Client) VerifyStateRoot(ctx context.Context, query url.Values) (apis.StateRootResponse, error) {
+	var result apis.StateRootResponse
+	err := c.do(ctx, "GET", "intermediate-hash/root", query, nil, &result)
+	return result, err
+}
+
+// BucketSizes calls GET db/buckets-stat: Size of every bucket.
+func (c *Client) BucketSizes(ctx context.Context, query url.Values) (map[string]map[string]float64, error) {
+	var result map[string]map[string]float64
+	err := c.do(ctx, "GET", "db/buckets-stat", query, nil, &result)
+	return result, err
+}
+
+// DBSize calls GET db/size: Size of the database on disk.
+func (c *Client) DBSize(ctx context.Context, query url.Values) (uint64, error) {
+	var result uint64
+	err := c.do(ctx, "GET", "db/size", query, nil, &result)
+	return result, err
+}
+
+// BucketStats calls GET db/buckets: Entries and B-tree statistics of every bucket.
+func (c *Client) BucketStats(ctx context.Context, query url.Values) (map[string]*apis.BucketStats, error) {
+	var result map[string]*apis.BucketStats
+	err := c.do(ctx, "GET", "db/buckets", query, nil, &result)
+	return result, err
+}
+
+// DBGrowth calls GET db/growth: Growth of the database and forecast of the disk full.
+func (c *Client) DBGrowth(ctx context.Context, query url.Values) (apis.DBGrowth, error) {
+	var result apis.DBGrowth
+	err := c.do(ctx, "GET", "db/growth", query, nil, &result)
+	return result, err
+}
+
+// Selector calls GET selectors/:selector: Text signatures of a function selector.
+func (c *Client) Selector(ctx context.Context, selector string, query url.Values) (apis.SelectorResponse, error) {
+	var result apis.SelectorResponse
+	err := c.do(ctx, "GET", "selectors/"+url.PathEscape(selector), query, nil, &result)
+	return result, err
+}
+
+// AddSelectors calls POST selectors/: Add text signatures.
+func (c *Client) AddSelectors(ctx context.Context, body []string, query url.Values) (apis.SelectorsAdded, error) {
+	var result apis.SelectorsAdded
+	err := c.do(ctx, "POST", "selectors/", query, body, &result)
+	return result, err
+}
+
+// ImportSelectors calls POST selectors/import: Import a dump with one signature, optionally preceded by its selector, per line.
+func (c *Client) ImportSelectors(ctx context.Context, body io.Reader, query url.Values) (apis.SelectorsAdded, error) {
+	var result apis.SelectorsAdded
+	err := c.do(ctx, "POST", "selectors/import", query, body, &result)
+	return result, err
+}
+
+// Finality calls GET finality/: Head, confirmations required and finalized block.
+func (c *Client) Finality(ctx context.Context, query url.Values) (map[string]uint64, error) {
+	var result map[string]uint64
+	err := c.do(ctx, "GET", "finality/", query, nil, &result)
+	return result, err
+}
+
+// SetFinalized calls POST finality/: Set the finalized block.
+func (c *Client) SetFinalized(ctx context.Context, query url.Values) error {
+	return c.do(ctx, "POST", "finality/", query, nil, nil)
+}
+
+// BatchRead calls POST batch/: Several reads in one database transaction.
+func (c *Client) BatchRead(ctx context.Context, body apis.BatchReadRequest, query url.Values) (apis.BatchReadResponse, error) {
+	var result apis.BatchReadResponse
+	err := c.do(ctx, "POST", "batch/", query, body, &result)
+	return result, err
+}
+
+// AnalysisStats calls GET analysis-stats: Cost of the analyses since startup.
+func (c *Client) AnalysisStats(ctx context.Context, query url.Values) (*apis.AnalysisStats, error) {
+	var result *apis.AnalysisStats
+	err := c.do(ctx, "GET", "analysis-stats", query, nil, &result)
+	return result, err
+}
+
+// Analysis calls GET analysis/:chain/:address: Static analysis of a contract.
+func (c *Client) Analysis(ctx context.Context, chain string, address string, query url.Values) (apis.AnalysisResponse, error) {
+	var result apis.AnalysisResponse
+	err := c.do(ctx, "GET", "analysis/"+url.PathEscape(chain)+"/"+url.PathEscape(address), query, nil, &result)
+	return result, err
+}
+
+// ProtocolAnalysis calls GET analysis/:chain/:address/protocol: Analysis of the contracts called by a contract.
+func (c *Client) ProtocolAnalysis(ctx context.Context, chain string, address string, query url.Values) (apis.ProtocolAnalysis, error) {
+	var result apis.ProtocolAnalysis
+	err := c.do(ctx, "GET", "analysis/"+url.PathEscape(chain)+"/"+url.PathEscape(address)+"/protocol", query, nil, &result)
+	return result, err
+}
+
+// Decompile calls GET analysis/:chain/:address/decompile: Pseudo-Yul of the public functions of a contract.
+func (c *Client) Decompile(ctx context.Context, chain string, address string, query url.Values) (apis.Decompiled, error) {
+	var result apis.Decompiled
+	err := c.do(ctx, "GET", "analysis/"+url.PathEscape(chain)+"/"+url.PathEscape(address)+"/decompile", query, nil, &result)
+	return result, err
+}
+
+// JumpCheck calls GET analysis/:chain/:address/jumps/:number: Jumps taken by a contract in replayed blocks checked against its CFG.
+func (c *Client) JumpCheck(ctx context.Context, chain string, address string, number string, query url.Values) (apis.JumpCheckResponse, error) {
+	var result apis.JumpCheckResponse
+	err := c.do(ctx, "GET", "analysis/"+url.PathEscape(chain)+"/"+url.PathEscape(address)+"/jumps/"+url.PathEscape(number), query, nil, &result)
+	return result, err
+}
+
+// Warmup calls POST warmup/: Read what the first requests after a restart need.
+func (c *Client) Warmup(ctx context.Context, query url.Values) (apis.WarmupResult, error) {
+	var result apis.WarmupResult
+	err := c.do(ctx, "POST", "warmup/", query, nil, &result)
+	return result, err
+}
+
+// Chains calls GET chains/: Chains the :chain segment may name.
+func (c *Client) Chains(ctx context.Context, query url.Values) ([]apis.Chain, error) {
+	var result []apis.Chain
+	err := c.do(ctx, "GET", "chains/", query, nil, &result)
+	return result, err
+}
+
+// RegisterChain calls POST chains/: Register a chain by genesis hash or config.
+func (c *Client) RegisterChain(ctx context.Context, body apis.Chain, query url.Values) (map[string]string, error) {
+	var result map[string]string
+	err := c.do(ctx, "POST", "chains/", query, body, &result)
+	return result, err
+}
+
+// Capabilities calls GET capabilities/: Optional subsystems of the deployment.
+func (c *Client) Capabilities(ctx context.Context, query url.Values) (apis.Capabilities, error) {
+	var result apis.Capabilities
+	err := c.do(ctx, "GET", "capabilities/", query, nil, &result)
+	return result, err
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/restapi/apis"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// TestGenerated checks that the client is generated from the current operations.
+func TestGenerated(t *testing.T) {
+	typ := reflect.TypeOf(&Client{})
+	for _, op := range apis.Operations {
+		_, ok := typ.MethodByName(op.ID)
+		assert.True(t, ok, "no method %s, run go generate", op.ID)
+	}
+}
+
+func TestClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	(&core.Genesis{Config: params.TestChainConfig}).MustCommit(db)
+	require.NoError(t, stages.SaveStageProgress(db, stages.Execution, 3, nil))
+	chain, err := apis.DetectChain(db.KV())
+	require.NoError(t, err)
+	e := &apis.Env{KV: db.KV(), DB: db, Chain: chain, Selectors: apis.NewSelectorDB(), Finality: apis.NewFinality(0)}
+
+	r := gin.New()
+	root := r.Group("api/v1")
+	root.Use(apis.NewAuth(map[string]apis.Scope{"reader": apis.ScopeRead, "admin": apis.ScopeAdmin}, nil).Middleware())
+	require.NoError(t, apis.RegisterRoutes(root, e))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := New(srv.URL + "/api/v1/")
+	_, err = c.Finality(ctx, nil)
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr), "%v", err)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+
+	c.Token = "reader"
+	finality, err := c.Finality(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), finality["head"])
+	err = c.SetFinalized(ctx, url.Values{"number": {"2"}})
+	require.True(t, errors.As(err, &apiErr), "%v", err)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+
+	c.Token = "admin"
+	require.NoError(t, c.SetFinalized(ctx, url.Values{"number": {"2"}}))
+	finality, err = c.Finality(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), finality["finalized"])
+
+	// the message of errors is decoded
+	err = c.SetFinalized(ctx, url.Values{"number": {"x"}})
+	require.True(t, errors.As(err, &apiErr), "%v", err)
+	assert.Equal(t, Error{StatusCode: http.StatusBadRequest, Message: "invalid block number"}, *apiErr)
+	// and the code of typed errors
+	_, err = c.Retrace(ctx, chain, "4", nil)
+	require.True(t, errors.As(err, &apiErr), "%v", err)
+	assert.Equal(t, Error{StatusCode: http.StatusNotFound, Code: "block_not_found", Message: apiErr.Message}, *apiErr)
+	assert.NotEmpty(t, apiErr.Message)
+}
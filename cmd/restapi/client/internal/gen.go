@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/restapi/apis"
+)
+
+type method struct {
+	apis.Operation
+	PathParams []string
+	PathExpr   string
+	BodyType   string
+	ResultType string
+}
+
+var methodTemplate = template.Must(template.New("method").Parse(`
+// {{.ID}} calls {{.Method}} {{.Path}}: {{.Summary}}.
+func (c *Client) {{.ID}}(ctx context.Context, {{range .PathParams}}{{.}} string, {{end}}{{if .BodyType}}body {{.BodyType}}, {{end}}query url.Values) {{if .ResultType}}({{.ResultType}}, error){{else}}error{{end}} {
+{{- if .ResultType}}
+	var result {{.ResultType}}
+	err := c.do(ctx, "{{.Method}}", {{.PathExpr}}, query, {{if .BodyType}}body{{else}}nil{{end}}, &result)
+	return result, err
+{{- else}}
+	return c.do(ctx, "{{.Method}}", {{.PathExpr}}, query, {{if .BodyType}}body{{else}}nil{{end}}, nil)
+{{- end}}
+}
+`))
+
+func main() {
+	imports := map[string]bool{"context": true, "net/url": true}
+	var methods []method
+	for _, op := range apis.Operations {
+		m := method{Operation: op}
+		// static segments are joined into literals, parameters escaped in between
+		var parts []string
+		static := ""
+		for i, seg := range strings.Split(op.Path, "/") {
+			if i > 0 {
+				static += "/"
+			}
+			if !strings.HasPrefix(seg, ":") {
+				static += seg
+				continue
+			}
+			if static != "" {
+				parts = append(parts, fmt.Sprintf("%q", static))
+			}
+			m.PathParams = append(m.PathParams, seg[1:])
+			parts = append(parts, "url.PathEscape("+seg[1:]+")")
+			static = ""
+		}
+		if static != "" {
+			parts = append(parts, fmt.Sprintf("%q", static))
+		}
+		m.PathExpr = strings.Join(parts, "+")
+		switch {
+		case op.Body != nil:
+			m.BodyType = typeName(reflect.TypeOf(op.Body), imports)
+		case op.RawBody != "":
+			m.BodyType = "io.Reader"
+			imports["io"] = true
+		}
+		if op.Response != nil {
+			m.ResultType = typeName(reflect.TypeOf(op.Response), imports)
+		}
+		if op.Method != http.MethodGet && op.Method != http.MethodPost {
+			panic("unsupported method " + op.Method)
+		}
+		methods = append(methods, m)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "// Code generated by go generate; DO NOT EDIT.\npackage client\n\nimport (\n")
+	// the standard library first, as goimports groups them
+	var std, other []string
+	for path := range imports {
+		if strings.Contains(path, ".") {
+			other = append(other, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	for _, path := range std {
+		fmt.Fprintf(buf, "\t%q\n", path)
+	}
+	buf.WriteString("\n")
+	for _, path := range other {
+		fmt.Fprintf(buf, "\t%q\n", path)
+	}
+	fmt.Fprintf(buf, ")\n")
+	for _, m := range methods {
+		if err := methodTemplate.Execute(buf, m); err != nil {
+			panic(err)
+		}
+	}
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	if err := ioutil.WriteFile("client_gen.go", b, 0644); err != nil {
+		panic(err)
+	}
+}
+
+// typeName returns the Go name of the type as used in the client and adds the packages of
+// the named types it is made of to the imports.
+func typeName(t reflect.Type, imports map[string]bool) string {
+	for e := t; ; e = e.Elem() {
+		if e.PkgPath() != "" {
+			imports[e.PkgPath()] = true
+		}
+		if k := e.Kind(); k != reflect.Ptr && k != reflect.Slice && k != reflect.Array && k != reflect.Map {
+			break
+		}
+		if e.Kind() == reflect.Map && e.Key().PkgPath() != "" {
+			imports[e.Key().PkgPath()] = true
+		}
+	}
+	return t.String()
+}
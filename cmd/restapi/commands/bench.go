@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchURL      string
+	benchPaths    []string
+	benchRounds   int
+	benchWarmup   bool
+	benchWarmupQS string
+)
+
+func init() {
+	benchCmd.Flags().StringVar(&benchURL, "url", "http://127.0.0.1:8080", "base URL of a running restapi")
+	benchCmd.Flags().StringSliceVar(&benchPaths, "path", nil, "request path to measure, e.g. /api/v1/accounts/0x..., can be repeated")
+	benchCmd.Flags().IntVar(&benchRounds, "rounds", 20, "number of times every path is requested")
+	benchCmd.Flags().BoolVar(&benchWarmup, "warmup", true, "call the warmup endpoint after the first measurement and measure again")
+	benchCmd.Flags().StringVar(&benchWarmupQS, "warmup.query", "", "query string passed to the warmup endpoint, e.g. blocks=1024&contracts=500")
+	rootCmd.AddCommand(benchCmd)
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measures request latencies of a freshly started restapi before and after warmup",
+	Long: `Start restapi without --warmup, then run bench against it. The first measurement
+shows the cold start latencies, the second one the latencies after POST /api/v1/warmup/.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(benchPaths) == 0 {
+			return fmt.Errorf("at least one --path is required")
+		}
+		client := &http.Client{Timeout: time.Minute}
+		before, err := measureLatencies(client)
+		if err != nil {
+			return err
+		}
+		printLatencies("cold", before)
+		if !benchWarmup {
+			return nil
+		}
+		start := time.Now()
+		resp, err := client.Post(strings.TrimRight(benchURL, "/")+"/api/v1/warmup/?"+benchWarmupQS, "application/json", nil)
+		if err != nil {
+			return err
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("warmup failed: %s %s", resp.Status, body)
+		}
+		fmt.Printf("warmup took %s: %s\n", time.Since(start), strings.TrimSpace(string(body)))
+		after, err := measureLatencies(client)
+		if err != nil {
+			return err
+		}
+		printLatencies("warm", after)
+		return nil
+	},
+}
+
+// measureLatencies requests all paths round by round, so the first round sees a cold server.
+func measureLatencies(client *http.Client) ([]time.Duration, error) {
+	latencies := make([]time.Duration, 0, benchRounds*len(benchPaths))
+	for i := 0; i < benchRounds; i++ {
+		for _, path := range benchPaths {
+			start := time.Now()
+			resp, err := client.Get(strings.TrimRight(benchURL, "/") + path)
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			latencies = append(latencies, time.Since(start))
+		}
+	}
+	return latencies, nil
+}
+
+func printLatencies(name string, latencies []time.Duration) {
+	fmt.Printf("%s: %d requests, p50 %s, p90 %s, p99 %s, max %s\n",
+		name, len(latencies), percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99), percentile(latencies, 1))
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/naoina/toml"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the environment variables setting flags, RESTAPI_HTTP_ADDR sets --http.addr.
+const envPrefix = "RESTAPI_"
+
+var (
+	configFile string
+	logFormat  string
+	logLevel   string
+)
+
+func init() {
+	rootCmd.Flags().StringVar(&configFile, "config", "", "path to a TOML file setting flags by name, like addr = \"0.0.0.0:8080\" in the table [http]; flags and RESTAPI_* environment variables take precedence")
+	rootCmd.Flags().StringVar(&logFormat, "log.format", "terminal", "format of the logs: terminal, logfmt or json, one object per line")
+	rootCmd.Flags().StringVar(&logLevel, "log.level", "info", "least severe level logged: trace, debug, info, warn, error or crit")
+}
+
+// envName returns the environment variable setting a flag.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flag))
+}
+
+// loadConfig sets the flags not given on the command line from the environment, or else from
+// the config file.
+func loadConfig(flags *pflag.FlagSet) error {
+	var fromFile map[string]string
+	if configFile != "" {
+		var err error
+		if fromFile, err = readConfigFile(configFile); err != nil {
+			return err
+		}
+		for name := range fromFile {
+			if name == "config" || flags.Lookup(name) == nil {
+				return fmt.Errorf("%s: unknown setting %q", configFile, name)
+			}
+		}
+	}
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "config" {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		source := envName(f.Name)
+		if !ok {
+			value, ok = fromFile[f.Name]
+			source = configFile
+		}
+		if !ok {
+			return
+		}
+		if errSet := f.Value.Set(value); errSet != nil {
+			err = fmt.Errorf("%s: invalid %s %q: %v", source, f.Name, value, errSet)
+		}
+	})
+	return err
+}
+
+// readConfigFile returns the settings of a TOML file by flag name: the names of the tables
+// enclosing a key are its prefix, [retrace] "cache.dir" = "..." sets --retrace.cache.dir.
+// Arrays are joined with commas, like list flags are given.
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err = toml.Unmarshal(b, &tree); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	settings := make(map[string]string)
+	var flatten func(prefix string, table map[string]interface{}) error
+	flatten = func(prefix string, table map[string]interface{}) error {
+		for key, value := range table {
+			name := prefix + key
+			switch v := value.(type) {
+			case map[string]interface{}:
+				if err := flatten(name+".", v); err != nil {
+					return err
+				}
+			case []interface{}:
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				settings[name] = strings.Join(items, ",")
+			case []map[string]interface{}:
+				return fmt.Errorf("%s: %s can not be an array of tables", path, name)
+			default:
+				settings[name] = fmt.Sprint(v)
+			}
+		}
+		return nil
+	}
+	if err = flatten("", tree); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// setupLogging replaces the terminal logger of main with the configured one. Logs other than
+// terminal ones are meant for collectors, gin then does not print its debug output.
+func setupLogging() error {
+	lvl, err := log.LvlFromString(logLevel)
+	if err != nil {
+		return fmt.Errorf("--log.level: %v", err)
+	}
+	switch logFormat {
+	case "terminal":
+		log.SetupDefaultTerminalLogger(lvl, "", "")
+		return nil
+	case "logfmt":
+		log.Root().SetHandler(log.LvlFilterHandler(lvl, log.StreamHandler(os.Stderr, log.LogfmtFormat())))
+	case "json":
+		log.Root().SetHandler(log.LvlFilterHandler(lvl, log.StreamHandler(os.Stderr, log.JSONFormat())))
+	default:
+		return fmt.Errorf("--log.format: unknown format %q, one of terminal, logfmt and json", logFormat)
+	}
+	gin.SetMode(gin.ReleaseMode)
+	return nil
+}
+
+// configuredFlags returns the flags differing from their defaults as key value pairs, for
+// the startup log. Tokens are not logged.
+func configuredFlags(flags *pflag.FlagSet) []interface{} {
+	var ctx []interface{}
+	flags.VisitAll(func(f *pflag.Flag) {
+		switch {
+		case f.Value.String() == f.DefValue:
+		case strings.HasSuffix(f.Name, "token"):
+			ctx = append(ctx, f.Name, "(set)")
+		default:
+			ctx = append(ctx, f.Name, f.Value.String())
+		}
+	})
+	return ctx
+}
@@ -0,0 +1,295 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+)
+
+var (
+	loadURL         string
+	loadKV          string
+	loadReplay      string
+	loadMix         string
+	loadChain       string
+	loadFrom        uint64
+	loadTo          uint64
+	loadAddresses   []string
+	loadDuration    time.Duration
+	loadConcurrency int
+	loadRate        float64
+	loadBudgetP99   time.Duration
+	loadBudgetErr   float64
+)
+
+func init() {
+	loadTestCmd.Flags().StringVar(&loadURL, "url", "http://127.0.0.1:8080", "base URL of the restapi deployment")
+	loadTestCmd.Flags().StringVar(&loadKV, "kv", "", "remote KV address (private.api.addr of turbo-geth) to load with header reads in addition to the REST requests")
+	loadTestCmd.Flags().StringVar(&loadReplay, "replay", "", "file with recorded requests, one \"METHOD PATH [BODY]\" per line, replayed in a loop instead of a synthesized mix")
+	loadTestCmd.Flags().StringVar(&loadMix, "mix", "mixed", "synthesized traffic: retrace, history, analysis or mixed")
+	loadTestCmd.Flags().StringVar(&loadChain, "chain", "mainnet", "chain name used in retrace and analysis paths")
+	loadTestCmd.Flags().Uint64Var(&loadFrom, "from", 0, "first block of the range requests are spread over")
+	loadTestCmd.Flags().Uint64Var(&loadTo, "to", 0, "last block of the range requests are spread over")
+	loadTestCmd.Flags().StringSliceVar(&loadAddresses, "address", nil, "addresses used by history and analysis requests, can be repeated")
+	loadTestCmd.Flags().DurationVar(&loadDuration, "duration", time.Minute, "how long to generate load")
+	loadTestCmd.Flags().IntVar(&loadConcurrency, "concurrency", 16, "number of concurrent clients")
+	loadTestCmd.Flags().Float64Var(&loadRate, "rate", 0, "requests per second over all clients, 0 for as fast as possible")
+	loadTestCmd.Flags().DurationVar(&loadBudgetP99, "budget.p99", 0, "fail if the p99 latency of any request class exceeds this, 0 to disable")
+	loadTestCmd.Flags().Float64Var(&loadBudgetErr, "budget.errors", 0.01, "fail if the error ratio of any request class exceeds this")
+	rootCmd.AddCommand(loadTestCmd)
+}
+
+var loadTestCmd = &cobra.Command{
+	Use:   "loadtest",
+	Short: "Generates load against a restapi deployment (and optionally the remote KV) and reports latency, throughput and error budgets",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		gen, err := newLoadGenerator()
+		if err != nil {
+			return err
+		}
+		var kv ethdb.KV
+		if loadKV != "" {
+			if kv, _, err = ethdb.NewRemote().Path(loadKV).Open(); err != nil {
+				return err
+			}
+			defer kv.Close()
+		}
+		return runLoad(cmd.Context(), gen, kv)
+	},
+}
+
+type loadRequest struct {
+	class  string // requests are reported per class
+	method string
+	path   string
+	body   string
+}
+
+// loadGenerator returns the i-th request of a worker.
+type loadGenerator func(rnd *rand.Rand, i int) loadRequest
+
+func newLoadGenerator() (loadGenerator, error) {
+	if loadReplay != "" {
+		recorded, err := readRecordedRequests(loadReplay)
+		if err != nil {
+			return nil, err
+		}
+		return func(rnd *rand.Rand, i int) loadRequest {
+			return recorded[rnd.Intn(len(recorded))]
+		}, nil
+	}
+	if loadTo < loadFrom {
+		return nil, fmt.Errorf("--to %d is below --from %d", loadTo, loadFrom)
+	}
+	block := func(rnd *rand.Rand) uint64 {
+		return loadFrom + uint64(rnd.Int63n(int64(loadTo-loadFrom+1)))
+	}
+	address := func(rnd *rand.Rand) string {
+		return loadAddresses[rnd.Intn(len(loadAddresses))]
+	}
+	retrace := func(rnd *rand.Rand) loadRequest {
+		return loadRequest{class: "retrace", method: http.MethodGet, path: fmt.Sprintf("/api/v1/retrace/%s/%d", loadChain, block(rnd))}
+	}
+	history := func(rnd *rand.Rand) loadRequest {
+		return loadRequest{class: "history", method: http.MethodGet, path: fmt.Sprintf("/api/v1/accounts/%s?block=%d", address(rnd), block(rnd))}
+	}
+	analysis := func(rnd *rand.Rand) loadRequest {
+		return loadRequest{class: "analysis", method: http.MethodGet, path: fmt.Sprintf("/api/v1/analysis/%s/%s?block=%d", loadChain, address(rnd), block(rnd))}
+	}
+	if loadMix != "retrace" && len(loadAddresses) == 0 {
+		return nil, fmt.Errorf("--mix %s needs at least one --address", loadMix)
+	}
+	switch loadMix {
+	case "retrace":
+		return func(rnd *rand.Rand, i int) loadRequest { return retrace(rnd) }, nil
+	case "history":
+		return func(rnd *rand.Rand, i int) loadRequest { return history(rnd) }, nil
+	case "analysis":
+		return func(rnd *rand.Rand, i int) loadRequest { return analysis(rnd) }, nil
+	case "mixed":
+		// roughly what explorers send: mostly point reads, some replays
+		return func(rnd *rand.Rand, i int) loadRequest {
+			switch n := rnd.Intn(10); {
+			case n < 6:
+				return history(rnd)
+			case n < 8:
+				return analysis(rnd)
+			default:
+				return retrace(rnd)
+			}
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown mix %q", loadMix)
+}
+
+func readRecordedRequests(path string) ([]loadRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var requests []loadRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid request %q, expected METHOD PATH [BODY]", line)
+		}
+		r := loadRequest{method: strings.ToUpper(parts[0]), path: parts[1]}
+		if len(parts) == 3 {
+			r.body = parts[2]
+		}
+		// class by the route group, e.g. /api/v1/retrace/... is "retrace"
+		r.class = r.method
+		if segments := strings.Split(strings.TrimPrefix(r.path, "/api/v1/"), "/"); segments[0] != "" {
+			r.class = strings.SplitN(segments[0], "?", 2)[0]
+		}
+		requests = append(requests, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("no requests in %s", path)
+	}
+	return requests, nil
+}
+
+type loadStats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func (s *loadStats) add(class string, d time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencies[class] = append(s.latencies[class], d)
+	if failed {
+		s.errors[class]++
+	}
+}
+
+func runLoad(ctx context.Context, gen loadGenerator, kv ethdb.KV) error {
+	ctx, cancel := context.WithTimeout(ctx, loadDuration)
+	defer cancel()
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if loadRate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(loadRate), 1)
+	}
+	stats := &loadStats{latencies: make(map[string][]time.Duration), errors: make(map[string]int)}
+	client := &http.Client{Timeout: time.Minute}
+	base := strings.TrimRight(loadURL, "/")
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < loadConcurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; ; i++ {
+				if err := limiter.Wait(ctx); err != nil {
+					return
+				}
+				if kv != nil && i%2 == 1 {
+					began := time.Now()
+					err := kv.View(ctx, func(tx ethdb.Tx) error {
+						_, err := tx.Get(dbutils.HeaderPrefix, dbutils.HeaderHashKey(loadFrom+uint64(rnd.Int63n(int64(loadTo-loadFrom+1)))))
+						return err
+					})
+					if ctx.Err() != nil {
+						return
+					}
+					stats.add("kv", time.Since(began), err != nil)
+					continue
+				}
+				r := gen(rnd, i)
+				began := time.Now()
+				failed := doLoadRequest(ctx, client, base, r)
+				if ctx.Err() != nil {
+					return
+				}
+				stats.add(r.class, time.Since(began), failed)
+			}
+		}(int64(w) + time.Now().UnixNano())
+	}
+	wg.Wait()
+	return reportLoad(stats, time.Since(start))
+}
+
+// doLoadRequest tells if the request failed, either in transport or with a server error.
+func doLoadRequest(ctx context.Context, client *http.Client, base string, r loadRequest) bool {
+	var body io.Reader
+	if r.body != "" {
+		body = strings.NewReader(r.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, base+r.path, body)
+	if err != nil {
+		return true
+	}
+	if r.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return err != nil || resp.StatusCode >= http.StatusInternalServerError
+}
+
+func reportLoad(stats *loadStats, elapsed time.Duration) error {
+	classes := make([]string, 0, len(stats.latencies))
+	for class := range stats.latencies {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	var violations []string
+	for _, class := range classes {
+		latencies := stats.latencies[class]
+		errRatio := float64(stats.errors[class]) / float64(len(latencies))
+		p99 := percentile(latencies, 0.99)
+		fmt.Printf("%-10s %7d requests %8.1f req/s  errors %6.2f%%  p50 %-12s p90 %-12s p99 %-12s max %s\n",
+			class, len(latencies), float64(len(latencies))/elapsed.Seconds(), 100*errRatio,
+			percentile(latencies, 0.5), percentile(latencies, 0.9), p99, percentile(latencies, 1))
+		if loadBudgetP99 > 0 && p99 > loadBudgetP99 {
+			violations = append(violations, fmt.Sprintf("%s p99 %s exceeds %s", class, p99, loadBudgetP99))
+		}
+		if errRatio > loadBudgetErr {
+			violations = append(violations, fmt.Sprintf("%s error ratio %.4f exceeds %.4f", class, errRatio, loadBudgetErr))
+		}
+	}
+	if len(classes) == 0 {
+		return fmt.Errorf("no requests completed in %s", elapsed)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("budget exceeded: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// percentile sorts the latencies in place and returns the p-th percentile.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[int(p*float64(len(latencies)-1))]
+}
@@ -1,27 +1,72 @@
 package commands
 
 import (
+	"runtime"
+	"time"
+
 	"github.com/ledgerwatch/turbo-geth/cmd/restapi/rest"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
 	"github.com/spf13/cobra"
 )
 
 var (
-	rpcAddr   string
-	chaindata string
-	addr      string
+	cfg            rest.Config
+	metricsEnabled bool
 )
 
 func init() {
-	rootCmd.Flags().StringVar(&rpcAddr, "private.api.addr", "127.0.0.1:9090", "binary RPC network address, for example: 127.0.0.1:9090, empty string means not to start the listener. do not expose to public network. serves remote database interface")
-	rootCmd.Flags().StringVar(&addr, "http.addr", "127.0.0.1:8080", "REST server listening host")
-	rootCmd.Flags().StringVar(&chaindata, "chaindata", "", "path to the database")
+	rootCmd.Flags().StringVar(&cfg.PrivateAPIAddr, "private.api.addr", "127.0.0.1:9090", "binary RPC network address, for example: 127.0.0.1:9090, empty string means not to start the listener. do not expose to public network. serves remote database interface")
+	rootCmd.Flags().StringVar(&cfg.PrivateAPIToken, "private.api.token", "", "token of the binary RPC, the --private.api.token of the node")
+	rootCmd.Flags().StringVar(&cfg.PrivateAPICACert, "private.api.tls.cacert", "", "path to the PEM certificates of the CAs of the binary RPC certificate, connects over TLS if set")
+	rootCmd.Flags().StringVar(&cfg.PrivateAPICert, "private.api.tls.cert", "", "path to the PEM client certificate presented to the binary RPC, connects over TLS if set")
+	rootCmd.Flags().StringVar(&cfg.PrivateAPIKey, "private.api.tls.key", "", "path to the PEM private key of --private.api.tls.cert")
+	rootCmd.Flags().StringVar(&cfg.Compression, "private.api.compression", "", "compression of the binary RPC calls: snappy or gzip, for nodes on another host")
+	rootCmd.Flags().IntVar(&cfg.PrivateAPIConns, "private.api.conns", 1, "connections to the binary RPC, the calls are spread over those connected")
+	rootCmd.Flags().StringVar(&cfg.Addr, "http.addr", "127.0.0.1:8080", "REST server listening host")
+	rootCmd.Flags().IntVar(&cfg.KVCache, "kv.cache", 0, "MB of accounts, code and headers kept in memory, dropped when the head advances, 0 to disable the cache")
+	rootCmd.Flags().StringVar(&cfg.Chaindata, "chaindata", "", "path to the database of a node on this machine, opened read-only instead of using --private.api.addr")
+	rootCmd.Flags().StringVar(&cfg.Selectors, "selectors", "", "path to a 4-byte selector dump (one signature or \"<selector> <signature>\" per line) used to name calls")
+	// metrics.Enabled is set from the command line by the metrics package itself, the flag only has to be accepted
+	rootCmd.Flags().StringVar(&cfg.Chains, "chains", "", "path to a JSON array of chains to serve besides mainnet, testnet, rinkeby and goerli: [{\"name\": \"xdai\", \"genesis\": \"0x...\"}] or with a literal \"config\"")
+	rootCmd.Flags().BoolVar(&metricsEnabled, "metrics", false, "collect metrics and serve them at /metrics (and /debug/metrics/prometheus)")
+	rootCmd.Flags().BoolVar(&cfg.Warmup, "warmup", false, "pre-load recent headers, touched accounts, intermediate hashes and hot contracts in the background at startup")
+	rootCmd.Flags().StringVar(&cfg.AuthKeys, "auth.keys", "", "path to a file with one \"<scope> <key>\" per line, scope is read or admin; requests then need a key or a token")
+	rootCmd.Flags().StringVar(&cfg.AuthJWTSecret, "auth.jwt.secret", "", "path to the HMAC secret (raw or 0x-prefixed hex) of accepted JWTs, whose scope claim is read (the default) or admin")
+	rootCmd.Flags().StringSliceVar(&cfg.CORSOrigins, "http.corsdomain", []string{"*"}, "comma separated list of origins browsers may call the API from, empty to send no CORS headers")
+	rootCmd.Flags().StringSliceVar(&cfg.CORSMethods, "http.cors.methods", []string{"GET", "POST"}, "methods allowed in cross origin requests")
+	rootCmd.Flags().StringSliceVar(&cfg.CORSHeaders, "http.cors.headers", []string{"Accept", "Content-Type", "Authorization", "X-API-Key", "X-Request-ID"}, "request headers allowed in cross origin requests")
+	rootCmd.Flags().Float64Var(&cfg.RateLimit, "ratelimit.rps", 0, "requests per second allowed to every client (API key, token subject or IP), 0 for no limit")
+	rootCmd.Flags().IntVar(&cfg.RateBurst, "ratelimit.burst", 20, "requests a client may send at once above --ratelimit.rps")
+	rootCmd.Flags().IntVar(&cfg.MaxReplays, "replay.max-concurrent", runtime.NumCPU(), "concurrent block and transaction replays (retrace, trace, receipts), further requests get 503; 0 for no bound")
+	rootCmd.Flags().StringVar(&cfg.TLSCert, "tls.cert", "", "path to the PEM certificate (chain) to serve HTTPS and HTTP/2 with")
+	rootCmd.Flags().StringVar(&cfg.TLSKey, "tls.key", "", "path to the PEM private key of --tls.cert")
+	rootCmd.Flags().BoolVar(&cfg.TLSSelfSigned, "tls.self-signed", false, "serve HTTPS with a certificate generated at startup, for development only")
+	rootCmd.Flags().IntVar(&cfg.RetraceCache, "retrace.cache", 256, "block retraces kept in memory by block hash and options, 0 to disable the cache")
+	rootCmd.Flags().StringVar(&cfg.RetraceCacheDir, "retrace.cache.dir", "", "directory also keeping the cached retraces as JSON files, which survive restarts")
+	rootCmd.Flags().IntVar(&cfg.MaxResponseBytes, "retrace.max-response", 64<<20, "retraces whose JSON encoding is larger than this many bytes are cut into pages, marked truncated; 0 for no limit")
+	rootCmd.Flags().IntVar(&cfg.MaxRetraceBatch, "retrace.batch.max", 100, "blocks and transactions a batch retrace may ask for, 0 for no limit")
+	rootCmd.Flags().DurationVar(&cfg.ShutdownDelay, "shutdown.delay", 0, "how long /ready fails before the server stops accepting connections on SIGTERM, for load balancers to stop routing to it")
+	rootCmd.Flags().DurationVar(&cfg.ShutdownTimeout, "shutdown.timeout", 30*time.Second, "how long requests in flight, like retraces, may take to complete on shutdown")
+	rootCmd.Flags().Uint64Var(&cfg.MinConfirmations, "retrace.min-confirmations", 0, "refuse to retrace blocks with fewer confirmations than this (unless marked finalized), 0 to serve any block")
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "restapi",
 	Short: "restapi exposes read-only blockchain APIs through REST (requires running turbo-geth node)",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return rest.ServeREST(cmd.Context(), addr, rpcAddr, chaindata)
+		if err := loadConfig(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := setupLogging(); err != nil {
+			return err
+		}
+		if metricsEnabled {
+			// the metrics created at startup stay disabled, the package only looks at the command line
+			metrics.Enabled = true
+		}
+		log.Info("Starting restapi", configuredFlags(cmd.Flags())...)
+		return rest.ServeREST(cmd.Context(), cfg)
 	},
 }
 
@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/restapi/apis"
+)
+
+// chainGroups are the route groups whose first segment is :chain.
+var chainGroups = map[string]bool{
+	"retrace":  true,
+	"trace":    true,
+	"receipts": true,
+	"history":  true,
+	"state":    true,
+	"supply":   true,
+	"rewards":  true,
+	"analysis": true,
+}
+
+// defaultChain makes the :chain segment optional: requests to the chain groups whose first
+// segment can not name a chain get the chain of the database inserted before routing, gin
+// routes can not have optional segments.
+func defaultChain(h http.Handler, e *apis.Env) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest := strings.TrimPrefix(r.URL.Path, "/api/v1/"); rest != r.URL.Path && e.Chain != "" {
+			parts := strings.SplitN(strings.TrimSuffix(rest, "/"), "/", 3)
+			switch {
+			case len(parts) == 1 && chainGroups[parts[0]]: // like POST /retrace
+				r.URL.Path = "/api/v1/" + parts[0] + "/" + e.Chain
+				r.URL.RawPath = ""
+			case len(parts) >= 2 && chainGroups[parts[0]] && !namesChain(parts[1]):
+				r.URL.Path = "/api/v1/" + parts[0] + "/" + e.Chain + "/" + strings.Join(parts[1:], "/")
+				r.URL.RawPath = ""
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// namesChain tells if a segment in the position of :chain can be one: block numbers,
+// addresses and the static segments following :chain can not.
+func namesChain(seg string) bool {
+	switch seg {
+	case "", "tx", "account", "storage":
+		return false
+	}
+	if strings.Trim(seg, "0123456789") == "" {
+		return false
+	}
+	if len(seg) == 42 && (strings.HasPrefix(seg, "0x") || strings.HasPrefix(seg, "0X")) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// instrument times every request under the name of its route, for example
+// restapi/route/retrace/chain/number, and counts the responses by status class.
+func instrument(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := "unmatched"
+	if path := c.FullPath(); path != "" {
+		route = routeMetricName(path)
+	}
+	metrics.GetOrRegisterTimer("restapi/route/"+route, nil).UpdateSince(start)
+	metrics.GetOrRegisterMeter("restapi/responses/"+statusClass(c.Writer.Status()), nil).Mark(1)
+}
+
+// routeMetricName turns /api/v1/retrace/:chain/:number into retrace/chain/number.
+func routeMetricName(path string) string {
+	path = strings.TrimPrefix(path, "/api/v1/")
+	var parts []string
+	for _, seg := range strings.Split(path, "/") {
+		seg = strings.TrimLeft(seg, ":*")
+		if seg != "" {
+			parts = append(parts, strings.ReplaceAll(seg, "-", "_"))
+		}
+	}
+	if len(parts) == 0 {
+		return "root"
+	}
+	return strings.Join(parts, "/")
+}
+
+func statusClass(status int) string {
+	return string(rune('0'+status/100)) + "xx"
+}
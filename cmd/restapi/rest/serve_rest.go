@@ -3,30 +3,115 @@ package rest
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ledgerwatch/turbo-geth/cmd/restapi/apis"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/metrics/prometheus"
+	"github.com/rs/cors"
 )
 
 func printError(name string, err error) {
 	if err != nil {
-		log.Printf("%v: SUCCESS", name)
+		log.Info(name + ": SUCCESS")
 	} else {
-		log.Printf("%v: FAIL (err=%v)", name, err)
+		log.Info(name+": FAIL", "err", err)
 	}
 }
 
-func ServeREST(ctx context.Context, restHost, rpcHost string, chaindata string) error {
-	r := gin.Default()
+// openLocal opens the database a node on the same machine writes to, read-only, with the
+// engine ethdb.Open would pick for the path.
+func openLocal(path string) (ethdb.KV, error) {
+	var kv ethdb.KV
+	var err error
+	if strings.HasSuffix(path, "_bolt") {
+		kv, err = ethdb.NewBolt().Path(path).ReadOnly().Open()
+	} else if strings.HasSuffix(path, "_badger") {
+		kv, err = ethdb.NewBadger().Path(path).ReadOnly().Open()
+	} else {
+		kv, err = ethdb.NewLMDB().Path(path).ReadOnly().Open()
+	}
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := ethdb.WithCompression(kv)
+	if err != nil {
+		kv.Close()
+		return nil, err
+	}
+	return compressed, nil
+}
+
+// Config holds the command line options of the server.
+type Config struct {
+	Addr             string // REST listening address
+	PrivateAPIAddr   string // remote database, used unless Chaindata is set
+	PrivateAPIToken  string
+	PrivateAPICACert string // connecting over TLS if it or PrivateAPICert is set
+	PrivateAPICert   string
+	PrivateAPIKey    string
+	Compression      string // of the calls to the remote database, snappy or gzip
+	PrivateAPIConns  int    // connections to the remote database
+	KVCache          int    // MB of values of the hot buckets cached, 0 to disable the cache
+	Chaindata        string // local database, opened read-only
+	Selectors        string // path of a selector dump
+	Chains           string // path of a JSON array of apis.Chain to register
+	MinConfirmations uint64
+	Warmup           bool
+	AuthKeys         string // path of an API keys file, see apis.LoadAPIKeys
+	AuthJWTSecret    string // path of the JWT HMAC secret
+	TLSCert          string
+	TLSKey           string
+	TLSSelfSigned    bool     // generate a certificate if TLSCert and TLSKey are not set
+	CORSOrigins      []string // no CORS headers are sent if empty
+	CORSMethods      []string
+	CORSHeaders      []string
+	RateLimit        float64 // requests per second and client, 0 for no limit
+	RateBurst        int
+	MaxReplays       int // concurrent block and transaction replays, 0 for no bound
+	RetraceCache     int // retraces kept in memory, 0 to disable the cache
+	RetraceCacheDir  string
+	MaxResponseBytes int
+	MaxRetraceBatch  int
+	ShutdownDelay    time.Duration // reporting not ready before draining, for load balancers to notice
+	ShutdownTimeout  time.Duration // for the requests in flight to complete
+}
+
+func ServeREST(ctx context.Context, cfg Config) error {
+	auth, err := loadAuth(cfg)
+	if err != nil {
+		return err
+	}
+	tlsConf, err := tlsConfig(cfg)
+	if err != nil {
+		return err
+	}
+	// gin.Default, with the requests logged like everything else
+	r := gin.New()
+	r.Use(apis.RequestIDMiddleware, apis.AccessLog, gin.Recovery())
+	if metrics.Enabled {
+		handler := gin.WrapH(prometheus.Handler(metrics.DefaultRegistry))
+		r.GET("/debug/metrics/prometheus", handler)
+		r.GET("/metrics", handler)
+		r.Use(instrument)
+	}
 	root := r.Group("api/v1")
-	allowCORS(root)
+	if auth != nil {
+		root.Use(auth.Middleware())
+	}
+	if limiter := apis.NewRateLimiter(cfg.RateLimit, cfg.RateBurst); limiter != nil {
+		root.Use(limiter.Middleware())
+	}
 	root.Use(func(c *gin.Context) {
 		c.Next()
-		if len(c.Errors) > 0 {
+		// handlers which responded already keep their errors in the context for the logs
+		if len(c.Errors) > 0 && !c.Writer.Written() {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, c.Errors)
 		}
 	})
@@ -34,77 +119,184 @@ func ServeREST(ctx context.Context, restHost, rpcHost string, chaindata string)
 	var kv ethdb.KV
 	var db ethdb.Database
 	var back ethdb.Backend
-	var err error
-	if rpcHost != "" {
-		kv, back, err = ethdb.NewRemote().Path(rpcHost).Open()
-		db = ethdb.NewObjectDatabase(kv)
-	} else if chaindata != "" {
-		database, errOpen := ethdb.Open(chaindata)
-		if errOpen != nil {
-			return errOpen
+	openRemote := func(addr string) (ethdb.KV, ethdb.Backend, error) {
+		kv, back, err := ethdb.NewRemote().Path(addr).TLS(cfg.PrivateAPICACert, cfg.PrivateAPICert, cfg.PrivateAPIKey).Token(cfg.PrivateAPIToken).Compression(cfg.Compression).Conns(cfg.PrivateAPIConns).Open()
+		if err == nil && metrics.Enabled {
+			kv = ethdb.NewMeteredKV(kv)
+		}
+		return kv, back, err
+	}
+	remoteAddr := cfg.PrivateAPIAddr
+	if cfg.Chaindata != "" {
+		remoteAddr = ""
+		if kv, err = openLocal(cfg.Chaindata); err != nil {
+			return err
+		}
+		if metrics.Enabled {
+			kv = ethdb.NewMeteredKV(kv)
 		}
-		kv = database.KV()
+		db = ethdb.NewObjectDatabase(kv)
+		log.Info("Serving the local database read-only", "path", cfg.Chaindata)
+	} else if remoteAddr != "" {
+		kv, back, err = openRemote(remoteAddr)
+		db = ethdb.NewObjectDatabase(kv)
 	} else {
 		err = fmt.Errorf("either remote or local db must be specified")
 	}
 	if err != nil {
 		return err
 	}
+	if cfg.KVCache > 0 {
+		kv = ethdb.NewCachedKV(kv, cfg.KVCache*1024*1024, stages.CacheHeads)
+		db = ethdb.NewObjectDatabase(kv)
+	}
 	defer db.Close()
-	e := &apis.Env{
-		KV:              kv,
-		DB:              db,
-		Back:            back,
-		RemoteDBAddress: rpcHost,
-		Chaindata:       chaindata,
+	selectors := apis.NewSelectorDB()
+	if cfg.Selectors != "" {
+		if selectors, err = apis.OpenSelectorDB(cfg.Selectors); err != nil {
+			return err
+		}
+		log.Info("Loaded selectors", "count", selectors.Len(), "path", cfg.Selectors)
 	}
-
-	if err = apis.RegisterPrivateAPI(root.Group("private-api"), e); err != nil {
-		return err
+	if cfg.Chains != "" {
+		n, errLoad := apis.LoadChains(cfg.Chains)
+		if errLoad != nil {
+			return errLoad
+		}
+		log.Info("Registered chains", "count", n, "path", cfg.Chains)
 	}
-	if err = apis.RegisterAccountAPI(root.Group("accounts"), e); err != nil {
+	retraceCache, err := apis.NewRetraceCache(cfg.RetraceCache, cfg.RetraceCacheDir)
+	if err != nil {
 		return err
 	}
-	if err = apis.RegisterStorageAPI(root.Group("storage"), e); err != nil {
-		return err
+	e := &apis.Env{
+		KV:               kv,
+		DB:               db,
+		Back:             back,
+		RemoteDBAddress:  remoteAddr,
+		OpenRemote:       openRemote,
+		Chaindata:        cfg.Chaindata,
+		Selectors:        selectors,
+		Finality:         apis.NewFinality(cfg.MinConfirmations),
+		ReplaySlots:      apis.NewReplaySlots(cfg.MaxReplays),
+		RetraceCache:     retraceCache,
+		MaxResponseBytes: cfg.MaxResponseBytes,
+		MaxRetraceBatch:  cfg.MaxRetraceBatch,
 	}
-	if err = apis.RegisterRetraceAPI(root.Group("retrace"), e); err != nil {
-		return err
+	if e.Chain, err = apis.DetectChain(kv); err != nil {
+		log.Warn("Could not detect the chain, routes have to name one", "err", err)
+	} else {
+		log.Info("Serving chain", "chain", e.Chain)
 	}
-	if err = apis.RegisterIntermediateHashAPI(root.Group("intermediate-hash"), e); err != nil {
+
+	if err = apis.RegisterRoutes(root, e); err != nil {
 		return err
 	}
-	if err = apis.RegisterDBAPI(root.Group("db"), e); err != nil {
-		return err
+	exts := apis.Extensions()
+	for _, ext := range exts {
+		if err = ext.Register(root.Group(ext.Name), e); err != nil {
+			return fmt.Errorf("registering extension %s: %w", ext.Name, err)
+		}
+	}
+	apis.RegisterOpenAPI(r)
+	apis.RegisterHealthAPI(r, e)
+	for _, ext := range exts {
+		if ext.Start == nil {
+			continue
+		}
+		if err = ext.Start(ctx, e); err != nil {
+			return fmt.Errorf("starting extension %s: %w", ext.Name, err)
+		}
+	}
+	defer func() {
+		for i := len(exts) - 1; i >= 0; i-- {
+			if exts[i].Stop != nil {
+				exts[i].Stop(e)
+			}
+		}
+	}()
+
+	if cfg.Warmup {
+		// serve right away, requests arriving early are just slower
+		go func() {
+			if _, err := apis.Warmup(ctx, e, apis.DefaultWarmupConfig); err != nil {
+				log.Warn("Warmup failed", "err", err)
+			}
+		}()
 	}
 
-	log.Printf("serving on %v... press ctrl+C to abort\n", restHost)
+	scheme := "http"
+	if tlsConf != nil {
+		scheme = "https"
+	}
+	log.Info("Serving... press ctrl+C to abort", "url", scheme+"://"+cfg.Addr)
 
-	srv := &http.Server{Addr: restHost, Handler: r}
+	srv := &http.Server{Addr: cfg.Addr, Handler: corsHandler(defaultChain(r, e), cfg), TLSConfig: tlsConf}
 
-	// Initializing the server in a goroutine so that
-	// it won't block the graceful shutdown handling below
+	// On SIGINT or SIGTERM the readiness checks fail first, then the server stops accepting
+	// connections and waits for the requests in flight, like long retraces, to complete
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-ctx.Done()
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		e.SetDraining()
+		if cfg.ShutdownDelay > 0 {
+			log.Info("Not ready, shutting down", "delay", cfg.ShutdownDelay)
+			time.Sleep(cfg.ShutdownDelay)
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 		defer cancel()
 		if err := srv.Shutdown(shutdownCtx); err != nil {
-			log.Fatal("Server forced to shutdown:", err)
+			log.Warn("Requests still in flight, closing", "timeout", cfg.ShutdownTimeout, "err", err)
+			srv.Close()
 		}
 	}()
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("listen: %s\n", err)
+	if tlsConf != nil {
+		// the certificates are in TLSConfig already
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("listen: %w", err)
 	}
+	// Shutdown returns right away from ListenAndServe, the database has to stay open until
+	// the requests are drained
+	<-shutdownDone
 
 	return nil
 }
 
-func allowCORS(r *gin.RouterGroup) {
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Next()
-	})
+// loadAuth reads the credentials, authentication is disabled (nil) if none are configured.
+func loadAuth(cfg Config) (*apis.Auth, error) {
+	var keys map[string]apis.Scope
+	var secret []byte
+	var err error
+	if cfg.AuthKeys != "" {
+		if keys, err = apis.LoadAPIKeys(cfg.AuthKeys); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.AuthJWTSecret != "" {
+		if secret, err = apis.LoadJWTSecret(cfg.AuthJWTSecret); err != nil {
+			return nil, err
+		}
+	}
+	return apis.NewAuth(keys, secret), nil
+}
+
+// corsHandler answers preflight requests and adds the CORS headers. It wraps the whole
+// router, as gin does not run group middleware for the OPTIONS requests it has no route for.
+func corsHandler(h http.Handler, cfg Config) http.Handler {
+	if len(cfg.CORSOrigins) == 0 {
+		return h
+	}
+	return cors.New(cors.Options{
+		AllowedOrigins: cfg.CORSOrigins,
+		AllowedMethods: cfg.CORSMethods,
+		AllowedHeaders: cfg.CORSHeaders,
+		ExposedHeaders: []string{"Retry-After", apis.RetraceCacheHeader, apis.RequestIDHeader},
+		MaxAge:         600,
+	}).Handler(h)
 }
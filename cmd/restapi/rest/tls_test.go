@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfig(t *testing.T) {
+	conf, err := tlsConfig(Config{})
+	require.NoError(t, err)
+	assert.Nil(t, conf)
+	_, err = tlsConfig(Config{TLSCert: "cert.pem"})
+	assert.Error(t, err)
+	_, err = tlsConfig(Config{TLSKey: "key.pem", TLSSelfSigned: true})
+	assert.Error(t, err)
+
+	// a certificate and key written to files
+	cert, err := selfSignedCert("")
+	require.NoError(t, err)
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err)
+	dir, err := ioutil.TempDir("", "restapi-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600))
+	conf, err = tlsConfig(Config{TLSCert: certFile, TLSKey: keyFile})
+	require.NoError(t, err)
+	require.Len(t, conf.Certificates, 1)
+	assert.Equal(t, cert.Certificate, conf.Certificates[0].Certificate)
+	_, err = tlsConfig(Config{TLSCert: keyFile, TLSKey: certFile})
+	assert.Error(t, err)
+}
+
+// TestSelfSigned checks that a client trusting the generated certificate talks HTTP/2 to the server.
+func TestSelfSigned(t *testing.T) {
+	conf, err := tlsConfig(Config{Addr: "127.0.0.1:0", TLSSelfSigned: true})
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto)) //nolint:errcheck
+	}))
+	srv.TLS = conf
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the client of srv trusts its certificate and checks the addresses it is valid for
+	resp, err := srv.Client().Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+	assert.Equal(t, "HTTP/2.0", string(body))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/ledgerwatch/turbo-geth/cmd/utils"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/internal/debug"
 	"github.com/ledgerwatch/turbo-geth/log"
@@ -14,6 +15,11 @@ import (
 
 type Flags struct {
 	PrivateApiAddr    string
+	PrivateApiToken   string
+	TLSCACert         string
+	TLSCert           string
+	TLSKey            string
+	Compression       string
 	Chaindata         string
 	HttpListenAddress string
 	HttpPort          int
@@ -21,6 +27,7 @@ type Flags struct {
 	HttpVirtualHost   []string
 	API               []string
 	Gascap            uint64
+	KVCache           int
 }
 
 var rootCmd = &cobra.Command{
@@ -43,7 +50,13 @@ func RootCommand() (*cobra.Command, *Flags) {
 
 	cfg := &Flags{}
 	rootCmd.PersistentFlags().StringVar(&cfg.PrivateApiAddr, "private.api.addr", "127.0.0.1:9090", "private api network address, for example: 127.0.0.1:9090, empty string means not to start the listener. do not expose to public network. serves remote database interface")
+	rootCmd.PersistentFlags().StringVar(&cfg.PrivateApiToken, "private.api.token", "", "token of the private api, the --private.api.token of the node")
+	rootCmd.PersistentFlags().StringVar(&cfg.TLSCACert, "private.api.tls.cacert", "", "path to the PEM certificates of the CAs of the private api certificate, connects over TLS if set")
+	rootCmd.PersistentFlags().StringVar(&cfg.TLSCert, "private.api.tls.cert", "", "path to the PEM client certificate presented to the private api, connects over TLS if set")
+	rootCmd.PersistentFlags().StringVar(&cfg.TLSKey, "private.api.tls.key", "", "path to the PEM private key of --private.api.tls.cert")
+	rootCmd.PersistentFlags().StringVar(&cfg.Compression, "private.api.compression", "", "compression of the private api calls: snappy or gzip, for nodes on another host")
 	rootCmd.PersistentFlags().StringVar(&cfg.Chaindata, "chaindata", "", "path to the database")
+	rootCmd.PersistentFlags().IntVar(&cfg.KVCache, "kv.cache", 0, "MB of accounts, code and headers kept in memory, dropped when the head advances, 0 to disable the cache")
 	rootCmd.PersistentFlags().StringVar(&cfg.HttpListenAddress, "http.addr", node.DefaultHTTPHost, "HTTP-RPC server listening interface")
 	rootCmd.PersistentFlags().IntVar(&cfg.HttpPort, "http.port", node.DefaultHTTPPort, "HTTP-RPC server listening port")
 	rootCmd.PersistentFlags().StringSliceVar(&cfg.HttpCORSDomain, "http.corsdomain", []string{}, "Comma separated list of domains from which to accept cross origin requests (browser enforced)")
@@ -59,7 +72,7 @@ func OpenDB(cfg Flags) (ethdb.KV, ethdb.Backend, error) {
 	var txPool ethdb.Backend
 	var err error
 	if cfg.PrivateApiAddr != "" {
-		db, txPool, err = ethdb.NewRemote().Path(cfg.PrivateApiAddr).Open()
+		db, txPool, err = ethdb.NewRemote().Path(cfg.PrivateApiAddr).TLS(cfg.TLSCACert, cfg.TLSCert, cfg.TLSKey).Token(cfg.PrivateApiToken).Compression(cfg.Compression).Open()
 		if err != nil {
 			return nil, nil, fmt.Errorf("could not connect to remoteDb: %w", err)
 		}
@@ -76,6 +89,9 @@ func OpenDB(cfg Flags) (ethdb.KV, ethdb.Backend, error) {
 	if err != nil {
 		return nil, nil, fmt.Errorf("could not connect to remoteDb: %w", err)
 	}
+	if cfg.KVCache > 0 {
+		db = ethdb.NewCachedKV(db, cfg.KVCache*1024*1024, stages.CacheHeads)
+	}
 
 	return db, txPool, err
 }
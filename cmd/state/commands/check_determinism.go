@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"runtime"
+
+	"github.com/ledgerwatch/turbo-geth/cmd/state/stateless"
+	"github.com/spf13/cobra"
+)
+
+var (
+	blockCount uint64
+	workers    int
+	parallel   int
+	checkRoot  bool
+)
+
+func init() {
+	withBlock(checkDeterminismCmd)
+	withChaindata(checkDeterminismCmd)
+	checkDeterminismCmd.Flags().Uint64Var(&blockCount, "count", 1000, "number of blocks to execute")
+	checkDeterminismCmd.Flags().IntVar(&workers, "workers", runtime.NumCPU(), "number of blocks executed concurrently in the second run")
+	checkDeterminismCmd.Flags().IntVar(&parallel, "parallel", 0, "if > 0, number of workers executing the transactions of every block in a third run")
+	checkDeterminismCmd.Flags().BoolVar(&checkRoot, "root", false, "check the state roots after the blocks of the first run, the range has to be close to the block the state is hashed at")
+	rootCmd.AddCommand(checkDeterminismCmd)
+}
+
+var checkDeterminismCmd = &cobra.Command{
+	Use:   "checkDeterminism",
+	Short: "Executes a range of historical blocks twice (fresh and sequential, then warm and concurrent) and checks that changesets, written values and receipt roots are identical",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return stateless.CheckDeterminism(genesis, block, blockCount, chaindata, workers, parallel, checkRoot)
+	},
+}
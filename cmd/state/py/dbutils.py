@@ -32,7 +32,7 @@ PreimagePrefix = "secure-key-".encode()
 ConfigPrefix = "ethereum-config-".encode()
 BloomBitsIndexPrefix = "iB".encode()
 BloomBitsIndexPrefixShead = "iBshead".encode()
-LastPrunedBlockKey = "LastPrunedBlock".encode()
+PrunedHistory = "prunedHistory".encode()
 LastAppliedMigration = "lastAppliedMigration".encode()
 StorageModeHistory = "smHistory".encode()
 StorageModeReceipts = "smReceipts".encode()
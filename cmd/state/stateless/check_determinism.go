@@ -0,0 +1,264 @@
+package stateless
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// executionOutput is everything a block execution produces that has to be identical between runs.
+type executionOutput struct {
+	accountChanges []byte
+	storageChanges []byte
+	accountValues  []byte
+	storageValues  []byte
+	receiptSha     common.Hash
+	writes         *state.ChangeSetWriter // for the state root, dropped once checked
+}
+
+func (o *executionOutput) diff(other *executionOutput) string {
+	switch {
+	case !bytes.Equal(o.accountChanges, other.accountChanges):
+		return "account changes"
+	case !bytes.Equal(o.storageChanges, other.storageChanges):
+		return "storage changes"
+	case !bytes.Equal(o.accountValues, other.accountValues):
+		return "account values written"
+	case !bytes.Equal(o.storageValues, other.storageValues):
+		return "storage values written"
+	case o.receiptSha != other.receiptSha:
+		return fmt.Sprintf("receipt root %x vs %x", o.receiptSha, other.receiptSha)
+	}
+	return ""
+}
+
+// blockExecutor executes a block on the state of reader, committing it to csw.
+type blockExecutor func(reader state.StateReader, block *types.Block, csw *state.ChangeSetWriter) (types.Receipts, error)
+
+// changeSetCollector is a ChangeSetWriter for the executions of core, which write no changesets.
+type changeSetCollector struct {
+	*state.ChangeSetWriter
+}
+
+func (changeSetCollector) WriteChangeSets() error { return nil }
+func (changeSetCollector) WriteHistory() error    { return nil }
+
+// codeCacheReader shares contract code between executions, code is looked up by hash and
+// therefore valid for any block.
+type codeCacheReader struct {
+	state.StateReader
+	code *sync.Map
+}
+
+func (r *codeCacheReader) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	if code, ok := r.code.Load(codeHash); ok {
+		return code.([]byte), nil
+	}
+	code, err := r.StateReader.ReadAccountCode(address, codeHash)
+	if err == nil && code != nil {
+		r.code.Store(codeHash, code)
+	}
+	return code, err
+}
+
+func (r *codeCacheReader) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	if code, ok := r.code.Load(codeHash); ok {
+		return len(code.([]byte)), nil
+	}
+	return r.StateReader.ReadAccountCodeSize(address, codeHash)
+}
+
+func executeForDeterminism(execute blockExecutor, reader state.StateReader, block *types.Block) (*executionOutput, error) {
+	csw := state.NewChangeSetWriterPlainWithValues(block.NumberU64() - 1)
+	receipts, err := execute(reader, block, csw)
+	if err != nil {
+		return nil, err
+	}
+	out := &executionOutput{receiptSha: types.DeriveSha(receipts), writes: csw}
+	for _, cs := range []struct {
+		get    func() (*changeset.ChangeSet, error)
+		encode func(*changeset.ChangeSet) ([]byte, error)
+		to     *[]byte
+	}{
+		{csw.GetAccountChanges, changeset.EncodeAccountsPlain, &out.accountChanges},
+		{csw.GetStorageChanges, changeset.EncodeStoragePlain, &out.storageChanges},
+		{csw.GetAccountValues, changeset.EncodeAccountsPlain, &out.accountValues},
+		{csw.GetStorageValues, changeset.EncodeStoragePlain, &out.storageValues},
+	} {
+		changes, err := cs.get()
+		if err != nil {
+			return nil, err
+		}
+		if changes.Len() == 0 {
+			continue
+		}
+		if *cs.to, err = cs.encode(changes); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// CheckDeterminism executes every block of the range twice in-process and compares the
+// changesets, the values written and the receipt roots byte by byte. The first run is
+// sequential and starts every block from a fresh state reader, the second run executes blocks
+// concurrently on the given number of workers, sharing a warm code cache between them.
+//
+// With parallel > 0 the blocks are executed a third time, each one with its transactions on
+// parallel workers, see core.ExecuteBlockParallel, and compared with the first run.
+//
+// With checkRoot the state root after every block of the first run is also computed and
+// checked against its header, see state.BlockStateRoot. The hashed state of chaindata is
+// rewound to every block, so the range has to be close to the block it is hashed at.
+func CheckDeterminism(genesis *core.Genesis, blockNum uint64, blockCount uint64, chaindata string, workers int, parallel int, checkRoot bool) error {
+	startTime := time.Now()
+	sigs := make(chan os.Signal, 1)
+	interruptCh := make(chan bool, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigs
+		interruptCh <- true
+	}()
+
+	if workers < 1 {
+		workers = 1
+	}
+	chainDb := ethdb.MustOpen(chaindata)
+	defer chainDb.Close()
+
+	chainConfig := genesis.Config
+	engine := ethash.NewFaker()
+	txCacher := core.NewTxSenderCacher(runtime.NumCPU())
+	bc, err := core.NewBlockChain(chainDb, nil, chainConfig, engine, vm.Config{}, nil, txCacher)
+	if err != nil {
+		return err
+	}
+	defer bc.Stop()
+
+	var hashedAt uint64
+	if checkRoot {
+		if hashedAt, _, err = stages.GetStageProgress(chainDb, stages.IntermediateHashes); err != nil {
+			return err
+		}
+		if blockNum == 0 || blockNum-1 > hashedAt {
+			return fmt.Errorf("the state is hashed at block %d, before block %d", hashedAt, blockNum)
+		}
+	}
+
+	var blocks []*types.Block
+	for n := blockNum; n < blockNum+blockCount; n++ {
+		if checkRoot && n-1 > hashedAt {
+			break
+		}
+		block := bc.GetBlockByNumber(n)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("no blocks from %d", blockNum)
+	}
+
+	sequential := func(reader state.StateReader, block *types.Block, csw *state.ChangeSetWriter) (types.Receipts, error) {
+		return runBlock(state.New(reader), state.NewNoopWriter(), csw, chainConfig, bc, block)
+	}
+	cold := make([]*executionOutput, len(blocks))
+	interrupt := false
+	for i, block := range blocks {
+		if cold[i], err = executeForDeterminism(sequential, state.NewPlainDBState(chainDb.KV(), block.NumberU64()-1), block); err != nil {
+			return err
+		}
+		if checkRoot {
+			root, err := state.BlockStateRoot(chainDb, hashedAt, block.NumberU64(), cold[i].writes)
+			if err != nil {
+				return fmt.Errorf("state root of block %d: %w", block.NumberU64(), err)
+			}
+			if root != block.Root() {
+				return fmt.Errorf("state root of block %d is %x, expected %x", block.NumberU64(), root, block.Root())
+			}
+		}
+		cold[i].writes = nil
+		if (i+1)%1000 == 0 {
+			log.Info("Executed cold", "blocks", i+1)
+		}
+		select {
+		case interrupt = <-interruptCh:
+			fmt.Println("interrupted, please wait for cleanup...")
+		default:
+		}
+		if interrupt {
+			blocks = blocks[:i+1]
+			break
+		}
+	}
+	log.Info("Cold run done", "blocks", len(blocks), "roots", checkRoot, "duration", time.Since(startTime))
+
+	warmStart := time.Now()
+	warm := make([]*executionOutput, len(blocks))
+	errs := make([]error, len(blocks))
+	code := &sync.Map{}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reader := &codeCacheReader{StateReader: state.NewPlainDBState(chainDb.KV(), blocks[i].NumberU64()-1), code: code}
+				warm[i], errs[i] = executeForDeterminism(sequential, reader, blocks[i])
+			}
+		}()
+	}
+	for i := range blocks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	log.Info("Warm run done", "blocks", len(blocks), "workers", workers, "duration", time.Since(warmStart))
+
+	for i, block := range blocks {
+		if errs[i] != nil {
+			return fmt.Errorf("block %d failed in the warm run only: %w", block.NumberU64(), errs[i])
+		}
+		if d := cold[i].diff(warm[i]); d != "" {
+			return fmt.Errorf("nondeterministic execution of block %d: %s differ", block.NumberU64(), d)
+		}
+	}
+
+	if parallel > 0 {
+		parallelStart := time.Now()
+		inBlock := func(reader state.StateReader, block *types.Block, csw *state.ChangeSetWriter) (types.Receipts, error) {
+			return core.ExecuteBlockParallel(chainConfig, &vm.Config{}, bc, engine, block, reader, changeSetCollector{csw}, parallel)
+		}
+		for i, block := range blocks {
+			out, err := executeForDeterminism(inBlock, state.NewPlainDBState(chainDb.KV(), block.NumberU64()-1), block)
+			if err != nil {
+				return fmt.Errorf("block %d failed in the parallel run only: %w", block.NumberU64(), err)
+			}
+			if d := cold[i].diff(out); d != "" {
+				return fmt.Errorf("parallel execution of block %d: %s differ", block.NumberU64(), d)
+			}
+		}
+		log.Info("Parallel run done", "blocks", len(blocks), "workers", parallel, "duration", time.Since(parallelStart))
+	}
+	log.Info("Execution is deterministic", "from", blockNum, "blocks", len(blocks), "duration", time.Since(startTime))
+	return nil
+}
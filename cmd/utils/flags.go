@@ -400,9 +400,18 @@ var (
 		Usage: `Configures the storage mode of the app:
 * h - write history to the DB
 * r - write receipts to the DB
-* t - write tx lookup index to the DB`,
+* t - write tx lookup index to the DB
+* c - compress the receipts and the contract code in the DB, chosen when the DB is created or upgraded`,
 		Value: ethdb.DefaultStorageMode.ToString(),
 	}
+	PruneModeFlag = cli.StringFlag{
+		Name: "prune",
+		Usage: `Configures how many blocks below the head of the data not needed to follow the chain are kept,
+all if not set, e.g. h=90000,t=1000000:
+* h - changesets, the history is queried and unwinds are done within them
+* r - receipts
+* t - tx lookup index`,
+	}
 	ArchiveSyncInterval = cli.IntFlag{
 		Name:  "archive-sync-interval",
 		Usage: "When to switch from full to archive sync",
@@ -410,7 +419,7 @@ var (
 	}
 	DatabaseFlag = cli.StringFlag{
 		Name:  "database",
-		Usage: "Which database software to use? Currently supported values: bolt & lmdb",
+		Usage: "Which database software to use? Currently supported values: bolt, lmdb & badger",
 		Value: "lmdb",
 	}
 	PrivateApiAddr = cli.StringFlag{
@@ -418,6 +427,31 @@ var (
 		Usage: "private api network address, for example: 127.0.0.1:9090, empty string means not to start the listener. do not expose to public network. serves remote database interface",
 		Value: "",
 	}
+	PrivateApiTLSCert = cli.StringFlag{
+		Name:  "private.api.tls.cert",
+		Usage: "path to the PEM certificate the private api is served with over TLS, plaintext if not set",
+		Value: "",
+	}
+	PrivateApiTLSKey = cli.StringFlag{
+		Name:  "private.api.tls.key",
+		Usage: "path to the PEM private key of --private.api.tls.cert",
+		Value: "",
+	}
+	PrivateApiTLSCACert = cli.StringFlag{
+		Name:  "private.api.tls.cacert",
+		Usage: "path to the PEM certificates of the CAs the clients of the private api must present a certificate of",
+		Value: "",
+	}
+	PrivateApiToken = cli.StringFlag{
+		Name:  "private.api.token",
+		Usage: "token the clients of the private api must send, empty string means any client is served",
+		Value: "",
+	}
+	PrivateApiWriteToken = cli.StringFlag{
+		Name:  "private.api.writetoken",
+		Usage: "token the clients of the private api must send to write to the database, empty string means the remote database interface is read-only",
+		Value: "",
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -485,6 +519,14 @@ var (
 		Name:  "vmdebug",
 		Usage: "Record information useful for VM and contract debugging",
 	}
+	VMPrefetchStateFlag = cli.BoolFlag{
+		Name:  "vm.prefetch",
+		Usage: "Read storage slots predicted by static analysis in the background before contracts are executed",
+	}
+	VMParallelTxsFlag = cli.IntFlag{
+		Name:  "vm.parallel",
+		Usage: "Execute the transactions of a block on this many threads, again in order those conflicting with the preceding ones (0 = in order)",
+	}
 	InsecureUnlockAllowedFlag = cli.BoolFlag{
 		Name:  "allow-insecure-unlock",
 		Usage: "Allow insecure account unlocking when account-related RPCs are exposed by http",
@@ -971,9 +1013,14 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 }
 
 // setPrivateApi populates configuration fields related to the remote
-// read-only interface to the databae
+// interface to the databae
 func setPrivateApi(ctx *cli.Context, cfg *node.Config) {
 	cfg.PrivateApiAddr = ctx.GlobalString(PrivateApiAddr.Name)
+	cfg.PrivateApiTLSCert = ctx.GlobalString(PrivateApiTLSCert.Name)
+	cfg.PrivateApiTLSKey = ctx.GlobalString(PrivateApiTLSKey.Name)
+	cfg.PrivateApiTLSCACert = ctx.GlobalString(PrivateApiTLSCACert.Name)
+	cfg.PrivateApiToken = ctx.GlobalString(PrivateApiToken.Name)
+	cfg.PrivateApiWriteToken = ctx.GlobalString(PrivateApiWriteToken.Name)
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -1248,7 +1295,8 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 			}
 		}
 	}
-	cfg.Bolt = strings.EqualFold(databaseFlag, "bolt") //case insensitive
+	cfg.Bolt = strings.EqualFold(databaseFlag, "bolt")     //case insensitive
+	cfg.Badger = strings.EqualFold(databaseFlag, "badger") //case insensitive
 }
 
 func setSmartCard(ctx *cli.Context, cfg *node.Config) {
@@ -1533,6 +1581,11 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	}
 
 	cfg.StorageMode = mode
+	pruneMode, err := ethdb.PruneModeFromString(ctx.GlobalString(PruneModeFlag.Name))
+	if err != nil {
+		Fatalf(fmt.Sprintf("error while parsing prune mode: %v", err))
+	}
+	cfg.PruneMode = pruneMode
 	cfg.ArchiveSyncInterval = ctx.GlobalInt(ArchiveSyncInterval.Name)
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
@@ -1554,6 +1607,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.GlobalBool(VMEnableDebugFlag.Name)
 	}
+	if ctx.GlobalIsSet(VMPrefetchStateFlag.Name) {
+		cfg.PrefetchState = ctx.GlobalBool(VMPrefetchStateFlag.Name)
+	}
+	if ctx.GlobalIsSet(VMParallelTxsFlag.Name) {
+		cfg.ParallelTxs = ctx.GlobalInt(VMParallelTxsFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(EWASMInterpreterFlag.Name) {
 		cfg.EWASMInterpreter = ctx.GlobalString(EWASMInterpreterFlag.Name)
@@ -78,6 +78,12 @@ var (
 	//value - list of block where it's changed
 	StorageHistoryBucket = "hST"
 
+	// LogAddressIndex and LogTopicIndex are the blocks of the logs of an address or with a topic
+	//key - address or topic + block number of the last element of the chunk (^uint64(0) for the current chunk)
+	//value - chunk of block numbers, in the format of the history index
+	LogAddressIndex = "log_address_index"
+	LogTopicIndex   = "log_topic_index"
+
 	//key - contract code hash
 	//value - contract code
 	CodeBucket = "CODE"
@@ -107,6 +113,11 @@ var (
 	// DatabaseInfoBucket is used to store information about data layout.
 	DatabaseInfoBucket = "DBINFO"
 
+	// DatabaseSizeBucket keeps the samples of the size of the database, see ethdb.SizeSampler
+	//key - time of the sample (unix seconds, uint64 big endian)
+	//value - size of the files and of every bucket
+	DatabaseSizeBucket = "DBSIZE"
+
 	// databaseVerisionKey tracks the current database version.
 	DatabaseVerisionKey = "DatabaseVersion"
 
@@ -158,15 +169,28 @@ var (
 
 // Keys
 var (
-	// last block that was pruned
-	// it's saved one in 5 minutes
-	LastPrunedBlockKey = []byte("LastPrunedBlock")
 	//StorageModeHistory - does node save history.
 	StorageModeHistory = []byte("smHistory")
 	//StorageModeReceipts - does node save receipts.
 	StorageModeReceipts = []byte("smReceipts")
 	//StorageModeTxIndex - does node save transactions index.
 	StorageModeTxIndex = []byte("smTxIndex")
+	//StorageModeCompression - does node compress the values of the receipts and the code.
+	StorageModeCompression = []byte("smCompression")
+	//PruneModeHistory - how many blocks of changesets the node keeps, 0 for all.
+	PruneModeHistory = []byte("pmHistory")
+	//PruneModeReceipts - how many blocks of receipts the node keeps, 0 for all.
+	PruneModeReceipts = []byte("pmReceipts")
+	//PruneModeTxIndex - how many blocks of tx lookup entries the node keeps, 0 for all.
+	PruneModeTxIndex = []byte("pmTxIndex")
+	// last blocks pruned of the changesets, receipts and tx lookup entries, big endian
+	PrunedHistory  = []byte("prunedHistory")
+	PrunedReceipts = []byte("prunedReceipts")
+	PrunedTxIndex  = []byte("prunedTxIndex")
+	// MigrationProgressPrefix + migration name -> last key committed by the unfinished migration
+	MigrationProgressPrefix = "migrationProgress_"
+	// CompressionDictPrefix + bucket -> dictionary of the compressed values of the bucket
+	CompressionDictPrefix = "compressionDict_"
 
 	HeadHeaderKey = "LastHeader"
 )
@@ -215,6 +239,9 @@ var Buckets = []string{
 	HeadFastBlockKey,
 	HeadHeaderKey,
 	Migrations,
+	LogAddressIndex,
+	LogTopicIndex,
+	DatabaseSizeBucket,
 }
 
 // DeprecatedBuckets - list of buckets which can be programmatically deleted - for example after migration
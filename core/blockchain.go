@@ -2147,28 +2147,44 @@ func ExecuteBlockEphemerally(
 		receipts = append(receipts, receipt)
 	}
 
+	if err := commitBlockEphemerally(chainConfig, engine, block, ibs, receipts, stateWriter); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// commitBlockEphemerally checks the receipts of the executed transactions, finalizes the
+// block and writes its state and changesets.
+func commitBlockEphemerally(
+	chainConfig *params.ChainConfig,
+	engine consensus.Engine,
+	block *types.Block,
+	ibs *state.IntraBlockState,
+	receipts types.Receipts,
+	stateWriter state.WriterWithChangeSets,
+) error {
+	header := block.Header()
 	if chainConfig.IsByzantium(header.Number) {
 		receiptSha := types.DeriveSha(receipts)
 		if receiptSha != block.Header().ReceiptHash {
-			return nil, fmt.Errorf("mismatched receipt headers for block %d", block.NumberU64())
+			return fmt.Errorf("mismatched receipt headers for block %d", block.NumberU64())
 		}
 	}
 
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
 	if _, err := engine.FinalizeAndAssemble(chainConfig, header, ibs, block.Transactions(), block.Uncles(), receipts); err != nil {
-		return nil, fmt.Errorf("finalize of block %d failed: %v", block.NumberU64(), err)
+		return fmt.Errorf("finalize of block %d failed: %v", block.NumberU64(), err)
 	}
 
 	ctx := chainConfig.WithEIPsFlags(context.Background(), header.Number)
 	if err := ibs.CommitBlock(ctx, stateWriter); err != nil {
-		return nil, fmt.Errorf("committing block %d failed: %v", block.NumberU64(), err)
+		return fmt.Errorf("committing block %d failed: %v", block.NumberU64(), err)
 	}
 
 	if err := stateWriter.WriteChangeSets(); err != nil {
-		return nil, fmt.Errorf("writing changesets for block %d failed: %v", block.NumberU64(), err)
+		return fmt.Errorf("writing changesets for block %d failed: %v", block.NumberU64(), err)
 	}
-
-	return receipts, nil
+	return nil
 }
 
 // InsertBodies is insertChain with execute=false and ommission of blockchain object
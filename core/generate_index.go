@@ -45,7 +45,7 @@ func (ig *IndexGenerator) GenerateIndex(startBlock, endBlock uint64, changeSetBu
 		v.IndexBucket,
 		datadir,
 		getExtractFunc(v.WalkerAdapter),
-		loadFunc,
+		LoadIndexFunc,
 		etl.TransformArgs{
 			ExtractStartKey: dbutils.EncodeTimestamp(startBlock),
 			ExtractEndKey:   dbutils.EncodeTimestamp(endBlock),
@@ -93,19 +93,24 @@ func (ig *IndexGenerator) Truncate(timestampTo uint64, changeSetBucket string) e
 		return err
 	}
 
-	historyEffects := make(map[string][]byte)
 	keySize := vv.KeySize
 	if dbutils.StorageChangeSetBucket == changeSetBucket || dbutils.PlainStorageChangeSetBucket == changeSetBucket {
 		keySize -= 8
 	}
+	return TruncateIndex(ig.db, vv.IndexBucket, keys, keySize, timestampTo)
+}
 
+// TruncateIndex removes the blocks greater than timestampTo from the chunks of the keys in
+// the indexBucket, the keys being keySize long without the incarnation.
+func TruncateIndex(db ethdb.Database, indexBucket string, keys map[string]struct{}, keySize int, timestampTo uint64) error {
+	historyEffects := make(map[string][]byte)
 	var startKey = make([]byte, keySize+8)
 
 	for key := range keys {
 		copy(startKey[:keySize], dbutils.CompositeKeyWithoutIncarnation([]byte(key)))
 
 		binary.BigEndian.PutUint64(startKey[keySize:], timestampTo)
-		if err := ig.db.Walk(vv.IndexBucket, startKey, 8*keySize, func(k, v []byte) (bool, error) {
+		if err := db.Walk(indexBucket, startKey, 8*keySize, func(k, v []byte) (bool, error) {
 			timestamp := binary.BigEndian.Uint64(k[keySize:]) // the last timestamp in the chunk
 			kStr := string(common.CopyBytes(k))
 			if timestamp > timestampTo {
@@ -126,15 +131,15 @@ func (ig *IndexGenerator) Truncate(timestampTo uint64, changeSetBucket string) e
 			return err
 		}
 	}
-	mutation := ig.db.NewBatch()
+	mutation := db.NewBatch()
 
 	for key, value := range historyEffects {
 		if value == nil {
-			if err := mutation.Delete(vv.IndexBucket, []byte(key)); err != nil {
+			if err := mutation.Delete(indexBucket, []byte(key)); err != nil {
 				return err
 			}
 		} else {
-			if err := mutation.Put(vv.IndexBucket, []byte(key), value); err != nil {
+			if err := mutation.Put(indexBucket, []byte(key), value); err != nil {
 				return err
 			}
 		}
@@ -143,7 +148,7 @@ func (ig *IndexGenerator) Truncate(timestampTo uint64, changeSetBucket string) e
 			if err != nil {
 				return err
 			}
-			mutation = ig.db.NewBatch()
+			mutation = db.NewBatch()
 		}
 	}
 	_, err := mutation.Commit()
@@ -159,7 +164,9 @@ func (ig *IndexGenerator) DropIndex(bucket string) error {
 	return casted.ClearBuckets(bucket)
 }
 
-func loadFunc(k []byte, value []byte, state etl.State, next etl.LoadNextFunc) error {
+// LoadIndexFunc appends the block numbers of the value, 8 bytes each followed by a byte 1 if the
+// value of the key at the block is empty, to the chunks of the key in the history index format.
+func LoadIndexFunc(k []byte, value []byte, state etl.State, next etl.LoadNextFunc) error {
 	if len(value)%9 != 0 {
 		log.Error("Value must be a multiple of 9", "ln", len(value), "k", common.Bytes2Hex(k))
 		return errors.New("incorrect value")
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// LogIndexBlocks returns the blocks from..to which may have logs matching the criteria of
+// eth_getLogs: of one of the addresses, if any, and with, at each position of topics which
+// isn't empty, one of its topics. The index isn't positional, the logs of the blocks are to
+// be filtered still. There must be an address or a topic, and the blocks must be indexed.
+func LogIndexBlocks(db ethdb.Getter, addresses []common.Address, topics [][]common.Hash, from, to uint64) ([]uint64, error) {
+	var matches map[uint64]struct{}
+	intersect := func(bucket string, keys [][]byte) error {
+		union := make(map[uint64]struct{})
+		for _, key := range keys {
+			if err := logIndexWalk(db, bucket, key, from, to, func(block uint64) {
+				union[block] = struct{}{}
+			}); err != nil {
+				return err
+			}
+		}
+		if matches == nil {
+			matches = union
+			return nil
+		}
+		for block := range matches {
+			if _, ok := union[block]; !ok {
+				delete(matches, block)
+			}
+		}
+		return nil
+	}
+
+	if len(addresses) > 0 {
+		keys := make([][]byte, len(addresses))
+		for i := range addresses {
+			keys[i] = addresses[i].Bytes()
+		}
+		if err := intersect(dbutils.LogAddressIndex, keys); err != nil {
+			return nil, err
+		}
+	}
+	for _, position := range topics {
+		if len(position) == 0 {
+			continue // any topic
+		}
+		keys := make([][]byte, len(position))
+		for i := range position {
+			keys[i] = position[i].Bytes()
+		}
+		if err := intersect(dbutils.LogTopicIndex, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	blocks := make([]uint64, 0, len(matches))
+	for block := range matches {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	return blocks, nil
+}
+
+func logIndexWalk(db ethdb.Getter, bucket string, key []byte, from, to uint64, walker func(block uint64)) error {
+	// the chunks are keyed by their last blocks, the first one to read is the first ending at from or after
+	startKey := make([]byte, len(key)+8)
+	copy(startKey, key)
+	binary.BigEndian.PutUint64(startKey[len(key):], from)
+	return db.Walk(bucket, startKey, 8*len(key), func(k, v []byte) (bool, error) {
+		blocks, _, err := dbutils.WrapHistoryIndex(v).Decode()
+		if err != nil {
+			return false, err
+		}
+		for _, block := range blocks {
+			if block > to {
+				return false, nil
+			}
+			if block >= from {
+				walker(block)
+			}
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,493 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/holiman/uint256"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+var (
+	parallelTxsMeter      = metrics.NewRegisteredMeter("chain/parallel/txs", nil)
+	parallelConflictMeter = metrics.NewRegisteredMeter("chain/parallel/conflicts", nil)
+)
+
+// ExecuteBlockParallel is ExecuteBlockEphemerally running the transactions of the block on
+// the workers optimistically: each one is executed on its own fork of the state at the
+// beginning of the block, see IntraBlockState.Fork, which records the keys it reads, and is
+// finalized into a ChangeSetWriter keeping the values it writes. The results are then applied
+// in order to the state of the block:
+//
+//   - a transaction conflicts if it read an account or a storage item written by one of the
+//     transactions before it, or if its speculative execution failed, or if the gas left in the
+//     block is less than its gas limit. Its result is dropped and it is executed again, with
+//     ApplyTransaction, on the state of the block.
+//   - otherwise the values it wrote are set on the state of the block, with its logs.
+//
+// The fees paid to the coinbase are added without reading it, for the transactions not to
+// conflict on them, unless they read the coinbase otherwise.
+//
+// It falls back to ExecuteBlockEphemerally with less than one worker or two transactions, for
+// the DAO fork block, and with vmConfig.Debug, the tracers expecting the transactions in order.
+//
+// The reads of stateReader are made by the calling goroutine, the transactions of the database
+// are bound to a thread.
+func ExecuteBlockParallel(
+	chainConfig *params.ChainConfig,
+	vmConfig *vm.Config,
+	chainContext ChainContext,
+	engine consensus.Engine,
+	block *types.Block,
+	stateReader state.StateReader,
+	stateWriter state.WriterWithChangeSets,
+	workers int,
+) (types.Receipts, error) {
+	txs := block.Transactions()
+	isDAOFork := chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(block.Number()) == 0
+	if workers < 1 || len(txs) < 2 || isDAOFork || vmConfig.Debug {
+		return ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter)
+	}
+	defer blockExecutionTimer.UpdateSince(time.Now())
+
+	header := block.Header()
+	coinbase, _ := engine.Author(header) // Ignore error, we're past header validation
+	results := speculateTxs(chainConfig, vmConfig, chainContext, header, coinbase, txs, stateReader, workers)
+
+	ibs := state.New(stateReader)
+	ctx := chainConfig.WithEIPsFlags(context.Background(), header.Number)
+	receipts := make(types.Receipts, 0, len(txs))
+	usedGas := new(uint64)
+	gp := new(GasPool).AddGas(block.GasLimit())
+	written := make(map[string]struct{})
+	for i, tx := range txs {
+		ibs.Prepare(tx.Hash(), block.Hash(), i)
+		writes := state.NewChangeSetWriterPlain(block.NumberU64())
+		var receipt *types.Receipt
+		if res := results[i]; res.err == nil && !res.conflicts(written) && gp.Gas() >= tx.Gas() {
+			if err := res.apply(ibs, coinbase); err != nil {
+				return nil, err
+			}
+			if err := ibs.FinalizeTx(ctx, writes); err != nil {
+				return nil, err
+			}
+			if err := gp.SubGas(res.usedGas); err != nil {
+				return nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+			}
+			*usedGas += res.usedGas
+			receipt = types.NewReceipt(res.failed, *usedGas)
+			receipt.TxHash = tx.Hash()
+			receipt.GasUsed = res.usedGas
+			if tx.To() == nil {
+				receipt.ContractAddress = res.contractAddress
+			}
+			receipt.Logs = ibs.GetLogs(tx.Hash())
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		} else {
+			parallelConflictMeter.Mark(1)
+			var err error
+			if receipt, err = ApplyTransaction(chainConfig, chainContext, nil, gp, ibs, writes, header, tx, usedGas, *vmConfig); err != nil {
+				return nil, fmt.Errorf("tx %x failed: %v", tx.Hash(), err)
+			}
+		}
+		if err := addWrittenKeys(written, writes); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	parallelTxsMeter.Mark(int64(len(txs)))
+
+	if err := commitBlockEphemerally(chainConfig, engine, block, ibs, receipts, stateWriter); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// addWrittenKeys adds the accounts and storage keys changed by a transaction, in the encoding
+// of IntraBlockState.ReadSet.
+func addWrittenKeys(written map[string]struct{}, writes *state.ChangeSetWriter) error {
+	accountChanges, err := writes.GetAccountChanges()
+	if err != nil {
+		return err
+	}
+	for _, change := range accountChanges.Changes {
+		written[string(change.Key)] = struct{}{}
+	}
+	storageChanges, err := writes.GetStorageChanges()
+	if err != nil {
+		return err
+	}
+	for _, change := range storageChanges.Changes {
+		written[string(change.Key)] = struct{}{}
+	}
+	return nil
+}
+
+// speculativeTx is the result of the execution of a transaction over the state at the
+// beginning of the block.
+type speculativeTx struct {
+	reads           map[string]struct{}       // read from the state at the beginning of the block, see IntraBlockState.ReadSet
+	writes          *state.ChangeSetWriter    // keeping the values written
+	codes           map[common.Address][]byte // of the accounts written with code
+	logs            []*types.Log
+	preimages       map[common.Hash][]byte
+	fee             uint256.Int // paid to the coinbase and not added yet
+	failed          bool
+	usedGas         uint64
+	contractAddress common.Address
+	err             error
+}
+
+func (s *speculativeTx) conflicts(written map[string]struct{}) bool {
+	if len(written) < len(s.reads) {
+		for k := range written {
+			if _, ok := s.reads[k]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	for k := range s.reads {
+		if _, ok := written[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply sets the values written by the transaction on the state of the block, which is the
+// state it was executed on for the keys it read, and adds the fee to the coinbase.
+func (s *speculativeTx) apply(ibs *state.IntraBlockState, coinbase common.Address) error {
+	accountValues, err := s.writes.GetAccountValues()
+	if err != nil {
+		return err
+	}
+	for _, change := range accountValues.Changes {
+		address := common.BytesToAddress(change.Key)
+		if len(change.Value) == 0 {
+			// self-destructed, or empty and touched: deleted when the transaction is finalized
+			if !ibs.Suicide(address) {
+				ibs.AddBalance(address, new(uint256.Int))
+			}
+			continue
+		}
+		var account accounts.Account
+		if err := account.DecodeForStorage(change.Value); err != nil {
+			return err
+		}
+		if account.Incarnation != ibs.GetIncarnation(address) {
+			ibs.CreateAccount(address, true)
+		}
+		ibs.SetBalance(address, &account.Balance)
+		ibs.SetNonce(address, account.Nonce)
+		if !account.IsEmptyCodeHash() && account.CodeHash != ibs.GetCodeHash(address) {
+			ibs.SetCode(address, s.codes[address])
+		}
+	}
+	storageValues, err := s.writes.GetStorageValues()
+	if err != nil {
+		return err
+	}
+	for _, change := range storageValues.Changes {
+		address, _, key := dbutils.PlainParseCompositeStorageKey(change.Key)
+		var value uint256.Int
+		value.SetBytes(change.Value)
+		ibs.SetState(address, &key, value)
+	}
+	for _, log := range s.logs {
+		ibs.AddLog(log)
+	}
+	for hash, preimage := range s.preimages {
+		ibs.AddPreimage(hash, preimage)
+	}
+	if !s.fee.IsZero() {
+		ibs.AddBalance(coinbase, &s.fee)
+	}
+	return nil
+}
+
+func speculateTxs(
+	chainConfig *params.ChainConfig,
+	vmConfig *vm.Config,
+	chainContext ChainContext,
+	header *types.Header,
+	coinbase common.Address,
+	txs types.Transactions,
+	stateReader state.StateReader,
+	workers int,
+) []*speculativeTx {
+	cfg := *vmConfig
+	cfg.Prefetcher = nil
+	cfg.SkipAnalysis = SkipAnalysis(chainConfig, header.Number.Uint64())
+	signer := types.MakeSigner(chainConfig, header.Number)
+
+	reads := make(chan func())
+	serial := func(read func()) {
+		done := make(chan struct{})
+		reads <- func() {
+			read()
+			close(done)
+		}
+		<-done
+	}
+	base := state.New(&serialReader{reader: stateReader, serial: serial})
+	results := make([]*speculativeTx, len(txs))
+	next := make(chan int, len(txs))
+	for i := range txs {
+		next <- i
+	}
+	close(next)
+	finished := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(txs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = speculateTx(chainConfig, cfg, chainContext, header, coinbase, signer, txs[i], base, serial)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	for {
+		select {
+		case read := <-reads:
+			read()
+		case <-finished:
+			return results
+		}
+	}
+}
+
+func speculateTx(
+	chainConfig *params.ChainConfig,
+	cfg vm.Config,
+	chainContext ChainContext,
+	header *types.Header,
+	coinbase common.Address,
+	signer types.Signer,
+	tx *types.Transaction,
+	base *state.IntraBlockState,
+	serial func(func()),
+) *speculativeTx {
+	res := &speculativeTx{}
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	ibs := base.Fork()
+	defer ibs.Discard()
+	res.reads = ibs.ReadSet()
+	ctx := chainConfig.WithEIPsFlags(context.Background(), header.Number)
+	ibs.Prepare(tx.Hash(), common.Hash{}, 0)
+	specState := &speculativeState{IntraBlockState: ibs, coinbase: coinbase, pendingSnapshots: make(map[int]uint256.Int)}
+
+	context := NewEVMContext(msg, header, chainContext, &coinbase)
+	getHash := context.GetHash
+	context.GetHash = func(n uint64) (hash common.Hash) {
+		serial(func() { hash = getHash(n) })
+		return hash
+	}
+	if cfg.TraceJumpDest {
+		context.TxHash = tx.Hash()
+	}
+	vmenv := vm.NewEVM(context, specState, chainConfig, cfg)
+	result, err := ApplyMessage(vmenv, msg, new(GasPool).AddGas(header.GasLimit))
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.failed = result.Failed()
+	res.usedGas = result.UsedGas
+	if msg.To() == nil {
+		res.contractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
+	}
+	res.fee = specState.pending
+	res.writes = state.NewChangeSetWriterPlainWithValues(header.Number.Uint64())
+	if res.err = ibs.FinalizeTx(ctx, res.writes); res.err != nil {
+		return res
+	}
+	accountValues, err := res.writes.GetAccountValues()
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.codes = make(map[common.Address][]byte)
+	for _, change := range accountValues.Changes {
+		var account accounts.Account
+		if len(change.Value) == 0 || account.DecodeForStorage(change.Value) != nil || account.IsEmptyCodeHash() {
+			continue
+		}
+		address := common.BytesToAddress(change.Key)
+		res.codes[address] = ibs.GetCode(address)
+	}
+	res.logs = ibs.GetLogs(tx.Hash())
+	res.preimages = ibs.Preimages()
+	return res
+}
+
+// serialReader makes the reads of the state at the beginning of the block on the goroutine
+// executing the block.
+type serialReader struct {
+	reader state.StateReader
+	serial func(func())
+}
+
+func (r *serialReader) ReadAccountData(address common.Address) (account *accounts.Account, err error) {
+	r.serial(func() { account, err = r.reader.ReadAccountData(address) })
+	return account, err
+}
+
+func (r *serialReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) (enc []byte, err error) {
+	r.serial(func() { enc, err = r.reader.ReadAccountStorage(address, incarnation, key) })
+	return enc, err
+}
+
+func (r *serialReader) ReadAccountCode(address common.Address, codeHash common.Hash) (code []byte, err error) {
+	r.serial(func() { code, err = r.reader.ReadAccountCode(address, codeHash) })
+	return code, err
+}
+
+func (r *serialReader) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (size int, err error) {
+	r.serial(func() { size, err = r.reader.ReadAccountCodeSize(address, codeHash) })
+	return size, err
+}
+
+func (r *serialReader) ReadAccountIncarnation(address common.Address) (incarnation uint64, err error) {
+	r.serial(func() { incarnation, err = r.reader.ReadAccountIncarnation(address) })
+	return incarnation, err
+}
+
+// speculativeState is the fork of a transaction with the amounts added to the coinbase pending
+// until the coinbase is used otherwise, so that paying the fees doesn't read it.
+type speculativeState struct {
+	*state.IntraBlockState
+	coinbase         common.Address
+	pending          uint256.Int // added to the coinbase
+	pendingSnapshots map[int]uint256.Int
+}
+
+// use adds the pending amount to the coinbase before it is used.
+func (s *speculativeState) use(addr common.Address) {
+	if addr != s.coinbase || s.pending.IsZero() {
+		return
+	}
+	s.IntraBlockState.AddBalance(addr, &s.pending)
+	s.pending.Clear()
+}
+
+func (s *speculativeState) CreateAccount(addr common.Address, contractCreation bool) {
+	s.use(addr)
+	s.IntraBlockState.CreateAccount(addr, contractCreation)
+}
+
+func (s *speculativeState) SubBalance(addr common.Address, amount *uint256.Int) {
+	s.use(addr)
+	s.IntraBlockState.SubBalance(addr, amount)
+}
+
+func (s *speculativeState) AddBalance(addr common.Address, amount *uint256.Int) {
+	if addr == s.coinbase && !amount.IsZero() {
+		s.pending.Add(&s.pending, amount)
+		return
+	}
+	s.use(addr)
+	s.IntraBlockState.AddBalance(addr, amount)
+}
+
+func (s *speculativeState) GetBalance(addr common.Address) *uint256.Int {
+	s.use(addr)
+	return s.IntraBlockState.GetBalance(addr)
+}
+
+func (s *speculativeState) GetNonce(addr common.Address) uint64 {
+	s.use(addr)
+	return s.IntraBlockState.GetNonce(addr)
+}
+
+func (s *speculativeState) SetNonce(addr common.Address, nonce uint64) {
+	s.use(addr)
+	s.IntraBlockState.SetNonce(addr, nonce)
+}
+
+func (s *speculativeState) GetCodeHash(addr common.Address) common.Hash {
+	s.use(addr)
+	return s.IntraBlockState.GetCodeHash(addr)
+}
+
+func (s *speculativeState) GetCode(addr common.Address) []byte {
+	s.use(addr)
+	return s.IntraBlockState.GetCode(addr)
+}
+
+func (s *speculativeState) SetCode(addr common.Address, code []byte) {
+	s.use(addr)
+	s.IntraBlockState.SetCode(addr, code)
+}
+
+func (s *speculativeState) GetCodeSize(addr common.Address) int {
+	s.use(addr)
+	return s.IntraBlockState.GetCodeSize(addr)
+}
+
+func (s *speculativeState) GetCommittedState(addr common.Address, key *common.Hash, value *uint256.Int) {
+	s.use(addr)
+	s.IntraBlockState.GetCommittedState(addr, key, value)
+}
+
+func (s *speculativeState) GetState(addr common.Address, key *common.Hash, value *uint256.Int) {
+	s.use(addr)
+	s.IntraBlockState.GetState(addr, key, value)
+}
+
+func (s *speculativeState) SetState(addr common.Address, key *common.Hash, value uint256.Int) {
+	s.use(addr)
+	s.IntraBlockState.SetState(addr, key, value)
+}
+
+func (s *speculativeState) Suicide(addr common.Address) bool {
+	s.use(addr)
+	return s.IntraBlockState.Suicide(addr)
+}
+
+func (s *speculativeState) HasSuicided(addr common.Address) bool {
+	s.use(addr)
+	return s.IntraBlockState.HasSuicided(addr)
+}
+
+func (s *speculativeState) Exist(addr common.Address) bool {
+	s.use(addr)
+	return s.IntraBlockState.Exist(addr)
+}
+
+func (s *speculativeState) Empty(addr common.Address) bool {
+	s.use(addr)
+	return s.IntraBlockState.Empty(addr)
+}
+
+func (s *speculativeState) Snapshot() int {
+	id := s.IntraBlockState.Snapshot()
+	s.pendingSnapshots[id] = s.pending
+	return id
+}
+
+func (s *speculativeState) RevertToSnapshot(id int) {
+	s.IntraBlockState.RevertToSnapshot(id)
+	s.pending = s.pendingSnapshots[id]
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"runtime"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+func TestExecuteBlockParallel(t *testing.T) {
+	var (
+		keys     = make([]*ecdsa.PrivateKey, 10)
+		addrs    = make([]common.Address, len(keys))
+		counter  = common.HexToAddress("0xc0")            // increments its slot 0
+		balancer = common.HexToAddress("0xc1")            // stores the balance of the coinbase in its slot 0
+		logger   = common.HexToAddress("0xc2")            // logs
+		doomed   = common.HexToAddress("0xc3")            // self-destructs, to the caller
+		incr     = common.FromHex("60005460010160005500") // also the init code of the contracts created
+		price    = uint256.NewInt().SetUint64(1)
+		value    = uint256.NewInt().SetUint64(1000)
+	)
+	alloc := GenesisAlloc{
+		counter:  {Balance: big.NewInt(0), Code: incr},
+		balancer: {Balance: big.NewInt(0), Code: common.FromHex("413160005500")},
+		logger:   {Balance: big.NewInt(0), Code: common.FromHex("60006000a0")},
+		doomed:   {Balance: big.NewInt(params.Ether), Code: common.FromHex("33ff")},
+	}
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+		alloc[addrs[i]] = GenesisAccount{Balance: big.NewInt(params.Ether)}
+	}
+	gspec := &Genesis{Config: params.TestChainConfig, Alloc: alloc}
+
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	signer := types.MakeSigner(gspec.Config, big.NewInt(1))
+	blocks, _, err := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, b *BlockGen) {
+		b.SetCoinbase(addrs[5])
+		add := func(from int, to *common.Address, gas uint64, data []byte) {
+			var tx *types.Transaction
+			if to == nil {
+				tx = types.NewContractCreation(b.TxNonce(addrs[from]), value, gas, price, data)
+			} else {
+				tx = types.NewTransaction(b.TxNonce(addrs[from]), *to, value, gas, price, data)
+			}
+			signed, err := types.SignTx(tx, signer, keys[from])
+			require.NoError(t, err)
+			b.AddTx(signed)
+		}
+		add(0, &common.Address{0xa0}, params.TxGas, nil)
+		add(0, &common.Address{0xa1}, params.TxGas, nil) // the sender of the preceding
+		add(1, &counter, 100000, nil)
+		add(2, &counter, 100000, nil)  // the storage of the preceding
+		add(3, &balancer, 100000, nil) // the coinbase
+		add(4, &addrs[0], params.TxGas, nil)
+		add(5, &common.Address{0xa0}, params.TxGas, nil) // sent by the coinbase
+		add(6, nil, 100000, incr)
+		add(7, &common.Address{byte(i)}, params.TxGas, nil)
+		add(8, &logger, 100000, nil)
+		add(9, &doomed, 100000, nil)
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+
+	execute := func(workers int) (*ethdb.ObjectDatabase, []types.Receipts) {
+		db := ethdb.NewMemDatabase()
+		gspec.MustCommit(db)
+		txCacher := NewTxSenderCacher(runtime.NumCPU())
+		bc, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, txCacher)
+		require.NoError(t, err)
+		defer bc.Stop()
+		var receipts []types.Receipts
+		for _, block := range blocks {
+			stateReader := state.NewPlainStateReader(db)
+			stateWriter := state.NewPlainStateWriter(db, block.NumberU64())
+			r, err := ExecuteBlockParallel(gspec.Config, &vm.Config{}, bc, bc.Engine(), block, stateReader, stateWriter, workers)
+			require.NoError(t, err)
+			receipts = append(receipts, r)
+		}
+		return db, receipts
+	}
+	serialDb, serialReceipts := execute(0)
+	defer serialDb.Close()
+	parallelDb, parallelReceipts := execute(4)
+	defer parallelDb.Close()
+
+	assert.Equal(t, serialReceipts, parallelReceipts)
+	for _, bucket := range []string{
+		dbutils.PlainStateBucket,
+		dbutils.PlainContractCodeBucket,
+		dbutils.PlainAccountChangeSetBucket,
+		dbutils.PlainStorageChangeSetBucket,
+	} {
+		assert.Equal(t, bucketContents(t, serialDb, bucket), bucketContents(t, parallelDb, bucket), bucket)
+	}
+}
+
+func bucketContents(t *testing.T, db *ethdb.ObjectDatabase, bucket string) map[string]string {
+	contents := make(map[string]string)
+	require.NoError(t, db.KV().View(context.Background(), func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucket)
+		for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			contents[string(k)] = string(v)
+		}
+		return nil
+	}))
+	return contents
+}
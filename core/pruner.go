@@ -123,19 +123,18 @@ func (p *BasicPruner) Stop() {
 	log.Info("Pruning stopped")
 }
 
+// ReadLastPrunedBlockNum returns the last block whose history was pruned, kept like that
+// of the Prune stage of the staged sync.
 func (p *BasicPruner) ReadLastPrunedBlockNum() uint64 {
-	data, _ := p.db.Get(dbutils.DatabaseInfoBucket, dbutils.LastPrunedBlockKey)
-	if len(data) == 0 {
-		return 0
-	}
-	return binary.LittleEndian.Uint64(data)
+	num, _ := ethdb.GetPruned(p.db, dbutils.PrunedHistory)
+	return num
 }
 
-// WriteHeadBlockHash stores the head block's hash.
+// WriteLastPrunedBlockNum stores the last block whose history was pruned.
 func (p *BasicPruner) WriteLastPrunedBlockNum(num uint64) {
 	b := make([]byte, 8)
-	binary.LittleEndian.PutUint64(b, num)
-	if err := p.db.Put(dbutils.DatabaseInfoBucket, dbutils.LastPrunedBlockKey, b); err != nil {
+	binary.BigEndian.PutUint64(b, num)
+	if err := p.db.Put(dbutils.DatabaseInfoBucket, dbutils.PrunedHistory, b); err != nil {
 		log.Crit("Failed to store last pruned block's num", "err", err)
 	}
 }
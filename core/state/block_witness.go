@@ -0,0 +1,395 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+// WitnessReader is a StateReader recording the accounts, storage and code read through it,
+// which the witness of a block has to prove, see BlockWitness.
+type WitnessReader struct {
+	reader   StateReader
+	accounts map[common.Address]struct{}
+	storage  map[common.Address]map[common.Hash]struct{}
+	codes    map[common.Address]struct{}
+}
+
+func NewWitnessReader(reader StateReader) *WitnessReader {
+	return &WitnessReader{
+		reader:   reader,
+		accounts: make(map[common.Address]struct{}),
+		storage:  make(map[common.Address]map[common.Hash]struct{}),
+		codes:    make(map[common.Address]struct{}),
+	}
+}
+
+// Touch records an account, and a storage item of it if key is not nil, as if it was read.
+// It is for the items written without being read first.
+func (r *WitnessReader) Touch(address common.Address, key *common.Hash) {
+	r.accounts[address] = struct{}{}
+	if key == nil {
+		return
+	}
+	m, ok := r.storage[address]
+	if !ok {
+		m = make(map[common.Hash]struct{})
+		r.storage[address] = m
+	}
+	m[*key] = struct{}{}
+}
+
+// TouchChanges records the accounts and storage items of the changesets of a ChangeSetWriter,
+// see Touch.
+func (r *WitnessReader) TouchChanges(w *ChangeSetWriter) error {
+	accountChanges, err := w.GetAccountChanges()
+	if err != nil {
+		return err
+	}
+	for _, change := range accountChanges.Changes {
+		r.Touch(common.BytesToAddress(change.Key), nil)
+	}
+	storageChanges, err := w.GetStorageChanges()
+	if err != nil {
+		return err
+	}
+	for _, change := range storageChanges.Changes {
+		address, _, key := dbutils.PlainParseCompositeStorageKey(change.Key)
+		r.Touch(address, &key)
+	}
+	return nil
+}
+
+func (r *WitnessReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r.Touch(address, nil)
+	return r.reader.ReadAccountData(address)
+}
+
+func (r *WitnessReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r.Touch(address, key)
+	return r.reader.ReadAccountStorage(address, incarnation, key)
+}
+
+func (r *WitnessReader) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	r.Touch(address, nil)
+	r.codes[address] = struct{}{}
+	return r.reader.ReadAccountCode(address, codeHash)
+}
+
+func (r *WitnessReader) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	r.Touch(address, nil)
+	r.codes[address] = struct{}{}
+	return r.reader.ReadAccountCodeSize(address, codeHash)
+}
+
+func (r *WitnessReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	r.Touch(address, nil)
+	return r.reader.ReadAccountIncarnation(address)
+}
+
+// BlockWitness builds the witness of the items recorded by r, read by the replay of block
+// blockNr on top of the state of block blockNr-1: the proofs of the accounts and storage items
+// against the state root of block blockNr-1, and the code of the contracts.
+//
+// Only the latest hashed state is kept, so db must hold the hashed state and the intermediate
+// hashes of block head, head >= blockNr-1, see rewoundTrie. The further head is the more it
+// costs.
+func BlockWitness(db ethdb.Database, head uint64, blockNr uint64, r *WitnessReader) (*trie.Witness, error) {
+	if blockNr == 0 || blockNr-1 > head {
+		return nil, fmt.Errorf("the hashed state of block %d can not be rewound to block %d", head, blockNr-1)
+	}
+	t, err := rewoundTrie(db, head, blockNr-1, r.accounts, r.storage)
+	if err != nil {
+		return nil, err
+	}
+
+	witnessList := trie.NewRetainList(0)
+	for address := range r.accounts {
+		addrHash := crypto.Keccak256Hash(address[:])
+		witnessList.AddKey(addrHash[:])
+	}
+	for address, keys := range r.storage {
+		addrHash := crypto.Keccak256Hash(address[:])
+		for key := range keys {
+			witnessList.AddKey(dbutils.GenerateCompositeTrieKey(addrHash, crypto.Keccak256Hash(key[:])))
+		}
+	}
+	for address := range r.codes {
+		addrHash := crypto.Keccak256Hash(address[:])
+		acc, ok := t.GetAccount(addrHash[:])
+		if !ok || acc == nil || acc.IsEmptyCodeHash() {
+			continue
+		}
+		code, err := db.Get(dbutils.CodeBucket, acc.CodeHash[:])
+		if err != nil {
+			return nil, fmt.Errorf("code %x of %x: %w", acc.CodeHash, address, err)
+		}
+		if err := t.UpdateAccountCode(addrHash[:], code); err != nil {
+			return nil, err
+		}
+		witnessList.AddCodeTouch(acc.CodeHash)
+	}
+	return t.ExtractWitness(false, witnessList)
+}
+
+// BlockStateRoot computes the state root after block blockNr from the values written by its
+// replay, kept by w, see NewChangeSetWriterPlainWithValues. They are applied to the part of the
+// trie of block blockNr-1 holding them, rewound from the hashed state of block head like for
+// BlockWitness, head >= blockNr-1.
+func BlockStateRoot(db ethdb.Database, head uint64, blockNr uint64, w *ChangeSetWriter) (common.Hash, error) {
+	if w.accountValues == nil {
+		return common.Hash{}, errValuesNotKept
+	}
+	if blockNr == 0 || blockNr-1 > head {
+		return common.Hash{}, fmt.Errorf("the hashed state of block %d can not be rewound to block %d", head, blockNr-1)
+	}
+	accountKeys := make(map[common.Address]struct{}, len(w.accountChanges))
+	for address := range w.accountChanges {
+		accountKeys[address] = struct{}{}
+	}
+	storageKeys := make(map[common.Address]map[common.Hash]struct{})
+	for k := range w.storageChanges {
+		address, _, key := dbutils.PlainParseCompositeStorageKey([]byte(k))
+		if _, ok := storageKeys[address]; !ok {
+			storageKeys[address] = make(map[common.Hash]struct{})
+		}
+		storageKeys[address][key] = struct{}{}
+	}
+	t, err := rewoundTrie(db, head, blockNr-1, accountKeys, storageKeys)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// The incarnations written, the storage of the others is gone with their accounts
+	incarnations := make(map[common.Address]uint64, len(w.accountChanges))
+	for address, original := range w.accountChanges {
+		addrHash := crypto.Keccak256Hash(address[:])
+		v := w.accountValues[address]
+		if len(v) == 0 {
+			t.Delete(addrHash[:])
+			continue
+		}
+		acc := new(accounts.Account)
+		if err := acc.DecodeForStorage(v); err != nil {
+			return common.Hash{}, err
+		}
+		var before accounts.Account
+		if len(original) > 0 {
+			if err := before.DecodeForStorage(original); err != nil {
+				return common.Hash{}, err
+			}
+		}
+		if len(original) == 0 || before.Incarnation != acc.Incarnation {
+			t.Delete(addrHash[:]) // with the storage of the previous incarnation
+			acc.Root = trie.EmptyRoot
+		}
+		t.UpdateAccount(addrHash[:], acc) // keeps the storage otherwise
+		incarnations[address] = acc.Incarnation
+	}
+	for k, v := range w.storageValues {
+		address, inc, key := dbutils.PlainParseCompositeStorageKey([]byte(k))
+		if current, ok := incarnations[address]; !ok || inc != current {
+			continue
+		}
+		cKey := dbutils.GenerateCompositeTrieKey(crypto.Keccak256Hash(address[:]), crypto.Keccak256Hash(key[:]))
+		if len(v) == 0 {
+			t.Delete(cKey)
+		} else {
+			t.Update(cKey, v)
+		}
+	}
+	return t.Hash(), nil
+}
+
+// rewoundTrie returns the part of the state trie of block blockNr holding the accounts and the
+// storage items, built from the hashed state and the intermediate hashes of block head in db
+// and rewound in memory with the plain changesets of the blocks after blockNr. Its root is
+// checked against the header of blockNr.
+//
+// The storage of the accounts which had another incarnation at blockNr, recreated or deleted
+// since, isn't in the trie of head. It is left in the hashed state under the keys of their
+// incarnation at blockNr, and their whole storage trie is rebuilt from there.
+func rewoundTrie(db ethdb.Database, head, blockNr uint64, accountKeys map[common.Address]struct{}, storageKeys map[common.Address]map[common.Hash]struct{}) (*trie.Trie, error) {
+	header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, blockNr), blockNr)
+	if header == nil {
+		return nil, fmt.Errorf("header of block %d not found", blockNr)
+	}
+	accountChanges, storageChanges, err := ethdb.RewindDataPlain(db, head, blockNr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The accounts at blockNr which changed since, nil for those which didn't exist
+	past := make(map[common.Address]*accounts.Account, len(accountChanges))
+	for k, v := range accountChanges {
+		address := common.BytesToAddress([]byte(k))
+		if len(v) == 0 {
+			past[address] = nil
+			continue
+		}
+		acc := new(accounts.Account)
+		if err := acc.DecodeForStorage(v); err != nil {
+			return nil, err
+		}
+		// The code hashes are omitted from the changesets of the updates
+		if acc.Incarnation > 0 && acc.IsEmptyCodeHash() {
+			codeHash, err := db.Get(dbutils.PlainContractCodeBucket, dbutils.PlainGenerateStoragePrefix(address[:], acc.Incarnation))
+			if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+				return nil, err
+			}
+			copy(acc.CodeHash[:], codeHash)
+		}
+		past[address] = acc
+	}
+
+	// The loader takes the storage of the incarnations at head
+	loadList := trie.NewRetainList(0)
+	heads := make(map[common.Address]uint64)
+	loadAccount := func(address common.Address) error {
+		if _, ok := heads[address]; ok {
+			return nil
+		}
+		addrHash := crypto.Keccak256Hash(address[:])
+		var acc accounts.Account
+		if _, err := rawdb.ReadAccount(db, addrHash, &acc); err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return err
+		}
+		heads[address] = acc.Incarnation
+		loadList.AddKey(addrHash[:])
+		return nil
+	}
+	// incarnation is that of the account at blockNr, false if it didn't exist or has to be rebuilt
+	incarnation := func(address common.Address) (uint64, bool) {
+		acc, changed := past[address]
+		switch {
+		case !changed:
+			return heads[address], true
+		case acc == nil || acc.Incarnation != heads[address]:
+			return 0, false
+		}
+		return acc.Incarnation, true
+	}
+	for address := range accountKeys {
+		if err := loadAccount(address); err != nil {
+			return nil, err
+		}
+	}
+	for address := range storageKeys {
+		if err := loadAccount(address); err != nil {
+			return nil, err
+		}
+	}
+	for address := range past {
+		if err := loadAccount(address); err != nil {
+			return nil, err
+		}
+	}
+	for k := range storageChanges {
+		address, _, _ := dbutils.PlainParseCompositeStorageKey([]byte(k))
+		if err := loadAccount(address); err != nil {
+			return nil, err
+		}
+	}
+	loadStorage := func(address common.Address, key common.Hash) {
+		if inc, ok := incarnation(address); ok {
+			loadList.AddKey(dbutils.GenerateCompositeStorageKey(crypto.Keccak256Hash(address[:]), inc, crypto.Keccak256Hash(key[:])))
+		}
+	}
+	for address, keys := range storageKeys {
+		for key := range keys {
+			loadStorage(address, key)
+		}
+	}
+	for k := range storageChanges {
+		address, _, key := dbutils.PlainParseCompositeStorageKey([]byte(k))
+		loadStorage(address, key)
+	}
+
+	loader := trie.NewFlatDbSubTrieLoader()
+	if err := loader.Reset(db, loadList, loadList, nil, [][]byte{nil}, []int{0}, false); err != nil {
+		return nil, err
+	}
+	subTries, err := loader.LoadSubTries()
+	if err != nil {
+		return nil, err
+	}
+	t := trie.New(subTries.Hashes[0])
+	if err := t.HookSubTries(subTries, [][]byte{nil}); err != nil {
+		return nil, err
+	}
+
+	// The storage changes of the accounts rebuilt, by account, the others are rewound in place
+	rebuilt := make(map[common.Address]map[common.Hash][]byte)
+	for address, acc := range past {
+		addrHash := crypto.Keccak256Hash(address[:])
+		if acc == nil {
+			t.Delete(addrHash[:])
+			continue
+		}
+		if _, ok := incarnation(address); ok {
+			t.UpdateAccount(addrHash[:], acc) // keeps the storage
+			continue
+		}
+		t.Delete(addrHash[:]) // with the storage of the incarnation at head
+		acc.Root = trie.EmptyRoot
+		t.UpdateAccount(addrHash[:], acc)
+		rebuilt[address] = make(map[common.Hash][]byte)
+	}
+	for k, v := range storageChanges {
+		address, inc, key := dbutils.PlainParseCompositeStorageKey([]byte(k))
+		if changes, ok := rebuilt[address]; ok {
+			if inc == past[address].Incarnation {
+				changes[crypto.Keccak256Hash(key[:])] = v
+			}
+			continue
+		}
+		if current, ok := incarnation(address); !ok || inc != current {
+			continue // of another incarnation, the keys of the trie don't have them
+		}
+		cKey := dbutils.GenerateCompositeTrieKey(crypto.Keccak256Hash(address[:]), crypto.Keccak256Hash(key[:]))
+		if len(v) == 0 {
+			t.Delete(cKey)
+		} else {
+			t.Update(cKey, v)
+		}
+	}
+	for address, changes := range rebuilt {
+		if err := rebuildStorage(db, t, address, past[address].Incarnation, changes); err != nil {
+			return nil, err
+		}
+	}
+	if root := t.Hash(); root != header.Root {
+		return nil, fmt.Errorf("state root %x of the trie rewound to block %d, expected %x", root, blockNr, header.Root)
+	}
+	return t, nil
+}
+
+// rebuildStorage inserts the storage of an incarnation of the account left in the hashed state,
+// with the values of the changes by hashed key overriding it, into t.
+func rebuildStorage(db ethdb.Database, t *trie.Trie, address common.Address, incarnation uint64, changes map[common.Hash][]byte) error {
+	addrHash := crypto.Keccak256Hash(address[:])
+	values := make(map[common.Hash][]byte)
+	prefix := dbutils.GenerateStoragePrefix(addrHash[:], incarnation)
+	if err := db.Walk(dbutils.CurrentStateBucket, prefix, 8*len(prefix), func(k, v []byte) (bool, error) {
+		values[common.BytesToHash(k[len(prefix):])] = common.CopyBytes(v)
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	for keyHash, v := range changes {
+		values[keyHash] = v
+	}
+	for keyHash, v := range values {
+		if len(v) > 0 {
+			t.Update(dbutils.GenerateCompositeTrieKey(addrHash, keyHash), v)
+		}
+	}
+	return nil
+}
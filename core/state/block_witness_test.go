@@ -0,0 +1,175 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"runtime"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/consensus/ethash"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/params"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+func TestBlockWitness(t *testing.T) {
+	var (
+		key, _  = crypto.GenerateKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		counter = common.HexToAddress("0xc0") // increments its slot 0
+		// The phoenix stores its input in its slot 0, or self-destructs without input. It is
+		// recreated by the factory, which runs its input as the init code with CREATE2.
+		phoenixCode = common.FromHex("3615600c57600035600055005b33ff")
+		phoenixInit = append(common.FromHex("600f80600b6000396000f3"), phoenixCode...)
+		factory     = common.HexToAddress("0xf0")
+		phoenix     = crypto.CreateAddress2(factory, common.Hash{}, crypto.Keccak256(phoenixInit))
+		gspec       = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				address: {Balance: big.NewInt(params.Ether)},
+				counter: {Balance: big.NewInt(0), Code: common.FromHex("60005460010160005500")},
+				factory: {Balance: big.NewInt(0), Code: common.FromHex("36600060003760003660006000f500")},
+				phoenix: {Balance: big.NewInt(0), Code: phoenixCode, Storage: map[common.Hash]common.Hash{{}: common.BytesToHash([]byte{5})}},
+			},
+		}
+		signer = types.MakeSigner(gspec.Config, big.NewInt(1))
+	)
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	genesis := gspec.MustCommit(db)
+	// The phoenix stores 9 in block 1, self-destructs in block 2, is recreated in block 3 and
+	// stores 3 in its new incarnation in block 4.
+	type call struct {
+		to   common.Address
+		data []byte
+	}
+	phoenixCalls := []call{
+		{phoenix, common.LeftPadBytes([]byte{9}, 32)},
+		{phoenix, nil},
+		{factory, phoenixInit},
+		{phoenix, common.LeftPadBytes([]byte{3}, 32)},
+	}
+	blocks, _, err := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 4, func(i int, b *core.BlockGen) {
+		for _, c := range []call{{counter, nil}, {common.Address{0xa0, byte(i)}, nil}, phoenixCalls[i]} {
+			tx, err := types.SignTx(types.NewTransaction(b.TxNonce(address), c.to, uint256.NewInt().SetUint64(1000), 200000, uint256.NewInt().SetUint64(1), c.data), signer, key)
+			require.NoError(t, err)
+			b.AddTx(tx)
+		}
+	}, false /* intermediateHashes */)
+	require.NoError(t, err)
+
+	// The plain state and changesets as executed by the staged sync, and the hashed state of the head.
+	// The blocks are replayed on another database, executed up to their parents.
+	txCacher := core.NewTxSenderCacher(runtime.NumCPU())
+	bc, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, txCacher)
+	require.NoError(t, err)
+	defer bc.Stop()
+	replayDb := ethdb.NewMemDatabase()
+	defer replayDb.Close()
+	gspec.MustCommit(replayDb)
+	readers := make(map[uint64]*state.WitnessReader)
+	writers := make(map[uint64]*state.ChangeSetWriter)
+	for _, block := range blocks {
+		bn := block.NumberU64()
+		if bn > 1 {
+			reader := state.NewWitnessReader(state.NewPlainStateReader(replayDb))
+			writer := state.NewChangeSetWriterPlainWithValues(bn - 1)
+			ibs := state.New(reader)
+			gp, usedGas := new(core.GasPool).AddGas(block.GasLimit()), new(uint64)
+			for _, tx := range block.Transactions() {
+				_, err = core.ApplyTransaction(gspec.Config, bc, nil, gp, ibs, state.NewNoopWriter(), block.Header(), tx, usedGas, vm.Config{})
+				require.NoError(t, err)
+			}
+			bc.Engine().Finalize(gspec.Config, block.Header(), ibs, block.Transactions(), block.Uncles())
+			require.NoError(t, ibs.CommitBlock(context.Background(), writer))
+			require.NoError(t, reader.TouchChanges(writer))
+			readers[bn] = reader
+			writers[bn] = writer
+		}
+		for _, db := range []*ethdb.ObjectDatabase{db, replayDb} {
+			_, err = core.ExecuteBlockEphemerally(gspec.Config, &vm.Config{}, bc, bc.Engine(), block, state.NewPlainStateReader(db), state.NewPlainStateWriter(db, bn))
+			require.NoError(t, err)
+		}
+		rawdb.WriteHeader(context.Background(), db, block.Header())
+		rawdb.WriteCanonicalHash(db, block.Hash(), bn)
+	}
+	hashState(t, db)
+	var phoenixAcc accounts.Account
+	ok, err := rawdb.ReadAccount(db, crypto.Keccak256Hash(phoenix[:]), &phoenixAcc)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(2), phoenixAcc.Incarnation, "recreated")
+
+	for bn, reader := range readers {
+		witness, err := state.BlockWitness(db, 4, bn, reader)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		stats, err := witness.WriteTo(&buf)
+		require.NoError(t, err)
+		assert.NotZero(t, stats.CodesSize()) // of the counter
+		witness, err = trie.NewWitnessFromReader(&buf, false)
+		require.NoError(t, err)
+		tr, err := trie.BuildTrieFromWitness(witness, false, false)
+		require.NoError(t, err)
+		assert.Equal(t, blocks[bn-2].Root(), tr.Hash())
+
+		acc, ok := tr.GetAccount(crypto.Keccak256(address[:]))
+		require.True(t, ok)
+		assert.Equal(t, 3*(bn-1), acc.Nonce)
+		slot, ok := tr.Get(dbutils.GenerateCompositeTrieKey(crypto.Keccak256Hash(counter[:]), crypto.Keccak256Hash(common.Hash{}.Bytes())))
+		require.True(t, ok)
+		assert.Equal(t, []byte{byte(bn - 1)}, slot)
+
+		// The storage of the phoenix is that of its incarnation at the parent
+		acc, ok = tr.GetAccount(crypto.Keccak256(phoenix[:]))
+		slot, _ = tr.Get(dbutils.GenerateCompositeTrieKey(crypto.Keccak256Hash(phoenix[:]), crypto.Keccak256Hash(common.Hash{}.Bytes())))
+		switch bn {
+		case 2:
+			require.True(t, ok)
+			assert.Equal(t, []byte{9}, slot)
+		case 3:
+			assert.Nil(t, acc, "self-destructed")
+		case 4:
+			require.True(t, ok)
+			assert.Nil(t, slot, "recreated")
+		}
+	}
+
+	_, err = state.BlockWitness(db, 1, 3, state.NewWitnessReader(state.NewPlainStateReader(db)))
+	assert.Error(t, err)
+
+	for bn, writer := range writers {
+		root, err := state.BlockStateRoot(db, 4, bn, writer)
+		require.NoError(t, err)
+		assert.Equal(t, blocks[bn-1].Root(), root, "block %d", bn)
+	}
+	_, err = state.BlockStateRoot(db, 4, 2, state.NewChangeSetWriterPlain(1))
+	assert.Error(t, err, "values not kept")
+}
+
+// hashState writes the hashed state of the plain state.
+func hashState(t *testing.T, db *ethdb.ObjectDatabase) {
+	require.NoError(t, db.ClearBuckets(dbutils.CurrentStateBucket))
+	require.NoError(t, db.Walk(dbutils.PlainStateBucket, nil, 0, func(k, v []byte) (bool, error) {
+		if len(k) == common.AddressLength {
+			return true, db.Put(dbutils.CurrentStateBucket, crypto.Keccak256(k), common.CopyBytes(v))
+		}
+		address, incarnation, key := dbutils.PlainParseCompositeStorageKey(k)
+		hashedKey := dbutils.GenerateCompositeStorageKey(crypto.Keccak256Hash(address[:]), incarnation, crypto.Keccak256Hash(key[:]))
+		return true, db.Put(dbutils.CurrentStateBucket, hashedKey, common.CopyBytes(v))
+	}))
+}
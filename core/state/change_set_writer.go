@@ -2,6 +2,7 @@ package state
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/holiman/uint256"
@@ -48,6 +49,8 @@ type ChangeSetWriter struct {
 	accountChanges map[common.Address][]byte
 	storageChanged map[common.Address]bool
 	storageChanges map[string][]byte
+	accountValues  map[common.Address][]byte // nil unless the values written are kept
+	storageValues  map[string][]byte
 	storageFactory changesetFactory
 	accountFactory changesetFactory
 	accountKeyGen  accountKeyGen
@@ -79,6 +82,15 @@ func NewChangeSetWriterPlain(blockNumber uint64) *ChangeSetWriter {
 	}
 }
 
+// NewChangeSetWriterPlainWithValues is NewChangeSetWriterPlain also keeping the values
+// written, for the diffs of the block, see GetAccountValues and GetStorageValues.
+func NewChangeSetWriterPlainWithValues(blockNumber uint64) *ChangeSetWriter {
+	w := NewChangeSetWriterPlain(blockNumber)
+	w.accountValues = make(map[common.Address][]byte)
+	w.storageValues = make(map[string][]byte)
+	return w
+}
+
 func (w *ChangeSetWriter) GetAccountChanges() (*changeset.ChangeSet, error) {
 	cs := w.accountFactory()
 	for address, val := range w.accountChanges {
@@ -102,6 +114,41 @@ func (w *ChangeSetWriter) GetStorageChanges() (*changeset.ChangeSet, error) {
 	return cs, nil
 }
 
+var errValuesNotKept = errors.New("the values written are not kept, see NewChangeSetWriterPlainWithValues")
+
+// GetAccountValues returns the values written to the accounts of GetAccountChanges, in the
+// storage encoding with the hashes, empty for the accounts deleted.
+func (w *ChangeSetWriter) GetAccountValues() (*changeset.ChangeSet, error) {
+	if w.accountValues == nil {
+		return nil, errValuesNotKept
+	}
+	cs := w.accountFactory()
+	for address := range w.accountChanges {
+		key, err := w.accountKeyGen(address)
+		if err != nil {
+			return nil, err
+		}
+		if err := cs.Add(key, w.accountValues[address]); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// GetStorageValues returns the values written to the keys of GetStorageChanges.
+func (w *ChangeSetWriter) GetStorageValues() (*changeset.ChangeSet, error) {
+	if w.storageValues == nil {
+		return nil, errValuesNotKept
+	}
+	cs := w.storageFactory()
+	for key := range w.storageChanges {
+		if err := cs.Add([]byte(key), w.storageValues[key]); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
 func accountsEqual(a1, a2 *accounts.Account) bool {
 	if a1.Nonce != a2.Nonce {
 		return false
@@ -132,6 +179,9 @@ func (w *ChangeSetWriter) UpdateAccountData(ctx context.Context, address common.
 
 		w.accountChanges[address] = originalAccountData(original, true /*omitHashes*/)
 	}
+	if w.accountValues != nil {
+		w.accountValues[address] = originalAccountData(account, false)
+	}
 	return nil
 }
 
@@ -141,6 +191,9 @@ func (w *ChangeSetWriter) UpdateAccountCode(address common.Address, incarnation
 
 func (w *ChangeSetWriter) DeleteAccount(ctx context.Context, address common.Address, original *accounts.Account) error {
 	w.accountChanges[address] = originalAccountData(original, false)
+	if w.accountValues != nil {
+		w.accountValues[address] = []byte{}
+	}
 	return nil
 }
 
@@ -156,6 +209,9 @@ func (w *ChangeSetWriter) WriteAccountStorage(ctx context.Context, address commo
 
 	w.storageChanges[string(compositeKey)] = original.Bytes()
 	w.storageChanged[address] = true
+	if w.storageValues != nil {
+		w.storageValues[string(compositeKey)] = value.Bytes()
+	}
 
 	return nil
 }
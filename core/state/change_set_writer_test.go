@@ -0,0 +1,54 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+)
+
+func TestChangeSetWriterValues(t *testing.T) {
+	ctx := context.Background()
+	updated, unchanged, deleted := common.HexToAddress("0x1"), common.HexToAddress("0x2"), common.HexToAddress("0x3")
+	original := accounts.NewAccount()
+	original.Initialised = true
+	original.Nonce = 1
+	account := original.SelfCopy()
+	account.Nonce = 2
+
+	w := NewChangeSetWriterPlainWithValues(1)
+	require.NoError(t, w.UpdateAccountData(ctx, updated, &original, account))
+	require.NoError(t, w.UpdateAccountData(ctx, unchanged, &original, &original))
+	require.NoError(t, w.DeleteAccount(ctx, deleted, &original))
+	key1, key2 := common.HexToHash("0x1"), common.HexToHash("0x2")
+	require.NoError(t, w.WriteAccountStorage(ctx, updated, 1, &key1, uint256.NewInt().SetUint64(1), uint256.NewInt().SetUint64(2)))
+	require.NoError(t, w.WriteAccountStorage(ctx, updated, 1, &key2, uint256.NewInt().SetUint64(3), uint256.NewInt().SetUint64(3)))
+
+	changes, err := w.GetAccountChanges()
+	require.NoError(t, err)
+	values, err := w.GetAccountValues()
+	require.NoError(t, err)
+	require.Len(t, values.Changes, len(changes.Changes))
+	byKey := map[common.Address][]byte{}
+	for _, ch := range values.Changes {
+		byKey[common.BytesToAddress(ch.Key)] = ch.Value
+	}
+	assert.Equal(t, originalAccountData(account, false), byKey[updated])
+	assert.Equal(t, []byte{}, byKey[deleted])
+	assert.NotContains(t, byKey, unchanged)
+
+	storageValues, err := w.GetStorageValues()
+	require.NoError(t, err)
+	require.Len(t, storageValues.Changes, 1)
+	assert.Equal(t, dbutils.PlainGenerateCompositeStorageKey(updated, 1, key1), storageValues.Changes[0].Key)
+	assert.Equal(t, []byte{2}, storageValues.Changes[0].Value)
+
+	_, err = NewChangeSetWriterPlain(1).GetAccountValues()
+	assert.Error(t, err, "the values are only kept on demand")
+}
@@ -22,32 +22,40 @@ const MaxChangesetsSearch = 256
 func GetAsOf(db ethdb.KV, storage bool, key []byte, timestamp uint64) ([]byte, error) {
 	var dat []byte
 	err := db.View(context.Background(), func(tx ethdb.Tx) error {
-		v, err := FindByHistory(tx, storage, key, timestamp)
-		if err == nil {
-			dat = make([]byte, len(v))
-			copy(dat, v)
-			return nil
-		}
-		if !errors.Is(err, ethdb.ErrKeyNotFound) {
-			return err
-		}
-		{
-			v, err := tx.Get(dbutils.PlainStateBucket, key)
-			if err != nil {
-				return err
-			}
-			if v == nil {
-				return ethdb.ErrKeyNotFound
-			}
-			dat = make([]byte, len(v))
-			copy(dat, v)
-			return nil
-		}
+		var err error
+		dat, err = GetAsOfTx(tx, storage, key, timestamp)
+		return err
 	})
 	return dat, err
 }
 
+// GetAsOfTx is like GetAsOf, but reads within the given transaction, so that several
+// reads can observe the same database snapshot.
+func GetAsOfTx(tx ethdb.Tx, storage bool, key []byte, timestamp uint64) ([]byte, error) {
+	v, err := FindByHistory(tx, storage, key, timestamp)
+	if err == nil {
+		return common.CopyBytes(v), nil
+	}
+	if !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, err
+	}
+	v, err = tx.Get(dbutils.PlainStateBucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ethdb.ErrKeyNotFound
+	}
+	return common.CopyBytes(v), nil
+}
+
+// FindByHistory returns the value of key as of the block timestamp found in the history,
+// ethdb.ErrKeyNotFound if it didn't change since, or ethdb.ErrPruned if the changesets of the
+// block were pruned.
 func FindByHistory(tx ethdb.Tx, storage bool, key []byte, timestamp uint64) ([]byte, error) {
+	if err := checkPruned(tx, timestamp); err != nil {
+		return nil, err
+	}
 	var hBucket string
 	if storage {
 		hBucket = dbutils.StorageHistoryBucket
@@ -180,11 +188,30 @@ func FindByHistory(tx ethdb.Tx, storage bool, key []byte, timestamp uint64) ([]b
 	return data, nil
 }
 
+// checkPruned returns ethdb.ErrPruned if the changesets needed for the state as of the block
+// timestamp, those of the blocks from timestamp on, were pruned. Without them the history
+// would give the current values.
+func checkPruned(tx ethdb.Tx, timestamp uint64) error {
+	pruned, err := ethdb.GetPruned(tx, dbutils.PrunedHistory)
+	if err != nil {
+		return err
+	}
+	if timestamp <= pruned {
+		return fmt.Errorf("%w: the state as of block %d, the changesets up to block %d were pruned", ethdb.ErrPruned, timestamp, pruned)
+	}
+	return nil
+}
+
 func WalkAsOf(db ethdb.KV, bucket string, hBucket string, startkey []byte, fixedbits int, timestamp uint64, walker func(k []byte, v []byte) (bool, error)) error {
 	//fmt.Printf("WalkAsOf %x %x %x %d %d\n", bucket, hBucket, startkey, fixedbits, timestamp)
 	if !(bucket == dbutils.PlainStateBucket || bucket == dbutils.CurrentStateBucket) {
 		return fmt.Errorf("unsupported state bucket: %s", string(bucket))
 	}
+	if err := db.View(context.Background(), func(tx ethdb.Tx) error {
+		return checkPruned(tx, timestamp)
+	}); err != nil {
+		return err
+	}
 	if hBucket == dbutils.AccountsHistoryBucket {
 		return walkAsOfThinAccounts(db, bucket, hBucket, startkey, fixedbits, timestamp, walker)
 	} else if hBucket == dbutils.StorageHistoryBucket {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -2311,3 +2312,138 @@ func assertChangesEquals(t *testing.T, changesObtained, changesExpected *changes
 		t.Fatal("block result is incorrect")
 	}
 }
+
+func TestHistoryView(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	tds := NewTrieDbState(common.Hash{}, db, 1)
+
+	addr := common.Address{1}
+	key := common.Hash{123}
+	block3Val := uint256.NewInt().SetBytes([]byte("block 3"))
+	stateVal := uint256.NewInt().SetBytes([]byte("state"))
+	emptyAcc := accounts.NewAccount()
+	acc3 := accounts.NewAccount()
+	acc3.Initialised = true
+	acc3.Balance.SetUint64(3)
+	acc3.Incarnation = 1
+	acc5 := acc3.SelfCopy()
+	acc5.Balance.SetUint64(5)
+
+	// the accounts and the storage of a block share the writer, each writer writes both changesets
+	writeBlock := func(blockNr uint64, original, account *accounts.Account, originalVal, val *uint256.Int) {
+		tds.SetBlockNr(blockNr)
+		blockWriter := tds.PlainStateWriter()
+		if err := blockWriter.UpdateAccountData(context.Background(), addr, original, account); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockWriter.WriteAccountStorage(context.Background(), addr, 1, &key, originalVal, val); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockWriter.WriteChangeSets(); err != nil {
+			t.Fatal(err)
+		}
+		if err := blockWriter.WriteHistory(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeBlock(3, &emptyAcc, &acc3, uint256.NewInt(), block3Val)
+	writeBlock(5, &acc3, acc5, block3Val, stateVal)
+
+	storageKey := dbutils.PlainGenerateCompositeStorageKey(addr, 1, key)
+	for _, tc := range []struct {
+		blockNr uint64
+		balance uint64
+		value   []byte
+	}{
+		{2, 0, nil},
+		{3, 3, block3Val.Bytes()},
+		{4, 3, block3Val.Bytes()},
+		{5, 5, stateVal.Bytes()},
+		{6, 5, stateVal.Bytes()},
+	} {
+		view := NewHistoryView(db.KV(), tc.blockNr)
+		err := view.View(context.Background(), func(tx ethdb.Tx) error {
+			enc, err := tx.Get(dbutils.PlainStateBucket, addr[:])
+			if err != nil {
+				return err
+			}
+			if tc.balance == 0 {
+				assert.Nil(t, enc, "account at block %d", tc.blockNr)
+			} else {
+				var acc accounts.Account
+				if err = acc.DecodeForStorage(enc); err != nil {
+					return err
+				}
+				assert.Equal(t, tc.balance, acc.Balance.Uint64(), "balance at block %d", tc.blockNr)
+			}
+			v, err := tx.Cursor(dbutils.PlainStateBucket).SeekExact(storageKey)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, tc.value, v, "storage at block %d", tc.blockNr)
+			values, err := tx.MultiGet(dbutils.PlainStateBucket, [][]byte{addr[:], storageKey, common.Address{2}.Bytes()})
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, [][]byte{enc, tc.value, nil}, values, "multi get at block %d", tc.blockNr)
+			_, _, err = tx.Cursor(dbutils.PlainStateBucket).First()
+			assert.Error(t, err, "iterating the plain state")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	view := NewHistoryView(db.KV(), 4)
+	assert.Equal(t, ErrHistoryViewReadOnly, view.Update(context.Background(), func(tx ethdb.Tx) error { return nil }))
+	var walked [][]byte
+	startKey := make([]byte, common.AddressLength+common.HashLength)
+	copy(startKey, addr[:])
+	if err := view.Walk(dbutils.StorageHistoryBucket, startKey, 8*common.AddressLength, func(k, v []byte) (bool, error) {
+		walked = append(walked, common.CopyBytes(v))
+		return true, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, [][]byte{block3Val.Bytes()}, walked)
+}
+
+func TestGetAsOfPruned(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	addrs, accState, _, _, _ := generateAccountsWithStorageAndHistory(t, db, 1, 1)
+
+	// the changesets of block 2 are pruned, its history index is kept
+	for _, bucket := range []string{dbutils.PlainAccountChangeSetBucket, dbutils.PlainStorageChangeSetBucket} {
+		if err := db.Delete(bucket, dbutils.EncodeTimestamp(2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pruned := make([]byte, 8)
+	binary.BigEndian.PutUint64(pruned, 2)
+	if err := db.Put(dbutils.DatabaseInfoBucket, dbutils.PrunedHistory, pruned); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := GetAsOf(db.KV(), false /* storage */, addrs[0].Bytes(), 2)
+	assert.True(t, errors.Is(err, ethdb.ErrPruned), "%v", err)
+	err = WalkAsOf(db.KV(), dbutils.PlainStateBucket, dbutils.AccountsHistoryBucket, nil, 0, 1, func(k, v []byte) (bool, error) {
+		return true, nil
+	})
+	assert.True(t, errors.Is(err, ethdb.ErrPruned), "%v", err)
+	_, err = NewPlainDBState(db.KV(), 1).ReadAccountData(addrs[0])
+	assert.True(t, errors.Is(err, ethdb.ErrPruned), "%v", err)
+
+	// the state after the pruned blocks is readable
+	enc, err := GetAsOf(db.KV(), false /* storage */, addrs[0].Bytes(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acc accounts.Account
+	if err = acc.DecodeForStorage(enc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, accState[0].Balance, acc.Balance)
+}
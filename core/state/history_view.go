@@ -0,0 +1,211 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+var ErrHistoryViewReadOnly = errors.New("historical view is read-only")
+
+// HistoryView is the database as of the state after a block: reads of PlainStateBucket
+// compose the plain state with the changesets, as GetAsOfTx, other buckets are read as they
+// are. The view does not own the database, closing it is a no-op.
+type HistoryView struct {
+	kv      ethdb.KV
+	blockNr uint64
+}
+
+// NewHistoryView opens a view of kv pinned at the state after blockNr.
+func NewHistoryView(kv ethdb.KV, blockNr uint64) *HistoryView {
+	return &HistoryView{kv: kv, blockNr: blockNr}
+}
+
+func (v *HistoryView) BlockNumber() uint64 {
+	return v.blockNr
+}
+
+func (v *HistoryView) View(ctx context.Context, f func(tx ethdb.Tx) error) error {
+	return v.kv.View(ctx, func(tx ethdb.Tx) error {
+		return f(NewHistoryTx(tx, v.blockNr))
+	})
+}
+
+func (v *HistoryView) Update(ctx context.Context, f func(tx ethdb.Tx) error) error {
+	return ErrHistoryViewReadOnly
+}
+
+func (v *HistoryView) Begin(ctx context.Context, parent ethdb.Tx, writable bool) (ethdb.Tx, error) {
+	if writable {
+		return nil, ErrHistoryViewReadOnly
+	}
+	if h, ok := parent.(*historyTx); ok {
+		parent = h.Tx
+	}
+	tx, err := v.kv.Begin(ctx, parent, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewHistoryTx(tx, v.blockNr), nil
+}
+
+func (v *HistoryView) Close() {}
+
+func (v *HistoryView) IdealBatchSize() int {
+	return v.kv.IdealBatchSize()
+}
+
+// Walk is WalkAsOf of the plain state at the block of the view, hBucket selects accounts or
+// storage. Cursors of the view only support SeekExact.
+func (v *HistoryView) Walk(hBucket string, startkey []byte, fixedbits int, walker func(k []byte, v []byte) (bool, error)) error {
+	return WalkAsOf(v.kv, dbutils.PlainStateBucket, hBucket, startkey, fixedbits, v.blockNr+1, walker)
+}
+
+// NewHistoryTx reads within tx as of the state after blockNr, like the transactions of a
+// HistoryView, so that reads at several blocks can share a snapshot. Rolling it back rolls
+// back tx.
+func NewHistoryTx(tx ethdb.Tx, blockNr uint64) ethdb.Tx {
+	if h, ok := tx.(*historyTx); ok {
+		tx = h.Tx
+	}
+	return &historyTx{Tx: tx, blockNr: blockNr}
+}
+
+type historyTx struct {
+	ethdb.Tx
+	blockNr uint64
+}
+
+// Get reads the account, or the storage for composite keys, as of the block, nil if it did
+// not exist or was deleted.
+func (tx *historyTx) Get(bucket string, key []byte) ([]byte, error) {
+	if bucket != dbutils.PlainStateBucket {
+		return tx.Tx.Get(bucket, key)
+	}
+	v, err := GetAsOfTx(tx.Tx, len(key) > common.AddressLength, key, tx.blockNr+1)
+	if errors.Is(err, ethdb.ErrKeyNotFound) || len(v) == 0 {
+		return nil, nil
+	}
+	return v, err
+}
+
+// MultiGet finds the keys of PlainStateBucket in the history one by one, and reads those
+// not changed since the block from the plain state at once.
+func (tx *historyTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	if bucket != dbutils.PlainStateBucket {
+		return tx.Tx.MultiGet(bucket, keys)
+	}
+	values := make([][]byte, len(keys))
+	var current []int // of the keys not found in the history
+	var currentKeys [][]byte
+	for i, key := range keys {
+		v, err := FindByHistory(tx.Tx, len(key) > common.AddressLength, key, tx.blockNr+1)
+		if errors.Is(err, ethdb.ErrKeyNotFound) {
+			current = append(current, i)
+			currentKeys = append(currentKeys, key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(v) > 0 {
+			values[i] = common.CopyBytes(v)
+		}
+	}
+	if len(currentKeys) == 0 {
+		return values, nil
+	}
+	currentValues, err := tx.Tx.MultiGet(dbutils.PlainStateBucket, currentKeys)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range current {
+		if len(currentValues[j]) > 0 {
+			values[i] = common.CopyBytes(currentValues[j])
+		}
+	}
+	return values, nil
+}
+
+func (tx *historyTx) Cursor(bucket string) ethdb.Cursor {
+	if bucket != dbutils.PlainStateBucket {
+		return tx.Tx.Cursor(bucket)
+	}
+	return &historyViewCursor{tx: tx}
+}
+
+func (tx *historyTx) Commit(ctx context.Context) error {
+	return ErrHistoryViewReadOnly
+}
+
+// historyViewCursor reads PlainStateBucket as of the block of the view. Iterating needs
+// merging the changesets with the plain state, which is what HistoryView.Walk does.
+type historyViewCursor struct {
+	tx *historyTx
+}
+
+var errHistoryViewIterate = fmt.Errorf("cursors of %s in a historical view only support SeekExact, iterate with HistoryView.Walk", dbutils.PlainStateBucket)
+
+func (c *historyViewCursor) Prefix(v []byte) ethdb.Cursor   { return c }
+func (c *historyViewCursor) MatchBits(uint) ethdb.Cursor    { return c }
+func (c *historyViewCursor) Prefetch(v uint) ethdb.Cursor   { return c }
+func (c *historyViewCursor) Range(_, _ []byte) ethdb.Cursor { return c }
+func (c *historyViewCursor) NoValues() ethdb.NoValuesCursor { return &historyViewNoValuesCursor{} }
+
+func (c *historyViewCursor) SeekExact(key []byte) ([]byte, error) {
+	return c.tx.Get(dbutils.PlainStateBucket, key)
+}
+
+func (c *historyViewCursor) First() ([]byte, []byte, error) {
+	return nil, nil, errHistoryViewIterate
+}
+
+func (c *historyViewCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	return nil, nil, errHistoryViewIterate
+}
+
+func (c *historyViewCursor) Next() ([]byte, []byte, error) {
+	return nil, nil, errHistoryViewIterate
+}
+
+func (c *historyViewCursor) Last() ([]byte, []byte, error) {
+	return nil, nil, errHistoryViewIterate
+}
+
+func (c *historyViewCursor) Walk(walker func(k, v []byte) (bool, error)) error {
+	return errHistoryViewIterate
+}
+
+func (c *historyViewCursor) Put(key []byte, value []byte) error {
+	return ErrHistoryViewReadOnly
+}
+
+func (c *historyViewCursor) Delete(key []byte) error {
+	return ErrHistoryViewReadOnly
+}
+
+func (c *historyViewCursor) Append(key []byte, value []byte) error {
+	return ErrHistoryViewReadOnly
+}
+
+type historyViewNoValuesCursor struct{}
+
+func (c *historyViewNoValuesCursor) First() ([]byte, uint32, error) {
+	return nil, 0, errHistoryViewIterate
+}
+
+func (c *historyViewNoValuesCursor) Seek(seek []byte) ([]byte, uint32, error) {
+	return nil, 0, errHistoryViewIterate
+}
+
+func (c *historyViewNoValuesCursor) Next() ([]byte, uint32, error) {
+	return nil, 0, errHistoryViewIterate
+}
+
+func (c *historyViewNoValuesCursor) Walk(walker func(k []byte, vSize uint32) (bool, error)) error {
+	return errHistoryViewIterate
+}
@@ -97,6 +97,8 @@ type IntraBlockState struct {
 	nextRevisionID int
 	tracer         StateTracer
 	trace          bool
+
+	reads map[string]struct{} // keys read from the parent of a fork, see Fork
 }
 
 // Create a new state from a given trie
@@ -0,0 +1,153 @@
+package state
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+)
+
+// Fork returns an overlay of the state for speculative execution, e.g. of the transactions of a
+// block in parallel or of calls on top of each other. The fork starts from the state of sdb and
+// keeps its changes to itself, nothing is copied: the accounts, storage and code are read from
+// sdb when the fork needs them, and recorded, see ReadSet and WriteSet.
+//
+// sdb must not change while its forks are used. The forks can be used concurrently, the reader
+// of sdb then has to be safe for concurrent use. Forks of forks are allowed.
+func (sdb *IntraBlockState) Fork() *IntraBlockState {
+	sdb.RLock()
+	defer sdb.RUnlock()
+	reads := make(map[string]struct{})
+	fork := New(&forkReader{parent: sdb, reads: reads})
+	fork.reads = reads
+	fork.thash, fork.bhash, fork.txIndex = sdb.thash, sdb.bhash, sdb.txIndex
+	fork.logSize = sdb.logSize
+	return fork
+}
+
+// Discard drops the fork and its changes, it can't be used after.
+func (sdb *IntraBlockState) Discard() {
+	sdb.Lock()
+	defer sdb.Unlock()
+	sdb.stateReader = nil
+	sdb.stateObjects = nil
+	sdb.stateObjectsDirty = nil
+	sdb.nilAccounts = nil
+	sdb.logs = nil
+	sdb.preimages = nil
+	sdb.journal = nil
+	sdb.reads = nil
+}
+
+// ReadSet returns the keys the fork read from its parent: the addresses of the accounts, also
+// for their code and incarnation, and the plain composite keys of the storage. It is nil for
+// the states which are not forks.
+func (sdb *IntraBlockState) ReadSet() map[string]struct{} {
+	sdb.RLock()
+	defer sdb.RUnlock()
+	return sdb.reads
+}
+
+// WriteSet returns the keys of the accounts and storage changed, or only touched, since the
+// state was created or forked, in the encoding of ReadSet.
+func (sdb *IntraBlockState) WriteSet() map[string]struct{} {
+	sdb.RLock()
+	defer sdb.RUnlock()
+	writes := make(map[string]struct{})
+	add := func(addr common.Address) {
+		stateObject, ok := sdb.stateObjects[addr]
+		if !ok {
+			return
+		}
+		writes[string(addr[:])] = struct{}{}
+		for key := range stateObject.dirtyStorage {
+			writes[string(dbutils.PlainGenerateCompositeStorageKey(addr, stateObject.data.GetIncarnation(), key))] = struct{}{}
+		}
+	}
+	for addr := range sdb.journal.dirties {
+		add(addr)
+	}
+	for addr := range sdb.stateObjectsDirty {
+		add(addr)
+	}
+	return writes
+}
+
+// forkReader reads the state of the parent of a fork. The parent is only read locked and left
+// as is, what it didn't load is read from its reader without being kept, so that the forks
+// don't wait for each other.
+type forkReader struct {
+	parent *IntraBlockState
+	reads  map[string]struct{}
+}
+
+// object is the live object of the parent, nil if the parent didn't load the account.
+// The parent must be read locked.
+func (r *forkReader) object(address common.Address) *stateObject {
+	r.reads[string(address[:])] = struct{}{}
+	return r.parent.stateObjects[address]
+}
+
+func (r *forkReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	r.parent.RLock()
+	defer r.parent.RUnlock()
+	stateObject := r.object(address)
+	if stateObject == nil {
+		if _, ok := r.parent.nilAccounts[address]; ok {
+			return nil, nil
+		}
+		return r.parent.stateReader.ReadAccountData(address)
+	}
+	if stateObject.deleted {
+		return nil, nil
+	}
+	var account accounts.Account
+	account.Copy(&stateObject.data)
+	return &account, nil
+}
+
+func (r *forkReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	r.parent.RLock()
+	defer r.parent.RUnlock()
+	r.reads[string(dbutils.PlainGenerateCompositeStorageKey(address, incarnation, *key))] = struct{}{}
+	stateObject := r.object(address)
+	if stateObject == nil || stateObject.deleted || stateObject.data.GetIncarnation() != incarnation {
+		return r.parent.stateReader.ReadAccountStorage(address, incarnation, key)
+	}
+	value, ok := stateObject.dirtyStorage[*key]
+	if !ok {
+		if value, ok = stateObject.originStorage[*key]; !ok && !stateObject.created {
+			return r.parent.stateReader.ReadAccountStorage(address, incarnation, key)
+		}
+	}
+	if value.IsZero() {
+		return nil, nil
+	}
+	return value.Bytes(), nil
+}
+
+func (r *forkReader) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
+	r.parent.RLock()
+	defer r.parent.RUnlock()
+	if stateObject := r.object(address); stateObject != nil && stateObject.data.CodeHash == codeHash && stateObject.code != nil {
+		return stateObject.code, nil
+	}
+	return r.parent.stateReader.ReadAccountCode(address, codeHash)
+}
+
+func (r *forkReader) ReadAccountCodeSize(address common.Address, codeHash common.Hash) (int, error) {
+	r.parent.RLock()
+	defer r.parent.RUnlock()
+	if stateObject := r.object(address); stateObject != nil && stateObject.data.CodeHash == codeHash && stateObject.code != nil {
+		return len(stateObject.code), nil
+	}
+	return r.parent.stateReader.ReadAccountCodeSize(address, codeHash)
+}
+
+func (r *forkReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	r.parent.RLock()
+	defer r.parent.RUnlock()
+	if stateObject := r.object(address); stateObject != nil && stateObject.suicided {
+		return stateObject.data.Incarnation, nil
+	}
+	return r.parent.stateReader.ReadAccountIncarnation(address)
+}
@@ -0,0 +1,81 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestFork(t *testing.T) {
+	ctx := context.Background()
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ibs := New(NewPlainStateReader(db))
+	addr, contract, suicided := common.HexToAddress("0x1"), common.HexToAddress("0x2"), common.HexToAddress("0x3")
+	key, other := common.HexToHash("0x4"), common.HexToHash("0x5")
+	code := []byte{0x60, 0x00}
+
+	ibs.AddBalance(addr, uint256.NewInt().SetUint64(10))
+	ibs.CreateAccount(contract, true)
+	ibs.SetCode(contract, code)
+	ibs.SetState(contract, &key, *uint256.NewInt().SetUint64(5))
+	ibs.AddBalance(suicided, uint256.NewInt().SetUint64(1))
+	require.NoError(t, ibs.FinalizeTx(ctx, NewNoopWriter()))
+	ibs.Suicide(suicided)
+	require.NoError(t, ibs.FinalizeTx(ctx, NewNoopWriter()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fork := ibs.Fork()
+			defer fork.Discard()
+			var value uint256.Int
+			fork.GetState(contract, &key, &value)
+			assert.Equal(t, uint64(5), value.Uint64())
+			assert.Equal(t, code, fork.GetCode(contract))
+			assert.Equal(t, uint64(10), fork.GetBalance(addr).Uint64())
+			assert.False(t, fork.Exist(suicided))
+		}()
+	}
+	wg.Wait()
+
+	fork := ibs.Fork()
+	fork.AddBalance(addr, uint256.NewInt().SetUint64(1))
+	fork.SetState(contract, &other, *uint256.NewInt().SetUint64(7))
+	assert.Equal(t, uint64(11), fork.GetBalance(addr).Uint64())
+	assert.Equal(t, uint64(10), ibs.GetBalance(addr).Uint64())
+	var value uint256.Int
+	ibs.GetState(contract, &other, &value)
+	assert.True(t, value.IsZero())
+
+	inc := ibs.GetIncarnation(contract)
+	assert.Equal(t, map[string]struct{}{
+		string(addr[:]):     {},
+		string(contract[:]): {},
+		string(dbutils.PlainGenerateCompositeStorageKey(contract, inc, other)): {},
+	}, fork.ReadSet())
+	assert.Equal(t, map[string]struct{}{
+		string(addr[:]):     {},
+		string(contract[:]): {},
+		string(dbutils.PlainGenerateCompositeStorageKey(contract, inc, other)): {},
+	}, fork.WriteSet())
+
+	nested := fork.Fork()
+	nested.GetState(contract, &other, &value)
+	assert.Equal(t, uint64(7), value.Uint64())
+	nested.Discard()
+
+	fork.Discard()
+	assert.Nil(t, fork.ReadSet())
+	assert.Equal(t, uint64(10), ibs.GetBalance(addr).Uint64())
+}
@@ -73,7 +73,10 @@ func (dbs *PlainDBState) ForEachStorage(addr common.Address, start []byte, cb fu
 	st := llrb.New()
 	var s [common.AddressLength + common.IncarnationLength + common.HashLength]byte
 	copy(s[:], addr[:])
-	accData, _ := GetAsOf(dbs.db, false /* storage */, addr[:], dbs.blockNr+1)
+	accData, err := GetAsOf(dbs.db, false /* storage */, addr[:], dbs.blockNr+1)
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return err
+	}
 	var acc accounts.Account
 	if err := acc.DecodeForStorage(accData); err != nil {
 		log.Error("Error decoding account", "error", err)
@@ -173,7 +176,10 @@ func (dbs *PlainDBState) ForEachAccount(start []byte, cb func(address *common.Ad
 
 func (dbs *PlainDBState) ReadAccountData(address common.Address) (*accounts.Account, error) {
 	enc, err := GetAsOf(dbs.db, false /* storage */, address[:], dbs.blockNr+1)
-	if err != nil || enc == nil || len(enc) == 0 {
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, err
+	}
+	if len(enc) == 0 {
 		return nil, nil
 	}
 	var acc accounts.Account
@@ -0,0 +1,124 @@
+package state
+
+import (
+	"context"
+	"sort"
+
+	"github.com/holiman/uint256"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+)
+
+var _ StateWriter = (*TxChangeSetWriter)(nil)
+
+// TxChangeSetWriter collects the changes of a block by transaction: it is the writer of the
+// FinalizeTx calls of an IntraBlockState executing the block, and SetTxNum tells the index of
+// the transaction whose changes follow. The changes of CommitBlock are those of the transaction
+// number following the last one, e.g. the rewards.
+//
+// FinalizeTx passes the values at the beginning of the block as the originals, the writer
+// replaces them with the values left by the preceding transactions, for every transaction to
+// only hold the changes it made, with their values before and after it.
+type TxChangeSetWriter struct {
+	blockNumber uint64
+	txNum       uint64
+	txs         map[uint64]*ChangeSetWriter
+	accounts    map[common.Address]*accounts.Account // last written, an empty account once deleted
+	storage     map[string]uint256.Int               // last written, by plain composite key
+}
+
+func NewTxChangeSetWriter(blockNumber uint64) *TxChangeSetWriter {
+	return &TxChangeSetWriter{
+		blockNumber: blockNumber,
+		txs:         make(map[uint64]*ChangeSetWriter),
+		accounts:    make(map[common.Address]*accounts.Account),
+		storage:     make(map[string]uint256.Int),
+	}
+}
+
+// SetTxNum sets the index in the block of the transaction whose changes are written next.
+func (w *TxChangeSetWriter) SetTxNum(txNum uint64) {
+	w.txNum = txNum
+}
+
+// TxNums are the indices of the transactions which changed the state, in order.
+func (w *TxChangeSetWriter) TxNums() []uint64 {
+	txNums := make([]uint64, 0, len(w.txs))
+	for txNum, csw := range w.txs {
+		if len(csw.accountChanges) > 0 || len(csw.storageChanges) > 0 {
+			txNums = append(txNums, txNum)
+		}
+	}
+	sort.Slice(txNums, func(i, j int) bool { return txNums[i] < txNums[j] })
+	return txNums
+}
+
+// Tx returns the changes of the transaction, with the values written, see
+// NewChangeSetWriterPlainWithValues. They are empty if the transaction changed nothing.
+func (w *TxChangeSetWriter) Tx(txNum uint64) *ChangeSetWriter {
+	if csw, ok := w.txs[txNum]; ok {
+		return csw
+	}
+	return NewChangeSetWriterPlainWithValues(w.blockNumber)
+}
+
+func (w *TxChangeSetWriter) current() *ChangeSetWriter {
+	csw, ok := w.txs[w.txNum]
+	if !ok {
+		csw = NewChangeSetWriterPlainWithValues(w.blockNumber)
+		w.txs[w.txNum] = csw
+	}
+	return csw
+}
+
+// original is the account before the current transaction.
+func (w *TxChangeSetWriter) original(address common.Address, blockOriginal *accounts.Account) *accounts.Account {
+	if account, ok := w.accounts[address]; ok {
+		return account
+	}
+	return blockOriginal
+}
+
+func (w *TxChangeSetWriter) UpdateAccountData(ctx context.Context, address common.Address, original, account *accounts.Account) error {
+	if err := w.current().UpdateAccountData(ctx, address, w.original(address, original), account); err != nil {
+		return err
+	}
+	w.accounts[address] = account.SelfCopy()
+	return nil
+}
+
+func (w *TxChangeSetWriter) UpdateAccountCode(address common.Address, incarnation uint64, codeHash common.Hash, code []byte) error {
+	return nil
+}
+
+func (w *TxChangeSetWriter) DeleteAccount(ctx context.Context, address common.Address, original *accounts.Account) error {
+	before := w.original(address, original)
+	if before != original && !before.Initialised {
+		// deleted by a preceding transaction, CommitBlock deletes the self-destructed accounts again
+		return nil
+	}
+	if err := w.current().DeleteAccount(ctx, address, before); err != nil {
+		return err
+	}
+	deleted := accounts.NewAccount()
+	w.accounts[address] = &deleted
+	return nil
+}
+
+func (w *TxChangeSetWriter) WriteAccountStorage(ctx context.Context, address common.Address, incarnation uint64, key *common.Hash, original, value *uint256.Int) error {
+	compositeKey := string(dbutils.PlainGenerateCompositeStorageKey(address, incarnation, *key))
+	if last, ok := w.storage[compositeKey]; ok {
+		original = &last
+	}
+	if err := w.current().WriteAccountStorage(ctx, address, incarnation, key, original, value); err != nil {
+		return err
+	}
+	w.storage[compositeKey] = *value
+	return nil
+}
+
+func (w *TxChangeSetWriter) CreateContract(address common.Address) error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+func TestTxChangeSetWriter(t *testing.T) {
+	ctx := context.Background()
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	ibs := New(NewPlainStateReader(db))
+	w := NewTxChangeSetWriter(1)
+	addr, coinbase := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+	key := common.HexToHash("0x3")
+
+	w.SetTxNum(0)
+	ibs.AddBalance(addr, uint256.NewInt().SetUint64(10))
+	ibs.SetState(addr, &key, *uint256.NewInt().SetUint64(1))
+	require.NoError(t, ibs.FinalizeTx(ctx, w))
+	w.SetTxNum(1)
+	ibs.AddBalance(addr, uint256.NewInt().SetUint64(5))
+	ibs.SetState(addr, &key, *uint256.NewInt().SetUint64(2))
+	require.NoError(t, ibs.FinalizeTx(ctx, w))
+	w.SetTxNum(2)
+	require.NoError(t, ibs.FinalizeTx(ctx, w))
+	w.SetTxNum(3)
+	ibs.AddBalance(coinbase, uint256.NewInt().SetUint64(2))
+	require.NoError(t, ibs.CommitBlock(ctx, w))
+
+	assert.Equal(t, []uint64{0, 1, 3}, w.TxNums())
+	balances := func(txNum uint64) map[common.Address][2]uint64 {
+		changes, err := w.Tx(txNum).GetAccountChanges()
+		require.NoError(t, err)
+		values, err := w.Tx(txNum).GetAccountValues()
+		require.NoError(t, err)
+		balance := func(cs *changeset.ChangeSet, i int) uint64 {
+			if len(cs.Changes[i].Value) == 0 {
+				return 0
+			}
+			var a accounts.Account
+			require.NoError(t, a.DecodeForStorage(cs.Changes[i].Value))
+			return a.Balance.Uint64()
+		}
+		byAddress := map[common.Address][2]uint64{}
+		for i := range changes.Changes {
+			require.Equal(t, changes.Changes[i].Key, values.Changes[i].Key)
+			byAddress[common.BytesToAddress(changes.Changes[i].Key)] = [2]uint64{balance(changes, i), balance(values, i)}
+		}
+		return byAddress
+	}
+	assert.Equal(t, map[common.Address][2]uint64{addr: {0, 10}}, balances(0))
+	assert.Equal(t, map[common.Address][2]uint64{addr: {10, 15}}, balances(1))
+	assert.Equal(t, map[common.Address][2]uint64{}, balances(2))
+	assert.Equal(t, map[common.Address][2]uint64{coinbase: {0, 2}}, balances(3))
+
+	storage := func(txNum uint64) [2][]byte {
+		changes, err := w.Tx(txNum).GetStorageChanges()
+		require.NoError(t, err)
+		values, err := w.Tx(txNum).GetStorageValues()
+		require.NoError(t, err)
+		require.Len(t, changes.Changes, 1)
+		return [2][]byte{changes.Changes[0].Value, values.Changes[0].Value}
+	}
+	assert.Equal(t, [2][]byte{{}, {1}}, storage(0))
+	assert.Equal(t, [2][]byte{{1}, {2}}, storage(1))
+}
@@ -0,0 +1,338 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// CfgInstr is a single decoded instruction.
+type CfgInstr struct {
+	PC  int
+	Op  OpCode
+	Imm []byte // push immediate, nil for other instructions
+}
+
+// BasicBlock is a maximal straight-line sequence of instructions. Blocks start at a
+// JUMPDEST or after a terminating instruction and end at JUMP, JUMPI, STOP, RETURN,
+// REVERT, SELFDESTRUCT or an undefined opcode.
+type BasicBlock struct {
+	Start    int
+	End      int // pc right after the last instruction
+	Instrs   []CfgInstr
+	Succs    []int // start pcs of statically known successors, the jump target first
+	Jump     bool  // the block ends with JUMP or JUMPI
+	Resolved bool  // the jump destination is known
+	// Dispatch is set for blocks of the selector dispatcher, which end with
+	// PUSH1..4 <Selector> EQ PUSHn <function entry> JUMPI.
+	Dispatch bool
+	Selector uint32
+	Invalid  bool // ends with an instruction undefined in the fork
+}
+
+// Last returns the terminating instruction of the block.
+func (b *BasicBlock) Last() CfgInstr {
+	return b.Instrs[len(b.Instrs)-1]
+}
+
+// CfgFunction is a public function found in the selector dispatcher.
+type CfgFunction struct {
+	Selector uint32
+	Entry    int   // pc of the first block
+	Blocks   []int // start pcs of blocks statically reachable from the entry, sorted
+}
+
+// StorageAccess is an SLOAD or SSTORE. Slot is nil unless it is a constant pushed right before the access,
+// Key is set for slots of mappings and dynamic arrays hashed within the block of the access.
+type StorageAccess struct {
+	PC    int
+	Op    OpCode
+	Slot  *uint256.Int
+	Key   *StorageKey
+	Block int
+}
+
+// Cfg is a control flow graph recovered from bytecode by a linear sweep. A jump is only
+// resolved when its destination is pushed immediately before it (and is a valid
+// JUMPDEST), which covers the dispatcher and most intra-function jumps emitted by
+// solc; returns from internal functions stay unresolved.
+type Cfg struct {
+	Blocks    []*BasicBlock
+	Functions []*CfgFunction
+	Fork      string // name of the instruction set the code was decoded with
+	byStart   map[int]*BasicBlock
+	jt        *JumpTable
+	duration  time.Duration
+}
+
+// CfgStats summarises the work done by NewCfg and how complete its result is.
+type CfgStats struct {
+	Instructions    int
+	Blocks          int
+	Functions       int
+	ResolvedJumps   int
+	UnresolvedJumps int
+	Duration        time.Duration // time spent in NewCfg
+}
+
+// Block returns the basic block starting at pc, or nil.
+func (cfg *Cfg) Block(pc int) *BasicBlock {
+	return cfg.byStart[pc]
+}
+
+// JumpStats counts resolved and unresolved JUMP/JUMPI instructions.
+func (cfg *Cfg) JumpStats() (resolved, unresolved int) {
+	for _, b := range cfg.Blocks {
+		if !b.Jump {
+			continue
+		}
+		if b.Resolved {
+			resolved++
+		} else {
+			unresolved++
+		}
+	}
+	return resolved, unresolved
+}
+
+// Stats returns counters of the analysis.
+func (cfg *Cfg) Stats() CfgStats {
+	stats := CfgStats{Blocks: len(cfg.Blocks), Functions: len(cfg.Functions), Duration: cfg.duration}
+	for _, b := range cfg.Blocks {
+		stats.Instructions += len(b.Instrs)
+	}
+	stats.ResolvedJumps, stats.UnresolvedJumps = cfg.JumpStats()
+	return stats
+}
+
+// StorageAccesses lists all SLOAD and SSTORE instructions in pc order.
+func (cfg *Cfg) StorageAccesses() []StorageAccess {
+	var accesses []StorageAccess
+	for _, b := range cfg.Blocks {
+		var keys map[int]*StorageKey
+		for i, in := range b.Instrs {
+			if in.Op != SLOAD && in.Op != SSTORE {
+				continue
+			}
+			if keys == nil {
+				keys = b.storageKeys(cfg.jt)
+			}
+			access := StorageAccess{PC: in.PC, Op: in.Op, Key: keys[in.PC], Block: b.Start}
+			if i > 0 && b.Instrs[i-1].Imm != nil {
+				access.Slot = new(uint256.Int).SetBytes(b.Instrs[i-1].Imm)
+			}
+			accesses = append(accesses, access)
+		}
+	}
+	return accesses
+}
+
+// CfgFlow is a value pushed by the instruction at Def and consumed as the Arg-th stack
+// operand (0 is the top) of the instruction at Use.
+type CfgFlow struct {
+	Def int
+	Use int
+	Arg int
+}
+
+// ValueFlows tracks stack values within basic blocks, values flowing in from predecessors
+// are not included. DUP and SWAP only move values around, so a value flows from the
+// instruction computing it straight to its consumers.
+func (cfg *Cfg) ValueFlows() []CfgFlow {
+	var flows []CfgFlow
+	for _, b := range cfg.Blocks {
+		flows = append(flows, b.valueFlows(cfg.jt)...)
+	}
+	return flows
+}
+
+func (b *BasicBlock) valueFlows(jt *JumpTable) []CfgFlow {
+	var flows []CfgFlow
+	var stack []int // pcs of the defining instructions, -1 for values from before the block
+	// ensure makes the n topmost values addressable, padding with values from before the block
+	ensure := func(n int) {
+		if len(stack) < n {
+			pad := make([]int, n-len(stack))
+			for i := range pad {
+				pad[i] = -1
+			}
+			stack = append(pad, stack...)
+		}
+	}
+	for _, in := range b.Instrs {
+		switch {
+		case in.Op >= DUP1 && in.Op <= DUP16:
+			n := int(in.Op-DUP1) + 1
+			ensure(n)
+			stack = append(stack, stack[len(stack)-n])
+			continue
+		case in.Op >= SWAP1 && in.Op <= SWAP16:
+			n := int(in.Op-SWAP1) + 1
+			ensure(n + 1)
+			top := len(stack) - 1
+			stack[top], stack[top-n] = stack[top-n], stack[top]
+			continue
+		}
+		op := jt[in.Op]
+		if op == nil {
+			break
+		}
+		pops := op.minStack
+		pushes := int(params.StackLimit) + pops - op.maxStack
+		ensure(pops)
+		for arg := 0; arg < pops; arg++ {
+			if def := stack[len(stack)-1-arg]; def >= 0 {
+				flows = append(flows, CfgFlow{Def: def, Use: in.PC, Arg: arg})
+			}
+		}
+		stack = stack[:len(stack)-pops]
+		for i := 0; i < pushes; i++ {
+			stack = append(stack, in.PC)
+		}
+	}
+	return flows
+}
+
+func isBlockTerminator(jt *JumpTable, op OpCode) bool {
+	switch op {
+	case JUMP, JUMPI, STOP, RETURN, REVERT, SELFDESTRUCT:
+		return true
+	}
+	return jt[op] == nil
+}
+
+// NewCfg splits the code into basic blocks and resolves static jumps, decoding it with
+// the Istanbul instruction set.
+func NewCfg(code []byte) *Cfg {
+	return newCfg(code, "istanbul", &istanbulInstructionSet)
+}
+
+// NewCfgWithRules decodes the code with the instruction set the interpreter would use
+// under the rules, so instructions introduced by later forks end blocks as invalid.
+func NewCfgWithRules(code []byte, rules params.Rules) *Cfg {
+	fork, jt := forkInstructionSet(rules)
+	return newCfg(code, fork, jt)
+}
+
+// ForkName returns the name of the instruction set selected by the rules, as in Cfg.Fork.
+func ForkName(rules params.Rules) string {
+	fork, _ := forkInstructionSet(rules)
+	return fork
+}
+
+func newCfg(code []byte, fork string, jt *JumpTable) *Cfg {
+	start := time.Now()
+	cfg := &Cfg{Fork: fork, byStart: make(map[int]*BasicBlock), jt: jt}
+	analysis := codeBitmap(code)
+	isJumpdest := func(dest *uint256.Int) bool {
+		if !dest.IsUint64() || dest.Uint64() >= uint64(len(code)) {
+			return false
+		}
+		return OpCode(code[dest.Uint64()]) == JUMPDEST && isCodeFromAnalysis(analysis, dest.Uint64())
+	}
+	cur := &BasicBlock{}
+	closeBlock := func(end int, falls bool) {
+		if len(cur.Instrs) == 0 {
+			cur.Start = end
+			return
+		}
+		cur.End = end
+		last := cur.Last()
+		if last.Op == JUMP || last.Op == JUMPI {
+			cur.Jump = true
+			if n := len(cur.Instrs); n > 1 && cur.Instrs[n-2].Imm != nil {
+				if dest := new(uint256.Int).SetBytes(cur.Instrs[n-2].Imm); isJumpdest(dest) {
+					cur.Resolved = true
+					cur.Succs = append(cur.Succs, int(dest.Uint64()))
+				}
+			}
+		}
+		if falls && end < len(code) {
+			cur.Succs = append(cur.Succs, end)
+		}
+		if n := len(cur.Instrs); n >= 4 && cur.Resolved {
+			in := cur.Instrs[n-4:]
+			if in[0].Op >= PUSH1 && in[0].Op <= PUSH4 && in[1].Op == EQ && in[2].Op.IsPush() && in[3].Op == JUMPI {
+				var sel [4]byte
+				copy(sel[4-len(in[0].Imm):], in[0].Imm)
+				cur.Dispatch = true
+				cur.Selector = binary.BigEndian.Uint32(sel[:])
+			}
+		}
+		cfg.Blocks = append(cfg.Blocks, cur)
+		cfg.byStart[cur.Start] = cur
+		cur = &BasicBlock{Start: end}
+	}
+	for pc := 0; pc < len(code); {
+		op := OpCode(code[pc])
+		if op == JUMPDEST {
+			closeBlock(pc, true)
+		}
+		in := CfgInstr{PC: pc, Op: op}
+		next := pc + 1
+		if op.IsPush() {
+			end := next + int(op-PUSH1+1)
+			if end > len(code) {
+				end = len(code)
+			}
+			in.Imm = code[next:end]
+			next = end
+		}
+		cur.Instrs = append(cur.Instrs, in)
+		pc = next
+		if isBlockTerminator(jt, op) {
+			cur.Invalid = jt[op] == nil
+			closeBlock(pc, op == JUMPI)
+		}
+	}
+	closeBlock(len(code), false)
+
+	for _, b := range cfg.Blocks {
+		if b.Dispatch {
+			entry := b.Succs[0]
+			cfg.Functions = append(cfg.Functions, &CfgFunction{Selector: b.Selector, Entry: entry, Blocks: cfg.reachable(entry)})
+		}
+	}
+	cfg.duration = time.Since(start)
+	return cfg
+}
+
+func (cfg *Cfg) reachable(from int) []int {
+	visited := make(map[int]bool)
+	stack := []int{from}
+	for len(stack) > 0 {
+		pc := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		b := cfg.byStart[pc]
+		if b == nil || visited[pc] {
+			continue
+		}
+		visited[pc] = true
+		stack = append(stack, b.Succs...)
+	}
+	blocks := make([]int, 0, len(visited))
+	for pc := range visited {
+		blocks = append(blocks, pc)
+	}
+	sort.Ints(blocks)
+	return blocks
+}
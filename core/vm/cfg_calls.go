@@ -0,0 +1,90 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// CallTarget is a CALL, CALLCODE, DELEGATECALL or STATICCALL site. The callee is Address
+// if it is pushed as a constant, or the value of storage slot Slot of the calling contract
+// if it is loaded from a constant slot (possibly masked to 20 bytes), as for proxies and
+// contracts keeping the addresses of their dependencies. Both are nil for other targets.
+type CallTarget struct {
+	PC      int
+	Op      OpCode
+	Address *common.Address
+	Slot    *uint256.Int
+}
+
+// CallTargets lists the call sites in pc order. The target operand is followed within the
+// basic block of the call.
+func (cfg *Cfg) CallTargets() []CallTarget {
+	var targets []CallTarget
+	for _, b := range cfg.Blocks {
+		instrs := make(map[int]CfgInstr, len(b.Instrs))
+		for _, in := range b.Instrs {
+			instrs[in.PC] = in
+		}
+		args := make(map[int]map[int]int) // use pc to operand to def pc
+		for _, f := range b.valueFlows(cfg.jt) {
+			if args[f.Use] == nil {
+				args[f.Use] = make(map[int]int)
+			}
+			args[f.Use][f.Arg] = f.Def
+		}
+		pushed := func(pc, arg int) (CfgInstr, bool) {
+			def, ok := args[pc][arg]
+			if !ok {
+				return CfgInstr{}, false
+			}
+			in := instrs[def]
+			return in, in.Imm != nil
+		}
+		for _, in := range b.Instrs {
+			if in.Op != CALL && in.Op != CALLCODE && in.Op != DELEGATECALL && in.Op != STATICCALL {
+				continue
+			}
+			target := CallTarget{PC: in.PC, Op: in.Op}
+			def, ok := args[in.PC][1]
+			// see through masking to an address, and(x, 0xff..ff)
+			for ok && instrs[def].Op == AND {
+				if _, isMask := pushed(def, 0); isMask {
+					def, ok = args[def][1]
+				} else if _, isMask := pushed(def, 1); isMask {
+					def, ok = args[def][0]
+				} else {
+					ok = false
+				}
+			}
+			if ok {
+				switch src := instrs[def]; {
+				case src.Imm != nil:
+					address := common.BytesToAddress(src.Imm)
+					target.Address = &address
+				case src.Op == SLOAD:
+					if slot, isConst := pushed(def, 0); isConst {
+						target.Slot = new(uint256.Int).SetBytes(slot.Imm)
+					}
+				}
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+var updateCfgCorpus = flag.Bool("update-cfg-corpus", false, "rewrite the golden files of testdata/cfg")
+
+// cfgCorpusDir holds bytecode fixtures in *.hex files, each with the expected blocks,
+// jump resolutions and functions in the *.golden file of the same name.
+const cfgCorpusDir = "testdata/cfg"
+
+// cfgCorpus returns the fixtures of the corpus by name.
+func cfgCorpus(t testing.TB) map[string][]byte {
+	files, err := filepath.Glob(filepath.Join(cfgCorpusDir, "*.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no fixtures in %s", cfgCorpusDir)
+	}
+	corpus := make(map[string][]byte, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code := common.FromHex(string(bytes.TrimSpace(data)))
+		if len(code) == 0 {
+			t.Fatalf("no bytecode in %s", file)
+		}
+		corpus[strings.TrimSuffix(filepath.Base(file), ".hex")] = code
+	}
+	return corpus
+}
+
+// cfgGolden renders the CFG one block or function per line, in the format of the golden files.
+func cfgGolden(cfg *Cfg) string {
+	var buf strings.Builder
+	for _, b := range cfg.Blocks {
+		fmt.Fprintf(&buf, "block %d-%d %s", b.Start, b.End, b.Last().Op)
+		if b.Jump {
+			if b.Resolved {
+				buf.WriteString(" resolved")
+			} else {
+				buf.WriteString(" unresolved")
+			}
+		}
+		if len(b.Succs) > 0 {
+			fmt.Fprintf(&buf, " succs %s", strings.Trim(fmt.Sprint(b.Succs), "[]"))
+		}
+		if b.Dispatch {
+			fmt.Fprintf(&buf, " dispatch 0x%08x", b.Selector)
+		}
+		buf.WriteByte('\n')
+	}
+	for _, f := range cfg.Functions {
+		fmt.Fprintf(&buf, "function 0x%08x entry %d blocks %s\n", f.Selector, f.Entry, strings.Trim(fmt.Sprint(f.Blocks), "[]"))
+	}
+	resolved, unresolved := cfg.JumpStats()
+	fmt.Fprintf(&buf, "jumps resolved %d unresolved %d\n", resolved, unresolved)
+	return buf.String()
+}
+
+// TestCfgCorpus compares the CFG of every fixture with its golden file. Run it with
+// -update-cfg-corpus to write the golden files after an intended change of the analysis,
+// and review their diff.
+func TestCfgCorpus(t *testing.T) {
+	for name, code := range cfgCorpus(t) {
+		name, code := name, code
+		t.Run(name, func(t *testing.T) {
+			got := cfgGolden(NewCfg(code))
+			golden := filepath.Join(cfgCorpusDir, name+".golden")
+			if *updateCfgCorpus {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("CFG differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
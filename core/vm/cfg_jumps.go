@@ -0,0 +1,140 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
+)
+
+// CfgEdge is a jump taken by a concrete execution: From is the pc of a JUMP or JUMPI and
+// To the pc executed next, which is the next instruction for a JUMPI not taken.
+type CfgEdge struct {
+	From int
+	To   int
+}
+
+// CheckEdges compares concretely taken edges with the CFG. Unsound edges contradict it:
+// they leave a pc which is not the last instruction of a jump block, or a resolved jump
+// for a pc other than its successors. Edges of unresolved jumps are missing from the CFG
+// by construction and are returned apart. Both are sorted.
+func (cfg *Cfg) CheckEdges(edges []CfgEdge) (unsound, unresolved []CfgEdge) {
+	jumps := make(map[int]*BasicBlock)
+	for _, b := range cfg.Blocks {
+		if b.Jump {
+			jumps[b.Last().PC] = b
+		}
+	}
+	for _, e := range edges {
+		b := jumps[e.From]
+		switch {
+		case b == nil:
+			unsound = append(unsound, e)
+		case b.Last().Op == JUMPI && e.To == b.End:
+			// not taken, the successor is missing if the code ends there
+		case b.succeeds(e.To):
+		case b.Resolved:
+			unsound = append(unsound, e)
+		default:
+			unresolved = append(unresolved, e)
+		}
+	}
+	sortEdges(unsound)
+	sortEdges(unresolved)
+	return unsound, unresolved
+}
+
+func (b *BasicBlock) succeeds(pc int) bool {
+	for _, s := range b.Succs {
+		if s == pc {
+			return true
+		}
+	}
+	return false
+}
+
+func sortEdges(edges []CfgEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
+
+// JumpRecorder is a Tracer recording the jumps taken by the code with the given hash, in
+// every call frame running it, to be checked against its CFG with CheckEdges.
+type JumpRecorder struct {
+	codeHash common.Hash
+	edges    map[CfgEdge]int
+	from     int // pc of the jump logged last, -1 after any other instruction
+	depth    int // of the jump logged last
+}
+
+func NewJumpRecorder(codeHash common.Hash) *JumpRecorder {
+	return &JumpRecorder{codeHash: codeHash, edges: make(map[CfgEdge]int), from: -1}
+}
+
+// Edges returns the edges taken with the number of times each was.
+func (r *JumpRecorder) Edges() map[CfgEdge]int {
+	return r.edges
+}
+
+func (r *JumpRecorder) CaptureStart(depth int, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	r.from = -1
+	return nil
+}
+
+// CaptureState is called before every instruction, so the instruction after a jump in the
+// same frame is its destination. A jump failing ends the frame, the next instruction is
+// then that of the caller or of the next transaction.
+func (r *JumpRecorder) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *stack.Stack, rStack *stack.ReturnStack, rData []byte, contract *Contract, depth int, err error) error {
+	if r.from >= 0 && depth == r.depth {
+		r.edges[CfgEdge{From: r.from, To: int(pc)}]++
+	}
+	r.from = -1
+	if err == nil && (op == JUMP || op == JUMPI) && contract.CodeHash == r.codeHash {
+		r.from, r.depth = int(pc), depth
+	}
+	return nil
+}
+
+func (r *JumpRecorder) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *stack.Stack, rStack *stack.ReturnStack, contract *Contract, depth int, err error) error {
+	r.from = -1
+	return nil
+}
+
+func (r *JumpRecorder) CaptureEnd(depth int, output []byte, gasUsed uint64, t time.Duration, err error) error {
+	r.from = -1
+	return nil
+}
+
+func (r *JumpRecorder) CaptureCreate(creator common.Address, creation common.Address) error {
+	return nil
+}
+
+func (r *JumpRecorder) CaptureAccountRead(account common.Address) error {
+	return nil
+}
+
+func (r *JumpRecorder) CaptureAccountWrite(account common.Address) error {
+	return nil
+}
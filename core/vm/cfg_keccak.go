@@ -0,0 +1,176 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// StorageKey is a storage slot derived by hashing, as solc lays out mappings and dynamic
+// arrays: the value of key in a mapping at slot p is at keccak(key . p), element i of a
+// dynamic array at slot p is at keccak(p) + i.
+type StorageKey struct {
+	Mapping bool         // keccak(key . base) if set, keccak(base) + index otherwise
+	Base    *uint256.Int // declaration slot, nil if Parent is set or it is not constant
+	Parent  *StorageKey  // for nested mappings and arrays, the slot the base was derived from
+	Key     *uint256.Int // constant mapping key or array index, nil if dynamic
+}
+
+// String renders the key in an indexing notation, e.g. 0x3[*] for any value of the mapping
+// at slot 3, 0x3[*][*] for a nested mapping and 0x5.data[0x2] for an array element.
+func (k *StorageKey) String() string {
+	base := "?"
+	switch {
+	case k.Parent != nil:
+		base = k.Parent.String()
+	case k.Base != nil:
+		base = k.Base.Hex()
+	}
+	key := "*"
+	if k.Key != nil {
+		key = k.Key.Hex()
+	}
+	if k.Mapping {
+		return fmt.Sprintf("%s[%s]", base, key)
+	}
+	return fmt.Sprintf("%s.data[%s]", base, key)
+}
+
+// memoryWriters are the instructions other than MSTORE writing to memory.
+var memoryWriters = map[OpCode]bool{
+	MSTORE8: true, CALLDATACOPY: true, CODECOPY: true, RETURNDATACOPY: true, EXTCODECOPY: true,
+	CALL: true, CALLCODE: true, DELEGATECALL: true, STATICCALL: true,
+}
+
+// symValue is a stack or memory word of the symbolic execution of a block: a constant,
+// a derived storage slot, or unknown if both are nil.
+type symValue struct {
+	c   *uint256.Int
+	key *StorageKey
+}
+
+// storageKeys executes the block symbolically and returns the derived slots accessed by
+// SLOAD and SSTORE by pc. Memory is only modelled for MSTORE at constant offsets within
+// the block, which is how solc prepares the input of SHA3 for mapping lookups.
+func (b *BasicBlock) storageKeys(jt *JumpTable) map[int]*StorageKey {
+	keys := make(map[int]*StorageKey)
+	var stack []symValue
+	memory := make(map[uint64]symValue)
+	ensure := func(n int) {
+		if len(stack) < n {
+			stack = append(make([]symValue, n-len(stack)), stack...)
+		}
+	}
+	for _, in := range b.Instrs {
+		switch {
+		case in.Op >= DUP1 && in.Op <= DUP16:
+			n := int(in.Op-DUP1) + 1
+			ensure(n)
+			stack = append(stack, stack[len(stack)-n])
+			continue
+		case in.Op >= SWAP1 && in.Op <= SWAP16:
+			n := int(in.Op-SWAP1) + 1
+			ensure(n + 1)
+			top := len(stack) - 1
+			stack[top], stack[top-n] = stack[top-n], stack[top]
+			continue
+		}
+		op := jt[in.Op]
+		if op == nil {
+			break
+		}
+		pops := op.minStack
+		pushes := int(params.StackLimit) + pops - op.maxStack
+		ensure(pops)
+		args := make([]symValue, pops)
+		for i := range args {
+			args[i] = stack[len(stack)-1-i]
+		}
+		stack = stack[:len(stack)-pops]
+		var result symValue
+		switch {
+		case in.Imm != nil:
+			result.c = new(uint256.Int).SetBytes(in.Imm)
+		case in.Op == MSTORE:
+			if off := args[0].c; off != nil && off.IsUint64() {
+				memory[off.Uint64()] = args[1]
+			} else {
+				memory = make(map[uint64]symValue) // any word may have been overwritten
+			}
+		case in.Op == SHA3:
+			result.key = hashedKey(memory, args[0].c, args[1].c)
+		case in.Op == ADD:
+			result = addSym(args[0], args[1])
+		case in.Op == SLOAD || in.Op == SSTORE:
+			if args[0].key != nil {
+				keys[in.PC] = args[0].key
+			}
+		case memoryWriters[in.Op]:
+			memory = make(map[uint64]symValue) // any word may have been overwritten
+		}
+		for i := 0; i < pushes; i++ {
+			stack = append(stack, result)
+		}
+	}
+	return keys
+}
+
+// hashedKey recognises keccak(key . base) and keccak(base) over words stored in memory.
+func hashedKey(memory map[uint64]symValue, offset, size *uint256.Int) *StorageKey {
+	if offset == nil || size == nil || !offset.IsUint64() || !size.IsUint64() {
+		return nil
+	}
+	off := offset.Uint64()
+	switch size.Uint64() {
+	case 64:
+		key, kok := memory[off]
+		base, bok := memory[off+32]
+		if !kok || !bok {
+			return nil
+		}
+		return &StorageKey{Mapping: true, Base: base.c, Parent: base.key, Key: key.c}
+	case 32:
+		base, ok := memory[off]
+		if !ok || (base.c == nil && base.key == nil) {
+			return nil
+		}
+		return &StorageKey{Base: base.c, Parent: base.key, Key: new(uint256.Int)}
+	}
+	return nil
+}
+
+// addSym adds an index to an array slot, or folds constants.
+func addSym(x, y symValue) symValue {
+	if x.key == nil {
+		x, y = y, x
+	}
+	switch {
+	case x.c != nil && y.c != nil:
+		return symValue{c: new(uint256.Int).Add(x.c, y.c)}
+	case x.key != nil && !x.key.Mapping && x.key.Key != nil && x.key.Key.IsZero():
+		k := *x.key
+		k.Key = nil
+		if y.c != nil {
+			k.Key = y.c
+		}
+		return symValue{key: &k}
+	}
+	return symValue{}
+}
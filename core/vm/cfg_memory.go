@@ -0,0 +1,168 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// MemoryBound is the highest memory a public function can touch. Size is only an upper
+// bound if Bounded, otherwise Unbounded lists the accesses whose offset or size is not a
+// constant within their block, typically derived from the free memory pointer or calldata.
+type MemoryBound struct {
+	Selector  uint32
+	Bounded   bool
+	Size      uint64 // bytes touched, a multiple of 32
+	Gas       uint64 // memory expansion gas for growing empty memory to Size
+	Unbounded []int
+}
+
+// memoryOperand is a memory range used by an instruction: the stack operands holding its
+// offset and size, or a fixed size if size is -1.
+type memoryOperand struct {
+	offset, size int
+	fixed        uint64
+}
+
+var memoryOperands = map[OpCode][]memoryOperand{
+	MLOAD:          {{0, -1, 32}},
+	MSTORE:         {{0, -1, 32}},
+	MSTORE8:        {{0, -1, 1}},
+	SHA3:           {{0, 1, 0}},
+	CALLDATACOPY:   {{0, 2, 0}},
+	CODECOPY:       {{0, 2, 0}},
+	RETURNDATACOPY: {{0, 2, 0}},
+	EXTCODECOPY:    {{1, 3, 0}},
+	LOG0:           {{0, 1, 0}},
+	LOG1:           {{0, 1, 0}},
+	LOG2:           {{0, 1, 0}},
+	LOG3:           {{0, 1, 0}},
+	LOG4:           {{0, 1, 0}},
+	CREATE:         {{1, 2, 0}},
+	CREATE2:        {{1, 2, 0}},
+	CALL:           {{3, 4, 0}, {5, 6, 0}},
+	CALLCODE:       {{3, 4, 0}, {5, 6, 0}},
+	DELEGATECALL:   {{2, 3, 0}, {4, 5, 0}},
+	STATICCALL:     {{2, 3, 0}, {4, 5, 0}},
+	RETURN:         {{0, 1, 0}},
+	REVERT:         {{0, 1, 0}},
+}
+
+// maxMemorySize is the largest memory size whose expansion gas fits into a uint64, as
+// checked by the interpreter.
+const maxMemorySize = 0x1FFFFFFFE0
+
+// MemoryBounds estimates the worst-case memory of every public function over the blocks
+// statically reachable from its entry. Offsets and sizes are constants if pushed or folded
+// from pushed values (ADD, SUB, MUL, SHL, AND, OR) within the block of the access, so code
+// reached through unresolved jumps, such as internal functions, is not accounted for.
+func (cfg *Cfg) MemoryBounds() []MemoryBound {
+	ranges := make(map[int][]uint64) // block start to the ends of its constant ranges
+	unbounded := make(map[int][]int) // block start to pcs of accesses that are not constant
+	for _, b := range cfg.Blocks {
+		ranges[b.Start], unbounded[b.Start] = b.memoryRanges(cfg.jt)
+	}
+	bounds := make([]MemoryBound, 0, len(cfg.Functions))
+	for _, f := range cfg.Functions {
+		bound := MemoryBound{Selector: f.Selector}
+		for _, pc := range f.Blocks {
+			for _, end := range ranges[pc] {
+				if end > bound.Size {
+					bound.Size = end
+				}
+			}
+			bound.Unbounded = append(bound.Unbounded, unbounded[pc]...)
+		}
+		bound.Bounded = len(bound.Unbounded) == 0
+		bound.Size = (bound.Size + 31) / 32 * 32
+		bound.Gas = memoryExpansionGas(bound.Size)
+		bounds = append(bounds, bound)
+	}
+	return bounds
+}
+
+// memoryExpansionGas is the gas charged for growing empty memory to size bytes.
+func memoryExpansionGas(size uint64) uint64 {
+	words := toWordSize(size)
+	return words*params.MemoryGas + words*words/params.QuadCoeffDiv
+}
+
+// memoryRanges returns the ends of the memory ranges touched with constant offsets and
+// sizes, and the pcs of the accesses whose ranges are unknown.
+func (b *BasicBlock) memoryRanges(jt *JumpTable) (ends []uint64, unknown []int) {
+	args := make(map[int]map[int]int) // use pc to operand to def pc
+	for _, f := range b.valueFlows(jt) {
+		if args[f.Use] == nil {
+			args[f.Use] = make(map[int]int)
+		}
+		args[f.Use][f.Arg] = f.Def
+	}
+	consts := make(map[int]*uint256.Int)
+	operand := func(pc, arg int) *uint256.Int {
+		if def, ok := args[pc][arg]; ok {
+			return consts[def]
+		}
+		return nil
+	}
+	for _, in := range b.Instrs {
+		if in.Imm != nil {
+			consts[in.PC] = new(uint256.Int).SetBytes(in.Imm)
+			continue
+		}
+		x, y := operand(in.PC, 0), operand(in.PC, 1)
+		if x != nil && y != nil {
+			switch in.Op {
+			case ADD:
+				consts[in.PC] = new(uint256.Int).Add(x, y)
+			case SUB:
+				consts[in.PC] = new(uint256.Int).Sub(x, y)
+			case MUL:
+				consts[in.PC] = new(uint256.Int).Mul(x, y)
+			case SHL:
+				if x.LtUint64(256) {
+					consts[in.PC] = new(uint256.Int).Lsh(y, uint(x.Uint64()))
+				}
+			case AND:
+				consts[in.PC] = new(uint256.Int).And(x, y)
+			case OR:
+				consts[in.PC] = new(uint256.Int).Or(x, y)
+			}
+		}
+		for _, m := range memoryOperands[in.Op] {
+			size := new(uint256.Int).SetUint64(m.fixed)
+			if m.size >= 0 {
+				size = operand(in.PC, m.size)
+			}
+			if size != nil && size.IsZero() {
+				continue // empty ranges do not expand memory
+			}
+			offset := operand(in.PC, m.offset)
+			if offset == nil || size == nil {
+				unknown = append(unknown, in.PC)
+				break
+			}
+			end := new(uint256.Int)
+			if end.AddOverflow(offset, size) || !end.IsUint64() || end.Uint64() > maxMemorySize {
+				unknown = append(unknown, in.PC)
+				break
+			}
+			ends = append(ends, end.Uint64())
+		}
+	}
+	return ends, unknown
+}
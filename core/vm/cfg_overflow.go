@@ -0,0 +1,89 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+// OverflowCandidate is an unchecked ADD, SUB or MUL whose result reaches a storage write
+// or the value of a call. Path lists the pcs from the arithmetic instruction to the sink.
+type OverflowCandidate struct {
+	PC   int
+	Sink int
+	Path []int
+}
+
+// overflowSinks maps instructions to the operand through which an overflowed value does harm.
+var overflowSinks = map[OpCode]int{
+	SSTORE:   1, // value
+	CALL:     2, // value
+	CALLCODE: 2, // value
+}
+
+// overflowPropagators pass an overflowed value on to their result.
+var overflowPropagators = map[OpCode]bool{
+	ADD: true, SUB: true, MUL: true, DIV: true, AND: true, OR: true,
+}
+
+// overflowGuards compare a value, typically in a require(c >= a) or SafeMath check.
+var overflowGuards = map[OpCode]bool{
+	LT: true, GT: true, SLT: true, SGT: true, EQ: true,
+}
+
+// OverflowCandidates flags arithmetic results that flow into SSTORE values or CALL values
+// without being compared on the way. The data flow is followed within basic blocks only,
+// so guards in other blocks are not seen and the result is a list of candidates for
+// review, mostly useful for contracts compiled before Solidity 0.8.
+func (cfg *Cfg) OverflowCandidates() []OverflowCandidate {
+	var candidates []OverflowCandidate
+	for _, b := range cfg.Blocks {
+		ops := make(map[int]OpCode, len(b.Instrs))
+		for _, in := range b.Instrs {
+			ops[in.PC] = in.Op
+		}
+		uses := make(map[int][]CfgFlow)
+		for _, f := range b.valueFlows(cfg.jt) {
+			uses[f.Def] = append(uses[f.Def], f)
+		}
+		guarded := func(pc int) bool {
+			for _, f := range uses[pc] {
+				if overflowGuards[ops[f.Use]] {
+					return true
+				}
+			}
+			return false
+		}
+		var walk func(path []int)
+		walk = func(path []int) {
+			pc := path[len(path)-1]
+			if guarded(pc) {
+				return
+			}
+			for _, f := range uses[pc] {
+				op := ops[f.Use]
+				if arg, ok := overflowSinks[op]; ok && arg == f.Arg {
+					candidates = append(candidates, OverflowCandidate{PC: path[0], Sink: f.Use, Path: append(append([]int(nil), path...), f.Use)})
+				} else if overflowPropagators[op] {
+					walk(append(path, f.Use))
+				}
+			}
+		}
+		for _, in := range b.Instrs {
+			if in.Op == ADD || in.Op == SUB || in.Op == MUL {
+				walk([]int{in.PC})
+			}
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// AnalysisReport is the result of an analysis pass. Consumers marshal it to JSON, so
+// passes should return values with exported fields.
+type AnalysisReport interface{}
+
+// AnalysisPass computes a report from a recovered CFG. Passes must not modify the CFG,
+// which may be shared and cached.
+type AnalysisPass func(cfg *Cfg) AnalysisReport
+
+var (
+	analysisPassesMu sync.RWMutex
+	analysisPasses   = map[string]AnalysisPass{
+		"storage":   func(cfg *Cfg) AnalysisReport { return cfg.StorageAccesses() },
+		"valueflow": func(cfg *Cfg) AnalysisReport { return cfg.ValueFlows() },
+		"overflow":  func(cfg *Cfg) AnalysisReport { return cfg.OverflowCandidates() },
+		"taint":     func(cfg *Cfg) AnalysisReport { return cfg.TaintFlows() },
+		"memory":    func(cfg *Cfg) AnalysisReport { return cfg.MemoryBounds() },
+		"stack":     func(cfg *Cfg) AnalysisReport { return cfg.StackConflicts() },
+		"calls":     func(cfg *Cfg) AnalysisReport { return cfg.CallTargets() },
+		"refund":    func(cfg *Cfg) AnalysisReport { return cfg.RefundBounds() },
+		"decompile": func(cfg *Cfg) AnalysisReport { return cfg.Decompile() },
+	}
+)
+
+// RegisterAnalysisPass adds a pass that can then be run by name, typically from an init
+// function of the package implementing it. It panics on a missing pass or a duplicate name.
+func RegisterAnalysisPass(name string, pass AnalysisPass) {
+	analysisPassesMu.Lock()
+	defer analysisPassesMu.Unlock()
+	if pass == nil {
+		panic(fmt.Sprintf("analysis pass %q is nil", name))
+	}
+	if _, ok := analysisPasses[name]; ok {
+		panic(fmt.Sprintf("analysis pass %q registered twice", name))
+	}
+	analysisPasses[name] = pass
+}
+
+// AnalysisPasses returns the names of the registered passes, sorted.
+func AnalysisPasses() []string {
+	analysisPassesMu.RLock()
+	defer analysisPassesMu.RUnlock()
+	names := make([]string, 0, len(analysisPasses))
+	for name := range analysisPasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RunAnalysisPass runs the pass registered under the name.
+func (cfg *Cfg) RunAnalysisPass(name string) (AnalysisReport, error) {
+	analysisPassesMu.RLock()
+	pass, ok := analysisPasses[name]
+	analysisPassesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown analysis pass %q, known are %v", name, AnalysisPasses())
+	}
+	return pass(cfg), nil
+}
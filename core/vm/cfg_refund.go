@@ -0,0 +1,167 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// RefundBound is the most gas a public function can have refunded. Sstores is the largest
+// number of SSTOREs executed along any path and Refund is only an upper bound if Bounded,
+// otherwise Loops lists the SSTOREs inside loops. The bound is before the refund is capped
+// to a half of the gas used by the transaction, and covers the code of the contract only,
+// not the code it calls.
+type RefundBound struct {
+	Selector     uint32
+	Bounded      bool
+	Sstores      int
+	Selfdestruct bool
+	Refund       uint64
+	Loops        []int
+}
+
+// maxSstoreRefund is the largest refund a single SSTORE can earn under the fork. For
+// Constantinople it is the EIP-1283 refund, which also bounds the Petersburg one.
+func maxSstoreRefund(fork string) uint64 {
+	switch fork {
+	case "istanbul", "yoloV1":
+		return params.SstoreInitRefundEIP2200
+	case "constantinople":
+		return params.NetSstoreResetClearRefund
+	default:
+		return params.SstoreRefundGas
+	}
+}
+
+// RefundBounds bounds the refunds of every public function over the blocks statically
+// reachable from its entry: the SSTOREs along the heaviest acyclic path each earn the
+// largest refund of the fork, and a SELFDESTRUCT adds its refund once, as an account
+// can only be destructed once per transaction. Code reached through unresolved jumps,
+// such as internal functions, is not accounted for.
+func (cfg *Cfg) RefundBounds() []RefundBound {
+	sstores := make(map[int][]int) // block start to pcs of its SSTOREs
+	for _, b := range cfg.Blocks {
+		for _, in := range b.Instrs {
+			if in.Op == SSTORE {
+				sstores[b.Start] = append(sstores[b.Start], in.PC)
+			}
+		}
+	}
+	perSstore := maxSstoreRefund(cfg.Fork)
+	bounds := make([]RefundBound, 0, len(cfg.Functions))
+	for _, f := range cfg.Functions {
+		bound := RefundBound{Selector: f.Selector}
+		inFunction := make(map[int]bool, len(f.Blocks))
+		for _, pc := range f.Blocks {
+			inFunction[pc] = true
+			bound.Selfdestruct = bound.Selfdestruct || cfg.byStart[pc].Last().Op == SELFDESTRUCT
+		}
+		components := cfg.components(f.Blocks, inFunction)
+		// components come in reverse topological order, so successors are done first
+		heaviest := make([]int, len(components))
+		component := make(map[int]int, len(f.Blocks))
+		for i, c := range components {
+			for _, pc := range c {
+				component[pc] = i
+			}
+		}
+		for i, c := range components {
+			cyclic := len(c) > 1
+			weight := 0
+			for _, pc := range c {
+				weight += len(sstores[pc])
+				for _, succ := range cfg.byStart[pc].Succs {
+					if !inFunction[succ] {
+						continue
+					}
+					if j := component[succ]; j != i {
+						if heaviest[j] > heaviest[i] {
+							heaviest[i] = heaviest[j]
+						}
+					} else {
+						cyclic = true
+					}
+				}
+			}
+			heaviest[i] += weight
+			if cyclic {
+				for _, pc := range c {
+					bound.Loops = append(bound.Loops, sstores[pc]...)
+				}
+			}
+		}
+		if i, ok := component[f.Entry]; ok {
+			bound.Sstores = heaviest[i]
+		}
+		bound.Bounded = len(bound.Loops) == 0
+		bound.Refund = uint64(bound.Sstores) * perSstore
+		if bound.Selfdestruct {
+			bound.Refund += params.SelfdestructRefundGas
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds
+}
+
+// components returns the strongly connected components of the subgraph induced by the
+// blocks, in reverse topological order (Tarjan's algorithm).
+func (cfg *Cfg) components(blocks []int, in map[int]bool) [][]int {
+	index := make(map[int]int, len(blocks))
+	low := make(map[int]int, len(blocks))
+	onStack := make(map[int]bool, len(blocks))
+	var stack []int
+	var result [][]int
+	var visit func(pc int)
+	visit = func(pc int) {
+		index[pc], low[pc] = len(index), len(index)
+		stack = append(stack, pc)
+		onStack[pc] = true
+		for _, succ := range cfg.byStart[pc].Succs {
+			if !in[succ] {
+				continue
+			}
+			if _, seen := index[succ]; !seen {
+				visit(succ)
+				if low[succ] < low[pc] {
+					low[pc] = low[succ]
+				}
+			} else if onStack[succ] && index[succ] < low[pc] {
+				low[pc] = index[succ]
+			}
+		}
+		if low[pc] != index[pc] {
+			return
+		}
+		var c []int
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			c = append(c, top)
+			if top == pc {
+				break
+			}
+		}
+		result = append(result, c)
+	}
+	for _, pc := range blocks {
+		if _, seen := index[pc]; !seen {
+			visit(pc)
+		}
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// StackConflict is a join point reached with different stack heights. Paths holds, for
+// each height, a path of block starts from the code entry to the join point, so the two
+// ways of reaching it can be compared; Heights[i] is the height along Paths[i].
+type StackConflict struct {
+	Block   int
+	Heights []int
+	Paths   [][]int
+}
+
+// stackEffect returns how many values the block needs on entry and how the stack height
+// changes from entry to exit.
+func (b *BasicBlock) stackEffect(jt *JumpTable) (needed, delta int) {
+	for _, in := range b.Instrs {
+		var pops, pushes int
+		switch {
+		case in.Op >= DUP1 && in.Op <= DUP16:
+			pops, pushes = int(in.Op-DUP1)+1, int(in.Op-DUP1)+2
+		case in.Op >= SWAP1 && in.Op <= SWAP16:
+			pops, pushes = int(in.Op-SWAP1)+2, int(in.Op-SWAP1)+2
+		default:
+			op := jt[in.Op]
+			if op == nil {
+				return needed, delta
+			}
+			pops = op.minStack
+			pushes = int(params.StackLimit) + pops - op.maxStack
+		}
+		if pops-delta > needed {
+			needed = pops - delta
+		}
+		delta += pushes - pops
+	}
+	return needed, delta
+}
+
+// StackConflicts propagates stack heights from the code entry along resolved jumps and
+// fall-throughs and reports the blocks reached with different heights, the usual cause of
+// imprecision when code is shared, e.g. an internal function jumped to from call sites of
+// different depths. A block also conflicts with itself if it needs more values than
+// there are, which is reported with a single height.
+func (cfg *Cfg) StackConflicts() []StackConflict {
+	if len(cfg.Blocks) == 0 {
+		return nil
+	}
+	entry := cfg.Blocks[0].Start
+	heights := map[int]int{entry: 0}
+	parent := map[int]int{entry: -1}
+	path := func(pc int) []int {
+		var p []int
+		for ; pc >= 0; pc = parent[pc] {
+			p = append([]int{pc}, p...)
+		}
+		return p
+	}
+	conflicts := make(map[int]*StackConflict)
+	worklist := []int{entry}
+	for len(worklist) > 0 {
+		pc := worklist[0]
+		worklist = worklist[1:]
+		b := cfg.byStart[pc]
+		if b == nil {
+			continue
+		}
+		needed, delta := b.stackEffect(cfg.jt)
+		if needed > heights[pc] && conflicts[pc] == nil {
+			conflicts[pc] = &StackConflict{Block: pc, Heights: []int{heights[pc]}, Paths: [][]int{path(pc)}}
+			continue
+		}
+		exit := heights[pc] + delta
+		for _, succ := range b.Succs {
+			h, seen := heights[succ]
+			if !seen {
+				heights[succ], parent[succ] = exit, pc
+				worklist = append(worklist, succ)
+				continue
+			}
+			if h == exit {
+				continue
+			}
+			c := conflicts[succ]
+			if c == nil {
+				c = &StackConflict{Block: succ, Heights: []int{h}, Paths: [][]int{path(succ)}}
+				conflicts[succ] = c
+			}
+			known := false
+			for _, ch := range c.Heights {
+				known = known || ch == exit
+			}
+			if !known {
+				c.Heights = append(c.Heights, exit)
+				c.Paths = append(c.Paths, append(path(pc), succ))
+			}
+		}
+	}
+	result := make([]StackConflict, 0, len(conflicts))
+	for _, c := range conflicts {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Block < result[j].Block })
+	return result
+}
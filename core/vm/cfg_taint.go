@@ -0,0 +1,225 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// TaintFlow is a value loaded from calldata at Source reaching operand Arg of the instruction at Sink.
+type TaintFlow struct {
+	Source int
+	Sink   int
+	Arg    int
+	Kind   string // storage-slot, storage-value, call-target or call-value
+}
+
+// taintSinks lists the sensitive operands of instructions.
+var taintSinks = map[OpCode]map[int]string{
+	SSTORE:       {0: "storage-slot", 1: "storage-value"},
+	CALL:         {1: "call-target", 2: "call-value"},
+	CALLCODE:     {1: "call-target", 2: "call-value"},
+	DELEGATECALL: {1: "call-target"},
+	STATICCALL:   {1: "call-target"},
+}
+
+// taintPropagators compute results carrying the taint of their operands.
+var taintPropagators = map[OpCode]bool{
+	ADD: true, SUB: true, MUL: true, DIV: true, SDIV: true, MOD: true, SMOD: true, EXP: true,
+	ADDMOD: true, MULMOD: true, SIGNEXTEND: true, AND: true, OR: true, XOR: true, NOT: true,
+	BYTE: true, SHL: true, SHR: true, SAR: true,
+}
+
+// taintLimit bounds the tracked stack depth and the number of block visits per function.
+const taintLimit = 1024
+
+type taintSet map[int]bool
+
+func (s taintSet) union(o taintSet) taintSet {
+	if len(o) == 0 {
+		return s
+	}
+	u := make(taintSet, len(s)+len(o))
+	for k := range s {
+		u[k] = true
+	}
+	for k := range o {
+		u[k] = true
+	}
+	return u
+}
+
+// taintValue is a stack entry, id identifies the value so that all copies made by DUP are
+// sanitized together.
+type taintValue struct {
+	id    int
+	taint taintSet
+}
+
+// TaintFlows runs a taint analysis from the entry of every public function: results of
+// CALLDATALOAD are sources, storage slots and values written, and targets and values of
+// calls are sinks. A value compared by LT, GT, SLT, SGT or EQ (as in require-style guards)
+// is considered sanitized from then on. Taint is propagated through arithmetic and bitwise
+// instructions and along statically resolved jumps; memory is not modelled, so data copied
+// by CALLDATACOPY or hashed by SHA3 is not followed.
+func (cfg *Cfg) TaintFlows() map[uint32][]TaintFlow {
+	flows := make(map[uint32][]TaintFlow)
+	for _, f := range cfg.Functions {
+		if found := cfg.taintFlows(f.Entry); len(found) > 0 {
+			flows[f.Selector] = found
+		}
+	}
+	return flows
+}
+
+func (cfg *Cfg) taintFlows(entry int) []TaintFlow {
+	found := make(map[TaintFlow]bool)
+	// entry states map the depth from the top of the stack to the taint at that depth
+	states := map[int]map[int]taintSet{entry: {}}
+	worklist := []int{entry}
+	for visits := 0; len(worklist) > 0 && visits < taintLimit*4; visits++ {
+		pc := worklist[0]
+		worklist = worklist[1:]
+		b := cfg.byStart[pc]
+		if b == nil {
+			continue
+		}
+		exit := b.taintTransfer(cfg.jt, states[pc], found)
+		for _, succ := range b.Succs {
+			if mergeTaint(states, succ, exit) {
+				worklist = append(worklist, succ)
+			}
+		}
+	}
+	result := make([]TaintFlow, 0, len(found))
+	for f := range found {
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Sink != result[j].Sink {
+			return result[i].Sink < result[j].Sink
+		}
+		if result[i].Arg != result[j].Arg {
+			return result[i].Arg < result[j].Arg
+		}
+		return result[i].Source < result[j].Source
+	})
+	return result
+}
+
+// mergeTaint joins the state into the entry state of the block and tells if it changed.
+func mergeTaint(states map[int]map[int]taintSet, pc int, state map[int]taintSet) bool {
+	old, visited := states[pc]
+	if !visited {
+		old = make(map[int]taintSet)
+		states[pc] = old
+	}
+	changed := !visited
+	for depth, taint := range state {
+		merged := old[depth].union(taint)
+		if len(merged) != len(old[depth]) {
+			old[depth] = merged
+			changed = true
+		}
+	}
+	return changed
+}
+
+// taintTransfer simulates the block on a stack of taints, records flows into sinks and
+// returns the state at the end of the block.
+func (b *BasicBlock) taintTransfer(jt *JumpTable, entry map[int]taintSet, found map[TaintFlow]bool) map[int]taintSet {
+	var stack []taintValue
+	pulled := 0 // number of values taken from the entry state
+	ensure := func(n int) {
+		for len(stack) < n {
+			stack = append([]taintValue{{id: -1 - pulled, taint: entry[pulled]}}, stack...)
+			pulled++
+		}
+	}
+	sanitize := func(id int) {
+		for i := range stack {
+			if stack[i].id == id {
+				stack[i].taint = nil
+			}
+		}
+	}
+	for _, in := range b.Instrs {
+		switch {
+		case in.Op >= DUP1 && in.Op <= DUP16:
+			n := int(in.Op-DUP1) + 1
+			ensure(n)
+			stack = append(stack, stack[len(stack)-n])
+			continue
+		case in.Op >= SWAP1 && in.Op <= SWAP16:
+			n := int(in.Op-SWAP1) + 1
+			ensure(n + 1)
+			top := len(stack) - 1
+			stack[top], stack[top-n] = stack[top-n], stack[top]
+			continue
+		}
+		op := jt[in.Op]
+		if op == nil {
+			break
+		}
+		pops := op.minStack
+		pushes := int(params.StackLimit) + pops - op.maxStack
+		ensure(pops)
+		args := make([]taintValue, pops)
+		for i := range args {
+			args[i] = stack[len(stack)-1-i]
+		}
+		stack = stack[:len(stack)-pops]
+		for arg, kind := range taintSinks[in.Op] {
+			for source := range args[arg].taint {
+				found[TaintFlow{Source: source, Sink: in.PC, Arg: arg, Kind: kind}] = true
+			}
+		}
+		var result taintSet
+		switch {
+		case in.Op == CALLDATALOAD:
+			result = taintSet{in.PC: true}
+		case taintPropagators[in.Op]:
+			for _, a := range args {
+				result = result.union(a.taint)
+			}
+		case in.Op == LT || in.Op == GT || in.Op == SLT || in.Op == SGT || in.Op == EQ:
+			for _, a := range args {
+				sanitize(a.id)
+			}
+		}
+		for i := 0; i < pushes; i++ {
+			stack = append(stack, taintValue{id: in.PC, taint: result})
+		}
+		if len(stack) > taintLimit {
+			stack = stack[len(stack)-taintLimit:]
+		}
+	}
+	exit := make(map[int]taintSet)
+	for i, v := range stack {
+		if len(v.taint) > 0 {
+			exit[len(stack)-1-i] = v.taint
+		}
+	}
+	for depth, taint := range entry {
+		if depth >= pulled && len(taint) > 0 && len(stack)+depth-pulled < taintLimit {
+			exit[len(stack)+depth-pulled] = taint
+		}
+	}
+	return exit
+}
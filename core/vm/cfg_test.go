@@ -0,0 +1,385 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// dispatcher with two functions: 0xa9059cbb stores 1 into slot 0,
+// 0x18160ddd loads slot 0 and then a dynamic slot before returning through a dynamic jump
+var cfgTestCode = common.FromHex("6000" + "35" + "60e0" + "1c" +
+	"80" + "63a9059cbb" + "14" + "601b" + "57" +
+	"80" + "6318160ddd" + "14" + "6022" + "57" +
+	"00" +
+	"5b" + "6001" + "6000" + "55" + "00" +
+	"5b" + "6000" + "54" + "80" + "602a" + "56" +
+	"5b" + "54" + "56")
+
+func TestCfgBlocks(t *testing.T) {
+	cfg := NewCfg(cfgTestCode)
+	var starts []int
+	for _, b := range cfg.Blocks {
+		starts = append(starts, b.Start)
+	}
+	if exp := []int{0, 16, 26, 27, 34, 42}; !reflect.DeepEqual(starts, exp) {
+		t.Fatalf("block starts %v, expected %v", starts, exp)
+	}
+	if exp := []int{27, 16}; !reflect.DeepEqual(cfg.Block(0).Succs, exp) {
+		t.Errorf("successors of the first block %v, expected %v", cfg.Block(0).Succs, exp)
+	}
+	resolved, unresolved := cfg.JumpStats()
+	if resolved != 3 || unresolved != 1 {
+		t.Errorf("resolved %d, unresolved %d, expected 3 and 1", resolved, unresolved)
+	}
+	if stats := cfg.Stats(); stats.Instructions != 29 || stats.Blocks != 6 || stats.Functions != 2 || stats.UnresolvedJumps != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCfgFunctions(t *testing.T) {
+	cfg := NewCfg(cfgTestCode)
+	if len(cfg.Functions) != 2 {
+		t.Fatalf("found %d functions, expected 2", len(cfg.Functions))
+	}
+	exp := []CfgFunction{
+		{Selector: 0xa9059cbb, Entry: 27, Blocks: []int{27}},
+		{Selector: 0x18160ddd, Entry: 34, Blocks: []int{34, 42}},
+	}
+	for i, f := range cfg.Functions {
+		if !reflect.DeepEqual(*f, exp[i]) {
+			t.Errorf("function %d: %+v, expected %+v", i, *f, exp[i])
+		}
+	}
+}
+
+func TestCfgStorageAccesses(t *testing.T) {
+	accesses := NewCfg(cfgTestCode).StorageAccesses()
+	if len(accesses) != 3 {
+		t.Fatalf("found %d storage accesses, expected 3", len(accesses))
+	}
+	if accesses[0].Op != SSTORE || accesses[0].Slot == nil || !accesses[0].Slot.IsZero() {
+		t.Errorf("unexpected first access %+v", accesses[0])
+	}
+	if accesses[1].Op != SLOAD || accesses[1].Slot == nil {
+		t.Errorf("unexpected second access %+v", accesses[1])
+	}
+	if accesses[2].Slot != nil {
+		t.Errorf("expected unknown slot for the dynamic access, got %v", accesses[2].Slot)
+	}
+}
+
+func TestCfgValueFlows(t *testing.T) {
+	cfg := NewCfg(cfgTestCode)
+	flows := make(map[CfgFlow]bool)
+	for _, f := range cfg.ValueFlows() {
+		flows[f] = true
+	}
+	for _, f := range []CfgFlow{
+		{Def: 0, Use: 2, Arg: 0},   // PUSH1 0 -> CALLDATALOAD
+		{Def: 3, Use: 5, Arg: 0},   // PUSH1 0xe0 -> SHR shift
+		{Def: 2, Use: 5, Arg: 1},   // CALLDATALOAD -> SHR value
+		{Def: 13, Use: 15, Arg: 0}, // PUSH1 0x1b -> JUMPI destination
+		{Def: 28, Use: 32, Arg: 1}, // PUSH1 1 -> SSTORE value
+		{Def: 5, Use: 12, Arg: 1},  // SHR -> EQ through DUP1
+	} {
+		if !flows[f] {
+			t.Errorf("missing flow %+v", f)
+		}
+	}
+	for f := range flows {
+		// DUP and SWAP are transparent, the selector duplicated at the start of the second block comes from a predecessor
+		if f.Use == 6 || f.Use == 16 || f.Def == 6 || f.Def == 16 || (f.Use == 22 && f.Def != 17) {
+			t.Errorf("unexpected flow %+v", f)
+		}
+	}
+}
+
+func TestCfgOverflowCandidates(t *testing.T) {
+	// slot0 = slot0 + 1
+	unguarded := NewCfg(common.FromHex("6001" + "6000" + "54" + "01" + "6000" + "55" + "00"))
+	exp := []OverflowCandidate{{PC: 5, Sink: 8, Path: []int{5, 8}}}
+	if c := unguarded.OverflowCandidates(); !reflect.DeepEqual(c, exp) {
+		t.Errorf("candidates %v, expected %v", c, exp)
+	}
+	// the sum is compared with the old value before it is stored
+	guarded := NewCfg(common.FromHex("6001" + "6000" + "54" + "01" + "80" + "6000" + "54" + "10" + "50" + "6000" + "55" + "00"))
+	if c := guarded.OverflowCandidates(); len(c) != 0 {
+		t.Errorf("unexpected candidates %v", c)
+	}
+}
+
+func TestCfgTaintFlows(t *testing.T) {
+	// 0x11111111 stores calldata into slot 0, 0x22222222 requires the calldata value to be below 100 first
+	cfg := NewCfg(common.FromHex("6000" + "35" + "60e0" + "1c" +
+		"80" + "6311111111" + "14" + "601b" + "57" +
+		"80" + "6322222222" + "14" + "6023" + "57" +
+		"00" +
+		"5b" + "6004" + "35" + "6000" + "55" + "00" +
+		"5b" + "6004" + "35" + "80" + "6064" + "11" + "602f" + "57" + "fe" +
+		"5b" + "6000" + "55" + "00"))
+	exp := map[uint32][]TaintFlow{
+		0x11111111: {{Source: 30, Sink: 33, Arg: 1, Kind: "storage-value"}},
+	}
+	if flows := cfg.TaintFlows(); !reflect.DeepEqual(flows, exp) {
+		t.Errorf("taint flows %v, expected %v", flows, exp)
+	}
+}
+
+func TestCfgForkRules(t *testing.T) {
+	// PUSH1 1 PUSH1 2 SHR PUSH1 0 SSTORE STOP, SHR was introduced by Constantinople
+	code := common.Hex2Bytes("6001" + "6002" + "1c" + "6000" + "55" + "00")
+	byzantium := NewCfgWithRules(code, params.MainnetChainConfig.Rules(big.NewInt(4370000)))
+	if byzantium.Fork != "byzantium" {
+		t.Errorf("fork %q, expected byzantium", byzantium.Fork)
+	}
+	if len(byzantium.Blocks) != 2 || !byzantium.Block(0).Invalid || byzantium.Block(0).End != 5 {
+		t.Errorf("SHR does not end the block as invalid under byzantium")
+	}
+	constantinople := NewCfgWithRules(code, params.MainnetChainConfig.Rules(big.NewInt(7280000)))
+	if constantinople.Fork != "constantinople" {
+		t.Errorf("fork %q, expected constantinople", constantinople.Fork)
+	}
+	if len(constantinople.Blocks) != 1 || constantinople.Block(0).Invalid {
+		t.Errorf("SHR ends the block under constantinople")
+	}
+	if flows := constantinople.ValueFlows(); len(flows) != 4 {
+		t.Errorf("value flows %+v, expected 4", flows)
+	}
+}
+
+func TestCfgMemoryBounds(t *testing.T) {
+	// 0x11111111 returns 32 bytes written at 0x40, 0x22222222 returns as many bytes as given in calldata
+	cfg := NewCfg(common.FromHex("6000" + "35" + "60e0" + "1c" +
+		"80" + "6311111111" + "14" + "601b" + "57" +
+		"80" + "6322222222" + "14" + "6026" + "57" +
+		"00" +
+		"5b" + "6001" + "6040" + "52" + "6020" + "6040" + "f3" +
+		"5b" + "6004" + "35" + "6000" + "f3"))
+	exp := []MemoryBound{
+		{Selector: 0x11111111, Bounded: true, Size: 96, Gas: 9},
+		{Selector: 0x22222222, Unbounded: []int{44}},
+	}
+	if bounds := cfg.MemoryBounds(); !reflect.DeepEqual(bounds, exp) {
+		t.Errorf("memory bounds %+v, expected %+v", bounds, exp)
+	}
+}
+
+func TestCfgRefundBounds(t *testing.T) {
+	// 0x11111111 clears two slots and selfdestructs, 0x22222222 clears a slot in a loop
+	cfg := NewCfg(common.FromHex("6000" + "35" + "60e0" + "1c" +
+		"80" + "6311111111" + "14" + "601b" + "57" +
+		"80" + "6322222222" + "14" + "6028" + "57" +
+		"00" +
+		"5b" + "6000" + "6000" + "55" + "6000" + "6001" + "55" + "33" + "ff" +
+		"5b" + "6000" + "6000" + "55" + "6028" + "56"))
+	exp := []RefundBound{
+		{Selector: 0x11111111, Bounded: true, Sstores: 2, Selfdestruct: true, Refund: 2*params.SstoreInitRefundEIP2200 + params.SelfdestructRefundGas},
+		{Selector: 0x22222222, Sstores: 1, Refund: params.SstoreInitRefundEIP2200, Loops: []int{45}},
+	}
+	if bounds := cfg.RefundBounds(); !reflect.DeepEqual(bounds, exp) {
+		t.Errorf("refund bounds %+v, expected %+v", bounds, exp)
+	}
+}
+
+func TestCfgDecompile(t *testing.T) {
+	// 0x11111111 runs for i := 0; i < calldataload(4); i++ { sstore(i, i) }
+	cfg := NewCfg(common.FromHex("6000" + "35" + "60e0" + "1c" +
+		"80" + "6311111111" + "14" + "6011" + "57" +
+		"00" +
+		"5b" + "6000" +
+		"5b" + "6004" + "35" + "81" + "10" + "15" + "6027" + "57" +
+		"80" + "80" + "55" + "6001" + "01" + "6014" + "56" +
+		"5b" + "00"))
+	exp := `function selector_0x11111111() {
+    let b14_0
+    b14_0 := 0x0
+    for {} 1 {} {
+        if iszero(lt(b14_0, calldataload(0x4))) {
+            stop()
+        }
+        sstore(b14_0, b14_0)
+        b14_0 := add(0x1, b14_0)
+        continue
+    }
+}
+`
+	functions := cfg.Decompile()
+	if len(functions) != 1 || functions[0].Code != exp {
+		t.Errorf("decompiled %+v, expected\n%s", functions, exp)
+	}
+}
+
+func TestCfgStorageKeys(t *testing.T) {
+	// balances[calldata] = 1 for a mapping at slot 3, then allowance[caller][calldata] = 2
+	// for a nested mapping at slot 4, then reads element 2 of an array at slot 5
+	cfg := NewCfg(common.FromHex(
+		"6001" + "6004" + "35" + "6000" + "52" + "6003" + "6020" + "52" + "6040" + "6000" + "20" + "55" +
+			"6002" + "33" + "6000" + "52" + "6004" + "6020" + "52" + "6040" + "6000" + "20" +
+			"6020" + "52" + "6004" + "35" + "6000" + "52" + "6040" + "6000" + "20" + "55" +
+			"6005" + "6000" + "52" + "6020" + "6000" + "20" + "6002" + "01" + "54" + "00"))
+	var keys []string
+	for _, a := range cfg.StorageAccesses() {
+		if a.Key == nil {
+			t.Fatalf("no key for the access at %d", a.PC)
+		}
+		keys = append(keys, a.Key.String())
+	}
+	if exp := []string{"0x3[*]", "0x4[*][*]", "0x5.data[0x2]"}; !reflect.DeepEqual(keys, exp) {
+		t.Errorf("keys %v, expected %v", keys, exp)
+	}
+}
+
+// cfgBenchCorpus returns the test contract and, if CFG_BENCH_CORPUS names a directory, the
+// contracts in its *.hex files, e.g. the most called mainnet contracts dumped beforehand.
+func cfgBenchCorpus(b *testing.B) map[string][]byte {
+	corpus := map[string][]byte{"dispatcher": cfgTestCode}
+	dir := os.Getenv("CFG_BENCH_CORPUS")
+	if dir == "" {
+		return corpus
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.hex"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if code := common.FromHex(string(bytes.TrimSpace(data))); len(code) > 0 {
+			corpus[filepath.Base(file)] = code
+		}
+	}
+	return corpus
+}
+
+// BenchmarkCfg compares the cost of the analysis pipelines per contract. The CFG, shared by
+// all of them, reports the fraction of jumps resolved, the passes the number of results they
+// find in it.
+func BenchmarkCfg(b *testing.B) {
+	taintFlows := func(cfg *Cfg) int {
+		n := 0
+		for _, flows := range cfg.TaintFlows() {
+			n += len(flows)
+		}
+		return n
+	}
+	pipelines := []struct {
+		name   string
+		metric string // of the results, empty for the fraction of jumps resolved
+		run    func(cfg *Cfg) int
+	}{
+		{"cfg", "", func(cfg *Cfg) int { return 0 }},
+		{"storage", "storage-accesses", func(cfg *Cfg) int { return len(cfg.StorageAccesses()) }},
+		{"valueflow", "overflow-candidates", func(cfg *Cfg) int { return len(cfg.OverflowCandidates()) }},
+		{"taint", "taint-flows", taintFlows},
+		{"all", "results", func(cfg *Cfg) int {
+			return len(cfg.StorageAccesses()) + len(cfg.OverflowCandidates()) + taintFlows(cfg) + len(cfg.MemoryBounds())
+		}},
+	}
+	corpus := cfgBenchCorpus(b)
+	names := make([]string, 0, len(corpus))
+	for name := range corpus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, p := range pipelines {
+		for _, name := range names {
+			code := corpus[name]
+			b.Run(p.name+"/"+name, func(b *testing.B) {
+				b.ReportAllocs()
+				var cfg *Cfg
+				var results int
+				for i := 0; i < b.N; i++ {
+					cfg = NewCfg(code)
+					results = p.run(cfg)
+				}
+				if p.metric != "" {
+					b.ReportMetric(float64(results), p.metric)
+				} else if resolved, unresolved := cfg.JumpStats(); resolved+unresolved > 0 {
+					b.ReportMetric(float64(resolved)/float64(resolved+unresolved), "resolved-jumps")
+				}
+			})
+		}
+	}
+}
+
+func TestCfgAnalysisPasses(t *testing.T) {
+	RegisterAnalysisPass("test-blocks", func(cfg *Cfg) AnalysisReport { return len(cfg.Blocks) })
+	report, err := NewCfg(cfgTestCode).RunAnalysisPass("test-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != 6 {
+		t.Errorf("report %v, expected 6 blocks", report)
+	}
+	if _, err := NewCfg(cfgTestCode).RunAnalysisPass("unknown"); err == nil {
+		t.Errorf("expected an error for an unknown pass")
+	}
+}
+
+func TestPredictedSlots(t *testing.T) {
+	// the constant slot 0 is loaded, the dynamic load and the store are not predicted
+	if slots := PredictedSlots(cfgTestCode); !reflect.DeepEqual(slots, []common.Hash{{}}) {
+		t.Errorf("predicted slots %v, expected slot 0", slots)
+	}
+}
+
+func TestCfgStackConflicts(t *testing.T) {
+	// the JUMPDEST at 10 is reached by the JUMPI with an empty stack and by the JUMP with one value
+	cfg := NewCfg(common.FromHex("6001" + "600a" + "57" + "6002" + "600a" + "56" + "5b" + "00"))
+	exp := []StackConflict{{Block: 10, Heights: []int{0, 1}, Paths: [][]int{{0, 10}, {0, 5, 10}}}}
+	if c := cfg.StackConflicts(); !reflect.DeepEqual(c, exp) {
+		t.Errorf("conflicts %+v, expected %+v", c, exp)
+	}
+	// POP on an empty stack
+	exp = []StackConflict{{Block: 0, Heights: []int{0}, Paths: [][]int{{0}}}}
+	if c := NewCfg(common.FromHex("50" + "00")).StackConflicts(); !reflect.DeepEqual(c, exp) {
+		t.Errorf("conflicts %+v, expected %+v", c, exp)
+	}
+	if c := NewCfg(cfgTestCode).StackConflicts(); len(c) != 0 {
+		t.Errorf("unexpected conflicts %+v", c)
+	}
+}
+
+func TestCfgCallTargets(t *testing.T) {
+	// CALL to a constant address, then DELEGATECALL to the address masked from slot 0
+	cfg := NewCfg(common.FromHex("6000" + "6000" + "6000" + "6000" + "6000" +
+		"73" + "1111111111111111111111111111111111111111" + "5a" + "f1" + "00" +
+		"6000" + "6000" + "6000" + "6000" + "6000" + "54" +
+		"73" + "ffffffffffffffffffffffffffffffffffffffff" + "16" + "5a" + "f4" + "00"))
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	exp := []CallTarget{
+		{PC: 32, Op: CALL, Address: &address},
+		{PC: 68, Op: DELEGATECALL, Slot: new(uint256.Int)},
+	}
+	if targets := cfg.CallTargets(); !reflect.DeepEqual(targets, exp) {
+		t.Errorf("call targets %+v, expected %+v", targets, exp)
+	}
+}
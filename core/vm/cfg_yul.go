@@ -0,0 +1,410 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/params"
+)
+
+// DecompiledFunction is a public function rendered as pseudo-Yul.
+type DecompiledFunction struct {
+	Selector uint32
+	Entry    int
+	Code     string
+}
+
+// volatileOps are instructions whose results depend on when they execute, so they are
+// bound to variables instead of being inlined into the expressions using them.
+var volatileOps = map[OpCode]bool{
+	SLOAD: true, MLOAD: true, SHA3: true, MSIZE: true, GAS: true,
+	BALANCE: true, SELFBALANCE: true, EXTCODESIZE: true, EXTCODEHASH: true, RETURNDATASIZE: true,
+	CALL: true, CALLCODE: true, DELEGATECALL: true, STATICCALL: true, CREATE: true, CREATE2: true,
+}
+
+// Decompile renders every public function as pseudo-Yul. Stack values become expressions,
+// values taken from below the entry stack of the function are named in0, in1, ..., and
+// values living across blocks that are reached in more than one way are kept in variables
+// named after the block. Loops become `for {} 1 {} {...}` and branches become `if` or
+// `switch`, joining at the first block reachable from both sides. Any other jump to a
+// block already written is left as a comment, as is an unresolved jump, so the output is
+// meant for reading, not for compiling.
+func (cfg *Cfg) Decompile() []DecompiledFunction {
+	functions := make([]DecompiledFunction, 0, len(cfg.Functions))
+	for _, f := range cfg.Functions {
+		w := newYulWriter(cfg, f)
+		w.write(f.Entry, yulStack{})
+		var code strings.Builder
+		fmt.Fprintf(&code, "function selector_0x%08x() {\n", f.Selector)
+		if len(w.declared) > 0 {
+			fmt.Fprintf(&code, "    let %s\n", strings.Join(w.declared, ", "))
+		}
+		code.WriteString(w.body.String())
+		code.WriteString("}\n")
+		functions = append(functions, DecompiledFunction{Selector: f.Selector, Entry: f.Entry, Code: code.String()})
+	}
+	return functions
+}
+
+// yulStack is the symbolic stack, the top last.
+type yulStack struct {
+	vals  []string
+	below int // values taken from below the entry stack
+}
+
+func (s *yulStack) ensure(n int) {
+	for len(s.vals) < n {
+		s.vals = append([]string{fmt.Sprintf("in%d", s.below)}, s.vals...)
+		s.below++
+	}
+}
+
+func (s *yulStack) pop() string {
+	s.ensure(1)
+	v := s.vals[len(s.vals)-1]
+	s.vals = s.vals[:len(s.vals)-1]
+	return v
+}
+
+func (s *yulStack) push(v string) {
+	s.vals = append(s.vals, v)
+}
+
+type yulWriter struct {
+	cfg      *Cfg
+	in       map[int]bool // blocks of the function
+	preds    map[int]int
+	headers  map[int]bool // targets of back edges
+	written  map[int]bool
+	open     map[int]bool // loop headers whose body is being written
+	stops    map[int]bool // join points of the enclosing branches
+	joins    map[int]yulStack
+	declared []string
+	vars     int
+	body     strings.Builder
+	depth    int
+}
+
+func newYulWriter(cfg *Cfg, f *CfgFunction) *yulWriter {
+	w := &yulWriter{
+		cfg:     cfg,
+		in:      make(map[int]bool, len(f.Blocks)),
+		preds:   make(map[int]int),
+		headers: make(map[int]bool),
+		written: make(map[int]bool),
+		open:    make(map[int]bool),
+		stops:   make(map[int]bool),
+		joins:   make(map[int]yulStack),
+		depth:   1,
+	}
+	for _, pc := range f.Blocks {
+		w.in[pc] = true
+	}
+	for _, pc := range f.Blocks {
+		for _, succ := range cfg.byStart[pc].Succs {
+			if w.in[succ] {
+				w.preds[succ]++
+			}
+		}
+	}
+	onPath := make(map[int]bool)
+	visited := make(map[int]bool)
+	var dfs func(pc int)
+	dfs = func(pc int) {
+		visited[pc], onPath[pc] = true, true
+		for _, succ := range cfg.byStart[pc].Succs {
+			switch {
+			case !w.in[succ]:
+			case onPath[succ]:
+				w.headers[succ] = true
+			case !visited[succ]:
+				dfs(succ)
+			}
+		}
+		onPath[pc] = false
+	}
+	dfs(f.Entry)
+	return w
+}
+
+func (w *yulWriter) line(format string, args ...interface{}) {
+	w.body.WriteString(strings.Repeat("    ", w.depth))
+	fmt.Fprintf(&w.body, format, args...)
+	w.body.WriteByte('\n')
+}
+
+// write writes the block reached with the stack and what follows it.
+func (w *yulWriter) write(pc int, st yulStack) {
+	if w.headers[pc] || w.preds[pc] > 1 {
+		st = w.arrive(pc, st)
+	}
+	w.enter(pc, st)
+}
+
+// enter writes the block, as the head of a loop if it is one.
+func (w *yulWriter) enter(pc int, st yulStack) {
+	w.written[pc] = true
+	if w.headers[pc] {
+		w.line("for {} 1 {} {")
+		w.depth++
+		w.open[pc] = true
+		w.instrs(pc, st)
+		delete(w.open, pc)
+		w.depth--
+		w.line("}")
+		return
+	}
+	w.instrs(pc, st)
+}
+
+// jump continues at the block, unless it ends a branch or a loop iteration, or is
+// already written.
+func (w *yulWriter) jump(pc int, st yulStack) {
+	switch {
+	case w.stops[pc]:
+		w.arrive(pc, st)
+	case w.open[pc]:
+		w.arrive(pc, st)
+		w.line("continue")
+	case w.written[pc]:
+		if _, ok := w.joins[pc]; ok {
+			w.arrive(pc, st)
+		}
+		w.line("// continues at 0x%x", pc)
+	default:
+		w.write(pc, st)
+	}
+}
+
+// arrive assigns the stack to the variables of the join point, declaring them on the
+// first arrival, and returns the stack of variables.
+func (w *yulWriter) arrive(pc int, st yulStack) yulStack {
+	join, ok := w.joins[pc]
+	if !ok {
+		join = yulStack{below: st.below}
+		for i := range st.vals {
+			name := fmt.Sprintf("b%x_%d", pc, i)
+			join.vals = append(join.vals, name)
+			w.declared = append(w.declared, name)
+		}
+		w.joins[pc] = join
+	}
+	if len(st.vals) != len(join.vals) {
+		w.line("// stack height %d, 0x%x expects %d", len(st.vals), pc, len(join.vals))
+	}
+	var names, vals []string
+	for i := 1; i <= len(st.vals) && i <= len(join.vals); i++ {
+		if name, val := join.vals[len(join.vals)-i], st.vals[len(st.vals)-i]; val != name {
+			names, vals = append(names, name), append(vals, val)
+		}
+	}
+	// the values may read the variables being assigned, so those go through temporaries
+	prefix := fmt.Sprintf("b%x_", pc)
+	for i := range vals {
+		if len(vals) > 1 && strings.Contains(vals[i], prefix) {
+			tmp := fmt.Sprintf("t%d", w.vars)
+			w.vars++
+			w.line("let %s := %s", tmp, vals[i])
+			vals[i] = tmp
+		}
+	}
+	for i := range names {
+		w.line("%s := %s", names[i], vals[i])
+	}
+	return yulStack{vals: append([]string(nil), join.vals...), below: join.below}
+}
+
+// instrs writes the instructions of the block and continues at its successors.
+func (w *yulWriter) instrs(pc int, st yulStack) {
+	b := w.cfg.byStart[pc]
+	for _, in := range b.Instrs {
+		switch {
+		case in.Imm != nil:
+			st.push(new(uint256.Int).SetBytes(in.Imm).Hex())
+			continue
+		case in.Op >= DUP1 && in.Op <= DUP16:
+			n := int(in.Op-DUP1) + 1
+			st.ensure(n)
+			st.push(st.vals[len(st.vals)-n])
+			continue
+		case in.Op >= SWAP1 && in.Op <= SWAP16:
+			n := int(in.Op-SWAP1) + 1
+			st.ensure(n + 1)
+			top := len(st.vals) - 1
+			st.vals[top], st.vals[top-n] = st.vals[top-n], st.vals[top]
+			continue
+		}
+		switch in.Op {
+		case JUMPDEST:
+			continue
+		case POP:
+			st.pop()
+			continue
+		case JUMP:
+			dest := st.pop()
+			if !b.Resolved {
+				w.line("jump(%s) // unresolved", dest)
+				return
+			}
+			w.jump(b.Succs[0], st)
+			return
+		case JUMPI:
+			dest, cond := st.pop(), st.pop()
+			if !b.Resolved {
+				w.line("if %s { jump(%s) } // unresolved", cond, dest)
+				continue
+			}
+			if len(b.Succs) < 2 {
+				w.jump(b.Succs[0], st)
+				return
+			}
+			w.branch(cond, b.Succs[0], b.Succs[1], st)
+			return
+		}
+		op := w.cfg.jt[in.Op]
+		if op == nil {
+			w.line("invalid() // 0x%02x", byte(in.Op))
+			return
+		}
+		pops := op.minStack
+		pushes := int(params.StackLimit) + pops - op.maxStack
+		args := make([]string, pops)
+		for i := range args {
+			args[i] = st.pop()
+		}
+		name := strings.ToLower(in.Op.String())
+		if in.Op == SHA3 {
+			name = "keccak256"
+		}
+		call := fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+		switch {
+		case pushes == 0:
+			w.line("%s", call)
+		case volatileOps[in.Op]:
+			v := fmt.Sprintf("v%d", w.vars)
+			w.vars++
+			w.line("let %s := %s", v, call)
+			st.push(v)
+		default:
+			st.push(call)
+		}
+		if op.halts || op.reverts {
+			return
+		}
+	}
+	if len(b.Succs) == 0 {
+		w.line("stop()") // past the end of the code
+		return
+	}
+	w.jump(b.Succs[len(b.Succs)-1], st)
+}
+
+// branch writes a conditional jump to target falling through to next.
+func (w *yulWriter) branch(cond string, target, next int, st yulStack) {
+	join, ok := w.joinPoint(target, next)
+	taken := yulStack{vals: append([]string(nil), st.vals...), below: st.below}
+	switch {
+	case !ok:
+		// neither side comes back, so the smaller one goes into the if
+		if len(w.reach(target)) <= len(w.reach(next)) {
+			w.guarded(cond, target, taken)
+			w.jump(next, st)
+		} else {
+			w.guarded("iszero("+cond+")", next, st)
+			w.jump(target, taken)
+		}
+		return
+	case join == next:
+		w.stops[join] = true
+		w.guarded(cond, target, taken)
+		w.arrive(join, st)
+	case join == target:
+		w.stops[join] = true
+		w.guarded("iszero("+cond+")", next, st)
+		w.arrive(join, taken)
+	default:
+		w.stops[join] = true
+		w.line("switch %s", cond)
+		w.line("case 0 {")
+		w.depth++
+		w.jump(next, st)
+		w.depth--
+		w.line("}")
+		w.line("default {")
+		w.depth++
+		w.jump(target, taken)
+		w.depth--
+		w.line("}")
+	}
+	delete(w.stops, join)
+	joined, arrived := w.joins[join]
+	if !arrived {
+		return
+	}
+	if w.written[join] {
+		w.line("// continues at 0x%x", join)
+		return
+	}
+	w.enter(join, joined)
+}
+
+// guarded writes the code from the block under the condition.
+func (w *yulWriter) guarded(cond string, pc int, st yulStack) {
+	w.line("if %s {", cond)
+	w.depth++
+	w.jump(pc, st)
+	w.depth--
+	w.line("}")
+}
+
+// joinPoint returns the first block not written yet that both sides of a branch reach,
+// searching from the fall-through side.
+func (w *yulWriter) joinPoint(target, next int) (int, bool) {
+	fromTarget := make(map[int]bool)
+	for _, pc := range w.reach(target) {
+		fromTarget[pc] = true
+	}
+	for _, pc := range w.reach(next) {
+		if fromTarget[pc] && !w.written[pc] && !w.stops[pc] && (pc == next || pc == target || w.preds[pc] > 1) {
+			return pc, true
+		}
+	}
+	return 0, false
+}
+
+// reach lists in breadth-first order the blocks of the function reachable from the block
+// without going through written blocks or back to open loop headers.
+func (w *yulWriter) reach(from int) []int {
+	visited := map[int]bool{from: true}
+	order := []int{from}
+	for i := 0; i < len(order); i++ {
+		pc := order[i]
+		if w.open[pc] || w.stops[pc] || (w.written[pc] && i > 0) {
+			continue
+		}
+		for _, succ := range w.cfg.byStart[pc].Succs {
+			if w.in[succ] && !visited[succ] {
+				visited[succ] = true
+				order = append(order, succ)
+			}
+		}
+	}
+	return order
+}
@@ -180,6 +180,15 @@ func NewEVM(ctx Context, state IntraBlockState, chainConfig *params.ChainConfig,
 	return evm
 }
 
+// frameTracer returns the tracer in debug mode if it is a FrameTracer.
+func (evm *EVM) frameTracer() (FrameTracer, bool) {
+	if !evm.vmConfig.Debug {
+		return nil, false
+	}
+	ft, ok := evm.vmConfig.Tracer.(FrameTracer)
+	return ft, ok
+}
+
 // Cancel cancels any running EVM operation. This may be called concurrently and
 // it's safe to be called multiple times.
 func (evm *EVM) Cancel() {
@@ -225,6 +234,10 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 				_ = evm.vmConfig.Tracer.CaptureStart(evm.depth, caller.Address(), addr, false, input, gas, value.ToBig())
 				_ = evm.vmConfig.Tracer.CaptureEnd(evm.depth, ret, 0, 0, nil)
 			}
+			if ft, ok := evm.frameTracer(); ok {
+				_ = ft.CaptureEnter(CALL, evm.depth, caller.Address(), addr, input, gas, value.ToBig())
+				_ = ft.CaptureExit(evm.depth, ret, 0, nil)
+			}
 			return nil, gas, nil
 		}
 		if evm.vmConfig.Debug {
@@ -241,6 +254,12 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 			evm.vmConfig.Tracer.CaptureEnd(evm.depth, ret, startGas-gas, time.Since(startTime), err) //nolint:errcheck
 		}(gas, time.Now())
 	}
+	if ft, ok := evm.frameTracer(); ok {
+		_ = ft.CaptureEnter(CALL, evm.depth, caller.Address(), addr, input, gas, value.ToBig())
+		defer func(startGas uint64) { // Lazy evaluation of the parameters
+			ft.CaptureExit(evm.depth, ret, startGas-gas, err) //nolint:errcheck
+		}(gas)
+	}
 
 	if isPrecompile {
 		ret, gas, err = RunPrecompiledContract(p, input, gas)
@@ -300,6 +319,12 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	var (
 		snapshot = evm.IntraBlockState.Snapshot()
 	)
+	if ft, ok := evm.frameTracer(); ok {
+		_ = ft.CaptureEnter(CALLCODE, evm.depth, caller.Address(), addr, input, gas, value.ToBig())
+		defer func(startGas uint64) { // Lazy evaluation of the parameters
+			ft.CaptureExit(evm.depth, ret, startGas-gas, err) //nolint:errcheck
+		}(gas)
+	}
 
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
@@ -336,6 +361,12 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 		return nil, gas, ErrDepth
 	}
 	snapshot := evm.IntraBlockState.Snapshot()
+	if ft, ok := evm.frameTracer(); ok {
+		_ = ft.CaptureEnter(DELEGATECALL, evm.depth, caller.Address(), addr, input, gas, nil)
+		defer func(startGas uint64) { // Lazy evaluation of the parameters
+			ft.CaptureExit(evm.depth, ret, startGas-gas, err) //nolint:errcheck
+		}(gas)
+	}
 
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
@@ -382,6 +413,13 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	// future scenarios
 	evm.IntraBlockState.AddBalance(addr, u256.Num0)
 
+	if ft, ok := evm.frameTracer(); ok {
+		_ = ft.CaptureEnter(STATICCALL, evm.depth, caller.Address(), addr, input, gas, new(big.Int))
+		defer func(startGas uint64) { // Lazy evaluation of the parameters
+			ft.CaptureExit(evm.depth, ret, startGas-gas, err) //nolint:errcheck
+		}(gas)
+	}
+
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
 		ret, gas, err = RunPrecompiledContract(p, input, gas)
 	} else {
@@ -421,7 +459,7 @@ func (c *codeAndHash) Hash() common.Hash {
 }
 
 // create creates a new contract using code as deployment code.
-func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *uint256.Int, address common.Address) ([]byte, common.Address, uint64, error) {
+func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *uint256.Int, address common.Address, typ OpCode) ([]byte, common.Address, uint64, error) {
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
 	if evm.depth > int(params.CallCreateDepth) {
@@ -458,6 +496,10 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if evm.vmConfig.Debug {
 		_ = evm.vmConfig.Tracer.CaptureStart(evm.depth, caller.Address(), address, true, codeAndHash.code, gas, value.ToBig())
 	}
+	ft, traceFrame := evm.frameTracer()
+	if traceFrame {
+		_ = ft.CaptureEnter(typ, evm.depth, caller.Address(), address, codeAndHash.code, gas, value.ToBig())
+	}
 	start := time.Now()
 
 	ret, err := run(evm, contract, nil, false)
@@ -493,6 +535,9 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	if evm.vmConfig.Debug {
 		_ = evm.vmConfig.Tracer.CaptureEnd(evm.depth, ret, gas-contract.Gas, time.Since(start), err)
 	}
+	if traceFrame {
+		_ = ft.CaptureExit(evm.depth, ret, gas-contract.Gas, err)
+	}
 	return ret, address, contract.Gas, err
 
 }
@@ -504,7 +549,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *uint2
 	if evm.vmConfig.Debug {
 		evm.vmConfig.Tracer.CaptureCreate(caller.Address(), contractAddr)
 	}
-	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr)
+	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr, CREATE)
 }
 
 // Create2 creates a new contract using code as deployment code.
@@ -515,7 +560,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *uint2
 func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *uint256.Int, salt *uint256.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
 	codeAndHash := &codeAndHash{code: code}
 	contractAddr = crypto.CreateAddress2(caller.Address(), common.Hash(salt.Bytes32()), codeAndHash.Hash().Bytes())
-	return evm.create(caller, codeAndHash, gas, endowment, contractAddr)
+	return evm.create(caller, codeAndHash, gas, endowment, contractAddr, CREATE2)
 }
 
 // ChainConfig returns the environment's chain configuration
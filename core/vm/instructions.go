@@ -535,6 +535,9 @@ func opMstore8(pc *uint64, interpreter *EVMInterpreter, callContext *callCtx) ([
 func opSload(pc *uint64, interpreter *EVMInterpreter, callContext *callCtx) ([]byte, error) {
 	loc := callContext.stack.Peek()
 	interpreter.hasherBuf = loc.Bytes32()
+	if p := interpreter.cfg.Prefetcher; p != nil {
+		p.Loaded(callContext.contract.Address(), interpreter.hasherBuf)
+	}
 	interpreter.evm.IntraBlockState.GetState(callContext.contract.Address(), &interpreter.hasherBuf, loc)
 	return nil, nil
 }
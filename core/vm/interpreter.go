@@ -24,6 +24,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/common/math"
 	"github.com/ledgerwatch/turbo-geth/core/vm/stack"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/params"
 )
 
 // Config are the configuration options for the Interpreter
@@ -39,6 +40,15 @@ type Config struct {
 	EVMInterpreter   string // External EVM interpreter options
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	PrefetchState bool            // Prefetch storage slots predicted by static analysis before contracts run
+	Prefetcher    StatePrefetcher // Set by the execution stage when PrefetchState is enabled
+
+	ParallelTxs int // Workers of the execution stage running the transactions of a block optimistically, 0 to run them in order
+
+	Cancel <-chan struct{} // Aborts execution like EVM.Cancel once closed, e.g. ctx.Done() of a request
+
+	NoGasLimit bool // Instructions never run out of gas, the part of their cost above the gas left is waived
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
@@ -94,27 +104,31 @@ type EVMInterpreter struct {
 	returnData []byte // Last CALL's return data for subsequent reuse
 }
 
-// NewEVMInterpreter returns a new instance of the Interpreter.
-func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
-	var jt *JumpTable
+// forkInstructionSet selects the instruction set of the fork and returns it with the fork name.
+func forkInstructionSet(rules params.Rules) (string, *JumpTable) {
 	switch {
-	case evm.chainRules.IsYoloV1:
-		jt = &yoloV1InstructionSet
-	case evm.chainRules.IsIstanbul:
-		jt = &istanbulInstructionSet
-	case evm.chainRules.IsConstantinople:
-		jt = &constantinopleInstructionSet
-	case evm.chainRules.IsByzantium:
-		jt = &byzantiumInstructionSet
-	case evm.chainRules.IsEIP158:
-		jt = &spuriousDragonInstructionSet
-	case evm.chainRules.IsEIP150:
-		jt = &tangerineWhistleInstructionSet
-	case evm.chainRules.IsHomestead:
-		jt = &homesteadInstructionSet
+	case rules.IsYoloV1:
+		return "yoloV1", &yoloV1InstructionSet
+	case rules.IsIstanbul:
+		return "istanbul", &istanbulInstructionSet
+	case rules.IsConstantinople:
+		return "constantinople", &constantinopleInstructionSet
+	case rules.IsByzantium:
+		return "byzantium", &byzantiumInstructionSet
+	case rules.IsEIP158:
+		return "spuriousDragon", &spuriousDragonInstructionSet
+	case rules.IsEIP150:
+		return "tangerineWhistle", &tangerineWhistleInstructionSet
+	case rules.IsHomestead:
+		return "homestead", &homesteadInstructionSet
 	default:
-		jt = &frontierInstructionSet
+		return "frontier", &frontierInstructionSet
 	}
+}
+
+// NewEVMInterpreter returns a new instance of the Interpreter.
+func NewEVMInterpreter(evm *EVM, cfg Config) *EVMInterpreter {
+	_, jt := forkInstructionSet(evm.chainRules)
 	if len(cfg.ExtraEips) > 0 {
 		jtCopy := *jt
 		for i, eip := range cfg.ExtraEips {
@@ -192,6 +206,9 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	}()
 	contract.Input = input
 
+	if in.cfg.Prefetcher != nil {
+		in.cfg.Prefetcher.Prefetch(contract.Address(), contract.CodeHash, contract.Code)
+	}
 	if in.cfg.Debug {
 		defer func() {
 			if err != nil {
@@ -210,7 +227,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	steps := 0
 	for {
 		steps++
-		if steps%1000 == 0 && atomic.LoadInt32(&in.evm.abort) != 0 {
+		if steps%1000 == 0 && (atomic.LoadInt32(&in.evm.abort) != 0 || in.cancelled()) {
 			break
 		}
 		if in.cfg.Debug {
@@ -245,7 +262,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 		}
 		// Static portion of gas
 		cost = operation.constantGas // For tracing
-		if !contract.UseGas(operation.constantGas) {
+		if !in.useGas(contract, operation.constantGas) {
 			return nil, ErrOutOfGas
 		}
 
@@ -272,7 +289,7 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 			var dynamicCost uint64
 			dynamicCost, err = operation.dynamicGas(in.evm, contract, locStack, mem, memorySize)
 			cost += dynamicCost // total cost, for debug tracing
-			if err != nil || !contract.UseGas(dynamicCost) {
+			if err != nil || !in.useGas(contract, dynamicCost) {
 				return nil, ErrOutOfGas
 			}
 		}
@@ -307,6 +324,31 @@ func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool) (
 	return nil, nil
 }
 
+// useGas charges the gas to the contract. Without a gas limit the gas left is charged if
+// it is not enough, and the execution goes on.
+func (in *EVMInterpreter) useGas(contract *Contract, gas uint64) bool {
+	if contract.UseGas(gas) {
+		return true
+	}
+	if !in.cfg.NoGasLimit {
+		return false
+	}
+	contract.Gas = 0
+	return true
+}
+
+// cancelled tells if the Cancel channel of the config is closed, and then aborts the EVM so
+// that the calling frames stop as well.
+func (in *EVMInterpreter) cancelled() bool {
+	select {
+	case <-in.cfg.Cancel:
+		in.evm.Cancel()
+		return true
+	default:
+		return false
+	}
+}
+
 // CanRun tells if the contract, passed as an argument, can be
 // run by the current interpreter.
 func (in *EVMInterpreter) CanRun(code []byte) bool {
@@ -115,6 +115,15 @@ type Tracer interface {
 	CaptureAccountWrite(account common.Address) error
 }
 
+// FrameTracer is implemented by the tracers which want to be told about every call frame
+// with its kind. CaptureStart and CaptureEnd are only called for the frames of CALL and
+// contract creations, CaptureEnter and CaptureExit are also called for those of CALLCODE,
+// DELEGATECALL and STATICCALL. The value of a DELEGATECALL is nil, that of the caller.
+type FrameTracer interface {
+	CaptureEnter(typ OpCode, depth int, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error
+	CaptureExit(depth int, output []byte, gasUsed uint64, err error) error
+}
+
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
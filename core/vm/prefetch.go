@@ -0,0 +1,51 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"github.com/ledgerwatch/turbo-geth/common"
+)
+
+// StatePrefetcher is told by the interpreter about code before it runs and about every
+// SLOAD, so that it can load the state the code is predicted to read in the background
+// and measure how good the prediction was. Both are called from the executing goroutine
+// and must not block.
+type StatePrefetcher interface {
+	// Prefetch is called before the code runs against the storage of address.
+	Prefetch(address common.Address, codeHash common.Hash, code []byte)
+	// Loaded is called on every SLOAD.
+	Loaded(address common.Address, key common.Hash)
+}
+
+// PredictedSlots returns the storage slots the code reads at constant positions, as found
+// by the CFG analysis. Slots of mappings and arrays depend on runtime values and are not
+// predicted.
+func PredictedSlots(code []byte) []common.Hash {
+	var slots []common.Hash
+	seen := make(map[common.Hash]bool)
+	for _, a := range NewCfg(code).StorageAccesses() {
+		if a.Op != SLOAD || a.Slot == nil {
+			continue
+		}
+		slot := common.Hash(a.Slot.Bytes32())
+		if !seen[slot] {
+			seen[slot] = true
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
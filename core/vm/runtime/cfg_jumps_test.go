@@ -0,0 +1,102 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+)
+
+// TestCfgConcreteJumps runs the fixtures of the CFG corpus, with every selector found in
+// their dispatcher as input, and checks that the CFG has every edge the execution took.
+func TestCfgConcreteJumps(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "testdata", "cfg", "*.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fixtures in the CFG corpus")
+	}
+	// the edges expected of some fixtures, with the times taken
+	expected := map[string]map[vm.CfgEdge]int{
+		"loop":          {{From: 10, To: 11}: 10, {From: 10, To: 17}: 1, {From: 16, To: 2}: 10},
+		"internal_call": {{From: 4, To: 7}: 1, {From: 11, To: 5}: 1},
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".hex")
+		code := common.FromHex(string(bytes.TrimSpace(data)))
+		cfg := vm.NewCfg(code)
+		recorder := vm.NewJumpRecorder(crypto.Keccak256Hash(code))
+		inputs := [][]byte{nil}
+		for _, f := range cfg.Functions {
+			input := make([]byte, 4)
+			binary.BigEndian.PutUint32(input, f.Selector)
+			inputs = append(inputs, input)
+		}
+		for _, input := range inputs {
+			// failing executions count as well, the jumps before the failure were taken
+			Execute(code, input, &Config{EVMConfig: vm.Config{Debug: true, Tracer: recorder}}, 0) //nolint:errcheck
+		}
+
+		var edges []vm.CfgEdge
+		for e := range recorder.Edges() {
+			edges = append(edges, e)
+		}
+		unsound, unresolved := cfg.CheckEdges(edges)
+		if len(unsound) > 0 {
+			t.Errorf("%s: edges missing from the CFG %v", name, unsound)
+		}
+		for _, e := range unresolved {
+			if cfg.Block(e.To) == nil {
+				t.Errorf("%s: unresolved jump %d to %d, which is not a block", name, e.From, e.To)
+			}
+		}
+		if exp, ok := expected[name]; ok && !reflect.DeepEqual(recorder.Edges(), exp) {
+			t.Errorf("%s: edges %v, expected %v", name, recorder.Edges(), exp)
+		}
+	}
+}
+
+func TestCheckEdges(t *testing.T) {
+	// internal_call: a call of the function at 7 returning to 5 through an unresolved jump
+	cfg := vm.NewCfg(common.FromHex("6005600756" + "5b00" + "5b60015056"))
+	unsound, unresolved := cfg.CheckEdges([]vm.CfgEdge{
+		{From: 11, To: 5}, // the return
+		{From: 4, To: 7},  // the call
+		{From: 4, To: 5},  // a resolved jump elsewhere
+		{From: 2, To: 7},  // not a jump
+	})
+	if exp := []vm.CfgEdge{{From: 2, To: 7}, {From: 4, To: 5}}; !reflect.DeepEqual(unsound, exp) {
+		t.Errorf("unsound %v, expected %v", unsound, exp)
+	}
+	if exp := []vm.CfgEdge{{From: 11, To: 5}}; !reflect.DeepEqual(unresolved, exp) {
+		t.Errorf("unresolved %v, expected %v", unresolved, exp)
+	}
+}
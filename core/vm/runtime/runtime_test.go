@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -102,6 +103,50 @@ func TestExecute(t *testing.T) {
 	}
 }
 
+func TestExecuteCancel(t *testing.T) {
+	cancel := make(chan struct{})
+	close(cancel)
+	done := make(chan error, 1)
+	go func() {
+		// an endless loop, the default gas limit does not stop it
+		_, _, err := Execute([]byte{
+			byte(vm.JUMPDEST),
+			byte(vm.PUSH1), 0,
+			byte(vm.JUMP),
+		}, nil, &Config{EVMConfig: vm.Config{Cancel: cancel}}, 0)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("didn't expect error", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("execution was not cancelled")
+	}
+}
+
+func TestExecuteNoGasLimit(t *testing.T) {
+	code := []byte{
+		byte(vm.PUSH1), 10,
+		byte(vm.PUSH1), 0,
+		byte(vm.MSTORE),
+		byte(vm.PUSH1), 32,
+		byte(vm.PUSH1), 0,
+		byte(vm.RETURN),
+	}
+	if _, _, err := Execute(code, nil, &Config{GasLimit: 10}, 0); err != vm.ErrOutOfGas {
+		t.Fatalf("expected %v, got %v", vm.ErrOutOfGas, err)
+	}
+	ret, _, err := Execute(code, nil, &Config{GasLimit: 10, EVMConfig: vm.Config{NoGasLimit: true}}, 0)
+	if err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	if num := new(big.Int).SetBytes(ret); num.Cmp(big.NewInt(10)) != 0 {
+		t.Error("Expected 10, got", num)
+	}
+}
+
 func TestCall(t *testing.T) {
 	db := ethdb.NewMemDatabase()
 	defer db.Close()
@@ -444,6 +489,65 @@ func TestReturnSubShallow(t *testing.T) {
 	}
 }
 
+// frameRecorder records the frames told to a FrameTracer.
+type frameRecorder struct {
+	stepCounter
+	frames []string
+	exits  int
+}
+
+func (r *frameRecorder) CaptureEnter(typ vm.OpCode, depth int, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	r.frames = append(r.frames, fmt.Sprintf("%d %v", depth, typ))
+	return nil
+}
+
+func (r *frameRecorder) CaptureExit(depth int, output []byte, gasUsed uint64, err error) error {
+	r.exits++
+	return nil
+}
+
+func TestFrameTracer(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	var (
+		tds     = state.NewTrieDbState(common.Hash{}, db, 0)
+		state   = state.New(tds)
+		address = common.HexToAddress("0x0a")
+		callee  = common.HexToAddress("0x0b")
+	)
+	// DELEGATECALL, STATICCALL and CALLCODE the callee, which CREATEs and CREATE2s empty contracts,
+	// salted with the gas left not to collide in the context of address
+	var code []byte
+	for _, op := range []vm.OpCode{vm.DELEGATECALL, vm.STATICCALL, vm.CALLCODE} {
+		code = append(code, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0)
+		if op == vm.CALLCODE {
+			code = append(code, byte(vm.PUSH1), 0)
+		}
+		code = append(code, byte(vm.PUSH1), 0x0b, byte(vm.GAS), byte(op), byte(vm.POP))
+	}
+	state.SetCode(address, code)
+	state.SetCode(callee, []byte{
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.CREATE), byte(vm.POP),
+		byte(vm.GAS), byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.CREATE2), byte(vm.POP),
+	})
+	tracer := frameRecorder{}
+	_, _, err := Call(address, nil, &Config{State: state,
+		ChainConfig: params.AllEthashProtocolChanges,
+		EVMConfig:   vm.Config{Debug: true, Tracer: &tracer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// creations are not allowed in a static call
+	exp := []string{"0 CALL", "1 DELEGATECALL", "2 CREATE", "2 CREATE2", "1 STATICCALL", "1 CALLCODE", "2 CREATE", "2 CREATE2"}
+	if !reflect.DeepEqual(exp, tracer.frames) {
+		t.Errorf("frames %v, expected %v", tracer.frames, exp)
+	}
+	if tracer.exits != len(tracer.frames) {
+		t.Errorf("%d frames exited, expected %d", tracer.exits, len(tracer.frames))
+	}
+}
+
 // disabled -- only used for generating markdown
 func DisabledTestReturnCases(t *testing.T) {
 	tracer := stepCounter{inner: vm.NewJSONLogger(nil, os.Stdout)}
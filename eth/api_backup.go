@@ -0,0 +1,95 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// PrivateBackupAPI copies the chain database while the node runs, it is exposed over the
+// private admin endpoint. One backup runs at a time.
+type PrivateBackupAPI struct {
+	eth *Ethereum
+
+	mu     sync.Mutex
+	status BackupStatus
+	cancel context.CancelFunc // of the running backup
+}
+
+// BackupStatus is the state of the last backup.
+type BackupStatus struct {
+	Dir     string    `json:"dir"`
+	Running bool      `json:"running"`
+	Started time.Time `json:"started"`
+	Written uint64    `json:"written"` // bytes
+	Total   uint64    `json:"total"`   // estimate, in bytes
+	Error   string    `json:"error,omitempty"`
+}
+
+// NewPrivateBackupAPI creates the backup API of the Ethereum service.
+func NewPrivateBackupAPI(eth *Ethereum) *PrivateBackupAPI {
+	return &PrivateBackupAPI{eth: eth}
+}
+
+// Backup starts copying the chain database into dir, as an LMDB database, and returns
+// without waiting, see BackupStatus. The writing is limited to limitMB megabytes per second,
+// if set, to leave the disk to the sync.
+func (api *PrivateBackupAPI) Backup(dir string, limitMB *uint64) (bool, error) {
+	if dir == "" {
+		return false, errors.New("dir is required")
+	}
+	var limit datasize.ByteSize
+	if limitMB != nil {
+		limit = datasize.ByteSize(*limitMB) * datasize.MB
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.status.Running {
+		return false, errors.New("a backup is running already")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	api.cancel = cancel
+	api.status = BackupStatus{Dir: dir, Running: true, Started: time.Now()}
+	go func() {
+		defer cancel()
+		err := ethdb.Backup(ctx, api.eth.ChainKV(), dir, limit, func(p ethdb.BackupProgress) {
+			api.mu.Lock()
+			api.status.Written, api.status.Total = p.Written, p.Total
+			api.mu.Unlock()
+		})
+		if err != nil {
+			log.Warn("Backup failed", "dir", dir, "err", err)
+		}
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		api.status.Running = false
+		if err != nil {
+			api.status.Error = err.Error()
+		}
+	}()
+	return true, nil
+}
+
+// BackupStatus returns the progress of the running backup, or the outcome of the last one.
+func (api *PrivateBackupAPI) BackupStatus() BackupStatus {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return api.status
+}
+
+// AbortBackup stops the running backup, removing the partial copy.
+func (api *PrivateBackupAPI) AbortBackup() (bool, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if !api.status.Running {
+		return false, errors.New("no backup is running")
+	}
+	api.cancel()
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package eth
+
+import (
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+// PrivatePruneAPI prunes the chain database on demand, it is exposed over the private admin
+// endpoint. The sync prunes at the end of each cycle as well, in the Prune stage.
+type PrivatePruneAPI struct {
+	eth *Ethereum
+	mu  sync.Mutex
+}
+
+// NewPrivatePruneAPI creates the prune API of the Ethereum service.
+func NewPrivatePruneAPI(eth *Ethereum) *PrivatePruneAPI {
+	return &PrivatePruneAPI{eth: eth}
+}
+
+// Prune deletes the data below the retention of mode, in the format of the --prune flag, or
+// of the mode of the node if not set, up to the last executed block. It returns what was
+// deleted of each class when done.
+func (api *PrivatePruneAPI) Prune(mode *string) ([]stagedsync.PruneResult, error) {
+	db := api.eth.ChainDb()
+	var pm ethdb.PruneMode
+	var err error
+	if mode != nil {
+		pm, err = ethdb.PruneModeFromString(*mode)
+	} else {
+		pm, err = ethdb.GetPruneModeFromDB(db)
+	}
+	if err != nil {
+		return nil, err
+	}
+	head, _, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return nil, err
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	results, err := stagedsync.Prune(db, pm, head, nil)
+	if results == nil {
+		results = []stagedsync.PruneResult{}
+	}
+	return results, err
+}
+
+// PruneMode returns the retention policy of the node.
+func (api *PrivatePruneAPI) PruneMode() (string, error) {
+	pm, err := ethdb.GetPruneModeFromDB(api.eth.ChainDb())
+	return pm.ToString(), err
+}
@@ -71,6 +71,8 @@ type Ethereum struct {
 	chainDb *ethdb.ObjectDatabase // Block chain database
 	chainKV ethdb.KV              // Same as chainDb, but different interface
 
+	sizeSampler *ethdb.SizeSampler // growth of the database, see the db/growth route of the restapi
+
 	eventMux       *event.TypeMux
 	engine         consensus.Engine
 	accountManager *accounts.Manager
@@ -134,10 +136,24 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		}
 	}
 
+	// the migrations follow the storage mode, e.g. the compression
+	err = ethdb.SetStorageModeIfNotExist(chainDb, config.StorageMode)
+	if err != nil {
+		return nil, err
+	}
 	err = migrations.NewMigrator().Apply(chainDb, stack.Config().DataDir)
 	if err != nil {
 		return nil, err
 	}
+	compressed, err := ethdb.WithCompression(chainDb.KV())
+	if err != nil {
+		return nil, err
+	}
+	chainDb.SetKV(compressed)
+	if stack.Config().PrivateApiAddr != "" {
+		// for the clients of the private API to watch the changes
+		chainDb.SetKV(ethdb.NewWatchedKV(chainDb.KV()))
+	}
 
 	chainConfig, genesisHash, _, genesisErr := core.SetupGenesisBlock(chainDb, config.Genesis, config.StorageMode.History, false /* overwrite */)
 
@@ -150,6 +166,7 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		config:            config,
 		chainDb:           chainDb,
 		chainKV:           chainDb.KV(),
+		sizeSampler:       ethdb.NewSizeSampler(chainDb.KV()),
 		eventMux:          stack.EventMux(),
 		accountManager:    stack.AccountManager(),
 		engine:            CreateConsensusEngine(stack, chainConfig, &config.Ethash, config.Miner.Notify, config.Miner.Noverify, chainDb),
@@ -179,11 +196,6 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		}
 	}
 
-	err = ethdb.SetStorageModeIfNotExist(chainDb, config.StorageMode)
-	if err != nil {
-		return nil, err
-	}
-
 	sm, err := ethdb.GetStorageModeFromDB(chainDb)
 	if err != nil {
 		return nil, err
@@ -191,6 +203,9 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	if !reflect.DeepEqual(sm, config.StorageMode) {
 		return nil, errors.New("mode is " + config.StorageMode.ToString() + " original mode is " + sm.ToString())
 	}
+	if err = ethdb.SetPruneMode(chainDb, config.PruneMode); err != nil {
+		return nil, err
+	}
 
 	vmConfig, cacheConfig := BlockchainRuntimeConfig(config)
 	txCacher := core.NewTxSenderCacher(runtime.NumCPU())
@@ -225,7 +240,15 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, chainDb, txCacher)
 
 	if stack.Config().PrivateApiAddr != "" {
-		remotedbserver.StartGrpc(chainDb.KV(), eth, stack.Config().PrivateApiAddr)
+		if err = remotedbserver.StartGrpc(chainDb.KV(), eth, stack.Config().PrivateApiAddr, remotedbserver.Config{
+			TLSCert:    stack.Config().PrivateApiTLSCert,
+			TLSKey:     stack.Config().PrivateApiTLSKey,
+			TLSCACert:  stack.Config().PrivateApiTLSCACert,
+			Token:      stack.Config().PrivateApiToken,
+			WriteToken: stack.Config().PrivateApiWriteToken,
+		}); err != nil {
+			return nil, err
+		}
 	}
 
 	checkpoint := config.Checkpoint
@@ -288,6 +311,8 @@ func BlockchainRuntimeConfig(config *Config) (vm.Config, *core.CacheConfig) {
 	var (
 		vmConfig = vm.Config{
 			EnablePreimageRecording: config.EnablePreimageRecording,
+			PrefetchState:           config.PrefetchState,
+			ParallelTxs:             config.ParallelTxs,
 			EWASMInterpreter:        config.EWASMInterpreter,
 			EVMInterpreter:          config.EVMInterpreter,
 		}
@@ -404,6 +429,16 @@ func (s *Ethereum) APIs() []rpc.API {
 		//	Version:   "1.0",
 		//	Service:   NewPrivateAdminAPI(s),
 		//},
+		{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   NewPrivateBackupAPI(s),
+		},
+		{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   NewPrivatePruneAPI(s),
+		},
 		//{
 		//	Namespace: "debug",
 		//	Version:   "1.0",
@@ -613,6 +648,7 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 // Ethereum protocol implementation.
 func (s *Ethereum) Start() error {
 	s.startEthEntryUpdate(s.p2pServer.LocalNode())
+	s.sizeSampler.Start()
 
 	// Start the bloom bits servicing goroutines
 	if s.config.SyncMode != downloader.StagedSync {
@@ -675,6 +711,7 @@ func (s *Ethereum) Stop() error {
 	if s.txPool != nil {
 		s.txPool.Stop()
 	}
+	s.sizeSampler.Stop()
 	//s.chainDb.Close()
 	return nil
 }
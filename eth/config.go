@@ -122,6 +122,7 @@ type Config struct {
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
 
 	StorageMode ethdb.StorageMode
+	PruneMode   ethdb.PruneMode
 
 	// DownloadOnly is set when the node does not need to process the blocks, but simply
 	// download them
@@ -174,6 +175,12 @@ type Config struct {
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
+	// Prefetches storage slots predicted by static analysis before contracts run
+	PrefetchState bool
+
+	// Workers executing the transactions of a block in parallel, 0 to execute them in order
+	ParallelTxs int
+
 	// Enables the dbg protocol
 	EnableDebugProtocol bool
 
@@ -25,6 +25,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/bloombits"
 	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/event"
 	"github.com/ledgerwatch/turbo-geth/rpc"
@@ -147,13 +148,23 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		logs []*types.Log
 		err  error
 	)
+	if indexed, _, _ := stages.GetStageProgress(f.db, stages.LogIndex); indexed >= uint64(f.begin) && f.narrowed() {
+		if indexed > end {
+			indexed = end
+		}
+		if logs, err = f.logIndexLogs(ctx, indexed); err != nil {
+			return logs, err
+		}
+	}
 	size, sections := f.backend.BloomStatus()
 	if indexed := sections * size; indexed > uint64(f.begin) {
+		var found []*types.Log
 		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
+			found, err = f.indexedLogs(ctx, end)
 		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
+			found, err = f.indexedLogs(ctx, indexed-1)
 		}
+		logs = append(logs, found...)
 		if err != nil {
 			return logs, err
 		}
@@ -210,6 +221,44 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 	}
 }
 
+// narrowed is whether the filter has an address or a topic, to look up in the log index.
+func (f *Filter) narrowed() bool {
+	if len(f.addresses) > 0 {
+		return true
+	}
+	for _, position := range f.topics {
+		if len(position) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// logIndexLogs returns the logs matching the filter criteria in the blocks of the log index.
+func (f *Filter) logIndexLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	blocks, err := core.LogIndexBlocks(f.db, f.addresses, f.topics, uint64(f.begin), end)
+	if err != nil {
+		return nil, err
+	}
+	var logs []*types.Log
+	for _, number := range blocks {
+		if err := ctx.Err(); err != nil {
+			return logs, err
+		}
+		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if header == nil || err != nil {
+			return logs, err
+		}
+		found, err := f.checkMatches(ctx, header)
+		if err != nil {
+			return logs, err
+		}
+		logs = append(logs, found...)
+	}
+	f.begin = int64(end) + 1
+	return logs, nil
+}
+
 // unindexedLogs returns the logs matching the filter criteria based on raw block
 // iteration and bloom matching.
 func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
@@ -29,6 +29,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		LightIngress            int                    `toml:",omitempty"`
 		LightEgress             int                    `toml:",omitempty"`
 		StorageMode             string
+		PruneMode               string
 		ArchiveSyncInterval     int
 		LightServ               int `toml:",omitempty"`
 		LightPeers              int `toml:",omitempty"`
@@ -48,6 +49,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
 		EnablePreimageRecording bool
+		PrefetchState           bool
+		ParallelTxs             int
 		DocRoot                 string `toml:"-"`
 		EWASMInterpreter        string
 		EVMInterpreter          string
@@ -66,6 +69,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TxLookupLimit = c.TxLookupLimit
 	enc.Whitelist = c.Whitelist
 	enc.StorageMode = c.StorageMode.ToString()
+	enc.PruneMode = c.PruneMode.ToString()
 	enc.ArchiveSyncInterval = c.ArchiveSyncInterval
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -86,6 +90,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
+	enc.PrefetchState = c.PrefetchState
+	enc.ParallelTxs = c.ParallelTxs
 	enc.DocRoot = c.DocRoot
 	enc.EWASMInterpreter = c.EWASMInterpreter
 	enc.EVMInterpreter = c.EVMInterpreter
@@ -110,6 +116,7 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		LightIngress            *int                   `toml:",omitempty"`
 		LightEgress             *int                   `toml:",omitempty"`
 		Mode                    *string
+		PruneMode               *string
 		ArchiveSyncInterval     *int
 		LightServ               *int `toml:",omitempty"`
 		LightPeers              *int `toml:",omitempty"`
@@ -129,6 +136,8 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
 		EnablePreimageRecording *bool
+		PrefetchState           *bool
+		ParallelTxs             *int
 		DocRoot                 *string `toml:"-"`
 		EWASMInterpreter        *string
 		EVMInterpreter          *string
@@ -172,6 +181,13 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		}
 		c.StorageMode = mode
 	}
+	if dec.PruneMode != nil {
+		mode, err := ethdb.PruneModeFromString(*dec.PruneMode)
+		if err != nil {
+			return err
+		}
+		c.PruneMode = mode
+	}
 	if dec.ArchiveSyncInterval != nil {
 		c.ArchiveSyncInterval = *dec.ArchiveSyncInterval
 	}
@@ -232,6 +248,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.EnablePreimageRecording != nil {
 		c.EnablePreimageRecording = *dec.EnablePreimageRecording
 	}
+	if dec.PrefetchState != nil {
+		c.PrefetchState = *dec.PrefetchState
+	}
+	if dec.ParallelTxs != nil {
+		c.ParallelTxs = *dec.ParallelTxs
+	}
 	if dec.DocRoot != nil {
 		c.DocRoot = *dec.DocRoot
 	}
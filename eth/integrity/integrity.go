@@ -0,0 +1,320 @@
+// Package integrity verifies the invariants between the buckets of a chain database.
+package integrity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/trie"
+)
+
+// Checks, the invariants verified.
+const (
+	Bodies    = "bodies"    // every canonical header has a body
+	TxLookup  = "txlookup"  // the transactions of the bodies are found by the tx lookup
+	History   = "history"   // the keys of the changesets are in the history indexes at their blocks
+	StateRoot = "stateroot" // the state recomputes to the root of the header
+)
+
+// Finding is an invariant which doesn't hold.
+type Finding struct {
+	Check   string        `json:"check"`
+	Block   uint64        `json:"block"`
+	Key     hexutil.Bytes `json:"key,omitempty"`
+	Message string        `json:"message"`
+}
+
+func (f Finding) String() string {
+	if len(f.Key) > 0 {
+		return fmt.Sprintf("%s: block %d, key %x: %s", f.Check, f.Block, []byte(f.Key), f.Message)
+	}
+	return fmt.Sprintf("%s: block %d: %s", f.Check, f.Block, f.Message)
+}
+
+// Config selects what Check verifies.
+type Config struct {
+	From, To    uint64   // blocks, To zero for the progress of the Execution stage
+	StateRoots  []uint64 // blocks the state root is recomputed at, the state is rebuilt for each
+	TmpDir      string   // where the state is rebuilt, the system one if empty
+	MaxFindings int      // Check stops after so many findings, zero for no limit
+}
+
+var errEnough = errors.New("enough findings")
+
+type checker struct {
+	ctx      context.Context
+	db       *ethdb.ObjectDatabase
+	cfg      Config
+	findings []Finding
+}
+
+func (c *checker) report(f Finding) error {
+	log.Warn("Integrity", "finding", f)
+	c.findings = append(c.findings, f)
+	if c.cfg.MaxFindings > 0 && len(c.findings) >= c.cfg.MaxFindings {
+		return errEnough
+	}
+	return nil
+}
+
+// Check verifies the blocks cfg.From..cfg.To, the tx lookup and the history indexes only
+// up to the progress of their stages, and only if the storage mode keeps them.
+func Check(ctx context.Context, db *ethdb.ObjectDatabase, cfg Config) ([]Finding, error) {
+	if cfg.To == 0 {
+		executed, _, err := stages.GetStageProgress(db, stages.Execution)
+		if err != nil {
+			return nil, err
+		}
+		cfg.To = executed
+	}
+	c := &checker{ctx: ctx, db: db, cfg: cfg}
+	err := c.check()
+	if errors.Is(err, errEnough) {
+		err = nil
+	}
+	return c.findings, err
+}
+
+func (c *checker) check() error {
+	sm, err := ethdb.GetStorageModeFromDB(c.db)
+	if err != nil {
+		return err
+	}
+	txLookupTo, err := c.progress(stages.TxLookup, sm.TxIndex)
+	if err != nil {
+		return err
+	}
+	if err = c.checkBodies(txLookupTo); err != nil {
+		return err
+	}
+	accountsTo, err := c.progress(stages.AccountHistoryIndex, sm.History)
+	if err != nil {
+		return err
+	}
+	if err = c.checkHistory(dbutils.PlainAccountChangeSetBucket, dbutils.AccountsHistoryBucket, accountsTo); err != nil {
+		return err
+	}
+	storageTo, err := c.progress(stages.StorageHistoryIndex, sm.History)
+	if err != nil {
+		return err
+	}
+	if err = c.checkHistory(dbutils.PlainStorageChangeSetBucket, dbutils.StorageHistoryBucket, storageTo); err != nil {
+		return err
+	}
+	for _, block := range c.cfg.StateRoots {
+		if err = c.checkStateRoot(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// progress is the last block to check against the output of the stage, cfg.To at most.
+func (c *checker) progress(stage stages.SyncStage, enabled bool) (uint64, error) {
+	if !enabled {
+		return 0, nil
+	}
+	progress, _, err := stages.GetStageProgress(c.db, stage)
+	if progress > c.cfg.To {
+		progress = c.cfg.To
+	}
+	return progress, err
+}
+
+func (c *checker) checkBodies(txLookupTo uint64) error {
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	for number := c.cfg.From; number <= c.cfg.To; number++ {
+		if err := common.Stopped(c.ctx.Done()); err != nil {
+			return err
+		}
+		select {
+		case <-logEvery.C:
+			log.Info("Integrity: bodies", "block", number)
+		default:
+		}
+
+		hash := rawdb.ReadCanonicalHash(c.db, number)
+		if hash == (common.Hash{}) {
+			if err := c.report(Finding{Check: Bodies, Block: number, Message: "no canonical hash"}); err != nil {
+				return err
+			}
+			continue
+		}
+		if rawdb.ReadHeader(c.db, hash, number) == nil {
+			if err := c.report(Finding{Check: Bodies, Block: number, Key: hash[:], Message: "no header of the canonical hash"}); err != nil {
+				return err
+			}
+		}
+		body := rawdb.ReadBody(c.db, hash, number)
+		if body == nil {
+			if err := c.report(Finding{Check: Bodies, Block: number, Key: hash[:], Message: "no body"}); err != nil {
+				return err
+			}
+			continue
+		}
+		if number > txLookupTo || number == 0 {
+			continue
+		}
+		for _, tx := range body.Transactions {
+			found := rawdb.ReadTxLookupEntry(c.db, tx.Hash())
+			if found == nil {
+				err := c.report(Finding{Check: TxLookup, Block: number, Key: tx.Hash().Bytes(), Message: "no tx lookup entry"})
+				if err != nil {
+					return err
+				}
+			} else if *found != number {
+				err := c.report(Finding{Check: TxLookup, Block: number, Key: tx.Hash().Bytes(), Message: fmt.Sprintf("tx lookup entry points at block %d", *found)})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *checker) checkHistory(changeSetBucket, indexBucket string, to uint64) error {
+	walker := func(cs []byte) changeset.Walker { return changeset.AccountChangeSetPlainBytes(cs) }
+	if changeSetBucket == dbutils.PlainStorageChangeSetBucket {
+		walker = func(cs []byte) changeset.Walker { return changeset.StorageChangeSetPlainBytes(cs) }
+	}
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	return c.db.Walk(changeSetBucket, dbutils.EncodeTimestamp(c.cfg.From), 0, func(k, v []byte) (bool, error) {
+		if err := common.Stopped(c.ctx.Done()); err != nil {
+			return false, err
+		}
+		number, _ := dbutils.DecodeTimestamp(k)
+		if number > to {
+			return false, nil
+		}
+		select {
+		case <-logEvery.C:
+			log.Info("Integrity: history", "bucket", indexBucket, "block", number)
+		default:
+		}
+		return true, walker(v).Walk(func(key, _ []byte) error {
+			chunk, err := c.db.GetIndexChunk(indexBucket, key, number)
+			if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+				return err
+			}
+			if len(chunk) == 0 {
+				return c.report(Finding{Check: History, Block: number, Key: common.CopyBytes(key), Message: "no chunk in " + indexBucket})
+			}
+			if _, _, ok := dbutils.WrapHistoryIndex(chunk).Search(number); !ok {
+				return c.report(Finding{Check: History, Block: number, Key: common.CopyBytes(key), Message: "not in " + indexBucket})
+			}
+			return nil
+		})
+	})
+}
+
+func (c *checker) checkStateRoot(block uint64) error {
+	header := rawdb.ReadHeader(c.db, rawdb.ReadCanonicalHash(c.db, block), block)
+	if header == nil {
+		return c.report(Finding{Check: StateRoot, Block: block, Message: "no canonical header"})
+	}
+	root, err := ComputeStateRoot(c.db, block, c.cfg.TmpDir)
+	if err != nil {
+		return err
+	}
+	if root != header.Root {
+		return c.report(Finding{Check: StateRoot, Block: block, Message: fmt.Sprintf("computed root %x, header has %x", root, header.Root)})
+	}
+	log.Info("Integrity: state root", "block", block, "root", root)
+	return nil
+}
+
+// ComputeStateRoot computes the root of the state after the block from the plain state and
+// the history. The hashed state as of the block is written into a database in tmpdir first,
+// so it takes the space of the hashed state.
+func ComputeStateRoot(db *ethdb.ObjectDatabase, block uint64, tmpdir string) (common.Hash, error) {
+	dir, err := ioutil.TempDir(tmpdir, "integrity")
+	if err != nil {
+		return common.Hash{}, err
+	}
+	defer os.RemoveAll(dir)
+	kv, err := ethdb.NewLMDB().Path(dir).Open()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	hashed := ethdb.NewObjectDatabase(kv)
+	defer hashed.Close()
+
+	// the history is thin: the storage keys don't have the incarnations, those of the accounts
+	// as of the block are used
+	incarnations := make(map[common.Address]uint64)
+	batch := hashed.NewBatch()
+	put := func(k, v []byte) error {
+		if err := batch.Put(dbutils.CurrentStateBucket, k, v); err != nil {
+			return err
+		}
+		if batch.BatchSize() < batch.IdealBatchSize() {
+			return nil
+		}
+		return batch.CommitAndBegin()
+	}
+	if err = state.WalkAsOf(db.KV(), dbutils.PlainStateBucket, dbutils.AccountsHistoryBucket, nil, 0, block+1, func(k, v []byte) (bool, error) {
+		var acc accounts.Account
+		if err := acc.DecodeForStorage(v); err != nil {
+			return false, err
+		}
+		if acc.Incarnation > 0 {
+			incarnations[common.BytesToAddress(k)] = acc.Incarnation
+			if acc.IsEmptyCodeHash() { // the changesets omit code hashes
+				codeHash, err := db.Get(dbutils.PlainContractCodeBucket, dbutils.PlainGenerateStoragePrefix(k, acc.Incarnation))
+				if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+					return false, err
+				}
+				acc.CodeHash = common.BytesToHash(codeHash)
+			}
+		}
+		enc := make([]byte, acc.EncodingLengthForStorage())
+		acc.EncodeForStorage(enc)
+		return true, put(crypto.Keccak256(k), enc)
+	}); err != nil {
+		return common.Hash{}, err
+	}
+	// the storage is walked per account, the plain state has the accounts among the storage
+	for addr, incarnation := range incarnations {
+		startKey := make([]byte, common.AddressLength+common.IncarnationLength+common.HashLength)
+		copy(startKey, addr[:])
+		addrHash := crypto.Keccak256Hash(addr[:])
+		if err = state.WalkAsOf(db.KV(), dbutils.PlainStateBucket, dbutils.StorageHistoryBucket, startKey, 8*common.AddressLength, block+1, func(k, v []byte) (bool, error) {
+			key := dbutils.GenerateCompositeStorageKey(addrHash, incarnation, crypto.Keccak256Hash(k[common.AddressLength:]))
+			return true, put(key, common.CopyBytes(v))
+		}); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	if _, err = batch.Commit(); err != nil {
+		return common.Hash{}, err
+	}
+
+	loader := trie.NewFlatDbSubTrieLoader()
+	noCollector := func(keyHex []byte, hash []byte) error { return nil }
+	if err = loader.Reset(hashed, trie.NewRetainList(0), trie.NewRetainList(0), noCollector, [][]byte{nil}, []int{0}, false); err != nil {
+		return common.Hash{}, err
+	}
+	subTries, err := loader.LoadSubTries()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return subTries.Hashes[0], nil
+}
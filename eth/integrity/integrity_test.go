@@ -0,0 +1,126 @@
+package integrity
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
+	"github.com/ledgerwatch/turbo-geth/crypto"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	require.NoError(t, ethdb.SetStorageModeIfNotExist(db, ethdb.StorageMode{History: true, TxIndex: true}))
+	tds := state.NewTrieDbState(common.Hash{}, db, 1)
+
+	eoa, contract := common.Address{1}, common.Address{2}
+	code := []byte("code")
+	loc1, loc2 := common.Hash{1}, common.Hash{2}
+	eoa1 := accounts.NewAccount()
+	eoa1.Initialised = true
+	eoa1.Balance.SetUint64(1)
+	eoa2 := eoa1.SelfCopy()
+	eoa2.Balance.SetUint64(2)
+	contract1 := accounts.NewAccount()
+	contract1.Initialised = true
+	contract1.Incarnation = 1
+	contract1.CodeHash = crypto.Keccak256Hash(code)
+	empty := accounts.NewAccount()
+
+	// stateRoot is the root of eoa and contract, with the storage
+	stateRoot := func(eoaAcc *accounts.Account, storage map[common.Hash]uint64) common.Hash {
+		storageTrie := trie.New(common.Hash{})
+		for loc, v := range storage {
+			storageTrie.Update(crypto.Keccak256(loc[:]), uint256.NewInt().SetUint64(v).Bytes())
+		}
+		contractAcc := contract1
+		contractAcc.Root = storageTrie.Hash()
+		tr := trie.New(common.Hash{})
+		tr.UpdateAccount(crypto.Keccak256(eoa[:]), eoaAcc)
+		tr.UpdateAccount(crypto.Keccak256(contract[:]), &contractAcc)
+		return tr.Hash()
+	}
+	writeBlock := func(number uint64, root common.Hash, txs []*types.Transaction) {
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Root: root}
+		rawdb.WriteHeader(ctx, db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), number)
+		rawdb.WriteBody(ctx, db, header.Hash(), number, &types.Body{Transactions: txs})
+	}
+	writeState := func(number uint64, f func(w *state.PlainStateWriter) error) {
+		tds.SetBlockNr(number)
+		w := tds.PlainStateWriter()
+		require.NoError(t, f(w))
+		require.NoError(t, w.WriteChangeSets())
+		require.NoError(t, w.WriteHistory())
+	}
+
+	writeBlock(0, trie.EmptyRoot, nil)
+	writeState(1, func(w *state.PlainStateWriter) error {
+		if err := w.UpdateAccountData(ctx, eoa, &empty, &eoa1); err != nil {
+			return err
+		}
+		if err := w.CreateContract(contract); err != nil {
+			return err
+		}
+		if err := w.UpdateAccountCode(contract, 1, contract1.CodeHash, code); err != nil {
+			return err
+		}
+		if err := w.WriteAccountStorage(ctx, contract, 1, &loc1, uint256.NewInt(), uint256.NewInt().SetUint64(1)); err != nil {
+			return err
+		}
+		return w.UpdateAccountData(ctx, contract, &empty, &contract1)
+	})
+	writeBlock(1, stateRoot(&eoa1, map[common.Hash]uint64{loc1: 1}), nil)
+	writeState(2, func(w *state.PlainStateWriter) error {
+		if err := w.UpdateAccountData(ctx, eoa, &eoa1, eoa2); err != nil {
+			return err
+		}
+		if err := w.WriteAccountStorage(ctx, contract, 1, &loc1, uint256.NewInt().SetUint64(1), uint256.NewInt().SetUint64(2)); err != nil {
+			return err
+		}
+		return w.WriteAccountStorage(ctx, contract, 1, &loc2, uint256.NewInt(), uint256.NewInt().SetUint64(3))
+	})
+	tx := types.NewTransaction(0, eoa, uint256.NewInt(), 21000, uint256.NewInt(), nil)
+	writeBlock(2, stateRoot(eoa2, map[common.Hash]uint64{loc1: 2, loc2: 3}), []*types.Transaction{tx})
+	// block 3 is only a header
+	header3 := &types.Header{Number: big.NewInt(3)}
+	rawdb.WriteHeader(ctx, db, header3)
+	rawdb.WriteCanonicalHash(db, header3.Hash(), 3)
+	for _, stage := range []stages.SyncStage{stages.Execution, stages.TxLookup, stages.AccountHistoryIndex, stages.StorageHistoryIndex} {
+		require.NoError(t, stages.SaveStageProgress(db, stage, 2, nil))
+	}
+
+	findings, err := Check(ctx, db, Config{From: 0, StateRoots: []uint64{1, 2}})
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, Finding{Check: TxLookup, Block: 2, Key: tx.Hash().Bytes(), Message: "no tx lookup entry"}, findings[0])
+
+	rawdb.WriteTxLookupEntries(db, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(2)}).WithBody([]*types.Transaction{tx}, nil))
+	findings, err = Check(ctx, db, Config{To: 3})
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	assert.Equal(t, Finding{Check: Bodies, Block: 3, Key: header3.Hash().Bytes(), Message: "no body"}, findings[0])
+
+	findings, err = Check(ctx, db, Config{To: 5, MaxFindings: 2})
+	require.NoError(t, err)
+	assert.Len(t, findings, 2, "stops at MaxFindings")
+
+	root1, err := ComputeStateRoot(db, 1, "")
+	require.NoError(t, err)
+	root2, err := ComputeStateRoot(db, 2, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, root1, root2)
+}
@@ -0,0 +1,216 @@
+package stagedsync
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/changeset"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/rlp"
+)
+
+const deltaVersion = 1
+
+// DeltaHeader opens a delta archive: the blocks From+1..To, to apply on a database executed
+// up to From.
+type DeltaHeader struct {
+	Version  uint
+	From     uint64
+	FromHash common.Hash
+	To       uint64
+	ToHash   common.Hash
+}
+
+// deltaRecord is an entry of a bucket, an empty value deletes the key.
+type deltaRecord struct {
+	Bucket string
+	Key    []byte
+	Value  []byte
+}
+
+// deltaBlockKeys are the entries of a canonical block shipped in a delta.
+func deltaBlockKeys(number uint64, hash common.Hash) []deltaRecord {
+	return []deltaRecord{
+		{Bucket: dbutils.HeaderPrefix, Key: dbutils.HeaderHashKey(number)},
+		{Bucket: dbutils.HeaderPrefix, Key: dbutils.HeaderKey(number, hash)},
+		{Bucket: dbutils.HeaderPrefix, Key: dbutils.HeaderTDKey(number, hash)},
+		{Bucket: dbutils.HeaderNumberPrefix, Key: hash.Bytes()},
+		{Bucket: dbutils.BlockBodyPrefix, Key: dbutils.BlockBodyKey(number, hash)},
+		{Bucket: dbutils.BlockReceiptsPrefix, Key: dbutils.BlockReceiptsKey(number, hash)},
+		{Bucket: dbutils.Senders, Key: dbutils.BlockBodyKey(number, hash)},
+		{Bucket: dbutils.PlainAccountChangeSetBucket, Key: dbutils.EncodeTimestamp(number)},
+		{Bucket: dbutils.PlainStorageChangeSetBucket, Key: dbutils.EncodeTimestamp(number)},
+	}
+}
+
+// ExportDelta writes a gzipped archive of what the blocks after from, up to the progress of
+// the Execution stage, changed in db: the headers, bodies, senders, receipts and changesets,
+// and the current values of the accounts and storage in the changesets, with the codes of
+// the accounts. The keys changed are collected in memory.
+func ExportDelta(db ethdb.Getter, from uint64, w io.Writer) (DeltaHeader, error) {
+	to, _, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return DeltaHeader{}, err
+	}
+	if from >= to {
+		return DeltaHeader{}, fmt.Errorf("nothing to export, the database is executed up to block %d", to)
+	}
+	header := DeltaHeader{Version: deltaVersion, From: from, FromHash: rawdb.ReadCanonicalHash(db, from), To: to, ToHash: rawdb.ReadCanonicalHash(db, to)}
+	if header.FromHash == (common.Hash{}) || header.ToHash == (common.Hash{}) {
+		return DeltaHeader{}, fmt.Errorf("no canonical hash of block %d or %d", from, to)
+	}
+
+	gz := gzip.NewWriter(w)
+	if err = rlp.Encode(gz, header); err != nil {
+		return DeltaHeader{}, err
+	}
+	put := func(bucket string, key []byte) ([]byte, error) {
+		v, err := db.Get(bucket, key)
+		if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+			return nil, err
+		}
+		if len(v) == 0 && bucket != dbutils.PlainStateBucket {
+			return nil, nil // not stored, receipts may be off
+		}
+		return v, rlp.Encode(gz, deltaRecord{Bucket: bucket, Key: key, Value: v})
+	}
+
+	changed := make(map[string]struct{})
+	collect := func(k, _ []byte) error {
+		changed[string(k)] = struct{}{}
+		return nil
+	}
+	for number := from + 1; number <= to; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			return DeltaHeader{}, fmt.Errorf("no canonical hash of block %d", number)
+		}
+		for _, record := range deltaBlockKeys(number, hash) {
+			v, err := put(record.Bucket, record.Key)
+			if err != nil {
+				return DeltaHeader{}, err
+			}
+			switch record.Bucket {
+			case dbutils.PlainAccountChangeSetBucket:
+				err = changeset.AccountChangeSetPlainBytes(v).Walk(collect)
+			case dbutils.PlainStorageChangeSetBucket:
+				err = changeset.StorageChangeSetPlainBytes(v).Walk(collect)
+			}
+			if err != nil {
+				return DeltaHeader{}, err
+			}
+		}
+	}
+
+	codes := make(map[string]struct{})
+	for _, k := range sortedKeys(changed) {
+		if _, err := put(dbutils.PlainStateBucket, []byte(k)); err != nil {
+			return DeltaHeader{}, err
+		}
+		if len(k) != common.AddressLength {
+			continue
+		}
+		if _, err := put(dbutils.IncarnationMapBucket, []byte(k)); err != nil {
+			return DeltaHeader{}, err
+		}
+		// changesets omit code hashes, the codes of all the incarnations are shipped
+		if err := db.Walk(dbutils.PlainContractCodeBucket, []byte(k), 8*common.AddressLength, func(key, codeHash []byte) (bool, error) {
+			if err := rlp.Encode(gz, deltaRecord{Bucket: dbutils.PlainContractCodeBucket, Key: key, Value: codeHash}); err != nil {
+				return false, err
+			}
+			if _, ok := codes[string(codeHash)]; ok {
+				return true, nil
+			}
+			codes[string(codeHash)] = struct{}{}
+			_, err := put(dbutils.CodeBucket, codeHash)
+			return true, err
+		}); err != nil {
+			return DeltaHeader{}, err
+		}
+	}
+	log.Info("Exported delta", "from", from, "to", to, "state keys", len(changed), "codes", len(codes))
+	return header, gz.Close()
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ImportDelta applies a delta archive written by ExportDelta to db, which must be executed
+// up to the first block of the delta, in one transaction. The stages up to Execution are
+// moved to the last block, the following ones, which read the changesets, catch up at the
+// next sync.
+func ImportDelta(db ethdb.Database, r io.Reader) (DeltaHeader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return DeltaHeader{}, err
+	}
+	stream := rlp.NewStream(gz, 0)
+	var header DeltaHeader
+	if err = stream.Decode(&header); err != nil {
+		return DeltaHeader{}, fmt.Errorf("delta header: %w", err)
+	}
+	if header.Version != deltaVersion {
+		return DeltaHeader{}, fmt.Errorf("unsupported delta version %d", header.Version)
+	}
+	executed, _, err := stages.GetStageProgress(db, stages.Execution)
+	if err != nil {
+		return DeltaHeader{}, err
+	}
+	if executed != header.From {
+		return DeltaHeader{}, fmt.Errorf("the delta starts after block %d, the database is executed up to block %d", header.From, executed)
+	}
+	if hash := rawdb.ReadCanonicalHash(db, header.From); hash != header.FromHash {
+		return DeltaHeader{}, fmt.Errorf("the delta starts after block %x, the database has %x", header.FromHash, hash)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return DeltaHeader{}, err
+	}
+	defer tx.Rollback()
+	for {
+		var record deltaRecord
+		if err = stream.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return DeltaHeader{}, fmt.Errorf("delta record: %w", err)
+		}
+		if len(record.Value) == 0 {
+			err = tx.Delete(record.Bucket, record.Key)
+		} else {
+			err = tx.Put(record.Bucket, record.Key, record.Value)
+		}
+		if err != nil {
+			return DeltaHeader{}, err
+		}
+	}
+	if rawdb.ReadCanonicalHash(tx, header.To) != header.ToHash {
+		return DeltaHeader{}, fmt.Errorf("truncated delta, no block %d", header.To)
+	}
+	for _, stage := range []stages.SyncStage{stages.Headers, stages.BlockHashes, stages.Bodies, stages.Senders, stages.Execution} {
+		if err = stages.SaveStageProgress(tx, stage, header.To, nil); err != nil {
+			return DeltaHeader{}, err
+		}
+	}
+	rawdb.WriteHeadHeaderHash(tx, header.ToHash)
+	rawdb.WriteHeadBlockHash(tx, header.ToHash)
+	if _, err = tx.Commit(); err != nil {
+		return DeltaHeader{}, err
+	}
+	log.Info("Imported delta", "from", header.From, "to", header.To)
+	return header, nil
+}
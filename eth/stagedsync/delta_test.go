@@ -0,0 +1,62 @@
+package stagedsync
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelta(t *testing.T) {
+	writeChain := func(db ethdb.Database, to uint64) {
+		for number := uint64(0); number <= to; number++ {
+			header := &types.Header{Number: new(big.Int).SetUint64(number), Extra: []byte("delta")}
+			rawdb.WriteHeader(context.Background(), db, header)
+			rawdb.WriteCanonicalHash(db, header.Hash(), number)
+		}
+		require.NoError(t, stages.SaveStageProgress(db, stages.Execution, to, nil))
+	}
+	source := ethdb.NewMemDatabase()
+	defer source.Close()
+	replica := ethdb.NewMemDatabase()
+	defer replica.Close()
+	generateBlocks(t, 1, 50, plainWriterGen(source), changeCodeWithIncarnations)
+	writeChain(source, 50)
+	generateBlocks(t, 1, 20, plainWriterGen(replica), changeCodeWithIncarnations)
+	writeChain(replica, 20)
+
+	var archive bytes.Buffer
+	header, err := ExportDelta(source, 20, &archive)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(50), header.To)
+
+	_, err = ImportDelta(replica, bytes.NewReader(archive.Bytes()[:archive.Len()/2]))
+	assert.Error(t, err, "truncated")
+	imported, err := ImportDelta(replica, bytes.NewReader(archive.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, header, imported)
+	_, err = ImportDelta(replica, bytes.NewReader(archive.Bytes()))
+	assert.Error(t, err, "applied already")
+
+	compareCurrentState(t, source, replica,
+		dbutils.PlainStateBucket,
+		dbutils.PlainContractCodeBucket,
+		dbutils.CodeBucket,
+		dbutils.IncarnationMapBucket,
+		dbutils.PlainAccountChangeSetBucket,
+		dbutils.PlainStorageChangeSetBucket,
+		dbutils.HeaderPrefix,
+	)
+	executed, _, err := stages.GetStageProgress(replica, stages.Execution)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(50), executed)
+	assert.Equal(t, header.ToHash, rawdb.ReadHeadBlockHash(replica))
+}
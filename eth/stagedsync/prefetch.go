@@ -0,0 +1,154 @@
+package stagedsync
+
+import (
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/vm"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+var (
+	prefetchPredictedMeter = metrics.NewRegisteredMeter("stages/execution/prefetch/predicted", nil)
+	prefetchDroppedMeter   = metrics.NewRegisteredMeter("stages/execution/prefetch/dropped", nil)
+	prefetchHitMeter       = metrics.NewRegisteredMeter("stages/execution/prefetch/hit", nil)
+	prefetchMissMeter      = metrics.NewRegisteredMeter("stages/execution/prefetch/miss", nil)
+)
+
+const (
+	prefetchWorkers   = 4
+	prefetchQueue     = 1024
+	prefetchCodeCache = 4096 // contracts whose predicted slots are kept
+)
+
+type prefetchRequest struct {
+	address  common.Address
+	codeHash common.Hash
+	code     []byte        // to analyze if slots is nil
+	slots    []common.Hash // cached
+}
+
+// statePrefetcher reads the storage slots predicted by static analysis in background
+// goroutines through its own read transactions, so that the SLOADs of the execution find
+// the pages in the page cache. The code not analyzed yet is analyzed by the goroutines too,
+// never by the execution. It counts an SLOAD as a hit if its slot was predicted for the
+// contract since the last reset.
+type statePrefetcher struct {
+	reader    *state.PlainStateReader
+	slots     *lru.Cache // code hash to predicted slots
+	mu        sync.Mutex // guards predicted, added to by the goroutines
+	predicted map[common.Address]map[common.Hash]struct{}
+	requests  chan prefetchRequest
+	wg        sync.WaitGroup
+}
+
+var _ vm.StatePrefetcher = (*statePrefetcher)(nil)
+
+func newStatePrefetcher(kv ethdb.KV) *statePrefetcher {
+	slots, _ := lru.New(prefetchCodeCache)
+	p := &statePrefetcher{
+		reader:    state.NewPlainStateReader(ethdb.NewObjectDatabase(kv)),
+		slots:     slots,
+		predicted: make(map[common.Address]map[common.Hash]struct{}),
+		requests:  make(chan prefetchRequest, prefetchQueue),
+	}
+	for i := 0; i < prefetchWorkers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+func (p *statePrefetcher) work() {
+	defer p.wg.Done()
+	for r := range p.requests {
+		if r.slots == nil {
+			if cached, ok := p.slots.Get(r.codeHash); ok {
+				r.slots = cached.([]common.Hash)
+			} else {
+				r.slots = vm.PredictedSlots(r.code)
+				p.slots.Add(r.codeHash, r.slots)
+			}
+			p.predict(r.address, r.slots)
+		}
+		if len(r.slots) == 0 {
+			continue
+		}
+		prefetchPredictedMeter.Mark(int64(len(r.slots)))
+		account, err := p.reader.ReadAccountData(r.address)
+		if err != nil {
+			log.Debug("Prefetch failed", "address", r.address, "err", err)
+			continue
+		}
+		if account == nil {
+			continue // created in this block
+		}
+		for i := range r.slots {
+			if _, err := p.reader.ReadAccountStorage(r.address, account.Incarnation, &r.slots[i]); err != nil {
+				log.Debug("Prefetch failed", "address", r.address, "slot", r.slots[i], "err", err)
+				break
+			}
+		}
+	}
+}
+
+func (p *statePrefetcher) Prefetch(address common.Address, codeHash common.Hash, code []byte) {
+	r := prefetchRequest{address: address, codeHash: codeHash, code: code}
+	if cached, ok := p.slots.Get(codeHash); ok {
+		r.slots = cached.([]common.Hash)
+		if len(r.slots) == 0 {
+			return
+		}
+		p.predict(address, r.slots)
+	}
+	select {
+	case p.requests <- r:
+	default:
+		// never slow down the execution, the SLOADs just read cold pages
+		prefetchDroppedMeter.Mark(int64(len(r.slots)))
+	}
+}
+
+// predict records the slots predicted for the contract at address.
+func (p *statePrefetcher) predict(address common.Address, slots []common.Hash) {
+	if len(slots) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	predicted, ok := p.predicted[address]
+	if !ok {
+		predicted = make(map[common.Hash]struct{}, len(slots))
+		p.predicted[address] = predicted
+	}
+	for _, slot := range slots {
+		predicted[slot] = struct{}{}
+	}
+}
+
+func (p *statePrefetcher) Loaded(address common.Address, key common.Hash) {
+	p.mu.Lock()
+	_, ok := p.predicted[address][key]
+	p.mu.Unlock()
+	if ok {
+		prefetchHitMeter.Mark(1)
+	} else {
+		prefetchMissMeter.Mark(1)
+	}
+}
+
+// reset forgets the predictions, called after every block.
+func (p *statePrefetcher) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.predicted = make(map[common.Address]map[common.Hash]struct{})
+}
+
+func (p *statePrefetcher) close() {
+	close(p.requests)
+	p.wg.Wait()
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/core/rawdb"
 	"github.com/ledgerwatch/turbo-geth/core/state"
+	"github.com/ledgerwatch/turbo-geth/core/types"
 	"github.com/ledgerwatch/turbo-geth/core/types/accounts"
 	"github.com/ledgerwatch/turbo-geth/core/vm"
 	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
@@ -67,6 +68,17 @@ func SpawnExecuteBlocksStage(s *StageState, stateDB ethdb.Database, chainConfig
 	batch := tx.NewBatch()
 	defer batch.Rollback()
 
+	var prefetcher *statePrefetcher
+	if vmConfig.PrefetchState && vmConfig.Prefetcher == nil {
+		if hasKV, ok := stateDB.(ethdb.HasKV); ok {
+			prefetcher = newStatePrefetcher(hasKV.KV())
+			defer prefetcher.close()
+			cfg := *vmConfig
+			cfg.Prefetcher = prefetcher
+			vmConfig = &cfg
+		}
+	}
+
 	engine := chainContext.Engine()
 
 	stageProgress := s.BlockNumber
@@ -96,7 +108,12 @@ func SpawnExecuteBlocksStage(s *StageState, stateDB ethdb.Database, chainConfig
 		stateWriter = state.NewPlainStateWriter(batch, blockNum)
 
 		// where the magic happens
-		receipts, err := core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter)
+		var receipts types.Receipts
+		if vmConfig.ParallelTxs > 0 {
+			receipts, err = core.ExecuteBlockParallel(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter, vmConfig.ParallelTxs)
+		} else {
+			receipts, err = core.ExecuteBlockEphemerally(chainConfig, vmConfig, chainContext, engine, block, stateReader, stateWriter)
+		}
 		if err != nil {
 			return err
 		}
@@ -104,6 +121,9 @@ func SpawnExecuteBlocksStage(s *StageState, stateDB ethdb.Database, chainConfig
 		if writeReceipts {
 			rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
 		}
+		if prefetcher != nil {
+			prefetcher.reset()
+		}
 
 		if batch.BatchSize() >= batch.IdealBatchSize() {
 			if err = s.Update(batch, blockNum); err != nil {
@@ -0,0 +1,112 @@
+package stagedsync
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// SpawnLogIndex indexes the blocks of the logs by address and topic, see core.LogIndexBlocks.
+// The logs are read from the receipts, the blocks without receipts are skipped.
+func SpawnLogIndex(s *StageState, db ethdb.Database, datadir string, quitCh <-chan struct{}) error {
+	endBlock, err := s.ExecutionAt(db)
+	if err != nil {
+		return fmt.Errorf("log index: getting last executed block: %w", err)
+	}
+	if endBlock == s.BlockNumber {
+		s.Done()
+		return nil
+	}
+
+	addresses := etl.NewCollector(datadir, etl.NewAppendBuffer(etl.BufferOptimalSize))
+	topics := etl.NewCollector(datadir, etl.NewAppendBuffer(etl.BufferOptimalSize))
+	if err = walkLogs(db, s.BlockNumber+1, endBlock, quitCh, func(block uint64, address, topic []byte) error {
+		v := make([]byte, 9) // in the format of the history index generation, the value is never empty
+		binary.BigEndian.PutUint64(v, block)
+		if address != nil {
+			return addresses.Collect(address, v)
+		}
+		return topics.Collect(topic, v)
+	}); err != nil {
+		return fmt.Errorf("log index: %w", err)
+	}
+	if err = addresses.Load(db, dbutils.LogAddressIndex, core.LoadIndexFunc, etl.TransformArgs{Quit: quitCh}); err != nil {
+		return fmt.Errorf("log index: loading addresses: %w", err)
+	}
+	if err = topics.Load(db, dbutils.LogTopicIndex, core.LoadIndexFunc, etl.TransformArgs{Quit: quitCh}); err != nil {
+		return fmt.Errorf("log index: loading topics: %w", err)
+	}
+	return s.DoneAndUpdate(db, endBlock)
+}
+
+func UnwindLogIndex(u *UnwindState, s *StageState, db ethdb.Database, quitCh <-chan struct{}) error {
+	addresses := make(map[string]struct{})
+	topics := make(map[string]struct{})
+	if err := walkLogs(db, u.UnwindPoint+1, s.BlockNumber, quitCh, func(_ uint64, address, topic []byte) error {
+		if address != nil {
+			addresses[string(address)] = struct{}{}
+		} else {
+			topics[string(topic)] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unwind log index: %w", err)
+	}
+	if err := core.TruncateIndex(db, dbutils.LogAddressIndex, addresses, common.AddressLength, u.UnwindPoint); err != nil {
+		return fmt.Errorf("unwind log index: truncating addresses: %w", err)
+	}
+	if err := core.TruncateIndex(db, dbutils.LogTopicIndex, topics, common.HashLength, u.UnwindPoint); err != nil {
+		return fmt.Errorf("unwind log index: truncating topics: %w", err)
+	}
+	return u.Done(db)
+}
+
+// walkLogs calls walker once per block for each address and each topic of the logs of the
+// canonical blocks from..to, with either the address or the topic set.
+func walkLogs(db ethdb.Getter, from, to uint64, quitCh <-chan struct{}, walker func(block uint64, address, topic []byte) error) error {
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	for block := from; block <= to; block++ {
+		if err := common.Stopped(quitCh); err != nil {
+			return err
+		}
+		select {
+		case <-logEvery.C:
+			log.Info("Log index", "block", block, "to", to)
+		default:
+		}
+
+		hash := rawdb.ReadCanonicalHash(db, block)
+		if hash == (common.Hash{}) {
+			continue
+		}
+		seen := make(map[string]struct{})
+		for _, receipt := range rawdb.ReadRawReceipts(db, hash, block) {
+			for _, l := range receipt.Logs {
+				if _, ok := seen[string(l.Address[:])]; !ok {
+					seen[string(l.Address[:])] = struct{}{}
+					if err := walker(block, l.Address.Bytes(), nil); err != nil {
+						return err
+					}
+				}
+				for _, topic := range l.Topics {
+					if _, ok := seen[string(topic[:])]; !ok {
+						seen[string(topic[:])] = struct{}{}
+						if err := walker(block, nil, topic.Bytes()); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
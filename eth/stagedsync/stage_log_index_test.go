@@ -0,0 +1,64 @@
+package stagedsync
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/core"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogIndex(t *testing.T) {
+	ctx := context.Background()
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	a1, a2 := common.Address{1}, common.Address{2}
+	t1, t2 := common.Hash{1}, common.Hash{2}
+	logs := map[uint64][]*types.Log{
+		1: {{Address: a1, Topics: []common.Hash{t1}}},
+		2: {{Address: a2, Topics: []common.Hash{t1, t2}}, {Address: a2, Topics: []common.Hash{t2}}},
+		3: {},
+		4: {{Address: a1, Topics: []common.Hash{t2}}},
+	}
+	for number := uint64(1); number <= 4; number++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(number)}
+		rawdb.WriteHeader(ctx, db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), number)
+		rawdb.WriteReceipts(db, header.Hash(), number, types.Receipts{{Status: types.ReceiptStatusSuccessful, Logs: logs[number]}})
+	}
+	require.NoError(t, stages.SaveStageProgress(db, stages.Execution, 4, nil))
+
+	s := &StageState{Stage: stages.LogIndex}
+	require.NoError(t, SpawnLogIndex(s, db, getDataDir(), nil))
+	query := func(addresses []common.Address, topics [][]common.Hash, from, to uint64) []uint64 {
+		blocks, err := core.LogIndexBlocks(db, addresses, topics, from, to)
+		require.NoError(t, err)
+		return blocks
+	}
+	assert.Equal(t, []uint64{1, 4}, query([]common.Address{a1}, nil, 0, 4))
+	assert.Equal(t, []uint64{1, 2, 4}, query([]common.Address{a1, a2}, nil, 0, 4))
+	assert.Equal(t, []uint64{2, 4}, query(nil, [][]common.Hash{{t2}}, 0, 4))
+	assert.Equal(t, []uint64{2}, query(nil, [][]common.Hash{{t1}, {t2}}, 0, 4))
+	assert.Equal(t, []uint64{4}, query([]common.Address{a1}, [][]common.Hash{nil, {t2}}, 0, 4))
+	assert.Equal(t, []uint64{4}, query([]common.Address{a1}, nil, 2, 4))
+	assert.Empty(t, query([]common.Address{{3}}, nil, 0, 4))
+
+	u := &UnwindState{Stage: stages.LogIndex, UnwindPoint: 1}
+	s = &StageState{Stage: stages.LogIndex, BlockNumber: 4}
+	require.NoError(t, UnwindLogIndex(u, s, db, nil))
+	assert.Equal(t, []uint64{1}, query([]common.Address{a1, a2}, nil, 0, 4))
+	assert.Empty(t, query(nil, [][]common.Hash{{t2}}, 0, 4))
+
+	// indexed again from the unwind point
+	s = &StageState{Stage: stages.LogIndex, BlockNumber: 1}
+	require.NoError(t, SpawnLogIndex(s, db, getDataDir(), nil))
+	assert.Equal(t, []uint64{1, 2, 4}, query([]common.Address{a1, a2}, nil, 0, 4))
+}
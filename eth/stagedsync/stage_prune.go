@@ -0,0 +1,215 @@
+package stagedsync
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// Classes of the data pruned.
+const (
+	PruneHistory  = "history"
+	PruneReceipts = "receipts"
+	PruneTxIndex  = "txindex"
+)
+
+// PruneResult is what a pruning of a class of data deleted.
+type PruneResult struct {
+	Class string `json:"class"`
+	From  uint64 `json:"from"` // blocks
+	To    uint64 `json:"to"`
+	Keys  uint64 `json:"keys"`
+	// of the keys and values deleted, freed in the database file for the next writes, the
+	// file doesn't shrink
+	Bytes uint64 `json:"bytes"`
+}
+
+func SpawnPruneStage(s *StageState, db ethdb.Database, quitCh <-chan struct{}) error {
+	to, err := s.ExecutionAt(db)
+	if err != nil {
+		return err
+	}
+	pm, err := ethdb.GetPruneModeFromDB(db)
+	if err != nil {
+		return err
+	}
+	if _, err = Prune(db, pm, to, quitCh); err != nil {
+		return err
+	}
+	return s.DoneAndUpdate(db, to)
+}
+
+// UnwindPruneStage fails the unwinds below the last block whose changesets were pruned, as
+// unwinding the state needs the changesets of the blocks unwound. The stage is the first
+// unwound, before any stage changed the state.
+func UnwindPruneStage(u *UnwindState, db ethdb.Database) error {
+	pruned, err := ethdb.GetPruned(db, dbutils.PrunedHistory)
+	if err != nil {
+		return err
+	}
+	if u.UnwindPoint < pruned {
+		return fmt.Errorf("%w: unwinding to block %d needs the changesets of the blocks up to %d", ethdb.ErrPruned, u.UnwindPoint, pruned)
+	}
+	return u.Done(db)
+}
+
+type pruneKey struct {
+	bucket string
+	key    []byte
+}
+
+// Prune deletes the changesets, receipts and tx lookup entries of the blocks more than
+// the retention of pm below head. The changesets and the receipts are kept until the stages
+// reading them processed them, so are the tx lookup entries until they are written. The
+// history queries and the unwinds needing pruned changesets fail with ethdb.ErrPruned, see
+// state.FindByHistory and UnwindPruneStage. Pruning is resumed from where it stopped, the
+// results are of the classes pruned.
+func Prune(db ethdb.Database, pm ethdb.PruneMode, head uint64, quitCh <-chan struct{}) ([]PruneResult, error) {
+	sm, err := ethdb.GetStorageModeFromDB(db)
+	if err != nil {
+		return nil, err
+	}
+	historyConsumers := []stages.SyncStage{stages.HashState, stages.IntermediateHashes}
+	if sm.History {
+		historyConsumers = append(historyConsumers, stages.AccountHistoryIndex, stages.StorageHistoryIndex)
+	}
+	var txIndexConsumers []stages.SyncStage
+	if sm.TxIndex {
+		txIndexConsumers = append(txIndexConsumers, stages.TxLookup)
+	}
+	receiptsConsumers := []stages.SyncStage{stages.LogIndex}
+	classes := []struct {
+		name      string
+		keep      uint64
+		enabled   bool
+		prunedKey []byte
+		consumers []stages.SyncStage
+		keys      func(number uint64, hash common.Hash) ([]pruneKey, error)
+	}{
+		{PruneHistory, pm.History, true, dbutils.PrunedHistory, historyConsumers, func(number uint64, _ common.Hash) ([]pruneKey, error) {
+			return []pruneKey{
+				{dbutils.PlainAccountChangeSetBucket, dbutils.EncodeTimestamp(number)},
+				{dbutils.PlainStorageChangeSetBucket, dbutils.EncodeTimestamp(number)},
+			}, nil
+		}},
+		{PruneReceipts, pm.Receipts, sm.Receipts, dbutils.PrunedReceipts, receiptsConsumers, func(number uint64, hash common.Hash) ([]pruneKey, error) {
+			return []pruneKey{{dbutils.BlockReceiptsPrefix, dbutils.BlockReceiptsKey(number, hash)}}, nil
+		}},
+		{PruneTxIndex, pm.TxIndex, sm.TxIndex, dbutils.PrunedTxIndex, txIndexConsumers, func(number uint64, hash common.Hash) ([]pruneKey, error) {
+			body := rawdb.ReadBody(db, hash, number)
+			if body == nil {
+				return nil, nil
+			}
+			var keys []pruneKey
+			for _, tx := range body.Transactions {
+				// the hash of a transaction replayed later is of the later block
+				if found := rawdb.ReadTxLookupEntry(db, tx.Hash()); found != nil && *found == number {
+					keys = append(keys, pruneKey{dbutils.TxLookupPrefix, tx.Hash().Bytes()})
+				}
+			}
+			return keys, nil
+		}},
+	}
+
+	var results []PruneResult
+	for _, class := range classes {
+		if !class.enabled || class.keep == 0 || head <= class.keep {
+			continue
+		}
+		to := head - class.keep
+		for _, stage := range class.consumers {
+			progress, _, err := stages.GetStageProgress(db, stage)
+			if err != nil {
+				return results, err
+			}
+			if progress < to {
+				to = progress
+			}
+		}
+		pruned, err := ethdb.GetPruned(db, class.prunedKey)
+		if err != nil {
+			return results, err
+		}
+		if pruned >= to {
+			continue
+		}
+		result, err := pruneBlocks(db, class.name, class.prunedKey, pruned+1, to, class.keys, quitCh)
+		if err != nil {
+			return results, err
+		}
+		log.Info("Pruned", "class", result.Class, "from", result.From, "to", result.To, "keys", result.Keys, "reclaimed", datasize.ByteSize(result.Bytes).HR())
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func putPruned(db ethdb.Putter, prunedKey []byte, pruned uint64) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, pruned)
+	return db.Put(dbutils.DatabaseInfoBucket, prunedKey, v)
+}
+
+// pruneBlocks deletes the keys of the canonical blocks from..to in batches, each saving the
+// last block pruned.
+func pruneBlocks(db ethdb.Database, class string, prunedKey []byte, from, to uint64, keys func(uint64, common.Hash) ([]pruneKey, error), quitCh <-chan struct{}) (PruneResult, error) {
+	result := PruneResult{Class: class, From: from, To: to}
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	batch := db.NewBatch()
+	defer batch.Rollback()
+	for number := from; number <= to; number++ {
+		if err := common.Stopped(quitCh); err != nil {
+			return result, err
+		}
+		select {
+		case <-logEvery.C:
+			log.Info("Pruning", "class", class, "block", number, "to", to, "reclaimed", datasize.ByteSize(result.Bytes).HR())
+		default:
+		}
+
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			continue
+		}
+		blockKeys, err := keys(number, hash)
+		if err != nil {
+			return result, err
+		}
+		for _, k := range blockKeys {
+			v, err := db.Get(k.bucket, k.key)
+			if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+				return result, err
+			}
+			if v == nil {
+				continue
+			}
+			if err = batch.Delete(k.bucket, k.key); err != nil {
+				return result, err
+			}
+			result.Keys++
+			result.Bytes += uint64(len(k.key) + len(v))
+		}
+		if batch.BatchSize() >= batch.IdealBatchSize() {
+			if err = putPruned(batch, prunedKey, number); err != nil {
+				return result, err
+			}
+			if err = batch.CommitAndBegin(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := putPruned(batch, prunedKey, to); err != nil {
+		return result, err
+	}
+	_, err := batch.Commit()
+	return result, err
+}
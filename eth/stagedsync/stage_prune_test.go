@@ -0,0 +1,93 @@
+package stagedsync
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/core/rawdb"
+	"github.com/ledgerwatch/turbo-geth/core/types"
+	"github.com/ledgerwatch/turbo-geth/eth/stagedsync/stages"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	require.NoError(t, ethdb.SetStorageModeIfNotExist(db, ethdb.DefaultStorageMode))
+
+	const head = 10
+	txs := make(map[uint64]common.Hash)
+	for number := uint64(1); number <= head; number++ {
+		tx := types.NewTransaction(number, common.Address{1}, uint256.NewInt(), 21000, uint256.NewInt(), nil)
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number)}).WithBody([]*types.Transaction{tx}, nil)
+		rawdb.WriteHeader(ctx, db, block.Header())
+		rawdb.WriteCanonicalHash(db, block.Hash(), number)
+		rawdb.WriteBody(ctx, db, block.Hash(), number, block.Body())
+		rawdb.WriteReceipts(db, block.Hash(), number, types.Receipts{{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000}})
+		rawdb.WriteTxLookupEntries(db, block)
+		require.NoError(t, db.Put(dbutils.PlainAccountChangeSetBucket, dbutils.EncodeTimestamp(number), []byte{1}))
+		require.NoError(t, db.Put(dbutils.PlainStorageChangeSetBucket, dbutils.EncodeTimestamp(number), []byte{1}))
+		txs[number] = tx.Hash()
+	}
+	for _, stage := range []stages.SyncStage{stages.Execution, stages.HashState, stages.IntermediateHashes, stages.StorageHistoryIndex, stages.TxLookup, stages.LogIndex} {
+		require.NoError(t, stages.SaveStageProgress(db, stage, head, nil))
+	}
+	// the changesets of the blocks above aren't indexed yet
+	require.NoError(t, stages.SaveStageProgress(db, stages.AccountHistoryIndex, 6, nil))
+
+	pm := ethdb.PruneMode{History: 3, Receipts: 5, TxIndex: 2}
+	results, err := Prune(db, pm, head, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	// the timestamps of the changesets are a byte, so are their values
+	assert.Equal(t, PruneResult{Class: PruneHistory, From: 1, To: 6, Keys: 12, Bytes: 12 * 2}, results[0])
+	assert.Equal(t, PruneReceipts, results[1].Class)
+	assert.Equal(t, uint64(5), results[1].To)
+	assert.Equal(t, uint64(5), results[1].Keys)
+	assert.NotZero(t, results[1].Bytes)
+	assert.Equal(t, PruneResult{Class: PruneTxIndex, From: 1, To: 8, Keys: 8, Bytes: 8 * (common.HashLength + 1)}, results[2])
+
+	for number := uint64(1); number <= head; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		cs, _ := db.Get(dbutils.PlainAccountChangeSetBucket, dbutils.EncodeTimestamp(number))
+		assert.Equal(t, number > 6, cs != nil, "changeset of block %d", number)
+		assert.Equal(t, number > 5, rawdb.ReadRawReceipts(db, hash, number) != nil, "receipts of block %d", number)
+		assert.Equal(t, number > 8, rawdb.ReadTxLookupEntry(db, txs[number]) != nil, "tx lookup of block %d", number)
+		assert.NotNil(t, rawdb.ReadBody(db, hash, number), "body of block %d", number)
+	}
+
+	// resumed from where it stopped
+	results, err = Prune(db, pm, head, nil)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	require.NoError(t, stages.SaveStageProgress(db, stages.AccountHistoryIndex, head, nil))
+	results, err = Prune(db, pm, head, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, PruneResult{Class: PruneHistory, From: 7, To: 7, Keys: 2, Bytes: 2 * 2}, results[0])
+}
+
+func TestUnwindPruned(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+	pruned := make([]byte, 8)
+	binary.BigEndian.PutUint64(pruned, 6)
+	require.NoError(t, db.Put(dbutils.DatabaseInfoBucket, dbutils.PrunedHistory, pruned))
+
+	// the blocks unwound need the changesets up to block 6
+	err := UnwindPruneStage(&UnwindState{Stage: stages.Prune, UnwindPoint: 5}, db)
+	assert.True(t, errors.Is(err, ethdb.ErrPruned), "%v", err)
+	require.NoError(t, UnwindPruneStage(&UnwindState{Stage: stages.Prune, UnwindPoint: 6}, db))
+	progress, _, err := stages.GetStageProgress(db, stages.Prune)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), progress)
+}
@@ -152,6 +152,18 @@ func PrepareStagedSync(
 				return UnwindTxLookup(u, s, stateDB, datadir, quitCh)
 			},
 		},
+		{
+			ID:                  stages.LogIndex,
+			Description:         "Generate log index",
+			Disabled:            !storageMode.Receipts,
+			DisabledDescription: "Enable by adding `r` to --storage-mode",
+			ExecFunc: func(s *StageState, u Unwinder) error {
+				return SpawnLogIndex(s, stateDB, datadir, quitCh)
+			},
+			UnwindFunc: func(u *UnwindState, s *StageState) error {
+				return UnwindLogIndex(u, s, stateDB, quitCh)
+			},
+		},
 		{
 			ID:          stages.TxPool,
 			Description: "Update transaction pool",
@@ -162,13 +174,23 @@ func PrepareStagedSync(
 				return unwindTxPool(u, s, stateDB, txPool, quitCh)
 			},
 		},
+		{
+			ID:          stages.Prune,
+			Description: "Prune changesets, receipts and tx lookup",
+			ExecFunc: func(s *StageState, _ Unwinder) error {
+				return SpawnPruneStage(s, stateDB, quitCh)
+			},
+			UnwindFunc: func(u *UnwindState, s *StageState) error {
+				return UnwindPruneStage(u, stateDB)
+			},
+		},
 	}
 
 	state := NewState(stages)
 	state.unwindOrder = []*Stage{
 		// Unwinding of tx pool (reinjecting transactions into the pool needs to happen after unwinding execution)
 		// Unwinding of IHashes needs to happen after unwinding HashState
-		stages[0], stages[1], stages[2], stages[3], stages[10], stages[4], stages[6], stages[5], stages[7], stages[8], stages[9],
+		stages[0], stages[1], stages[2], stages[3], stages[11], stages[4], stages[6], stages[5], stages[7], stages[8], stages[9], stages[10], stages[12],
 	}
 	if err := state.LoadUnwindInfo(stateDB); err != nil {
 		return nil, err
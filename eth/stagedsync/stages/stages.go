@@ -41,6 +41,8 @@ const (
 	StorageHistoryIndex                  // Generating history index for storage
 	TxLookup                             // Generating transactions lookup index
 	TxPool                               // Starts Backend
+	Prune                                // Pruning the changesets, receipts and tx lookup below the retention
+	LogIndex                             // Generating the index of the logs by address and topic
 	Finish                               // Nominal stage after all other stages
 )
 
@@ -56,9 +58,18 @@ var DBKeys = map[SyncStage][]byte{
 	StorageHistoryIndex: []byte("StorageHistoryIndex"),
 	TxLookup:            []byte("TxLookup"),
 	TxPool:              []byte("TxPool"),
+	Prune:               []byte("Prune"),
+	LogIndex:            []byte("LogIndex"),
 	Finish:              []byte("Finish"),
 }
 
+// CacheHeads are the keys whose values change when the state and the canonical headers do, which
+// drop the values of ethdb.CachedKV: the head header and the progress of the execution.
+var CacheHeads = []ethdb.CacheHead{
+	{Bucket: dbutils.HeadHeaderKey, Key: []byte(dbutils.HeadHeaderKey)},
+	{Bucket: dbutils.SyncStageProgress, Key: DBKeys[Execution]},
+}
+
 // GetStageProgress retrieves saved progress of given sync stage from the database
 func GetStageProgress(db ethdb.Getter, stage SyncStage) (uint64, []byte, error) {
 	v, err := db.Get(dbutils.SyncStageProgress, DBKeys[stage])
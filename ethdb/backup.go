@@ -0,0 +1,118 @@
+package ethdb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"golang.org/x/time/rate"
+)
+
+// BackupProgress is how far a backup is, Total is an estimate: the pages in use of the database.
+type BackupProgress struct {
+	Written uint64
+	Total   uint64
+}
+
+// Backup copies the database into dir/data.mdb while it stays open, so that the copy can be
+// opened as an LMDB database in dir. The writing is throttled to limit bytes per second,
+// zero for no limit, to leave the disk to the sync. progress, if set, is called as the copy
+// is written, and the progress is logged every 30 seconds. A partial copy is removed.
+func Backup(ctx context.Context, kv KV, dir string, limit datasize.ByteSize, progress func(BackupProgress)) error {
+	backuper, ok := kv.(HasBackup)
+	if !ok {
+		return fmt.Errorf("backups of %T are not supported", kv)
+	}
+	var total uint64
+	if stats, ok := kv.(HasStats); ok {
+		var err error
+		if total, err = stats.DiskSize(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return err
+	}
+	file := path.Join(dir, "data.mdb")
+	// O_EXCL: overwriting may be a way to corrupt arbitrary files
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := &backupWriter{ctx: ctx, f: f, total: total, progress: progress}
+	if limit > 0 {
+		w.limiter = rate.NewLimiter(rate.Limit(limit.Bytes()), int(datasize.MB.Bytes()))
+	}
+
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-logEvery.C:
+				log.Info("Backup", "dir", dir, "written", datasize.ByteSize(atomic.LoadUint64(&w.written)).HR(), "total", datasize.ByteSize(total).HR())
+			}
+		}
+	}()
+
+	started := time.Now()
+	err = backuper.BackupTo(ctx, w)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file)
+		return err
+	}
+	log.Info("Backup done", "dir", dir, "size", datasize.ByteSize(w.written).HR(), "in", time.Since(started))
+	return nil
+}
+
+// backupWriter throttles the writes to the file, counting them.
+type backupWriter struct {
+	ctx      context.Context
+	f        *os.File
+	limiter  *rate.Limiter
+	written  uint64 // atomic, read by the logging
+	total    uint64
+	progress func(BackupProgress)
+}
+
+func (w *backupWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if w.limiter != nil {
+			if len(chunk) > w.limiter.Burst() {
+				chunk = chunk[:w.limiter.Burst()]
+			}
+			if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+				return written, err
+			}
+		}
+		n, err := w.f.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	soFar := atomic.AddUint64(&w.written, uint64(written))
+	if w.progress != nil {
+		w.progress(BackupProgress{Written: soFar, Total: w.total})
+	}
+	return written, nil
+}
@@ -0,0 +1,54 @@
+package ethdb_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup(t *testing.T) {
+	ctx, bucket := context.Background(), dbutils.CodeBucket
+	kv := ethdb.NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	require.NoError(t, kv.Update(ctx, func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucket)
+		for i := 0; i < 1000; i++ {
+			if err := c.Put([]byte(fmt.Sprintf("%04d", i)), make([]byte, 1024)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	dir := t.TempDir()
+	var last ethdb.BackupProgress
+	require.NoError(t, ethdb.Backup(ctx, kv, dir, 64*datasize.MB, func(p ethdb.BackupProgress) { last = p }))
+	assert.Greater(t, last.Written, uint64(1000*1024))
+	assert.NotZero(t, last.Total)
+	assert.Error(t, ethdb.Backup(ctx, kv, dir, 0, nil), "overwriting the backup")
+
+	backup := ethdb.NewLMDB().Path(dir).MustOpen()
+	defer backup.Close()
+	require.NoError(t, backup.View(ctx, func(tx ethdb.Tx) error {
+		counter := 0
+		err := tx.Cursor(bucket).Walk(func(k, v []byte) (bool, error) {
+			counter++
+			return true, nil
+		})
+		assert.Equal(t, 1000, counter)
+		return err
+	}))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	dir = filepath.Join(t.TempDir(), "cancelled")
+	assert.Equal(t, context.Canceled, ethdb.Backup(cancelled, kv, dir, 0, nil))
+	assert.NoFileExists(t, filepath.Join(dir, "data.mdb"))
+}
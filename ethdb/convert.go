@@ -0,0 +1,102 @@
+package ethdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// OpenKV opens the database at path with the engine: lmdb, bolt or badger.
+func OpenKV(engine, path string, readOnly bool) (KV, error) {
+	switch engine {
+	case "lmdb":
+		opts := NewLMDB().Path(path)
+		if readOnly {
+			opts = opts.ReadOnly()
+		}
+		return opts.Open()
+	case "bolt":
+		opts := NewBolt().Path(path)
+		if readOnly {
+			opts = opts.ReadOnly()
+		}
+		return opts.Open()
+	case "badger":
+		opts := NewBadger().Path(path)
+		if readOnly {
+			opts = opts.ReadOnly()
+		}
+		return opts.Open()
+	default:
+		return nil, fmt.Errorf("unknown database engine %q, expected lmdb, bolt or badger", engine)
+	}
+}
+
+// Convert copies the buckets of from into to, usually of another engine, in transactions of
+// the ideal batch size of to. The values are copied as they are stored, the compressed ones
+// along with their dictionaries. An interrupted copy can't be resumed, it is to be restarted
+// into an empty database.
+func Convert(ctx context.Context, from, to KV) error {
+	logEvery := time.NewTicker(30 * time.Second)
+	defer logEvery.Stop()
+
+	tx, err := to.Begin(ctx, nil, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	var batchSize, total int
+	return from.View(ctx, func(fromTx Tx) error {
+		for _, bucket := range dbutils.Buckets {
+			var count uint64
+			c, out := fromTx.Cursor(bucket), tx.Cursor(bucket)
+			for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+				if err != nil {
+					return err
+				}
+				if err = common.Stopped(ctx.Done()); err != nil {
+					return err
+				}
+				if err = out.Put(k, v); err != nil {
+					return err
+				}
+				count++
+				batchSize += len(k) + len(v)
+				if batchSize < to.IdealBatchSize() {
+					continue
+				}
+				err = tx.Commit(ctx)
+				tx = nil
+				if err != nil {
+					return err
+				}
+				total += batchSize
+				batchSize = 0
+				if tx, err = to.Begin(ctx, nil, true); err != nil {
+					return err
+				}
+				out = tx.Cursor(bucket)
+				select {
+				case <-logEvery.C:
+					log.Info("Converting", "bucket", bucket, "key", fmt.Sprintf("%x", k), "copied", datasize.ByteSize(total).HR())
+				default:
+				}
+			}
+			if count > 0 {
+				log.Info("Converted", "bucket", bucket, "records", count)
+			}
+		}
+		err := tx.Commit(ctx)
+		tx = nil
+		return err
+	})
+}
@@ -0,0 +1,59 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	ctx := context.Background()
+	fromLMDB := NewLMDB().InMem().MustOpen()
+	defer fromLMDB.Close()
+	viaBadger := NewBadger().InMem().MustOpen()
+	defer viaBadger.Close()
+	toLMDB := NewLMDB().InMem().MustOpen()
+	defer toLMDB.Close()
+
+	// PlainStateBucket is DupSort in LMDB
+	account := bytes.Repeat([]byte{1}, 20)
+	storage := append(append(append([]byte{}, account...), 0, 0, 0, 0, 0, 0, 0, 1), bytes.Repeat([]byte{2}, 32)...)
+	pairs := map[string][][2][]byte{
+		dbutils.PlainStateBucket: {{account, []byte{3}}, {storage, []byte{4}}},
+		dbutils.HeaderPrefix:     {{[]byte{5}, []byte{6}}},
+	}
+	require.NoError(t, fromLMDB.Update(ctx, func(tx Tx) error {
+		for bucket, kvs := range pairs {
+			for _, kv := range kvs {
+				if err := tx.Cursor(bucket).Put(kv[0], kv[1]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}))
+
+	require.NoError(t, Convert(ctx, fromLMDB, viaBadger))
+	require.NoError(t, Convert(ctx, viaBadger, toLMDB))
+	for _, kv := range []KV{viaBadger, toLMDB} {
+		require.NoError(t, kv.View(ctx, func(tx Tx) error {
+			for bucket, kvs := range pairs {
+				var got [][2][]byte
+				if err := tx.Cursor(bucket).Walk(func(k, v []byte) (bool, error) {
+					got = append(got, [2][]byte{k, v})
+					return true, nil
+				}); err != nil {
+					return err
+				}
+				assert.Equal(t, kvs, got, bucket)
+			}
+			return nil
+		}))
+	}
+	_, err := OpenKV("leveldb", "", true)
+	assert.Error(t, err)
+}
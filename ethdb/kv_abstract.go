@@ -1,8 +1,10 @@
 package ethdb
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 )
@@ -24,6 +26,8 @@ type KV interface {
 type Tx interface {
 	Cursor(bucket string) Cursor
 	Get(bucket string, key []byte) (val []byte, err error)
+	// MultiGet reads the values of the keys, nil for missing ones, in a single round trip to remote databases
+	MultiGet(bucket string, keys [][]byte) ([][]byte, error)
 
 	Commit(ctx context.Context) error
 	Rollback()
@@ -43,6 +47,7 @@ type Cursor interface {
 	Prefix(v []byte) Cursor
 	MatchBits(uint) Cursor
 	Prefetch(v uint) Cursor
+	Range(start, end []byte) Cursor // First seeks start if it is after the prefix, the keys stop before end, nil for no bound
 	NoValues() NoValuesCursor
 
 	First() ([]byte, []byte, error)
@@ -57,6 +62,53 @@ type Cursor interface {
 	Append(key []byte, value []byte) error // Danger: if provided data will not sorted (or bucket have old records which mess with new in sorting manner) - db will corrupt. Method also doesn't tolerate duplicates.
 }
 
+// keyRange bounds the keys of a cursor, see Cursor.Range.
+type keyRange struct {
+	start, end []byte
+}
+
+// first is the key First seeks, the start or the prefix, whichever is greater.
+func (r keyRange) first(prefix []byte) []byte {
+	if bytes.Compare(r.start, prefix) > 0 {
+		return r.start
+	}
+	return prefix
+}
+
+// past tells if the key is at or after the end.
+func (r keyRange) past(k []byte) bool {
+	return r.end != nil && k != nil && bytes.Compare(k, r.end) >= 0
+}
+
+// hasPrefixBits tells if the key starts with the first bits of the prefix, with the whole
+// prefix if bits is 0, see Cursor.MatchBits. A nil prefix matches every key.
+func hasPrefixBits(k, prefix []byte, bits uint) bool {
+	if bits == 0 || bits >= 8*uint(len(prefix)) {
+		return bytes.HasPrefix(k, prefix)
+	}
+	n := bits / 8
+	if !bytes.HasPrefix(k, prefix[:n]) {
+		return false
+	}
+	if bits%8 == 0 {
+		return true
+	}
+	mask := byte(0xff) << (8 - bits%8)
+	return uint(len(k)) > n && k[n]&mask == prefix[n]&mask
+}
+
+// prefixBits is the first key with the first bits of the prefix, the key First seeks.
+func prefixBits(prefix []byte, bits uint) []byte {
+	if bits == 0 || bits >= 8*uint(len(prefix)) {
+		return prefix
+	}
+	first := common.CopyBytes(prefix[:(bits+7)/8])
+	if bits%8 != 0 {
+		first[len(first)-1] &= byte(0xff) << (8 - bits%8)
+	}
+	return first
+}
+
 type NoValuesCursor interface {
 	First() ([]byte, uint32, error)
 	Seek(seek []byte) ([]byte, uint32, error)
@@ -68,6 +120,48 @@ type HasStats interface {
 	DiskSize(context.Context) (uint64, error) // db size
 }
 
+// HasBackup is a KV which can copy itself consistently while it stays open, see Backup.
+type HasBackup interface {
+	// BackupTo writes a copy of the database files into w
+	BackupTo(ctx context.Context, w io.Writer) error
+}
+
+// HasConnectivity is a KV reached over the network, which may be disconnected.
+type HasConnectivity interface {
+	// Connectivity tells if the database can be reached, with the state of the connections
+	Connectivity() (connected bool, state string)
+}
+
+// Change is a put or a delete of a key, see HasWatch.
+type Change struct {
+	Key    []byte
+	Value  []byte
+	Delete bool // put the key if not set
+}
+
+// HasWatch is a KV notifying the changes of keys, see WatchedKV.
+type HasWatch interface {
+	// Watch sends the changes of the keys of the bucket with the prefix, those of a transaction in one
+	// slice, in the order of the commits. The channel is closed when ctx is done or when the changes
+	// aren't read in time, then the keys are to be read again. The changes must not be modified.
+	Watch(ctx context.Context, bucket string, prefix []byte) (<-chan []Change, error)
+}
+
+// BucketStat describes the B-tree of a bucket.
+type BucketStat struct {
+	Entries       uint64
+	Depth         uint64
+	BranchPages   uint64
+	LeafPages     uint64
+	OverflowPages uint64
+	PageSize      uint64
+}
+
+// HasBucketStat is implemented by transactions of databases which can describe the storage of a bucket.
+type HasBucketStat interface {
+	BucketStat(name string) (*BucketStat, error)
+}
+
 type Backend interface {
 	AddLocal([]byte) ([]byte, error)
 	Etherbase() (common.Address, error)
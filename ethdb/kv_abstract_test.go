@@ -16,6 +16,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -80,7 +82,85 @@ func TestManagedTx(t *testing.T) {
 		t.Run("multiple cursors "+msg, func(t *testing.T) {
 			testMultiCursor(t, db, bucket1, bucket2)
 		})
+		t.Run("prefetch "+msg, func(t *testing.T) {
+			testPrefetch(t, db, bucket1)
+		})
+		t.Run("multi get "+msg, func(t *testing.T) {
+			testMultiGet(t, db, bucket1, bucket2)
+		})
+		t.Run("range "+msg, func(t *testing.T) {
+			testRange(t, db, bucket1, bucket2)
+		})
+	}
+}
+
+func TestRemoteUpdate(t *testing.T) {
+	bucket := dbutils.Buckets[0]
+	kv := ethdb.NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	readOnlyKV := ethdb.NewLMDB().InMem().MustOpen()
+	defer readOnlyKV.Close()
+
+	conn, readOnlyConn := bufconn.Listen(1024*1024), bufconn.Listen(1024*1024)
+	grpcServer, readOnlyServer := grpc.NewServer(), grpc.NewServer()
+	remote.RegisterKVServer(grpcServer, remotedbserver.NewWritableKvServer(kv, "secret"))
+	remote.RegisterKVServer(readOnlyServer, remotedbserver.NewKvServer(readOnlyKV))
+	go func() { _ = grpcServer.Serve(conn) }()
+	go func() { _ = readOnlyServer.Serve(readOnlyConn) }()
+	defer grpcServer.Stop()
+	defer readOnlyServer.Stop()
+
+	ctx := context.Background()
+	put := func(db ethdb.KV, buckets ...string) error {
+		return db.Update(ctx, func(tx ethdb.Tx) error {
+			for _, b := range buckets {
+				if err := tx.Cursor(b).Put([]byte{3}, []byte{3}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	get := func(key byte) []byte {
+		var v []byte
+		require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) (err error) {
+			v, err = tx.Get(bucket, []byte{key})
+			return err
+		}))
+		return v
 	}
+
+	rdb, _ := ethdb.NewRemote().InMem(conn).WriteToken("secret").MustOpen()
+	defer rdb.Close()
+	require.NoError(t, rdb.Update(ctx, func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucket)
+		require.NoError(t, c.Put([]byte{1}, []byte{1}))
+		require.NoError(t, c.Put([]byte{2}, []byte{2}))
+		require.NoError(t, c.Delete([]byte{1}))
+		return nil
+	}))
+	assert.Nil(t, get(1))
+	assert.Equal(t, []byte{2}, get(2))
+
+	tx, err := rdb.Begin(ctx, nil, false)
+	require.NoError(t, err)
+	assert.Error(t, tx.Cursor(bucket).Put([]byte{3}, []byte{3}))
+	tx.Rollback()
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(put(rdb, bucket, "unknown")))
+	assert.Nil(t, get(3), "the transaction must be rolled back")
+
+	wrongToken, _ := ethdb.NewRemote().InMem(conn).WriteToken("guess").MustOpen()
+	defer wrongToken.Close()
+	assert.Equal(t, codes.Unauthenticated, status.Code(put(wrongToken, bucket)))
+	assert.Nil(t, get(3))
+
+	readOnly, _ := ethdb.NewRemote().InMem(readOnlyConn).WriteToken("secret").MustOpen()
+	defer readOnly.Close()
+	assert.Equal(t, codes.PermissionDenied, status.Code(put(readOnly, bucket)))
+
+	require.NoError(t, put(rdb, bucket))
+	assert.Equal(t, []byte{3}, get(3))
 }
 
 func setupDatabases() (writeDBs []ethdb.KV, readDBs []ethdb.KV, close func()) {
@@ -88,6 +168,10 @@ func setupDatabases() (writeDBs []ethdb.KV, readDBs []ethdb.KV, close func()) {
 		ethdb.NewBolt().InMem().MustOpen(),
 		ethdb.NewLMDB().InMem().MustOpen(),
 		ethdb.NewLMDB().InMem().MustOpen(), // for remote db
+		ethdb.NewMemKV(),
+		ethdb.NewMeteredKV(ethdb.NewLMDB().InMem().MustOpen()),
+		ethdb.NewWatchedKV(ethdb.NewLMDB().InMem().MustOpen()),
+		ethdb.NewBadger().InMem().MustOpen(),
 	}
 
 	conn := bufconn.Listen(1024 * 1024)
@@ -97,6 +181,10 @@ func setupDatabases() (writeDBs []ethdb.KV, readDBs []ethdb.KV, close func()) {
 		writeDBs[0],
 		writeDBs[1],
 		rdb,
+		writeDBs[3],
+		writeDBs[4],
+		writeDBs[5],
+		writeDBs[6],
 	}
 
 	grpcServer := grpc.NewServer()
@@ -179,6 +267,115 @@ func testPrefixFilter(t *testing.T, db ethdb.KV, bucket1 string) {
 	}
 
 }
+func testPrefetch(t *testing.T, db ethdb.KV, bucket1 string) {
+	assert := assert.New(t)
+
+	if err := db.View(context.Background(), func(tx ethdb.Tx) error {
+		var keys [][]byte
+		if err := tx.Cursor(bucket1).Walk(func(k, _ []byte) (bool, error) {
+			keys = append(keys, common.CopyBytes(k))
+			return true, nil
+		}); err != nil {
+			return err
+		}
+		assert.Equal(13, len(keys))
+
+		for _, prefetch := range []uint{2, 3, 13, 100} {
+			c := tx.Cursor(bucket1).Prefetch(prefetch)
+			var prefetched [][]byte
+			for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+				if err != nil {
+					return err
+				}
+				prefetched = append(prefetched, common.CopyBytes(k))
+			}
+			assert.Equal(keys, prefetched, "prefetch %d", prefetch)
+
+			k, _, err := c.Seek([]byte{2})
+			assert.NoError(err)
+			assert.Equal([]byte{2}, k)
+			k, _, err = c.Next()
+			assert.NoError(err)
+			assert.Equal([]byte{3}, k)
+			k, _, err = c.Seek([]byte{0, 0, 1})
+			assert.NoError(err)
+			assert.Equal([]byte{0, 0, 1}, k)
+			k, _, err = c.Next()
+			assert.NoError(err)
+			assert.Equal([]byte{1}, k)
+		}
+
+		c := tx.Cursor(bucket1).Prefix([]byte{0}).Prefetch(2)
+		counter := 0
+		for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			counter++
+		}
+		assert.Equal(4, counter)
+		return nil
+	}); err != nil {
+		assert.NoError(err)
+	}
+}
+
+func testMultiGet(t *testing.T, db ethdb.KV, bucket1, bucket2 string) {
+	keys := [][]byte{{0, 0, 0, 0, 0, 1}, {5}, {0, 0, 0, 0, 0, 3}, {0, 0, 1}, {42}, {0, 0, 0, 0, 0, 2}}
+	if err := db.View(context.Background(), func(tx ethdb.Tx) error {
+		for _, bucket := range []string{bucket1, bucket2} {
+			values, err := tx.MultiGet(bucket, keys)
+			if err != nil {
+				return err
+			}
+			require.Len(t, values, len(keys))
+			for i, key := range keys {
+				v, err := tx.Get(bucket, key)
+				if err != nil {
+					return err
+				}
+				assert.Equal(t, v, values[i], "%s %x", bucket, key)
+			}
+			assert.Nil(t, values[2])
+			assert.Nil(t, values[4])
+			assert.Equal(t, []byte{1}, values[1])
+
+			values, err = tx.MultiGet(bucket, nil)
+			assert.NoError(t, err)
+			assert.Empty(t, values)
+		}
+		return nil
+	}); err != nil {
+		require.NoError(t, err)
+	}
+}
+
+func testRange(t *testing.T, db ethdb.KV, bucket1, bucket2 string) {
+	keys := func(c ethdb.Cursor) [][]byte {
+		var result [][]byte
+		require.NoError(t, c.Walk(func(k, _ []byte) (bool, error) {
+			result = append(result, common.CopyBytes(k))
+			return true, nil
+		}))
+		return result
+	}
+	require.NoError(t, db.View(context.Background(), func(tx ethdb.Tx) error {
+		for _, bucket := range []string{bucket1, bucket2} {
+			assert.Equal(t, [][]byte{{3}, {4}, {5}}, keys(tx.Cursor(bucket).Range([]byte{3}, []byte{6})), bucket)
+			assert.Equal(t, [][]byte{{3}, {4}, {5}}, keys(tx.Cursor(bucket).Prefetch(2).Range([]byte{3}, []byte{6})), bucket)
+			assert.Equal(t, [][]byte{{8}, {9}}, keys(tx.Cursor(bucket).Range([]byte{8}, nil)), bucket)
+			assert.Equal(t, [][]byte{{0}, {0, 0, 0, 0, 0, 1}}, keys(tx.Cursor(bucket).Range(nil, []byte{0, 0, 0, 0, 0, 2})), bucket)
+			assert.Equal(t, [][]byte{{0, 0, 0, 0, 0, 2}}, keys(tx.Cursor(bucket).Prefix([]byte{0}).Range([]byte{0, 0, 0, 0, 0, 2}, []byte{0, 0, 1})), bucket)
+			assert.Empty(t, keys(tx.Cursor(bucket).Range([]byte{5}, []byte{5})), bucket)
+
+			k, _, err := tx.Cursor(bucket).Range(nil, []byte{5}).Seek([]byte{7})
+			require.NoError(t, err)
+			assert.Nil(t, k, bucket)
+		}
+		return nil
+	}))
+}
+
 func testCtxCancel(t *testing.T, db ethdb.KV, bucket1 string) {
 	assert := assert.New(t)
 	cancelableCtx, cancel := context.WithTimeout(context.Background(), time.Microsecond)
@@ -523,3 +720,29 @@ func TestReadAfterPut(t *testing.T) {
 		})
 	}
 }
+
+func TestBucketStat(t *testing.T) {
+	kv := ethdb.NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	bucket := dbutils.Buckets[15]
+	ctx := context.Background()
+	require.NoError(t, kv.Update(ctx, func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucket)
+		for i := 0; i < 100; i++ {
+			if err := c.Put([]byte{byte(i)}, []byte{byte(i), byte(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(t, kv.View(ctx, func(tx ethdb.Tx) error {
+		withStat, ok := tx.(ethdb.HasBucketStat)
+		require.True(t, ok)
+		st, err := withStat.BucketStat(bucket)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(100), st.Entries)
+		assert.Equal(t, uint64(1), st.LeafPages)
+		assert.NotZero(t, st.PageSize)
+		return nil
+	}))
+}
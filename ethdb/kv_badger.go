@@ -0,0 +1,630 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger/v2"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+const (
+	badgerFirstBatch = 16   // pairs a cursor reads after a seek
+	badgerMaxBatch   = 1024 // pairs a cursor reads at once when iterating
+)
+
+type badgerOpts struct {
+	Badger badger.Options
+}
+
+// BadgerKV is a KV on Badger, a log-structured merge tree: the writes are appended and compacted
+// in the background, with less write amplification than the B-tree of LMDB, the reads may look
+// into several levels of the tree. The keys of a bucket are prefixed by the length of the name
+// of the bucket and the name, the keys prefixed by 0 are the names of the existing buckets.
+// DupSort buckets are plain buckets, the keys and values are the same as of LMDB.
+//
+// There is one write transaction at a time, as of LMDB. Its writes are limited to the batch
+// size of Badger, see badger.Options.MaxTableSize, IdealBatchSize is half of it. The nested
+// transactions write into their parent, their Rollback writes back the values they replaced.
+type BadgerKV struct {
+	opts    badgerOpts
+	badger  *badger.DB
+	log     log.Logger
+	writeMu sync.Mutex // held by the write transaction
+	wg      sync.WaitGroup
+}
+
+type badgerTx struct {
+	ctx      context.Context
+	db       *BadgerKV
+	badger   *badger.Txn
+	parent   *badgerTx
+	writable bool
+	done     bool
+	writes   *uint64      // of the transaction and its nested ones, for the cursors to read again
+	undo     []badgerUndo // the values replaced by a nested transaction
+}
+
+type badgerUndo struct {
+	key, value []byte
+	existed    bool
+}
+
+type badgerCursor struct {
+	ctx       context.Context
+	tx        *badgerTx
+	bucket    []byte // prefix of the keys of the bucket
+	prefix    []byte
+	bits      uint // of the prefix matched, all if 0
+	bounds    keyRange
+	prefetch  int
+	batch     []memPair // read from the bucket at once, from the current position
+	batchSize int
+	pos       int
+	writes    uint64 // of the transaction when the batch was read
+	moved     bool   // by First, Seek or Last
+}
+
+type noValuesBadgerCursor struct {
+	*badgerCursor
+}
+
+// badgerLogger passes the messages of Badger to the log, most of them are about its compactions.
+type badgerLogger struct {
+	log log.Logger
+}
+
+func (l badgerLogger) Errorf(format string, args ...interface{}) {
+	l.log.Error(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l badgerLogger) Warningf(format string, args ...interface{}) {
+	l.log.Warn(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l badgerLogger) Infof(format string, args ...interface{}) {
+	l.log.Debug(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l badgerLogger) Debugf(format string, args ...interface{}) {
+	l.log.Trace(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func NewBadger() badgerOpts {
+	return badgerOpts{Badger: badger.DefaultOptions("").WithDetectConflicts(false)}
+}
+
+func (opts badgerOpts) Path(path string) badgerOpts {
+	opts.Badger = opts.Badger.WithDir(path).WithValueDir(path)
+	return opts
+}
+
+func (opts badgerOpts) InMem() badgerOpts {
+	opts.Badger = opts.Badger.WithInMemory(true).WithDir("").WithValueDir("")
+	return opts
+}
+
+func (opts badgerOpts) ReadOnly() badgerOpts {
+	opts.Badger = opts.Badger.WithReadOnly(true)
+	return opts
+}
+
+func (opts badgerOpts) Open() (KV, error) {
+	logger := log.New("badger_db", opts.Badger.Dir)
+	if !opts.Badger.InMemory {
+		if err := os.MkdirAll(opts.Badger.Dir, 0744); err != nil {
+			return nil, fmt.Errorf("could not create dir: %s, %w", opts.Badger.Dir, err)
+		}
+	}
+	db, err := badger.Open(opts.Badger.WithLogger(badgerLogger{log: logger}))
+	if err != nil {
+		return nil, err
+	}
+	kv := &BadgerKV{opts: opts, badger: db, log: logger}
+	if !opts.Badger.ReadOnly {
+		if err := kv.Update(context.Background(), func(tx Tx) error {
+			for _, name := range dbutils.Buckets {
+				if err := tx.(*badgerTx).CreateBucket(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			kv.Close()
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
+func (opts badgerOpts) MustOpen() KV {
+	db, err := opts.Open()
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Close closes BadgerKV
+// All transactions must be closed before closing the database.
+func (db *BadgerKV) Close() {
+	db.wg.Wait()
+	if db.badger == nil {
+		return
+	}
+	bdb := db.badger
+	db.badger = nil
+	if err := bdb.Close(); err != nil {
+		db.log.Warn("failed to close badger DB", "err", err)
+	} else {
+		db.log.Info("badger database closed")
+	}
+}
+
+func (db *BadgerKV) DiskSize(_ context.Context) (uint64, error) {
+	if db.badger == nil {
+		return 0, fmt.Errorf("db closed")
+	}
+	lsm, vlog := db.badger.Size()
+	return uint64(lsm + vlog), nil
+}
+
+func (db *BadgerKV) IdealBatchSize() int {
+	return int(db.badger.MaxBatchSize() / 2)
+}
+
+func (db *BadgerKV) Begin(ctx context.Context, parent Tx, writable bool) (Tx, error) {
+	if db.badger == nil {
+		return nil, fmt.Errorf("db closed")
+	}
+	if parent != nil {
+		p, ok := parent.(*badgerTx)
+		if !ok {
+			return nil, fmt.Errorf("parent %T of a transaction of BadgerKV", parent)
+		}
+		if writable && !p.writable {
+			return nil, fmt.Errorf("writable transaction in a read-only one")
+		}
+		return &badgerTx{ctx: ctx, db: db, badger: p.badger, parent: p, writable: writable, writes: p.writes}, nil
+	}
+	if writable {
+		db.writeMu.Lock()
+	}
+	db.wg.Add(1)
+	return &badgerTx{ctx: ctx, db: db, badger: db.badger.NewTransaction(writable), writable: writable, writes: new(uint64)}, nil
+}
+
+func (db *BadgerKV) View(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *BadgerKV) Update(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Commit of a nested transaction keeps its writes in the parent, the undo of them goes to the
+// parent if it is nested too.
+func (tx *badgerTx) Commit(ctx context.Context) error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	if tx.parent != nil {
+		if tx.parent.parent != nil {
+			tx.parent.undo = append(tx.parent.undo, tx.undo...)
+		}
+		return nil
+	}
+	defer tx.db.wg.Done()
+	if !tx.writable {
+		tx.badger.Discard()
+		return nil
+	}
+	defer tx.db.writeMu.Unlock()
+	return tx.db.wrapErr(tx.badger.Commit())
+}
+
+func (tx *badgerTx) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	if tx.parent != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			u := tx.undo[i]
+			var err error
+			if u.existed {
+				err = tx.badger.Set(u.key, u.value)
+			} else {
+				err = tx.badger.Delete(u.key)
+			}
+			if err != nil {
+				log.Warn("badger rollback of a nested transaction failed", "err", err)
+				return
+			}
+		}
+		*tx.writes++
+		return
+	}
+	tx.badger.Discard()
+	if tx.writable {
+		tx.db.writeMu.Unlock()
+	}
+	tx.db.wg.Done()
+}
+
+// wrapErr tells the limit of the writes of a transaction when they are over it.
+func (db *BadgerKV) wrapErr(err error) error {
+	if errors.Is(err, badger.ErrTxnTooBig) {
+		return fmt.Errorf("%w, the writes of a transaction are limited to %d bytes and %d keys", err, db.badger.MaxBatchSize(), db.badger.MaxBatchCount())
+	}
+	return err
+}
+
+// badgerBucket is the prefix of the keys of the bucket.
+func badgerBucket(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+// badgerKey is the key of the bucket in Badger, a new slice as Badger keeps it until the commit.
+func badgerKey(bucket, key []byte) []byte {
+	k := make([]byte, len(bucket)+len(key))
+	copy(k, bucket)
+	copy(k[len(bucket):], key)
+	return k
+}
+
+// badgerValue is the value of an item, not nil if it exists.
+func badgerValue(item *badger.Item) ([]byte, error) {
+	v, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		v = []byte{}
+	}
+	return v, nil
+}
+
+func (tx *badgerTx) get(key []byte) ([]byte, error) {
+	item, err := tx.badger.Get(key)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return badgerValue(item)
+}
+
+func (tx *badgerTx) Get(bucket string, key []byte) ([]byte, error) {
+	select {
+	case <-tx.ctx.Done():
+		return nil, tx.ctx.Err()
+	default:
+	}
+	return tx.get(badgerKey(badgerBucket(bucket), key))
+}
+
+func (tx *badgerTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if values[i], err = tx.Get(bucket, key); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// set puts the value, or deletes the key if the value is nil.
+func (tx *badgerTx) set(key, value []byte) error {
+	if !tx.writable {
+		return fmt.Errorf("write in a read-only transaction")
+	}
+	if tx.parent != nil {
+		old, err := tx.get(key)
+		if err != nil {
+			return err
+		}
+		tx.undo = append(tx.undo, badgerUndo{key: key, value: old, existed: old != nil})
+	}
+	*tx.writes++
+	if value == nil {
+		return tx.db.wrapErr(tx.badger.Delete(key))
+	}
+	return tx.db.wrapErr(tx.badger.Set(key, append([]byte{}, value...)))
+}
+
+// keys returns the keys with the prefix, without it.
+func (tx *badgerTx) keys(prefix []byte) [][]byte {
+	it := tx.badger.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+	var keys [][]byte
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil)[len(prefix):])
+	}
+	return keys
+}
+
+func (tx *badgerTx) BucketSize(name string) (uint64, error) {
+	prefix := badgerBucket(name)
+	it := tx.badger.NewIterator(badger.IteratorOptions{Prefix: prefix})
+	defer it.Close()
+	var size uint64
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		size += uint64(it.Item().EstimatedSize())
+	}
+	return size, nil
+}
+
+func (tx *badgerTx) CreateBucket(name string) error {
+	if tx.ExistsBucket(name) {
+		return nil
+	}
+	return tx.set(badgerKey([]byte{0}, []byte(name)), []byte{})
+}
+
+func (tx *badgerTx) DropBucket(name string) error {
+	for i := range dbutils.Buckets {
+		if dbutils.Buckets[i] == name {
+			return fmt.Errorf("%w, bucket: %s", ErrAttemptToDeleteNonDeprecatedBucket, name)
+		}
+	}
+	if err := tx.ClearBucket(name); err != nil {
+		return err
+	}
+	if !tx.ExistsBucket(name) {
+		return nil
+	}
+	return tx.set(badgerKey([]byte{0}, []byte(name)), nil)
+}
+
+func (tx *badgerTx) ExistsBucket(name string) bool {
+	v, err := tx.get(badgerKey([]byte{0}, []byte(name)))
+	return err == nil && v != nil
+}
+
+func (tx *badgerTx) ClearBucket(name string) error {
+	bucket := badgerBucket(name)
+	for _, k := range tx.keys(bucket) {
+		if err := tx.set(badgerKey(bucket, k), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *badgerTx) ExistingBuckets() ([]string, error) {
+	var names []string
+	for _, k := range tx.keys([]byte{0}) {
+		names = append(names, string(k))
+	}
+	return names, nil
+}
+
+func (tx *badgerTx) Cursor(bucket string) Cursor {
+	return &badgerCursor{ctx: tx.ctx, tx: tx, bucket: badgerBucket(bucket)}
+}
+
+func (c *badgerCursor) Prefix(v []byte) Cursor {
+	c.prefix = v
+	return c
+}
+
+func (c *badgerCursor) Range(start, end []byte) Cursor {
+	c.bounds = keyRange{start: start, end: end}
+	return c
+}
+
+func (c *badgerCursor) MatchBits(n uint) Cursor {
+	c.bits = n
+	return c
+}
+
+// Prefetch sets how many pairs are read at once.
+func (c *badgerCursor) Prefetch(v uint) Cursor {
+	c.prefetch = int(v)
+	return c
+}
+
+func (c *badgerCursor) NoValues() NoValuesCursor {
+	return &noValuesBadgerCursor{badgerCursor: c}
+}
+
+// read reads the next batch of pairs, from the key, after it if exclusive. The iterators of
+// Badger don't see the writes made after they were created and there can be one at a time in a
+// write transaction, so the pairs are read ahead by short-lived ones.
+func (c *badgerCursor) read(from []byte, exclusive bool, size int) error {
+	if c.prefetch > 0 {
+		size = c.prefetch
+	}
+	c.batch, c.pos, c.batchSize, c.writes, c.moved = c.batch[:0], 0, size, *c.tx.writes, true
+	it := c.tx.badger.NewIterator(badger.IteratorOptions{PrefetchValues: true, PrefetchSize: size, Prefix: c.bucket})
+	defer it.Close()
+	seek := badgerKey(c.bucket, from)
+	it.Seek(seek)
+	if exclusive && it.ValidForPrefix(c.bucket) && bytes.Equal(it.Item().Key(), seek) {
+		it.Next()
+	}
+	for ; it.ValidForPrefix(c.bucket) && len(c.batch) < size; it.Next() {
+		v, err := badgerValue(it.Item())
+		if err != nil {
+			return err
+		}
+		c.batch = append(c.batch, memPair{k: it.Item().KeyCopy(nil)[len(c.bucket):], v: v})
+	}
+	return nil
+}
+
+// current returns the pair at the position, if it is within the prefix and the range.
+func (c *badgerCursor) current() ([]byte, []byte, error) {
+	if c.pos >= len(c.batch) {
+		return nil, nil, nil
+	}
+	p := c.batch[c.pos]
+	if !hasPrefixBits(p.k, c.prefix, c.bits) || c.bounds.past(p.k) {
+		return nil, nil, nil
+	}
+	return p.k, p.v, nil
+}
+
+func (c *badgerCursor) First() ([]byte, []byte, error) {
+	return c.Seek(c.bounds.first(prefixBits(c.prefix, c.bits)))
+}
+
+func (c *badgerCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	select {
+	case <-c.ctx.Done():
+		return []byte{}, nil, c.ctx.Err()
+	default:
+	}
+	if err := c.read(seek, false, badgerFirstBatch); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.current()
+}
+
+func (c *badgerCursor) SeekExact(key []byte) ([]byte, error) {
+	return c.tx.get(badgerKey(c.bucket, key))
+}
+
+func (c *badgerCursor) Next() ([]byte, []byte, error) {
+	select {
+	case <-c.ctx.Done():
+		return []byte{}, nil, c.ctx.Err()
+	default:
+	}
+	if !c.moved {
+		return c.First()
+	}
+	if c.pos >= len(c.batch) {
+		return nil, nil, nil
+	}
+	if c.writes == *c.tx.writes {
+		c.pos++
+		if c.pos < len(c.batch) {
+			return c.current()
+		}
+		if len(c.batch) < c.batchSize {
+			return nil, nil, nil // the end of the bucket
+		}
+		c.pos--
+	}
+	// the rest of the batch is read again after writes, as other keys may be there since
+	size := c.batchSize * 2
+	if size > badgerMaxBatch {
+		size = badgerMaxBatch
+	}
+	if err := c.read(c.batch[c.pos].k, true, size); err != nil {
+		return []byte{}, nil, err
+	}
+	return c.current()
+}
+
+func (c *badgerCursor) Last() ([]byte, []byte, error) {
+	if c.prefix != nil || c.bounds.end != nil {
+		return []byte{}, nil, fmt.Errorf(".Last doesn't support c.prefix and ranges yet")
+	}
+	c.batch, c.pos, c.batchSize, c.writes, c.moved = c.batch[:0], 0, 1, *c.tx.writes, true
+	it := c.tx.badger.NewIterator(badger.IteratorOptions{Reverse: true})
+	defer it.Close()
+	// the prefix of the bucket with the last byte incremented is after its keys, the names
+	// of the buckets are ASCII
+	end := badgerKey(c.bucket, nil)
+	end[len(end)-1]++
+	it.Seek(end)
+	if it.Valid() && bytes.Equal(it.Item().Key(), end) {
+		it.Next()
+	}
+	if !it.ValidForPrefix(c.bucket) {
+		return nil, nil, nil
+	}
+	v, err := badgerValue(it.Item())
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	c.batch = append(c.batch, memPair{k: it.Item().KeyCopy(nil)[len(c.bucket):], v: v})
+	return c.current()
+}
+
+func (c *badgerCursor) Put(key []byte, value []byte) error {
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	default:
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return c.tx.set(badgerKey(c.bucket, key), value)
+}
+
+func (c *badgerCursor) Append(key []byte, value []byte) error {
+	return c.Put(key, value)
+}
+
+func (c *badgerCursor) Delete(key []byte) error {
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	default:
+	}
+	return c.tx.set(badgerKey(c.bucket, key), nil)
+}
+
+func (c *badgerCursor) Walk(walker func(k, v []byte) (bool, error)) error {
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		ok, err := walker(k, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *noValuesBadgerCursor) First() ([]byte, uint32, error) {
+	k, v, err := c.badgerCursor.First()
+	return k, uint32(len(v)), err
+}
+
+func (c *noValuesBadgerCursor) Seek(seek []byte) ([]byte, uint32, error) {
+	k, v, err := c.badgerCursor.Seek(seek)
+	return k, uint32(len(v)), err
+}
+
+func (c *noValuesBadgerCursor) Next() ([]byte, uint32, error) {
+	k, v, err := c.badgerCursor.Next()
+	return k, uint32(len(v)), err
+}
+
+func (c *noValuesBadgerCursor) Walk(walker func(k []byte, vSize uint32) (bool, error)) error {
+	return c.badgerCursor.Walk(func(k, v []byte) (bool, error) {
+		return walker(k, uint32(len(v)))
+	})
+}
@@ -0,0 +1,119 @@
+package ethdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerKV(t *testing.T) {
+	ctx := context.Background()
+	kv := NewBadger().InMem().MustOpen()
+	defer kv.Close()
+	// neighbours, the prefix of one bucket must not reach into the other
+	bucket, next := dbutils.Buckets[0], dbutils.Buckets[1]
+
+	require.NoError(t, LoadFixture(kv, strings.NewReader(`{"`+bucket+`": {"0x01": "0x0a", "0x03": "0x0c", "0x04": "0x"}, "`+next+`": {"0x00": "0x0b"}}`)))
+
+	read, err := kv.Begin(ctx, nil, false)
+	require.NoError(t, err)
+	defer read.Rollback()
+
+	write, err := kv.Begin(ctx, nil, true)
+	require.NoError(t, err)
+	c := write.Cursor(bucket)
+	require.NoError(t, c.Put([]byte{2}, []byte{11}))
+	require.NoError(t, c.Delete([]byte{3}))
+	// the keys after the position are read again after the writes
+	k, _, err := c.First()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1}, k)
+	require.NoError(t, c.Put([]byte{1, 0}, []byte{10}))
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 0}, k)
+	k, v, err := c.Last()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{4}, k)
+	assert.Equal(t, []byte{}, v, "empty values aren't missing")
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	assert.Nil(t, k)
+
+	// the nested transactions write into their parent, until they are rolled back
+	nested, err := kv.Begin(ctx, write, true)
+	require.NoError(t, err)
+	require.NoError(t, nested.Cursor(bucket).Put([]byte{1}, []byte{1}))
+	require.NoError(t, nested.Cursor(bucket).Delete([]byte{2}))
+	v, err = write.Get(bucket, []byte{2})
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	nested.Rollback()
+	values, err := write.MultiGet(bucket, [][]byte{{1}, {2}, {3}})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{{10}, {11}, nil}, values)
+	nested, err = kv.Begin(ctx, write, true)
+	require.NoError(t, err)
+	require.NoError(t, nested.Cursor(bucket).Put([]byte{5}, []byte{15}))
+	require.NoError(t, nested.Commit(ctx))
+	require.NoError(t, write.Commit(ctx))
+
+	// the read transaction sees the snapshot it began at
+	var keys [][]byte
+	require.NoError(t, read.Cursor(bucket).Walk(func(k, v []byte) (bool, error) {
+		keys = append(keys, k)
+		return true, nil
+	}))
+	assert.Equal(t, [][]byte{{1}, {3}, {4}}, keys)
+
+	require.NoError(t, kv.View(ctx, func(tx Tx) error {
+		// over several batches
+		c = tx.Cursor(bucket).Prefetch(2)
+		keys = nil
+		for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+			require.NoError(t, err)
+			keys = append(keys, k)
+		}
+		assert.Equal(t, [][]byte{{1}, {1, 0}, {2}, {4}, {5}}, keys)
+		k, _, err := tx.Cursor(bucket).Range([]byte{2}, []byte{5}).Seek([]byte{4})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{4}, k)
+		k, _, err = tx.Cursor(bucket).Range([]byte{2}, []byte{4}).Seek([]byte{4})
+		require.NoError(t, err)
+		assert.Nil(t, k)
+		keys = nil
+		require.NoError(t, tx.Cursor(bucket).Prefix([]byte{3, 0xff}).MatchBits(6).Walk(func(k, v []byte) (bool, error) {
+			keys = append(keys, k)
+			return true, nil
+		}))
+		assert.Equal(t, [][]byte{{1}, {1, 0}, {2}}, keys, "keys with the first 6 bits of 0x03")
+		k, _, err = tx.Cursor(next).Last()
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0}, k)
+		return nil
+	}))
+
+	require.NoError(t, kv.Update(ctx, func(tx Tx) error {
+		migrator := tx.(BucketMigrator)
+		assert.True(t, migrator.ExistsBucket(bucket))
+		assert.Error(t, migrator.DropBucket(bucket))
+		require.NoError(t, migrator.ClearBucket(bucket))
+		k, _, err := tx.Cursor(bucket).First()
+		require.NoError(t, err)
+		assert.Nil(t, k)
+		require.NoError(t, migrator.CreateBucket("deprecated"))
+		names, err := migrator.ExistingBuckets()
+		require.NoError(t, err)
+		assert.Len(t, names, len(dbutils.Buckets)+1)
+		require.NoError(t, migrator.DropBucket("deprecated"))
+		assert.False(t, migrator.ExistsBucket("deprecated"))
+		v, err := tx.Get(next, []byte{0})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{11}, v)
+		return nil
+	}))
+}
@@ -42,6 +42,7 @@ type boltCursor struct {
 	ctx    context.Context
 	bucket boltBucket
 	prefix []byte
+	bounds keyRange
 
 	bolt *bolt.Cursor
 }
@@ -219,6 +220,11 @@ func (c *boltCursor) Prefix(v []byte) Cursor {
 	return c
 }
 
+func (c *boltCursor) Range(start, end []byte) Cursor {
+	c.bounds = keyRange{start: start, end: end}
+	return c
+}
+
 func (c *boltCursor) MatchBits(n uint) Cursor {
 	panic("not implemented yet")
 }
@@ -253,6 +259,18 @@ func (tx *boltTx) Get(bucket string, key []byte) (val []byte, err error) {
 	return tx.Bucket(bucket).Get(key)
 }
 
+func (tx *boltTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	b := tx.Bucket(bucket)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if values[i], err = b.Get(key); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
 func (b boltBucket) Get(key []byte) (val []byte, err error) {
 	select {
 	case <-b.tx.ctx.Done():
@@ -296,12 +314,13 @@ func (c *boltCursor) SeekExact(key []byte) (val []byte, err error) {
 }
 
 func (c *boltCursor) First() (k, v []byte, err error) {
-	if len(c.prefix) == 0 {
+	first := c.bounds.first(c.prefix)
+	if len(first) == 0 {
 		k, v = c.bolt.First()
-		return k, v, nil
+	} else {
+		k, v = c.bolt.Seek(first)
 	}
-	k, v = c.bolt.Seek(c.prefix)
-	if !bytes.HasPrefix(k, c.prefix) {
+	if !bytes.HasPrefix(k, c.prefix) || c.bounds.past(k) {
 		return nil, nil, nil
 	}
 	return k, v, nil
@@ -315,10 +334,8 @@ func (c *boltCursor) Seek(seek []byte) (k, v []byte, err error) {
 	}
 
 	k, v = c.bolt.Seek(seek)
-	if c.prefix != nil {
-		if !bytes.HasPrefix(k, c.prefix) {
-			return nil, nil, nil
-		}
+	if (c.prefix != nil && !bytes.HasPrefix(k, c.prefix)) || c.bounds.past(k) {
+		return nil, nil, nil
 	}
 	return k, v, nil
 }
@@ -331,10 +348,8 @@ func (c *boltCursor) Next() (k, v []byte, err error) {
 	}
 
 	k, v = c.bolt.Next()
-	if c.prefix != nil {
-		if !bytes.HasPrefix(k, c.prefix) {
-			k, v = nil, nil
-		}
+	if (c.prefix != nil && !bytes.HasPrefix(k, c.prefix)) || c.bounds.past(k) {
+		k, v = nil, nil
 	}
 	return k, v, nil
 }
@@ -400,17 +415,8 @@ func (c *noValuesBoltCursor) Walk(walker func(k []byte, vSize uint32) (bool, err
 }
 
 func (c *noValuesBoltCursor) First() (k []byte, vSize uint32, err error) {
-	var v []byte
-	if len(c.prefix) == 0 {
-		k, v = c.bolt.First()
-		return k, uint32(len(v)), nil
-	}
-
-	k, v = c.bolt.Seek(c.prefix)
-	if !bytes.HasPrefix(k, c.prefix) {
-		return nil, 0, nil
-	}
-	return k, uint32(len(v)), nil
+	k, v, err := c.boltCursor.First()
+	return k, uint32(len(v)), err
 }
 
 func (c *noValuesBoltCursor) Seek(seek []byte) (k []byte, vSize uint32, err error) {
@@ -422,10 +428,8 @@ func (c *noValuesBoltCursor) Seek(seek []byte) (k []byte, vSize uint32, err erro
 
 	var v []byte
 	k, v = c.bolt.Seek(seek)
-	if c.prefix != nil {
-		if !bytes.HasPrefix(k, c.prefix) {
-			return nil, 0, nil
-		}
+	if (c.prefix != nil && !bytes.HasPrefix(k, c.prefix)) || c.bounds.past(k) {
+		return nil, 0, nil
 	}
 	return k, uint32(len(v)), nil
 }
@@ -439,10 +443,8 @@ func (c *noValuesBoltCursor) Next() (k []byte, vSize uint32, err error) {
 
 	var v []byte
 	k, v = c.bolt.Next()
-	if c.prefix != nil {
-		if !bytes.HasPrefix(k, c.prefix) {
-			return nil, 0, nil
-		}
+	if (c.prefix != nil && !bytes.HasPrefix(k, c.prefix)) || c.bounds.past(k) {
+		return nil, 0, nil
 	}
 	return k, uint32(len(v)), nil
 }
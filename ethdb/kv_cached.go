@@ -0,0 +1,409 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+// CachedBuckets are the buckets of CachedKV: the accounts, the code and the headers, read by
+// most of the queries.
+var CachedBuckets = []string{dbutils.PlainStateBucket, dbutils.PlainContractCodeBucket, dbutils.CodeBucket, dbutils.HeaderPrefix}
+
+var (
+	dbCacheHitMeter  = metrics.NewRegisteredMeter("db/cache/hit", nil)
+	dbCacheMissMeter = metrics.NewRegisteredMeter("db/cache/miss", nil)
+)
+
+// maxCachedEntry is the size of the largest key and value cached, fastcache drops larger ones.
+const maxCachedEntry = 64*1024 - 16
+
+// CacheHead is a key whose value changes when the values of CachedBuckets do, see CachedKV.
+type CacheHead struct {
+	Bucket string
+	Key    []byte
+}
+
+// CachedKV caches the values read by the read transactions from CachedBuckets, for the readers
+// of a database written by another process, like the rpcdaemon and the restapi, which read the
+// same accounts and headers over and over. The values are dropped when the head advances, when
+// the value of one of the heads changes.
+//
+// If kv is HasWatch, the heads are watched and the values are dropped when a change of them is
+// notified, the transactions begun in between may read the values of the previous head.
+// Otherwise, and while the watch is interrupted, each transaction reads the heads before its
+// first read from the cache. The writes through CachedKV drop the values when committed.
+type CachedKV struct {
+	KV
+	cache  *fastcache.Cache
+	heads  []CacheHead
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.RWMutex // held for writing when the values are dropped
+	gen        uint64       // of the values, incremented when they are dropped
+	headValues []byte       // the heads of the values, nil if not read yet or watched
+	watching   int          // heads watched
+}
+
+type cachedTx struct {
+	Tx
+	db      *CachedKV
+	gen     uint64
+	checked bool // gen is known
+	bypass  bool // the transaction doesn't see the values of the cache
+}
+
+type cachedCursor struct {
+	Cursor
+	tx     *cachedTx
+	bucket string
+}
+
+// NewCachedKV caches up to size bytes of the values of kv, dropped when the heads change, see
+// CachedKV. size is at least 32MB.
+func NewCachedKV(kv KV, size int, heads []CacheHead) *CachedKV {
+	ctx, cancel := context.WithCancel(context.Background())
+	db := &CachedKV{KV: kv, cache: fastcache.New(size), heads: heads, cancel: cancel}
+	if watcher, ok := kv.(HasWatch); ok {
+		for _, head := range heads {
+			db.wg.Add(1)
+			go db.watch(ctx, watcher, head)
+		}
+	}
+	return db
+}
+
+// watch drops the values on the changes of the head, until ctx is done. The watch is started
+// again if it ends, each transaction reads the heads in the meantime. If it can't start, the
+// transactions keep reading the heads.
+func (db *CachedKV) watch(ctx context.Context, watcher HasWatch, head CacheHead) {
+	defer db.wg.Done()
+	for {
+		changes, err := watcher.Watch(ctx, head.Bucket, head.Key)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Info("The heads of the database cache are read by each transaction", "bucket", head.Bucket, "err", err)
+			}
+			return
+		}
+		db.mu.Lock()
+		db.watching++
+		db.resetLocked()
+		db.mu.Unlock()
+		for batch := range changes {
+			for _, change := range batch {
+				if bytes.Equal(change.Key, head.Key) {
+					db.reset()
+					break
+				}
+			}
+		}
+		db.mu.Lock()
+		db.watching--
+		db.resetLocked()
+		db.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (db *CachedKV) reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.resetLocked()
+}
+
+func (db *CachedKV) resetLocked() {
+	db.cache.Reset()
+	db.gen++
+	db.headValues = nil
+}
+
+// Close stops the watches, then closes kv.
+func (db *CachedKV) Close() {
+	db.cancel()
+	db.wg.Wait()
+	db.KV.Close()
+}
+
+func (db *CachedKV) Begin(ctx context.Context, parent Tx, writable bool) (Tx, error) {
+	if cachedParent, ok := parent.(*cachedTx); ok {
+		parent = cachedParent.Tx
+	}
+	tx, err := db.KV.Begin(ctx, parent, writable)
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedTx{Tx: tx, db: db, bypass: writable}
+	db.mu.RLock()
+	if db.watching == len(db.heads) && len(db.heads) > 0 {
+		// the snapshot of the transaction is of the current head, or of a later one not notified yet
+		cached.gen, cached.checked = db.gen, true
+	}
+	db.mu.RUnlock()
+	return cached, nil
+}
+
+func (db *CachedKV) View(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *CachedKV) Update(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *CachedKV) Watch(ctx context.Context, bucket string, prefix []byte) (<-chan []Change, error) {
+	if watcher, ok := db.KV.(HasWatch); ok {
+		return watcher.Watch(ctx, bucket, prefix)
+	}
+	return nil, fmt.Errorf("%T doesn't notify the changes of keys", db.KV)
+}
+
+func (db *CachedKV) DiskSize(ctx context.Context) (uint64, error) {
+	if stats, ok := db.KV.(HasStats); ok {
+		return stats.DiskSize(ctx)
+	}
+	return 0, nil
+}
+
+func (db *CachedKV) BackupTo(ctx context.Context, w io.Writer) error {
+	if backuper, ok := db.KV.(HasBackup); ok {
+		return backuper.BackupTo(ctx, w)
+	}
+	return fmt.Errorf("%T doesn't support hot backups", db.KV)
+}
+
+// check tells if the transaction sees the values of the cache, reading the heads if they
+// aren't watched. A transaction of other heads than those of the values drops them, for those
+// of its heads.
+func (tx *cachedTx) check() (bool, error) {
+	if tx.bypass {
+		return false, nil
+	}
+	if tx.checked {
+		return true, nil
+	}
+	var heads []byte
+	for _, head := range tx.db.heads {
+		v, err := tx.Tx.Get(head.Bucket, head.Key)
+		if err != nil {
+			return false, err
+		}
+		var lenBuf [binary.MaxVarintLen64]byte
+		heads = append(heads, lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(v)))]...)
+		heads = append(heads, v...)
+	}
+	tx.db.mu.Lock()
+	if tx.db.headValues == nil || !bytes.Equal(heads, tx.db.headValues) {
+		tx.db.resetLocked()
+		tx.db.headValues = heads
+	}
+	tx.gen, tx.checked = tx.db.gen, true
+	tx.db.mu.Unlock()
+	return true, nil
+}
+
+// cacheKey is the key of the value in the cache, prefixed by the bucket.
+func cacheKey(bucket string, key []byte) []byte {
+	k := make([]byte, 0, 1+len(bucket)+len(key))
+	k = append(k, byte(len(bucket)))
+	k = append(k, bucket...)
+	return append(k, key...)
+}
+
+func (tx *cachedTx) get(bucket string, key []byte, read func() ([]byte, error)) ([]byte, error) {
+	if !isCached(bucket) {
+		return read()
+	}
+	ok, err := tx.check()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return read()
+	}
+	k := cacheKey(bucket, key)
+	tx.db.mu.RLock()
+	var v []byte
+	var hit bool
+	if tx.gen == tx.db.gen {
+		v, hit = tx.db.cache.HasGet(nil, k)
+	}
+	tx.db.mu.RUnlock()
+	if hit {
+		dbCacheHitMeter.Mark(1)
+		if v == nil {
+			v = []byte{}
+		}
+		return v, nil
+	}
+	dbCacheMissMeter.Mark(1)
+	if v, err = read(); err != nil || v == nil {
+		// the keys not found aren't cached, they may be written without a change of the heads
+		return v, err
+	}
+	if len(k)+len(v) <= maxCachedEntry {
+		tx.db.mu.RLock()
+		if tx.gen == tx.db.gen {
+			tx.db.cache.Set(k, v)
+		}
+		tx.db.mu.RUnlock()
+	}
+	return v, nil
+}
+
+func isCached(bucket string) bool {
+	for _, b := range CachedBuckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+func (tx *cachedTx) Get(bucket string, key []byte) ([]byte, error) {
+	return tx.get(bucket, key, func() ([]byte, error) {
+		return tx.Tx.Get(bucket, key)
+	})
+}
+
+func (tx *cachedTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	if !isCached(bucket) || tx.bypass {
+		return tx.Tx.MultiGet(bucket, keys)
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if values[i], err = tx.Get(bucket, key); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (tx *cachedTx) Cursor(bucket string) Cursor {
+	c := tx.Tx.Cursor(bucket)
+	if tx.bypass || !isCached(bucket) {
+		return c
+	}
+	return &cachedCursor{Cursor: c, tx: tx, bucket: bucket}
+}
+
+// Commit of a write transaction drops the values, they may have been written.
+func (tx *cachedTx) Commit(ctx context.Context) error {
+	if err := tx.Tx.Commit(ctx); err != nil {
+		return err
+	}
+	if tx.bypass {
+		tx.db.reset()
+	}
+	return nil
+}
+
+func (tx *cachedTx) migrator() (BucketMigrator, error) {
+	migrator, ok := tx.Tx.(BucketMigrator)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't implement ethdb.TxMigrator interface", tx.Tx)
+	}
+	return migrator, nil
+}
+
+func (tx *cachedTx) DropBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.DropBucket(name)
+}
+
+func (tx *cachedTx) CreateBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.CreateBucket(name)
+}
+
+func (tx *cachedTx) ExistsBucket(name string) bool {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return false
+	}
+	return migrator.ExistsBucket(name)
+}
+
+func (tx *cachedTx) ClearBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.ClearBucket(name)
+}
+
+func (tx *cachedTx) ExistingBuckets() ([]string, error) {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.ExistingBuckets()
+}
+
+func (tx *cachedTx) BucketStat(name string) (*BucketStat, error) {
+	withStat, ok := tx.Tx.(HasBucketStat)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't describe buckets", tx.Tx)
+	}
+	return withStat.BucketStat(name)
+}
+
+func (c *cachedCursor) Prefix(v []byte) Cursor {
+	c.Cursor = c.Cursor.Prefix(v)
+	return c
+}
+
+func (c *cachedCursor) MatchBits(n uint) Cursor {
+	c.Cursor = c.Cursor.MatchBits(n)
+	return c
+}
+
+func (c *cachedCursor) Prefetch(v uint) Cursor {
+	c.Cursor = c.Cursor.Prefetch(v)
+	return c
+}
+
+func (c *cachedCursor) Range(start, end []byte) Cursor {
+	c.Cursor = c.Cursor.Range(start, end)
+	return c
+}
+
+func (c *cachedCursor) SeekExact(key []byte) ([]byte, error) {
+	return c.tx.get(c.bucket, key, func() ([]byte, error) {
+		return c.Cursor.SeekExact(key)
+	})
+}
@@ -0,0 +1,73 @@
+package ethdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedKV(t *testing.T) {
+	ctx := context.Background()
+	heads := []CacheHead{{Bucket: dbutils.SyncStageProgress, Key: []byte("Execution")}}
+	put := func(kv KV, bucket string, k, v []byte) {
+		require.NoError(t, kv.Update(ctx, func(tx Tx) error {
+			return tx.Cursor(bucket).Put(k, v)
+		}))
+	}
+	get := func(kv KV, k []byte) (v []byte) {
+		require.NoError(t, kv.View(ctx, func(tx Tx) error {
+			var err error
+			v, err = tx.Get(dbutils.PlainStateBucket, k)
+			return err
+		}))
+		return v
+	}
+
+	// the heads are read by the transactions
+	kv := NewLMDB().InMem().MustOpen()
+	cached := NewCachedKV(kv, 32*1024*1024, heads)
+	defer cached.Close()
+	put(kv, dbutils.PlainStateBucket, []byte{1}, []byte{1})
+	assert.Equal(t, []byte{1}, get(cached, []byte{1}))
+	put(kv, dbutils.PlainStateBucket, []byte{1}, []byte{2})
+	put(kv, dbutils.PlainStateBucket, []byte{2}, []byte{2})
+	assert.Equal(t, []byte{1}, get(cached, []byte{1}), "cached until the head advances")
+	assert.Equal(t, []byte{2}, get(cached, []byte{2}), "the keys not found aren't cached")
+	put(kv, dbutils.SyncStageProgress, []byte("Execution"), []byte{1})
+	assert.Equal(t, []byte{2}, get(cached, []byte{1}))
+
+	require.NoError(t, cached.View(ctx, func(tx Tx) error {
+		values, err := tx.MultiGet(dbutils.PlainStateBucket, [][]byte{{1}, {2}, {3}})
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{{2}, {2}, nil}, values)
+		v, err := tx.Cursor(dbutils.PlainStateBucket).SeekExact([]byte{2})
+		require.NoError(t, err)
+		assert.Equal(t, []byte{2}, v)
+		return nil
+	}))
+	// the writes through the cache drop it
+	put(cached, dbutils.PlainStateBucket, []byte{2}, []byte{3})
+	assert.Equal(t, []byte{3}, get(cached, []byte{2}))
+
+	// the heads are watched
+	watched := NewWatchedKV(NewLMDB().InMem().MustOpen())
+	cached = NewCachedKV(watched, 32*1024*1024, heads)
+	defer cached.Close()
+	require.Eventually(t, func() bool {
+		cached.mu.RLock()
+		defer cached.mu.RUnlock()
+		return cached.watching == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	put(watched, dbutils.PlainStateBucket, []byte{1}, []byte{1})
+	assert.Equal(t, []byte{1}, get(cached, []byte{1}))
+	put(watched, dbutils.PlainStateBucket, []byte{1}, []byte{2})
+	assert.Equal(t, []byte{1}, get(cached, []byte{1}))
+	put(watched, dbutils.SyncStageProgress, []byte("Execution"), []byte{1})
+	require.Eventually(t, func() bool {
+		return get(cached, []byte{1})[0] == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
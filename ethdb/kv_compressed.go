@@ -0,0 +1,406 @@
+package ethdb
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+// Formats of the values of the compressed buckets, in their first byte.
+const (
+	valueRaw     byte = 0 // the value follows
+	valueDeflate byte = 1 // the value deflated with the dictionary of the bucket follows
+)
+
+const (
+	minCompressedSize = 64        // smaller values are stored raw
+	maxDictSize       = 32 * 1024 // the window of deflate, the dictionary doesn't help beyond
+	dictSegmentSize   = 16
+)
+
+// CompressedBuckets are compressed with the storage mode compression, they take most of the disk
+// of archives.
+var CompressedBuckets = []string{dbutils.BlockReceiptsPrefix, dbutils.CodeBucket}
+
+// dictSeeds start the dictionaries, for those trained with few values: the common code of the
+// solidity contracts, the ERC20 events, and the padding of the addresses and the numbers.
+var dictSeeds = map[string][]byte{
+	dbutils.BlockReceiptsPrefix: common.FromHex("" +
+		"000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000" +
+		"ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" + // Transfer(address,address,uint256)
+		"8c5be1e5ebec7d5bd14f71427e1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"), // Approval(address,address,uint256)
+	dbutils.CodeBucket: common.FromHex("" +
+		"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff" +
+		"7c01000000000000000000000000000000000000000000000000000000006000350463ffffffff16" +
+		"73ffffffffffffffffffffffffffffffffffffffff16" +
+		"6060604052" + "6080604052" + "600436106100" + "57600080fd5b" + "3480156100" + "5b50" +
+		"a165627a7a72305820" + "a265627a7a72315820" + "a264697066735822" + "64736f6c6343"),
+}
+
+// CompressedKV stores the values of the compressed buckets deflated with the dictionary of the
+// bucket, behind a byte of format, and inflates them when they are read. The values of the other
+// buckets, and the sizes of the NoValuesCursor, are those stored.
+type CompressedKV struct {
+	KV
+	codecs map[string]*ValueCodec
+}
+
+type compressedTx struct {
+	Tx
+	db *CompressedKV
+}
+
+type compressedCursor struct {
+	Cursor
+	codec *ValueCodec
+}
+
+// ValueCodec compresses and decompresses the values of a bucket with its dictionary.
+type ValueCodec struct {
+	dict    []byte
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func NewValueCodec(dict []byte) *ValueCodec {
+	return &ValueCodec{dict: dict}
+}
+
+// Encode returns the value with its format, deflated if it is smaller.
+func (c *ValueCodec) Encode(v []byte) []byte {
+	if len(v) >= minCompressedSize {
+		w, _ := c.writers.Get().(*flate.Writer)
+		if w == nil {
+			w, _ = flate.NewWriterDict(ioutil.Discard, flate.DefaultCompression, c.dict)
+		}
+		var buf bytes.Buffer
+		buf.WriteByte(valueDeflate)
+		w.Reset(&buf)
+		// writes into a bytes.Buffer don't fail
+		_, _ = w.Write(v)
+		_ = w.Close()
+		c.writers.Put(w)
+		if buf.Len() <= len(v) {
+			return buf.Bytes()
+		}
+	}
+	encoded := make([]byte, len(v)+1)
+	encoded[0] = valueRaw
+	copy(encoded[1:], v)
+	return encoded
+}
+
+// Decode returns the value encoded by Encode, a part of it if it is raw.
+func (c *ValueCodec) Decode(v []byte) ([]byte, error) {
+	if len(v) == 0 {
+		return v, nil
+	}
+	switch v[0] {
+	case valueRaw:
+		return v[1:], nil
+	case valueDeflate:
+		r, _ := c.readers.Get().(io.ReadCloser)
+		if r == nil {
+			r = flate.NewReaderDict(bytes.NewReader(v[1:]), c.dict)
+		} else if err := r.(flate.Resetter).Reset(bytes.NewReader(v[1:]), c.dict); err != nil {
+			return nil, err
+		}
+		decoded, err := ioutil.ReadAll(r)
+		c.readers.Put(r)
+		if err != nil {
+			return nil, fmt.Errorf("corrupted compressed value: %w", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unknown format %d of a compressed value", v[0])
+	}
+}
+
+// TrainDictionary builds a dictionary of the bucket from samples of its values: the segments
+// found in most of them, the most frequent last, the closest to the data, after the seed.
+func TrainDictionary(bucket string, samples [][]byte) []byte {
+	counts := map[string]int{}
+	for _, sample := range samples {
+		seen := map[string]struct{}{}
+		for i := 0; i+dictSegmentSize <= len(sample); i += dictSegmentSize / 2 {
+			segment := string(sample[i : i+dictSegmentSize])
+			if _, ok := seen[segment]; ok {
+				continue
+			}
+			seen[segment] = struct{}{}
+			counts[segment]++
+		}
+	}
+	type segmentCount struct {
+		segment string
+		count   int
+	}
+	var segments []segmentCount
+	for segment, count := range counts {
+		if count > 1 {
+			segments = append(segments, segmentCount{segment, count})
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].count != segments[j].count {
+			return segments[i].count > segments[j].count
+		}
+		return segments[i].segment < segments[j].segment
+	})
+	seed := dictSeeds[bucket]
+	if room := (maxDictSize - len(seed)) / dictSegmentSize; len(segments) > room {
+		segments = segments[:room]
+	}
+	dict := make([]byte, 0, len(seed)+len(segments)*dictSegmentSize)
+	dict = append(dict, seed...)
+	for i := len(segments) - 1; i >= 0; i-- {
+		dict = append(dict, segments[i].segment...)
+	}
+	return dict
+}
+
+// NewCompressedKV compresses the values of the buckets of the dictionaries, see CompressedKV.
+func NewCompressedKV(kv KV, dicts map[string][]byte) *CompressedKV {
+	db := &CompressedKV{KV: kv, codecs: make(map[string]*ValueCodec, len(dicts))}
+	for bucket, dict := range dicts {
+		db.codecs[bucket] = NewValueCodec(dict)
+	}
+	return db
+}
+
+// WithCompression wraps kv into a CompressedKV if it has compressed buckets, which have a dictionary.
+func WithCompression(kv KV) (KV, error) {
+	if _, ok := kv.(*CompressedKV); ok {
+		return kv, nil
+	}
+	dicts := map[string][]byte{}
+	if err := kv.View(context.Background(), func(tx Tx) error {
+		for _, bucket := range CompressedBuckets {
+			dict, err := tx.Get(dbutils.DatabaseInfoBucket, []byte(dbutils.CompressionDictPrefix+bucket))
+			if err != nil {
+				return err
+			}
+			if len(dict) > 0 {
+				dicts[bucket] = common.CopyBytes(dict)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if len(dicts) == 0 {
+		return kv, nil
+	}
+	return NewCompressedKV(kv, dicts), nil
+}
+
+func (db *CompressedKV) Begin(ctx context.Context, parent Tx, writable bool) (Tx, error) {
+	if compressed, ok := parent.(*compressedTx); ok {
+		parent = compressed.Tx
+	}
+	tx, err := db.KV.Begin(ctx, parent, writable)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedTx{Tx: tx, db: db}, nil
+}
+
+func (db *CompressedKV) View(ctx context.Context, f func(tx Tx) error) error {
+	return db.KV.View(ctx, func(tx Tx) error {
+		return f(&compressedTx{Tx: tx, db: db})
+	})
+}
+
+func (db *CompressedKV) Update(ctx context.Context, f func(tx Tx) error) error {
+	return db.KV.Update(ctx, func(tx Tx) error {
+		return f(&compressedTx{Tx: tx, db: db})
+	})
+}
+
+func (db *CompressedKV) DiskSize(ctx context.Context) (uint64, error) {
+	if stats, ok := db.KV.(HasStats); ok {
+		return stats.DiskSize(ctx)
+	}
+	return 0, nil
+}
+
+func (db *CompressedKV) BackupTo(ctx context.Context, w io.Writer) error {
+	if backuper, ok := db.KV.(HasBackup); ok {
+		return backuper.BackupTo(ctx, w)
+	}
+	return fmt.Errorf("%T doesn't support hot backups", db.KV)
+}
+
+func (tx *compressedTx) Cursor(bucket string) Cursor {
+	c := tx.Tx.Cursor(bucket)
+	if codec, ok := tx.db.codecs[bucket]; ok {
+		return &compressedCursor{Cursor: c, codec: codec}
+	}
+	return c
+}
+
+func (tx *compressedTx) Get(bucket string, key []byte) ([]byte, error) {
+	v, err := tx.Tx.Get(bucket, key)
+	codec, ok := tx.db.codecs[bucket]
+	if err != nil || v == nil || !ok {
+		return v, err
+	}
+	return codec.Decode(v)
+}
+
+func (tx *compressedTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	values, err := tx.Tx.MultiGet(bucket, keys)
+	codec, ok := tx.db.codecs[bucket]
+	if err != nil || !ok {
+		return values, err
+	}
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		if values[i], err = codec.Decode(v); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (tx *compressedTx) migrator() (BucketMigrator, error) {
+	migrator, ok := tx.Tx.(BucketMigrator)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't implement ethdb.TxMigrator interface", tx.Tx)
+	}
+	return migrator, nil
+}
+
+func (tx *compressedTx) DropBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.DropBucket(name)
+}
+
+func (tx *compressedTx) CreateBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.CreateBucket(name)
+}
+
+func (tx *compressedTx) ExistsBucket(name string) bool {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return false
+	}
+	return migrator.ExistsBucket(name)
+}
+
+func (tx *compressedTx) ClearBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.ClearBucket(name)
+}
+
+func (tx *compressedTx) ExistingBuckets() ([]string, error) {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.ExistingBuckets()
+}
+
+func (tx *compressedTx) BucketStat(name string) (*BucketStat, error) {
+	withStat, ok := tx.Tx.(HasBucketStat)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't describe buckets", tx.Tx)
+	}
+	return withStat.BucketStat(name)
+}
+
+func (c *compressedCursor) Prefix(v []byte) Cursor {
+	c.Cursor = c.Cursor.Prefix(v)
+	return c
+}
+
+func (c *compressedCursor) MatchBits(n uint) Cursor {
+	c.Cursor = c.Cursor.MatchBits(n)
+	return c
+}
+
+func (c *compressedCursor) Prefetch(v uint) Cursor {
+	c.Cursor = c.Cursor.Prefetch(v)
+	return c
+}
+
+func (c *compressedCursor) Range(start, end []byte) Cursor {
+	c.Cursor = c.Cursor.Range(start, end)
+	return c
+}
+
+func (c *compressedCursor) decode(k, v []byte, err error) ([]byte, []byte, error) {
+	if err != nil || k == nil {
+		return k, v, err
+	}
+	v, err = c.codec.Decode(v)
+	return k, v, err
+}
+
+func (c *compressedCursor) First() ([]byte, []byte, error) {
+	return c.decode(c.Cursor.First())
+}
+
+func (c *compressedCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	return c.decode(c.Cursor.Seek(seek))
+}
+
+func (c *compressedCursor) SeekExact(key []byte) ([]byte, error) {
+	v, err := c.Cursor.SeekExact(key)
+	if err != nil || v == nil {
+		return v, err
+	}
+	return c.codec.Decode(v)
+}
+
+func (c *compressedCursor) Next() ([]byte, []byte, error) {
+	return c.decode(c.Cursor.Next())
+}
+
+func (c *compressedCursor) Last() ([]byte, []byte, error) {
+	return c.decode(c.Cursor.Last())
+}
+
+func (c *compressedCursor) Walk(walker func(k, v []byte) (bool, error)) error {
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		ok, err := walker(k, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *compressedCursor) Put(key []byte, value []byte) error {
+	return c.Cursor.Put(key, c.codec.Encode(value))
+}
+
+func (c *compressedCursor) Append(key []byte, value []byte) error {
+	return c.Cursor.Append(key, c.codec.Encode(value))
+}
@@ -0,0 +1,97 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueCodec(t *testing.T) {
+	var samples [][]byte
+	for i := 0; i < 10; i++ {
+		samples = append(samples, append(bytes.Repeat([]byte{byte(i)}, 40), []byte("a segment common to all the samples")...))
+	}
+	dict := TrainDictionary(dbutils.CodeBucket, samples)
+	assert.True(t, bytes.HasPrefix(dict, dictSeeds[dbutils.CodeBucket]))
+	assert.Contains(t, string(dict), "a segment common")
+	assert.LessOrEqual(t, len(dict), maxDictSize)
+
+	codec := NewValueCodec(dict)
+	random := make([]byte, 1000)
+	_, err := rand.Read(random)
+	require.NoError(t, err)
+	for _, v := range [][]byte{{}, []byte("short"), random, append(samples[3], samples[3]...)} {
+		encoded := codec.Encode(v)
+		if len(v) >= minCompressedSize && v[0] != random[0] {
+			assert.Equal(t, valueDeflate, encoded[0])
+			assert.Less(t, len(encoded), len(v))
+		} else {
+			assert.Equal(t, valueRaw, encoded[0], "small or incompressible values are stored raw")
+		}
+		decoded, err := codec.Decode(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, v, decoded)
+	}
+	_, err = codec.Decode([]byte{7, 1})
+	assert.Error(t, err)
+}
+
+func TestCompressedKV(t *testing.T) {
+	ctx := context.Background()
+	kv := NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	unwrapped, err := WithCompression(kv)
+	require.NoError(t, err)
+	assert.Equal(t, kv, unwrapped, "without dictionary")
+
+	require.NoError(t, kv.Update(ctx, func(tx Tx) error {
+		return tx.Cursor(dbutils.DatabaseInfoBucket).Put([]byte(dbutils.CompressionDictPrefix+dbutils.CodeBucket), TrainDictionary(dbutils.CodeBucket, nil))
+	}))
+	compressed, err := WithCompression(kv)
+	require.NoError(t, err)
+	require.IsType(t, &CompressedKV{}, compressed)
+
+	code := bytes.Repeat([]byte{0x60, 0x80, 0x60, 0x40, 0x52}, 100)
+	other := dbutils.Buckets[0]
+	require.NoError(t, compressed.Update(ctx, func(tx Tx) error {
+		if err := tx.Cursor(dbutils.CodeBucket).Put([]byte{1}, code); err != nil {
+			return err
+		}
+		if err := tx.Cursor(dbutils.CodeBucket).Put([]byte{2}, []byte{2}); err != nil {
+			return err
+		}
+		return tx.Cursor(other).Put([]byte{1}, code)
+	}))
+
+	require.NoError(t, compressed.View(ctx, func(tx Tx) error {
+		v, err := tx.Get(dbutils.CodeBucket, []byte{1})
+		require.NoError(t, err)
+		assert.Equal(t, code, v)
+		values, err := tx.MultiGet(dbutils.CodeBucket, [][]byte{{1}, {2}, {3}})
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{code, {2}, nil}, values)
+		k, v, err := tx.Cursor(dbutils.CodeBucket).Last()
+		require.NoError(t, err)
+		assert.Equal(t, []byte{2}, k)
+		assert.Equal(t, []byte{2}, v)
+		v, err = tx.Get(other, []byte{1})
+		require.NoError(t, err)
+		assert.Equal(t, code, v)
+		return nil
+	}))
+	require.NoError(t, kv.View(ctx, func(tx Tx) error {
+		stored, err := tx.Get(dbutils.CodeBucket, []byte{1})
+		require.NoError(t, err)
+		assert.Equal(t, valueDeflate, stored[0])
+		assert.Less(t, len(stored), len(code)/10)
+		stored, err = tx.Get(other, []byte{1})
+		require.NoError(t, err)
+		assert.Equal(t, code, stored, "the other buckets aren't compressed")
+		return nil
+	}))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -207,6 +208,54 @@ func (db *LmdbKV) DiskSize(_ context.Context) (uint64, error) {
 	return uint64(stats.PSize) * (stats.LeafPages + stats.BranchPages + stats.OverflowPages), nil
 }
 
+// BackupTo writes a compacted copy of the environment, the data.mdb of a new one, into w.
+// LMDB copies in a read transaction of its own, so writers are not blocked. The copy is
+// streamed through a pipe, which is drained to the end even if ctx is cancelled or w fails:
+// LMDB can't be interrupted.
+func (db *LmdbKV) BackupTo(ctx context.Context, w io.Writer) error {
+	if db.env == nil {
+		return fmt.Errorf("db closed")
+	}
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	copied := make(chan error, 1)
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		err := db.env.CopyFDFlag(pw.Fd(), lmdb.CopyCompact)
+		pw.Close()
+		copied <- err
+	}()
+
+	var writeErr error
+	buf := make([]byte, 1024*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 && writeErr == nil {
+			if writeErr = ctx.Err(); writeErr == nil {
+				_, writeErr = w.Write(buf[:n])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if writeErr == nil {
+				writeErr = err
+			}
+			r.Close() // fails the copy
+			break
+		}
+	}
+	if err := <-copied; err != nil && writeErr == nil {
+		return fmt.Errorf("copy of the environment: %w", err)
+	}
+	return writeErr
+}
+
 func (db *LmdbKV) IdealBatchSize() int {
 	return int(512 * datasize.MB)
 }
@@ -260,6 +309,8 @@ type LmdbCursor struct {
 	dbi        lmdb.DBI
 	bucketCfg  *dbutils.BucketConfigItem
 	prefix     []byte
+	bits       uint // of the prefix matched, all if 0
+	bounds     keyRange
 
 	cursor *lmdb.Cursor
 }
@@ -475,8 +526,14 @@ func (c *LmdbCursor) Prefix(v []byte) Cursor {
 	return c
 }
 
+func (c *LmdbCursor) Range(start, end []byte) Cursor {
+	c.bounds = keyRange{start: start, end: end}
+	return c
+}
+
 func (c *LmdbCursor) MatchBits(n uint) Cursor {
-	panic("not implemented yet")
+	c.bits = n
+	return c
 }
 
 func (c *LmdbCursor) Prefetch(v uint) Cursor {
@@ -493,7 +550,7 @@ func (tx *lmdbTx) Get(bucket string, key []byte) ([]byte, error) {
 	dbi := tx.db.buckets[bucket]
 	cfg := dbutils.BucketsCfg[bucket]
 	if cfg.IsDupSort {
-		return tx.getDupSort(bucket, dbi, cfg, key)
+		return tx.getDupSort(tx.Cursor(bucket).(*LmdbCursor), dbi, cfg, key)
 	}
 
 	val, err := tx.get(dbi, key)
@@ -506,10 +563,32 @@ func (tx *lmdbTx) Get(bucket string, key []byte) ([]byte, error) {
 	return val, nil
 }
 
-func (tx *lmdbTx) getDupSort(bucket string, dbi lmdb.DBI, cfg *dbutils.BucketConfigItem, key []byte) ([]byte, error) {
+// MultiGet reads the keys of dupsort buckets with a single cursor.
+func (tx *lmdbTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	dbi := tx.db.buckets[bucket]
+	cfg := dbutils.BucketsCfg[bucket]
+	var c *LmdbCursor
+	if cfg.IsDupSort {
+		c = tx.Cursor(bucket).(*LmdbCursor)
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if c != nil {
+			values[i], err = tx.getDupSort(c, dbi, cfg, key)
+		} else if values[i], err = tx.get(dbi, key); lmdb.IsNotFound(err) {
+			values[i], err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (tx *lmdbTx) getDupSort(c *LmdbCursor, dbi lmdb.DBI, cfg *dbutils.BucketConfigItem, key []byte) ([]byte, error) {
 	from, to := cfg.DupFromLen, cfg.DupToLen
 	if len(key) == from {
-		c := tx.Cursor(bucket).(*LmdbCursor)
 		if err := c.initCursor(); err != nil {
 			return nil, err
 		}
@@ -544,6 +623,21 @@ func (tx *lmdbTx) BucketSize(name string) (uint64, error) {
 	return (st.LeafPages + st.BranchPages + st.OverflowPages) * uint64(os.Getpagesize()), nil
 }
 
+func (tx *lmdbTx) BucketStat(name string) (*BucketStat, error) {
+	st, err := tx.tx.Stat(tx.db.buckets[name])
+	if err != nil {
+		return nil, err
+	}
+	return &BucketStat{
+		Entries:       st.Entries,
+		Depth:         uint64(st.Depth),
+		BranchPages:   st.BranchPages,
+		LeafPages:     st.LeafPages,
+		OverflowPages: st.OverflowPages,
+		PageSize:      uint64(st.PSize),
+	}, nil
+}
+
 func (tx *lmdbTx) Cursor(bucket string) Cursor {
 	return &LmdbCursor{bucketName: bucket, ctx: tx.ctx, tx: tx, bucketCfg: dbutils.BucketsCfg[bucket], dbi: tx.db.buckets[bucket]}
 }
@@ -575,7 +669,7 @@ func (c *LmdbCursor) First() ([]byte, []byte, error) {
 		}
 	}
 
-	return c.Seek(c.prefix)
+	return c.Seek(c.bounds.first(prefixBits(c.prefix, c.bits)))
 }
 
 func (c *LmdbCursor) Last() ([]byte, []byte, error) {
@@ -585,8 +679,8 @@ func (c *LmdbCursor) Last() ([]byte, []byte, error) {
 		}
 	}
 
-	if c.prefix != nil {
-		return []byte{}, nil, fmt.Errorf(".Last doesn't support c.prefix yet")
+	if c.prefix != nil || c.bounds.end != nil {
+		return []byte{}, nil, fmt.Errorf(".Last doesn't support c.prefix and ranges yet")
 	}
 
 	k, v, err := c.last()
@@ -638,7 +732,7 @@ func (c *LmdbCursor) Seek(seek []byte) (k, v []byte, err error) {
 		err = fmt.Errorf("failed LmdbKV cursor.Seek(): %w, bucket: %s,  key: %x", err, c.bucketName, seek)
 		return []byte{}, nil, err
 	}
-	if c.prefix != nil && !bytes.HasPrefix(k, c.prefix) {
+	if !hasPrefixBits(k, c.prefix, c.bits) || c.bounds.past(k) {
 		k, v = nil, nil
 	}
 
@@ -656,7 +750,7 @@ func (c *LmdbCursor) seekDupSort(seek []byte) (k, v []byte, err error) {
 			}
 			return []byte{}, nil, err
 		}
-		if c.prefix != nil && !bytes.HasPrefix(k, c.prefix) {
+		if !hasPrefixBits(k, c.prefix, c.bits) || c.bounds.past(k) {
 			k, v = nil, nil
 		}
 		return k, v, nil
@@ -699,7 +793,7 @@ func (c *LmdbCursor) seekDupSort(seek []byte) (k, v []byte, err error) {
 		k = k2
 	}
 
-	if c.prefix != nil && !bytes.HasPrefix(k, c.prefix) {
+	if !hasPrefixBits(k, c.prefix, c.bits) || c.bounds.past(k) {
 		k, v = nil, nil
 	}
 	return k, v, nil
@@ -729,7 +823,7 @@ func (c *LmdbCursor) Next() (k, v []byte, err error) {
 		}
 		return []byte{}, nil, fmt.Errorf("failed LmdbKV cursor.Next(): %w", err)
 	}
-	if c.prefix != nil && !bytes.HasPrefix(k, c.prefix) {
+	if !hasPrefixBits(k, c.prefix, c.bits) || c.bounds.past(k) {
 		k, v = nil, nil
 	}
 
@@ -756,7 +850,7 @@ func (c *LmdbCursor) nextDupSort() (k, v []byte, err error) {
 		v = v[from-to:]
 	}
 
-	if c.prefix != nil && !bytes.HasPrefix(k, c.prefix) {
+	if !hasPrefixBits(k, c.prefix, c.bits) || c.bounds.past(k) {
 		k, v = nil, nil
 	}
 	return k, v, nil
@@ -1097,7 +1191,7 @@ func (c *lmdbNoValuesCursor) Walk(walker func(k []byte, vSize uint32) (bool, err
 }
 
 func (c *lmdbNoValuesCursor) First() (k []byte, v uint32, err error) {
-	return c.Seek(c.prefix)
+	return c.Seek(c.bounds.first(prefixBits(c.prefix, c.bits)))
 }
 
 func (c *lmdbNoValuesCursor) Seek(seek []byte) (k []byte, vSize uint32, err error) {
@@ -0,0 +1,477 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/hexutil"
+)
+
+// MemKV is a KV kept in sorted slices on the heap, without files, for tests. The buckets are
+// copied on the first write of a transaction, so the read transactions see the snapshot they
+// began at and the writes are only visible once committed. There is one write transaction at
+// a time. DupSort buckets are plain buckets, the keys and values are the same as of LMDB.
+type MemKV struct {
+	mu      sync.RWMutex // guards buckets
+	writeMu sync.Mutex   // held by the write transaction
+	wg      sync.WaitGroup
+	buckets map[string][]memPair
+	closed  bool
+}
+
+type memPair struct {
+	k, v []byte
+}
+
+type memTx struct {
+	ctx      context.Context
+	db       *MemKV
+	parent   *memTx
+	writable bool
+	done     bool
+	buckets  map[string][]memPair
+	owned    map[string]bool // buckets already copied by this transaction
+}
+
+type memCursor struct {
+	ctx    context.Context
+	tx     *memTx
+	bucket string
+	prefix []byte
+	bits   uint // of the prefix matched, all if 0
+	bounds keyRange
+	key    []byte // of the current position, nil after the last one
+	moved  bool   // by First or Seek
+}
+
+type noValuesMemCursor struct {
+	*memCursor
+}
+
+// NewMemKV returns an empty MemKV with all the dbutils.Buckets.
+func NewMemKV() *MemKV {
+	db := &MemKV{buckets: make(map[string][]memPair, len(dbutils.Buckets))}
+	for _, name := range dbutils.Buckets {
+		db.buckets[name] = nil
+	}
+	return db
+}
+
+// Close closes MemKV after the transactions, the data is dropped.
+func (db *MemKV) Close() {
+	db.wg.Wait()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closed = true
+	db.buckets = nil
+}
+
+func (db *MemKV) IdealBatchSize() int {
+	return 1024 * 1024
+}
+
+func (db *MemKV) Begin(ctx context.Context, parent Tx, writable bool) (Tx, error) {
+	if parent != nil {
+		p, ok := parent.(*memTx)
+		if !ok {
+			return nil, fmt.Errorf("parent %T of a transaction of MemKV", parent)
+		}
+		if writable && !p.writable {
+			return nil, fmt.Errorf("writable transaction in a read-only one")
+		}
+		return &memTx{ctx: ctx, db: db, parent: p, writable: writable, buckets: copyBuckets(p.buckets), owned: map[string]bool{}}, nil
+	}
+	if writable {
+		db.writeMu.Lock()
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		if writable {
+			db.writeMu.Unlock()
+		}
+		return nil, fmt.Errorf("db closed")
+	}
+	db.wg.Add(1)
+	return &memTx{ctx: ctx, db: db, writable: writable, buckets: copyBuckets(db.buckets), owned: map[string]bool{}}, nil
+}
+
+func (db *MemKV) View(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *MemKV) Update(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func copyBuckets(buckets map[string][]memPair) map[string][]memPair {
+	c := make(map[string][]memPair, len(buckets))
+	for name, pairs := range buckets {
+		c[name] = pairs
+	}
+	return c
+}
+
+func (tx *memTx) Commit(ctx context.Context) error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	if tx.parent == nil {
+		defer tx.db.wg.Done()
+	}
+	if !tx.writable {
+		return nil
+	}
+	if tx.parent != nil {
+		tx.parent.buckets = tx.buckets
+		for name := range tx.owned {
+			tx.parent.owned[name] = true
+		}
+		return nil
+	}
+	defer tx.db.writeMu.Unlock()
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	tx.db.buckets = tx.buckets
+	return nil
+}
+
+func (tx *memTx) Rollback() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	if tx.parent != nil {
+		return
+	}
+	if tx.writable {
+		tx.db.writeMu.Unlock()
+	}
+	tx.db.wg.Done()
+}
+
+// search returns the position of the first key of the bucket at or after key.
+func (tx *memTx) search(bucket string, key []byte) int {
+	pairs := tx.buckets[bucket]
+	return sort.Search(len(pairs), func(i int) bool { return bytes.Compare(pairs[i].k, key) >= 0 })
+}
+
+func (tx *memTx) Get(bucket string, key []byte) ([]byte, error) {
+	select {
+	case <-tx.ctx.Done():
+		return nil, tx.ctx.Err()
+	default:
+	}
+	pairs := tx.buckets[bucket]
+	if i := tx.search(bucket, key); i < len(pairs) && bytes.Equal(pairs[i].k, key) {
+		return pairs[i].v, nil
+	}
+	return nil, nil
+}
+
+func (tx *memTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if values[i], err = tx.Get(bucket, key); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// writableBucket returns the pairs of the bucket, copied if they are shared with other transactions.
+func (tx *memTx) writableBucket(bucket string) ([]memPair, error) {
+	if !tx.writable {
+		return nil, fmt.Errorf("write in a read-only transaction, bucket: %s", bucket)
+	}
+	pairs, ok := tx.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w, bucket: %s", ErrUnknownBucket, bucket)
+	}
+	if !tx.owned[bucket] {
+		pairs = append(make([]memPair, 0, len(pairs)+1), pairs...)
+		tx.buckets[bucket] = pairs
+		tx.owned[bucket] = true
+	}
+	return pairs, nil
+}
+
+func (tx *memTx) put(bucket string, key, value []byte) error {
+	pairs, err := tx.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	pair := memPair{k: append([]byte{}, key...), v: append([]byte{}, value...)}
+	i := tx.search(bucket, key)
+	if i < len(pairs) && bytes.Equal(pairs[i].k, key) {
+		pairs[i] = pair
+		return nil
+	}
+	pairs = append(pairs, memPair{})
+	copy(pairs[i+1:], pairs[i:])
+	pairs[i] = pair
+	tx.buckets[bucket] = pairs
+	return nil
+}
+
+func (tx *memTx) delete(bucket string, key []byte) error {
+	pairs, err := tx.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	i := tx.search(bucket, key)
+	if i < len(pairs) && bytes.Equal(pairs[i].k, key) {
+		tx.buckets[bucket] = append(pairs[:i], pairs[i+1:]...)
+	}
+	return nil
+}
+
+func (tx *memTx) BucketSize(name string) (uint64, error) {
+	var size uint64
+	for _, pair := range tx.buckets[name] {
+		size += uint64(len(pair.k) + len(pair.v))
+	}
+	return size, nil
+}
+
+func (tx *memTx) CreateBucket(name string) error {
+	if _, ok := tx.buckets[name]; !ok {
+		tx.buckets[name] = nil
+		tx.owned[name] = true
+	}
+	return nil
+}
+
+func (tx *memTx) DropBucket(name string) error {
+	for i := range dbutils.Buckets {
+		if dbutils.Buckets[i] == name {
+			return fmt.Errorf("%w, bucket: %s", ErrAttemptToDeleteNonDeprecatedBucket, name)
+		}
+	}
+	delete(tx.buckets, name)
+	delete(tx.owned, name)
+	return nil
+}
+
+func (tx *memTx) ExistsBucket(name string) bool {
+	_, ok := tx.buckets[name]
+	return ok
+}
+
+func (tx *memTx) ClearBucket(name string) error {
+	if _, ok := tx.buckets[name]; !ok {
+		return nil
+	}
+	tx.buckets[name] = nil
+	tx.owned[name] = true
+	return nil
+}
+
+func (tx *memTx) ExistingBuckets() ([]string, error) {
+	names := make([]string, 0, len(tx.buckets))
+	for name := range tx.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (tx *memTx) Cursor(bucket string) Cursor {
+	return &memCursor{ctx: tx.ctx, tx: tx, bucket: bucket}
+}
+
+func (c *memCursor) Prefix(v []byte) Cursor {
+	c.prefix = v
+	return c
+}
+
+func (c *memCursor) Range(start, end []byte) Cursor {
+	c.bounds = keyRange{start: start, end: end}
+	return c
+}
+
+func (c *memCursor) MatchBits(n uint) Cursor {
+	c.bits = n
+	return c
+}
+
+func (c *memCursor) Prefetch(v uint) Cursor {
+	// nothing to do
+	return c
+}
+
+func (c *memCursor) NoValues() NoValuesCursor {
+	return &noValuesMemCursor{memCursor: c}
+}
+
+// at positions the cursor at the i-th pair of the bucket, if it is within the prefix and the range.
+func (c *memCursor) at(i int) ([]byte, []byte, error) {
+	c.moved = true
+	pairs := c.tx.buckets[c.bucket]
+	if i < 0 || i >= len(pairs) {
+		c.key = nil
+		return nil, nil, nil
+	}
+	c.key = pairs[i].k
+	if !hasPrefixBits(c.key, c.prefix, c.bits) || c.bounds.past(c.key) {
+		return nil, nil, nil
+	}
+	return pairs[i].k, pairs[i].v, nil
+}
+
+func (c *memCursor) First() ([]byte, []byte, error) {
+	return c.at(c.tx.search(c.bucket, c.bounds.first(prefixBits(c.prefix, c.bits))))
+}
+
+func (c *memCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	select {
+	case <-c.ctx.Done():
+		return []byte{}, nil, c.ctx.Err()
+	default:
+	}
+	return c.at(c.tx.search(c.bucket, seek))
+}
+
+func (c *memCursor) SeekExact(key []byte) ([]byte, error) {
+	return c.tx.Get(c.bucket, key)
+}
+
+func (c *memCursor) Next() ([]byte, []byte, error) {
+	select {
+	case <-c.ctx.Done():
+		return []byte{}, nil, c.ctx.Err()
+	default:
+	}
+	if !c.moved {
+		return c.First()
+	}
+	if c.key == nil {
+		return nil, nil, nil
+	}
+	// the key may be deleted or other keys inserted since, the next one is searched again
+	i := c.tx.search(c.bucket, c.key)
+	if pairs := c.tx.buckets[c.bucket]; i < len(pairs) && bytes.Equal(pairs[i].k, c.key) {
+		i++
+	}
+	return c.at(i)
+}
+
+func (c *memCursor) Last() ([]byte, []byte, error) {
+	if c.prefix != nil || c.bounds.end != nil {
+		return []byte{}, nil, fmt.Errorf(".Last doesn't support c.prefix and ranges yet")
+	}
+	return c.at(len(c.tx.buckets[c.bucket]) - 1)
+}
+
+func (c *memCursor) Put(key []byte, value []byte) error {
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	default:
+	}
+	return c.tx.put(c.bucket, key, value)
+}
+
+func (c *memCursor) Append(key []byte, value []byte) error {
+	return c.Put(key, value)
+}
+
+func (c *memCursor) Delete(key []byte) error {
+	select {
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	default:
+	}
+	return c.tx.delete(c.bucket, key)
+}
+
+func (c *memCursor) Walk(walker func(k, v []byte) (bool, error)) error {
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		ok, err := walker(k, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *noValuesMemCursor) First() ([]byte, uint32, error) {
+	k, v, err := c.memCursor.First()
+	return k, uint32(len(v)), err
+}
+
+func (c *noValuesMemCursor) Seek(seek []byte) ([]byte, uint32, error) {
+	k, v, err := c.memCursor.Seek(seek)
+	return k, uint32(len(v)), err
+}
+
+func (c *noValuesMemCursor) Next() ([]byte, uint32, error) {
+	k, v, err := c.memCursor.Next()
+	return k, uint32(len(v)), err
+}
+
+func (c *noValuesMemCursor) Walk(walker func(k []byte, vSize uint32) (bool, error)) error {
+	return c.memCursor.Walk(func(k, v []byte) (bool, error) {
+		return walker(k, uint32(len(v)))
+	})
+}
+
+// LoadFixture puts into db the pairs of the JSON object read from r, of the buckets to their
+// keys to values, both hex with the 0x prefix:
+//
+//	{"PLAIN-CST": {"0x01...": "0x02..."}, "h": {...}}
+func LoadFixture(db KV, r io.Reader) error {
+	var fixture map[string]map[string]string
+	if err := json.NewDecoder(r).Decode(&fixture); err != nil {
+		return err
+	}
+	return db.Update(context.Background(), func(tx Tx) error {
+		for bucket, pairs := range fixture {
+			if _, ok := dbutils.BucketsCfg[bucket]; !ok {
+				return fmt.Errorf("%w, bucket: %s", ErrUnknownBucket, bucket)
+			}
+			c := tx.Cursor(bucket)
+			for k, v := range pairs {
+				key, err := hexutil.Decode(k)
+				if err != nil {
+					return fmt.Errorf("key %s of bucket %s: %w", k, bucket, err)
+				}
+				value, err := hexutil.Decode(v)
+				if err != nil {
+					return fmt.Errorf("value of key %s of bucket %s: %w", k, bucket, err)
+				}
+				if err = c.Put(key, value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,70 @@
+package ethdb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemKV(t *testing.T) {
+	ctx := context.Background()
+	kv := NewMemKV()
+	defer kv.Close()
+	bucket := dbutils.Buckets[0]
+
+	require.NoError(t, LoadFixture(kv, strings.NewReader(`{"`+bucket+`": {"0x01": "0x0a", "0x03": "0x0c"}}`)))
+	assert.Error(t, LoadFixture(kv, strings.NewReader(`{"unknown": {"0x01": "0x0a"}}`)))
+	assert.Error(t, LoadFixture(kv, strings.NewReader(`{"`+bucket+`": {"01": "0x0a"}}`)))
+
+	read, err := kv.Begin(ctx, nil, false)
+	require.NoError(t, err)
+	defer read.Rollback()
+
+	write, err := kv.Begin(ctx, nil, true)
+	require.NoError(t, err)
+	c := write.Cursor(bucket)
+	require.NoError(t, c.Put([]byte{2}, []byte{11}))
+	require.NoError(t, c.Delete([]byte{3}))
+	// the keys after the position are read again after the writes
+	k, _, err := c.First()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1}, k)
+	require.NoError(t, c.Put([]byte{1, 0}, []byte{10}))
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 0}, k)
+
+	sub, err := kv.Begin(ctx, write, true)
+	require.NoError(t, err)
+	require.NoError(t, sub.Cursor(bucket).Put([]byte{4}, []byte{13}))
+	sub.Rollback()
+	sub, err = kv.Begin(ctx, write, true)
+	require.NoError(t, err)
+	require.NoError(t, sub.Cursor(bucket).Put([]byte{5}, []byte{14}))
+	require.NoError(t, sub.Commit(ctx))
+	require.NoError(t, write.Commit(ctx))
+
+	keys := func(tx Tx) (keys []string) {
+		require.NoError(t, tx.Cursor(bucket).Walk(func(k, v []byte) (bool, error) {
+			keys = append(keys, string(k))
+			return true, nil
+		}))
+		return keys
+	}
+	assert.Equal(t, []string{"\x01", "\x03"}, keys(read), "snapshot of the read transaction")
+	require.NoError(t, kv.View(ctx, func(tx Tx) error {
+		assert.Equal(t, []string{"\x01", "\x01\x00", "\x02", "\x05"}, keys(tx))
+		assert.Error(t, tx.Cursor(bucket).Put([]byte{6}, nil), "write in a read-only transaction")
+		var matched []string
+		require.NoError(t, tx.Cursor(bucket).Prefix([]byte{3, 0xff}).MatchBits(6).Walk(func(k, v []byte) (bool, error) {
+			matched = append(matched, string(k))
+			return true, nil
+		}))
+		assert.Equal(t, []string{"\x01", "\x01\x00", "\x02"}, matched, "keys with the first 6 bits of 0x03")
+		return nil
+	}))
+}
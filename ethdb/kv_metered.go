@@ -0,0 +1,333 @@
+package ethdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/metrics"
+)
+
+var dbKVCommitTimer = metrics.NewRegisteredTimer("db/kv/commit", nil)
+
+// MeteredKV measures the operations of the transactions of a KV by bucket, in the timers
+// db/kv/<bucket>/get, seek, next, put and delete, which count them and give their latencies,
+// and db/kv/commit. First is a seek, MultiGet a get and Append a put. The timers are nil
+// unless metrics are enabled.
+type MeteredKV struct {
+	KV
+	timers map[string]*bucketTimers // of dbutils.Buckets, read-only
+}
+
+type meteredTx struct {
+	Tx
+	db *MeteredKV
+}
+
+type meteredCursor struct {
+	Cursor
+	timers *bucketTimers
+}
+
+type meteredNoValuesCursor struct {
+	NoValuesCursor
+	timers *bucketTimers
+}
+
+type bucketTimers struct {
+	get, seek, next, put, delete metrics.Timer
+}
+
+var (
+	bucketTimersLock sync.Mutex
+	bucketTimersMap  = map[string]*bucketTimers{}
+)
+
+func timersOf(bucket string) *bucketTimers {
+	bucketTimersLock.Lock()
+	defer bucketTimersLock.Unlock()
+	if t, ok := bucketTimersMap[bucket]; ok {
+		return t
+	}
+	// bucket names like PLAIN-CST2 are not valid in Prometheus names
+	name := "db/kv/" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, bucket) + "/"
+	t := &bucketTimers{
+		get:    metrics.GetOrRegisterTimer(name+"get", nil),
+		seek:   metrics.GetOrRegisterTimer(name+"seek", nil),
+		next:   metrics.GetOrRegisterTimer(name+"next", nil),
+		put:    metrics.GetOrRegisterTimer(name+"put", nil),
+		delete: metrics.GetOrRegisterTimer(name+"delete", nil),
+	}
+	bucketTimersMap[bucket] = t
+	return t
+}
+
+// NewMeteredKV measures the operations of kv, see MeteredKV.
+func NewMeteredKV(kv KV) *MeteredKV {
+	db := &MeteredKV{KV: kv, timers: make(map[string]*bucketTimers, len(dbutils.Buckets))}
+	for _, name := range dbutils.Buckets {
+		db.timers[name] = timersOf(name)
+	}
+	return db
+}
+
+func (db *MeteredKV) timersOf(bucket string) *bucketTimers {
+	if t, ok := db.timers[bucket]; ok {
+		return t
+	}
+	return timersOf(bucket)
+}
+
+func (db *MeteredKV) Begin(ctx context.Context, parent Tx, writable bool) (Tx, error) {
+	if metered, ok := parent.(*meteredTx); ok {
+		parent = metered.Tx
+	}
+	tx, err := db.KV.Begin(ctx, parent, writable)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredTx{Tx: tx, db: db}, nil
+}
+
+func (db *MeteredKV) View(ctx context.Context, f func(tx Tx) error) error {
+	return db.KV.View(ctx, func(tx Tx) error {
+		return f(&meteredTx{Tx: tx, db: db})
+	})
+}
+
+// Update is Begin and Commit, for the commit to be measured.
+func (db *MeteredKV) Update(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *MeteredKV) DiskSize(ctx context.Context) (uint64, error) {
+	if stats, ok := db.KV.(HasStats); ok {
+		return stats.DiskSize(ctx)
+	}
+	return 0, nil
+}
+
+func (db *MeteredKV) BackupTo(ctx context.Context, w io.Writer) error {
+	if backuper, ok := db.KV.(HasBackup); ok {
+		return backuper.BackupTo(ctx, w)
+	}
+	return fmt.Errorf("%T doesn't support hot backups", db.KV)
+}
+
+func (db *MeteredKV) Connectivity() (bool, string) {
+	if remote, ok := db.KV.(HasConnectivity); ok {
+		return remote.Connectivity()
+	}
+	return true, ""
+}
+
+func (db *MeteredKV) Watch(ctx context.Context, bucket string, prefix []byte) (<-chan []Change, error) {
+	if watched, ok := db.KV.(HasWatch); ok {
+		return watched.Watch(ctx, bucket, prefix)
+	}
+	return nil, fmt.Errorf("%T doesn't notify changes", db.KV)
+}
+
+func (tx *meteredTx) Cursor(bucket string) Cursor {
+	return &meteredCursor{Cursor: tx.Tx.Cursor(bucket), timers: tx.db.timersOf(bucket)}
+}
+
+func (tx *meteredTx) Get(bucket string, key []byte) ([]byte, error) {
+	defer tx.db.timersOf(bucket).get.UpdateSince(time.Now())
+	return tx.Tx.Get(bucket, key)
+}
+
+func (tx *meteredTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	defer tx.db.timersOf(bucket).get.UpdateSince(time.Now())
+	return tx.Tx.MultiGet(bucket, keys)
+}
+
+func (tx *meteredTx) Commit(ctx context.Context) error {
+	defer dbKVCommitTimer.UpdateSince(time.Now())
+	return tx.Tx.Commit(ctx)
+}
+
+func (tx *meteredTx) migrator() (BucketMigrator, error) {
+	migrator, ok := tx.Tx.(BucketMigrator)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't implement ethdb.TxMigrator interface", tx.Tx)
+	}
+	return migrator, nil
+}
+
+func (tx *meteredTx) DropBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.DropBucket(name)
+}
+
+func (tx *meteredTx) CreateBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.CreateBucket(name)
+}
+
+func (tx *meteredTx) ExistsBucket(name string) bool {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return false
+	}
+	return migrator.ExistsBucket(name)
+}
+
+func (tx *meteredTx) ClearBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.ClearBucket(name)
+}
+
+func (tx *meteredTx) ExistingBuckets() ([]string, error) {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.ExistingBuckets()
+}
+
+func (tx *meteredTx) BucketStat(name string) (*BucketStat, error) {
+	withStat, ok := tx.Tx.(HasBucketStat)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't describe buckets", tx.Tx)
+	}
+	return withStat.BucketStat(name)
+}
+
+func (c *meteredCursor) Prefix(v []byte) Cursor {
+	c.Cursor = c.Cursor.Prefix(v)
+	return c
+}
+
+func (c *meteredCursor) MatchBits(n uint) Cursor {
+	c.Cursor = c.Cursor.MatchBits(n)
+	return c
+}
+
+func (c *meteredCursor) Prefetch(v uint) Cursor {
+	c.Cursor = c.Cursor.Prefetch(v)
+	return c
+}
+
+func (c *meteredCursor) Range(start, end []byte) Cursor {
+	c.Cursor = c.Cursor.Range(start, end)
+	return c
+}
+
+func (c *meteredCursor) NoValues() NoValuesCursor {
+	return &meteredNoValuesCursor{NoValuesCursor: c.Cursor.NoValues(), timers: c.timers}
+}
+
+func (c *meteredCursor) First() ([]byte, []byte, error) {
+	defer c.timers.seek.UpdateSince(time.Now())
+	return c.Cursor.First()
+}
+
+func (c *meteredCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	defer c.timers.seek.UpdateSince(time.Now())
+	return c.Cursor.Seek(seek)
+}
+
+func (c *meteredCursor) SeekExact(key []byte) ([]byte, error) {
+	defer c.timers.get.UpdateSince(time.Now())
+	return c.Cursor.SeekExact(key)
+}
+
+func (c *meteredCursor) Next() ([]byte, []byte, error) {
+	defer c.timers.next.UpdateSince(time.Now())
+	return c.Cursor.Next()
+}
+
+func (c *meteredCursor) Last() ([]byte, []byte, error) {
+	defer c.timers.seek.UpdateSince(time.Now())
+	return c.Cursor.Last()
+}
+
+func (c *meteredCursor) Put(key []byte, value []byte) error {
+	defer c.timers.put.UpdateSince(time.Now())
+	return c.Cursor.Put(key, value)
+}
+
+func (c *meteredCursor) Append(key []byte, value []byte) error {
+	defer c.timers.put.UpdateSince(time.Now())
+	return c.Cursor.Append(key, value)
+}
+
+func (c *meteredCursor) Delete(key []byte) error {
+	defer c.timers.delete.UpdateSince(time.Now())
+	return c.Cursor.Delete(key)
+}
+
+// Walk iterates with First and Next, for them to be measured.
+func (c *meteredCursor) Walk(walker func(k, v []byte) (bool, error)) error {
+	for k, v, err := c.First(); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		ok, err := walker(k, v)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (c *meteredNoValuesCursor) First() ([]byte, uint32, error) {
+	defer c.timers.seek.UpdateSince(time.Now())
+	return c.NoValuesCursor.First()
+}
+
+func (c *meteredNoValuesCursor) Seek(seek []byte) ([]byte, uint32, error) {
+	defer c.timers.seek.UpdateSince(time.Now())
+	return c.NoValuesCursor.Seek(seek)
+}
+
+func (c *meteredNoValuesCursor) Next() ([]byte, uint32, error) {
+	defer c.timers.next.UpdateSince(time.Now())
+	return c.NoValuesCursor.Next()
+}
+
+func (c *meteredNoValuesCursor) Walk(walker func(k []byte, vSize uint32) (bool, error)) error {
+	for k, vSize, err := c.First(); k != nil; k, vSize, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		ok, err := walker(k, vSize)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+	return nil
+}
@@ -3,15 +3,28 @@ package ethdb
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
 	"github.com/ledgerwatch/turbo-geth/log"
+	"github.com/ledgerwatch/turbo-geth/metrics"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -25,23 +38,55 @@ import (
 //go:generate protoc --go-grpc_out=. "./remote/db.proto"
 //go:generate protoc --go-grpc_out=. "./remote/ethbackend.proto"
 
+var (
+	remoteSeekTimer = metrics.NewRegisteredTimer("db/remote/seek", nil)    // opening a stream and reading the first pair
+	remoteNextTimer = metrics.NewRegisteredTimer("db/remote/next", nil)    // reading a pair which was not streamed, or the first streamed batch
+	remoteRetries   = metrics.NewRegisteredCounter("db/remote/retry", nil) // reads retried as the server was unavailable
+)
+
+const (
+	remoteRetryBaseDelay       = 100 * time.Millisecond
+	defaultRemoteRetryMaxDelay = 5 * time.Second
+	defaultRemoteRetryTimeout  = 30 * time.Second
+)
+
 type remoteOpts struct {
 	DialAddress string
+	tlsCACert   string
+	tlsCert     string
+	tlsKey      string
+	token       string
+	writeToken  string
+	compression string
+	conns       int
+	retryDelay  time.Duration // max
+	retryFor    time.Duration
 	inMemConn   *bufconn.Listener // for tests
 }
 
 type RemoteKV struct {
-	opts     remoteOpts
+	opts  remoteOpts
+	conns []*remoteConn
+	next  uint32 // round robin of the conns
+	log   log.Logger
+
+	noSeekBatch int32  // set once the server turned out to predate SeekBatch
+	noMultiGet  int32  // set once the server turned out to predate MultiGet
+	compression string // of the calls, as negotiated on open
+}
+
+type remoteConn struct {
+	conn     *grpc.ClientConn
 	remoteKV remote.KVClient
 	remoteDB remote.DBClient
-	conn     *grpc.ClientConn
-	log      log.Logger
 }
 
 type remoteTx struct {
-	ctx     context.Context
-	db      *RemoteKV
-	cursors []*remoteCursor
+	ctx       context.Context
+	db        *RemoteKV
+	cursors   []*remoteCursor
+	writable  bool
+	mutations []*remote.Mutation // sent on commit
 }
 
 type remoteCursor struct {
@@ -50,7 +95,11 @@ type remoteCursor struct {
 	prefetch           uint32
 	ctx                context.Context
 	prefix             []byte
+	bounds             keyRange
 	stream             remote.KV_SeekClient
+	batchStream        remote.KV_SeekBatchClient // instead of stream for prefetching cursors
+	batch              []*remote.Pair            // read ahead of the cursor
+	key                []byte                    // last returned, where the cursor resumes if the stream breaks
 	tx                 *remoteTx
 	bucketName         string
 }
@@ -75,15 +124,95 @@ func (opts remoteOpts) Path(path string) remoteOpts {
 	return opts
 }
 
+// TLS connects over TLS, verifying the server with the CA certificates of the PEM file caCert,
+// or the system ones if empty, and presenting the client certificate cert and its key if set.
+// It is used if caCert or cert is set.
+func (opts remoteOpts) TLS(caCert, cert, key string) remoteOpts {
+	opts.tlsCACert, opts.tlsCert, opts.tlsKey = caCert, cert, key
+	return opts
+}
+
+// Token is sent with every call, it must be the --private.api.token of the node.
+func (opts remoteOpts) Token(token string) remoteOpts {
+	opts.token = token
+	return opts
+}
+
+// WriteToken is sent to the server to write, it must be the --private.api.writetoken of the node.
+func (opts remoteOpts) WriteToken(token string) remoteOpts {
+	opts.writeToken = token
+	return opts
+}
+
+// Compression compresses the calls, and the replies, with remote.Snappy or remote.Gzip. It is
+// negotiated when opening: calls are not compressed if the server does not have the compressor
+// or can not be reached.
+func (opts remoteOpts) Compression(name string) remoteOpts {
+	opts.compression = name
+	return opts
+}
+
+// Conns opens n connections to the server, the calls are spread over those connected.
+func (opts remoteOpts) Conns(n int) remoteOpts {
+	opts.conns = n
+	return opts
+}
+
+// Retry retries the reads failing as the server is unavailable, like when it restarts, for up
+// to timeout, 0 not to retry, with delays doubling up to maxDelay. The connections are
+// reestablished with the same delays. Writes are not retried. By default the reads are
+// retried for 30s with delays up to 5s.
+func (opts remoteOpts) Retry(maxDelay, timeout time.Duration) remoteOpts {
+	opts.retryDelay, opts.retryFor = maxDelay, timeout
+	return opts
+}
+
 func (opts remoteOpts) InMem(listener *bufconn.Listener) remoteOpts {
 	opts.inMemConn = listener
 	return opts
 }
 
 func (opts remoteOpts) Open() (KV, Backend, error) {
+	if opts.conns < 1 {
+		opts.conns = 1
+	}
+	if opts.retryDelay < remoteRetryBaseDelay {
+		opts.retryDelay = remoteRetryBaseDelay
+	}
+	connectBackoff := backoff.DefaultConfig
+	connectBackoff.BaseDelay = remoteRetryBaseDelay
+	connectBackoff.MaxDelay = opts.retryDelay
 	var dialOpts = []grpc.DialOption{
-		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.DefaultConfig}),
-		grpc.WithInsecure(),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: connectBackoff, MinConnectTimeout: 5 * time.Second}),
+	}
+	if opts.tlsCACert != "" || opts.tlsCert != "" {
+		tlsConfig, err := opts.tlsConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+	if opts.token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(tokenCredentials(opts.token)))
+	}
+	db := &RemoteKV{
+		opts: opts,
+		log:  log.New("remote_db", opts.DialAddress),
+	}
+	if opts.compression != "" {
+		if encoding.GetCompressor(opts.compression) == nil {
+			return nil, nil, fmt.Errorf("unknown compression %q, use %s or %s", opts.compression, remote.Snappy, remote.Gzip)
+		}
+		dialOpts = append(dialOpts,
+			grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+				return invoker(ctx, method, req, reply, cc, db.compress(callOpts)...)
+			}),
+			grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return streamer(ctx, desc, cc, method, db.compress(callOpts)...)
+			}),
+		)
 	}
 
 	if opts.inMemConn != nil {
@@ -95,29 +224,83 @@ func (opts remoteOpts) Open() (KV, Backend, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	conn, err := grpc.DialContext(ctx, opts.DialAddress, dialOpts...)
-	if err != nil {
-		return nil, nil, err
+	for i := 0; i < opts.conns; i++ {
+		conn, err := grpc.DialContext(ctx, opts.DialAddress, dialOpts...)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		db.conns = append(db.conns, &remoteConn{conn: conn, remoteKV: remote.NewKVClient(conn), remoteDB: remote.NewDBClient(conn)})
 	}
-
-	db := &RemoteKV{
-		opts:     opts,
-		conn:     conn,
-		remoteKV: remote.NewKVClient(conn),
-		remoteDB: remote.NewDBClient(conn),
-		log:      log.New("remote_db", opts.DialAddress),
+	if opts.compression != "" {
+		db.negotiateCompression(ctx)
 	}
 
 	eth := &RemoteBackend{
 		opts:             opts,
-		remoteEthBackend: remote.NewETHBACKENDClient(conn),
-		conn:             conn,
+		remoteEthBackend: remote.NewETHBACKENDClient(db.conns[0].conn),
+		conn:             db.conns[0].conn,
 		log:              log.New("remote_db", opts.DialAddress),
 	}
 
 	return db, eth, nil
 }
 
+// negotiateCompression compresses the calls if a compressed call succeeds, the server fails
+// those with a compressor it does not have.
+func (db *RemoteKV) negotiateCompression(ctx context.Context) {
+	_, err := db.conns[0].remoteDB.Size(ctx, &remote.SizeRequest{}, grpc.UseCompressor(db.opts.compression))
+	switch {
+	case err == nil:
+		db.compression = db.opts.compression
+	case status.Code(err) == codes.Unimplemented:
+		db.log.Warn("The server does not support the compression, calls are not compressed", "compression", db.opts.compression)
+	default:
+		db.log.Warn("Could not negotiate the compression, calls are not compressed", "compression", db.opts.compression, "err", err)
+	}
+}
+
+func (db *RemoteKV) compress(callOpts []grpc.CallOption) []grpc.CallOption {
+	if db.compression == "" {
+		return callOpts
+	}
+	return append(callOpts, grpc.UseCompressor(db.compression))
+}
+
+func (opts remoteOpts) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.tlsCACert != "" {
+		pem, err := ioutil.ReadFile(opts.tlsCACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", opts.tlsCACert)
+		}
+	}
+	if opts.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(opts.tlsCert, opts.tlsKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// tokenCredentials sends the token in the authorization metadata of every call, like the
+// write token of commits.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
 func (opts remoteOpts) MustOpen() (KV, Backend) {
 	db, txPool, err := opts.Open()
 	if err != nil {
@@ -127,36 +310,151 @@ func (opts remoteOpts) MustOpen() (KV, Backend) {
 }
 
 func NewRemote() remoteOpts {
-	return remoteOpts{}
+	return remoteOpts{conns: 1, retryDelay: defaultRemoteRetryMaxDelay, retryFor: defaultRemoteRetryTimeout}
 }
 
 // Close
 // All transactions must be closed before closing the database.
 func (db *RemoteKV) Close() {
-	if db.conn != nil {
-		if err := db.conn.Close(); err != nil {
+	if db.conns == nil {
+		return
+	}
+	for _, c := range db.conns {
+		if err := c.conn.Close(); err != nil {
 			db.log.Warn("failed to close remote DB", "err", err)
-		} else {
-			db.log.Info("remote database closed")
 		}
-		db.conn = nil
+	}
+	db.log.Info("remote database closed")
+	db.conns = nil
+}
+
+// pick returns the next connection which is not failing, if any.
+func (db *RemoteKV) pick() *remoteConn {
+	i := int(atomic.AddUint32(&db.next, 1))
+	for j := range db.conns {
+		c := db.conns[(i+j)%len(db.conns)]
+		if state := c.conn.GetState(); state != connectivity.TransientFailure && state != connectivity.Shutdown {
+			return c
+		}
+	}
+	return db.conns[i%len(db.conns)]
+}
+
+// retry calls f until it doesn't fail as the server is unavailable, with doubling delays, for
+// up to the retry timeout.
+func (db *RemoteKV) retry(ctx context.Context, f func(c *remoteConn) error) error {
+	var deadline time.Time
+	delay := remoteRetryBaseDelay
+	for {
+		err := f(db.pick())
+		if status.Code(err) != codes.Unavailable || db.opts.retryFor == 0 {
+			return err
+		}
+		if deadline.IsZero() {
+			deadline = time.Now().Add(db.opts.retryFor)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		db.log.Debug("remote DB unavailable, retrying", "in", delay, "err", err)
+		remoteRetries.Inc(1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > db.opts.retryDelay {
+			delay = db.opts.retryDelay
+		}
 	}
 }
 
+// Connectivity tells if a connection is established, or idle and established on the next call,
+// with the states of the connections.
+func (db *RemoteKV) Connectivity() (bool, string) {
+	if db.conns == nil {
+		return false, "closed"
+	}
+	connected := false
+	states := make([]string, len(db.conns))
+	for i, c := range db.conns {
+		state := c.conn.GetState()
+		if state == connectivity.Ready || state == connectivity.Idle {
+			connected = true
+		}
+		states[i] = state.String()
+	}
+	return connected, strings.Join(states, ",")
+}
+
 func (db *RemoteKV) DiskSize(ctx context.Context) (uint64, error) {
-	sizeReply, err := db.remoteDB.Size(ctx, &remote.SizeRequest{})
-	if err != nil {
-		return 0, err
+	var size uint64
+	err := db.retry(ctx, func(c *remoteConn) error {
+		sizeReply, err := c.remoteDB.Size(ctx, &remote.SizeRequest{})
+		if err != nil {
+			return err
+		}
+		size = sizeReply.Size
+		return nil
+	})
+	return size, err
+}
+
+// Watch returns once the server started the watch, the changes of a transaction larger than
+// remotedbserver.MaxBatchBytes come in several slices. The channel is also closed when the stream
+// ends, the watch is to be opened again then.
+func (db *RemoteKV) Watch(ctx context.Context, bucket string, prefix []byte) (<-chan []Change, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var stream remote.KV_WatchClient
+	if err := db.retry(ctx, func(c *remoteConn) (err error) {
+		if stream, err = c.remoteKV.Watch(ctx, &remote.WatchRequest{BucketName: bucket, Prefix: prefix}); err != nil {
+			return err
+		}
+		_, err = stream.Recv() // without changes, the watch started
+		return err
+	}); err != nil {
+		cancel()
+		return nil, err
 	}
-	return sizeReply.Size, nil
+	ch := make(chan []Change)
+	go func() {
+		defer cancel()
+		defer close(ch)
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					db.log.Warn("remote DB watch ended", "bucket", bucket, "err", err)
+				}
+				return
+			}
+			changes := make([]Change, len(msg.Changes))
+			for i, change := range msg.Changes {
+				changes[i] = Change{Key: change.Key, Value: change.Value, Delete: change.Delete}
+				if !change.Delete && change.Value == nil {
+					changes[i].Value = []byte{}
+				}
+			}
+			select {
+			case ch <- changes:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
 }
 
 func (db *RemoteKV) IdealBatchSize() int {
 	panic("not supported")
 }
 
+// Begin - the writes of a writable transaction are sent to the server on .Commit(), its reads don't see them
 func (db *RemoteKV) Begin(ctx context.Context, parent Tx, writable bool) (Tx, error) {
-	panic("remote db doesn't support managed transactions")
+	if parent != nil {
+		return nil, fmt.Errorf("remote db doesn't support nested transactions")
+	}
+	return &remoteTx{ctx: ctx, db: db, writable: writable}, nil
 }
 
 func (db *RemoteKV) View(ctx context.Context, f func(tx Tx) error) (err error) {
@@ -166,21 +464,76 @@ func (db *RemoteKV) View(ctx context.Context, f func(tx Tx) error) (err error) {
 	return f(t)
 }
 
+// Update - the writes of f are sent to the server when it returns, its reads don't see them
 func (db *RemoteKV) Update(ctx context.Context, f func(tx Tx) error) (err error) {
-	return fmt.Errorf("remote db provider doesn't support .Update method")
+	t := &remoteTx{ctx: ctx, db: db, writable: true}
+	defer t.Rollback()
+
+	if err = f(t); err != nil {
+		return err
+	}
+	return t.Commit(ctx)
 }
 
+// Commit - sends the writes, the server applies them in one transaction
 func (tx *remoteTx) Commit(ctx context.Context) error {
-	panic("remote db is read-only")
+	if !tx.writable {
+		return fmt.Errorf("remote db tx is read-only")
+	}
+	mutations := tx.mutations
+	defer tx.Rollback()
+	if len(mutations) == 0 {
+		return nil
+	}
+
+	if tx.db.opts.writeToken != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tx.db.opts.writeToken)
+	}
+	stream, err := tx.db.pick().remoteKV.Update(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range mutations {
+		if err = stream.Send(m); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = stream.Send(&remote.Mutation{Commit: true})
+	}
+	if err != nil && err != io.EOF { // on io.EOF the status of the stream is received
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return err
 }
 
 func (tx *remoteTx) Rollback() {
 	for _, c := range tx.cursors {
-		if c.stream != nil {
-			_ = c.stream.CloseSend()
-			c.stream = nil
-		}
+		c.closeStream()
 	}
+	tx.mutations = nil
+}
+
+func (tx *remoteTx) mutate(m *remote.Mutation) error {
+	if !tx.writable {
+		return fmt.Errorf("remote db tx is read-only")
+	}
+	tx.mutations = append(tx.mutations, m)
+	return nil
+}
+
+func (c *remoteCursor) closeStream() {
+	if c.stream != nil {
+		_ = c.stream.CloseSend()
+		c.stream = nil
+	}
+	if c.batchStream != nil {
+		_ = c.batchStream.CloseSend()
+		c.batchStream = nil
+	}
+	c.batch = nil
+	c.streamingRequested = false
 }
 
 func (c *remoteCursor) Prefix(v []byte) Cursor {
@@ -188,6 +541,12 @@ func (c *remoteCursor) Prefix(v []byte) Cursor {
 	return c
 }
 
+// Range is applied by the server, and by the cursor too, for servers which ignore it.
+func (c *remoteCursor) Range(start, end []byte) Cursor {
+	c.bounds = keyRange{start: start, end: end}
+	return c
+}
+
 func (c *remoteCursor) MatchBits(n uint) Cursor {
 	panic("not implemented yet")
 }
@@ -203,27 +562,83 @@ func (c *remoteCursor) NoValues() NoValuesCursor {
 }
 
 func (tx *remoteTx) BucketSize(name string) (uint64, error) {
-	sizeReply, err := tx.db.remoteDB.BucketSize(tx.ctx, &remote.BucketSizeRequest{BucketName: name})
-	if err != nil {
-		return 0, err
-	}
-	return sizeReply.Size, nil
+	var size uint64
+	err := tx.db.retry(tx.ctx, func(c *remoteConn) error {
+		sizeReply, err := c.remoteDB.BucketSize(tx.ctx, &remote.BucketSizeRequest{BucketName: name})
+		if err != nil {
+			return err
+		}
+		size = sizeReply.Size
+		return nil
+	})
+	return size, err
 }
 
 func (tx *remoteTx) Get(bucket string, key []byte) (val []byte, err error) {
 	c := tx.Cursor(bucket)
-	defer func() {
-		if v, ok := c.(*remoteCursor); ok {
-			if v.stream == nil {
-				return
-			}
-			_ = v.stream.CloseSend()
-		}
-	}()
+	defer c.(*remoteCursor).closeStream()
 
 	return c.SeekExact(key)
 }
 
+// MultiGet reads the values with a single call, whose replies are streamed in batches. Like
+// Get, it does not see the writes of the transaction. Values of the empty key are not read.
+func (tx *remoteTx) MultiGet(bucket string, keys [][]byte) ([][]byte, error) {
+	if atomic.LoadInt32(&tx.db.noMultiGet) == 0 {
+		var values [][]byte
+		err := tx.db.retry(tx.ctx, func(c *remoteConn) (err error) {
+			values, err = tx.multiGet(c, bucket, keys)
+			return err
+		})
+		if status.Code(err) != codes.Unimplemented {
+			return values, err
+		}
+		atomic.StoreInt32(&tx.db.noMultiGet, 1)
+		tx.db.log.Debug("remote DB can't read several keys at once, reading them one by one", "err", err)
+	}
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		var err error
+		if values[i], err = tx.Get(bucket, key); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (tx *remoteTx) multiGet(c *remoteConn, bucket string, keys [][]byte) ([][]byte, error) {
+	values := make([][]byte, 0, len(keys))
+	if len(keys) == 0 {
+		return values, nil
+	}
+	ctx, cancel := context.WithCancel(tx.ctx)
+	defer cancel()
+	stream, err := c.remoteKV.MultiGet(ctx, &remote.MultiGetRequest{BucketName: bucket, Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+	for len(values) < len(keys) {
+		batch, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("remote db sent %d values of %d keys", len(values), len(keys))
+			}
+			return nil, err
+		}
+		for _, pair := range batch.Pairs {
+			switch {
+			case pair.Key == nil: // missing
+				values = append(values, nil)
+			case pair.Value == nil:
+				values = append(values, []byte{})
+			default:
+				values = append(values, pair.Value)
+			}
+		}
+	}
+	return values, nil
+}
+
 func (c *remoteCursor) SeekExact(key []byte) (val []byte, err error) {
 	k, v, err := c.Seek(key)
 	if err != nil {
@@ -242,37 +657,58 @@ func (tx *remoteTx) Cursor(bucket string) Cursor {
 }
 
 func (c *remoteCursor) Put(key []byte, value []byte) error {
-	panic("not supported")
+	return c.tx.mutate(&remote.Mutation{BucketName: c.bucketName, Key: common.CopyBytes(key), Value: common.CopyBytes(value)})
 }
 
+// Append - same as .Put(), the server doesn't rely on the order of the keys
 func (c *remoteCursor) Append(key []byte, value []byte) error {
-	panic("not supported")
+	return c.Put(key, value)
 }
 
 func (c *remoteCursor) Delete(key []byte) error {
-	panic("not supported")
+	return c.tx.mutate(&remote.Mutation{BucketName: c.bucketName, Key: common.CopyBytes(key), Delete: true})
 }
 
 func (c *remoteCursor) First() ([]byte, []byte, error) {
-	return c.Seek(c.prefix)
+	return c.Seek(c.bounds.first(c.prefix))
 }
 
 // Seek - doesn't start streaming (because much of code does only several .Seek calls without reading sequence of data)
-// .Next() - does request streaming (if configured by user)
+// .Next() - does request streaming (if configured by user), in batches of the prefetch size
 func (c *remoteCursor) Seek(seek []byte) ([]byte, []byte, error) {
-	if c.stream != nil {
-		_ = c.stream.CloseSend()
-		c.stream = nil
-	}
 	c.initialized = true
+	defer remoteSeekTimer.UpdateSince(time.Now())
+
+	var k, v []byte
+	if err := c.tx.db.retry(c.ctx, func(conn *remoteConn) (err error) {
+		c.closeStream()
+		k, v, err = c.seek(conn, seek)
+		return err
+	}); err != nil {
+		return []byte{}, nil, err
+	}
+	c.key = k
+	return c.cut(k, v, nil)
+}
+
+func (c *remoteCursor) seek(conn *remoteConn, seek []byte) ([]byte, []byte, error) {
+	if c.prefetch > 1 && atomic.LoadInt32(&c.tx.db.noSeekBatch) == 0 {
+		k, v, err := c.seekBatch(conn, seek)
+		if status.Code(err) != codes.Unimplemented {
+			return k, v, err
+		}
+		c.closeStream()
+		atomic.StoreInt32(&c.tx.db.noSeekBatch, 1)
+		c.tx.db.log.Debug("remote DB can't stream batches, streaming pairs", "err", err)
+	}
 
 	var err error
-	c.stream, err = c.tx.db.remoteKV.Seek(c.ctx)
+	c.stream, err = conn.remoteKV.Seek(c.ctx)
 	if err != nil {
 		return []byte{}, nil, err
 	}
-	err = c.stream.Send(&remote.SeekRequest{BucketName: c.bucketName, SeekKey: seek, Prefix: c.prefix, StartSreaming: false})
-	if err != nil {
+	err = c.stream.Send(&remote.SeekRequest{BucketName: c.bucketName, SeekKey: seek, Prefix: c.prefix, End: c.bounds.end, StartSreaming: false})
+	if err != nil && err != io.EOF { // on io.EOF the status of the stream is received
 		return []byte{}, nil, err
 	}
 
@@ -280,20 +716,81 @@ func (c *remoteCursor) Seek(seek []byte) ([]byte, []byte, error) {
 	if err != nil {
 		return []byte{}, nil, err
 	}
+	return pair.Key, pair.Value, nil
+}
+
+// seekBatch opens a SeekBatch stream, the first batch only has the pair sought.
+func (c *remoteCursor) seekBatch(conn *remoteConn, seek []byte) ([]byte, []byte, error) {
+	var err error
+	c.batchStream, err = conn.remoteKV.SeekBatch(c.ctx)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	err = c.batchStream.Send(&remote.SeekRequest{BucketName: c.bucketName, SeekKey: seek, Prefix: c.prefix, End: c.bounds.end, StartSreaming: false, BatchSize: 1})
+	if err != nil && err != io.EOF { // on io.EOF the status of the stream is received
+		return []byte{}, nil, err
+	}
+	return c.nextFromBatch()
+}
 
+// nextFromBatch returns the next pair read ahead, receiving the next batch when all were returned.
+func (c *remoteCursor) nextFromBatch() ([]byte, []byte, error) {
+	if len(c.batch) == 0 {
+		batch, err := c.batchStream.Recv()
+		if err != nil {
+			return []byte{}, nil, err
+		}
+		if len(batch.Pairs) == 0 {
+			return []byte{}, nil, fmt.Errorf("remote db sent an empty batch")
+		}
+		c.batch = batch.Pairs
+	}
+	pair := c.batch[0]
+	c.batch[0] = nil
+	c.batch = c.batch[1:]
 	return pair.Key, pair.Value, nil
 }
 
-// Next - returns next data element from server, request streaming (if configured by user)
+// Next - returns next data element from server, request streaming (if configured by user). If the
+// stream breaks as the server is unavailable, the cursor seeks the pair after the last one again.
 func (c *remoteCursor) Next() ([]byte, []byte, error) {
 	if !c.initialized {
 		return c.First()
 	}
 
+	k, v, err := c.next()
+	if status.Code(err) == codes.Unavailable && c.tx.db.opts.retryFor != 0 && c.key != nil {
+		c.tx.db.log.Debug("remote DB stream broken, seeking again", "err", err)
+		last := c.key
+		if k, v, err = c.Seek(last); err != nil || !bytes.Equal(k, last) {
+			return k, v, err
+		}
+		k, v, err = c.next()
+	}
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	c.key = k
+	return c.cut(k, v, nil)
+}
+
+func (c *remoteCursor) next() ([]byte, []byte, error) {
+	if c.batchStream != nil {
+		if !c.streamingRequested {
+			defer remoteNextTimer.UpdateSince(time.Now())
+			if err := c.batchStream.Send(&remote.SeekRequest{StartSreaming: true, BatchSize: c.prefetch}); err != nil && err != io.EOF { // on io.EOF the status of the stream is received
+				return []byte{}, nil, err
+			}
+			c.streamingRequested = true
+		}
+		return c.nextFromBatch()
+	}
+
 	// if streaming not requested, server will send data only when remoteKV send message to bi-directional channel
 	if !c.streamingRequested {
+		defer remoteNextTimer.UpdateSince(time.Now())
 		doStream := c.prefetch > 1
-		if err := c.stream.Send(&remote.SeekRequest{StartSreaming: doStream}); err != nil {
+		if err := c.stream.Send(&remote.SeekRequest{StartSreaming: doStream}); err != nil && err != io.EOF { // on io.EOF the status of the stream is received
 			return []byte{}, nil, err
 		}
 		c.streamingRequested = doStream
@@ -306,6 +803,14 @@ func (c *remoteCursor) Next() ([]byte, []byte, error) {
 	return pair.Key, pair.Value, nil
 }
 
+// cut ends the iteration at the end of the range.
+func (c *remoteCursor) cut(k, v []byte, err error) ([]byte, []byte, error) {
+	if err == nil && c.bounds.past(k) {
+		return nil, nil, nil
+	}
+	return k, v, err
+}
+
 func (c *remoteCursor) Last() ([]byte, []byte, error) {
 	panic("not implemented yet")
 }
@@ -343,7 +848,7 @@ func (c *remoteNoValuesCursor) Walk(walker func(k []byte, vSize uint32) (bool, e
 }
 
 func (c *remoteNoValuesCursor) First() ([]byte, uint32, error) {
-	return c.Seek(c.prefix)
+	return c.Seek(c.bounds.first(c.prefix))
 }
 
 func (c *remoteNoValuesCursor) Seek(seek []byte) ([]byte, uint32, error) {
@@ -0,0 +1,286 @@
+package ethdb_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
+	"github.com/ledgerwatch/turbo-geth/ethdb/remote/remotedbserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRemoteTLSAndToken(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", caCert, caKey)
+	writeCert(t, dir, "client", caCert, caKey)
+	writeCert(t, dir, "stranger", nil, nil)
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	kv := ethdb.NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	grpcServer, err := remotedbserver.NewServer(kv, nil, remotedbserver.Config{
+		TLSCert:    path("server.pem"),
+		TLSKey:     path("server.key"),
+		TLSCACert:  path("ca.pem"),
+		Token:      "token",
+		WriteToken: "write",
+	})
+	require.NoError(t, err)
+	conn := bufconn.Listen(1024 * 1024)
+	go func() { _ = grpcServer.Serve(conn) }()
+	defer grpcServer.Stop()
+
+	ctx, bucket := context.Background(), dbutils.Buckets[0]
+	open := func(caCert, cert, token string) ethdb.KV {
+		certFile, keyFile := "", ""
+		if cert != "" {
+			certFile, keyFile = cert+".pem", cert+".key"
+		}
+		// the failed handshakes are not retried
+		db, _, err := ethdb.NewRemote().Path("localhost").InMem(conn).TLS(caCert, certFile, keyFile).Token(token).WriteToken("write").Retry(0, 0).Open()
+		require.NoError(t, err)
+		return db
+	}
+	read := func(caCert, cert, token string) ([]byte, error) {
+		db := open(caCert, cert, token)
+		defer db.Close()
+		var v []byte
+		err := db.View(ctx, func(tx ethdb.Tx) (err error) {
+			v, err = tx.Get(bucket, []byte{1})
+			return err
+		})
+		return v, err
+	}
+
+	db := open(path("ca.pem"), path("client"), "token")
+	require.NoError(t, db.Update(ctx, func(tx ethdb.Tx) error {
+		return tx.Cursor(bucket).Put([]byte{1}, []byte{1})
+	}))
+	db.Close()
+	v, err := read(path("ca.pem"), path("client"), "token")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1}, v)
+
+	_, err = read(path("ca.pem"), path("client"), "guess")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = read(path("ca.pem"), path("client"), "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = read(path("ca.pem"), path("stranger"), "token")
+	assert.Error(t, err, "client certificate of an unknown CA")
+	_, err = read(path("stranger.pem"), path("client"), "token")
+	assert.Error(t, err, "server certificate of an unknown CA")
+	_, err = read("", "", "token")
+	assert.Error(t, err, "plaintext")
+}
+
+// countingCompressor is snappy, counting the compressed messages.
+type countingCompressor struct {
+	encoding.Compressor
+	compressed int32
+}
+
+func (c *countingCompressor) Name() string {
+	return "counting"
+}
+
+func (c *countingCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	atomic.AddInt32(&c.compressed, 1)
+	return c.Compressor.Compress(w)
+}
+
+func TestRemoteCompression(t *testing.T) {
+	counting := &countingCompressor{Compressor: encoding.GetCompressor(remote.Snappy)}
+	encoding.RegisterCompressor(counting)
+
+	kv := ethdb.NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	grpcServer, err := remotedbserver.NewServer(kv, nil, remotedbserver.Config{WriteToken: "write"})
+	require.NoError(t, err)
+	conn := bufconn.Listen(1024 * 1024)
+	go func() { _ = grpcServer.Serve(conn) }()
+	defer grpcServer.Stop()
+
+	_, _, err = ethdb.NewRemote().Path("localhost").InMem(conn).Compression("zip").Open()
+	assert.Error(t, err, "unknown compression")
+
+	ctx, bucket := context.Background(), dbutils.CodeBucket
+	value := bytes.Repeat([]byte{1}, 64*1024)
+	for i, compression := range []string{remote.Snappy, remote.Gzip, "counting"} {
+		db, _, err := ethdb.NewRemote().Path("localhost").InMem(conn).Compression(compression).WriteToken("write").Open()
+		require.NoError(t, err)
+		require.NoError(t, db.Update(ctx, func(tx ethdb.Tx) error {
+			return tx.Cursor(bucket).Put([]byte{byte(i)}, value)
+		}))
+		require.NoError(t, db.View(ctx, func(tx ethdb.Tx) error {
+			v, err := tx.Get(bucket, []byte{byte(i)})
+			assert.Equal(t, value, v, compression)
+			return err
+		}))
+		db.Close()
+	}
+	// the client compresses the calls, the server the replies
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&counting.compressed), int32(6))
+}
+
+func TestRemoteReconnect(t *testing.T) {
+	kv := ethdb.NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+	ctx, bucket := context.Background(), dbutils.Buckets[0]
+	require.NoError(t, kv.Update(ctx, func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucket)
+		for i := 0; i < 10; i++ {
+			if err := c.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	serve := func(listener net.Listener) *grpc.Server {
+		grpcServer, err := remotedbserver.NewServer(kv, nil, remotedbserver.Config{})
+		require.NoError(t, err)
+		go func() { _ = grpcServer.Serve(listener) }()
+		return grpcServer
+	}
+	grpcServer := serve(listener)
+
+	db, _, err := ethdb.NewRemote().Path(addr).Conns(2).Retry(50*time.Millisecond, 10*time.Second).Open()
+	require.NoError(t, err)
+	defer db.Close()
+	connectivity := db.(ethdb.HasConnectivity)
+
+	restarted := make(chan *grpc.Server, 1)
+	var keys []byte
+	require.NoError(t, db.View(ctx, func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucket)
+		for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k[0])
+			if k[0] == 4 {
+				// the node restarts in the middle of the iteration
+				grpcServer.Stop()
+				for connected, _ := connectivity.Connectivity(); connected; connected, _ = connectivity.Connectivity() {
+					time.Sleep(10 * time.Millisecond)
+				}
+				time.AfterFunc(200*time.Millisecond, func() {
+					listener, err := net.Listen("tcp", addr)
+					if err != nil {
+						t.Error(err)
+						close(restarted)
+						return
+					}
+					restarted <- serve(listener)
+				})
+			}
+		}
+		return nil
+	}))
+	if grpcServer = <-restarted; grpcServer != nil {
+		defer grpcServer.Stop()
+	}
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, keys, "resumed after the last key")
+	connected, state := connectivity.Connectivity()
+	assert.True(t, connected, state)
+}
+
+func TestRemoteWatch(t *testing.T) {
+	kv := ethdb.NewWatchedKV(ethdb.NewLMDB().InMem().MustOpen())
+	defer kv.Close()
+	unwatched := ethdb.NewLMDB().InMem().MustOpen()
+	defer unwatched.Close()
+	conn, unwatchedConn := bufconn.Listen(1024*1024), bufconn.Listen(1024*1024)
+	grpcServer, unwatchedServer := grpc.NewServer(), grpc.NewServer()
+	remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(kv))
+	remote.RegisterKVServer(unwatchedServer, remotedbserver.NewKvServer(unwatched))
+	go func() { _ = grpcServer.Serve(conn) }()
+	go func() { _ = unwatchedServer.Serve(unwatchedConn) }()
+	defer grpcServer.Stop()
+	defer unwatchedServer.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bucket := dbutils.HeaderPrefix
+	rdb, _ := ethdb.NewRemote().InMem(conn).MustOpen()
+	defer rdb.Close()
+	changes, err := rdb.(ethdb.HasWatch).Watch(ctx, bucket, []byte{1})
+	require.NoError(t, err)
+	_, err = rdb.(ethdb.HasWatch).Watch(ctx, "unknown", nil)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the watch started on the server when Watch returned
+	require.NoError(t, kv.Update(ctx, func(tx ethdb.Tx) error {
+		c := tx.Cursor(bucket)
+		if err := c.Put([]byte{1, 1}, nil); err != nil {
+			return err
+		}
+		if err := c.Put([]byte{2}, []byte{2}); err != nil {
+			return err
+		}
+		return c.Delete([]byte{1, 2})
+	}))
+	assert.Equal(t, []ethdb.Change{{Key: []byte{1, 1}, Value: []byte{}}, {Key: []byte{1, 2}, Delete: true}}, <-changes)
+	cancel()
+	for range changes {
+	}
+
+	unwatchedDB, _ := ethdb.NewRemote().InMem(unwatchedConn).MustOpen()
+	defer unwatchedDB.Close()
+	_, err = unwatchedDB.(ethdb.HasWatch).Watch(context.Background(), bucket, nil)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// writeCert writes name.pem and name.key into dir, a localhost certificate signed by parent,
+// or a self-signed CA without parent.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
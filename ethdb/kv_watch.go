@@ -0,0 +1,316 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+// watchBuffer is the number of transactions whose changes a watch holds until they are read.
+const watchBuffer = 256
+
+// WatchedKV notifies the changes committed by its write transactions, see HasWatch. The changes
+// are the Put, Append and Delete of the cursors of the transactions begun after the watch of their
+// bucket, the buckets cleared or dropped aren't notified.
+type WatchedKV struct {
+	KV
+	mu       sync.Mutex
+	commitMu sync.Mutex // keeps the notifications in the order of the commits
+	watches  map[*watch]struct{}
+	watched  map[string]int // watches by bucket, replaced on change for the transactions to keep it
+}
+
+type watch struct {
+	bucket string
+	prefix []byte
+	ch     chan []Change
+	done   chan struct{}
+}
+
+type watchedTx struct {
+	Tx
+	db      *WatchedKV
+	parent  *watchedTx
+	watched map[string]int
+	changes map[string][]Change
+}
+
+type watchedCursor struct {
+	Cursor
+	tx     *watchedTx
+	bucket string
+}
+
+// NewWatchedKV notifies the changes of kv, see WatchedKV.
+func NewWatchedKV(kv KV) *WatchedKV {
+	return &WatchedKV{KV: kv, watches: map[*watch]struct{}{}}
+}
+
+func (db *WatchedKV) Watch(ctx context.Context, bucket string, prefix []byte) (<-chan []Change, error) {
+	if _, ok := dbutils.BucketsCfg[bucket]; !ok {
+		return nil, fmt.Errorf("%w, bucket: %s", ErrUnknownBucket, bucket)
+	}
+	w := &watch{bucket: bucket, prefix: common.CopyBytes(prefix), ch: make(chan []Change, watchBuffer), done: make(chan struct{})}
+	db.mu.Lock()
+	db.watches[w] = struct{}{}
+	db.countWatches(bucket, 1)
+	db.mu.Unlock()
+	go func() {
+		select {
+		case <-ctx.Done():
+			db.mu.Lock()
+			defer db.mu.Unlock()
+			if _, ok := db.watches[w]; ok {
+				db.unwatch(w)
+			}
+		case <-w.done:
+		}
+	}()
+	return w.ch, nil
+}
+
+// unwatch is called with the lock held.
+func (db *WatchedKV) unwatch(w *watch) {
+	delete(db.watches, w)
+	db.countWatches(w.bucket, -1)
+	close(w.ch)
+	close(w.done)
+}
+
+// countWatches is called with the lock held.
+func (db *WatchedKV) countWatches(bucket string, delta int) {
+	watched := make(map[string]int, len(db.watched)+1)
+	for b, n := range db.watched {
+		watched[b] = n
+	}
+	watched[bucket] += delta
+	if watched[bucket] == 0 {
+		delete(watched, bucket)
+	}
+	db.watched = watched
+}
+
+// notify sends the changes committed to the watches matching them, those which don't have room
+// for them are closed.
+func (db *WatchedKV) notify(changes map[string][]Change) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for w := range db.watches {
+		var matching []Change
+		for _, change := range changes[w.bucket] {
+			if bytes.HasPrefix(change.Key, w.prefix) {
+				matching = append(matching, change)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		select {
+		case w.ch <- matching:
+		default:
+			log.Warn("Closing the watch of the database changes, they aren't read in time", "bucket", w.bucket, "prefix", fmt.Sprintf("%x", w.prefix))
+			db.unwatch(w)
+		}
+	}
+}
+
+// Close closes the watches, then kv.
+func (db *WatchedKV) Close() {
+	db.mu.Lock()
+	for w := range db.watches {
+		db.unwatch(w)
+	}
+	db.mu.Unlock()
+	db.KV.Close()
+}
+
+func (db *WatchedKV) Begin(ctx context.Context, parent Tx, writable bool) (Tx, error) {
+	watchedParent, _ := parent.(*watchedTx)
+	if watchedParent != nil {
+		parent = watchedParent.Tx
+	}
+	tx, err := db.KV.Begin(ctx, parent, writable)
+	if err != nil || !writable {
+		return tx, err
+	}
+	wtx := &watchedTx{Tx: tx, db: db, parent: watchedParent}
+	if watchedParent != nil {
+		wtx.watched = watchedParent.watched
+	} else {
+		db.mu.Lock()
+		wtx.watched = db.watched
+		db.mu.Unlock()
+	}
+	return wtx, nil
+}
+
+// Update is Begin and Commit, for the changes to be notified.
+func (db *WatchedKV) Update(ctx context.Context, f func(tx Tx) error) error {
+	tx, err := db.Begin(ctx, nil, true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *WatchedKV) DiskSize(ctx context.Context) (uint64, error) {
+	if stats, ok := db.KV.(HasStats); ok {
+		return stats.DiskSize(ctx)
+	}
+	return 0, nil
+}
+
+func (db *WatchedKV) BackupTo(ctx context.Context, w io.Writer) error {
+	if backuper, ok := db.KV.(HasBackup); ok {
+		return backuper.BackupTo(ctx, w)
+	}
+	return fmt.Errorf("%T doesn't support hot backups", db.KV)
+}
+
+// Cursor notifies the writes of the cursors of the buckets watched when the transaction began.
+func (tx *watchedTx) Cursor(bucket string) Cursor {
+	c := tx.Tx.Cursor(bucket)
+	if tx.watched[bucket] == 0 {
+		return c
+	}
+	return &watchedCursor{Cursor: c, tx: tx, bucket: bucket}
+}
+
+func (tx *watchedTx) record(bucket string, change Change) {
+	if tx.changes == nil {
+		tx.changes = map[string][]Change{}
+	}
+	tx.changes[bucket] = append(tx.changes[bucket], change)
+}
+
+// Commit passes the changes to the parent transaction, if any, otherwise notifies them.
+func (tx *watchedTx) Commit(ctx context.Context) error {
+	if tx.parent != nil || len(tx.changes) == 0 {
+		if err := tx.Tx.Commit(ctx); err != nil {
+			return err
+		}
+		for bucket, changes := range tx.changes {
+			for _, change := range changes {
+				tx.parent.record(bucket, change)
+			}
+		}
+		return nil
+	}
+	tx.db.commitMu.Lock()
+	defer tx.db.commitMu.Unlock()
+	if err := tx.Tx.Commit(ctx); err != nil {
+		return err
+	}
+	tx.db.notify(tx.changes)
+	return nil
+}
+
+func (tx *watchedTx) migrator() (BucketMigrator, error) {
+	migrator, ok := tx.Tx.(BucketMigrator)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't implement ethdb.TxMigrator interface", tx.Tx)
+	}
+	return migrator, nil
+}
+
+func (tx *watchedTx) DropBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.DropBucket(name)
+}
+
+func (tx *watchedTx) CreateBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.CreateBucket(name)
+}
+
+func (tx *watchedTx) ExistsBucket(name string) bool {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return false
+	}
+	return migrator.ExistsBucket(name)
+}
+
+func (tx *watchedTx) ClearBucket(name string) error {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return err
+	}
+	return migrator.ClearBucket(name)
+}
+
+func (tx *watchedTx) ExistingBuckets() ([]string, error) {
+	migrator, err := tx.migrator()
+	if err != nil {
+		return nil, err
+	}
+	return migrator.ExistingBuckets()
+}
+
+func (tx *watchedTx) BucketStat(name string) (*BucketStat, error) {
+	withStat, ok := tx.Tx.(HasBucketStat)
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't describe buckets", tx.Tx)
+	}
+	return withStat.BucketStat(name)
+}
+
+func (c *watchedCursor) Prefix(v []byte) Cursor {
+	c.Cursor = c.Cursor.Prefix(v)
+	return c
+}
+
+func (c *watchedCursor) MatchBits(n uint) Cursor {
+	c.Cursor = c.Cursor.MatchBits(n)
+	return c
+}
+
+func (c *watchedCursor) Prefetch(v uint) Cursor {
+	c.Cursor = c.Cursor.Prefetch(v)
+	return c
+}
+
+func (c *watchedCursor) Range(start, end []byte) Cursor {
+	c.Cursor = c.Cursor.Range(start, end)
+	return c
+}
+
+func (c *watchedCursor) Put(key []byte, value []byte) error {
+	if err := c.Cursor.Put(key, value); err != nil {
+		return err
+	}
+	c.tx.record(c.bucket, Change{Key: common.CopyBytes(key), Value: common.CopyBytes(value)})
+	return nil
+}
+
+func (c *watchedCursor) Append(key []byte, value []byte) error {
+	if err := c.Cursor.Append(key, value); err != nil {
+		return err
+	}
+	c.tx.record(c.bucket, Change{Key: common.CopyBytes(key), Value: common.CopyBytes(value)})
+	return nil
+}
+
+func (c *watchedCursor) Delete(key []byte) error {
+	if err := c.Cursor.Delete(key); err != nil {
+		return err
+	}
+	c.tx.record(c.bucket, Change{Key: common.CopyBytes(key), Delete: true})
+	return nil
+}
@@ -0,0 +1,72 @@
+package ethdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchedKV(t *testing.T) {
+	bucket, other := dbutils.Buckets[0], dbutils.Buckets[1]
+	kv := NewWatchedKV(NewLMDB().InMem().MustOpen())
+	defer kv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// begun before the watch, not notified
+	before, err := kv.Begin(ctx, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, before.Cursor(bucket).Put([]byte{1, 0}, []byte{0}))
+
+	changes, err := kv.Watch(ctx, bucket, []byte{1})
+	require.NoError(t, err)
+	_, err = kv.Watch(ctx, "unknown", nil)
+	assert.Error(t, err)
+	require.NoError(t, before.Commit(ctx))
+
+	require.NoError(t, kv.Update(ctx, func(tx Tx) error {
+		c := tx.Cursor(bucket)
+		require.NoError(t, c.Put([]byte{1, 1}, []byte{1}))
+		require.NoError(t, c.Put([]byte{2}, []byte{2}))
+		require.NoError(t, tx.Cursor(other).Put([]byte{1, 2}, []byte{2}))
+		sub, err := kv.Begin(ctx, tx, true)
+		require.NoError(t, err)
+		require.NoError(t, sub.Cursor(bucket).Put([]byte{1, 3}, []byte{3}))
+		sub.Rollback()
+		sub, err = kv.Begin(ctx, tx, true)
+		require.NoError(t, err)
+		require.NoError(t, sub.Cursor(bucket).Delete([]byte{1, 0}))
+		return sub.Commit(ctx)
+	}))
+	assert.Equal(t, []Change{{Key: []byte{1, 1}, Value: []byte{1}}, {Key: []byte{1, 0}, Delete: true}}, <-changes)
+
+	rolledBack, err := kv.Begin(ctx, nil, true)
+	require.NoError(t, err)
+	require.NoError(t, rolledBack.Cursor(bucket).Put([]byte{1, 4}, []byte{4}))
+	rolledBack.Rollback()
+	require.NoError(t, kv.Update(ctx, func(tx Tx) error {
+		return tx.Cursor(bucket).Put([]byte{1, 5}, []byte{5})
+	}))
+	assert.Equal(t, []Change{{Key: []byte{1, 5}, Value: []byte{5}}}, <-changes)
+
+	cancel()
+	_, open := <-changes
+	assert.False(t, open, "closed when the context is done")
+	assert.Empty(t, kv.watched)
+
+	changes, err = kv.Watch(context.Background(), bucket, nil)
+	require.NoError(t, err)
+	for i := 0; i <= watchBuffer; i++ {
+		require.NoError(t, kv.Update(context.Background(), func(tx Tx) error {
+			return tx.Cursor(bucket).Put([]byte{3}, []byte{byte(i)})
+		}))
+	}
+	received := 0
+	for range changes {
+		received++
+	}
+	assert.Equal(t, watchBuffer, received, "closed when the changes aren't read in time")
+}
@@ -26,6 +26,10 @@ func NewMemDatabase() *ObjectDatabase {
 		return NewObjectDatabase(NewBolt().InMem().MustOpen())
 	case "lmdb":
 		return NewObjectDatabase(NewLMDB().InMem().MustOpen())
+	case "badger":
+		return NewObjectDatabase(NewBadger().InMem().MustOpen())
+	case "mem":
+		return NewObjectDatabase(NewMemKV())
 	default:
 		return NewObjectDatabase(NewLMDB().InMem().MustOpen())
 	}
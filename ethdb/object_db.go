@@ -72,13 +72,20 @@ func Open(path string) (*ObjectDatabase, error) {
 		kv, err = NewLMDB().Path(path).Open()
 	case testDB == "bolt" || strings.HasSuffix(path, "_bolt"):
 		kv, err = NewBolt().Path(path).Open()
+	case testDB == "badger" || strings.HasSuffix(path, "_badger"):
+		kv, err = NewBadger().Path(path).Open()
 	default:
 		kv, err = NewLMDB().Path(path).Open()
 	}
 	if err != nil {
 		return nil, err
 	}
-	return NewObjectDatabase(kv), nil
+	compressed, err := WithCompression(kv)
+	if err != nil {
+		kv.Close()
+		return nil, err
+	}
+	return NewObjectDatabase(compressed), nil
 }
 
 // Put inserts or updates a single entry.
@@ -319,6 +326,11 @@ func (db *ObjectDatabase) KV() KV {
 	return db.kv
 }
 
+// SetKV replaces the KV, by a wrapper of it, before the database is used concurrently.
+func (db *ObjectDatabase) SetKV(kv KV) {
+	db.kv = kv
+}
+
 func (db *ObjectDatabase) MemCopy() *ObjectDatabase {
 	var mem *ObjectDatabase
 	// Open the db and recover any potential corruptions
@@ -327,6 +339,10 @@ func (db *ObjectDatabase) MemCopy() *ObjectDatabase {
 		mem = NewObjectDatabase(NewLMDB().InMem().MustOpen())
 	case *BoltKV:
 		mem = NewObjectDatabase(NewBolt().InMem().MustOpen())
+	case *BadgerKV:
+		mem = NewObjectDatabase(NewBadger().InMem().MustOpen())
+	case *MemKV:
+		mem = NewObjectDatabase(NewMemKV())
 	}
 
 	if err := db.kv.View(context.Background(), func(readTx Tx) error {
@@ -0,0 +1,116 @@
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+)
+
+// PruneMode is the retention policy of the data which isn't needed to follow the chain:
+// how many blocks below the head are kept, 0 to keep all.
+type PruneMode struct {
+	History  uint64 // changesets
+	Receipts uint64
+	TxIndex  uint64
+}
+
+// ToString formats the mode as its flag, the letters of the storage mode with the
+// numbers of blocks kept, e.g. "h=90000,t=1000000".
+func (m PruneMode) ToString() string {
+	var parts []string
+	if m.History > 0 {
+		parts = append(parts, fmt.Sprintf("h=%d", m.History))
+	}
+	if m.Receipts > 0 {
+		parts = append(parts, fmt.Sprintf("r=%d", m.Receipts))
+	}
+	if m.TxIndex > 0 {
+		parts = append(parts, fmt.Sprintf("t=%d", m.TxIndex))
+	}
+	return strings.Join(parts, ",")
+}
+
+func PruneModeFromString(flags string) (PruneMode, error) {
+	mode := PruneMode{}
+	if flags == "" {
+		return mode, nil
+	}
+	for _, flag := range strings.Split(flags, ",") {
+		kv := strings.SplitN(flag, "=", 2)
+		if len(kv) != 2 {
+			return mode, fmt.Errorf("expected <letter>=<blocks>, found: %s", flag)
+		}
+		blocks, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return mode, fmt.Errorf("invalid number of blocks in %s: %w", flag, err)
+		}
+		switch kv[0] {
+		case "h":
+			mode.History = blocks
+		case "r":
+			mode.Receipts = blocks
+		case "t":
+			mode.TxIndex = blocks
+		default:
+			return mode, fmt.Errorf("unexpected flag found: %s", kv[0])
+		}
+	}
+	return mode, nil
+}
+
+func GetPruneModeFromDB(db Getter) (PruneMode, error) {
+	var pm PruneMode
+	for key, blocks := range map[string]*uint64{
+		string(dbutils.PruneModeHistory):  &pm.History,
+		string(dbutils.PruneModeReceipts): &pm.Receipts,
+		string(dbutils.PruneModeTxIndex):  &pm.TxIndex,
+	} {
+		v, err := db.Get(dbutils.DatabaseInfoBucket, []byte(key))
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return PruneMode{}, err
+		}
+		if len(v) == 8 {
+			*blocks = binary.BigEndian.Uint64(v)
+		}
+	}
+	return pm, nil
+}
+
+// SetPruneMode stores the mode, unlike the storage mode it can change: the data pruned
+// isn't restored, the data kept since is pruned by the new mode.
+func SetPruneMode(db Putter, pm PruneMode) error {
+	for key, blocks := range map[string]uint64{
+		string(dbutils.PruneModeHistory):  pm.History,
+		string(dbutils.PruneModeReceipts): pm.Receipts,
+		string(dbutils.PruneModeTxIndex):  pm.TxIndex,
+	} {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, blocks)
+		if err := db.Put(dbutils.DatabaseInfoBucket, []byte(key), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrPruned is returned for the data of the blocks which were pruned.
+var ErrPruned = errors.New("pruned")
+
+// GetPruned returns the last block whose data of prunedKey, dbutils.PrunedHistory,
+// PrunedReceipts or PrunedTxIndex, was pruned, 0 if none was. db is a Getter or a Tx.
+func GetPruned(db interface {
+	Get(bucket string, key []byte) ([]byte, error)
+}, prunedKey []byte) (uint64, error) {
+	v, err := db.Get(dbutils.DatabaseInfoBucket, prunedKey)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	if len(v) != 8 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
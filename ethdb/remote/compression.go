@@ -0,0 +1,54 @@
+package remote
+
+import (
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // registers gzip
+)
+
+// Compressors of the calls, registered with gRPC. Clients choose one, the server answers
+// with the compressor of the request.
+const (
+	Snappy = "snappy"
+	Gzip   = "gzip"
+)
+
+func init() {
+	encoding.RegisterCompressor(&snappyCompressor{})
+}
+
+// snappyCompressor uses the snappy framing format, reusing the buffers of the writers.
+type snappyCompressor struct {
+	writers sync.Pool
+}
+
+func (c *snappyCompressor) Name() string {
+	return Snappy
+}
+
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	sw, ok := c.writers.Get().(*snappyWriter)
+	if !ok {
+		return &snappyWriter{Writer: snappy.NewBufferedWriter(w), pool: &c.writers}, nil
+	}
+	sw.Reset(w)
+	return sw, nil
+}
+
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
+
+type snappyWriter struct {
+	*snappy.Writer
+	pool *sync.Pool
+}
+
+func (w *snappyWriter) Close() error {
+	err := w.Writer.Close()
+	w.pool.Put(w)
+	return err
+}
@@ -22,6 +22,21 @@ type KVClient interface {
 	// if streaming not requested - streams next data only when clients sends message to bi-directional channel
 	// no full consistency guarantee - server implementation can close/open underlying db transaction at any time
 	Seek(ctx context.Context, opts ...grpc.CallOption) (KV_SeekClient, error)
+	// like Seek, but sends up to batchSize pairs per message, the batch ending the data ends with a pair without key
+	// if streaming requested - streams batches until the end of the data
+	// if streaming not requested - sends the next batch only when client sends message to bi-directional channel
+	SeekBatch(ctx context.Context, opts ...grpc.CallOption) (KV_SeekBatchClient, error)
+	// applies the mutations of a write transaction in one database transaction, committed after a message with commit set
+	// the client sends the mutations when it commits, the transaction is rolled back if the stream ends without commit
+	// requires the write token of the server in the "authorization" metadata, as "Bearer <token>"
+	Update(ctx context.Context, opts ...grpc.CallOption) (KV_UpdateClient, error)
+	// reads the values of the keys in one database transaction, sent in the order of the keys in batches of pairs
+	// missing keys are sent as a pair without key
+	MultiGet(ctx context.Context, in *MultiGetRequest, opts ...grpc.CallOption) (KV_MultiGetClient, error)
+	// notifies the changes of the keys of the bucket with the prefix, those of a write transaction in one message
+	// the first message, without changes, is sent when the watch started
+	// the stream ends with an error if the client doesn't read the changes in time
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (KV_WatchClient, error)
 }
 
 type kVClient struct {
@@ -63,6 +78,135 @@ func (x *kVSeekClient) Recv() (*Pair, error) {
 	return m, nil
 }
 
+func (c *kVClient) SeekBatch(ctx context.Context, opts ...grpc.CallOption) (KV_SeekBatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_KV_serviceDesc.Streams[1], "/remote.KV/SeekBatch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVSeekBatchClient{stream}
+	return x, nil
+}
+
+type KV_SeekBatchClient interface {
+	Send(*SeekRequest) error
+	Recv() (*Pairs, error)
+	grpc.ClientStream
+}
+
+type kVSeekBatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVSeekBatchClient) Send(m *SeekRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *kVSeekBatchClient) Recv() (*Pairs, error) {
+	m := new(Pairs)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVClient) Update(ctx context.Context, opts ...grpc.CallOption) (KV_UpdateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_KV_serviceDesc.Streams[2], "/remote.KV/Update", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVUpdateClient{stream}
+	return x, nil
+}
+
+type KV_UpdateClient interface {
+	Send(*Mutation) error
+	CloseAndRecv() (*UpdateReply, error)
+	grpc.ClientStream
+}
+
+type kVUpdateClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVUpdateClient) Send(m *Mutation) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *kVUpdateClient) CloseAndRecv() (*UpdateReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UpdateReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVClient) MultiGet(ctx context.Context, in *MultiGetRequest, opts ...grpc.CallOption) (KV_MultiGetClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_KV_serviceDesc.Streams[3], "/remote.KV/MultiGet", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVMultiGetClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KV_MultiGetClient interface {
+	Recv() (*Pairs, error)
+	grpc.ClientStream
+}
+
+type kVMultiGetClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVMultiGetClient) Recv() (*Pairs, error) {
+	m := new(Pairs)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (KV_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_KV_serviceDesc.Streams[4], "/remote.KV/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KV_WatchClient interface {
+	Recv() (*Changes, error)
+	grpc.ClientStream
+}
+
+type kVWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVWatchClient) Recv() (*Changes, error) {
+	m := new(Changes)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // KVServer is the server API for KV service.
 // All implementations must embed UnimplementedKVServer
 // for forward compatibility
@@ -72,6 +216,21 @@ type KVServer interface {
 	// if streaming not requested - streams next data only when clients sends message to bi-directional channel
 	// no full consistency guarantee - server implementation can close/open underlying db transaction at any time
 	Seek(KV_SeekServer) error
+	// like Seek, but sends up to batchSize pairs per message, the batch ending the data ends with a pair without key
+	// if streaming requested - streams batches until the end of the data
+	// if streaming not requested - sends the next batch only when client sends message to bi-directional channel
+	SeekBatch(KV_SeekBatchServer) error
+	// applies the mutations of a write transaction in one database transaction, committed after a message with commit set
+	// the client sends the mutations when it commits, the transaction is rolled back if the stream ends without commit
+	// requires the write token of the server in the "authorization" metadata, as "Bearer <token>"
+	Update(KV_UpdateServer) error
+	// reads the values of the keys in one database transaction, sent in the order of the keys in batches of pairs
+	// missing keys are sent as a pair without key
+	MultiGet(*MultiGetRequest, KV_MultiGetServer) error
+	// notifies the changes of the keys of the bucket with the prefix, those of a write transaction in one message
+	// the first message, without changes, is sent when the watch started
+	// the stream ends with an error if the client doesn't read the changes in time
+	Watch(*WatchRequest, KV_WatchServer) error
 	mustEmbedUnimplementedKVServer()
 }
 
@@ -82,6 +241,18 @@ type UnimplementedKVServer struct {
 func (*UnimplementedKVServer) Seek(KV_SeekServer) error {
 	return status.Errorf(codes.Unimplemented, "method Seek not implemented")
 }
+func (*UnimplementedKVServer) SeekBatch(KV_SeekBatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method SeekBatch not implemented")
+}
+func (*UnimplementedKVServer) Update(KV_UpdateServer) error {
+	return status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (*UnimplementedKVServer) MultiGet(*MultiGetRequest, KV_MultiGetServer) error {
+	return status.Errorf(codes.Unimplemented, "method MultiGet not implemented")
+}
+func (*UnimplementedKVServer) Watch(*WatchRequest, KV_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (*UnimplementedKVServer) mustEmbedUnimplementedKVServer() {}
 
 func RegisterKVServer(s *grpc.Server, srv KVServer) {
@@ -114,6 +285,100 @@ func (x *kVSeekServer) Recv() (*SeekRequest, error) {
 	return m, nil
 }
 
+func _KV_SeekBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(KVServer).SeekBatch(&kVSeekBatchServer{stream})
+}
+
+type KV_SeekBatchServer interface {
+	Send(*Pairs) error
+	Recv() (*SeekRequest, error)
+	grpc.ServerStream
+}
+
+type kVSeekBatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVSeekBatchServer) Send(m *Pairs) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *kVSeekBatchServer) Recv() (*SeekRequest, error) {
+	m := new(SeekRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _KV_Update_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(KVServer).Update(&kVUpdateServer{stream})
+}
+
+type KV_UpdateServer interface {
+	SendAndClose(*UpdateReply) error
+	Recv() (*Mutation, error)
+	grpc.ServerStream
+}
+
+type kVUpdateServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVUpdateServer) SendAndClose(m *UpdateReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *kVUpdateServer) Recv() (*Mutation, error) {
+	m := new(Mutation)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _KV_MultiGet_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(MultiGetRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVServer).MultiGet(m, &kVMultiGetServer{stream})
+}
+
+type KV_MultiGetServer interface {
+	Send(*Pairs) error
+	grpc.ServerStream
+}
+
+type kVMultiGetServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVMultiGetServer) Send(m *Pairs) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KV_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVServer).Watch(m, &kVWatchServer{stream})
+}
+
+type KV_WatchServer interface {
+	Send(*Changes) error
+	grpc.ServerStream
+}
+
+type kVWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVWatchServer) Send(m *Changes) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _KV_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "remote.KV",
 	HandlerType: (*KVServer)(nil),
@@ -125,6 +390,27 @@ var _KV_serviceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "SeekBatch",
+			Handler:       _KV_SeekBatch_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Update",
+			Handler:       _KV_Update_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "MultiGet",
+			Handler:       _KV_MultiGet_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _KV_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "remote/kv.proto",
 }
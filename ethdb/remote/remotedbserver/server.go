@@ -2,16 +2,27 @@ package remotedbserver
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
 	"github.com/ledgerwatch/turbo-geth/core"
 	"github.com/ledgerwatch/turbo-geth/ethdb"
 	"github.com/ledgerwatch/turbo-geth/ethdb/remote"
@@ -21,21 +32,63 @@ import (
 
 const MaxTxTTL = time.Minute
 
+// MaxBatchBytes bounds the keys and values of a message of SeekBatch, far below the message
+// size limit of grpc, a batch ends after the pair reaching it.
+const MaxBatchBytes = 1 << 20
+
 type KvServer struct {
 	remote.UnimplementedKVServer // must be embedded to have forward compatible implementations.
 
-	kv ethdb.KV
+	kv         ethdb.KV
+	writeToken string // clients must send to write, writes are refused if empty
+}
+
+// Config secures the private RPC server: without certificate it serves plaintext, without
+// token any client can read.
+type Config struct {
+	TLSCert    string // path of the PEM certificate (chain) served
+	TLSKey     string // path of the PEM private key of TLSCert
+	TLSCACert  string // path of the PEM certificates of the CAs of the clients, which must present a certificate if set
+	Token      string // clients must send to call any method
+	WriteToken string // clients must send to write, writes are refused if empty
 }
 
-func StartGrpc(kv ethdb.KV, eth core.Backend, addr string) {
-	log.Info("Starting private RPC server", "on", addr)
+func StartGrpc(kv ethdb.KV, eth core.Backend, addr string, cfg Config) error {
+	log.Info("Starting private RPC server", "on", addr, "tls", cfg.TLSCert != "", "clientCerts", cfg.TLSCACert != "", "token", cfg.Token != "", "writable", cfg.WriteToken != "")
+	grpcServer, err := NewServer(kv, eth, cfg)
+	if err != nil {
+		return err
+	}
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Error("Could not create listener", "address", addr, "err", err)
-		return
+		return fmt.Errorf("could not create listener on %s: %w", addr, err)
 	}
 
-	kvSrv := NewKvServer(kv)
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Error("private RPC server fail", "err", err)
+		}
+	}()
+	return nil
+}
+
+// NewServer returns the private RPC server of the database and the backend, not serving yet.
+func NewServer(kv ethdb.KV, eth core.Backend, cfg Config) (*grpc.Server, error) {
+	var creds credentials.TransportCredentials
+	if cfg.TLSCert != "" {
+		tlsConfig, err := serverTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	} else if cfg.TLSCACert != "" {
+		return nil, fmt.Errorf("client certificates need a server certificate")
+	}
+	if creds == nil && cfg.Token != "" {
+		log.Warn("The private RPC server token is sent in plaintext, serve TLS to protect it")
+	}
+
+	kvSrv := NewWritableKvServer(kv, cfg.WriteToken)
 	dbSrv := NewDBServer(kv)
 	ethBackendSrv := NewEthBackendServer(eth)
 	var (
@@ -46,17 +99,31 @@ func StartGrpc(kv ethdb.KV, eth core.Backend, addr string) {
 		streamInterceptors = append(streamInterceptors, grpc_prometheus.StreamServerInterceptor)
 		unaryInterceptors = append(unaryInterceptors, grpc_prometheus.UnaryServerInterceptor)
 	}
+	if cfg.Token != "" {
+		authorize := func(ctx context.Context) (context.Context, error) {
+			if !hasToken(ctx, cfg.Token) {
+				return nil, status.Error(codes.Unauthenticated, "invalid token")
+			}
+			return ctx, nil
+		}
+		streamInterceptors = append(streamInterceptors, grpc_auth.StreamServerInterceptor(authorize))
+		unaryInterceptors = append(unaryInterceptors, grpc_auth.UnaryServerInterceptor(authorize))
+	}
 	streamInterceptors = append(streamInterceptors, grpc_recovery.StreamServerInterceptor())
 	unaryInterceptors = append(unaryInterceptors, grpc_recovery.UnaryServerInterceptor())
 
-	grpcServer := grpc.NewServer(
+	opts := []grpc.ServerOption{
 		grpc.NumStreamWorkers(20),  // reduce amount of goroutines
 		grpc.WriteBufferSize(1024), // reduce buffers to save mem
 		grpc.ReadBufferSize(1024),
 		grpc.MaxConcurrentStreams(40), // to force clients reduce concurency level
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamInterceptors...)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors...)),
-	)
+	}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	grpcServer := grpc.NewServer(opts...)
 	remote.RegisterKVServer(grpcServer, kvSrv)
 	remote.RegisterDBServer(grpcServer, dbSrv)
 	remote.RegisterETHBACKENDServer(grpcServer, ethBackendSrv)
@@ -64,18 +131,39 @@ func StartGrpc(kv ethdb.KV, eth core.Backend, addr string) {
 	if metrics.Enabled {
 		grpc_prometheus.Register(grpcServer)
 	}
+	return grpcServer, nil
+}
 
-	go func() {
-		if err := grpcServer.Serve(lis); err != nil {
-			log.Error("private RPC server fail", "err", err)
+// serverTLSConfig loads the certificate of the server and the CAs of the clients.
+func serverTLSConfig(cfg Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the private RPC server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.TLSCACert != "" {
+		pem, err := ioutil.ReadFile(cfg.TLSCACert)
+		if err != nil {
+			return nil, err
 		}
-	}()
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", cfg.TLSCACert)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
 }
 
 func NewKvServer(kv ethdb.KV) *KvServer {
 	return &KvServer{kv: kv}
 }
 
+// NewWritableKvServer serves Update to the clients sending writeToken.
+func NewWritableKvServer(kv ethdb.KV, writeToken string) *KvServer {
+	return &KvServer{kv: kv, writeToken: writeToken}
+}
+
 func (s *KvServer) Seek(stream remote.KV_SeekServer) error {
 	in, recvErr := stream.Recv()
 	if recvErr != nil {
@@ -91,9 +179,9 @@ func (s *KvServer) Seek(stream remote.KV_SeekServer) error {
 	}
 	defer rollback()
 
-	bucketName, prefix := in.BucketName, in.Prefix // 'in' value will cahnge, but this params will immutable
+	bucketName, prefix, end := in.BucketName, in.Prefix, in.End // 'in' value will cahnge, but this params will immutable
 
-	c := tx.Cursor(bucketName).Prefix(prefix)
+	c := tx.Cursor(bucketName).Prefix(prefix).Range(nil, end)
 
 	t := time.Now()
 	i := 0
@@ -130,8 +218,220 @@ func (s *KvServer) Seek(stream remote.KV_SeekServer) error {
 			if err != nil {
 				return err
 			}
-			c = tx.Cursor(bucketName).Prefix(prefix)
+			c = tx.Cursor(bucketName).Prefix(prefix).Range(nil, end)
 			_, _, _ = c.Seek(k)
 		}
 	}
 }
+
+func (s *KvServer) SeekBatch(stream remote.KV_SeekBatchServer) error {
+	in, recvErr := stream.Recv()
+	if recvErr != nil {
+		return recvErr
+	}
+
+	tx, err := s.kv.Begin(context.Background(), nil, false)
+	if err != nil {
+		return err
+	}
+	rollback := func() {
+		tx.Rollback()
+	}
+	defer rollback()
+
+	bucketName, prefix, end := in.BucketName, in.Prefix, in.End // 'in' value will change, but this params will immutable
+
+	c := tx.Cursor(bucketName).Prefix(prefix).Range(nil, end)
+
+	t := time.Now()
+	i := 0
+	// the pair after a batch is read before sending it, if k==nil - still send it to client and stop
+	k, v, err := c.Seek(in.SeekKey)
+	for {
+		batch := &remote.Pairs{}
+		size := 0
+		for uint32(len(batch.Pairs)) < in.BatchSize || len(batch.Pairs) == 0 {
+			if err != nil {
+				return err
+			}
+			pair := &remote.Pair{Key: common.CopyBytes(k), Value: common.CopyBytes(v)}
+			batch.Pairs = append(batch.Pairs, pair)
+			if k == nil {
+				break
+			}
+
+			//TODO: protect against stale client
+			i++
+			if i%128 == 0 && time.Since(t) > MaxTxTTL {
+				tx.Rollback()
+				tx, err = s.kv.Begin(context.Background(), nil, false)
+				if err != nil {
+					return err
+				}
+				t = time.Now()
+				c = tx.Cursor(bucketName).Prefix(prefix).Range(nil, end)
+				if _, _, err = c.Seek(pair.Key); err != nil {
+					return err
+				}
+			}
+			k, v, err = c.Next()
+
+			size += len(pair.Key) + len(pair.Value)
+			if size >= MaxBatchBytes {
+				break
+			}
+		}
+
+		if err := stream.Send(batch); err != nil {
+			return err
+		}
+		if batch.Pairs[len(batch.Pairs)-1].Key == nil {
+			return nil
+		}
+
+		// if client not requested stream then wait signal from him before send next batch
+		if !in.StartSreaming {
+			in, recvErr = stream.Recv()
+			if recvErr != nil {
+				if recvErr == io.EOF {
+					return nil
+				}
+				return recvErr
+			}
+		}
+	}
+}
+
+func (s *KvServer) Update(stream remote.KV_UpdateServer) error {
+	if err := s.authorizeWrite(stream.Context()); err != nil {
+		return err
+	}
+
+	var applied uint64
+	if err := s.kv.Update(stream.Context(), func(tx ethdb.Tx) error {
+		cursors := make(map[string]ethdb.Cursor)
+		for {
+			in, err := stream.Recv()
+			if err != nil {
+				if err == io.EOF {
+					return status.Error(codes.Aborted, "transaction closed without commit")
+				}
+				return err
+			}
+			if in.Commit {
+				return nil
+			}
+
+			c, ok := cursors[in.BucketName]
+			if !ok {
+				if _, ok = dbutils.BucketsCfg[in.BucketName]; !ok {
+					return status.Errorf(codes.InvalidArgument, "unknown bucket %q", in.BucketName)
+				}
+				c = tx.Cursor(in.BucketName)
+				cursors[in.BucketName] = c
+			}
+			if in.Delete {
+				err = c.Delete(in.Key)
+			} else {
+				err = c.Put(in.Key, in.Value)
+			}
+			if err != nil {
+				return err
+			}
+			applied++
+		}
+	}); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&remote.UpdateReply{Mutations: applied})
+}
+
+func (s *KvServer) MultiGet(in *remote.MultiGetRequest, stream remote.KV_MultiGetServer) error {
+	if _, ok := dbutils.BucketsCfg[in.BucketName]; !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown bucket %q", in.BucketName)
+	}
+	return s.kv.View(stream.Context(), func(tx ethdb.Tx) error {
+		values, err := tx.MultiGet(in.BucketName, in.Keys)
+		if err != nil {
+			return err
+		}
+		// the values are sent within the transaction, missing keys as pairs without key
+		batch := &remote.Pairs{}
+		size := 0
+		for i, v := range values {
+			pair := &remote.Pair{}
+			if v != nil {
+				pair.Key, pair.Value = in.Keys[i], v
+			}
+			batch.Pairs = append(batch.Pairs, pair)
+			size += len(pair.Key) + len(pair.Value)
+			if size >= MaxBatchBytes || i == len(values)-1 {
+				if err := stream.Send(batch); err != nil {
+					return err
+				}
+				batch, size = &remote.Pairs{}, 0
+			}
+		}
+		return nil
+	})
+}
+
+// Watch needs a database notifying its changes, see ethdb.WatchedKV. The changes of a transaction
+// are sent in messages of up to MaxBatchBytes.
+func (s *KvServer) Watch(in *remote.WatchRequest, stream remote.KV_WatchServer) error {
+	watched, ok := s.kv.(ethdb.HasWatch)
+	if !ok {
+		return status.Error(codes.Unimplemented, "the database doesn't notify changes")
+	}
+	if _, ok = dbutils.BucketsCfg[in.BucketName]; !ok {
+		return status.Errorf(codes.InvalidArgument, "unknown bucket %q", in.BucketName)
+	}
+	changes, err := watched.Watch(stream.Context(), in.BucketName, in.Prefix)
+	if err != nil {
+		return err
+	}
+	if err = stream.Send(&remote.Changes{}); err != nil {
+		return err
+	}
+	for txChanges := range changes {
+		msg := &remote.Changes{}
+		size := 0
+		for i, change := range txChanges {
+			msg.Changes = append(msg.Changes, &remote.Change{Key: change.Key, Value: change.Value, Delete: change.Delete})
+			size += len(change.Key) + len(change.Value)
+			if size >= MaxBatchBytes || i == len(txChanges)-1 {
+				if err = stream.Send(msg); err != nil {
+					return err
+				}
+				msg, size = &remote.Changes{}, 0
+			}
+		}
+	}
+	if err = stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Aborted, "watch closed, the changes weren't read in time or the database closed")
+}
+
+// authorizeWrite checks the token sent by the client in the authorization metadata.
+func (s *KvServer) authorizeWrite(ctx context.Context) error {
+	if s.writeToken == "" {
+		return status.Error(codes.PermissionDenied, "writes to the database are disabled")
+	}
+	if !hasToken(ctx, s.writeToken) {
+		return status.Error(codes.Unauthenticated, "invalid write token")
+	}
+	return nil
+}
+
+// hasToken tells if the token is one of those sent by the client in the authorization
+// metadata, where the token and the write token may both be.
+func hasToken(ctx context.Context, token string) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package ethdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/log"
+)
+
+const (
+	// SizeSampleInterval is the period of the samples of SizeSampler
+	SizeSampleInterval = time.Hour
+	// SizeSamplesKept is how long the samples are kept
+	SizeSamplesKept = 366 * 24 * time.Hour
+)
+
+// SizeSample is the size of the database files and of its buckets at a time.
+type SizeSample struct {
+	Time    time.Time
+	Total   uint64 // of the files, 0 if the KV doesn't tell
+	Buckets map[string]uint64
+}
+
+// SampleSize measures the size of the database and of every bucket.
+func SampleSize(ctx context.Context, kv KV) (*SizeSample, error) {
+	sample := &SizeSample{Time: time.Now(), Buckets: make(map[string]uint64, len(dbutils.Buckets))}
+	if stats, ok := kv.(HasStats); ok {
+		var err error
+		if sample.Total, err = stats.DiskSize(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := kv.View(ctx, func(tx Tx) error {
+		for _, name := range dbutils.Buckets {
+			size, err := tx.BucketSize(name)
+			if err != nil {
+				return err
+			}
+			sample.Buckets[name] = size
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return sample, nil
+}
+
+func sizeSampleKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	if t.Unix() > 0 {
+		binary.BigEndian.PutUint64(k, uint64(t.Unix()))
+	}
+	return k
+}
+
+// WriteSizeSample stores the sample in DatabaseSizeBucket, the value is the uvarint total
+// followed by the uvarint length of the name, the name and the uvarint size of every bucket.
+func WriteSizeSample(tx Tx, sample *SizeSample) error {
+	var buf [binary.MaxVarintLen64]byte
+	v := append([]byte{}, buf[:binary.PutUvarint(buf[:], sample.Total)]...)
+	for name, size := range sample.Buckets {
+		v = append(v, buf[:binary.PutUvarint(buf[:], uint64(len(name)))]...)
+		v = append(v, name...)
+		v = append(v, buf[:binary.PutUvarint(buf[:], size)]...)
+	}
+	return tx.Cursor(dbutils.DatabaseSizeBucket).Put(sizeSampleKey(sample.Time), v)
+}
+
+func decodeSizeSample(k, v []byte) (*SizeSample, error) {
+	if len(k) != 8 {
+		return nil, fmt.Errorf("size sample key of %d bytes", len(k))
+	}
+	sample := &SizeSample{Time: time.Unix(int64(binary.BigEndian.Uint64(k)), 0), Buckets: map[string]uint64{}}
+	var n int
+	if sample.Total, n = binary.Uvarint(v); n <= 0 {
+		return nil, fmt.Errorf("size sample of %s: invalid total", sample.Time)
+	}
+	for v = v[n:]; len(v) > 0; {
+		nameLen, n := binary.Uvarint(v)
+		if n <= 0 || uint64(len(v)-n) < nameLen {
+			return nil, fmt.Errorf("size sample of %s: invalid bucket name", sample.Time)
+		}
+		name := string(v[n : n+int(nameLen)])
+		v = v[n+int(nameLen):]
+		size, n := binary.Uvarint(v)
+		if n <= 0 {
+			return nil, fmt.Errorf("size sample of %s: invalid size of %s", sample.Time, name)
+		}
+		sample.Buckets[name] = size
+		v = v[n:]
+	}
+	return sample, nil
+}
+
+// ReadSizeSamples returns the samples taken since the time, oldest first.
+func ReadSizeSamples(tx Tx, since time.Time) ([]*SizeSample, error) {
+	var samples []*SizeSample
+	c := tx.Cursor(dbutils.DatabaseSizeBucket)
+	for k, v, err := c.Seek(sizeSampleKey(since)); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, err
+		}
+		sample, err := decodeSizeSample(k, v)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// PruneSizeSamples deletes the samples taken before the time.
+func PruneSizeSamples(tx Tx, before time.Time) error {
+	end := sizeSampleKey(before)
+	c := tx.Cursor(dbutils.DatabaseSizeBucket)
+	for k, _, err := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _, err = c.First() {
+		if err != nil {
+			return err
+		}
+		if err = c.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SizeGrowth is the growth of the total and of every bucket in bytes per day, the slope of
+// the least squares line through the samples. It is 0 with less than two samples.
+func SizeGrowth(samples []*SizeSample) (total float64, buckets map[string]float64) {
+	buckets = map[string]float64{}
+	if len(samples) < 2 {
+		return 0, buckets
+	}
+	days := make([]float64, len(samples))
+	for i, sample := range samples {
+		days[i] = sample.Time.Sub(samples[0].Time).Hours() / 24
+	}
+	total = slope(days, func(i int) uint64 { return samples[i].Total })
+	for name := range samples[len(samples)-1].Buckets {
+		buckets[name] = slope(days, func(i int) uint64 { return samples[i].Buckets[name] })
+	}
+	return total, buckets
+}
+
+func slope(xs []float64, y func(i int) uint64) float64 {
+	var meanX, meanY float64
+	for i, x := range xs {
+		meanX += x
+		meanY += float64(y(i))
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(xs))
+	var cov, varX float64
+	for i, x := range xs {
+		cov += (x - meanX) * (float64(y(i)) - meanY)
+		varX += (x - meanX) * (x - meanX)
+	}
+	if varX == 0 {
+		return 0
+	}
+	return cov / varX
+}
+
+// SizeSampler stores a sample of the size of the database every SizeSampleInterval and
+// deletes those older than SizeSamplesKept, for the growth of the database to be known.
+type SizeSampler struct {
+	kv   KV
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewSizeSampler(kv KV) *SizeSampler {
+	return &SizeSampler{kv: kv, stop: make(chan struct{})}
+}
+
+func (s *SizeSampler) Start() {
+	s.wg.Add(1)
+	go s.loop()
+}
+
+func (s *SizeSampler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *SizeSampler) loop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(SizeSampleInterval)
+	defer ticker.Stop()
+	// the restarts don't sample more often than every SizeSampleInterval
+	var last time.Time
+	if err := s.kv.View(context.Background(), func(tx Tx) error {
+		k, _, err := tx.Cursor(dbutils.DatabaseSizeBucket).Last()
+		if len(k) == 8 {
+			last = time.Unix(int64(binary.BigEndian.Uint64(k)), 0)
+		}
+		return err
+	}); err != nil {
+		log.Warn("Failed to read the last sample of the database size", "err", err)
+	}
+	if time.Since(last) >= SizeSampleInterval {
+		s.sample()
+	}
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+func (s *SizeSampler) sample() {
+	ctx := context.Background()
+	sample, err := SampleSize(ctx, s.kv)
+	if err == nil {
+		err = s.kv.Update(ctx, func(tx Tx) error {
+			if err := WriteSizeSample(tx, sample); err != nil {
+				return err
+			}
+			return PruneSizeSamples(tx, sample.Time.Add(-SizeSamplesKept))
+		})
+	}
+	if err != nil {
+		log.Warn("Failed to sample the database size", "err", err)
+	}
+}
@@ -0,0 +1,59 @@
+package ethdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizeSamples(t *testing.T) {
+	ctx := context.Background()
+	kv := NewLMDB().InMem().MustOpen()
+	defer kv.Close()
+
+	sample, err := SampleSize(ctx, kv)
+	require.NoError(t, err)
+	assert.Len(t, sample.Buckets, len(dbutils.Buckets))
+
+	start := time.Unix(1600000000, 0)
+	require.NoError(t, kv.Update(ctx, func(tx Tx) error {
+		for day := 0; day < 10; day++ {
+			if err := WriteSizeSample(tx, &SizeSample{
+				Time:    start.Add(time.Duration(day) * 24 * time.Hour),
+				Total:   1000 + uint64(day)*100,
+				Buckets: map[string]uint64{dbutils.PlainStateBucket: 500 + uint64(day)*10, dbutils.CodeBucket: 7},
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	require.NoError(t, kv.Update(ctx, func(tx Tx) error {
+		samples, err := ReadSizeSamples(tx, start.Add(5*24*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, samples, 5)
+		assert.Equal(t, start.Add(5*24*time.Hour), samples[0].Time)
+		assert.Equal(t, uint64(1500), samples[0].Total)
+		assert.Equal(t, map[string]uint64{dbutils.PlainStateBucket: 550, dbutils.CodeBucket: 7}, samples[0].Buckets)
+
+		total, buckets := SizeGrowth(samples)
+		assert.InDelta(t, 100, total, 1e-9)
+		assert.InDelta(t, 10, buckets[dbutils.PlainStateBucket], 1e-9)
+		assert.InDelta(t, 0, buckets[dbutils.CodeBucket], 1e-9)
+
+		total, _ = SizeGrowth(samples[:1])
+		assert.Zero(t, total)
+
+		require.NoError(t, PruneSizeSamples(tx, start.Add(8*24*time.Hour)))
+		samples, err = ReadSizeSamples(tx, time.Time{})
+		require.NoError(t, err)
+		require.Len(t, samples, 2)
+		assert.Equal(t, start.Add(8*24*time.Hour), samples[0].Time)
+		return nil
+	}))
+}
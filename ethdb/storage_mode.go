@@ -8,9 +8,10 @@ import (
 )
 
 type StorageMode struct {
-	History   bool
-	Receipts  bool
-	TxIndex   bool
+	History     bool
+	Receipts    bool
+	TxIndex     bool
+	Compression bool // of the values of the receipts and the code, see CompressedKV
 }
 
 var DefaultStorageMode = StorageMode{History: true, Receipts: true, TxIndex: true}
@@ -26,6 +27,9 @@ func (m StorageMode) ToString() string {
 	if m.TxIndex {
 		modeString += "t"
 	}
+	if m.Compression {
+		modeString += "c"
+	}
 	return modeString
 }
 
@@ -39,6 +43,8 @@ func StorageModeFromString(flags string) (StorageMode, error) {
 			mode.Receipts = true
 		case 't':
 			mode.TxIndex = true
+		case 'c':
+			mode.Compression = true
 		default:
 			return mode, fmt.Errorf("unexpected flag found: %c", flag)
 		}
@@ -71,6 +77,12 @@ func GetStorageModeFromDB(db Database) (StorageMode, error) {
 	}
 	sm.TxIndex = len(v) == 1 && v[0] == 1
 
+	v, err = db.Get(dbutils.DatabaseInfoBucket, dbutils.StorageModeCompression)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return StorageMode{}, err
+	}
+	sm.Compression = len(v) == 1 && v[0] == 1
+
 	return sm, nil
 }
 
@@ -93,6 +105,11 @@ func SetStorageModeIfNotExist(db Database, sm StorageMode) error {
 		return err
 	}
 
+	err = setModeOnEmpty(db, dbutils.StorageModeCompression, sm.Compression)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -22,6 +22,7 @@ func TestSetStorageModeIfNotExist(t *testing.T) {
 		true,
 		true,
 		true,
+		true,
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -36,8 +37,38 @@ func TestSetStorageModeIfNotExist(t *testing.T) {
 		true,
 		true,
 		true,
+		true,
 	}) {
 		spew.Dump(sm)
 		t.Fatal("not equal")
 	}
 }
+
+func TestPruneMode(t *testing.T) {
+	pm, err := PruneModeFromString("h=90000,t=1000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pm, PruneMode{History: 90000, TxIndex: 1000000}) {
+		t.Fatal("not equal", pm)
+	}
+	if pm.ToString() != "h=90000,t=1000000" {
+		t.Fatal("not equal", pm.ToString())
+	}
+	if _, err = PruneModeFromString("h"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	db := NewMemDatabase()
+	if err = SetPruneMode(db, pm); err != nil {
+		t.Fatal(err)
+	}
+	fromDB, err := GetPruneModeFromDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pm, fromDB) {
+		spew.Dump(fromDB)
+		t.Fatal("not equal")
+	}
+}
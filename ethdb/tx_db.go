@@ -20,7 +20,7 @@ type TxDb struct {
 	db       Database
 	Tx       Tx
 	ParentTx Tx
-	cursors  map[string]*LmdbCursor
+	cursors  map[string]Cursor
 	len      uint64
 }
 
@@ -65,12 +65,15 @@ func (m *TxDb) begin(parent Tx) error {
 	}
 	m.Tx = tx
 	m.ParentTx = parent
-	m.cursors = make(map[string]*LmdbCursor, 16)
+	m.cursors = make(map[string]Cursor, 16)
 	for i := range dbutils.Buckets {
-		m.cursors[dbutils.Buckets[i]] = tx.Cursor(dbutils.Buckets[i]).(*LmdbCursor)
-		if err := m.cursors[dbutils.Buckets[i]].initCursor(); err != nil {
-			return err
+		c := tx.Cursor(dbutils.Buckets[i])
+		if lmdbCursor, ok := c.(*LmdbCursor); ok {
+			if err := lmdbCursor.initCursor(); err != nil {
+				return err
+			}
 		}
+		m.cursors[dbutils.Buckets[i]] = c
 	}
 	return nil
 }
@@ -181,6 +181,22 @@ web3._extend({
 			call: 'admin_importChain',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'backup',
+			call: 'admin_backup',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'abortBackup',
+			call: 'admin_abortBackup'
+		}),
+		new web3._extend.Method({
+			name: 'prune',
+			call: 'admin_prune',
+			params: 1,
+			inputFormatter: [null]
+		}),
 		new web3._extend.Method({
 			name: 'sleepBlocks',
 			call: 'admin_sleepBlocks',
@@ -220,6 +236,14 @@ web3._extend({
 			name: 'datadir',
 			getter: 'admin_datadir'
 		}),
+		new web3._extend.Property({
+			name: 'backupStatus',
+			getter: 'admin_backupStatus'
+		}),
+		new web3._extend.Property({
+			name: 'pruneMode',
+			getter: 'admin_pruneMode'
+		}),
 	]
 });
 `
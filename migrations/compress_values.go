@@ -0,0 +1,134 @@
+package migrations
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/ledgerwatch/turbo-geth/common"
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+)
+
+const (
+	dictSamples    = 4096
+	dictSampleSize = 4096 // bytes, the start of the larger values is sampled
+)
+
+// compressPartSize is the size of the values compressed in a part, committed with the
+// progress of the migration. The ideal batch size of the database if 0, tests set it.
+var compressPartSize = 0
+
+var compressReceipts = Migration{
+	Name: "compress_receipts",
+	Up: func(db ethdb.Database, datadir string, OnLoadCommit etl.LoadCommitHandler) error {
+		return compressBucket(db, "compress_receipts", dbutils.BlockReceiptsPrefix, OnLoadCommit)
+	},
+}
+
+var compressCode = Migration{
+	Name: "compress_code",
+	Up: func(db ethdb.Database, datadir string, OnLoadCommit etl.LoadCommitHandler) error {
+		return compressBucket(db, "compress_code", dbutils.CodeBucket, OnLoadCommit)
+	},
+}
+
+// compressBucket compresses the values of the bucket in place if the storage mode compresses, with
+// a dictionary trained from a sample of them, see ethdb.CompressedKV. The values are compressed
+// in parts, each committed with the last key compressed as the progress of the migration name,
+// and an interrupted migration resumes after it. The dictionary is written with the first part,
+// the bucket is compressed once it is there and the migration is applied.
+func compressBucket(db ethdb.Database, name, bucket string, OnLoadCommit etl.LoadCommitHandler) error {
+	sm, err := ethdb.GetStorageModeFromDB(db)
+	if err != nil {
+		return err
+	}
+	if !sm.Compression {
+		return OnLoadCommit(db, nil, true)
+	}
+	progress, err := Progress(db, name)
+	if err != nil {
+		return err
+	}
+	dictKey := []byte(dbutils.CompressionDictPrefix + bucket)
+	dict, err := db.Get(dbutils.DatabaseInfoBucket, dictKey)
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return err
+	}
+	if len(dict) > 0 && progress == nil {
+		return OnLoadCommit(db, nil, true)
+	}
+	// the values up to progress are compressed with the dictionary of the first part
+	if progress == nil {
+		if dict, err = trainDictionary(db, bucket); err != nil {
+			return err
+		}
+	}
+	codec := ethdb.NewValueCodec(dict)
+
+	partSize := compressPartSize
+	if partSize == 0 {
+		partSize = db.IdealBatchSize()
+	}
+	batch := db.NewBatch()
+	defer batch.Rollback()
+	if err = batch.Put(dbutils.DatabaseInfoBucket, dictKey, dict); err != nil {
+		return err
+	}
+	start := []byte{}
+	if progress != nil {
+		// the first key after progress
+		start = append(common.CopyBytes(progress), 0)
+	}
+	for start != nil {
+		var last, next []byte
+		if err = db.Walk(bucket, start, 0, func(k, v []byte) (bool, error) {
+			if last != nil && batch.BatchSize() >= partSize {
+				next = common.CopyBytes(k)
+				return false, nil
+			}
+			last = common.CopyBytes(k)
+			return true, batch.Put(bucket, last, codec.Encode(v))
+		}); err != nil {
+			return err
+		}
+		if start = next; start == nil {
+			break
+		}
+		if err = OnLoadCommit(batch, last, false); err != nil {
+			return err
+		}
+		if err = batch.CommitAndBegin(); err != nil {
+			return err
+		}
+	}
+	if err = OnLoadCommit(batch, nil, true); err != nil {
+		return err
+	}
+	_, err = batch.Commit()
+	return err
+}
+
+// trainDictionary returns the dictionary trained from a sample of the values of the bucket.
+func trainDictionary(db ethdb.Getter, bucket string) ([]byte, error) {
+	// reservoir sampling, for the samples to be spread over the bucket
+	var samples [][]byte
+	extracted := 0
+	random := rand.New(rand.NewSource(1))
+	if err := db.Walk(bucket, nil, 0, func(k, v []byte) (bool, error) {
+		extracted++
+		sample := v
+		if len(sample) > dictSampleSize {
+			sample = sample[:dictSampleSize]
+		}
+		if len(samples) < dictSamples {
+			samples = append(samples, common.CopyBytes(sample))
+		} else if i := random.Intn(extracted); i < dictSamples {
+			samples[i] = common.CopyBytes(sample)
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	return ethdb.TrainDictionary(bucket, samples), nil
+}
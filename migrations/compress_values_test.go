@@ -0,0 +1,122 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/turbo-geth/common/dbutils"
+	"github.com/ledgerwatch/turbo-geth/common/etl"
+	"github.com/ledgerwatch/turbo-geth/ethdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressValues(t *testing.T) {
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	require.NoError(ethdb.SetStorageModeIfNotExist(db, ethdb.StorageMode{Compression: true}))
+
+	receipt := bytes.Repeat([]byte{0xdd, 0xf2, 0x52, 0xad, 0x1b, 0xe2, 0xc8, 0x9b}, 20)
+	code := bytes.Repeat([]byte{0x60, 0x80, 0x60, 0x40, 0x52}, 100)
+	for i := byte(0); i < 10; i++ {
+		require.NoError(db.Put(dbutils.BlockReceiptsPrefix, []byte{i}, append(receipt, i)))
+		require.NoError(db.Put(dbutils.CodeBucket, []byte{i}, append(code, i)))
+	}
+	require.NoError(db.Put(dbutils.CodeBucket, []byte{10}, []byte{1}))
+
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{compressReceipts, compressCode}
+	require.NoError(migrator.Apply(db, ""))
+
+	for _, bucket := range []string{dbutils.BlockReceiptsPrefix, dbutils.CodeBucket} {
+		dict, err := db.Get(dbutils.DatabaseInfoBucket, []byte(dbutils.CompressionDictPrefix+bucket))
+		require.NoError(err)
+		require.NotEmpty(dict)
+	}
+	stored, err := db.Get(dbutils.CodeBucket, []byte{1})
+	require.NoError(err)
+	require.Less(len(stored), len(code))
+
+	kv, err := ethdb.WithCompression(db.KV())
+	require.NoError(err)
+	require.NoError(kv.View(context.Background(), func(tx ethdb.Tx) error {
+		for i := byte(0); i < 10; i++ {
+			v, err := tx.Get(dbutils.BlockReceiptsPrefix, []byte{i})
+			require.NoError(err)
+			require.Equal(append(receipt, i), v)
+			v, err = tx.Get(dbutils.CodeBucket, []byte{i})
+			require.NoError(err)
+			require.Equal(append(code, i), v)
+		}
+		v, err := tx.Get(dbutils.CodeBucket, []byte{10})
+		require.NoError(err)
+		require.Equal([]byte{1}, v)
+		return nil
+	}))
+}
+
+func TestCompressValuesResume(t *testing.T) {
+	defer func(size int) { compressPartSize = size }(compressPartSize)
+	compressPartSize = 1 // a value by part
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	require.NoError(ethdb.SetStorageModeIfNotExist(db, ethdb.StorageMode{Compression: true}))
+	code := bytes.Repeat([]byte{0x60, 0x80, 0x60, 0x40, 0x52}, 100)
+	for i := byte(0); i < 10; i++ {
+		require.NoError(db.Put(dbutils.CodeBucket, []byte{i}, append(code, i)))
+	}
+
+	interrupted := errors.New("interrupted")
+	parts := 0
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{{
+		Name: compressCode.Name,
+		Up: func(db ethdb.Database, datadir string, OnLoadCommit etl.LoadCommitHandler) error {
+			return compressCode.Up(db, datadir, func(putter ethdb.Putter, key []byte, isDone bool) error {
+				if parts++; parts == 4 {
+					return interrupted
+				}
+				return OnLoadCommit(putter, key, isDone)
+			})
+		},
+	}}
+	require.True(errors.Is(migrator.Apply(db, ""), interrupted))
+	progress, err := Progress(db, compressCode.Name)
+	require.NoError(err)
+	require.Equal([]byte{2}, progress)
+	for i := byte(0); i < 10; i++ {
+		stored, err := db.Get(dbutils.CodeBucket, []byte{i})
+		require.NoError(err)
+		require.Equal(i > 2, bytes.Equal(append(code, i), stored), "value %d", i)
+	}
+
+	// resumed after the values compressed, which aren't compressed twice
+	migrator.Migrations = []Migration{compressCode}
+	require.NoError(migrator.Apply(db, ""))
+	kv, err := ethdb.WithCompression(db.KV())
+	require.NoError(err)
+	require.NoError(kv.View(context.Background(), func(tx ethdb.Tx) error {
+		for i := byte(0); i < 10; i++ {
+			v, err := tx.Get(dbutils.CodeBucket, []byte{i})
+			require.NoError(err)
+			require.Equal(append(code, i), v)
+		}
+		return nil
+	}))
+}
+
+func TestCompressValuesDisabled(t *testing.T) {
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	require.NoError(ethdb.SetStorageModeIfNotExist(db, ethdb.StorageMode{}))
+	code := bytes.Repeat([]byte{0x60, 0x80, 0x60, 0x40, 0x52}, 100)
+	require.NoError(db.Put(dbutils.CodeBucket, []byte{1}, code))
+
+	migrator := NewMigrator()
+	migrator.Migrations = []Migration{compressReceipts, compressCode}
+	require.NoError(migrator.Apply(db, ""))
+
+	v, err := db.Get(dbutils.CodeBucket, []byte{1})
+	require.NoError(err)
+	require.Equal(code, v)
+	_, err = db.Get(dbutils.DatabaseInfoBucket, []byte(dbutils.CompressionDictPrefix+dbutils.CodeBucket))
+	require.True(err == ethdb.ErrKeyNotFound)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ledgerwatch/turbo-geth/common"
 	"github.com/ledgerwatch/turbo-geth/common/dbutils"
@@ -52,6 +53,8 @@ import (
 //	},
 // - if you need migrate multiple buckets - create separate migration for each bucket
 // - write test where apply migration twice
+// - a long migration may commit in parts, calling OnLoadCommit with isDone false and the last key committed,
+//   on restart it resumes from Progress(db, name) instead of starting over
 var migrations = []Migration{
 	stagesToUseNamedKeys,
 	unwindStagesToUseNamedKeys,
@@ -59,6 +62,8 @@ var migrations = []Migration{
 	unwindStagedsyncToUseStageBlockhashes,
 	dupSortHashState,
 	dupSortPlainState,
+	compressReceipts,
+	compressCode,
 }
 
 type Migration struct {
@@ -79,6 +84,7 @@ func NewMigrator() *Migrator {
 
 type Migrator struct {
 	Migrations []Migration
+	DryRun     bool // only log the migrations which would be applied
 }
 
 func AppliedMigrations(db ethdb.Database, withPayload bool) (map[string][]byte, error) {
@@ -94,14 +100,11 @@ func AppliedMigrations(db ethdb.Database, withPayload bool) (map[string][]byte,
 	return applied, err
 }
 
-func (m *Migrator) Apply(db ethdb.Database, datadir string) error {
-	if len(m.Migrations) == 0 {
-		return nil
-	}
-
+// PendingMigrations returns the migrations not applied to db yet, in the order they apply.
+func (m *Migrator) PendingMigrations(db ethdb.Database) ([]Migration, error) {
 	applied, err := AppliedMigrations(db, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// migration names must be unique, protection against people's mistake
@@ -109,23 +112,67 @@ func (m *Migrator) Apply(db ethdb.Database, datadir string) error {
 	for i := range m.Migrations {
 		_, ok := uniqueNameCheck[m.Migrations[i].Name]
 		if ok {
-			return fmt.Errorf("%w, duplicate: %s", ErrMigrationNonUniqueName, m.Migrations[i].Name)
+			return nil, fmt.Errorf("%w, duplicate: %s", ErrMigrationNonUniqueName, m.Migrations[i].Name)
 		}
 		uniqueNameCheck[m.Migrations[i].Name] = true
 	}
+	for name := range applied {
+		if !uniqueNameCheck[name] {
+			log.Warn("Database has a migration unknown to this version, it may be written by a newer one", "name", name)
+		}
+	}
 
+	var pending []Migration
 	for i := range m.Migrations {
-		v := m.Migrations[i]
-		if _, ok := applied[v.Name]; ok {
-			continue
+		if _, ok := applied[m.Migrations[i].Name]; !ok {
+			pending = append(pending, m.Migrations[i])
+		}
+	}
+	return pending, nil
+}
+
+// Progress returns the last key committed by the unfinished migration name, nil if it didn't
+// commit a part.
+func Progress(db ethdb.Getter, name string) ([]byte, error) {
+	v, err := db.Get(dbutils.DatabaseInfoBucket, []byte(dbutils.MigrationProgressPrefix+name))
+	if err != nil && !errors.Is(err, ethdb.ErrKeyNotFound) {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (m *Migrator) Apply(db ethdb.Database, datadir string) error {
+	if len(m.Migrations) == 0 {
+		return nil
+	}
+
+	pending, err := m.PendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if m.DryRun {
+		for i := range pending {
+			log.Info("Would apply migration", "name", pending[i].Name, "step", fmt.Sprintf("%d/%d", i+1, len(pending)))
+		}
+		return nil
+	}
+
+	for i := range pending {
+		v := pending[i]
+		progressKey := []byte(dbutils.MigrationProgressPrefix + v.Name)
+		progress, err := Progress(db, v.Name)
+		if err != nil {
+			return err
 		}
 
 		commitFuncCalled := false // commit function must be called if no error, protection against people's mistake
 
-		log.Info("Apply migration", "name", v.Name)
+		log.Info("Apply migration", "name", v.Name, "step", fmt.Sprintf("%d/%d", i+1, len(pending)), "resumed from", fmt.Sprintf("%x", progress))
+		started := time.Now()
 		if err := v.Up(db, datadir, func(putter ethdb.Putter, key []byte, isDone bool) error {
 			if !isDone {
-				return nil // don't save partial progress
+				log.Info("Migration progress", "name", v.Name, "key", fmt.Sprintf("%x", key), "in", time.Since(started))
+				return putter.Put(dbutils.DatabaseInfoBucket, progressKey, common.CopyBytes(key))
 			}
 			commitFuncCalled = true
 
@@ -139,13 +186,17 @@ func (m *Migrator) Apply(db ethdb.Database, datadir string) error {
 			}
 			return nil
 		}); err != nil {
-			return err
+			return fmt.Errorf("migration %s: %w", v.Name, err)
 		}
 
 		if !commitFuncCalled {
 			return fmt.Errorf("%w: %s", ErrMigrationCommitNotCalled, v.Name)
 		}
-		log.Info("Applied migration", "name", v.Name)
+		// the progress isn't read once the migration is applied, it's dropped after
+		if err := db.Delete(dbutils.DatabaseInfoBucket, progressKey); err != nil {
+			return err
+		}
+		log.Info("Applied migration", "name", v.Name, "in", time.Since(started))
 	}
 	return nil
 }
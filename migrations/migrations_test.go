@@ -199,3 +199,66 @@ func TestCommitCallRequired(t *testing.T) {
 	require.NoError(err)
 	require.Equal(0, len(applied))
 }
+
+func TestDryRun(t *testing.T) {
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	migrations = []Migration{
+		{
+			"one",
+			func(db ethdb.Database, datadir string, OnLoadCommit etl.LoadCommitHandler) error {
+				t.Fatal("shouldn't been executed")
+				return nil
+			},
+		},
+	}
+	migrator := NewMigrator()
+	migrator.Migrations = migrations
+	migrator.DryRun = true
+	err := migrator.Apply(db, "")
+	require.NoError(err)
+
+	pending, err := migrator.PendingMigrations(db)
+	require.NoError(err)
+	require.Equal(1, len(pending))
+	require.Equal("one", pending[0].Name)
+}
+
+func TestResume(t *testing.T) {
+	require, db := require.New(t), ethdb.NewMemDatabase()
+	interrupted := errors.New("interrupted")
+	var resumedFrom []byte
+	migrations = []Migration{
+		{
+			"one",
+			func(db ethdb.Database, datadir string, OnLoadCommit etl.LoadCommitHandler) error {
+				progress, err := Progress(db, "one")
+				if err != nil {
+					return err
+				}
+				if progress == nil {
+					if err := OnLoadCommit(db, []byte("key"), false); err != nil {
+						return err
+					}
+					return interrupted
+				}
+				resumedFrom = progress
+				return OnLoadCommit(db, nil, true)
+			},
+		},
+	}
+	migrator := NewMigrator()
+	migrator.Migrations = migrations
+	err := migrator.Apply(db, "")
+	require.True(errors.Is(err, interrupted))
+
+	err = migrator.Apply(db, "")
+	require.NoError(err)
+	require.Equal([]byte("key"), resumedFrom)
+
+	progress, err := Progress(db, "one")
+	require.NoError(err)
+	require.Nil(progress)
+	pending, err := migrator.PendingMigrations(db)
+	require.NoError(err)
+	require.Equal(0, len(pending))
+}
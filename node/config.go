@@ -179,14 +179,28 @@ type Config struct {
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
-	// Whether to use BoltDB or LMDB.
-	LMDB bool
-	Bolt bool
+	// Whether to use BoltDB, LMDB or Badger.
+	LMDB   bool
+	Bolt   bool
+	Badger bool
 
 	// Address to listen to when launchig listener for remote database access
 	// empty string means not to start the listener
 	PrivateApiAddr string
 
+	// Certificate and key the remote database is served with over TLS, plaintext if empty,
+	// and the CAs of the certificates clients must then present, any client if empty
+	PrivateApiTLSCert   string
+	PrivateApiTLSKey    string
+	PrivateApiTLSCACert string
+
+	// Token the clients of the remote database must send, any client if empty
+	PrivateApiToken string
+
+	// Token the clients of the remote database must send to write to it,
+	// empty string means the remote database is read-only
+	PrivateApiWriteToken string
+
 	staticNodesWarning     bool
 	trustedNodesWarning    bool
 	oldGethResourceWarning bool
@@ -561,6 +561,9 @@ func (n *Node) OpenDatabaseWithFreezer(name string, _, _ int, _, _ string) (*eth
 	} else if n.config.Bolt {
 		log.Info("Opening Database (Bolt)")
 		db, err = ethdb.Open(n.config.ResolvePath(name + "_bolt"))
+	} else if n.config.Badger {
+		log.Info("Opening Database (Badger)")
+		db, err = ethdb.Open(n.config.ResolvePath(name + "_badger"))
 	} else {
 		log.Info("Opening Database (LMDB)")
 		db, err = ethdb.Open(n.config.ResolvePath(name))
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
 
 	"github.com/holiman/uint256"
@@ -24,6 +23,7 @@ type StateReader struct {
 	codeReads    map[common.Address]struct{}
 	blockNr      uint64
 	db           ethdb.KV
+	view         *state.HistoryView
 	storage      map[common.Address]*llrb.LLRB
 }
 
@@ -33,6 +33,7 @@ func NewStateReader(db ethdb.KV, blockNr uint64) *StateReader {
 		storageReads: make(map[common.Address]map[common.Hash]struct{}),
 		codeReads:    make(map[common.Address]struct{}),
 		db:           db,
+		view:         state.NewHistoryView(db, blockNr),
 		blockNr:      blockNr,
 		storage:      make(map[common.Address]*llrb.LLRB),
 	}
@@ -66,8 +67,8 @@ func (r *StateReader) GetCodeReads() [][]byte {
 
 func (r *StateReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
 	r.accountReads[address] = struct{}{}
-	enc, err := state.GetAsOf(r.db, false /* storage */, address[:], r.blockNr+1)
-	if err != nil || enc == nil || len(enc) == 0 {
+	enc, err := r.readPlainState(address[:])
+	if err != nil || enc == nil {
 		return nil, nil
 	}
 	var acc accounts.Account
@@ -85,13 +86,24 @@ func (r *StateReader) ReadAccountStorage(address common.Address, incarnation uin
 	}
 	m[*key] = struct{}{}
 	compositeKey := dbutils.PlainGenerateCompositeStorageKey(address, incarnation, *key)
-	enc, err := state.GetAsOf(r.db, true /* storage */, compositeKey, r.blockNr+1)
+	enc, err := r.readPlainState(compositeKey)
 	if err != nil || enc == nil {
 		return nil, nil
 	}
 	return enc, nil
 }
 
+// readPlainState reads an account or a storage slot as of the block of the reader.
+func (r *StateReader) readPlainState(key []byte) ([]byte, error) {
+	var v []byte
+	err := r.view.View(context.Background(), func(tx ethdb.Tx) error {
+		var err error
+		v, err = tx.Get(dbutils.PlainStateBucket, key)
+		return err
+	})
+	return v, err
+}
+
 func (r *StateReader) ReadAccountCode(address common.Address, codeHash common.Hash) ([]byte, error) {
 	r.codeReads[address] = struct{}{}
 	if bytes.Equal(codeHash[:], crypto.Keccak256(nil)) {
@@ -156,13 +168,13 @@ func (r *StateReader) ForEachStorage(addr common.Address, start []byte, cb func(
 	st := llrb.New()
 	var s [common.AddressLength + common.IncarnationLength + common.HashLength]byte
 	copy(s[:], addr[:])
-	accData, err := state.GetAsOf(r.db, false /* storage */, addr[:], r.blockNr+1)
+	accData, err := r.readPlainState(addr[:])
 	if err != nil {
-		if errors.Is(err, ethdb.ErrKeyNotFound) {
-			return fmt.Errorf("account %x not found at %d", addr, r.blockNr)
-		}
 		return fmt.Errorf("retrieving account %x: %w", addr, err)
 	}
+	if accData == nil {
+		return fmt.Errorf("account %x not found at %d", addr, r.blockNr)
+	}
 	var acc accounts.Account
 	if err := acc.DecodeForStorage(accData); err != nil {
 		return fmt.Errorf("decoding account %x: %w", addr, err)